@@ -17,12 +17,17 @@ import (
 
 // Message types
 const (
-	TypeHello       = "hello"
-	TypeHelloAck    = "hello_ack"
-	TypeAgentInvoke = "agent_invoke"
-	TypeDelta       = "delta"
-	TypeDone        = "done"
-	TypeError       = "error"
+	TypeHello            = "hello"
+	TypeHelloAck         = "hello_ack"
+	TypeAgentInvoke      = "agent_invoke"
+	TypeToolResult       = "tool_result"
+	TypeApprovalDecision = "approval_decision"
+	TypeDelta            = "delta"
+	TypeToolRequest      = "tool_request"
+	TypeToolRequestChunk = "tool_request_chunk"
+	TypeApprovalRequired = "approval_required"
+	TypeDone             = "done"
+	TypeError            = "error"
 )
 
 // BaseMessage contains common fields for all messages.
@@ -45,7 +50,7 @@ type HelloMessage struct {
 // AgentInvokeMessage is sent to invoke an agent.
 type AgentInvokeMessage struct {
 	BaseMessage
-	AgentID string       `json:"agent_id"`
+	AgentID string       `json:"agent_id,omitempty"`
 	Message InputMessage `json:"message"`
 }
 
@@ -55,6 +60,53 @@ type InputMessage struct {
 	Content string `json:"content"`
 }
 
+// ToolResultMessage is sent to submit a client tool execution result.
+type ToolResultMessage struct {
+	BaseMessage
+	ToolCallID string          `json:"tool_call_id"`
+	OK         bool            `json:"ok"`
+	Result     json.RawMessage `json:"result,omitempty"`
+	Error      json.RawMessage `json:"error,omitempty"`
+}
+
+// ApprovalDecisionMessage is sent to approve or reject a pending approval.
+type ApprovalDecisionMessage struct {
+	BaseMessage
+	ApprovalID string `json:"approval_id"`
+	Decision   string `json:"decision"` // "approve" or "reject"
+	Reason     string `json:"reason,omitempty"`
+}
+
+// ToolRequestMessage is sent by the server when a client tool must be executed.
+type ToolRequestMessage struct {
+	BaseMessage
+	ToolCallID string          `json:"tool_call_id"`
+	ToolName   string          `json:"tool_name"`
+	Args       json.RawMessage `json:"args"`
+	DeadlineTs int64           `json:"deadline_ts"`
+}
+
+// ToolRequestChunkMessage carries one fragment of a large tool_request's args.
+type ToolRequestChunkMessage struct {
+	BaseMessage
+	ToolCallID string `json:"tool_call_id"`
+	ToolName   string `json:"tool_name"`
+	DeadlineTs int64  `json:"deadline_ts"`
+	Seq        int    `json:"seq"`
+	Total      int    `json:"total"`
+	Last       bool   `json:"last"`
+	Data       string `json:"data"`
+}
+
+// ApprovalRequiredMessage is sent by the server when a tool call needs approval.
+type ApprovalRequiredMessage struct {
+	BaseMessage
+	ApprovalID  string `json:"approval_id"`
+	ToolCallID  string `json:"tool_call_id"`
+	ToolName    string `json:"tool_name"`
+	ArgsSummary string `json:"args_summary"`
+}
+
 // ErrorMessage represents an error from the server.
 type ErrorMessage struct {
 	BaseMessage
@@ -67,6 +119,9 @@ type Client struct {
 	conn      *websocket.Conn
 	sessionID string
 	done      chan struct{}
+
+	// chunks holds the args fragments received so far per tool call.
+	chunks map[string][]string
 }
 
 // NewClient creates a new client and connects to the server.
@@ -77,8 +132,9 @@ func NewClient(addr string) (*Client, error) {
 	}
 
 	return &Client{
-		conn: conn,
-		done: make(chan struct{}),
+		conn:   conn,
+		done:   make(chan struct{}),
+		chunks: make(map[string][]string),
 	}, nil
 }
 
@@ -149,6 +205,38 @@ func (c *Client) SendAgentInvoke(agentID, content string) error {
 	return c.conn.WriteJSON(msg)
 }
 
+// SendToolResult sends a successful tool_result for a pending tool call.
+func (c *Client) SendToolResult(toolCallID string, result json.RawMessage) error {
+	msg := ToolResultMessage{
+		BaseMessage: BaseMessage{
+			Type:      TypeToolResult,
+			Ts:        time.Now().UnixMilli(),
+			SessionID: c.sessionID,
+		},
+		ToolCallID: toolCallID,
+		OK:         true,
+		Result:     result,
+	}
+
+	return c.conn.WriteJSON(msg)
+}
+
+// SendApprovalDecision sends an approve or reject decision for a pending approval.
+func (c *Client) SendApprovalDecision(approvalID, decision, reason string) error {
+	msg := ApprovalDecisionMessage{
+		BaseMessage: BaseMessage{
+			Type:      TypeApprovalDecision,
+			Ts:        time.Now().UnixMilli(),
+			SessionID: c.sessionID,
+		},
+		ApprovalID: approvalID,
+		Decision:   decision,
+		Reason:     reason,
+	}
+
+	return c.conn.WriteJSON(msg)
+}
+
 // ReadMessages reads and prints messages from the server.
 func (c *Client) ReadMessages() {
 	for {
@@ -170,6 +258,28 @@ func (c *Client) ReadMessages() {
 				continue
 			}
 
+			switch base.Type {
+			case TypeToolRequest:
+				var req ToolRequestMessage
+				if err := json.Unmarshal(data, &req); err == nil {
+					printToolRequest(req)
+					continue
+				}
+			case TypeToolRequestChunk:
+				var chunk ToolRequestChunkMessage
+				if err := json.Unmarshal(data, &chunk); err == nil {
+					c.addToolRequestChunk(chunk)
+					continue
+				}
+			case TypeApprovalRequired:
+				var req ApprovalRequiredMessage
+				if err := json.Unmarshal(data, &req); err == nil {
+					fmt.Printf("\n[approval_required] %s: %s\n", req.ToolName, req.ArgsSummary)
+					fmt.Printf("  Respond with: /approve %s  or  /reject %s [reason]\n", req.ApprovalID, req.ApprovalID)
+					continue
+				}
+			}
+
 			// Pretty print the message
 			var prettyJSON map[string]interface{}
 			json.Unmarshal(data, &prettyJSON)
@@ -179,10 +289,52 @@ func (c *Client) ReadMessages() {
 	}
 }
 
+// addToolRequestChunk stores one fragment of a chunked tool_request and
+// prints the request once all of its fragments have arrived. Fragments are
+// placed by seq, so a replayed one is simply stored again.
+func (c *Client) addToolRequestChunk(chunk ToolRequestChunkMessage) {
+	if chunk.Total <= 0 || chunk.Seq < 0 || chunk.Seq >= chunk.Total {
+		log.Printf("Ignoring tool_request_chunk %d/%d for %s", chunk.Seq, chunk.Total, chunk.ToolCallID)
+		return
+	}
+	parts := c.chunks[chunk.ToolCallID]
+	if len(parts) != chunk.Total {
+		parts = make([]string, chunk.Total)
+	}
+	// Fragments are never empty, so an empty slot is one still to arrive.
+	parts[chunk.Seq] = chunk.Data
+	c.chunks[chunk.ToolCallID] = parts
+	for _, part := range parts {
+		if part == "" {
+			return
+		}
+	}
+	delete(c.chunks, chunk.ToolCallID)
+
+	args := strings.Join(parts, "")
+	if !json.Valid([]byte(args)) {
+		log.Printf("Reassembled tool_request args for %s are not valid JSON", chunk.ToolCallID)
+		return
+	}
+	printToolRequest(ToolRequestMessage{
+		BaseMessage: chunk.BaseMessage,
+		ToolCallID:  chunk.ToolCallID,
+		ToolName:    chunk.ToolName,
+		Args:        json.RawMessage(args),
+		DeadlineTs:  chunk.DeadlineTs,
+	})
+}
+
+// printToolRequest prompts for the result of a client tool call.
+func printToolRequest(req ToolRequestMessage) {
+	fmt.Printf("\n[tool_request] %s wants %s with args %s\n", req.RunID, req.ToolName, string(req.Args))
+	fmt.Printf("  Respond with: /tool %s <json-result>\n", req.ToolCallID)
+}
+
 func main() {
 	addr := flag.String("addr", "ws://localhost:8090/ws", "WebSocket server address")
 	apiKey := flag.String("api-key", "", "API key for authentication")
-	agentID := flag.String("agent", "default", "Agent ID to invoke")
+	agentID := flag.String("agent", "", "Agent ID to invoke (empty uses the orchestrator's DEFAULT_AGENT_ID)")
 	flag.Parse()
 
 	log.SetFlags(log.Ltime)
@@ -203,7 +355,12 @@ func main() {
 
 	fmt.Printf("Session established: %s\n", client.sessionID)
 	fmt.Println("\nType a message and press Enter to send.")
-	fmt.Println("Commands: /quit to exit\n")
+	fmt.Println("Commands:")
+	fmt.Println("  /tool <tool_call_id> <json-result>   submit a client tool result")
+	fmt.Println("  /approve <approval_id>               approve a pending tool call")
+	fmt.Println("  /reject <approval_id> [reason]       reject a pending tool call")
+	fmt.Println("  /quit                                exit")
+	fmt.Println()
 
 	// Start reading messages in background
 	go client.ReadMessages()
@@ -236,6 +393,13 @@ func main() {
 				return
 			}
 
+			if strings.HasPrefix(input, "/") {
+				if err := handleCommand(client, input); err != nil {
+					log.Printf("Command error: %v", err)
+				}
+				continue
+			}
+
 			if err := client.SendAgentInvoke(*agentID, input); err != nil {
 				log.Printf("Send error: %v", err)
 				continue
@@ -245,3 +409,41 @@ func main() {
 		}
 	}
 }
+
+// handleCommand executes a slash command that responds to a pending
+// tool_request or approval_required prompt.
+func handleCommand(client *Client, input string) error {
+	cmd, rest, _ := strings.Cut(input, " ")
+	rest = strings.TrimSpace(rest)
+
+	switch cmd {
+	case "/tool":
+		toolCallID, result, _ := strings.Cut(rest, " ")
+		result = strings.TrimSpace(result)
+		if toolCallID == "" || result == "" {
+			return fmt.Errorf("usage: /tool <tool_call_id> <json-result>")
+		}
+		if !json.Valid([]byte(result)) {
+			return fmt.Errorf("result is not valid JSON: %s", result)
+		}
+		if err := client.SendToolResult(toolCallID, json.RawMessage(result)); err != nil {
+			return err
+		}
+		fmt.Printf("Tool result sent for %s\n", toolCallID)
+
+	case "/approve", "/reject":
+		approvalID, reason, _ := strings.Cut(rest, " ")
+		if approvalID == "" {
+			return fmt.Errorf("usage: %s <approval_id> [reason]", cmd)
+		}
+		decision := strings.TrimPrefix(cmd, "/")
+		if err := client.SendApprovalDecision(approvalID, decision, strings.TrimSpace(reason)); err != nil {
+			return err
+		}
+		fmt.Printf("Approval decision sent: %s %s\n", decision, approvalID)
+
+	default:
+		return fmt.Errorf("unknown command: %s", cmd)
+	}
+	return nil
+}
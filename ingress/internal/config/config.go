@@ -2,48 +2,142 @@
 package config
 
 import (
+	"log/slog"
 	"os"
 	"strconv"
+	"strings"
 	"time"
 )
 
 // Config holds the ingress configuration.
 type Config struct {
 	// Server settings
-	WSPort   int // External WebSocket port
-	RPCPort  int // Internal RPC port for ingress events
+	WSPort  int // External WebSocket port
+	RPCPort int // Internal RPC port for ingress events
 
 	// Orchestrator settings (RPC address)
 	OrchestratorRPCAddr string
+	// EventStreamEnabled keeps an event stream open to the orchestrator, on
+	// which it sends the events of the sessions bound here; IngressID names
+	// this instance on it.
+	EventStreamEnabled bool
+	IngressID          string
 
 	// Auth settings
 	APIKey string // Static API key for hello.api_key validation
+	// hello_ack carries a reconnect token, valid for ReconnectTokenTTL, that a
+	// later hello may present instead of the API key. Replicas must share
+	// ReconnectTokenSecret; empty disables reconnect tokens.
+	ReconnectTokenSecret string
+	ReconnectTokenTTL    time.Duration
 
 	// WebSocket settings
-	PingInterval   time.Duration
-	WriteTimeout   time.Duration
-	ReadTimeout    time.Duration
-	MaxMessageSize int64
+	PingInterval    time.Duration
+	WriteTimeout    time.Duration
+	ReadTimeout     time.Duration
+	ReadBufferSize  int
+	WriteBufferSize int
+	// MaxMessageSize caps every inbound message in bytes (0 disables);
+	// MessageSizeLimits overrides it for individual message types.
+	MaxMessageSize    int64
+	MessageSizeLimits map[string]int64
 
-	// Logging
-	LogLevel string
+	// agent_invoke limits (0 disables)
+	MaxInvokeContentBytes int     // Max length of message.content
+	InvokeRatePerMinute   float64 // Sustained agent_invoke rate per session
+	InvokeBurst           int     // agent_invoke burst allowance per session
+
+	// SessionBindPolicy decides what happens when a hello names a session
+	// that other connections are bound to: SessionBindMulti keeps them all,
+	// SessionBindSingleActive closes the others.
+	SessionBindPolicy string
+
+	// Fan-out limits (0 disables): MaxSessionConnections caps the
+	// connections one session may have bound; SendBytesPerSecond caps the
+	// rate at which each connection is written, with bursts of up to
+	// SendBurstBytes.
+	MaxSessionConnections int
+	SendBytesPerSecond    int
+	SendBurstBytes        int
+
+	// EchoEnabled answers "echo" messages with "echo_reply" (a round-trip
+	// connectivity check); disable to reject them.
+	EchoEnabled bool
+
+	// Logging: LogLevel is debug, info, warn or error; LogFormat is text or
+	// json.
+	LogLevel  string
+	LogFormat string
 }
 
+// Session bind policies.
+const (
+	SessionBindMulti        = "multi"
+	SessionBindSingleActive = "single_active"
+)
+
 // Load loads configuration from environment variables.
 func Load() *Config {
 	return &Config{
-		WSPort:              getEnvInt("WS_PORT", 8090),
-		RPCPort:             getEnvIntWithFallback("RPC_PORT", "HTTP_PORT", 8091),
-		OrchestratorRPCAddr: getEnvWithFallback("ORCHESTRATOR_RPC_ADDR", "ORCHESTRATOR_URL", "orchestrator:8081"),
-		APIKey:              getEnv("API_KEY", ""),
-		PingInterval:        time.Duration(getEnvInt("WS_PING_INTERVAL_MS", 30000)) * time.Millisecond,
-		WriteTimeout:        time.Duration(getEnvInt("WS_WRITE_TIMEOUT_MS", 10000)) * time.Millisecond,
-		ReadTimeout:         time.Duration(getEnvInt("WS_READ_TIMEOUT_MS", 60000)) * time.Millisecond,
-		MaxMessageSize:      int64(getEnvInt("WS_MAX_MESSAGE_SIZE", 65536)),
-		LogLevel:            getEnv("LOG_LEVEL", "info"),
+		WSPort:                getEnvInt("WS_PORT", 8090),
+		RPCPort:               getEnvIntWithFallback("RPC_PORT", "HTTP_PORT", 8091),
+		OrchestratorRPCAddr:   getEnvWithFallback("ORCHESTRATOR_RPC_ADDR", "ORCHESTRATOR_URL", "orchestrator:8081"),
+		EventStreamEnabled:    getEnvBool("EVENT_STREAM_ENABLED", true),
+		IngressID:             getEnv("INGRESS_ID", defaultIngressID()),
+		APIKey:                getEnv("API_KEY", ""),
+		ReconnectTokenSecret:  getEnv("RECONNECT_TOKEN_SECRET", ""),
+		ReconnectTokenTTL:     time.Duration(getEnvInt("RECONNECT_TOKEN_TTL_MS", 300000)) * time.Millisecond,
+		PingInterval:          time.Duration(getEnvInt("WS_PING_INTERVAL_MS", 30000)) * time.Millisecond,
+		WriteTimeout:          time.Duration(getEnvInt("WS_WRITE_TIMEOUT_MS", 10000)) * time.Millisecond,
+		ReadTimeout:           time.Duration(getEnvInt("WS_READ_TIMEOUT_MS", 60000)) * time.Millisecond,
+		ReadBufferSize:        getEnvInt("WS_READ_BUFFER_SIZE", 4096),
+		WriteBufferSize:       getEnvInt("WS_WRITE_BUFFER_SIZE", 4096),
+		MaxMessageSize:        int64(getEnvInt("WS_MAX_MESSAGE_SIZE", 65536)),
+		MessageSizeLimits:     getEnvSizeLimits("WS_MESSAGE_SIZE_LIMITS"),
+		MaxInvokeContentBytes: getEnvInt("MAX_INVOKE_CONTENT_BYTES", 32768),
+		InvokeRatePerMinute:   float64(getEnvInt("INVOKE_RATE_PER_MINUTE", 60)),
+		InvokeBurst:           getEnvInt("INVOKE_BURST", 10),
+		SessionBindPolicy:     getEnv("SESSION_BIND_POLICY", SessionBindMulti),
+		MaxSessionConnections: getEnvInt("MAX_SESSION_CONNECTIONS", 0),
+		SendBytesPerSecond:    getEnvInt("WS_SEND_BYTES_PER_SEC", 0),
+		SendBurstBytes:        getEnvInt("WS_SEND_BURST_BYTES", 65536),
+		EchoEnabled:           getEnvBool("WS_ECHO_ENABLED", true),
+		LogLevel:              getEnv("LOG_LEVEL", "info"),
+		LogFormat:             getEnv("LOG_FORMAT", "text"),
 	}
 }
 
+// MessageSizeLimit returns the size limit for inbound messages of msgType.
+func (c *Config) MessageSizeLimit(msgType string) int64 {
+	if limit, ok := c.MessageSizeLimits[msgType]; ok {
+		return limit
+	}
+	return c.MaxMessageSize
+}
+
+// MaxFrameSize returns the largest inbound message any type may send, or 0
+// when some type is unlimited.
+func (c *Config) MaxFrameSize() int64 {
+	max := c.MaxMessageSize
+	for _, limit := range c.MessageSizeLimits {
+		if max <= 0 || limit <= 0 {
+			return 0
+		}
+		if limit > max {
+			max = limit
+		}
+	}
+	return max
+}
+
+// defaultIngressID is the host name, or "ingress" when it is unknown.
+func defaultIngressID() string {
+	if host, err := os.Hostname(); err == nil && host != "" {
+		return host
+	}
+	return "ingress"
+}
+
 func getEnvWithFallback(primary, fallback, defaultVal string) string {
 	if val := os.Getenv(primary); val != "" {
 		return val
@@ -85,3 +179,36 @@ func getEnvInt(key string, defaultVal int) int {
 	}
 	return defaultVal
 }
+
+func getEnvBool(key string, defaultVal bool) bool {
+	if val := os.Getenv(key); val != "" {
+		if boolVal, err := strconv.ParseBool(val); err == nil {
+			return boolVal
+		}
+	}
+	return defaultVal
+}
+
+// getEnvSizeLimits parses "type=bytes" pairs separated by commas, e.g.
+// "tool_result=1048576,echo=1024". Malformed pairs are skipped.
+func getEnvSizeLimits(key string) map[string]int64 {
+	val := os.Getenv(key)
+	if val == "" {
+		return nil
+	}
+	limits := make(map[string]int64)
+	for _, pair := range strings.Split(val, ",") {
+		name, size, ok := strings.Cut(strings.TrimSpace(pair), "=")
+		if !ok {
+			slog.Warn("ignoring malformed size limit entry", "key", key, "entry", pair)
+			continue
+		}
+		limit, err := strconv.ParseInt(strings.TrimSpace(size), 10, 64)
+		if err != nil || limit < 0 {
+			slog.Warn("ignoring malformed size limit entry", "key", key, "entry", pair)
+			continue
+		}
+		limits[strings.TrimSpace(name)] = limit
+	}
+	return limits
+}
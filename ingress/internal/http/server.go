@@ -3,7 +3,7 @@ package http
 
 import (
 	"context"
-	"log"
+	"encoding/json"
 	"net/http"
 	"time"
 
@@ -11,6 +11,7 @@ import (
 	"github.com/labstack/echo/v4/middleware"
 
 	"github.com/xiaot623/gogo/ingress/internal/hub"
+	"github.com/xiaot623/gogo/ingress/internal/protocol"
 )
 
 // Server is the internal HTTP server for ingress.
@@ -60,31 +61,22 @@ func (s *Server) handleHealth(c echo.Context) error {
 	})
 }
 
-// SendRequest represents the request body for POST /internal/send.
-type SendRequest struct {
-	SessionID string                 `json:"session_id"`
-	Event     map[string]interface{} `json:"event"`
-}
+// SendRequest is the request body for POST /internal/send.
+type SendRequest = protocol.SendRequest
 
-// SendResponse represents the response for POST /internal/send.
-type SendResponse struct {
-	OK        bool `json:"ok"`
-	Delivered bool `json:"delivered"`
-}
+// SendResponse is the response for POST /internal/send.
+type SendResponse = protocol.SendResponse
 
-// handleInternalSend handles event forwarding from orchestrator to WebSocket clients.
+// handleInternalSend handles event forwarding from orchestrator to WebSocket
+// clients. A malformed push is rejected with 400 so the sender does not retry
+// it as if delivery had merely failed.
 func (s *Server) handleInternalSend(c echo.Context) error {
 	var req SendRequest
-	if err := c.Bind(&req); err != nil {
-		return c.JSON(http.StatusBadRequest, map[string]string{"error": "invalid request body"})
+	if err := json.NewDecoder(c.Request().Body).Decode(&req); err != nil {
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": "invalid request body: " + err.Error()})
 	}
-
-	if req.SessionID == "" {
-		return c.JSON(http.StatusBadRequest, map[string]string{"error": "session_id is required"})
-	}
-
-	if req.Event == nil {
-		return c.JSON(http.StatusBadRequest, map[string]string{"error": "event is required"})
+	if err := req.Validate(); err != nil {
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": err.Error()})
 	}
 
 	// Add timestamp if not present
@@ -96,12 +88,12 @@ func (s *Server) handleInternalSend(c echo.Context) error {
 	hasConnections := s.hub.HasActiveConnections(req.SessionID)
 
 	// Broadcast event to session
-	if err := s.hub.BroadcastJSON(req.SessionID, req.Event); err != nil {
-		log.Printf("Failed to broadcast event: %v", err)
+	if err := s.hub.BroadcastEvent(req.SessionID, req.Event); err != nil {
+		s.hub.Logger().Error("failed to broadcast event", "session_id", req.SessionID, "error", err)
 		return c.JSON(http.StatusInternalServerError, map[string]string{"error": "failed to broadcast event"})
 	}
 
-	log.Printf("Event sent to session %s: type=%v, delivered=%v", req.SessionID, req.Event["type"], hasConnections)
+	s.hub.Logger().Debug("event sent to session", "session_id", req.SessionID, "type", req.Event["type"], "delivered", hasConnections)
 
 	return c.JSON(http.StatusOK, SendResponse{
 		OK:        true,
@@ -0,0 +1,120 @@
+package http
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/xiaot623/gogo/ingress/internal/hub"
+	"github.com/xiaot623/gogo/ingress/internal/protocol"
+)
+
+func postSend(t *testing.T, s *Server, body string) (int, map[string]interface{}) {
+	t.Helper()
+	req := httptest.NewRequest(http.MethodPost, "/internal/send", strings.NewReader(body))
+	req.Header.Set("Content-Type", "application/json")
+	rec := httptest.NewRecorder()
+	s.echo.ServeHTTP(rec, req)
+
+	var resp map[string]interface{}
+	if err := json.Unmarshal(rec.Body.Bytes(), &resp); err != nil {
+		t.Fatalf("invalid JSON response %q: %v", rec.Body.String(), err)
+	}
+	return rec.Code, resp
+}
+
+func TestInternalSendDeliversEvent(t *testing.T) {
+	h := hub.NewHub()
+	go h.Run()
+	conn := h.NewConnection(nil)
+	conn.SessionID = "s1"
+	h.Register(conn)
+	s := NewServer(h)
+
+	code, resp := postSend(t, s, `{"version":1,"session_id":"s1","event":{"type":"delta","run_id":"r1","text":"hi"}}`)
+	if code != http.StatusOK || resp["ok"] != true || resp["delivered"] != true {
+		t.Fatalf("unexpected response %d %v", code, resp)
+	}
+
+	select {
+	case data := <-conn.Send:
+		var msg map[string]interface{}
+		if err := json.Unmarshal(data, &msg); err != nil {
+			t.Fatalf("invalid event JSON: %v", err)
+		}
+		if msg["type"] != "delta" || msg["text"] != "hi" || msg["ts"] == nil {
+			t.Fatalf("unexpected event: %v", msg)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("event was not delivered")
+	}
+}
+
+func TestInternalSendDeliversToolRequestChunk(t *testing.T) {
+	h := hub.NewHub()
+	go h.Run()
+	conn := h.NewConnection(nil)
+	conn.SessionID = "s1"
+	h.Register(conn)
+	s := NewServer(h)
+
+	code, resp := postSend(t, s, `{"version":1,"session_id":"s1","event":{"type":"tool_request_chunk","run_id":"r1","event_id":"evt_1","tool_call_id":"tc1","tool_name":"fs.write","deadline_ts":1000,"seq":1,"total":2,"last":true,"data":"\"}"}}`)
+	if code != http.StatusOK || resp["delivered"] != true {
+		t.Fatalf("unexpected response %d %v", code, resp)
+	}
+
+	select {
+	case data := <-conn.Send:
+		var msg protocol.ToolRequestChunkMessage
+		if err := json.Unmarshal(data, &msg); err != nil {
+			t.Fatalf("invalid chunk JSON: %v", err)
+		}
+		if msg.Type != protocol.TypeToolRequestChunk || msg.ToolCallID != "tc1" || msg.ToolName != "fs.write" || msg.DeadlineTs != 1000 ||
+			msg.Seq != 1 || msg.Total != 2 || !msg.Last || msg.Data != `"}` {
+			t.Fatalf("unexpected chunk: %s", data)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("chunk was not delivered")
+	}
+}
+
+func TestInternalSendAcceptsMissingVersion(t *testing.T) {
+	s := NewServer(hub.NewHub())
+
+	code, resp := postSend(t, s, `{"session_id":"s1","event":{"type":"done"}}`)
+	if code != http.StatusOK || resp["ok"] != true || resp["delivered"] != false {
+		t.Fatalf("unexpected response %d %v", code, resp)
+	}
+}
+
+func TestInternalSendRejectsMalformedPush(t *testing.T) {
+	s := NewServer(hub.NewHub())
+
+	tests := []struct {
+		name string
+		body string
+		want string
+	}{
+		{"invalid json", `{"session_id":`, "invalid request body"},
+		{"event not an object", `{"session_id":"s1","event":"done"}`, "invalid request body"},
+		{"missing session", `{"event":{"type":"done"}}`, "session_id is required"},
+		{"missing event", `{"session_id":"s1"}`, "event is required"},
+		{"missing type", `{"session_id":"s1","event":{"run_id":"r1"}}`, "event.type"},
+		{"non-string type", `{"session_id":"s1","event":{"type":7}}`, "event.type"},
+		{"future version", `{"version":2,"session_id":"s1","event":{"type":"done"}}`, "unsupported version 2"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			code, resp := postSend(t, s, tt.body)
+			if code != http.StatusBadRequest {
+				t.Fatalf("expected 400, got %d %v", code, resp)
+			}
+			if msg, _ := resp["error"].(string); !strings.Contains(msg, tt.want) {
+				t.Fatalf("expected error containing %q, got %q", tt.want, msg)
+			}
+		})
+	}
+}
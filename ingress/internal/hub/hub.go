@@ -3,12 +3,16 @@ package hub
 
 import (
 	"encoding/json"
-	"log"
+	"errors"
+	"log/slog"
 	"sync"
+	"sync/atomic"
 	"time"
 
 	"github.com/google/uuid"
 	"github.com/gorilla/websocket"
+
+	"github.com/xiaot623/gogo/ingress/internal/protocol"
 )
 
 // Connection represents a single WebSocket connection.
@@ -19,6 +23,27 @@ type Connection struct {
 	Send      chan []byte
 	hub       *Hub
 	mu        sync.Mutex
+
+	// Protocol is the subprotocol negotiated at the handshake (e.g.
+	// "gogo.v1") and selects how the connection's messages are parsed. It
+	// starts as protocol.DefaultSubprotocol and is set before registration.
+	Protocol string
+
+	// ClientMeta is the client_meta of the connection's hello. It is only
+	// accessed from the connection's read loop.
+	ClientMeta map[string]string
+	// DeviceID is the device_id of the connection's hello. It is only
+	// accessed from the connection's read loop.
+	DeviceID string
+
+	// closed is set, under hub.mu, once Send has been closed. closeFrame is
+	// the close frame payload writePump sends when it sees Send closed.
+	closed     bool
+	closeFrame []byte
+
+	// runs holds the run_ids started by this connection that have not ended.
+	runsMu sync.Mutex
+	runs   map[string]bool
 }
 
 // Hub manages all WebSocket connections.
@@ -36,24 +61,87 @@ type Hub struct {
 	// Broadcast channel for sending to specific session
 	broadcast chan *SessionMessage
 
+	// onSessionEmpty, if set, is called in its own goroutine when Unregister
+	// removes the last connection of a session.
+	onSessionEmpty func(sessionID string)
+
+	// onSessionsChanged, if set, is called with h.mu held whenever a session
+	// gains its first connection or loses its last.
+	onSessionsChanged func()
+
+	// maxSessionConns caps the connections BindSession lets one session
+	// have; 0 means no cap.
+	maxSessionConns int
+
+	// Counters updated by Run; read lock-free by Stats.
+	messagesBroadcast atomic.Uint64
+	messagesDropped   atomic.Uint64
+	bytesSent         atomic.Uint64
+	bindsRejected     atomic.Uint64
+
+	logger *slog.Logger
+
 	mu sync.RWMutex
 }
 
+// Option configures a Hub.
+type Option func(*Hub)
+
+// WithLogger sets the hub's logger; the default is slog.Default().
+func WithLogger(logger *slog.Logger) Option {
+	return func(h *Hub) {
+		if logger != nil {
+			h.logger = logger
+		}
+	}
+}
+
+// WithMaxSessionConnections caps how many connections BindSession lets a
+// session have (0, the default, means no cap), so one session cannot be
+// used to multiply the hub's broadcast work.
+func WithMaxSessionConnections(n int) Option {
+	return func(h *Hub) {
+		h.maxSessionConns = n
+	}
+}
+
+// Stats is a point-in-time snapshot of hub state and cumulative counters.
+type Stats struct {
+	Connections       int
+	Sessions          int
+	MaxSessionFanout  int // Connections in the largest session
+	MessagesBroadcast uint64
+	MessagesDropped   uint64 // Deliveries dropped because a connection buffer was full
+	BytesSent         uint64 // Bytes queued to connections by broadcasts
+	BindsRejected     uint64 // BindSession calls refused with ErrSessionFull
+}
+
 // SessionMessage is used to broadcast a message to a session.
 type SessionMessage struct {
 	SessionID string
 	Data      []byte
+
+	// For run events, connections that started RunID receive OwnerData instead
+	// of Data, and EndsRun removes the run from their active set.
+	RunID     string
+	OwnerData []byte
+	EndsRun   bool
 }
 
 // NewHub creates a new Hub.
-func NewHub() *Hub {
-	return &Hub{
+func NewHub(opts ...Option) *Hub {
+	h := &Hub{
 		connections: make(map[string]*Connection),
 		sessions:    make(map[string]map[string]bool),
 		register:    make(chan *Connection),
 		unregister:  make(chan *Connection),
 		broadcast:   make(chan *SessionMessage, 256),
+		logger:      slog.Default(),
 	}
+	for _, opt := range opts {
+		opt(h)
+	}
+	return h
 }
 
 // Run starts the hub's main loop.
@@ -66,38 +154,47 @@ func (h *Hub) Run() {
 			if conn.SessionID != "" {
 				if h.sessions[conn.SessionID] == nil {
 					h.sessions[conn.SessionID] = make(map[string]bool)
+					h.sessionsChangedLocked()
 				}
 				h.sessions[conn.SessionID][conn.ID] = true
 			}
+			// BindSession may rebind conn once the lock is released.
+			sessionID := conn.SessionID
 			h.mu.Unlock()
-			log.Printf("Connection registered: %s (session: %s)", conn.ID, conn.SessionID)
+			h.logger.Info("connection registered", "conn_id", conn.ID, "session_id", sessionID)
 
 		case conn := <-h.unregister:
 			h.mu.Lock()
-			if _, ok := h.connections[conn.ID]; ok {
-				delete(h.connections, conn.ID)
-				if conn.SessionID != "" && h.sessions[conn.SessionID] != nil {
-					delete(h.sessions[conn.SessionID], conn.ID)
-					if len(h.sessions[conn.SessionID]) == 0 {
-						delete(h.sessions, conn.SessionID)
-					}
-				}
-				close(conn.Send)
-			}
+			sessionID := conn.SessionID
+			emptied := h.removeLocked(conn, nil) && sessionID != "" && h.sessions[sessionID] == nil
+			onSessionEmpty := h.onSessionEmpty
 			h.mu.Unlock()
-			log.Printf("Connection unregistered: %s", conn.ID)
+			if emptied && onSessionEmpty != nil {
+				go onSessionEmpty(sessionID)
+			}
+			h.logger.Info("connection unregistered", "conn_id", conn.ID, "session_id", sessionID)
 
 		case msg := <-h.broadcast:
+			h.messagesBroadcast.Add(1)
 			h.mu.RLock()
 			if connIDs, ok := h.sessions[msg.SessionID]; ok {
 				for connID := range connIDs {
 					if conn, exists := h.connections[connID]; exists {
+						data := msg.Data
+						if msg.RunID != "" && conn.OwnsRun(msg.RunID) {
+							data = msg.OwnerData
+							if msg.EndsRun {
+								conn.RemoveRun(msg.RunID)
+							}
+						}
 						select {
-						case conn.Send <- msg.Data:
+						case conn.Send <- data:
+							h.bytesSent.Add(uint64(len(data)))
 						default:
 							// Buffer full, close the connection
-							log.Printf("Connection %s buffer full, closing", connID)
-							go h.Unregister(conn)
+							h.messagesDropped.Add(1)
+							h.logger.Warn("connection buffer full, closing", "conn_id", connID, "session_id", msg.SessionID)
+							go h.CloseConnection(conn, protocol.CloseCodeSlowConsumer, "send buffer full")
 						}
 					}
 				}
@@ -110,10 +207,11 @@ func (h *Hub) Run() {
 // NewConnection creates a new connection and registers it with the hub.
 func (h *Hub) NewConnection(ws *websocket.Conn) *Connection {
 	conn := &Connection{
-		ID:   uuid.New().String(),
-		Conn: ws,
-		Send: make(chan []byte, 256),
-		hub:  h,
+		ID:       uuid.New().String(),
+		Conn:     ws,
+		Send:     make(chan []byte, 256),
+		hub:      h,
+		Protocol: protocol.DefaultSubprotocol,
 	}
 	return conn
 }
@@ -128,16 +226,144 @@ func (h *Hub) Unregister(conn *Connection) {
 	h.unregister <- conn
 }
 
-// BindSession binds a connection to a session.
-func (h *Hub) BindSession(conn *Connection, sessionID string) {
+// OnSessionEmpty sets fn to be called when a client disconnect leaves a
+// session without connections. It is not called for connections closed by
+// the hub itself (CloseSession, CloseConnection, CloseAll).
+func (h *Hub) OnSessionEmpty(fn func(sessionID string)) {
 	h.mu.Lock()
 	defer h.mu.Unlock()
+	h.onSessionEmpty = fn
+}
+
+// OnSessionsChanged sets fn to be called whenever a session gains its first
+// connection or loses its last, for any reason. fn is called with the hub
+// locked, so it must not block or call back into the hub; SessionIDs gives
+// the current set.
+func (h *Hub) OnSessionsChanged(fn func()) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.onSessionsChanged = fn
+}
+
+// sessionsChangedLocked calls onSessionsChanged. h.mu must be held.
+func (h *Hub) sessionsChangedLocked() {
+	if h.onSessionsChanged != nil {
+		h.onSessionsChanged()
+	}
+}
 
+// SessionIDs returns the sessions with at least one connection.
+func (h *Hub) SessionIDs() []string {
+	h.mu.RLock()
+	defer h.mu.RUnlock()
+	ids := make([]string, 0, len(h.sessions))
+	for id := range h.sessions {
+		ids = append(ids, id)
+	}
+	return ids
+}
+
+// CloseConnection sends conn a close frame with code and reason, after any
+// messages already queued for it, and unregisters it. It reports false if conn
+// was already unregistered.
+func (h *Hub) CloseConnection(conn *Connection, code int, reason string) bool {
+	frame := websocket.FormatCloseMessage(code, reason)
+
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	return h.removeLocked(conn, frame)
+}
+
+// CloseAll closes every registered connection as CloseConnection does and
+// returns the number closed. It is used to drain ingress on shutdown.
+func (h *Hub) CloseAll(code int, reason string) int {
+	frame := websocket.FormatCloseMessage(code, reason)
+
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	closed := 0
+	for _, conn := range h.connections {
+		if h.removeLocked(conn, frame) {
+			closed++
+		}
+	}
+	if closed > 0 {
+		h.logger.Info("closed connections", "connections", closed, "code", code, "reason", reason)
+	}
+	return closed
+}
+
+// removeLocked unregisters conn and closes its Send channel; writePump then
+// sends frame, or an empty close frame if frame is nil. It reports false if
+// conn was not registered. h.mu must be held for writing.
+func (h *Hub) removeLocked(conn *Connection, frame []byte) bool {
+	if _, ok := h.connections[conn.ID]; !ok {
+		return false
+	}
+	delete(h.connections, conn.ID)
+	if conn.SessionID != "" && h.sessions[conn.SessionID] != nil {
+		delete(h.sessions[conn.SessionID], conn.ID)
+		if len(h.sessions[conn.SessionID]) == 0 {
+			delete(h.sessions, conn.SessionID)
+			h.sessionsChangedLocked()
+		}
+	}
+	conn.closeFrame = frame
+	conn.closed = true
+	close(conn.Send)
+	return true
+}
+
+// BindSession binds a connection to a session and returns how many
+// connections the session then has. It returns ErrSessionFull, leaving conn
+// where it was, when the session already has the most connections the hub
+// allows.
+func (h *Hub) BindSession(conn *Connection, sessionID string) (int, error) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	bound := h.sessions[sessionID]
+	if h.maxSessionConns > 0 && !bound[conn.ID] && len(bound) >= h.maxSessionConns {
+		h.bindsRejected.Add(1)
+		h.logger.Warn("session bind rejected: too many connections", "session_id", sessionID, "conn_id", conn.ID, "connections", len(bound))
+		return len(bound), ErrSessionFull
+	}
+	h.bindLocked(conn, sessionID)
+	return len(h.sessions[sessionID]), nil
+}
+
+// TakeOverSession binds conn to a session as BindSession does, after closing
+// the session's other connections as CloseConnection does with code and
+// reason. It returns the number of connections closed.
+func (h *Hub) TakeOverSession(conn *Connection, sessionID string, code int, reason string) int {
+	frame := websocket.FormatCloseMessage(code, reason)
+
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	closed := 0
+	for connID := range h.sessions[sessionID] {
+		other, ok := h.connections[connID]
+		if !ok || other == conn {
+			continue
+		}
+		if h.removeLocked(other, frame) {
+			closed++
+		}
+	}
+	h.bindLocked(conn, sessionID)
+	if closed > 0 {
+		h.logger.Info("session taken over", "session_id", sessionID, "conn_id", conn.ID, "connections", closed, "code", code, "reason", reason)
+	}
+	return closed
+}
+
+// bindLocked moves conn to sessionID. h.mu must be held for writing.
+func (h *Hub) bindLocked(conn *Connection, sessionID string) {
 	// Remove from old session if any
 	if conn.SessionID != "" && h.sessions[conn.SessionID] != nil {
 		delete(h.sessions[conn.SessionID], conn.ID)
 		if len(h.sessions[conn.SessionID]) == 0 {
 			delete(h.sessions, conn.SessionID)
+			h.sessionsChangedLocked()
 		}
 	}
 
@@ -145,10 +371,44 @@ func (h *Hub) BindSession(conn *Connection, sessionID string) {
 	conn.SessionID = sessionID
 	if h.sessions[sessionID] == nil {
 		h.sessions[sessionID] = make(map[string]bool)
+		h.sessionsChangedLocked()
 	}
 	h.sessions[sessionID][conn.ID] = true
 }
 
+// CloseSession disconnects every connection of a session: each is sent a
+// close frame with code and reason and unregistered. It returns the number of
+// connections closed. Messages already queued on a connection are still
+// written before the close frame; later broadcasts to the session are dropped.
+func (h *Hub) CloseSession(sessionID string, code int, reason string) int {
+	frame := websocket.FormatCloseMessage(code, reason)
+
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	closed := 0
+	for connID := range h.sessions[sessionID] {
+		conn, ok := h.connections[connID]
+		if !ok {
+			continue
+		}
+		delete(h.connections, connID)
+		// writePump sends closeFrame once it sees Send closed; taking the
+		// write lock keeps broadcasts from sending on the closed channel.
+		conn.closeFrame = frame
+		conn.closed = true
+		close(conn.Send)
+		closed++
+	}
+	if _, ok := h.sessions[sessionID]; ok {
+		delete(h.sessions, sessionID)
+		h.sessionsChangedLocked()
+	}
+	if closed > 0 {
+		h.logger.Info("session disconnected", "session_id", sessionID, "connections", closed, "code", code, "reason", reason)
+	}
+	return closed
+}
+
 // Broadcast sends a message to all connections of a session.
 func (h *Hub) Broadcast(sessionID string, data []byte) {
 	h.broadcast <- &SessionMessage{
@@ -167,8 +427,49 @@ func (h *Hub) BroadcastJSON(sessionID string, v interface{}) error {
 	return nil
 }
 
+// BroadcastEvent sends an orchestrator event to all connections of a session.
+// Events carrying a run_id are annotated with "own_run", which is true only for
+// connections that started the run; done and error events end the run.
+func (h *Hub) BroadcastEvent(sessionID string, event map[string]interface{}) error {
+	runID, _ := event["run_id"].(string)
+	if runID == "" {
+		return h.BroadcastJSON(sessionID, event)
+	}
+	eventType, _ := event["type"].(string)
+	return h.BroadcastRunEvent(sessionID, runID, event, eventType == "done" || eventType == "error")
+}
+
+// BroadcastRunEvent sends a run event to a session, annotating it with
+// "own_run" per connection. With endsRun the run is removed from the active
+// runs of the connections that own it.
+func (h *Hub) BroadcastRunEvent(sessionID, runID string, event map[string]interface{}, endsRun bool) error {
+	event["own_run"] = false
+	data, err := json.Marshal(event)
+	if err != nil {
+		return err
+	}
+	event["own_run"] = true
+	ownerData, err := json.Marshal(event)
+	if err != nil {
+		return err
+	}
+	h.broadcast <- &SessionMessage{
+		SessionID: sessionID,
+		Data:      data,
+		RunID:     runID,
+		OwnerData: ownerData,
+		EndsRun:   endsRun,
+	}
+	return nil
+}
+
 // SendToConnection sends a message to a specific connection.
 func (h *Hub) SendToConnection(conn *Connection, data []byte) error {
+	h.mu.RLock()
+	defer h.mu.RUnlock()
+	if conn.closed {
+		return ErrConnectionClosed
+	}
 	select {
 	case conn.Send <- data:
 		return nil
@@ -200,6 +501,27 @@ func (h *Hub) GetSessionCount() int {
 	return len(h.sessions)
 }
 
+// Stats returns a snapshot of hub state and counters.
+func (h *Hub) Stats() Stats {
+	h.mu.RLock()
+	stats := Stats{
+		Connections: len(h.connections),
+		Sessions:    len(h.sessions),
+	}
+	for _, connIDs := range h.sessions {
+		if len(connIDs) > stats.MaxSessionFanout {
+			stats.MaxSessionFanout = len(connIDs)
+		}
+	}
+	h.mu.RUnlock()
+
+	stats.MessagesBroadcast = h.messagesBroadcast.Load()
+	stats.MessagesDropped = h.messagesDropped.Load()
+	stats.BytesSent = h.bytesSent.Load()
+	stats.BindsRejected = h.bindsRejected.Load()
+	return stats
+}
+
 // HasActiveConnections checks if a session has any active connections.
 func (h *Hub) HasActiveConnections(sessionID string) bool {
 	h.mu.RLock()
@@ -208,6 +530,41 @@ func (h *Hub) HasActiveConnections(sessionID string) bool {
 	return ok && len(connIDs) > 0
 }
 
+// AddRun marks runID as started by this connection.
+func (c *Connection) AddRun(runID string) {
+	c.runsMu.Lock()
+	defer c.runsMu.Unlock()
+	if c.runs == nil {
+		c.runs = make(map[string]bool)
+	}
+	c.runs[runID] = true
+}
+
+// RemoveRun removes runID from the connection's active runs.
+func (c *Connection) RemoveRun(runID string) {
+	c.runsMu.Lock()
+	defer c.runsMu.Unlock()
+	delete(c.runs, runID)
+}
+
+// OwnsRun reports whether this connection started runID and it is still active.
+func (c *Connection) OwnsRun(runID string) bool {
+	c.runsMu.Lock()
+	defer c.runsMu.Unlock()
+	return c.runs[runID]
+}
+
+// ActiveRuns returns the run_ids started by this connection that have not ended.
+func (c *Connection) ActiveRuns() []string {
+	c.runsMu.Lock()
+	defer c.runsMu.Unlock()
+	runs := make([]string, 0, len(c.runs))
+	for runID := range c.runs {
+		runs = append(runs, runID)
+	}
+	return runs
+}
+
 // WriteMessage writes a message to the connection with proper locking.
 func (c *Connection) WriteMessage(messageType int, data []byte) error {
 	c.mu.Lock()
@@ -225,11 +582,28 @@ func (c *Connection) SetReadDeadline(t time.Time) error {
 	return c.Conn.SetReadDeadline(t)
 }
 
+// CloseFrame returns the payload of the close frame to send when Send is
+// closed; empty unless the connection was closed with a code.
+func (c *Connection) CloseFrame() []byte {
+	if c.closeFrame == nil {
+		return []byte{}
+	}
+	return c.closeFrame
+}
+
 // Close closes the connection.
 func (c *Connection) Close() error {
 	return c.Conn.Close()
 }
 
+// ErrConnectionClosed is returned when sending to a connection that has been
+// unregistered or disconnected.
+var ErrConnectionClosed = errors.New("connection closed")
+
+// ErrSessionFull is returned by BindSession when the session already has as
+// many connections as WithMaxSessionConnections allows.
+var ErrSessionFull = errors.New("session has too many connections")
+
 // ErrBufferFull is returned when the send buffer is full.
 var ErrBufferFull = &BufferFullError{}
 
@@ -239,3 +613,8 @@ type BufferFullError struct{}
 func (e *BufferFullError) Error() string {
 	return "send buffer full"
 }
+
+// Logger returns the hub's logger, for servers built on the hub.
+func (h *Hub) Logger() *slog.Logger {
+	return h.logger
+}
@@ -0,0 +1,223 @@
+package hub
+
+import (
+	"encoding/json"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/gorilla/websocket"
+
+	"github.com/xiaot623/gogo/ingress/internal/protocol"
+)
+
+func receive(t *testing.T, conn *Connection) map[string]interface{} {
+	t.Helper()
+	select {
+	case data := <-conn.Send:
+		var msg map[string]interface{}
+		if err := json.Unmarshal(data, &msg); err != nil {
+			t.Fatalf("invalid JSON: %v", err)
+		}
+		return msg
+	case <-time.After(time.Second):
+		t.Fatalf("no message for connection %s", conn.ID)
+		return nil
+	}
+}
+
+func TestBroadcastEventAnnotatesRunOwnership(t *testing.T) {
+	h := NewHub()
+	go h.Run()
+
+	owner, other := h.NewConnection(nil), h.NewConnection(nil)
+	for _, conn := range []*Connection{owner, other} {
+		conn.SessionID = "s1"
+		h.Register(conn)
+	}
+	owner.AddRun("r1")
+
+	if err := h.BroadcastEvent("s1", map[string]interface{}{"type": "delta", "run_id": "r1", "text": "hi"}); err != nil {
+		t.Fatalf("BroadcastEvent: %v", err)
+	}
+	if msg := receive(t, owner); msg["own_run"] != true || msg["text"] != "hi" {
+		t.Fatalf("unexpected owner message: %v", msg)
+	}
+	if msg := receive(t, other); msg["own_run"] != false {
+		t.Fatalf("unexpected other message: %v", msg)
+	}
+
+	// Session-level events without a run_id are not annotated.
+	if err := h.BroadcastEvent("s1", map[string]interface{}{"type": "state"}); err != nil {
+		t.Fatalf("BroadcastEvent: %v", err)
+	}
+	if msg := receive(t, owner); msg["own_run"] != nil {
+		t.Fatalf("unexpected annotation: %v", msg)
+	}
+	receive(t, other)
+
+	// done ends the run for its owner.
+	if err := h.BroadcastEvent("s1", map[string]interface{}{"type": "done", "run_id": "r1"}); err != nil {
+		t.Fatalf("BroadcastEvent: %v", err)
+	}
+	if msg := receive(t, owner); msg["own_run"] != true {
+		t.Fatalf("expected done to be marked own_run: %v", msg)
+	}
+	receive(t, other)
+	if owner.OwnsRun("r1") || len(owner.ActiveRuns()) != 0 {
+		t.Fatalf("run should have ended, active runs: %v", owner.ActiveRuns())
+	}
+}
+
+func TestCloseSession(t *testing.T) {
+	h := NewHub()
+	go h.Run()
+
+	a, b, other := h.NewConnection(nil), h.NewConnection(nil), h.NewConnection(nil)
+	a.SessionID, b.SessionID, other.SessionID = "s1", "s1", "s2"
+	for _, conn := range []*Connection{a, b, other} {
+		h.Register(conn)
+	}
+	deadline := time.Now().Add(time.Second)
+	for h.GetConnectionCount() != 3 {
+		if time.Now().After(deadline) {
+			t.Fatal("connections were not registered")
+		}
+		time.Sleep(time.Millisecond)
+	}
+
+	// Broadcasts racing the close must neither panic nor reach closed sockets.
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		for i := 0; i < 100; i++ {
+			h.BroadcastEvent("s1", map[string]interface{}{"type": "delta"})
+		}
+	}()
+	time.Sleep(time.Millisecond)
+
+	if n := h.CloseSession("s1", 4001, "session deleted"); n != 2 {
+		t.Fatalf("expected 2 connections closed, got %d", n)
+	}
+	<-done
+
+	for _, conn := range []*Connection{a, b} {
+		for range conn.Send {
+			// Drain broadcasts queued before the close; Send must end closed.
+		}
+		if got := string(conn.CloseFrame()); got != string(websocket.FormatCloseMessage(4001, "session deleted")) {
+			t.Fatalf("unexpected close frame %q", got)
+		}
+		if err := h.SendToConnection(conn, []byte("{}")); err != ErrConnectionClosed {
+			t.Fatalf("expected ErrConnectionClosed, got %v", err)
+		}
+		h.Unregister(conn) // unregistering an evicted connection is a no-op
+	}
+
+	if h.HasActiveConnections("s1") || !h.HasActiveConnections("s2") {
+		t.Fatal("expected only s1 to be disconnected")
+	}
+	if n := h.CloseSession("s1", 4001, ""); n != 0 {
+		t.Fatalf("expected closing an empty session to be a no-op, got %d", n)
+	}
+	if len(other.CloseFrame()) != 0 {
+		t.Fatal("other session should not have a close frame")
+	}
+}
+
+func TestSlowConsumerClosed(t *testing.T) {
+	h := NewHub()
+	go h.Run()
+
+	conn := h.NewConnection(nil)
+	conn.SessionID = "s1"
+	h.Register(conn)
+
+	// Nothing reads Send, so the broadcast past its capacity evicts conn.
+	for i := 0; i <= cap(conn.Send); i++ {
+		h.Broadcast("s1", []byte("{}"))
+	}
+	deadline := time.Now().Add(time.Second)
+	for h.HasActiveConnections("s1") {
+		if time.Now().After(deadline) {
+			t.Fatal("slow connection was not closed")
+		}
+		time.Sleep(time.Millisecond)
+	}
+	for range conn.Send {
+	}
+	want := websocket.FormatCloseMessage(protocol.CloseCodeSlowConsumer, "send buffer full")
+	if got := string(conn.CloseFrame()); got != string(want) {
+		t.Fatalf("unexpected close frame %q", got)
+	}
+	if h.Stats().MessagesDropped != 1 {
+		t.Fatalf("expected 1 dropped message, got %d", h.Stats().MessagesDropped)
+	}
+}
+
+func TestOnSessionEmpty(t *testing.T) {
+	h := NewHub()
+	go h.Run()
+	emptied := make(chan string, 1)
+	h.OnSessionEmpty(func(sessionID string) { emptied <- sessionID })
+
+	a, b := h.NewConnection(nil), h.NewConnection(nil)
+	a.SessionID, b.SessionID = "s1", "s1"
+	h.Register(a)
+	h.Register(b)
+
+	h.Unregister(a)
+	select {
+	case id := <-emptied:
+		t.Fatalf("session %s reported empty with a connection left", id)
+	case <-time.After(20 * time.Millisecond):
+	}
+	h.Unregister(b)
+	select {
+	case id := <-emptied:
+		if id != "s1" {
+			t.Fatalf("expected s1, got %s", id)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("empty session was not reported")
+	}
+}
+
+func TestBindSessionMaxConnections(t *testing.T) {
+	h := NewHub(WithMaxSessionConnections(2))
+	go h.Run()
+
+	a, b, c := h.NewConnection(nil), h.NewConnection(nil), h.NewConnection(nil)
+	for _, conn := range []*Connection{a, b, c} {
+		h.Register(conn)
+	}
+	for i, conn := range []*Connection{a, b} {
+		if n, err := h.BindSession(conn, "s1"); err != nil || n != i+1 {
+			t.Fatalf("BindSession = %d, %v", n, err)
+		}
+	}
+	// Rebinding a connection already in the session does not count twice.
+	if n, err := h.BindSession(b, "s1"); err != nil || n != 2 {
+		t.Fatalf("rebind = %d, %v", n, err)
+	}
+
+	if n, err := h.BindSession(c, "s1"); !errors.Is(err, ErrSessionFull) || n != 2 {
+		t.Fatalf("expected ErrSessionFull with 2 connections, got %d, %v", n, err)
+	}
+	if c.SessionID != "" || h.Stats().BindsRejected != 1 {
+		t.Fatalf("rejected bind left session %q, stats %+v", c.SessionID, h.Stats())
+	}
+
+	// A connection closing makes room.
+	h.Unregister(a)
+	deadline := time.Now().Add(time.Second)
+	for {
+		if _, err := h.BindSession(c, "s1"); err == nil {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatal("bind still rejected after a connection closed")
+		}
+		time.Sleep(time.Millisecond)
+	}
+}
@@ -0,0 +1,60 @@
+// Package metrics exposes ingress metrics in Prometheus format.
+package metrics
+
+import (
+	"github.com/prometheus/client_golang/prometheus"
+
+	"github.com/xiaot623/gogo/ingress/internal/hub"
+)
+
+// HubCollector reports WebSocket hub state. Values are read from a single
+// hub.Stats snapshot per scrape, so the broadcast path only pays for atomic
+// counter increments.
+type HubCollector struct {
+	hub *hub.Hub
+
+	connections       *prometheus.Desc
+	sessions          *prometheus.Desc
+	maxSessionFanout  *prometheus.Desc
+	messagesBroadcast *prometheus.Desc
+	messagesDropped   *prometheus.Desc
+	bytesSent         *prometheus.Desc
+	bindsRejected     *prometheus.Desc
+}
+
+// NewHubCollector creates a collector for the given hub.
+func NewHubCollector(h *hub.Hub) *HubCollector {
+	return &HubCollector{
+		hub:               h,
+		connections:       prometheus.NewDesc("ingress_ws_connections", "Number of open WebSocket connections.", nil, nil),
+		sessions:          prometheus.NewDesc("ingress_ws_sessions", "Number of sessions with at least one connection.", nil, nil),
+		maxSessionFanout:  prometheus.NewDesc("ingress_ws_max_session_fanout", "Connections bound to the largest session.", nil, nil),
+		messagesBroadcast: prometheus.NewDesc("ingress_ws_messages_broadcast_total", "Messages broadcast to sessions.", nil, nil),
+		messagesDropped:   prometheus.NewDesc("ingress_ws_messages_dropped_total", "Deliveries dropped because a connection send buffer was full.", nil, nil),
+		bytesSent:         prometheus.NewDesc("ingress_ws_bytes_sent_total", "Bytes queued to connections by broadcasts.", nil, nil),
+		bindsRejected:     prometheus.NewDesc("ingress_ws_session_binds_rejected_total", "Session binds rejected because the session had too many connections.", nil, nil),
+	}
+}
+
+// Describe implements prometheus.Collector.
+func (c *HubCollector) Describe(ch chan<- *prometheus.Desc) {
+	ch <- c.connections
+	ch <- c.sessions
+	ch <- c.maxSessionFanout
+	ch <- c.messagesBroadcast
+	ch <- c.messagesDropped
+	ch <- c.bytesSent
+	ch <- c.bindsRejected
+}
+
+// Collect implements prometheus.Collector.
+func (c *HubCollector) Collect(ch chan<- prometheus.Metric) {
+	stats := c.hub.Stats()
+	ch <- prometheus.MustNewConstMetric(c.connections, prometheus.GaugeValue, float64(stats.Connections))
+	ch <- prometheus.MustNewConstMetric(c.sessions, prometheus.GaugeValue, float64(stats.Sessions))
+	ch <- prometheus.MustNewConstMetric(c.maxSessionFanout, prometheus.GaugeValue, float64(stats.MaxSessionFanout))
+	ch <- prometheus.MustNewConstMetric(c.messagesBroadcast, prometheus.CounterValue, float64(stats.MessagesBroadcast))
+	ch <- prometheus.MustNewConstMetric(c.messagesDropped, prometheus.CounterValue, float64(stats.MessagesDropped))
+	ch <- prometheus.MustNewConstMetric(c.bytesSent, prometheus.CounterValue, float64(stats.BytesSent))
+	ch <- prometheus.MustNewConstMetric(c.bindsRejected, prometheus.CounterValue, float64(stats.BindsRejected))
+}
@@ -0,0 +1,98 @@
+package metrics
+
+import (
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+
+	"github.com/xiaot623/gogo/ingress/internal/hub"
+)
+
+// gather returns the value of each metric the registry exposes, by name.
+func gather(t *testing.T, reg *prometheus.Registry) map[string]float64 {
+	t.Helper()
+	families, err := reg.Gather()
+	if err != nil {
+		t.Fatalf("Gather: %v", err)
+	}
+	values := make(map[string]float64)
+	for _, family := range families {
+		for _, m := range family.GetMetric() {
+			switch {
+			case m.GetGauge() != nil:
+				values[family.GetName()] = m.GetGauge().GetValue()
+			case m.GetCounter() != nil:
+				values[family.GetName()] = m.GetCounter().GetValue()
+			}
+		}
+	}
+	return values
+}
+
+// waitFor polls the registry until name has the value want, as the hub
+// applies registrations asynchronously.
+func waitFor(t *testing.T, reg *prometheus.Registry, name string, want float64) {
+	t.Helper()
+	deadline := time.Now().Add(time.Second)
+	for {
+		got := gather(t, reg)[name]
+		if got == want {
+			return
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("expected %s %v, got %v", name, want, got)
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+}
+
+func TestHubCollector(t *testing.T) {
+	h := hub.NewHub()
+	go h.Run()
+	reg := prometheus.NewRegistry()
+	reg.MustRegister(NewHubCollector(h))
+
+	a, b := h.NewConnection(nil), h.NewConnection(nil)
+	a.SessionID = "s1"
+	h.Register(a)
+	h.Register(b)
+	waitFor(t, reg, "ingress_ws_connections", 2)
+	if values := gather(t, reg); values["ingress_ws_sessions"] != 1 || values["ingress_ws_max_session_fanout"] != 1 {
+		t.Fatalf("unexpected metrics after register: %v", values)
+	}
+
+	if _, err := h.BindSession(b, "s1"); err != nil {
+		t.Fatalf("BindSession: %v", err)
+	}
+	if values := gather(t, reg); values["ingress_ws_sessions"] != 1 || values["ingress_ws_max_session_fanout"] != 2 {
+		t.Fatalf("unexpected metrics after bind: %v", values)
+	}
+
+	if err := h.BroadcastEvent("s1", map[string]interface{}{"type": "delta", "text": "hi"}); err != nil {
+		t.Fatalf("BroadcastEvent: %v", err)
+	}
+	for _, conn := range []*hub.Connection{a, b} {
+		select {
+		case <-conn.Send:
+		case <-time.After(time.Second):
+			t.Fatalf("broadcast did not reach %s", conn.ID)
+		}
+	}
+	waitFor(t, reg, "ingress_ws_messages_broadcast_total", 1)
+	if values := gather(t, reg); values["ingress_ws_bytes_sent_total"] <= 0 || values["ingress_ws_messages_dropped_total"] != 0 {
+		t.Fatalf("unexpected metrics after broadcast: %v", values)
+	}
+
+	h.Unregister(a)
+	h.Unregister(b)
+	waitFor(t, reg, "ingress_ws_connections", 0)
+	values := gather(t, reg)
+	if values["ingress_ws_sessions"] != 0 || values["ingress_ws_max_session_fanout"] != 0 {
+		t.Fatalf("unexpected metrics after unregister: %v", values)
+	}
+	// Counters keep their totals.
+	if values["ingress_ws_messages_broadcast_total"] != 1 || values["ingress_ws_bytes_sent_total"] <= 0 {
+		t.Fatalf("counters reset after unregister: %v", values)
+	}
+}
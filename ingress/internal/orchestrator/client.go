@@ -35,6 +35,12 @@ type InvokeRequest struct {
 	InputMessage InputMessage      `json:"input_message"`
 	RequestID    string            `json:"request_id,omitempty"`
 	Context      map[string]string `json:"context,omitempty"`
+	Tags         []string          `json:"tags,omitempty"`
+	MaxHistory   *int              `json:"max_history,omitempty"`
+	// MaxDurationMs caps the run's wall-clock time (0 = orchestrator default).
+	MaxDurationMs int64 `json:"max_duration_ms,omitempty"`
+	// Priority is high, normal or low ("" = normal).
+	Priority string `json:"priority,omitempty"`
 }
 
 // InputMessage represents the input message content.
@@ -45,9 +51,12 @@ type InputMessage struct {
 
 // InvokeResponse represents the response from invoking an agent.
 type InvokeResponse struct {
-	RunID     string `json:"run_id"`
-	SessionID string `json:"session_id"`
-	AgentID   string `json:"agent_id"`
+	RunID            string   `json:"run_id"`
+	SessionID        string   `json:"session_id"`
+	AgentID          string   `json:"agent_id"`
+	RequestedAgentID string   `json:"requested_agent_id,omitempty"`
+	Fallback         bool     `json:"fallback,omitempty"`
+	Tags             []string `json:"tags,omitempty"`
 }
 
 // ToolCallResultRequest represents a request to submit a tool call result.
@@ -55,6 +64,7 @@ type ToolCallResultRequest struct {
 	Status string          `json:"status"` // SUCCEEDED or FAILED
 	Result json.RawMessage `json:"result,omitempty"`
 	Error  json.RawMessage `json:"error,omitempty"`
+	Nonce  string          `json:"nonce,omitempty"`
 }
 
 // ToolCallResultResponse represents the response after submitting a tool call result.
@@ -66,11 +76,27 @@ type ToolCallResultResponse struct {
 	CompletedAt int64           `json:"completed_at"`
 }
 
+// ToolProgressRequest carries one chunk of incremental tool output.
+type ToolProgressRequest struct {
+	Seq   int64  `json:"seq"`
+	Chunk string `json:"chunk"`
+}
+
+// ToolProgressResponse reports whether a progress chunk was recorded.
+type ToolProgressResponse struct {
+	ToolCallID string `json:"tool_call_id"`
+	Status     string `json:"status"`
+	Seq        int64  `json:"seq"`
+	Accepted   bool   `json:"accepted"`
+}
+
 // ApprovalDecisionRequest represents a decision on an approval.
 type ApprovalDecisionRequest struct {
 	Decision  string `json:"decision"` // APPROVED or REJECTED
 	Reason    string `json:"reason,omitempty"`
 	DecidedBy string `json:"decided_by,omitempty"`
+	Remember  string `json:"remember,omitempty"` // "session" or "user"
+	Nonce     string `json:"nonce,omitempty"`
 }
 
 // ApprovalDecisionResponse represents the response after submitting an approval decision.
@@ -85,8 +111,10 @@ type ApprovalDecisionResponse struct {
 
 // CancelRunResponse represents the response from canceling a run.
 type CancelRunResponse struct {
-	RunID  string `json:"run_id"`
-	Status string `json:"status"`
+	RunID     string `json:"run_id"`
+	Status    string `json:"status"`
+	Reason    string `json:"reason,omitempty"`
+	DecidedBy string `json:"decided_by,omitempty"`
 }
 
 // ToolCallResultArgs wraps tool call IDs with the tool result payload.
@@ -95,15 +123,69 @@ type ToolCallResultArgs struct {
 	Request    ToolCallResultRequest `json:"request"`
 }
 
+// ToolProgressArgs wraps tool call IDs with a progress chunk.
+type ToolProgressArgs struct {
+	ToolCallID string              `json:"tool_call_id"`
+	Request    ToolProgressRequest `json:"request"`
+}
+
 // ApprovalDecisionArgs wraps approval IDs with the decision payload.
 type ApprovalDecisionArgs struct {
 	ApprovalID string                  `json:"approval_id"`
 	Request    ApprovalDecisionRequest `json:"request"`
 }
 
-// CancelRunRequest identifies a run to cancel.
+// CancelRunRequest identifies a run to cancel and, optionally, why and by
+// whom.
 type CancelRunRequest struct {
-	RunID string `json:"run_id"`
+	RunID     string `json:"run_id"`
+	Reason    string `json:"reason,omitempty"`
+	DecidedBy string `json:"decided_by,omitempty"`
+}
+
+// SessionDisconnectedRequest reports that a session has no connection left.
+type SessionDisconnectedRequest struct {
+	SessionID string `json:"session_id"`
+}
+
+// SessionDisconnectedResponse tells how the orchestrator handled a
+// disconnected session: the runs it cancelled, or Detached when they continue
+// without events being pushed.
+type SessionDisconnectedResponse struct {
+	SessionID     string   `json:"session_id"`
+	CancelledRuns []string `json:"cancelled_runs"`
+	Detached      bool     `json:"detached"`
+}
+
+// ListRunsRequest selects a session's runs; Active keeps only unfinished
+// ones.
+type ListRunsRequest struct {
+	SessionID string `json:"session_id"`
+	Active    bool   `json:"active,omitempty"`
+	Limit     int    `json:"limit,omitempty"`
+}
+
+// RunSummary is the list view of a run.
+type RunSummary struct {
+	RunID     string    `json:"run_id"`
+	AgentID   string    `json:"agent_id"`
+	Status    string    `json:"status"`
+	StartedAt time.Time `json:"started_at"`
+}
+
+// ListRunsResponse lists a session's runs, newest first.
+type ListRunsResponse struct {
+	Runs []RunSummary `json:"runs"`
+}
+
+// AckEventsRequest records how far a client device has handled a run's
+// events: up to Seq, or up to the event EventID names.
+type AckEventsRequest struct {
+	SessionID string `json:"session_id"`
+	DeviceID  string `json:"device_id"`
+	RunID     string `json:"run_id"`
+	Seq       int64  `json:"seq,omitempty"`
+	EventID   string `json:"event_id,omitempty"`
 }
 
 // AckResponse is a generic OK response.
@@ -144,6 +226,25 @@ func (c *Client) SubmitToolResult(ctx context.Context, toolCallID string, req *T
 	return &resultResp, nil
 }
 
+// SubmitToolProgress calls orchestrator SubmitToolProgress over RPC.
+func (c *Client) SubmitToolProgress(ctx context.Context, toolCallID string, req *ToolProgressRequest) (*ToolProgressResponse, error) {
+	if req == nil {
+		return nil, fmt.Errorf("tool progress request is required")
+	}
+
+	args := &ToolProgressArgs{
+		ToolCallID: toolCallID,
+		Request:    *req,
+	}
+
+	var progressResp ToolProgressResponse
+	if err := c.call(ctx, "Orchestrator.SubmitToolProgress", args, &progressResp); err != nil {
+		return nil, fmt.Errorf("failed to submit tool progress: %w", err)
+	}
+
+	return &progressResp, nil
+}
+
 // SubmitApprovalDecision calls orchestrator SubmitApprovalDecision over RPC.
 func (c *Client) SubmitApprovalDecision(ctx context.Context, approvalID string, req *ApprovalDecisionRequest) (*ApprovalDecisionResponse, error) {
 	if req == nil {
@@ -164,9 +265,7 @@ func (c *Client) SubmitApprovalDecision(ctx context.Context, approvalID string,
 }
 
 // CancelRun calls orchestrator CancelRun over RPC.
-func (c *Client) CancelRun(ctx context.Context, runID string) (*CancelRunResponse, error) {
-	args := &CancelRunRequest{RunID: runID}
-
+func (c *Client) CancelRun(ctx context.Context, args *CancelRunRequest) (*CancelRunResponse, error) {
 	var cancelResp CancelRunResponse
 	if err := c.call(ctx, "Orchestrator.CancelRun", args, &cancelResp); err != nil {
 		return nil, fmt.Errorf("failed to cancel run: %w", err)
@@ -175,6 +274,36 @@ func (c *Client) CancelRun(ctx context.Context, runID string) (*CancelRunRespons
 	return &cancelResp, nil
 }
 
+// SessionDisconnected calls orchestrator SessionDisconnected over RPC.
+func (c *Client) SessionDisconnected(ctx context.Context, sessionID string) (*SessionDisconnectedResponse, error) {
+	var resp SessionDisconnectedResponse
+	if err := c.call(ctx, "Orchestrator.SessionDisconnected", &SessionDisconnectedRequest{SessionID: sessionID}, &resp); err != nil {
+		return nil, fmt.Errorf("failed to report session disconnect: %w", err)
+	}
+
+	return &resp, nil
+}
+
+// ListRuns calls orchestrator ListRuns over RPC.
+func (c *Client) ListRuns(ctx context.Context, req *ListRunsRequest) (*ListRunsResponse, error) {
+	var resp ListRunsResponse
+	if err := c.call(ctx, "Orchestrator.ListRuns", req, &resp); err != nil {
+		return nil, fmt.Errorf("failed to list runs: %w", err)
+	}
+
+	return &resp, nil
+}
+
+// AckEvents calls orchestrator AckEvents over RPC.
+func (c *Client) AckEvents(ctx context.Context, req *AckEventsRequest) error {
+	var ack AckResponse
+	if err := c.call(ctx, "Orchestrator.AckEvents", req, &ack); err != nil {
+		return fmt.Errorf("failed to ack events: %w", err)
+	}
+
+	return nil
+}
+
 func (c *Client) call(ctx context.Context, method string, args, reply interface{}) error {
 	if c.addr == "" {
 		return fmt.Errorf("orchestrator rpc address is empty")
@@ -182,7 +311,7 @@ func (c *Client) call(ctx context.Context, method string, args, reply interface{
 
 	conn, err := net.DialTimeout("tcp", c.addr, c.dialTimeout)
 	if err != nil {
-		return err
+		return classifyError(method, err)
 	}
 	defer conn.Close()
 
@@ -197,9 +326,9 @@ func (c *Client) call(ctx context.Context, method string, args, reply interface{
 
 	select {
 	case <-ctx.Done():
-		return ctx.Err()
+		return classifyError(method, ctx.Err())
 	case <-call.Done:
-		return call.Error
+		return classifyError(method, call.Error)
 	}
 }
 
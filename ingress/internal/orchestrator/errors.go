@@ -0,0 +1,144 @@
+package orchestrator
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/rpc"
+	"strings"
+	"time"
+)
+
+// ErrorKind classifies a failed orchestrator call.
+type ErrorKind string
+
+const (
+	// ErrorKindUnavailable means the orchestrator could not be reached or the
+	// connection dropped before a reply (transport failure).
+	ErrorKindUnavailable ErrorKind = "unavailable"
+	// ErrorKindTimeout means the call did not complete before its deadline
+	// (transport failure).
+	ErrorKindTimeout ErrorKind = "timeout"
+	// ErrorKindServer means the orchestrator accepted the call but failed
+	// internally, the RPC equivalent of a 5xx.
+	ErrorKindServer ErrorKind = "server"
+	// ErrorKindCapacity means the orchestrator is at its concurrent agent
+	// stream limit and shed the request.
+	ErrorKindCapacity ErrorKind = "capacity"
+	// ErrorKindMaintenance means the orchestrator is in read-only mode and
+	// refuses new invokes, tool invocations and registrations for now.
+	ErrorKindMaintenance ErrorKind = "maintenance"
+	// ErrorKindRejected means the orchestrator rejected the request itself
+	// (validation, unknown IDs), the RPC equivalent of a 4xx.
+	ErrorKindRejected ErrorKind = "rejected"
+)
+
+// Suggested delays before retrying, per error kind.
+const (
+	unavailableRetryAfter = 1 * time.Second
+	capacityRetryAfter    = 1 * time.Second
+	timeoutRetryAfter     = 2 * time.Second
+	serverRetryAfter      = 5 * time.Second
+	maintenanceRetryAfter = 30 * time.Second
+)
+
+// Error is returned by Client calls that fail, so callers can tell transport
+// failures from application errors and decide whether to retry.
+type Error struct {
+	Kind   ErrorKind
+	Method string
+	Err    error
+}
+
+func (e *Error) Error() string {
+	return fmt.Sprintf("%s: %v", e.Method, e.Err)
+}
+
+func (e *Error) Unwrap() error {
+	return e.Err
+}
+
+// Transport reports whether the call failed before the orchestrator replied.
+func (e *Error) Transport() bool {
+	return e.Kind == ErrorKindUnavailable || e.Kind == ErrorKindTimeout
+}
+
+// Retryable reports whether resending the same request may succeed.
+func (e *Error) Retryable() bool {
+	return e.Kind != ErrorKindRejected
+}
+
+// RetryAfter is the suggested delay before retrying, or 0 if the call should
+// not be retried.
+func (e *Error) RetryAfter() time.Duration {
+	switch e.Kind {
+	case ErrorKindUnavailable:
+		return unavailableRetryAfter
+	case ErrorKindTimeout:
+		return timeoutRetryAfter
+	case ErrorKindServer:
+		return serverRetryAfter
+	case ErrorKindCapacity:
+		return capacityRetryAfter
+	case ErrorKindMaintenance:
+		return maintenanceRetryAfter
+	}
+	return 0
+}
+
+// RetryInfo extracts retry guidance from an error returned by Client. Errors
+// that were not classified are reported as not retryable.
+func RetryInfo(err error) (retryable bool, retryAfter time.Duration) {
+	var oerr *Error
+	if !errors.As(err, &oerr) {
+		return false, 0
+	}
+	return oerr.Retryable(), oerr.RetryAfter()
+}
+
+// classifyError wraps an error from an RPC call with its ErrorKind.
+func classifyError(method string, err error) error {
+	if err == nil {
+		return nil
+	}
+	return &Error{Kind: errorKind(err), Method: method, Err: err}
+}
+
+func errorKind(err error) ErrorKind {
+	var netErr net.Error
+	switch {
+	case errors.Is(err, context.DeadlineExceeded):
+		return ErrorKindTimeout
+	case errors.As(err, &netErr) && netErr.Timeout():
+		return ErrorKindTimeout
+	case errors.Is(err, rpc.ErrShutdown), errors.Is(err, io.EOF), errors.Is(err, io.ErrUnexpectedEOF):
+		return ErrorKindUnavailable
+	}
+
+	var opErr *net.OpError
+	if errors.As(err, &opErr) {
+		return ErrorKindUnavailable
+	}
+
+	var serverErr rpc.ServerError
+	if errors.As(err, &serverErr) {
+		// Orchestrator handlers wrap internal failures as "failed to ...",
+		// load shedding as "capacity: ..." and read-only refusals as
+		// "maintenance: ..."; anything else is a rejection of the request
+		// itself.
+		if strings.HasPrefix(string(serverErr), "failed to ") {
+			return ErrorKindServer
+		}
+		if strings.HasPrefix(string(serverErr), "capacity:") {
+			return ErrorKindCapacity
+		}
+		if strings.HasPrefix(string(serverErr), "maintenance:") {
+			return ErrorKindMaintenance
+		}
+		return ErrorKindRejected
+	}
+
+	return ErrorKindServer
+}
@@ -0,0 +1,64 @@
+package orchestrator
+
+import (
+	"context"
+	"errors"
+	"net"
+	"net/rpc"
+	"testing"
+	"time"
+)
+
+func TestClassifyError(t *testing.T) {
+	tests := []struct {
+		name      string
+		err       error
+		kind      ErrorKind
+		retryable bool
+	}{
+		{"deadline", context.DeadlineExceeded, ErrorKindTimeout, true},
+		{"connection dropped", rpc.ErrShutdown, ErrorKindUnavailable, true},
+		{"internal failure", rpc.ServerError("failed to create run: disk full"), ErrorKindServer, true},
+		{"capacity", rpc.ServerError("capacity: too many concurrent agent streams, retry later"), ErrorKindCapacity, true},
+		{"maintenance", rpc.ServerError("maintenance: orchestrator is read-only, retry later"), ErrorKindMaintenance, true},
+		{"validation", rpc.ServerError("agent_id is required"), ErrorKindRejected, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := classifyError("Orchestrator.Invoke", tt.err)
+			var oerr *Error
+			if !errors.As(err, &oerr) {
+				t.Fatalf("expected *Error, got %T", err)
+			}
+			if oerr.Kind != tt.kind {
+				t.Fatalf("expected kind %s, got %s", tt.kind, oerr.Kind)
+			}
+			retryable, retryAfter := RetryInfo(err)
+			if retryable != tt.retryable || (retryAfter > 0) != tt.retryable {
+				t.Fatalf("unexpected retry info: %v, %v", retryable, retryAfter)
+			}
+		})
+	}
+}
+
+func TestInvokeConnectionRefused(t *testing.T) {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("listen: %v", err)
+	}
+	addr := ln.Addr().String()
+	ln.Close()
+
+	c := NewClient(addr)
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+
+	_, err = c.Invoke(ctx, &InvokeRequest{SessionID: "s1", AgentID: "a1"})
+	var oerr *Error
+	if !errors.As(err, &oerr) || oerr.Kind != ErrorKindUnavailable || !oerr.Transport() {
+		t.Fatalf("expected unavailable transport error, got %v", err)
+	}
+	if retryable, _ := RetryInfo(err); !retryable {
+		t.Fatal("expected connection refused to be retryable")
+	}
+}
@@ -0,0 +1,242 @@
+package orchestrator
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"net"
+	"time"
+
+	"github.com/xiaot623/gogo/ingress/internal/protocol"
+)
+
+// Event stream methods, mirrored from the orchestrator's ingress adapter.
+// SubscribeEventsMethod opens the stream; the rest are JSON-RPC 1.0
+// notifications (id null, no reply).
+const (
+	SubscribeEventsMethod = "Orchestrator.SubscribeEvents"
+	SubscribeMethod       = "Orchestrator.Subscribe"
+	UnsubscribeMethod     = "Orchestrator.Unsubscribe"
+	EventMethod           = "Ingress.Event"
+)
+
+// StreamMessage is a JSON-RPC 1.0 request on an event stream, or a
+// notification when ID is null.
+type StreamMessage struct {
+	Method string            `json:"method"`
+	Params []json.RawMessage `json:"params"`
+	ID     json.RawMessage   `json:"id"`
+}
+
+// StreamReply answers the SubscribeEvents request.
+type StreamReply struct {
+	ID     json.RawMessage `json:"id"`
+	Result *struct {
+		OK bool `json:"ok"`
+	} `json:"result"`
+	Error interface{} `json:"error"`
+}
+
+// SubscribeEventsArgs opens an event stream for this ingress instance.
+type SubscribeEventsArgs struct {
+	IngressID  string   `json:"ingress_id"`
+	SessionIDs []string `json:"session_ids,omitempty"`
+}
+
+// SubscribeArgs are the params of Subscribe and Unsubscribe notifications.
+type SubscribeArgs struct {
+	SessionIDs []string `json:"session_ids"`
+}
+
+// DeliverFunc hands an event received on the stream to the sessions'
+// connections.
+type DeliverFunc func(req *protocol.SendRequest, resp *protocol.SendResponse) error
+
+// EventStream holds a long-lived connection to the orchestrator on which it
+// receives the events of the sessions bound to this ingress, instead of one
+// Ingress.PushEvent call per event. It subscribes to sessions as they gain
+// their first connection and unsubscribes when they lose their last, and
+// reconnects with backoff when the connection drops.
+type EventStream struct {
+	addr      string
+	ingressID string
+	sessions  func() []string
+	deliver   DeliverFunc
+	changed   chan struct{}
+	logger    *slog.Logger
+
+	dialTimeout  time.Duration
+	writeTimeout time.Duration
+	minBackoff   time.Duration
+	maxBackoff   time.Duration
+}
+
+// NewEventStream creates an event stream to the orchestrator RPC address.
+// sessions returns the sessions bound here; deliver receives their events.
+func NewEventStream(baseURL, ingressID string, sessions func() []string, deliver DeliverFunc) *EventStream {
+	return &EventStream{
+		addr:         resolveRPCAddr(baseURL),
+		ingressID:    ingressID,
+		sessions:     sessions,
+		deliver:      deliver,
+		changed:      make(chan struct{}, 1),
+		logger:       slog.Default().With("ingress_id", ingressID),
+		dialTimeout:  5 * time.Second,
+		writeTimeout: 5 * time.Second,
+		minBackoff:   500 * time.Millisecond,
+		maxBackoff:   30 * time.Second,
+	}
+}
+
+// SessionsChanged tells the stream that the set of sessions changed. It
+// never blocks.
+func (s *EventStream) SessionsChanged() {
+	select {
+	case s.changed <- struct{}{}:
+	default:
+	}
+}
+
+// Run keeps the stream open until ctx is done.
+func (s *EventStream) Run(ctx context.Context) {
+	backoff := s.minBackoff
+	for {
+		opened := time.Now()
+		err := s.serve(ctx)
+		if ctx.Err() != nil {
+			return
+		}
+		// A stream that stayed up for a while starts over with a short delay.
+		if time.Since(opened) > s.maxBackoff {
+			backoff = s.minBackoff
+		}
+		s.logger.Warn("orchestrator event stream closed, reconnecting", "error", err, "retry_in", backoff)
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(backoff):
+		}
+		backoff = min(backoff*2, s.maxBackoff)
+	}
+}
+
+// serve opens one stream and serves it until it fails or ctx is done.
+func (s *EventStream) serve(ctx context.Context) error {
+	if s.addr == "" {
+		return fmt.Errorf("orchestrator rpc address is empty")
+	}
+	conn, err := net.DialTimeout("tcp", s.addr, s.dialTimeout)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+	stop := context.AfterFunc(ctx, func() { conn.Close() })
+	defer stop()
+
+	enc := json.NewEncoder(conn)
+	dec := json.NewDecoder(conn)
+
+	subscribed := make(map[string]bool)
+	for _, id := range s.sessions() {
+		subscribed[id] = true
+	}
+	params, _ := json.Marshal(SubscribeEventsArgs{IngressID: s.ingressID, SessionIDs: keys(subscribed)})
+	_ = conn.SetDeadline(time.Now().Add(s.dialTimeout))
+	if err := enc.Encode(StreamMessage{Method: SubscribeEventsMethod, Params: []json.RawMessage{params}, ID: json.RawMessage("0")}); err != nil {
+		return err
+	}
+	var reply StreamReply
+	if err := dec.Decode(&reply); err != nil {
+		return err
+	}
+	if reply.Error != nil {
+		return fmt.Errorf("orchestrator refused event stream: %v", reply.Error)
+	}
+	_ = conn.SetDeadline(time.Time{})
+	s.logger.Info("orchestrator event stream opened", "addr", s.addr, "sessions", len(subscribed))
+
+	readErr := make(chan error, 1)
+	go func() { readErr <- s.read(dec) }()
+	for {
+		select {
+		case err := <-readErr:
+			return err
+		case <-s.changed:
+			if err := s.sync(conn, enc, subscribed); err != nil {
+				return err
+			}
+		}
+	}
+}
+
+// read delivers the events received on the stream until it fails.
+func (s *EventStream) read(dec *json.Decoder) error {
+	for {
+		var msg StreamMessage
+		if err := dec.Decode(&msg); err != nil {
+			return err
+		}
+		if msg.Method != EventMethod || len(msg.Params) != 1 {
+			s.logger.Warn("ignoring unknown event stream message", "method", msg.Method)
+			continue
+		}
+		var req protocol.SendRequest
+		if err := json.Unmarshal(msg.Params[0], &req); err != nil {
+			s.logger.Warn("dropping malformed event stream event", "error", err)
+			continue
+		}
+		if err := s.deliver(&req, nil); err != nil {
+			s.logger.Warn("failed to deliver event stream event", "session_id", req.SessionID, "error", err)
+		}
+	}
+}
+
+// sync brings the orchestrator's subscriptions in line with the sessions
+// bound now, updating subscribed.
+func (s *EventStream) sync(conn net.Conn, enc *json.Encoder, subscribed map[string]bool) error {
+	current := make(map[string]bool)
+	for _, id := range s.sessions() {
+		current[id] = true
+	}
+	var added, removed []string
+	for id := range current {
+		if !subscribed[id] {
+			added = append(added, id)
+		}
+	}
+	for id := range subscribed {
+		if !current[id] {
+			removed = append(removed, id)
+		}
+	}
+
+	_ = conn.SetWriteDeadline(time.Now().Add(s.writeTimeout))
+	for _, change := range []struct {
+		method string
+		ids    []string
+	}{{SubscribeMethod, added}, {UnsubscribeMethod, removed}} {
+		if len(change.ids) == 0 {
+			continue
+		}
+		params, _ := json.Marshal(SubscribeArgs{SessionIDs: change.ids})
+		if err := enc.Encode(StreamMessage{Method: change.method, Params: []json.RawMessage{params}}); err != nil {
+			return err
+		}
+	}
+	for _, id := range added {
+		subscribed[id] = true
+	}
+	for _, id := range removed {
+		delete(subscribed, id)
+	}
+	return nil
+}
+
+func keys(set map[string]bool) []string {
+	ids := make([]string, 0, len(set))
+	for id := range set {
+		ids = append(ids, id)
+	}
+	return ids
+}
@@ -0,0 +1,97 @@
+package orchestrator
+
+import (
+	"context"
+	"encoding/json"
+	"net"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/xiaot623/gogo/ingress/internal/protocol"
+)
+
+func TestEventStreamSubscribesAndDelivers(t *testing.T) {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("Listen: %v", err)
+	}
+	defer ln.Close()
+
+	var mu sync.Mutex
+	sessions := []string{"s1"}
+	delivered := make(chan *protocol.SendRequest, 1)
+	stream := NewEventStream(ln.Addr().String(), "ingress-1",
+		func() []string {
+			mu.Lock()
+			defer mu.Unlock()
+			return append([]string(nil), sessions...)
+		},
+		func(req *protocol.SendRequest, resp *protocol.SendResponse) error {
+			delivered <- req
+			return nil
+		})
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go stream.Run(ctx)
+
+	conn, err := ln.Accept()
+	if err != nil {
+		t.Fatalf("Accept: %v", err)
+	}
+	defer conn.Close()
+	_ = conn.SetDeadline(time.Now().Add(5 * time.Second))
+	enc, dec := json.NewEncoder(conn), json.NewDecoder(conn)
+
+	// The stream opens with this instance's ID and bound sessions.
+	var hello StreamMessage
+	var args SubscribeEventsArgs
+	if err := dec.Decode(&hello); err != nil || hello.Method != SubscribeEventsMethod || len(hello.Params) != 1 {
+		t.Fatalf("unexpected hello %+v (%v)", hello, err)
+	}
+	_ = json.Unmarshal(hello.Params[0], &args)
+	if args.IngressID != "ingress-1" || len(args.SessionIDs) != 1 || args.SessionIDs[0] != "s1" {
+		t.Fatalf("unexpected hello args %+v", args)
+	}
+	if err := enc.Encode(map[string]interface{}{"id": hello.ID, "result": map[string]bool{"ok": true}, "error": nil}); err != nil {
+		t.Fatalf("reply: %v", err)
+	}
+
+	// Events sent as notifications are delivered.
+	params, _ := json.Marshal(protocol.SendRequest{Version: 1, SessionID: "s1", Event: map[string]interface{}{"type": "delta", "text": "hi"}})
+	if err := enc.Encode(StreamMessage{Method: EventMethod, Params: []json.RawMessage{params}}); err != nil {
+		t.Fatalf("send event: %v", err)
+	}
+	select {
+	case req := <-delivered:
+		if req.SessionID != "s1" || req.Event["text"] != "hi" {
+			t.Fatalf("unexpected delivered event %+v", req)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("event was not delivered")
+	}
+
+	// A session change is sent as Subscribe and Unsubscribe notifications.
+	mu.Lock()
+	sessions = []string{"s2"}
+	mu.Unlock()
+	stream.SessionsChanged()
+
+	got := make(map[string][]string)
+	for len(got) < 2 {
+		var msg StreamMessage
+		var sub SubscribeArgs
+		if err := dec.Decode(&msg); err != nil || len(msg.Params) != 1 || string(msg.ID) != "null" {
+			t.Fatalf("unexpected notification %+v (%v)", msg, err)
+		}
+		_ = json.Unmarshal(msg.Params[0], &sub)
+		got[msg.Method] = sub.SessionIDs
+	}
+	if ids := got[SubscribeMethod]; len(ids) != 1 || ids[0] != "s2" {
+		t.Fatalf("expected s2 subscribed, got %v", got)
+	}
+	if ids := got[UnsubscribeMethod]; len(ids) != 1 || ids[0] != "s1" {
+		t.Fatalf("expected s1 unsubscribed, got %v", got)
+	}
+}
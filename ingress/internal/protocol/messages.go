@@ -1,27 +1,71 @@
 // Package protocol defines the WebSocket message protocol between clients and ingress.
 package protocol
 
-import "encoding/json"
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+)
+
+// Subprotocol names clients offer in Sec-WebSocket-Protocol. A connection that
+// offers none speaks DefaultSubprotocol.
+const (
+	SubprotocolPrefix  = "gogo."
+	SubprotocolV1      = "gogo.v1"
+	DefaultSubprotocol = SubprotocolV1
+)
+
+// SupportedSubprotocols lists the subprotocols ingress accepts, most
+// preferred first.
+var SupportedSubprotocols = []string{SubprotocolV1}
+
+// IsSupportedSubprotocol reports whether ingress speaks the named subprotocol.
+func IsSupportedSubprotocol(name string) bool {
+	for _, p := range SupportedSubprotocols {
+		if p == name {
+			return true
+		}
+	}
+	return false
+}
+
+// IsGogoSubprotocol reports whether name is a gogo protocol version, whether
+// or not this ingress supports it.
+func IsGogoSubprotocol(name string) bool {
+	return strings.HasPrefix(name, SubprotocolPrefix)
+}
 
 // Message types from client to ingress
 const (
 	TypeHello            = "hello"
 	TypeAgentInvoke      = "agent_invoke"
 	TypeToolResult       = "tool_result"
+	TypeToolProgress     = "tool_progress"
 	TypeApprovalDecision = "approval_decision"
 	TypeCancelRun        = "cancel_run"
+	TypeListRuns         = "list_runs"
+	TypeAck              = "ack"
+	TypeEcho             = "echo"
 )
 
 // Message types from ingress to client
 const (
 	TypeHelloAck         = "hello_ack"
+	TypeSessionBound     = "session_bound"
 	TypeRunStarted       = "run_started"
 	TypeDelta            = "delta"
 	TypeState            = "state"
+	TypeToolCallDelta    = "tool_call_delta"
 	TypeToolRequest      = "tool_request"
+	TypeToolRequestChunk = "tool_request_chunk"
 	TypeApprovalRequired = "approval_required"
+	TypePolicyBlocked    = "policy_blocked"
+	TypeCancelAck        = "cancel_ack"
+	TypeRuns             = "runs"
 	TypeDone             = "done"
 	TypeError            = "error"
+	TypeEchoReply        = "echo_reply"
 )
 
 // BaseMessage contains common fields for all messages.
@@ -33,17 +77,36 @@ type BaseMessage struct {
 	RunID     string `json:"run_id,omitempty"`
 }
 
-// HelloMessage is sent by client to establish connection.
+// HelloMessage is sent by client to establish connection. ReconnectToken, from
+// an earlier hello_ack, may stand in for APIKey when rebinding the same
+// session_id and user_id.
 type HelloMessage struct {
 	BaseMessage
-	UserID     string            `json:"user_id,omitempty"`
-	APIKey     string            `json:"api_key,omitempty"`
-	ClientMeta map[string]string `json:"client_meta,omitempty"`
+	UserID         string            `json:"user_id,omitempty"`
+	APIKey         string            `json:"api_key,omitempty"`
+	ReconnectToken string            `json:"reconnect_token,omitempty"`
+	ClientMeta     map[string]string `json:"client_meta,omitempty"`
+	// DeviceID names the client device across reconnects; its acks let it
+	// resume a run's events from the orchestrator with only this ID.
+	DeviceID string `json:"device_id,omitempty"`
 }
 
-// HelloAckMessage is sent by ingress after successful hello.
+// HelloAckMessage is sent by ingress after successful hello. Protocol is the
+// subprotocol negotiated for the connection. ReconnectToken is set when
+// reconnect tokens are enabled and expires at ReconnectTokenExpiresAt (Unix
+// milliseconds).
 type HelloAckMessage struct {
 	BaseMessage
+	Protocol                string `json:"protocol"`
+	ReconnectToken          string `json:"reconnect_token,omitempty"`
+	ReconnectTokenExpiresAt int64  `json:"reconnect_token_expires_at,omitempty"`
+}
+
+// SessionBoundMessage follows hello_ack with the number of connections,
+// including this one, that now share the session.
+type SessionBoundMessage struct {
+	BaseMessage
+	Connections int `json:"connections"`
 }
 
 // AgentInvokeMessage is sent by client to invoke an agent.
@@ -51,6 +114,17 @@ type AgentInvokeMessage struct {
 	BaseMessage
 	AgentID string       `json:"agent_id"`
 	Message InputMessage `json:"message"`
+	// Tags label the run for grouping and filtering.
+	Tags []string `json:"tags,omitempty"`
+	// MaxHistory caps how many recent session messages the agent receives
+	// (0 = none, -1 = all); nil uses the orchestrator default.
+	MaxHistory *int `json:"max_history,omitempty"`
+	// MaxDurationMs caps the run's wall-clock time; it can only shorten the
+	// orchestrator's MAX_RUN_DURATION_MS.
+	MaxDurationMs int64 `json:"max_duration_ms,omitempty"`
+	// Priority orders the run for agent stream slots when the orchestrator
+	// is saturated: high, normal (default) or low.
+	Priority string `json:"priority,omitempty"`
 }
 
 // InputMessage represents the input message content.
@@ -66,6 +140,17 @@ type ToolResultMessage struct {
 	OK         bool            `json:"ok"`
 	Result     json.RawMessage `json:"result,omitempty"`
 	Error      json.RawMessage `json:"error,omitempty"`
+	// Nonce makes a resent result get the first one's outcome.
+	Nonce string `json:"nonce,omitempty"`
+}
+
+// ToolProgressMessage is sent by client with incremental output of a running
+// tool. Seq must increase across the chunks of a tool call.
+type ToolProgressMessage struct {
+	BaseMessage
+	ToolCallID string `json:"tool_call_id"`
+	Seq        int64  `json:"seq"`
+	Chunk      string `json:"chunk"`
 }
 
 // ApprovalDecisionMessage is sent by client to submit approval decision.
@@ -74,11 +159,111 @@ type ApprovalDecisionMessage struct {
 	ApprovalID string `json:"approval_id"`
 	Decision   string `json:"decision"` // "approve" or "reject"
 	Reason     string `json:"reason,omitempty"`
+	// Remember auto-approves the tool for the rest of the "session" or for
+	// the "user".
+	Remember string `json:"remember,omitempty"`
+	// Nonce makes a resent decision get the first one's outcome.
+	Nonce string `json:"nonce,omitempty"`
 }
 
-// CancelRunMessage is sent by client to cancel a run.
+// CancelRunMessage is sent by client to cancel a run. Reason and DecidedBy
+// are optional and recorded with the cancellation; DecidedBy defaults to
+// "user".
 type CancelRunMessage struct {
 	BaseMessage
+	Reason    string `json:"reason,omitempty"`
+	DecidedBy string `json:"decided_by,omitempty"`
+}
+
+// ListRunsMessage asks for the session's runs, e.g. to restore a client
+// after a reconnect. Active keeps only runs that have not ended.
+type ListRunsMessage struct {
+	BaseMessage
+	Active bool `json:"active,omitempty"`
+	Limit  int  `json:"limit,omitempty"`
+}
+
+// AckMessage tells the orchestrator that the client has handled RunID's
+// events up to Seq (from replayed events) or EventID (from pushed ones).
+// DeviceID defaults to the one sent in hello.
+type AckMessage struct {
+	BaseMessage
+	Seq      int64  `json:"seq,omitempty"`
+	EventID  string `json:"event_id,omitempty"`
+	DeviceID string `json:"device_id,omitempty"`
+}
+
+// EchoMessage is a connectivity check; ingress bounces Payload straight back
+// in an EchoReplyMessage without involving the orchestrator.
+type EchoMessage struct {
+	BaseMessage
+	Payload json.RawMessage `json:"payload,omitempty"`
+}
+
+// EchoReplyMessage answers an EchoMessage.
+type EchoReplyMessage struct {
+	BaseMessage
+	Payload json.RawMessage `json:"payload,omitempty"`
+}
+
+// RunStartedMessage is sent to the invoking connection as soon as the
+// orchestrator has accepted an agent_invoke. RequestID echoes the invoke so the
+// client can map it to RunID.
+type RunStartedMessage struct {
+	BaseMessage
+	AgentID          string   `json:"agent_id"`
+	RequestedAgentID string   `json:"requested_agent_id,omitempty"`
+	Fallback         bool     `json:"fallback,omitempty"`
+	OwnRun           bool     `json:"own_run"`
+	Tags             []string `json:"tags,omitempty"`
+}
+
+// CancelAckMessage is sent by ingress once the orchestrator has confirmed a
+// cancel_run request. Status is the run's final status; Reason and DecidedBy
+// are those recorded when the run was cancelled.
+type CancelAckMessage struct {
+	BaseMessage
+	Status    string `json:"status"`
+	Reason    string `json:"reason,omitempty"`
+	DecidedBy string `json:"decided_by,omitempty"`
+}
+
+// RunsMessage answers a ListRunsMessage with the session's runs that are not
+// archived, newest first.
+type RunsMessage struct {
+	BaseMessage
+	Runs []RunInfo `json:"runs"`
+}
+
+// RunInfo describes one run in a RunsMessage. StartedAt is in Unix
+// milliseconds.
+type RunInfo struct {
+	RunID     string `json:"run_id"`
+	Status    string `json:"status"`
+	StartedAt int64  `json:"started_at"`
+	AgentID   string `json:"agent_id"`
+}
+
+// PolicyBlockedMessage reports that policy blocked a tool call, whether the
+// client or the agent invoked it. The tool call ends as BLOCKED.
+type PolicyBlockedMessage struct {
+	BaseMessage
+	ToolCallID string `json:"tool_call_id"`
+	ToolName   string `json:"tool_name"`
+	Reason     string `json:"reason,omitempty"`
+}
+
+// ToolRequestChunkMessage carries one fragment of a large tool_request's args.
+// Clients concatenate Data in Seq order and parse the result once Last is set.
+type ToolRequestChunkMessage struct {
+	BaseMessage
+	ToolCallID string `json:"tool_call_id"`
+	ToolName   string `json:"tool_name"`
+	DeadlineTs int64  `json:"deadline_ts"`
+	Seq        int    `json:"seq"`
+	Total      int    `json:"total"`
+	Last       bool   `json:"last"`
+	Data       string `json:"data"`
 }
 
 // ErrorMessage is sent by ingress when an error occurs.
@@ -86,6 +271,12 @@ type ErrorMessage struct {
 	BaseMessage
 	Code    string `json:"code"`
 	Message string `json:"message"`
+	// Retryable is set when resending the failed request may succeed, after
+	// waiting RetryAfterMs.
+	Retryable    bool  `json:"retryable,omitempty"`
+	RetryAfterMs int64 `json:"retry_after_ms,omitempty"`
+	// LimitBytes is the size limit a message_too_large message exceeded.
+	LimitBytes int64 `json:"limit_bytes,omitempty"`
 }
 
 // Error codes
@@ -95,6 +286,33 @@ const (
 	ErrorCodeSessionRequired  = "session_required"
 	ErrorCodeInternalError    = "internal_error"
 	ErrorCodeOrchestratorFail = "orchestrator_fail"
+	ErrorCodeRateLimited      = "rate_limited"
+	ErrorCodeMessageTooLarge  = "message_too_large"
+	ErrorCodeMaintenance      = "maintenance"
+	ErrorCodeSessionFull      = "session_full"
+)
+
+// Close codes sent by ingress in WebSocket close frames, from the 4000-4999
+// range RFC 6455 leaves to applications. Clients use them to decide whether
+// and how to reconnect.
+const (
+	// CloseCodeUnauthorized: hello carried an invalid api_key. Reconnecting
+	// with the same credentials fails again.
+	CloseCodeUnauthorized = 4001
+	// CloseCodeServerShutdown: ingress is shutting down. Reconnect after a
+	// short backoff.
+	CloseCodeServerShutdown = 4002
+	// CloseCodeSlowConsumer: the client read too slowly and its send buffer
+	// filled up. Events queued after the buffer filled are lost.
+	CloseCodeSlowConsumer = 4003
+	// CloseCodeSessionTakenOver: another connection sent hello for the same
+	// session while SESSION_BIND_POLICY is single_active. Reconnecting takes
+	// the session back from it.
+	CloseCodeSessionTakenOver = 4004
+	// CloseCodeSessionFull: hello named a session that already has
+	// MAX_SESSION_CONNECTIONS connections; sent after the session_full
+	// error. Reconnecting fails until one of them closes.
+	CloseCodeSessionFull = 4005
 )
 
 // RawMessage is used for parsing incoming messages before type dispatch.
@@ -102,3 +320,42 @@ type RawMessage struct {
 	Type string          `json:"type"`
 	Data json.RawMessage `json:"-"`
 }
+
+// SendVersion is the version of the SendRequest payload the orchestrator
+// pushes to ingress. A request without a version is treated as version 1.
+const SendVersion = 1
+
+// SendRequest is the payload of an orchestrator event push, received over
+// RPC (Ingress.PushEvent) or POST /internal/send. The orchestrator mirrors it
+// in its ingress adapter.
+type SendRequest struct {
+	Version   int                    `json:"version,omitempty"`
+	SessionID string                 `json:"session_id"`
+	Event     map[string]interface{} `json:"event"`
+}
+
+// SendResponse is the reply to an event push.
+type SendResponse struct {
+	OK        bool `json:"ok"`
+	Delivered bool `json:"delivered"`
+}
+
+// Validate reports the first problem that makes the request undeliverable:
+// an unsupported version, a missing session_id or event, or an event without
+// a string type.
+func (r *SendRequest) Validate() error {
+	if r.Version < 0 || r.Version > SendVersion {
+		return fmt.Errorf("unsupported version %d (max %d)", r.Version, SendVersion)
+	}
+	if r.SessionID == "" {
+		return errors.New("session_id is required")
+	}
+	if r.Event == nil {
+		return errors.New("event is required")
+	}
+	typ, ok := r.Event["type"].(string)
+	if !ok || typ == "" {
+		return errors.New("event.type must be a non-empty string")
+	}
+	return nil
+}
@@ -3,13 +3,15 @@ package rpc
 import (
 	"context"
 	"errors"
-	"log"
+	"log/slog"
 	"net"
 	"net/rpc"
 	"net/rpc/jsonrpc"
 	"time"
 
+	"github.com/gorilla/websocket"
 	"github.com/xiaot623/gogo/ingress/internal/hub"
+	"github.com/xiaot623/gogo/ingress/internal/protocol"
 )
 
 // Server exposes ingress RPC endpoints.
@@ -22,8 +24,7 @@ type Server struct {
 // NewServer creates a new ingress RPC server.
 func NewServer(h *hub.Hub) (*Server, error) {
 	rpcServer := rpc.NewServer()
-	handler := &Handler{hub: h}
-	if err := rpcServer.RegisterName("Ingress", handler); err != nil {
+	if err := rpcServer.RegisterName("Ingress", NewHandler(h)); err != nil {
 		return nil, err
 	}
 
@@ -48,7 +49,7 @@ func (s *Server) Start(addr string) error {
 				close(s.done)
 				return nil
 			}
-			log.Printf("RPC accept error: %v", err)
+			slog.Warn("RPC accept error", "error", err)
 			continue
 		}
 
@@ -79,28 +80,29 @@ type Handler struct {
 	hub *hub.Hub
 }
 
-// SendRequest represents the request body for event delivery.
-type SendRequest struct {
-	SessionID string                 `json:"session_id"`
-	Event     map[string]interface{} `json:"event"`
+// NewHandler creates the RPC handler for h. Its PushEvent also delivers the
+// events the orchestrator sends on the event stream.
+func NewHandler(h *hub.Hub) *Handler {
+	return &Handler{hub: h}
 }
 
-// SendResponse represents the response for event delivery.
-type SendResponse struct {
-	OK        bool `json:"ok"`
-	Delivered bool `json:"delivered"`
-}
+// SendRequest is the request body for event delivery.
+type SendRequest = protocol.SendRequest
+
+// SendResponse is the response for event delivery.
+type SendResponse = protocol.SendResponse
+
+// InvalidSendPrefix starts the error returned for a malformed push, so the
+// orchestrator can tell it from a delivery failure worth retrying.
+const InvalidSendPrefix = "invalid send request: "
 
 // PushEvent forwards events from the orchestrator to WebSocket clients.
 func (h *Handler) PushEvent(req *SendRequest, resp *SendResponse) error {
 	if req == nil {
-		return errors.New("send request is required")
-	}
-	if req.SessionID == "" {
-		return errors.New("session_id is required")
+		return errors.New(InvalidSendPrefix + "send request is required")
 	}
-	if req.Event == nil {
-		return errors.New("event is required")
+	if err := req.Validate(); err != nil {
+		return errors.New(InvalidSendPrefix + err.Error())
 	}
 
 	if _, ok := req.Event["ts"]; !ok {
@@ -108,11 +110,11 @@ func (h *Handler) PushEvent(req *SendRequest, resp *SendResponse) error {
 	}
 
 	hasConnections := h.hub.HasActiveConnections(req.SessionID)
-	if err := h.hub.BroadcastJSON(req.SessionID, req.Event); err != nil {
+	if err := h.hub.BroadcastEvent(req.SessionID, req.Event); err != nil {
 		return err
 	}
 
-	log.Printf("Event sent to session %s: type=%v, delivered=%v", req.SessionID, req.Event["type"], hasConnections)
+	h.hub.Logger().Debug("event sent to session", "session_id", req.SessionID, "type", req.Event["type"], "delivered", hasConnections)
 
 	if resp != nil {
 		resp.OK = true
@@ -120,3 +122,39 @@ func (h *Handler) PushEvent(req *SendRequest, resp *SendResponse) error {
 	}
 	return nil
 }
+
+// DisconnectRequest represents the request body for evicting a session.
+type DisconnectRequest struct {
+	SessionID string `json:"session_id"`
+	Code      int    `json:"code,omitempty"`
+	Reason    string `json:"reason,omitempty"`
+}
+
+// DisconnectResponse represents the response for evicting a session.
+type DisconnectResponse struct {
+	OK           bool `json:"ok"`
+	Disconnected int  `json:"disconnected"`
+}
+
+// DisconnectSession closes every WebSocket connection of a session with the
+// given close code (default 1008, policy violation) and reason.
+func (h *Handler) DisconnectSession(req *DisconnectRequest, resp *DisconnectResponse) error {
+	if req == nil {
+		return errors.New("disconnect request is required")
+	}
+	if req.SessionID == "" {
+		return errors.New("session_id is required")
+	}
+	code := req.Code
+	if code == 0 {
+		code = websocket.ClosePolicyViolation
+	}
+
+	n := h.hub.CloseSession(req.SessionID, code, req.Reason)
+
+	if resp != nil {
+		resp.OK = true
+		resp.Disconnected = n
+	}
+	return nil
+}
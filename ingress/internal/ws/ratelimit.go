@@ -0,0 +1,98 @@
+package ws
+
+import (
+	"sync"
+	"time"
+
+	"golang.org/x/time/rate"
+)
+
+// limiterIdleTTL is how long a session's limiter is kept after its last use.
+const limiterIdleTTL = 10 * time.Minute
+
+// sessionLimiter applies a token-bucket rate limit per session.
+type sessionLimiter struct {
+	limit rate.Limit
+	burst int
+
+	mu        sync.Mutex
+	limiters  map[string]*limiterEntry
+	lastSweep time.Time
+}
+
+type limiterEntry struct {
+	limiter  *rate.Limiter
+	lastSeen time.Time
+}
+
+// newSessionLimiter creates a limiter allowing perMinute events per session
+// with the given burst. A non-positive rate disables limiting.
+func newSessionLimiter(perMinute float64, burst int) *sessionLimiter {
+	if perMinute <= 0 {
+		return nil
+	}
+	if burst < 1 {
+		burst = 1
+	}
+	return &sessionLimiter{
+		limit:    rate.Limit(perMinute / 60),
+		burst:    burst,
+		limiters: make(map[string]*limiterEntry),
+	}
+}
+
+// Allow reports whether the session may perform another event now.
+func (l *sessionLimiter) Allow(sessionID string) bool {
+	if l == nil {
+		return true
+	}
+	now := time.Now()
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if now.Sub(l.lastSweep) > limiterIdleTTL {
+		for id, e := range l.limiters {
+			if now.Sub(e.lastSeen) > limiterIdleTTL {
+				delete(l.limiters, id)
+			}
+		}
+		l.lastSweep = now
+	}
+
+	e, ok := l.limiters[sessionID]
+	if !ok {
+		e = &limiterEntry{limiter: rate.NewLimiter(l.limit, l.burst)}
+		l.limiters[sessionID] = e
+	}
+	e.lastSeen = now
+	return e.limiter.AllowN(now, 1)
+}
+
+// sendLimiter caps the bytes per second written to one connection.
+type sendLimiter struct {
+	limiter *rate.Limiter
+}
+
+// newSendLimiter creates a limiter allowing bytesPerSecond with bursts of
+// burst bytes. A non-positive rate disables limiting.
+func newSendLimiter(bytesPerSecond, burst int) *sendLimiter {
+	if bytesPerSecond <= 0 {
+		return nil
+	}
+	if burst < 1 {
+		burst = bytesPerSecond
+	}
+	return &sendLimiter{limiter: rate.NewLimiter(rate.Limit(bytesPerSecond), burst)}
+}
+
+// wait blocks until n more bytes may be written. A message larger than the
+// burst is charged the whole burst, so it waits for a full bucket rather
+// than forever.
+func (l *sendLimiter) wait(n int) {
+	if l == nil {
+		return
+	}
+	n = min(n, l.limiter.Burst())
+	time.Sleep(l.limiter.ReserveN(time.Now(), n).Delay())
+}
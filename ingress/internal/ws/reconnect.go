@@ -0,0 +1,90 @@
+package ws
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"strings"
+	"time"
+)
+
+// Errors returned when a reconnect token is refused.
+var (
+	errTokenMalformed = errors.New("malformed reconnect token")
+	errTokenSignature = errors.New("invalid reconnect token signature")
+	errTokenExpired   = errors.New("reconnect token expired")
+	errTokenMismatch  = errors.New("reconnect token is for another session or user")
+)
+
+// reconnectClaims is the signed body of a reconnect token.
+type reconnectClaims struct {
+	SessionID string `json:"sid"`
+	UserID    string `json:"uid,omitempty"`
+	ExpiresAt int64  `json:"exp"` // Unix milliseconds
+}
+
+// reconnectTokens issues and verifies stateless reconnect tokens: the
+// base64url claims and their HMAC-SHA256, joined by a dot. Any ingress
+// replica sharing the secret can verify a token another one issued.
+type reconnectTokens struct {
+	secret []byte
+	ttl    time.Duration
+	now    func() time.Time
+}
+
+// newReconnectTokens returns nil, disabling reconnect tokens, when secret is
+// empty or ttl is not positive.
+func newReconnectTokens(secret string, ttl time.Duration) *reconnectTokens {
+	if secret == "" || ttl <= 0 {
+		return nil
+	}
+	return &reconnectTokens{secret: []byte(secret), ttl: ttl, now: time.Now}
+}
+
+// issue returns a token binding sessionID and userID, and its expiry in Unix
+// milliseconds.
+func (t *reconnectTokens) issue(sessionID, userID string) (string, int64) {
+	claims := reconnectClaims{
+		SessionID: sessionID,
+		UserID:    userID,
+		ExpiresAt: t.now().Add(t.ttl).UnixMilli(),
+	}
+	body, _ := json.Marshal(claims)
+	encoded := base64.RawURLEncoding.EncodeToString(body)
+	return encoded + "." + t.sign(encoded), claims.ExpiresAt
+}
+
+// verify checks that token is authentic, unexpired and bound to sessionID and
+// userID.
+func (t *reconnectTokens) verify(token, sessionID, userID string) error {
+	encoded, sig, ok := strings.Cut(token, ".")
+	if !ok {
+		return errTokenMalformed
+	}
+	if !hmac.Equal([]byte(sig), []byte(t.sign(encoded))) {
+		return errTokenSignature
+	}
+	body, err := base64.RawURLEncoding.DecodeString(encoded)
+	if err != nil {
+		return errTokenMalformed
+	}
+	var claims reconnectClaims
+	if err := json.Unmarshal(body, &claims); err != nil {
+		return errTokenMalformed
+	}
+	if t.now().UnixMilli() >= claims.ExpiresAt {
+		return errTokenExpired
+	}
+	if claims.SessionID != sessionID || claims.UserID != userID {
+		return errTokenMismatch
+	}
+	return nil
+}
+
+func (t *reconnectTokens) sign(encoded string) string {
+	mac := hmac.New(sha256.New, t.secret)
+	mac.Write([]byte(encoded))
+	return base64.RawURLEncoding.EncodeToString(mac.Sum(nil))
+}
@@ -4,9 +4,13 @@ package ws
 import (
 	"context"
 	"encoding/json"
-	"log"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
 	"net/http"
 	"strings"
+	"sync"
 	"time"
 
 	"github.com/google/uuid"
@@ -24,48 +28,159 @@ type Server struct {
 	cfg          *config.Config
 	hub          *hub.Hub
 	orchestrator *orchestrator.Client
+	logger       *slog.Logger
 	upgrader     websocket.Upgrader
+	invokeLimit  *sessionLimiter
+	reconnect    *reconnectTokens
+
+	// writers tracks running writePumps so Drain can wait for close frames
+	// to be sent.
+	writers sync.WaitGroup
+
+	// handlers maps a subprotocol to the handlers for its message types.
+	handlers map[string]map[string]messageHandler
 }
 
+// messageHandler handles one inbound message of a known type.
+type messageHandler func(conn *hub.Connection, data []byte)
+
 // NewServer creates a new WebSocket server.
 func NewServer(cfg *config.Config, h *hub.Hub, orch *orchestrator.Client) *Server {
-	return &Server{
+	s := &Server{
 		cfg:          cfg,
 		hub:          h,
 		orchestrator: orch,
+		logger:       h.Logger(),
 		upgrader: websocket.Upgrader{
-			ReadBufferSize:  1024,
-			WriteBufferSize: 1024,
+			ReadBufferSize:  cfg.ReadBufferSize,
+			WriteBufferSize: cfg.WriteBufferSize,
+			Subprotocols:    protocol.SupportedSubprotocols,
 			CheckOrigin: func(r *http.Request) bool {
 				// Allow all origins for MVP
 				return true
 			},
 		},
+		invokeLimit: newSessionLimiter(cfg.InvokeRatePerMinute, cfg.InvokeBurst),
+		reconnect:   newReconnectTokens(cfg.ReconnectTokenSecret, cfg.ReconnectTokenTTL),
+	}
+	s.handlers = map[string]map[string]messageHandler{
+		protocol.SubprotocolV1: s.v1Handlers(),
+	}
+	return s
+}
+
+// connLogger returns the server logger annotated with the connection and its
+// session.
+func (s *Server) connLogger(conn *hub.Connection) *slog.Logger {
+	return s.logger.With("conn_id", conn.ID, "session_id", conn.SessionID)
+}
+
+// v1Handlers returns the message handlers of the gogo.v1 subprotocol. A later
+// version starts from a copy of these and adds or replaces entries, so v1
+// clients keep their behavior.
+func (s *Server) v1Handlers() map[string]messageHandler {
+	return map[string]messageHandler{
+		protocol.TypeHello:            s.handleHello,
+		protocol.TypeAgentInvoke:      s.handleAgentInvoke,
+		protocol.TypeToolResult:       s.handleToolResult,
+		protocol.TypeToolProgress:     s.handleToolProgress,
+		protocol.TypeApprovalDecision: s.handleApprovalDecision,
+		protocol.TypeCancelRun:        s.handleCancelRun,
+		protocol.TypeListRuns:         s.handleListRuns,
+		protocol.TypeAck:              s.handleAck,
+		protocol.TypeEcho:             s.handleEcho,
 	}
 }
 
 // HandleWebSocket handles WebSocket upgrade and connection lifecycle.
 func (s *Server) HandleWebSocket(c echo.Context) error {
+	if offered := unsupportedSubprotocols(c.Request()); offered != nil {
+		s.logger.Warn("rejecting WebSocket handshake: unsupported subprotocols", "offered", offered)
+		return c.JSON(http.StatusBadRequest, map[string]interface{}{
+			"error":     "unsupported protocol version: " + strings.Join(offered, ", "),
+			"code":      "unsupported_protocol",
+			"supported": protocol.SupportedSubprotocols,
+		})
+	}
+
 	ws, err := s.upgrader.Upgrade(c.Response(), c.Request(), nil)
 	if err != nil {
-		log.Printf("Failed to upgrade WebSocket: %v", err)
+		s.logger.Error("failed to upgrade WebSocket", "error", err)
 		return err
 	}
 
-	// Create and register connection
+	// Create and register connection. Clients that offer no subprotocol
+	// predate versioning and speak the default.
 	conn := s.hub.NewConnection(ws)
+	if p := ws.Subprotocol(); p != "" {
+		conn.Protocol = p
+	}
 	s.hub.Register(conn)
 
-	// Set up connection parameters
-	ws.SetReadLimit(s.cfg.MaxMessageSize)
+	// Message size limits are enforced by readPump: ws.SetReadLimit would drop
+	// the connection without telling the client why.
 
 	// Start reader and writer goroutines
+	s.writers.Add(1)
 	go s.writePump(conn)
 	go s.readPump(conn)
 
 	return nil
 }
 
+// Drain closes every connection with CloseCodeServerShutdown and waits until
+// their close frames have been written or ctx ends. Call it before shutting
+// down the HTTP server, which does not track hijacked WebSocket connections.
+func (s *Server) Drain(ctx context.Context) error {
+	s.hub.CloseAll(protocol.CloseCodeServerShutdown, "server shutting down")
+
+	done := make(chan struct{})
+	go func() {
+		s.writers.Wait()
+		close(done)
+	}()
+	select {
+	case <-done:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// ReportSessionDisconnected tells the orchestrator that a session has no
+// connection left, so it can cancel or stop pushing the session's runs. It is
+// skipped if a client has reconnected to the session in the meantime.
+func (s *Server) ReportSessionDisconnected(sessionID string) {
+	if s.hub.HasActiveConnections(sessionID) {
+		return
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+	resp, err := s.orchestrator.SessionDisconnected(ctx, sessionID)
+	if err != nil {
+		s.logger.Warn("failed to report session disconnect", "session_id", sessionID, "error", err)
+		return
+	}
+	s.logger.Info("reported session disconnect", "session_id", sessionID, "cancelled_runs", resp.CancelledRuns, "detached", resp.Detached)
+}
+
+// unsupportedSubprotocols returns the gogo subprotocols a handshake offers
+// when none of them is supported, and nil otherwise. Offered protocols outside
+// the gogo namespace are ignored.
+func unsupportedSubprotocols(r *http.Request) []string {
+	var offered []string
+	for _, p := range websocket.Subprotocols(r) {
+		if !protocol.IsGogoSubprotocol(p) {
+			continue
+		}
+		if protocol.IsSupportedSubprotocol(p) {
+			return nil
+		}
+		offered = append(offered, p)
+	}
+	return offered
+}
+
 // readPump reads messages from the WebSocket connection.
 func (s *Server) readPump(conn *hub.Connection) {
 	defer func() {
@@ -79,39 +194,91 @@ func (s *Server) readPump(conn *hub.Connection) {
 		return nil
 	})
 
+	limit := s.cfg.MaxFrameSize()
 	for {
-		_, message, err := conn.Conn.ReadMessage()
+		_, r, err := conn.Conn.NextReader()
 		if err != nil {
 			if websocket.IsUnexpectedCloseError(err, websocket.CloseGoingAway, websocket.CloseAbnormalClosure) {
-				log.Printf("WebSocket error: %v", err)
+				s.connLogger(conn).Warn("WebSocket error", "error", err)
 			}
 			break
 		}
+		if limit > 0 {
+			// Read one byte past the limit to detect oversized messages
+			// without buffering them.
+			r = io.LimitReader(r, limit+1)
+		}
+		message, err := io.ReadAll(r)
+		if err != nil {
+			if websocket.IsUnexpectedCloseError(err, websocket.CloseGoingAway, websocket.CloseAbnormalClosure) {
+				s.connLogger(conn).Warn("WebSocket error", "error", err)
+			}
+			break
+		}
+		if limit > 0 && int64(len(message)) > limit {
+			s.closeOversized(conn, limit)
+			break
+		}
 
 		s.handleMessage(conn, message)
 	}
 }
 
+// closeOversized tells the client its message exceeded limit and closes the
+// connection, since the rest of the message is left unread. The frames are
+// written directly so they go out before the connection is torn down.
+func (s *Server) closeOversized(conn *hub.Connection, limit int64) {
+	s.connLogger(conn).Warn("closing connection: inbound message too large", "limit", limit)
+	data, err := json.Marshal(messageTooLarge(conn, limit))
+	if err != nil {
+		return
+	}
+	conn.SetWriteDeadline(time.Now().Add(s.cfg.WriteTimeout))
+	if err := conn.WriteMessage(websocket.TextMessage, data); err != nil {
+		return
+	}
+	conn.WriteMessage(websocket.CloseMessage, websocket.FormatCloseMessage(websocket.CloseMessageTooBig, "message too large"))
+}
+
+func messageTooLarge(conn *hub.Connection, limit int64) protocol.ErrorMessage {
+	return protocol.ErrorMessage{
+		BaseMessage: protocol.BaseMessage{
+			Type:      protocol.TypeError,
+			Ts:        time.Now().UnixMilli(),
+			SessionID: conn.SessionID,
+		},
+		Code:       protocol.ErrorCodeMessageTooLarge,
+		Message:    fmt.Sprintf("message exceeds %d bytes", limit),
+		LimitBytes: limit,
+	}
+}
+
 // writePump writes messages to the WebSocket connection.
 func (s *Server) writePump(conn *hub.Connection) {
 	ticker := time.NewTicker(s.cfg.PingInterval)
+	limiter := newSendLimiter(s.cfg.SendBytesPerSecond, s.cfg.SendBurstBytes)
 	defer func() {
 		ticker.Stop()
 		conn.Close()
+		s.writers.Done()
 	}()
 
 	for {
 		select {
 		case message, ok := <-conn.Send:
-			conn.SetWriteDeadline(time.Now().Add(s.cfg.WriteTimeout))
 			if !ok {
 				// Hub closed the channel
-				conn.WriteMessage(websocket.CloseMessage, []byte{})
+				conn.SetWriteDeadline(time.Now().Add(s.cfg.WriteTimeout))
+				conn.WriteMessage(websocket.CloseMessage, conn.CloseFrame())
 				return
 			}
 
+			// A throttled connection's Send buffer fills while it waits, and
+			// the hub closes it as a slow consumer once it is full.
+			limiter.wait(len(message))
+			conn.SetWriteDeadline(time.Now().Add(s.cfg.WriteTimeout))
 			if err := conn.WriteMessage(websocket.TextMessage, message); err != nil {
-				log.Printf("Failed to write message: %v", err)
+				s.connLogger(conn).Warn("failed to write message", "error", err)
 				return
 			}
 
@@ -124,7 +291,8 @@ func (s *Server) writePump(conn *hub.Connection) {
 	}
 }
 
-// handleMessage dispatches incoming messages to appropriate handlers.
+// handleMessage dispatches incoming messages to the handler registered for
+// their type under the connection's subprotocol.
 func (s *Server) handleMessage(conn *hub.Connection, data []byte) {
 	// Parse message type
 	var baseMsg protocol.BaseMessage
@@ -132,21 +300,17 @@ func (s *Server) handleMessage(conn *hub.Connection, data []byte) {
 		s.sendError(conn, "", protocol.ErrorCodeInvalidMessage, "invalid JSON message")
 		return
 	}
+	if limit := s.cfg.MessageSizeLimit(baseMsg.Type); limit > 0 && int64(len(data)) > limit {
+		s.hub.SendJSONToConnection(conn, messageTooLarge(conn, limit))
+		return
+	}
 
-	switch baseMsg.Type {
-	case protocol.TypeHello:
-		s.handleHello(conn, data)
-	case protocol.TypeAgentInvoke:
-		s.handleAgentInvoke(conn, data)
-	case protocol.TypeToolResult:
-		s.handleToolResult(conn, data)
-	case protocol.TypeApprovalDecision:
-		s.handleApprovalDecision(conn, data)
-	case protocol.TypeCancelRun:
-		s.handleCancelRun(conn, data)
-	default:
+	handle, ok := s.handlers[conn.Protocol][baseMsg.Type]
+	if !ok {
 		s.sendError(conn, "", protocol.ErrorCodeInvalidMessage, "unknown message type: "+baseMsg.Type)
+		return
 	}
+	handle(conn, data)
 }
 
 // handleHello handles the hello handshake message.
@@ -157,20 +321,37 @@ func (s *Server) handleHello(conn *hub.Connection, data []byte) {
 		return
 	}
 
-	// Validate API key if configured
-	if s.cfg.APIKey != "" && msg.APIKey != s.cfg.APIKey {
+	// Validate API key if configured, unless a valid reconnect token rebinds
+	// the session it was issued for
+	if s.cfg.APIKey != "" && !s.validReconnectToken(conn, &msg) && msg.APIKey != s.cfg.APIKey {
 		s.sendError(conn, "", protocol.ErrorCodeUnauthorized, "invalid api_key")
+		s.hub.CloseConnection(conn, protocol.CloseCodeUnauthorized, "invalid api_key")
 		return
 	}
 
 	// Generate or use provided session ID
 	sessionID := msg.SessionID
 	if sessionID == "" {
-		sessionID = "sess_" + uuid.New().String()[:8]
+		sessionID = "sess_" + uuid.Must(uuid.NewV7()).String()
 	}
 
 	// Bind connection to session
-	s.hub.BindSession(conn, sessionID)
+	conn.ClientMeta = msg.ClientMeta
+	conn.DeviceID = msg.DeviceID
+	connections := 1
+	if s.cfg.SessionBindPolicy == config.SessionBindSingleActive {
+		if taken := s.hub.TakeOverSession(conn, sessionID, protocol.CloseCodeSessionTakenOver, "session_taken_over"); taken > 0 {
+			s.connLogger(conn).Info("session taken over from other connections", "connections", taken)
+		}
+	} else {
+		var err error
+		if connections, err = s.hub.BindSession(conn, sessionID); err != nil {
+			s.connLogger(conn).Warn("rejecting hello: session is full", "requested_session_id", sessionID, "connections", connections)
+			s.sendError(conn, "", protocol.ErrorCodeSessionFull, fmt.Sprintf("session already has %d connections", connections))
+			s.hub.CloseConnection(conn, protocol.CloseCodeSessionFull, "session_full")
+			return
+		}
+	}
 
 	// Send hello_ack
 	ack := protocol.HelloAckMessage{
@@ -179,10 +360,81 @@ func (s *Server) handleHello(conn *hub.Connection, data []byte) {
 			Ts:        time.Now().UnixMilli(),
 			SessionID: sessionID,
 		},
+		Protocol: conn.Protocol,
+	}
+	if s.reconnect != nil {
+		ack.ReconnectToken, ack.ReconnectTokenExpiresAt = s.reconnect.issue(sessionID, msg.UserID)
 	}
 	s.hub.SendJSONToConnection(conn, ack)
+	s.hub.SendJSONToConnection(conn, protocol.SessionBoundMessage{
+		BaseMessage: protocol.BaseMessage{
+			Type:      protocol.TypeSessionBound,
+			Ts:        time.Now().UnixMilli(),
+			SessionID: sessionID,
+		},
+		Connections: connections,
+	})
+
+	s.connLogger(conn).Info("hello handshake completed", "connections", connections)
+}
+
+// validReconnectToken reports whether a hello carries a reconnect token that
+// authenticates it. A refused token is logged and the hello falls back to
+// api_key authentication.
+func (s *Server) validReconnectToken(conn *hub.Connection, msg *protocol.HelloMessage) bool {
+	if s.reconnect == nil || msg.ReconnectToken == "" || msg.SessionID == "" {
+		return false
+	}
+	if err := s.reconnect.verify(msg.ReconnectToken, msg.SessionID, msg.UserID); err != nil {
+		s.connLogger(conn).Info("reconnect token refused", "requested_session_id", msg.SessionID, "error", err)
+		return false
+	}
+	return true
+}
 
-	log.Printf("Hello handshake completed for session: %s", sessionID)
+// handleEcho bounces an echo payload back to the sending connection.
+func (s *Server) handleEcho(conn *hub.Connection, data []byte) {
+	if !s.cfg.EchoEnabled {
+		s.sendError(conn, "", protocol.ErrorCodeInvalidMessage, "echo is disabled")
+		return
+	}
+
+	var msg protocol.EchoMessage
+	if err := json.Unmarshal(data, &msg); err != nil {
+		s.sendError(conn, "", protocol.ErrorCodeInvalidMessage, "invalid echo message")
+		return
+	}
+
+	if conn.SessionID == "" {
+		s.sendError(conn, "", protocol.ErrorCodeSessionRequired, "must send hello first")
+		return
+	}
+
+	s.hub.SendJSONToConnection(conn, protocol.EchoReplyMessage{
+		BaseMessage: protocol.BaseMessage{
+			Type:      protocol.TypeEchoReply,
+			Ts:        time.Now().UnixMilli(),
+			RequestID: msg.RequestID,
+			SessionID: conn.SessionID,
+		},
+		Payload: msg.Payload,
+	})
+}
+
+// clientContextPrefix namespaces client_meta keys in an invoke's context so a
+// client cannot set orchestrator context such as user_id.
+const clientContextPrefix = "client."
+
+// clientContext turns a connection's client_meta into invoke context entries.
+func clientContext(meta map[string]string) map[string]string {
+	if len(meta) == 0 {
+		return nil
+	}
+	ctx := make(map[string]string, len(meta))
+	for k, v := range meta {
+		ctx[clientContextPrefix+k] = v
+	}
+	return ctx
 }
 
 // handleAgentInvoke handles agent invocation requests.
@@ -199,12 +451,25 @@ func (s *Server) handleAgentInvoke(conn *hub.Connection, data []byte) {
 		return
 	}
 
+	if s.cfg.MaxInvokeContentBytes > 0 && len(msg.Message.Content) > s.cfg.MaxInvokeContentBytes {
+		s.sendError(conn, "", protocol.ErrorCodeInvalidMessage,
+			fmt.Sprintf("message content exceeds %d bytes", s.cfg.MaxInvokeContentBytes))
+		return
+	}
+
 	// Use session from connection or message
 	sessionID := conn.SessionID
 	if msg.SessionID != "" {
 		sessionID = msg.SessionID
 	}
 
+	// Limit on the session bound at hello: msg.SessionID is client-chosen,
+	// so keying on it would let a client mint a fresh budget per request.
+	if !s.invokeLimit.Allow(conn.SessionID) {
+		s.sendError(conn, "", protocol.ErrorCodeRateLimited, "too many agent_invoke requests, slow down")
+		return
+	}
+
 	// Prepare orchestrator request
 	req := &orchestrator.InvokeRequest{
 		SessionID: sessionID,
@@ -213,7 +478,12 @@ func (s *Server) handleAgentInvoke(conn *hub.Connection, data []byte) {
 			Role:    msg.Message.Role,
 			Content: msg.Message.Content,
 		},
-		RequestID: msg.RequestID,
+		RequestID:     msg.RequestID,
+		Context:       clientContext(conn.ClientMeta),
+		Tags:          msg.Tags,
+		MaxHistory:    msg.MaxHistory,
+		MaxDurationMs: msg.MaxDurationMs,
+		Priority:      msg.Priority,
 	}
 
 	// Call orchestrator (async - don't block the WebSocket)
@@ -223,16 +493,51 @@ func (s *Server) handleAgentInvoke(conn *hub.Connection, data []byte) {
 
 		resp, err := s.orchestrator.Invoke(ctx, req)
 		if err != nil {
-			log.Printf("Orchestrator invoke failed: %v", err)
-			s.sendErrorToSession(sessionID, msg.RequestID, protocol.ErrorCodeOrchestratorFail, err.Error())
+			s.connLogger(conn).Error("orchestrator invoke failed", "error", err)
+			code := protocol.ErrorCodeOrchestratorFail
+			var oerr *orchestrator.Error
+			if errors.As(err, &oerr) && oerr.Kind == orchestrator.ErrorKindMaintenance {
+				code = protocol.ErrorCodeMaintenance
+			}
+			s.sendOrchestratorError(sessionID, msg.RequestID, code, err)
 			return
 		}
 
-		log.Printf("Agent invoked successfully: run_id=%s", resp.RunID)
-		// Note: run_started and subsequent events will come via ingress RPC fanout.
+		s.startRun(conn, msg.RequestID, resp)
 	}()
 }
 
+// startRun tracks a newly invoked run on the connection that started it and
+// acks it with run_started. Orchestrator events for the run are then marked
+// own_run on this connection until the run's done or error event.
+func (s *Server) startRun(conn *hub.Connection, requestID string, resp *orchestrator.InvokeResponse) {
+	conn.AddRun(resp.RunID)
+
+	ack := protocol.RunStartedMessage{
+		BaseMessage: protocol.BaseMessage{
+			Type:      protocol.TypeRunStarted,
+			Ts:        time.Now().UnixMilli(),
+			RequestID: requestID,
+			SessionID: resp.SessionID,
+			RunID:     resp.RunID,
+		},
+		AgentID:          resp.AgentID,
+		RequestedAgentID: resp.RequestedAgentID,
+		Fallback:         resp.Fallback,
+		OwnRun:           true,
+		Tags:             resp.Tags,
+	}
+	if err := s.hub.SendJSONToConnection(conn, ack); err != nil {
+		s.connLogger(conn).Warn("failed to send run_started", "run_id", resp.RunID, "error", err)
+	}
+
+	if resp.Fallback {
+		s.connLogger(conn).Info("agent invoked", "run_id", resp.RunID, "agent_id", resp.AgentID, "requested_agent_id", resp.RequestedAgentID)
+	} else {
+		s.connLogger(conn).Info("agent invoked", "run_id", resp.RunID, "agent_id", resp.AgentID)
+	}
+}
+
 // handleToolResult handles tool result submissions.
 func (s *Server) handleToolResult(conn *hub.Connection, data []byte) {
 	var msg protocol.ToolResultMessage
@@ -256,6 +561,7 @@ func (s *Server) handleToolResult(conn *hub.Connection, data []byte) {
 		Status: status,
 		Result: msg.Result,
 		Error:  msg.Error,
+		Nonce:  msg.Nonce,
 	}
 
 	go func() {
@@ -264,15 +570,56 @@ func (s *Server) handleToolResult(conn *hub.Connection, data []byte) {
 
 		_, err := s.orchestrator.SubmitToolResult(ctx, msg.ToolCallID, req)
 		if err != nil {
-			log.Printf("Submit tool result failed: %v", err)
-			s.sendErrorToSession(conn.SessionID, msg.RunID, protocol.ErrorCodeOrchestratorFail, err.Error())
+			s.connLogger(conn).Error("submit tool result failed", "tool_call_id", msg.ToolCallID, "error", err)
+			s.sendOrchestratorError(conn.SessionID, msg.RunID, protocol.ErrorCodeOrchestratorFail, err)
 			return
 		}
 
-		log.Printf("Tool result submitted: tool_call_id=%s", msg.ToolCallID)
+		s.connLogger(conn).Info("tool result submitted", "tool_call_id", msg.ToolCallID)
 	}()
 }
 
+// toolProgressTimeout bounds how long a tool_progress forward may hold up the
+// connection's read loop.
+const toolProgressTimeout = 5 * time.Second
+
+// handleToolProgress forwards incremental tool output. Unlike tool_result it
+// is forwarded synchronously, so the chunks of a connection reach the
+// orchestrator in the order they were sent and before any tool_result that
+// follows them.
+func (s *Server) handleToolProgress(conn *hub.Connection, data []byte) {
+	var msg protocol.ToolProgressMessage
+	if err := json.Unmarshal(data, &msg); err != nil {
+		s.sendError(conn, "", protocol.ErrorCodeInvalidMessage, "invalid tool_progress message")
+		return
+	}
+
+	if conn.SessionID == "" {
+		s.sendError(conn, msg.RunID, protocol.ErrorCodeSessionRequired, "must send hello first")
+		return
+	}
+	if msg.ToolCallID == "" || msg.Seq <= 0 {
+		s.sendError(conn, msg.RunID, protocol.ErrorCodeInvalidMessage, "tool_progress requires tool_call_id and a positive seq")
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), toolProgressTimeout)
+	defer cancel()
+
+	resp, err := s.orchestrator.SubmitToolProgress(ctx, msg.ToolCallID, &orchestrator.ToolProgressRequest{
+		Seq:   msg.Seq,
+		Chunk: msg.Chunk,
+	})
+	if err != nil {
+		s.connLogger(conn).Error("submit tool progress failed", "tool_call_id", msg.ToolCallID, "error", err)
+		s.sendOrchestratorError(conn.SessionID, msg.RunID, protocol.ErrorCodeOrchestratorFail, err)
+		return
+	}
+	if !resp.Accepted {
+		s.connLogger(conn).Debug("tool progress dropped", "tool_call_id", msg.ToolCallID, "seq", msg.Seq, "last_accepted", resp.Seq)
+	}
+}
+
 // handleApprovalDecision handles approval decision submissions.
 func (s *Server) handleApprovalDecision(conn *hub.Connection, data []byte) {
 	var msg protocol.ApprovalDecisionMessage
@@ -297,6 +644,8 @@ func (s *Server) handleApprovalDecision(conn *hub.Connection, data []byte) {
 	req := &orchestrator.ApprovalDecisionRequest{
 		Decision: decision,
 		Reason:   msg.Reason,
+		Remember: msg.Remember,
+		Nonce:    msg.Nonce,
 	}
 
 	go func() {
@@ -305,12 +654,12 @@ func (s *Server) handleApprovalDecision(conn *hub.Connection, data []byte) {
 
 		_, err := s.orchestrator.SubmitApprovalDecision(ctx, msg.ApprovalID, req)
 		if err != nil {
-			log.Printf("Submit approval decision failed: %v", err)
-			s.sendErrorToSession(conn.SessionID, msg.RunID, protocol.ErrorCodeOrchestratorFail, err.Error())
+			s.connLogger(conn).Error("submit approval decision failed", "approval_id", msg.ApprovalID, "error", err)
+			s.sendOrchestratorError(conn.SessionID, msg.RunID, protocol.ErrorCodeOrchestratorFail, err)
 			return
 		}
 
-		log.Printf("Approval decision submitted: approval_id=%s, decision=%s", msg.ApprovalID, decision)
+		s.connLogger(conn).Info("approval decision submitted", "approval_id", msg.ApprovalID, "decision", decision)
 	}()
 }
 
@@ -336,17 +685,154 @@ func (s *Server) handleCancelRun(conn *hub.Connection, data []byte) {
 		ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
 		defer cancel()
 
-		_, err := s.orchestrator.CancelRun(ctx, msg.RunID)
+		resp, err := s.orchestrator.CancelRun(ctx, &orchestrator.CancelRunRequest{
+			RunID:     msg.RunID,
+			Reason:    msg.Reason,
+			DecidedBy: msg.DecidedBy,
+		})
+		if err != nil {
+			s.connLogger(conn).Error("cancel run failed", "run_id", msg.RunID, "error", err)
+			s.sendOrchestratorError(conn.SessionID, msg.RunID, protocol.ErrorCodeOrchestratorFail, err)
+			return
+		}
+
+		ack := protocol.CancelAckMessage{
+			BaseMessage: protocol.BaseMessage{
+				Type:      protocol.TypeCancelAck,
+				Ts:        time.Now().UnixMilli(),
+				RequestID: msg.RequestID,
+				SessionID: conn.SessionID,
+				RunID:     resp.RunID,
+			},
+			Status:    resp.Status,
+			Reason:    resp.Reason,
+			DecidedBy: resp.DecidedBy,
+		}
+		// The run is over, so release it from the connection that started it.
+		if event, err := toEvent(ack); err == nil {
+			s.hub.BroadcastRunEvent(conn.SessionID, resp.RunID, event, true)
+		}
+
+		s.connLogger(conn).Info("run cancelled", "run_id", resp.RunID, "status", resp.Status)
+	}()
+}
+
+// handleListRuns answers with the session's runs, so a reconnecting client
+// can find the ones still in flight.
+func (s *Server) handleListRuns(conn *hub.Connection, data []byte) {
+	var msg protocol.ListRunsMessage
+	if err := json.Unmarshal(data, &msg); err != nil {
+		s.sendError(conn, "", protocol.ErrorCodeInvalidMessage, "invalid list_runs message")
+		return
+	}
+
+	if conn.SessionID == "" {
+		s.sendError(conn, "", protocol.ErrorCodeSessionRequired, "must send hello first")
+		return
+	}
+	if msg.Limit < 0 {
+		s.sendError(conn, "", protocol.ErrorCodeInvalidMessage, "limit must not be negative")
+		return
+	}
+
+	sessionID := conn.SessionID
+	go func() {
+		ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+		defer cancel()
+
+		resp, err := s.orchestrator.ListRuns(ctx, &orchestrator.ListRunsRequest{
+			SessionID: sessionID,
+			Active:    msg.Active,
+			Limit:     msg.Limit,
+		})
 		if err != nil {
-			log.Printf("Cancel run failed: %v", err)
-			s.sendErrorToSession(conn.SessionID, msg.RunID, protocol.ErrorCodeOrchestratorFail, err.Error())
+			s.connLogger(conn).Error("list runs failed", "error", err)
+			s.hub.SendJSONToConnection(conn, orchestratorErrorMessage(sessionID, "", protocol.ErrorCodeOrchestratorFail, err))
 			return
 		}
 
-		log.Printf("Run cancelled: run_id=%s", msg.RunID)
+		runs := make([]protocol.RunInfo, 0, len(resp.Runs))
+		for _, run := range resp.Runs {
+			runs = append(runs, protocol.RunInfo{
+				RunID:     run.RunID,
+				Status:    run.Status,
+				StartedAt: run.StartedAt.UnixMilli(),
+				AgentID:   run.AgentID,
+			})
+		}
+		s.hub.SendJSONToConnection(conn, protocol.RunsMessage{
+			BaseMessage: protocol.BaseMessage{
+				Type:      protocol.TypeRuns,
+				Ts:        time.Now().UnixMilli(),
+				RequestID: msg.RequestID,
+				SessionID: sessionID,
+			},
+			Runs: runs,
+		})
+	}()
+}
+
+// handleAck forwards an ack to the orchestrator. Acks are not answered; a
+// failed one is reported as an error.
+func (s *Server) handleAck(conn *hub.Connection, data []byte) {
+	var msg protocol.AckMessage
+	if err := json.Unmarshal(data, &msg); err != nil {
+		s.sendError(conn, "", protocol.ErrorCodeInvalidMessage, "invalid ack message")
+		return
+	}
+
+	if conn.SessionID == "" {
+		s.sendError(conn, msg.RunID, protocol.ErrorCodeSessionRequired, "must send hello first")
+		return
+	}
+	deviceID := msg.DeviceID
+	if deviceID == "" {
+		deviceID = conn.DeviceID
+	}
+	switch {
+	case msg.RunID == "":
+		s.sendError(conn, "", protocol.ErrorCodeInvalidMessage, "run_id is required")
+		return
+	case msg.Seq <= 0 && msg.EventID == "":
+		s.sendError(conn, msg.RunID, protocol.ErrorCodeInvalidMessage, "seq or event_id is required")
+		return
+	case deviceID == "":
+		s.sendError(conn, msg.RunID, protocol.ErrorCodeInvalidMessage, "device_id is required, in the ack or in hello")
+		return
+	}
+
+	sessionID := conn.SessionID
+	go func() {
+		ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+		defer cancel()
+
+		if err := s.orchestrator.AckEvents(ctx, &orchestrator.AckEventsRequest{
+			SessionID: sessionID,
+			DeviceID:  deviceID,
+			RunID:     msg.RunID,
+			Seq:       msg.Seq,
+			EventID:   msg.EventID,
+		}); err != nil {
+			s.connLogger(conn).Warn("ack failed", "run_id", msg.RunID, "error", err)
+			s.hub.SendJSONToConnection(conn, orchestratorErrorMessage(sessionID, msg.RunID, protocol.ErrorCodeOrchestratorFail, err))
+		}
 	}()
 }
 
+// toEvent converts a protocol message into the generic event map used for
+// per-connection run annotation.
+func toEvent(v interface{}) (map[string]interface{}, error) {
+	data, err := json.Marshal(v)
+	if err != nil {
+		return nil, err
+	}
+	var event map[string]interface{}
+	if err := json.Unmarshal(data, &event); err != nil {
+		return nil, err
+	}
+	return event, nil
+}
+
 // sendError sends an error message to a connection.
 func (s *Server) sendError(conn *hub.Connection, runID, code, message string) {
 	errMsg := protocol.ErrorMessage{
@@ -362,17 +848,24 @@ func (s *Server) sendError(conn *hub.Connection, runID, code, message string) {
 	s.hub.SendJSONToConnection(conn, errMsg)
 }
 
-// sendErrorToSession sends an error message to all connections of a session.
-func (s *Server) sendErrorToSession(sessionID, runID, code, message string) {
-	errMsg := protocol.ErrorMessage{
+// sendOrchestratorError reports a failed orchestrator call to the session,
+// telling clients whether and when the request may be resent.
+func (s *Server) sendOrchestratorError(sessionID, runID, code string, err error) {
+	s.hub.BroadcastJSON(sessionID, orchestratorErrorMessage(sessionID, runID, code, err))
+}
+
+func orchestratorErrorMessage(sessionID, runID, code string, err error) protocol.ErrorMessage {
+	retryable, retryAfter := orchestrator.RetryInfo(err)
+	return protocol.ErrorMessage{
 		BaseMessage: protocol.BaseMessage{
 			Type:      protocol.TypeError,
 			Ts:        time.Now().UnixMilli(),
 			RunID:     runID,
 			SessionID: sessionID,
 		},
-		Code:    code,
-		Message: message,
+		Code:         code,
+		Message:      err.Error(),
+		Retryable:    retryable,
+		RetryAfterMs: retryAfter.Milliseconds(),
 	}
-	s.hub.BroadcastJSON(sessionID, errMsg)
 }
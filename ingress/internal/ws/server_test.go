@@ -0,0 +1,763 @@
+package ws
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net"
+	"net/http/httptest"
+	"net/rpc"
+	"net/rpc/jsonrpc"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gorilla/websocket"
+	"github.com/labstack/echo/v4"
+
+	"github.com/xiaot623/gogo/ingress/internal/config"
+	"github.com/xiaot623/gogo/ingress/internal/hub"
+	"github.com/xiaot623/gogo/ingress/internal/orchestrator"
+	"github.com/xiaot623/gogo/ingress/internal/protocol"
+)
+
+func newTestServer(cfg *config.Config) (*Server, *hub.Connection) {
+	h := hub.NewHub()
+	conn := h.NewConnection(nil)
+	conn.SessionID = "s1"
+	return NewServer(cfg, h, orchestrator.NewClient("")), conn
+}
+
+func invokeMessage(content string) []byte {
+	data, _ := json.Marshal(protocol.AgentInvokeMessage{
+		BaseMessage: protocol.BaseMessage{Type: protocol.TypeAgentInvoke},
+		AgentID:     "a1",
+		Message:     protocol.InputMessage{Role: "user", Content: content},
+	})
+	return data
+}
+
+// nextError returns the error sent directly to conn, if any.
+func nextError(conn *hub.Connection) *protocol.ErrorMessage {
+	select {
+	case data := <-conn.Send:
+		var msg protocol.ErrorMessage
+		_ = json.Unmarshal(data, &msg)
+		return &msg
+	default:
+		return nil
+	}
+}
+
+func TestAgentInvokeContentLimit(t *testing.T) {
+	s, conn := newTestServer(&config.Config{MaxInvokeContentBytes: 8})
+
+	s.handleMessage(conn, invokeMessage("short"))
+	if msg := nextError(conn); msg != nil {
+		t.Fatalf("unexpected error for small content: %+v", msg)
+	}
+
+	s.handleMessage(conn, invokeMessage(strings.Repeat("x", 9)))
+	msg := nextError(conn)
+	if msg == nil || msg.Code != protocol.ErrorCodeInvalidMessage {
+		t.Fatalf("expected invalid_message, got %+v", msg)
+	}
+}
+
+func TestHelloClientMetaReachesInvokeContext(t *testing.T) {
+	s, conn := newTestServer(&config.Config{})
+
+	s.handleMessage(conn, []byte(`{"type":"hello","client_meta":{"platform":"ios","user_id":"spoofed"}}`))
+	if msg := nextError(conn); msg == nil || msg.Type != protocol.TypeHelloAck {
+		t.Fatalf("expected hello_ack, got %+v", msg)
+	}
+
+	ctx := clientContext(conn.ClientMeta)
+	if len(ctx) != 2 || ctx["client.platform"] != "ios" || ctx["client.user_id"] != "spoofed" {
+		t.Fatalf("unexpected invoke context: %v", ctx)
+	}
+	if _, ok := ctx["user_id"]; ok {
+		t.Fatalf("client_meta must not set user_id: %v", ctx)
+	}
+}
+
+func TestAgentInvokeRateLimit(t *testing.T) {
+	s, conn := newTestServer(&config.Config{InvokeRatePerMinute: 1, InvokeBurst: 2})
+
+	for i := 0; i < 2; i++ {
+		s.handleMessage(conn, invokeMessage("hi"))
+		if msg := nextError(conn); msg != nil {
+			t.Fatalf("invoke %d unexpectedly rejected: %+v", i, msg)
+		}
+	}
+
+	s.handleMessage(conn, invokeMessage("hi"))
+	msg := nextError(conn)
+	if msg == nil || msg.Code != protocol.ErrorCodeRateLimited {
+		t.Fatalf("expected rate_limited, got %+v", msg)
+	}
+
+	// Naming another session in the message does not reset the budget.
+	other, _ := json.Marshal(protocol.AgentInvokeMessage{
+		BaseMessage: protocol.BaseMessage{Type: protocol.TypeAgentInvoke, SessionID: "spoofed"},
+		AgentID:     "a1",
+		Message:     protocol.InputMessage{Role: "user", Content: "hi"},
+	})
+	s.handleMessage(conn, other)
+	if msg := nextError(conn); msg == nil || msg.Code != protocol.ErrorCodeRateLimited {
+		t.Fatalf("expected rate_limited for a message-level session_id, got %+v", msg)
+	}
+
+	// Control messages are exempt from the invoke limit.
+	cancel, _ := json.Marshal(protocol.CancelRunMessage{BaseMessage: protocol.BaseMessage{Type: protocol.TypeCancelRun, RunID: "r1"}})
+	s.handleMessage(conn, cancel)
+	if msg := nextError(conn); msg != nil {
+		t.Fatalf("cancel_run unexpectedly rejected: %+v", msg)
+	}
+
+	// Other sessions have their own budget.
+	if !s.invokeLimit.Allow("s2") {
+		t.Fatal("expected a fresh session to be allowed")
+	}
+}
+
+func TestEcho(t *testing.T) {
+	s, conn := newTestServer(&config.Config{EchoEnabled: true})
+
+	s.handleMessage(conn, []byte(`{"type":"echo","request_id":"req-1","payload":{"n":1}}`))
+	var reply protocol.EchoReplyMessage
+	select {
+	case data := <-conn.Send:
+		_ = json.Unmarshal(data, &reply)
+	default:
+		t.Fatal("expected echo_reply")
+	}
+	if reply.Type != protocol.TypeEchoReply || reply.SessionID != "s1" || reply.RequestID != "req-1" || reply.Ts == 0 {
+		t.Fatalf("unexpected reply: %+v", reply)
+	}
+	if string(reply.Payload) != `{"n":1}` {
+		t.Fatalf("unexpected payload: %s", reply.Payload)
+	}
+
+	conn.SessionID = ""
+	s.handleMessage(conn, []byte(`{"type":"echo"}`))
+	if msg := nextError(conn); msg == nil || msg.Code != protocol.ErrorCodeSessionRequired {
+		t.Fatalf("expected session_required, got %+v", msg)
+	}
+
+	s, conn = newTestServer(&config.Config{})
+	s.handleMessage(conn, []byte(`{"type":"echo"}`))
+	if msg := nextError(conn); msg == nil || msg.Code != protocol.ErrorCodeInvalidMessage {
+		t.Fatalf("expected invalid_message when disabled, got %+v", msg)
+	}
+}
+
+func TestToolProgressValidation(t *testing.T) {
+	s, conn := newTestServer(&config.Config{})
+
+	s.handleMessage(conn, []byte(`{"type":"tool_progress","tool_call_id":"tc1","chunk":"x"}`))
+	if msg := nextError(conn); msg == nil || msg.Code != protocol.ErrorCodeInvalidMessage {
+		t.Fatalf("expected invalid_message for missing seq, got %+v", msg)
+	}
+
+	conn.SessionID = ""
+	s.handleMessage(conn, []byte(`{"type":"tool_progress","tool_call_id":"tc1","seq":1,"chunk":"x"}`))
+	if msg := nextError(conn); msg == nil || msg.Code != protocol.ErrorCodeSessionRequired {
+		t.Fatalf("expected session_required, got %+v", msg)
+	}
+}
+
+func TestStartRunAcksInvokingConnection(t *testing.T) {
+	s, conn := newTestServer(&config.Config{})
+
+	s.startRun(conn, "req-1", &orchestrator.InvokeResponse{RunID: "r1", SessionID: "s1", AgentID: "a1", Tags: []string{"experiment=x"}})
+
+	var ack protocol.RunStartedMessage
+	select {
+	case data := <-conn.Send:
+		_ = json.Unmarshal(data, &ack)
+	default:
+		t.Fatal("expected run_started ack")
+	}
+	if ack.Type != protocol.TypeRunStarted || ack.RunID != "r1" || ack.RequestID != "req-1" || !ack.OwnRun || len(ack.Tags) != 1 || ack.Tags[0] != "experiment=x" {
+		t.Fatalf("unexpected ack: %+v", ack)
+	}
+	if !conn.OwnsRun("r1") {
+		t.Fatal("expected connection to track the run")
+	}
+}
+
+func TestOrchestratorErrorMessageRetryInfo(t *testing.T) {
+	msg := orchestratorErrorMessage("s1", "req-1", protocol.ErrorCodeOrchestratorFail, errors.New("boom"))
+	if msg.Retryable || msg.RetryAfterMs != 0 {
+		t.Fatalf("unclassified errors must not be retryable: %+v", msg)
+	}
+
+	_, err := orchestrator.NewClient("127.0.0.1:1").Invoke(context.Background(), &orchestrator.InvokeRequest{})
+	msg = orchestratorErrorMessage("s1", "req-1", protocol.ErrorCodeOrchestratorFail, err)
+	if !msg.Retryable || msg.RetryAfterMs <= 0 {
+		t.Fatalf("expected retry guidance for unreachable orchestrator: %+v", msg)
+	}
+}
+
+func TestMessageSizeLimits(t *testing.T) {
+	cfg := &config.Config{
+		EchoEnabled:       true,
+		PingInterval:      time.Minute,
+		WriteTimeout:      time.Second,
+		ReadTimeout:       time.Minute,
+		MaxMessageSize:    256,
+		MessageSizeLimits: map[string]int64{"echo": 64},
+	}
+	h := hub.NewHub()
+	go h.Run()
+	s := NewServer(cfg, h, orchestrator.NewClient(""))
+	e := echo.New()
+	e.GET("/ws", s.HandleWebSocket)
+	srv := httptest.NewServer(e)
+	defer srv.Close()
+
+	ws, _, err := websocket.DefaultDialer.Dial("ws"+strings.TrimPrefix(srv.URL, "http")+"/ws", nil)
+	if err != nil {
+		t.Fatalf("Dial: %v", err)
+	}
+	defer ws.Close()
+	ws.SetReadDeadline(time.Now().Add(5 * time.Second))
+
+	readError := func() protocol.ErrorMessage {
+		t.Helper()
+		var msg protocol.ErrorMessage
+		if err := ws.ReadJSON(&msg); err != nil {
+			t.Fatalf("ReadJSON: %v", err)
+		}
+		return msg
+	}
+
+	// Over the echo limit but under the connection limit: rejected, and the
+	// connection stays usable.
+	big := `{"type":"echo","payload":"` + strings.Repeat("x", 100) + `"}`
+	if err := ws.WriteMessage(websocket.TextMessage, []byte(big)); err != nil {
+		t.Fatalf("WriteMessage: %v", err)
+	}
+	if msg := readError(); msg.Code != protocol.ErrorCodeMessageTooLarge || msg.LimitBytes != 64 {
+		t.Fatalf("expected message_too_large with limit 64, got %+v", msg)
+	}
+
+	// Over every limit: explained, then closed with 1009.
+	huge := `{"type":"tool_result","payload":"` + strings.Repeat("x", 1024) + `"}`
+	if err := ws.WriteMessage(websocket.TextMessage, []byte(huge)); err != nil {
+		t.Fatalf("WriteMessage: %v", err)
+	}
+	if msg := readError(); msg.Code != protocol.ErrorCodeMessageTooLarge || msg.LimitBytes != 256 {
+		t.Fatalf("expected message_too_large with limit 256, got %+v", msg)
+	}
+	if _, _, err := ws.ReadMessage(); !websocket.IsCloseError(err, websocket.CloseMessageTooBig) {
+		t.Fatalf("expected close 1009, got %v", err)
+	}
+}
+
+func TestSubprotocolNegotiation(t *testing.T) {
+	cfg := &config.Config{
+		PingInterval: time.Minute,
+		WriteTimeout: time.Second,
+		ReadTimeout:  time.Minute,
+	}
+	h := hub.NewHub()
+	go h.Run()
+	s := NewServer(cfg, h, orchestrator.NewClient(""))
+	e := echo.New()
+	e.GET("/ws", s.HandleWebSocket)
+	srv := httptest.NewServer(e)
+	defer srv.Close()
+	url := "ws" + strings.TrimPrefix(srv.URL, "http") + "/ws"
+
+	helloAck := func(subprotocols []string) (string, protocol.HelloAckMessage) {
+		t.Helper()
+		dialer := websocket.Dialer{Subprotocols: subprotocols}
+		ws, _, err := dialer.Dial(url, nil)
+		if err != nil {
+			t.Fatalf("Dial %v: %v", subprotocols, err)
+		}
+		defer ws.Close()
+		ws.SetReadDeadline(time.Now().Add(5 * time.Second))
+		if err := ws.WriteMessage(websocket.TextMessage, []byte(`{"type":"hello"}`)); err != nil {
+			t.Fatalf("WriteMessage: %v", err)
+		}
+		var ack protocol.HelloAckMessage
+		if err := ws.ReadJSON(&ack); err != nil {
+			t.Fatalf("ReadJSON: %v", err)
+		}
+		return ws.Subprotocol(), ack
+	}
+
+	// Negotiated: the handshake and hello_ack both name the version.
+	negotiated, ack := helloAck([]string{"gogo.v9", protocol.SubprotocolV1})
+	if negotiated != protocol.SubprotocolV1 || ack.Type != protocol.TypeHelloAck || ack.Protocol != protocol.SubprotocolV1 {
+		t.Fatalf("expected gogo.v1, got handshake %q ack %+v", negotiated, ack)
+	}
+
+	// Not offered: pre-versioning clients get v1 without a handshake header.
+	negotiated, ack = helloAck(nil)
+	if negotiated != "" || ack.Protocol != protocol.SubprotocolV1 {
+		t.Fatalf("expected default gogo.v1, got handshake %q ack %+v", negotiated, ack)
+	}
+
+	// Only unsupported versions offered: rejected before the upgrade.
+	dialer := websocket.Dialer{Subprotocols: []string{"gogo.v9"}}
+	if _, resp, err := dialer.Dial(url, nil); err == nil || resp == nil || resp.StatusCode != 400 {
+		t.Fatalf("expected 400 for unsupported version, got resp %v err %v", resp, err)
+	}
+}
+
+func TestCloseCodes(t *testing.T) {
+	cfg := &config.Config{
+		APIKey:       "secret",
+		PingInterval: time.Minute,
+		WriteTimeout: time.Second,
+		ReadTimeout:  time.Minute,
+	}
+	h := hub.NewHub()
+	go h.Run()
+	s := NewServer(cfg, h, orchestrator.NewClient(""))
+	e := echo.New()
+	e.GET("/ws", s.HandleWebSocket)
+	srv := httptest.NewServer(e)
+	defer srv.Close()
+	url := "ws" + strings.TrimPrefix(srv.URL, "http") + "/ws"
+
+	dial := func(hello string) *websocket.Conn {
+		t.Helper()
+		ws, _, err := websocket.DefaultDialer.Dial(url, nil)
+		if err != nil {
+			t.Fatalf("Dial: %v", err)
+		}
+		ws.SetReadDeadline(time.Now().Add(5 * time.Second))
+		if err := ws.WriteMessage(websocket.TextMessage, []byte(hello)); err != nil {
+			t.Fatalf("WriteMessage: %v", err)
+		}
+		return ws
+	}
+
+	// A rejected api_key is explained, then closed with 4001.
+	bad := dial(`{"type":"hello","api_key":"wrong"}`)
+	defer bad.Close()
+	var errMsg protocol.ErrorMessage
+	if err := bad.ReadJSON(&errMsg); err != nil || errMsg.Code != protocol.ErrorCodeUnauthorized {
+		t.Fatalf("expected unauthorized error, got %+v (%v)", errMsg, err)
+	}
+	if _, _, err := bad.ReadMessage(); !websocket.IsCloseError(err, protocol.CloseCodeUnauthorized) {
+		t.Fatalf("expected close %d, got %v", protocol.CloseCodeUnauthorized, err)
+	}
+
+	// Drain closes the remaining connections with 4002.
+	good := dial(`{"type":"hello","api_key":"secret"}`)
+	defer good.Close()
+	var ack protocol.HelloAckMessage
+	if err := good.ReadJSON(&ack); err != nil || ack.Type != protocol.TypeHelloAck {
+		t.Fatalf("expected hello_ack, got %+v (%v)", ack, err)
+	}
+	var bound protocol.SessionBoundMessage
+	if err := good.ReadJSON(&bound); err != nil || bound.Type != protocol.TypeSessionBound {
+		t.Fatalf("expected session_bound, got %+v (%v)", bound, err)
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	if err := s.Drain(ctx); err != nil {
+		t.Fatalf("Drain: %v", err)
+	}
+	if _, _, err := good.ReadMessage(); !websocket.IsCloseError(err, protocol.CloseCodeServerShutdown) {
+		t.Fatalf("expected close %d, got %v", protocol.CloseCodeServerShutdown, err)
+	}
+}
+
+func TestSessionBindPolicy(t *testing.T) {
+	for _, policy := range []string{config.SessionBindMulti, config.SessionBindSingleActive} {
+		t.Run(policy, func(t *testing.T) {
+			cfg := &config.Config{
+				SessionBindPolicy: policy,
+				PingInterval:      time.Minute,
+				WriteTimeout:      time.Second,
+				ReadTimeout:       time.Minute,
+			}
+			h := hub.NewHub()
+			go h.Run()
+			s := NewServer(cfg, h, orchestrator.NewClient(""))
+			e := echo.New()
+			e.GET("/ws", s.HandleWebSocket)
+			srv := httptest.NewServer(e)
+			defer srv.Close()
+			url := "ws" + strings.TrimPrefix(srv.URL, "http") + "/ws"
+
+			hello := func() (*websocket.Conn, protocol.SessionBoundMessage) {
+				t.Helper()
+				ws, _, err := websocket.DefaultDialer.Dial(url, nil)
+				if err != nil {
+					t.Fatalf("Dial: %v", err)
+				}
+				ws.SetReadDeadline(time.Now().Add(5 * time.Second))
+				if err := ws.WriteMessage(websocket.TextMessage, []byte(`{"type":"hello","session_id":"s1"}`)); err != nil {
+					t.Fatalf("WriteMessage: %v", err)
+				}
+				var ack protocol.HelloAckMessage
+				if err := ws.ReadJSON(&ack); err != nil || ack.Type != protocol.TypeHelloAck {
+					t.Fatalf("expected hello_ack, got %+v (%v)", ack, err)
+				}
+				var bound protocol.SessionBoundMessage
+				if err := ws.ReadJSON(&bound); err != nil || bound.Type != protocol.TypeSessionBound {
+					t.Fatalf("expected session_bound, got %+v (%v)", bound, err)
+				}
+				return ws, bound
+			}
+
+			first, bound := hello()
+			defer first.Close()
+			if bound.Connections != 1 {
+				t.Fatalf("expected 1 connection, got %d", bound.Connections)
+			}
+			second, bound := hello()
+			defer second.Close()
+
+			if policy == config.SessionBindMulti {
+				if bound.Connections != 2 {
+					t.Fatalf("expected 2 connections, got %d", bound.Connections)
+				}
+				return
+			}
+			if bound.Connections != 1 {
+				t.Fatalf("expected 1 connection, got %d", bound.Connections)
+			}
+			if _, _, err := first.ReadMessage(); !websocket.IsCloseError(err, protocol.CloseCodeSessionTakenOver) {
+				t.Fatalf("expected close %d, got %v", protocol.CloseCodeSessionTakenOver, err)
+			}
+		})
+	}
+}
+
+func TestMaxSessionConnections(t *testing.T) {
+	cfg := &config.Config{
+		SessionBindPolicy: config.SessionBindMulti,
+		PingInterval:      time.Minute,
+		WriteTimeout:      time.Second,
+		ReadTimeout:       time.Minute,
+	}
+	h := hub.NewHub(hub.WithMaxSessionConnections(1))
+	go h.Run()
+	s := NewServer(cfg, h, orchestrator.NewClient(""))
+	e := echo.New()
+	e.GET("/ws", s.HandleWebSocket)
+	srv := httptest.NewServer(e)
+	defer srv.Close()
+	url := "ws" + strings.TrimPrefix(srv.URL, "http") + "/ws"
+
+	hello := func() *websocket.Conn {
+		t.Helper()
+		ws, _, err := websocket.DefaultDialer.Dial(url, nil)
+		if err != nil {
+			t.Fatalf("Dial: %v", err)
+		}
+		ws.SetReadDeadline(time.Now().Add(5 * time.Second))
+		if err := ws.WriteMessage(websocket.TextMessage, []byte(`{"type":"hello","session_id":"s1"}`)); err != nil {
+			t.Fatalf("WriteMessage: %v", err)
+		}
+		return ws
+	}
+
+	first := hello()
+	defer first.Close()
+	var ack protocol.HelloAckMessage
+	if err := first.ReadJSON(&ack); err != nil || ack.Type != protocol.TypeHelloAck {
+		t.Fatalf("expected hello_ack, got %+v (%v)", ack, err)
+	}
+
+	// The session is full: the second hello is refused and closed.
+	second := hello()
+	defer second.Close()
+	var msg protocol.ErrorMessage
+	if err := second.ReadJSON(&msg); err != nil || msg.Code != protocol.ErrorCodeSessionFull {
+		t.Fatalf("expected session_full error, got %+v (%v)", msg, err)
+	}
+	if _, _, err := second.ReadMessage(); !websocket.IsCloseError(err, protocol.CloseCodeSessionFull) {
+		t.Fatalf("expected close %d, got %v", protocol.CloseCodeSessionFull, err)
+	}
+	if stats := h.Stats(); stats.BindsRejected != 1 {
+		t.Fatalf("expected 1 rejected bind, got %+v", stats)
+	}
+}
+
+func TestSendLimiter(t *testing.T) {
+	if newSendLimiter(0, 100) != nil {
+		t.Fatal("expected a zero rate to disable the limiter")
+	}
+	l := newSendLimiter(1000, 100)
+	start := time.Now()
+	l.wait(100)
+	if elapsed := time.Since(start); elapsed > 50*time.Millisecond {
+		t.Fatalf("first burst waited %v", elapsed)
+	}
+	// The bucket is empty; a message larger than the burst waits for a full
+	// one (100 bytes at 1000 B/s).
+	l.wait(1 << 20)
+	if elapsed := time.Since(start); elapsed < 80*time.Millisecond {
+		t.Fatalf("expected the second write to be throttled, waited %v", elapsed)
+	}
+}
+
+// fakeOrchestrator answers the Orchestrator.ListRuns, AckEvents and
+// CancelRun RPCs.
+type fakeOrchestrator struct {
+	requests chan orchestrator.ListRunsRequest
+	acks     chan orchestrator.AckEventsRequest
+	// cancels holds the CancelRun reply per run ID; other runs are not found.
+	cancels map[string]orchestrator.CancelRunResponse
+}
+
+func (f *fakeOrchestrator) ListRuns(req *orchestrator.ListRunsRequest, resp *orchestrator.ListRunsResponse) error {
+	f.requests <- *req
+	resp.Runs = []orchestrator.RunSummary{{RunID: "r2", AgentID: "a1", Status: "RUNNING", StartedAt: time.UnixMilli(1704067200000)}}
+	return nil
+}
+
+func (f *fakeOrchestrator) AckEvents(req *orchestrator.AckEventsRequest, resp *orchestrator.AckResponse) error {
+	f.acks <- *req
+	resp.OK = true
+	return nil
+}
+
+func (f *fakeOrchestrator) CancelRun(req *orchestrator.CancelRunRequest, resp *orchestrator.CancelRunResponse) error {
+	reply, ok := f.cancels[req.RunID]
+	if !ok {
+		return errors.New("run not found")
+	}
+	*resp = reply
+	return nil
+}
+
+// startFakeOrchestrator serves fake over JSON-RPC and returns its address.
+func startFakeOrchestrator(t *testing.T, fake *fakeOrchestrator) string {
+	t.Helper()
+	server := rpc.NewServer()
+	if err := server.RegisterName("Orchestrator", fake); err != nil {
+		t.Fatalf("RegisterName: %v", err)
+	}
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("Listen: %v", err)
+	}
+	t.Cleanup(func() { ln.Close() })
+	go func() {
+		for {
+			c, err := ln.Accept()
+			if err != nil {
+				return
+			}
+			go server.ServeCodec(jsonrpc.NewServerCodec(c))
+		}
+	}()
+	return ln.Addr().String()
+}
+
+func TestListRuns(t *testing.T) {
+	fake := &fakeOrchestrator{requests: make(chan orchestrator.ListRunsRequest, 1)}
+	addr := startFakeOrchestrator(t, fake)
+
+	h := hub.NewHub()
+	conn := h.NewConnection(nil)
+	s := NewServer(&config.Config{}, h, orchestrator.NewClient(addr))
+
+	s.handleMessage(conn, []byte(`{"type":"list_runs"}`))
+	if msg := nextError(conn); msg == nil || msg.Code != protocol.ErrorCodeSessionRequired {
+		t.Fatalf("expected session_required, got %+v", msg)
+	}
+
+	conn.SessionID = "s1"
+	s.handleMessage(conn, []byte(`{"type":"list_runs","request_id":"req-1","active":true,"limit":5}`))
+	var reply protocol.RunsMessage
+	select {
+	case data := <-conn.Send:
+		_ = json.Unmarshal(data, &reply)
+	case <-time.After(5 * time.Second):
+		t.Fatal("expected runs reply")
+	}
+	if req := <-fake.requests; req.SessionID != "s1" || !req.Active || req.Limit != 5 {
+		t.Fatalf("unexpected ListRuns request: %+v", req)
+	}
+	if reply.Type != protocol.TypeRuns || reply.RequestID != "req-1" || len(reply.Runs) != 1 {
+		t.Fatalf("unexpected reply: %+v", reply)
+	}
+	if run := reply.Runs[0]; run.RunID != "r2" || run.Status != "RUNNING" || run.AgentID != "a1" || run.StartedAt != 1704067200000 {
+		t.Fatalf("unexpected run: %+v", run)
+	}
+}
+
+func TestAckForwardsDevicePosition(t *testing.T) {
+	fake := &fakeOrchestrator{acks: make(chan orchestrator.AckEventsRequest, 1)}
+	addr := startFakeOrchestrator(t, fake)
+
+	h := hub.NewHub()
+	conn := h.NewConnection(nil)
+	conn.SessionID = "s1"
+	s := NewServer(&config.Config{}, h, orchestrator.NewClient(addr))
+
+	for _, body := range []string{
+		`{"type":"ack","seq":3}`,
+		`{"type":"ack","run_id":"r1"}`,
+		`{"type":"ack","run_id":"r1","seq":3}`, // no device_id yet
+	} {
+		s.handleMessage(conn, []byte(body))
+		if msg := nextError(conn); msg == nil || msg.Code != protocol.ErrorCodeInvalidMessage {
+			t.Fatalf("expected invalid_message for %s, got %+v", body, msg)
+		}
+	}
+
+	// The device_id of hello applies to later acks.
+	conn.DeviceID = "phone"
+	s.handleMessage(conn, []byte(`{"type":"ack","run_id":"r1","event_id":"evt_1"}`))
+	select {
+	case req := <-fake.acks:
+		if req != (orchestrator.AckEventsRequest{SessionID: "s1", DeviceID: "phone", RunID: "r1", EventID: "evt_1"}) {
+			t.Fatalf("unexpected AckEvents request: %+v", req)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("ack was not forwarded")
+	}
+}
+
+func TestCancelRunAcksFinalStatus(t *testing.T) {
+	fake := &fakeOrchestrator{cancels: map[string]orchestrator.CancelRunResponse{
+		"r1": {RunID: "r1", Status: "CANCELLED", Reason: "user_stop", DecidedBy: "u1"},
+		// The run had already finished, so it keeps its own status.
+		"r2": {RunID: "r2", Status: "DONE"},
+	}}
+	addr := startFakeOrchestrator(t, fake)
+
+	h := hub.NewHub()
+	go h.Run()
+	conn := h.NewConnection(nil)
+	conn.SessionID = "s1"
+	h.Register(conn)
+	s := NewServer(&config.Config{}, h, orchestrator.NewClient(addr))
+
+	tests := []struct {
+		runID string
+		want  protocol.CancelAckMessage
+	}{
+		{"r1", protocol.CancelAckMessage{Status: "CANCELLED", Reason: "user_stop", DecidedBy: "u1"}},
+		{"r2", protocol.CancelAckMessage{Status: "DONE"}},
+	}
+	for _, tt := range tests {
+		s.handleMessage(conn, []byte(`{"type":"cancel_run","request_id":"req-`+tt.runID+`","run_id":"`+tt.runID+`","reason":"user_stop"}`))
+		var ack protocol.CancelAckMessage
+		select {
+		case data := <-conn.Send:
+			_ = json.Unmarshal(data, &ack)
+		case <-time.After(5 * time.Second):
+			t.Fatalf("expected cancel_ack for %s", tt.runID)
+		}
+		if ack.Type != protocol.TypeCancelAck || ack.RequestID != "req-"+tt.runID || ack.RunID != tt.runID || ack.SessionID != "s1" {
+			t.Fatalf("unexpected cancel_ack: %+v", ack)
+		}
+		if ack.Status != tt.want.Status || ack.Reason != tt.want.Reason || ack.DecidedBy != tt.want.DecidedBy {
+			t.Fatalf("expected %+v for %s, got %+v", tt.want, tt.runID, ack)
+		}
+	}
+}
+
+func TestCancelRunFailureSendsOrchestratorError(t *testing.T) {
+	addr := startFakeOrchestrator(t, &fakeOrchestrator{})
+
+	h := hub.NewHub()
+	go h.Run()
+	conn := h.NewConnection(nil)
+	conn.SessionID = "s1"
+	h.Register(conn)
+	s := NewServer(&config.Config{}, h, orchestrator.NewClient(addr))
+
+	s.handleMessage(conn, []byte(`{"type":"cancel_run","run_id":"r_missing"}`))
+	var msg protocol.ErrorMessage
+	select {
+	case data := <-conn.Send:
+		_ = json.Unmarshal(data, &msg)
+	case <-time.After(5 * time.Second):
+		t.Fatal("expected an error")
+	}
+	if msg.Type != protocol.TypeError || msg.Code != protocol.ErrorCodeOrchestratorFail || msg.RunID != "r_missing" || !strings.Contains(msg.Message, "run not found") {
+		t.Fatalf("unexpected error: %+v", msg)
+	}
+}
+
+func TestReconnectToken(t *testing.T) {
+	cfg := &config.Config{APIKey: "secret", ReconnectTokenSecret: "hmac-key", ReconnectTokenTTL: time.Minute}
+	s, _ := newTestServer(cfg)
+
+	// hello sends body on a fresh connection, as a refused hello closes it.
+	hello := func(body string) protocol.HelloAckMessage {
+		t.Helper()
+		conn := s.hub.NewConnection(nil)
+		s.handleMessage(conn, []byte(body))
+		var ack protocol.HelloAckMessage
+		select {
+		case data := <-conn.Send:
+			_ = json.Unmarshal(data, &ack)
+		default:
+		}
+		return ack
+	}
+
+	ack := hello(`{"type":"hello","session_id":"s1","user_id":"u1","api_key":"secret"}`)
+	if ack.Type != protocol.TypeHelloAck || ack.ReconnectToken == "" || ack.ReconnectTokenExpiresAt <= time.Now().UnixMilli() {
+		t.Fatalf("expected hello_ack with a reconnect token, got %+v", ack)
+	}
+	token := ack.ReconnectToken
+
+	// The token replaces the api_key for the same session and user.
+	if ack := hello(`{"type":"hello","session_id":"s1","user_id":"u1","reconnect_token":"` + token + `"}`); ack.Type != protocol.TypeHelloAck {
+		t.Fatalf("expected hello_ack for reconnect, got %+v", ack)
+	}
+
+	// Another session or user, or a forged token, is refused...
+	for _, body := range []string{
+		`{"type":"hello","session_id":"s2","user_id":"u1","reconnect_token":"` + token + `"}`,
+		`{"type":"hello","session_id":"s1","user_id":"u2","reconnect_token":"` + token + `"}`,
+		`{"type":"hello","session_id":"s1","user_id":"u1","reconnect_token":"` + token + `x"}`,
+	} {
+		if ack := hello(body); ack.Type != protocol.TypeError {
+			t.Fatalf("expected %s to be refused, got %+v", body, ack)
+		}
+	}
+
+	// ...unless the hello falls back to a valid api_key.
+	if ack := hello(`{"type":"hello","session_id":"s2","user_id":"u1","api_key":"secret","reconnect_token":"` + token + `"}`); ack.Type != protocol.TypeHelloAck {
+		t.Fatalf("expected hello_ack with api_key fallback, got %+v", ack)
+	}
+}
+
+func TestReconnectTokenExpiry(t *testing.T) {
+	now := time.UnixMilli(1704067200000)
+	tokens := newReconnectTokens("hmac-key", time.Minute)
+	tokens.now = func() time.Time { return now }
+
+	token, expiresAt := tokens.issue("s1", "u1")
+	if expiresAt != now.Add(time.Minute).UnixMilli() {
+		t.Fatalf("unexpected expiry %d", expiresAt)
+	}
+	if err := tokens.verify(token, "s1", "u1"); err != nil {
+		t.Fatalf("verify: %v", err)
+	}
+
+	now = now.Add(time.Minute)
+	if err := tokens.verify(token, "s1", "u1"); !errors.Is(err, errTokenExpired) {
+		t.Fatalf("expected expired token, got %v", err)
+	}
+
+	other := newReconnectTokens("other-key", time.Minute)
+	other.now = tokens.now
+	forged, _ := other.issue("s1", "u1")
+	now = now.Add(-time.Minute)
+	if err := tokens.verify(forged, "s1", "u1"); !errors.Is(err, errTokenSignature) {
+		t.Fatalf("expected signature error, got %v", err)
+	}
+
+	if newReconnectTokens("", time.Minute) != nil {
+		t.Fatal("expected tokens to be disabled without a secret")
+	}
+}
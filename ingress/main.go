@@ -3,7 +3,7 @@ package main
 import (
 	"context"
 	"fmt"
-	"log"
+	"log/slog"
 	"net/http"
 	"os"
 	"os/signal"
@@ -12,9 +12,13 @@ import (
 
 	"github.com/labstack/echo/v4"
 	"github.com/labstack/echo/v4/middleware"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
 
 	"github.com/xiaot623/gogo/ingress/internal/config"
 	"github.com/xiaot623/gogo/ingress/internal/hub"
+	"github.com/xiaot623/gogo/ingress/internal/logging"
+	"github.com/xiaot623/gogo/ingress/internal/metrics"
 	"github.com/xiaot623/gogo/ingress/internal/orchestrator"
 	internalrpc "github.com/xiaot623/gogo/ingress/internal/transport/rpc"
 	"github.com/xiaot623/gogo/ingress/internal/ws"
@@ -24,13 +28,22 @@ func main() {
 	// Load configuration
 	cfg := config.Load()
 
-	log.Printf("Starting ingress service...")
-	log.Printf("WebSocket Port: %d", cfg.WSPort)
-	log.Printf("RPC Port: %d", cfg.RPCPort)
-	log.Printf("Orchestrator RPC Address: %s", cfg.OrchestratorRPCAddr)
+	// Structured logging; the standard log package is routed through it too
+	logger := logging.New(os.Stderr, cfg.LogLevel, cfg.LogFormat)
+	slog.SetDefault(logger)
+	fatal := func(msg string, err error) {
+		logger.Error(msg, "error", err)
+		os.Exit(1)
+	}
+
+	logger.Info("starting ingress",
+		"ws_port", cfg.WSPort,
+		"rpc_port", cfg.RPCPort,
+		"orchestrator_rpc_addr", cfg.OrchestratorRPCAddr,
+		"ingress_id", cfg.IngressID)
 
 	// Initialize hub
-	connectionHub := hub.NewHub()
+	connectionHub := hub.NewHub(hub.WithLogger(logger), hub.WithMaxSessionConnections(cfg.MaxSessionConnections))
 	go connectionHub.Run()
 
 	// Initialize orchestrator client
@@ -38,6 +51,7 @@ func main() {
 
 	// Initialize WebSocket server
 	wsServer := ws.NewServer(cfg, connectionHub, orchClient)
+	connectionHub.OnSessionEmpty(wsServer.ReportSessionDisconnected)
 
 	// Create WebSocket Echo server
 	wsEcho := echo.New()
@@ -54,17 +68,32 @@ func main() {
 		})
 	})
 
+	// Expose hub metrics for Prometheus
+	registry := prometheus.NewRegistry()
+	registry.MustRegister(metrics.NewHubCollector(connectionHub))
+	wsEcho.GET("/metrics", echo.WrapHandler(promhttp.HandlerFor(registry, promhttp.HandlerOpts{})))
+
 	// Initialize internal RPC server
 	rpcServer, err := internalrpc.NewServer(connectionHub)
 	if err != nil {
-		log.Fatalf("Failed to initialize RPC server: %v", err)
+		fatal("failed to initialize RPC server", err)
+	}
+
+	// Receive events for the sessions bound here over one stream to the
+	// orchestrator; Ingress.PushEvent still serves sessions it does not cover
+	streamCtx, stopStream := context.WithCancel(context.Background())
+	defer stopStream()
+	if cfg.EventStreamEnabled {
+		eventStream := orchestrator.NewEventStream(cfg.OrchestratorRPCAddr, cfg.IngressID, connectionHub.SessionIDs, internalrpc.NewHandler(connectionHub).PushEvent)
+		connectionHub.OnSessionsChanged(eventStream.SessionsChanged)
+		go eventStream.Run(streamCtx)
 	}
 
 	// Start WebSocket server
 	go func() {
 		addr := fmt.Sprintf(":%d", cfg.WSPort)
 		if err := wsEcho.Start(addr); err != nil && err != http.ErrServerClosed {
-			log.Fatalf("Failed to start WebSocket server: %v", err)
+			fatal("failed to start WebSocket server", err)
 		}
 	}()
 
@@ -72,31 +101,35 @@ func main() {
 	go func() {
 		addr := fmt.Sprintf(":%d", cfg.RPCPort)
 		if err := rpcServer.Start(addr); err != nil {
-			log.Fatalf("Failed to start RPC server: %v", err)
+			fatal("failed to start RPC server", err)
 		}
 	}()
 
-	log.Printf("WebSocket server started on port %d", cfg.WSPort)
-	log.Printf("Internal RPC server started on port %d", cfg.RPCPort)
+	logger.Info("ingress started", "ws_port", cfg.WSPort, "rpc_port", cfg.RPCPort)
 
 	// Wait for interrupt signal
 	quit := make(chan os.Signal, 1)
 	signal.Notify(quit, syscall.SIGINT, syscall.SIGTERM)
 	<-quit
 
-	log.Println("Shutting down ingress...")
+	logger.Info("shutting down ingress")
+	stopStream()
 
 	// Graceful shutdown
 	shutdownCtx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
 	defer cancel()
 
-	// Shutdown both servers
+	// Close client connections with a shutdown close code, then shutdown
+	// both servers
+	if err := wsServer.Drain(shutdownCtx); err != nil {
+		logger.Error("failed to drain WebSocket connections", "error", err)
+	}
 	if err := wsEcho.Shutdown(shutdownCtx); err != nil {
-		log.Printf("Failed to shutdown WebSocket server gracefully: %v", err)
+		logger.Error("failed to shut down WebSocket server gracefully", "error", err)
 	}
 	if err := rpcServer.Shutdown(shutdownCtx); err != nil {
-		log.Printf("Failed to shutdown RPC server gracefully: %v", err)
+		logger.Error("failed to shut down RPC server gracefully", "error", err)
 	}
 
-	log.Println("Ingress stopped")
+	logger.Info("ingress stopped")
 }
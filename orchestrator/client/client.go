@@ -0,0 +1,384 @@
+// Package client provides a typed Go client for the orchestrator public HTTP API.
+package client
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Client is an HTTP client for the orchestrator /v1 API.
+type Client struct {
+	baseURL    string
+	httpClient *http.Client
+	apiKey     string
+}
+
+// Option configures a Client.
+type Option func(*Client)
+
+// WithHTTPClient overrides the underlying HTTP client.
+func WithHTTPClient(httpClient *http.Client) Option {
+	return func(c *Client) {
+		if httpClient != nil {
+			c.httpClient = httpClient
+		}
+	}
+}
+
+// WithAPIKey sends key as a bearer token, for orchestrators with API_KEYS set.
+func WithAPIKey(key string) Option {
+	return func(c *Client) {
+		c.apiKey = key
+	}
+}
+
+// NewClient creates a new orchestrator API client.
+func NewClient(baseURL string, opts ...Option) *Client {
+	c := &Client{
+		baseURL: strings.TrimSuffix(baseURL, "/"),
+		httpClient: &http.Client{
+			Timeout: 2 * time.Minute, // Long enough for WaitToolCall
+		},
+	}
+	for _, opt := range opts {
+		opt(c)
+	}
+	return c
+}
+
+// APIError is returned when the orchestrator responds with a non-2xx status.
+// Code is the machine-readable error code when the response carries one
+// (e.g. "unauthorized").
+type APIError struct {
+	StatusCode int
+	Code       string
+	Message    string
+}
+
+func (e *APIError) Error() string {
+	return fmt.Sprintf("orchestrator returned status %d: %s", e.StatusCode, e.Message)
+}
+
+// EventsQuery filters a GetRunEvents call.
+type EventsQuery struct {
+	AfterTs int64
+	Cursor  string
+	// DeviceID resumes after the last event the device acknowledged when
+	// neither AfterTs nor Cursor is set.
+	DeviceID string
+	Types    []string
+	Limit    int
+}
+
+// EventsPage is a single page of run events.
+type EventsPage struct {
+	Events     []Event `json:"events"`
+	HasMore    bool    `json:"has_more"`
+	NextCursor string  `json:"next_cursor,omitempty"`
+}
+
+// RunsQuery filters a ListRuns call.
+type RunsQuery struct {
+	Status        RunStatus
+	AgentID       string
+	SessionID     string
+	Tag           string
+	StartedAfter  time.Time
+	StartedBefore time.Time
+	Cursor        string
+	Limit         int
+}
+
+// RunsPage is a single page of run summaries.
+type RunsPage struct {
+	Runs       []RunSummary `json:"runs"`
+	HasMore    bool         `json:"has_more"`
+	NextCursor string       `json:"next_cursor,omitempty"`
+}
+
+// MessagesPage is a single page of session messages.
+type MessagesPage struct {
+	Messages []Message `json:"messages"`
+	HasMore  bool      `json:"has_more"`
+}
+
+// InvokeTool invokes a tool within a run.
+func (c *Client) InvokeTool(ctx context.Context, toolName string, req ToolInvokeRequest) (*ToolInvokeResponse, error) {
+	var resp ToolInvokeResponse
+	path := "/v1/tools/" + url.PathEscape(toolName) + "/invoke"
+	if err := c.do(ctx, http.MethodPost, path, nil, req, &resp); err != nil {
+		return nil, err
+	}
+	return &resp, nil
+}
+
+// GetToolCall retrieves the current state of a tool call.
+func (c *Client) GetToolCall(ctx context.Context, toolCallID string) (*ToolCallResponse, error) {
+	var resp ToolCallResponse
+	if err := c.do(ctx, http.MethodGet, "/v1/tool_calls/"+url.PathEscape(toolCallID), nil, nil, &resp); err != nil {
+		return nil, err
+	}
+	return &resp, nil
+}
+
+// WaitToolCall blocks until the tool call completes or timeoutMs elapses.
+func (c *Client) WaitToolCall(ctx context.Context, toolCallID string, timeoutMs int) (*ToolCallResponse, error) {
+	query := url.Values{}
+	if timeoutMs > 0 {
+		query.Set("timeout_ms", strconv.Itoa(timeoutMs))
+	}
+	var resp ToolCallResponse
+	if err := c.do(ctx, http.MethodPost, "/v1/tool_calls/"+url.PathEscape(toolCallID)+"/wait", query, nil, &resp); err != nil {
+		return nil, err
+	}
+	return &resp, nil
+}
+
+// SubmitToolResult submits the result of a client tool call.
+func (c *Client) SubmitToolResult(ctx context.Context, toolCallID string, req ToolCallResultRequest) (*ToolCallResultResponse, error) {
+	var resp ToolCallResultResponse
+	if err := c.do(ctx, http.MethodPost, "/v1/tool_calls/"+url.PathEscape(toolCallID)+"/submit", nil, req, &resp); err != nil {
+		return nil, err
+	}
+	return &resp, nil
+}
+
+// SubmitToolProgress submits a chunk of incremental output from a running
+// client tool call.
+func (c *Client) SubmitToolProgress(ctx context.Context, toolCallID string, req ToolProgressRequest) (*ToolProgressResponse, error) {
+	var resp ToolProgressResponse
+	if err := c.do(ctx, http.MethodPost, "/v1/tool_calls/"+url.PathEscape(toolCallID)+"/progress", nil, req, &resp); err != nil {
+		return nil, err
+	}
+	return &resp, nil
+}
+
+// DecideApproval submits an approve/reject decision for a pending approval.
+func (c *Client) DecideApproval(ctx context.Context, approvalID string, req ApprovalDecisionRequest) error {
+	return c.do(ctx, http.MethodPost, "/v1/approvals/"+url.PathEscape(approvalID)+"/decide", nil, req, nil)
+}
+
+// EvaluatePolicy returns the policy decision for a tool call without invoking it.
+func (c *Client) EvaluatePolicy(ctx context.Context, req PolicyEvaluateRequest) (*PolicyEvaluateResponse, error) {
+	var resp PolicyEvaluateResponse
+	if err := c.do(ctx, http.MethodPost, "/v1/policy/evaluate", nil, req, &resp); err != nil {
+		return nil, err
+	}
+	return &resp, nil
+}
+
+// UpdateSession merges (or, with req.Replace, replaces) a session's metadata.
+func (c *Client) UpdateSession(ctx context.Context, sessionID string, req SessionUpdateRequest) (*Session, error) {
+	var session Session
+	if err := c.do(ctx, http.MethodPatch, "/v1/sessions/"+url.PathEscape(sessionID), nil, req, &session); err != nil {
+		return nil, err
+	}
+	return &session, nil
+}
+
+// GetSessionMessages retrieves messages for a session, optionally restricted
+// by filter to some roles or a single run.
+func (c *Client) GetSessionMessages(ctx context.Context, sessionID string, limit int, before string, filter MessageFilter) (*MessagesPage, error) {
+	query := url.Values{}
+	if limit > 0 {
+		query.Set("limit", strconv.Itoa(limit))
+	}
+	if before != "" {
+		query.Set("before", before)
+	}
+	if len(filter.Roles) > 0 {
+		query.Set("role", strings.Join(filter.Roles, ","))
+	}
+	if filter.RunID != "" {
+		query.Set("run_id", filter.RunID)
+	}
+	var page MessagesPage
+	if err := c.do(ctx, http.MethodGet, "/v1/sessions/"+url.PathEscape(sessionID)+"/messages", query, nil, &page); err != nil {
+		return nil, err
+	}
+	return &page, nil
+}
+
+// ListRuns retrieves a page of runs across sessions, newest first.
+func (c *Client) ListRuns(ctx context.Context, q RunsQuery) (*RunsPage, error) {
+	query := url.Values{}
+	if q.Status != "" {
+		query.Set("status", string(q.Status))
+	}
+	if q.AgentID != "" {
+		query.Set("agent_id", q.AgentID)
+	}
+	if q.SessionID != "" {
+		query.Set("session_id", q.SessionID)
+	}
+	if q.Tag != "" {
+		query.Set("tag", q.Tag)
+	}
+	if !q.StartedAfter.IsZero() {
+		query.Set("started_after", q.StartedAfter.Format(time.RFC3339Nano))
+	}
+	if !q.StartedBefore.IsZero() {
+		query.Set("started_before", q.StartedBefore.Format(time.RFC3339Nano))
+	}
+	if q.Cursor != "" {
+		query.Set("cursor", q.Cursor)
+	}
+	if q.Limit > 0 {
+		query.Set("limit", strconv.Itoa(q.Limit))
+	}
+	var page RunsPage
+	if err := c.do(ctx, http.MethodGet, "/v1/runs", query, nil, &page); err != nil {
+		return nil, err
+	}
+	return &page, nil
+}
+
+// GetRunEvents retrieves a single page of events for a run.
+func (c *Client) GetRunEvents(ctx context.Context, runID string, q EventsQuery) (*EventsPage, error) {
+	query := url.Values{}
+	if q.AfterTs > 0 {
+		query.Set("after_ts", strconv.FormatInt(q.AfterTs, 10))
+	}
+	if q.Cursor != "" {
+		query.Set("cursor", q.Cursor)
+	}
+	if q.DeviceID != "" {
+		query.Set("device_id", q.DeviceID)
+	}
+	if len(q.Types) > 0 {
+		query.Set("types", strings.Join(q.Types, ","))
+	}
+	if q.Limit > 0 {
+		query.Set("limit", strconv.Itoa(q.Limit))
+	}
+	var page EventsPage
+	if err := c.do(ctx, http.MethodGet, "/v1/runs/"+url.PathEscape(runID)+"/events", query, nil, &page); err != nil {
+		return nil, err
+	}
+	return &page, nil
+}
+
+// Events returns an iterator over all events of a run, following next_cursor
+// across pages.
+func (c *Client) Events(runID string, q EventsQuery) *EventIterator {
+	return &EventIterator{client: c, runID: runID, query: q}
+}
+
+// EventIterator iterates over run events page by page.
+//
+//	it := c.Events(runID, client.EventsQuery{})
+//	for it.Next(ctx) {
+//		ev := it.Event()
+//	}
+//	if err := it.Err(); err != nil { ... }
+type EventIterator struct {
+	client *Client
+	runID  string
+	query  EventsQuery
+
+	buf     []Event
+	current Event
+	done    bool
+	err     error
+}
+
+// Next advances to the next event, fetching a new page when needed.
+func (it *EventIterator) Next(ctx context.Context) bool {
+	for len(it.buf) == 0 {
+		if it.done || it.err != nil {
+			return false
+		}
+		page, err := it.client.GetRunEvents(ctx, it.runID, it.query)
+		if err != nil {
+			it.err = err
+			return false
+		}
+		it.buf = page.Events
+		if !page.HasMore || page.NextCursor == "" {
+			it.done = true
+		} else {
+			it.query.Cursor = page.NextCursor
+		}
+	}
+	it.current = it.buf[0]
+	it.buf = it.buf[1:]
+	return true
+}
+
+// Event returns the current event.
+func (it *EventIterator) Event() Event {
+	return it.current
+}
+
+// Err returns the first error encountered while iterating.
+func (it *EventIterator) Err() error {
+	return it.err
+}
+
+func (c *Client) do(ctx context.Context, method, path string, query url.Values, body, out interface{}) error {
+	u := c.baseURL + path
+	if len(query) > 0 {
+		u += "?" + query.Encode()
+	}
+
+	var reader io.Reader
+	if body != nil {
+		data, err := json.Marshal(body)
+		if err != nil {
+			return fmt.Errorf("failed to marshal request: %w", err)
+		}
+		reader = bytes.NewReader(data)
+	}
+
+	httpReq, err := http.NewRequestWithContext(ctx, method, u, reader)
+	if err != nil {
+		return fmt.Errorf("failed to create request: %w", err)
+	}
+	if body != nil {
+		httpReq.Header.Set("Content-Type", "application/json")
+	}
+	httpReq.Header.Set("Accept", "application/json")
+	if c.apiKey != "" {
+		httpReq.Header.Set("Authorization", "Bearer "+c.apiKey)
+	}
+
+	resp, err := c.httpClient.Do(httpReq)
+	if err != nil {
+		return fmt.Errorf("failed to send request: %w", err)
+	}
+	defer resp.Body.Close()
+
+	respBody, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return fmt.Errorf("failed to read response: %w", err)
+	}
+
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		apiErr := &APIError{StatusCode: resp.StatusCode, Message: string(respBody)}
+		var errResp struct {
+			Error string `json:"error"`
+			Code  string `json:"code"`
+		}
+		if err := json.Unmarshal(respBody, &errResp); err == nil && errResp.Error != "" {
+			apiErr.Message = errResp.Error
+			apiErr.Code = errResp.Code
+		}
+		return apiErr
+	}
+
+	if out == nil {
+		return nil
+	}
+	if err := json.Unmarshal(respBody, out); err != nil {
+		return fmt.Errorf("failed to unmarshal response: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,162 @@
+package client
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/labstack/echo/v4"
+	"github.com/xiaot623/gogo/orchestrator/internal/adapter/agentclient"
+	"github.com/xiaot623/gogo/orchestrator/internal/adapter/ingress"
+	"github.com/xiaot623/gogo/orchestrator/internal/adapter/llm"
+	"github.com/xiaot623/gogo/orchestrator/internal/config"
+	"github.com/xiaot623/gogo/orchestrator/internal/domain"
+	"github.com/xiaot623/gogo/orchestrator/internal/repository"
+	"github.com/xiaot623/gogo/orchestrator/internal/service"
+	v1 "github.com/xiaot623/gogo/orchestrator/internal/transport/http/v1"
+	"github.com/xiaot623/gogo/orchestrator/policy"
+	"github.com/xiaot623/gogo/orchestrator/tests/helpers"
+)
+
+func newTestServer(t *testing.T) (*Client, store.Store) {
+	t.Helper()
+	cfg := &config.Config{AgentTimeout: time.Second, ToolTimeout: time.Second}
+	db := helpers.NewTestSQLiteStore(t)
+	policyEngine, err := policy.NewEngine(context.Background(), policy.DefaultPolicy)
+	if err != nil {
+		t.Fatalf("NewEngine failed: %v", err)
+	}
+	svc := service.New(db, agentclient.NewClient(), ingress.NewClient(""), llm.NewClient("", "", time.Second), cfg, policyEngine)
+
+	e := echo.New()
+	v1.NewHandler(svc).RegisterRoutes(e)
+	server := httptest.NewServer(e)
+	t.Cleanup(server.Close)
+
+	return NewClient(server.URL, WithHTTPClient(server.Client())), db
+}
+
+func seedRun(t *testing.T, db store.Store, sessionID, runID string) {
+	t.Helper()
+	ctx := context.Background()
+	if err := db.CreateSession(ctx, &domain.Session{SessionID: sessionID, UserID: "u1", CreatedAt: time.Now()}); err != nil {
+		t.Fatalf("CreateSession failed: %v", err)
+	}
+	if err := db.CreateRun(ctx, &domain.Run{RunID: runID, SessionID: sessionID, RootAgentID: "a1", Status: domain.RunStatusRunning, StartedAt: time.Now()}); err != nil {
+		t.Fatalf("CreateRun failed: %v", err)
+	}
+}
+
+func TestEventIteratorFollowsCursor(t *testing.T) {
+	ctx := context.Background()
+	c, db := newTestServer(t)
+	seedRun(t, db, "s1", "r1")
+
+	base := time.Now().UnixMilli()
+	for i := 0; i < 5; i++ {
+		event := &domain.Event{
+			EventID: "e" + string(rune('1'+i)),
+			RunID:   "r1",
+			Ts:      base + int64(i),
+			Type:    domain.EventTypeAgentStreamDelta,
+			Payload: json.RawMessage(`{"text":"x"}`),
+		}
+		if err := db.CreateEvent(ctx, event); err != nil {
+			t.Fatalf("CreateEvent failed: %v", err)
+		}
+	}
+
+	page, err := c.GetRunEvents(ctx, "r1", EventsQuery{Limit: 2})
+	if err != nil {
+		t.Fatalf("GetRunEvents failed: %v", err)
+	}
+	if len(page.Events) != 2 || !page.HasMore || page.NextCursor == "" {
+		t.Fatalf("unexpected first page: %+v", page)
+	}
+
+	it := c.Events("r1", EventsQuery{Limit: 2})
+	var ids []string
+	for it.Next(ctx) {
+		ids = append(ids, it.Event().EventID)
+	}
+	if err := it.Err(); err != nil {
+		t.Fatalf("iterator error: %v", err)
+	}
+	if len(ids) != 5 || ids[0] != "e1" || ids[4] != "e5" {
+		t.Fatalf("unexpected events: %v", ids)
+	}
+}
+
+func TestInvokeToolAndSubmitResult(t *testing.T) {
+	ctx := context.Background()
+	c, db := newTestServer(t)
+	seedRun(t, db, "s1", "r1")
+
+	resp, err := c.InvokeTool(ctx, "browser.screenshot", ToolInvokeRequest{RunID: "r1", Args: json.RawMessage(`{}`)})
+	if err != nil {
+		t.Fatalf("InvokeTool failed: %v", err)
+	}
+	if resp.Status != "pending" || resp.Reason != "waiting_client" {
+		t.Fatalf("unexpected invoke response: %+v", resp)
+	}
+
+	result, err := c.SubmitToolResult(ctx, resp.ToolCallID, ToolCallResultRequest{
+		Status: "SUCCEEDED",
+		Result: json.RawMessage(`{"ok":true}`),
+	})
+	if err != nil {
+		t.Fatalf("SubmitToolResult failed: %v", err)
+	}
+	if result.Status != ToolCallStatusSucceeded {
+		t.Fatalf("unexpected result status: %s", result.Status)
+	}
+
+	tc, err := c.GetToolCall(ctx, resp.ToolCallID)
+	if err != nil {
+		t.Fatalf("GetToolCall failed: %v", err)
+	}
+	if tc.Status != ToolCallStatusSucceeded {
+		t.Fatalf("unexpected tool call status: %s", tc.Status)
+	}
+}
+
+func TestAPIErrorDecoded(t *testing.T) {
+	c, _ := newTestServer(t)
+
+	_, err := c.GetToolCall(context.Background(), "missing")
+	var apiErr *APIError
+	if !errors.As(err, &apiErr) {
+		t.Fatalf("expected APIError, got %v", err)
+	}
+	if apiErr.StatusCode != http.StatusNotFound || apiErr.Message != "tool call not found" {
+		t.Fatalf("unexpected error: %+v", apiErr)
+	}
+}
+
+func TestAPIKeySentAsBearerToken(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Authorization") != "Bearer k1" {
+			w.Header().Set("Content-Type", "application/json")
+			w.WriteHeader(http.StatusUnauthorized)
+			w.Write([]byte(`{"error":"invalid bearer token","code":"unauthorized"}`))
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		w.Write([]byte(`{"tool_call_id":"tc1","status":"SUCCEEDED"}`))
+	}))
+	defer server.Close()
+
+	if _, err := NewClient(server.URL, WithAPIKey("k1")).GetToolCall(context.Background(), "tc1"); err != nil {
+		t.Fatalf("GetToolCall with key failed: %v", err)
+	}
+
+	_, err := NewClient(server.URL).GetToolCall(context.Background(), "tc1")
+	var apiErr *APIError
+	if !errors.As(err, &apiErr) || apiErr.StatusCode != http.StatusUnauthorized || apiErr.Code != "unauthorized" {
+		t.Fatalf("expected unauthorized APIError, got %v", err)
+	}
+}
@@ -0,0 +1,102 @@
+package client
+
+import "github.com/xiaot623/gogo/orchestrator/internal/domain"
+
+// The request and response types below are the orchestrator's own wire
+// types, re-exported so callers outside this module can name them.
+
+// Request types.
+type (
+	ToolInvokeRequest       = domain.ToolInvokeRequest
+	ToolCallResultRequest   = domain.ToolCallResultRequest
+	ToolProgressRequest     = domain.ToolProgressRequest
+	ApprovalDecisionRequest = domain.ApprovalDecisionRequest
+	PolicyEvaluateRequest   = domain.PolicyEvaluateRequest
+	SessionUpdateRequest    = domain.SessionUpdateRequest
+	MessageFilter           = domain.MessageFilter
+)
+
+// Response types.
+type (
+	ToolInvokeResponse     = domain.ToolInvokeResponse
+	ToolCallResponse       = domain.ToolCallResponse
+	ToolCallResultResponse = domain.ToolCallResultResponse
+	ToolProgressResponse   = domain.ToolProgressResponse
+	PolicyEvaluateResponse = domain.PolicyEvaluateResponse
+	ToolError              = domain.ToolError
+	Timestamps             = domain.Timestamps
+	Session                = domain.Session
+	Message                = domain.Message
+	RunSummary             = domain.RunSummary
+	Event                  = domain.Event
+)
+
+// RunStatus is the status of a run.
+type RunStatus = domain.RunStatus
+
+// Run statuses.
+const (
+	RunStatusCreated               = domain.RunStatusCreated
+	RunStatusRunning               = domain.RunStatusRunning
+	RunStatusPausedWaitingTool     = domain.RunStatusPausedWaitingTool
+	RunStatusPausedWaitingApproval = domain.RunStatusPausedWaitingApproval
+	RunStatusDone                  = domain.RunStatusDone
+	RunStatusFailed                = domain.RunStatusFailed
+	RunStatusCancelled             = domain.RunStatusCancelled
+)
+
+// ToolCallStatus is the status of a tool call.
+type ToolCallStatus = domain.ToolCallStatus
+
+// Tool call statuses.
+const (
+	ToolCallStatusCreated         = domain.ToolCallStatusCreated
+	ToolCallStatusPolicyChecked   = domain.ToolCallStatusPolicyChecked
+	ToolCallStatusBlocked         = domain.ToolCallStatusBlocked
+	ToolCallStatusWaitingApproval = domain.ToolCallStatusWaitingApproval
+	ToolCallStatusApproved        = domain.ToolCallStatusApproved
+	ToolCallStatusRejected        = domain.ToolCallStatusRejected
+	ToolCallStatusDispatched      = domain.ToolCallStatusDispatched
+	ToolCallStatusRunning         = domain.ToolCallStatusRunning
+	ToolCallStatusSucceeded       = domain.ToolCallStatusSucceeded
+	ToolCallStatusFailed          = domain.ToolCallStatusFailed
+	ToolCallStatusTimeout         = domain.ToolCallStatusTimeout
+)
+
+// RememberScope is how widely a remembered approval applies.
+type RememberScope = domain.RememberScope
+
+// Remember scopes.
+const (
+	RememberScopeSession = domain.RememberScopeSession
+	RememberScopeUser    = domain.RememberScopeUser
+)
+
+// EventType is the type of a run event.
+type EventType = domain.EventType
+
+// Event types.
+const (
+	EventTypeRunStarted          = domain.EventTypeRunStarted
+	EventTypeUserInput           = domain.EventTypeUserInput
+	EventTypeAgentInvokeStarted  = domain.EventTypeAgentInvokeStarted
+	EventTypeAgentStreamDelta    = domain.EventTypeAgentStreamDelta
+	EventTypeAgentInvokeDone     = domain.EventTypeAgentInvokeDone
+	EventTypeRunDone             = domain.EventTypeRunDone
+	EventTypeRunFailed           = domain.EventTypeRunFailed
+	EventTypeRunCancelled        = domain.EventTypeRunCancelled
+	EventTypeAgentState          = domain.EventTypeAgentState
+	EventTypeRunSummary          = domain.EventTypeRunSummary
+	EventTypeAgentToolCallDelta  = domain.EventTypeAgentToolCallDelta
+	EventTypeAgentReasoningDelta = domain.EventTypeAgentReasoningDelta
+	EventTypeLLMCallStarted      = domain.EventTypeLLMCallStarted
+	EventTypeLLMCallDone         = domain.EventTypeLLMCallDone
+	EventTypeToolCallCreated     = domain.EventTypeToolCallCreated
+	EventTypePolicyDecision      = domain.EventTypePolicyDecision
+	EventTypeToolDispatched      = domain.EventTypeToolDispatched
+	EventTypeToolResult          = domain.EventTypeToolResult
+	EventTypeToolRequest         = domain.EventTypeToolRequest
+	EventTypeToolProgress        = domain.EventTypeToolProgress
+	EventTypeApprovalRequired    = domain.EventTypeApprovalRequired
+	EventTypeApprovalDecision    = domain.EventTypeApprovalDecision
+)
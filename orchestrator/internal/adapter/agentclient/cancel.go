@@ -0,0 +1,65 @@
+package agentclient
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+
+	"github.com/xiaot623/gogo/orchestrator/internal/telemetry"
+)
+
+// CancelRequest is the body POSTed to an agent's cancel URL.
+type CancelRequest struct {
+	RunID     string `json:"run_id"`
+	SessionID string `json:"session_id"`
+	Reason    string `json:"reason,omitempty"`
+}
+
+// ValidateCancelURL checks that an agent's cancel URL, if set, is an
+// absolute http(s) URL.
+func ValidateCancelURL(cancelURL string) error {
+	if cancelURL == "" {
+		return nil
+	}
+	u, err := url.Parse(cancelURL)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return fmt.Errorf("cancel_url must be an http(s) URL")
+	}
+	return nil
+}
+
+// Cancel tells an agent to stop working on a run by POSTing a CancelRequest
+// to its cancel URL with the agent's configured headers. Any 2xx answer
+// counts as accepted.
+func (c *Client) Cancel(ctx context.Context, cancelURL string, headers map[string]string, req CancelRequest) error {
+	body, err := json.Marshal(req)
+	if err != nil {
+		return fmt.Errorf("failed to marshal cancel request: %w", err)
+	}
+	httpReq, err := http.NewRequestWithContext(ctx, http.MethodPost, cancelURL, bytes.NewReader(body))
+	if err != nil {
+		return fmt.Errorf("failed to create cancel request: %w", err)
+	}
+	for name, value := range headers {
+		httpReq.Header.Set(name, value)
+	}
+	httpReq.Header.Set("Content-Type", "application/json")
+	httpReq.Header.Set("X-Session-ID", req.SessionID)
+	httpReq.Header.Set("X-Run-ID", req.RunID)
+	telemetry.InjectHTTP(ctx, httpReq)
+
+	resp, err := c.httpClient.Do(httpReq)
+	if err != nil {
+		return fmt.Errorf("failed to cancel agent run: %w", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		bodyBytes, _ := io.ReadAll(io.LimitReader(resp.Body, 4096))
+		return &StatusError{StatusCode: resp.StatusCode, Body: string(bodyBytes)}
+	}
+	return nil
+}
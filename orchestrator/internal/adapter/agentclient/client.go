@@ -2,17 +2,19 @@
 package agentclient
 
 import (
-	"bufio"
 	"bytes"
 	"context"
 	"encoding/json"
 	"fmt"
 	"io"
+	"net"
 	"net/http"
 	"strings"
 	"time"
 
 	"github.com/xiaot623/gogo/orchestrator/internal/domain"
+	"github.com/xiaot623/gogo/orchestrator/internal/telemetry"
+	"golang.org/x/net/http/httpguts"
 )
 
 // SSEEvent represents a parsed SSE event.
@@ -24,40 +26,216 @@ type SSEEvent struct {
 // EventHandler is called for each SSE event from the agent.
 type EventHandler func(event SSEEvent) error
 
+// StatusError is returned by Invoke when the agent answers with a non-200
+// status.
+type StatusError struct {
+	StatusCode int
+	Body       string
+}
+
+func (e *StatusError) Error() string {
+	return fmt.Sprintf("agent returned status %d: %s", e.StatusCode, e.Body)
+}
+
+// Default stream read limits; see WithReadBufferSize and WithMaxFrameSize.
+const (
+	DefaultReadBufferSize = 64 << 10
+	DefaultMaxFrameSize   = 16 << 20
+)
+
 // Client is an HTTP client for invoking agents.
 type Client struct {
-	httpClient *http.Client
+	httpClient     *http.Client
+	readBufferSize int
+	maxFrameSize   int
+}
+
+// Option configures a Client.
+type Option func(*Client)
+
+// WithTransport sets the transport used to reach agents.
+func WithTransport(transport http.RoundTripper) Option {
+	return func(c *Client) {
+		if transport != nil {
+			c.httpClient.Transport = transport
+		}
+	}
+}
+
+// WithReadBufferSize sets the buffer agent streams are read through. Lines
+// longer than the buffer are still read whole; it only sets how much is
+// read from the connection at once.
+func WithReadBufferSize(n int) Option {
+	return func(c *Client) {
+		if n > 0 {
+			c.readBufferSize = n
+		}
+	}
+}
+
+// WithMaxFrameSize caps the size of one streamed event: an SSE event's data
+// or an NDJSON line. A larger frame fails the stream with ErrFrameTooLarge.
+// 0 removes the cap.
+func WithMaxFrameSize(n int) Option {
+	return func(c *Client) {
+		if n >= 0 {
+			c.maxFrameSize = n
+		}
+	}
+}
+
+// NewClient creates a new agent client. The client has no overall timeout,
+// which would cut off long agent streams: callers bound each invocation with
+// its context, and the transport bounds connecting and waiting for response
+// headers.
+func NewClient(opts ...Option) *Client {
+	c := &Client{
+		httpClient:     &http.Client{Transport: NewTransport(TransportConfig{})},
+		readBufferSize: DefaultReadBufferSize,
+		maxFrameSize:   DefaultMaxFrameSize,
+	}
+	for _, opt := range opts {
+		opt(c)
+	}
+	return c
 }
 
-// NewClient creates a new agent client.
-func NewClient() *Client {
-	return &Client{
-		httpClient: &http.Client{
-			Timeout: 5 * time.Minute, // Long timeout for streaming
-		},
+// TransportConfig tunes the connections used to reach agents. Zero fields
+// take the defaults below.
+type TransportConfig struct {
+	DialTimeout           time.Duration
+	KeepAlive             time.Duration
+	TLSHandshakeTimeout   time.Duration
+	ResponseHeaderTimeout time.Duration
+	IdleConnTimeout       time.Duration
+	MaxIdleConnsPerHost   int
+}
+
+// Transport defaults.
+const (
+	DefaultDialTimeout           = 10 * time.Second
+	DefaultKeepAlive             = 30 * time.Second
+	DefaultTLSHandshakeTimeout   = 10 * time.Second
+	DefaultResponseHeaderTimeout = 60 * time.Second
+	DefaultIdleConnTimeout       = 90 * time.Second
+	DefaultMaxIdleConnsPerHost   = 32
+)
+
+// NewTransport builds a pooled transport for agent streams. Only connecting,
+// the TLS handshake and the wait for response headers are time-limited; the
+// response body may stream for as long as the request context allows.
+func NewTransport(cfg TransportConfig) *http.Transport {
+	orDefault := func(d, def time.Duration) time.Duration {
+		if d > 0 {
+			return d
+		}
+		return def
+	}
+	maxIdle := cfg.MaxIdleConnsPerHost
+	if maxIdle <= 0 {
+		maxIdle = DefaultMaxIdleConnsPerHost
+	}
+
+	dialer := &net.Dialer{
+		Timeout:   orDefault(cfg.DialTimeout, DefaultDialTimeout),
+		KeepAlive: orDefault(cfg.KeepAlive, DefaultKeepAlive),
+	}
+	return &http.Transport{
+		Proxy:                 http.ProxyFromEnvironment,
+		DialContext:           dialer.DialContext,
+		ForceAttemptHTTP2:     true,
+		TLSHandshakeTimeout:   orDefault(cfg.TLSHandshakeTimeout, DefaultTLSHandshakeTimeout),
+		ResponseHeaderTimeout: orDefault(cfg.ResponseHeaderTimeout, DefaultResponseHeaderTimeout),
+		IdleConnTimeout:       orDefault(cfg.IdleConnTimeout, DefaultIdleConnTimeout),
+		MaxIdleConnsPerHost:   maxIdle,
+		ExpectContinueTimeout: time.Second,
 	}
 }
 
-// Invoke calls an agent's /invoke endpoint and streams SSE events.
+// sensitiveHeaderParts marks header names whose values must not be logged.
+var sensitiveHeaderParts = []string{"auth", "token", "secret", "key", "password", "cookie"}
+
+// reservedHeaders are set by Invoke itself and cannot be overridden per agent.
+var reservedHeaders = map[string]bool{
+	"Content-Type":   true,
+	"Content-Length": true,
+	"Accept":         true,
+	"Host":           true,
+	"X-Session-Id":   true,
+	"X-Run-Id":       true,
+}
+
+// ValidateHeaders checks agent-configured headers for invalid or reserved names
+// and values.
+func ValidateHeaders(headers map[string]string) error {
+	for name, value := range headers {
+		if !httpguts.ValidHeaderFieldName(name) {
+			return fmt.Errorf("invalid header name %q", name)
+		}
+		if !httpguts.ValidHeaderFieldValue(value) {
+			return fmt.Errorf("invalid value for header %s", name)
+		}
+		if reservedHeaders[http.CanonicalHeaderKey(name)] {
+			return fmt.Errorf("header %s is managed by the orchestrator", http.CanonicalHeaderKey(name))
+		}
+	}
+	return nil
+}
+
+// RedactHeaders returns a copy of headers with sensitive values replaced, for
+// use in logs and recorded events.
+func RedactHeaders(headers map[string]string) map[string]string {
+	if len(headers) == 0 {
+		return nil
+	}
+	out := make(map[string]string, len(headers))
+	for name, value := range headers {
+		lower := strings.ToLower(name)
+		for _, part := range sensitiveHeaderParts {
+			if strings.Contains(lower, part) {
+				value = "[REDACTED]"
+				break
+			}
+		}
+		out[name] = value
+	}
+	return out
+}
+
+// Invoke calls an agent's /invoke endpoint and streams its events. The
+// response is decoded as SSE or NDJSON according to req.ResponseFormat, or
+// the response Content-Type when no format is configured.
 func (c *Client) Invoke(ctx context.Context, endpoint string, req *domain.AgentInvokeRequest, handler EventHandler) error {
+	openAI := req.Protocol == domain.AgentProtocolOpenAIChat
+
 	// Prepare request body
-	body, err := json.Marshal(req)
+	var payload interface{} = req
+	url := strings.TrimSuffix(endpoint, "/") + "/invoke"
+	if openAI {
+		payload = newOpenAIChatRequest(req)
+		url = strings.TrimSuffix(endpoint, "/") + "/chat/completions"
+	}
+	body, err := json.Marshal(payload)
 	if err != nil {
 		return fmt.Errorf("failed to marshal request: %w", err)
 	}
 
 	// Create HTTP request
-	url := strings.TrimSuffix(endpoint, "/") + "/invoke"
 	httpReq, err := http.NewRequestWithContext(ctx, http.MethodPost, url, bytes.NewReader(body))
 	if err != nil {
 		return fmt.Errorf("failed to create request: %w", err)
 	}
 
-	// Set headers
+	// Set headers. Agent-configured headers go first so the protocol headers
+	// below always win.
+	for name, value := range req.Headers {
+		httpReq.Header.Set(name, value)
+	}
 	httpReq.Header.Set("Content-Type", "application/json")
-	httpReq.Header.Set("Accept", "text/event-stream")
+	httpReq.Header.Set("Accept", acceptHeader(req.ResponseFormat))
 	httpReq.Header.Set("X-Session-ID", req.SessionID)
 	httpReq.Header.Set("X-Run-ID", req.RunID)
+	telemetry.InjectHTTP(ctx, httpReq)
 
 	// Execute request
 	resp, err := c.httpClient.Do(httpReq)
@@ -68,20 +246,30 @@ func (c *Client) Invoke(ctx context.Context, endpoint string, req *domain.AgentI
 
 	if resp.StatusCode != http.StatusOK {
 		bodyBytes, _ := io.ReadAll(resp.Body)
-		return fmt.Errorf("agent returned status %d: %s", resp.StatusCode, string(bodyBytes))
+		return &StatusError{StatusCode: resp.StatusCode, Body: string(bodyBytes)}
 	}
 
-	// Parse SSE stream
-	return c.parseSSE(resp.Body, handler)
+	// Parse the event stream
+	decode := c.decoderFor(req.ResponseFormat, resp.Header.Get("Content-Type"))
+	if openAI {
+		return c.parseOpenAIStream(resp.Body, decode, req.RunID, handler)
+	}
+	return decode(resp.Body, handler)
 }
 
 // parseSSE parses an SSE stream and calls the handler for each event.
 func (c *Client) parseSSE(reader io.Reader, handler EventHandler) error {
-	scanner := bufio.NewScanner(reader)
+	lines := c.newLineReader(reader)
 	var event SSEEvent
 
-	for scanner.Scan() {
-		line := scanner.Text()
+	for {
+		line, err := lines.next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return err
+		}
 
 		// Empty line marks end of event
 		if line == "" {
@@ -104,6 +292,9 @@ func (c *Client) parseSSE(reader io.Reader, handler EventHandler) error {
 			} else {
 				event.Data = data
 			}
+			if c.maxFrameSize > 0 && len(event.Data) > c.maxFrameSize {
+				return c.frameTooLarge()
+			}
 		}
 		// Ignore comments (lines starting with :) and other fields
 	}
@@ -115,7 +306,7 @@ func (c *Client) parseSSE(reader io.Reader, handler EventHandler) error {
 		}
 	}
 
-	return scanner.Err()
+	return nil
 }
 
 // ParseDeltaEvent parses a delta event data.
@@ -136,6 +327,44 @@ func ParseDoneEvent(data string) (*domain.DoneEventData, error) {
 	return &done, nil
 }
 
+// ParseStateEvent parses a state event data. A state event must name a state.
+func ParseStateEvent(data string) (*domain.StateEventData, error) {
+	var state domain.StateEventData
+	if err := json.Unmarshal([]byte(data), &state); err != nil {
+		return nil, fmt.Errorf("failed to parse state event: %w", err)
+	}
+	if state.State == "" {
+		return nil, fmt.Errorf("failed to parse state event: missing state")
+	}
+	return &state, nil
+}
+
+// ParseToolCallDeltaEvent parses a tool_call_delta event data. It must name
+// the tool call it belongs to.
+func ParseToolCallDeltaEvent(data string) (*domain.ToolCallDeltaEventData, error) {
+	var delta domain.ToolCallDeltaEventData
+	if err := json.Unmarshal([]byte(data), &delta); err != nil {
+		return nil, fmt.Errorf("failed to parse tool_call_delta event: %w", err)
+	}
+	if delta.ToolCallID == "" {
+		return nil, fmt.Errorf("failed to parse tool_call_delta event: missing tool_call_id")
+	}
+	return &delta, nil
+}
+
+// ParseToolCallEvent parses a tool_call event data. It must name the tool
+// call it ends.
+func ParseToolCallEvent(data string) (*domain.ToolCallEventData, error) {
+	var call domain.ToolCallEventData
+	if err := json.Unmarshal([]byte(data), &call); err != nil {
+		return nil, fmt.Errorf("failed to parse tool_call event: %w", err)
+	}
+	if call.ToolCallID == "" {
+		return nil, fmt.Errorf("failed to parse tool_call event: missing tool_call_id")
+	}
+	return &call, nil
+}
+
 // ParseErrorEvent parses an error event data.
 func ParseErrorEvent(data string) (*domain.ErrorEventData, error) {
 	var errEvt domain.ErrorEventData
@@ -3,6 +3,7 @@ package agentclient
 import (
 	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
 	"net/http"
@@ -12,6 +13,8 @@ import (
 	"time"
 
 	"github.com/xiaot623/gogo/orchestrator/internal/domain"
+	"github.com/xiaot623/gogo/orchestrator/internal/telemetry"
+	"go.opentelemetry.io/otel/trace"
 )
 
 func TestClientInvokeParsesSSE(t *testing.T) {
@@ -96,6 +99,104 @@ func TestParseSSEMultilineData(t *testing.T) {
 	}
 }
 
+func TestParseLongFrames(t *testing.T) {
+	// Longer than bufio.Scanner's default 64 KiB token limit.
+	text := strings.Repeat("x", 200<<10)
+	sse := "event: delta\ndata: {\"text\":\"" + text + "\"}\n\n"
+	ndjson := "{\"type\":\"delta\",\"text\":\"" + text + "\"}\n"
+
+	client := NewClient(WithReadBufferSize(4096), WithMaxFrameSize(1<<20))
+	for name, decode := range map[string]streamDecoder{"sse": client.parseSSE, "ndjson": client.parseNDJSON} {
+		input := sse
+		if name == "ndjson" {
+			input = ndjson
+		}
+		var got []SSEEvent
+		if err := decode(strings.NewReader(input), func(event SSEEvent) error {
+			got = append(got, event)
+			return nil
+		}); err != nil {
+			t.Fatalf("%s: decode failed: %v", name, err)
+		}
+		if len(got) != 1 || got[0].Event != "delta" || !strings.Contains(got[0].Data, text) {
+			t.Fatalf("%s: unexpected events: %d", name, len(got))
+		}
+	}
+
+	// Past the max frame size the stream fails with ErrFrameTooLarge,
+	// including an SSE event whose data lines only add up to too much.
+	client = NewClient(WithMaxFrameSize(1024))
+	chunk := strings.Repeat("y", 600)
+	for name, tc := range map[string]struct {
+		decode streamDecoder
+		input  string
+	}{
+		"sse line":    {client.parseSSE, sse},
+		"sse event":   {client.parseSSE, "event: delta\ndata: " + chunk + "\ndata: " + chunk + "\n\n"},
+		"ndjson line": {client.parseNDJSON, ndjson},
+	} {
+		called := false
+		err := tc.decode(strings.NewReader(tc.input), func(SSEEvent) error {
+			called = true
+			return nil
+		})
+		if !errors.Is(err, ErrFrameTooLarge) || called {
+			t.Fatalf("%s: expected ErrFrameTooLarge before any event, got %v (called=%v)", name, err, called)
+		}
+	}
+}
+
+func TestClientInvokeParsesNDJSON(t *testing.T) {
+	var accept string
+	contentType := "application/x-ndjson"
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		accept = r.Header.Get("Accept")
+		w.Header().Set("Content-Type", contentType)
+		fmt.Fprint(w, "{\"type\":\"delta\",\"text\":\"hi\"}\n\n")
+		fmt.Fprint(w, "{\"type\":\"done\",\"final_message\":\"hi\"}\n")
+	}))
+	defer server.Close()
+
+	client := &Client{httpClient: server.Client()}
+	invoke := func(format domain.AgentResponseFormat) []SSEEvent {
+		t.Helper()
+		req := &domain.AgentInvokeRequest{AgentID: "agent-1", SessionID: "sess-1", RunID: "run-1", ResponseFormat: format}
+		var events []SSEEvent
+		if err := client.Invoke(context.Background(), server.URL, req, func(event SSEEvent) error {
+			events = append(events, event)
+			return nil
+		}); err != nil {
+			t.Fatalf("invoke failed: %v", err)
+		}
+		return events
+	}
+
+	// Detected from the Content-Type when no format is configured.
+	events := invoke("")
+	if len(events) != 2 || events[0].Event != "delta" || events[1].Event != "done" {
+		t.Fatalf("unexpected events: %+v", events)
+	}
+	delta, err := ParseDeltaEvent(events[0].Data)
+	if err != nil || delta.Text != "hi" {
+		t.Fatalf("unexpected delta: %+v %v", delta, err)
+	}
+	if accept != "text/event-stream" {
+		t.Fatalf("expected default Accept, got %q", accept)
+	}
+
+	// A configured format wins over a misleading Content-Type.
+	contentType = "text/plain"
+	if events := invoke(domain.AgentResponseFormatNDJSON); len(events) != 2 || events[1].Event != "done" {
+		t.Fatalf("unexpected events: %+v", events)
+	}
+	if accept != "application/x-ndjson" {
+		t.Fatalf("expected NDJSON Accept, got %q", accept)
+	}
+	if events := invoke(domain.AgentResponseFormatSSE); len(events) != 0 {
+		t.Fatalf("expected NDJSON body to yield no SSE events, got %+v", events)
+	}
+}
+
 func TestParseEvents(t *testing.T) {
 	delta, err := ParseDeltaEvent(`{"text":"hi"}`)
 	if err != nil {
@@ -120,6 +221,14 @@ func TestParseEvents(t *testing.T) {
 	if errEvt.Code != "boom" {
 		t.Fatalf("unexpected error event: %+v", errEvt)
 	}
+
+	state, err := ParseStateEvent(`{"state":"searching","detail":"3 sources"}`)
+	if err != nil {
+		t.Fatalf("ParseStateEvent failed: %v", err)
+	}
+	if state.State != "searching" || state.Detail != "3 sources" {
+		t.Fatalf("unexpected state event: %+v", state)
+	}
 }
 
 func TestParseEventErrors(t *testing.T) {
@@ -132,4 +241,113 @@ func TestParseEventErrors(t *testing.T) {
 	if _, err := ParseErrorEvent("nope"); err == nil {
 		t.Fatalf("expected error for invalid error")
 	}
+	if _, err := ParseStateEvent(`{"detail":"no state"}`); err == nil {
+		t.Fatalf("expected error for state event without state")
+	}
+}
+
+func TestClientInvokePropagatesTraceContext(t *testing.T) {
+	if _, err := telemetry.Setup(context.Background(), "", "test"); err != nil {
+		t.Fatalf("telemetry setup failed: %v", err)
+	}
+
+	var traceparent string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		traceparent = r.Header.Get("traceparent")
+		w.Header().Set("Content-Type", "text/event-stream")
+		fmt.Fprint(w, "event: done\ndata: {}\n\n")
+	}))
+	defer server.Close()
+
+	traceID, _ := trace.TraceIDFromHex("4bf92f3577b34da6a3ce929d0e0e4736")
+	spanID, _ := trace.SpanIDFromHex("00f067aa0ba902b7")
+	ctx := trace.ContextWithSpanContext(context.Background(), trace.NewSpanContext(trace.SpanContextConfig{
+		TraceID:    traceID,
+		SpanID:     spanID,
+		TraceFlags: trace.FlagsSampled,
+	}))
+
+	client := &Client{httpClient: server.Client()}
+	req := &domain.AgentInvokeRequest{AgentID: "agent-1", SessionID: "sess-1", RunID: "run-1"}
+	if err := client.Invoke(ctx, server.URL, req, func(SSEEvent) error { return nil }); err != nil {
+		t.Fatalf("invoke failed: %v", err)
+	}
+
+	if want := "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01"; traceparent != want {
+		t.Fatalf("expected traceparent %q, got %q", want, traceparent)
+	}
+}
+
+func TestClientInvokeSendsAgentHeaders(t *testing.T) {
+	var gotHeaders http.Header
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		gotHeaders = r.Header.Clone()
+		w.Header().Set("Content-Type", "text/event-stream")
+		fmt.Fprint(w, "event: done\ndata: {}\n\n")
+	}))
+	defer server.Close()
+
+	client := &Client{httpClient: server.Client()}
+	req := &domain.AgentInvokeRequest{
+		AgentID:   "agent-1",
+		SessionID: "sess-1",
+		RunID:     "run-1",
+		Headers:   map[string]string{"Authorization": "Bearer t", "X-Tenant": "acme", "Content-Type": "text/plain"},
+	}
+	if err := client.Invoke(context.Background(), server.URL, req, func(SSEEvent) error { return nil }); err != nil {
+		t.Fatalf("invoke failed: %v", err)
+	}
+
+	if gotHeaders.Get("Authorization") != "Bearer t" || gotHeaders.Get("X-Tenant") != "acme" {
+		t.Fatalf("agent headers not forwarded: %v", gotHeaders)
+	}
+	if gotHeaders.Get("Content-Type") != "application/json" {
+		t.Fatalf("expected managed Content-Type, got %q", gotHeaders.Get("Content-Type"))
+	}
+}
+
+func TestRedactHeaders(t *testing.T) {
+	got := RedactHeaders(map[string]string{"Authorization": "Bearer t", "X-Api-Key": "k", "X-Tenant": "acme"})
+	if got["Authorization"] != "[REDACTED]" || got["X-Api-Key"] != "[REDACTED]" || got["X-Tenant"] != "acme" {
+		t.Fatalf("unexpected redaction: %v", got)
+	}
+}
+
+func TestTransportTimesOutHeadersButNotStreams(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("X-Run-Id") == "slow-headers" {
+			time.Sleep(300 * time.Millisecond)
+		}
+		w.Header().Set("Content-Type", "text/event-stream")
+		w.(http.Flusher).Flush()
+		// The stream outlives the header timeout between events.
+		fmt.Fprint(w, "event: delta\ndata: {\"text\":\"hi\"}\n\n")
+		w.(http.Flusher).Flush()
+		time.Sleep(200 * time.Millisecond)
+		fmt.Fprint(w, "event: done\ndata: {\"final_message\":\"hi\"}\n\n")
+	}))
+	defer server.Close()
+
+	client := NewClient(WithTransport(NewTransport(TransportConfig{ResponseHeaderTimeout: 100 * time.Millisecond})))
+	if client.httpClient.Timeout != 0 {
+		t.Fatalf("client must not have an overall timeout, got %v", client.httpClient.Timeout)
+	}
+	req := &domain.AgentInvokeRequest{AgentID: "a1", RunID: "r1"}
+
+	var events []SSEEvent
+	if err := client.Invoke(context.Background(), server.URL, req, func(event SSEEvent) error {
+		events = append(events, event)
+		return nil
+	}); err != nil {
+		t.Fatalf("slow stream was cut off: %v", err)
+	}
+	if len(events) != 2 {
+		t.Fatalf("expected 2 events, got %+v", events)
+	}
+
+	req.RunID = "slow-headers"
+	err := client.Invoke(context.Background(), server.URL, req, func(SSEEvent) error { return nil })
+	if err == nil || !strings.Contains(err.Error(), "timeout awaiting response headers") {
+		t.Fatalf("expected response header timeout, got %v", err)
+	}
 }
@@ -0,0 +1,123 @@
+package agentclient
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"mime"
+	"strings"
+
+	"github.com/xiaot623/gogo/orchestrator/internal/domain"
+)
+
+// streamDecoder reads an agent's streamed response body and calls handler for
+// each event, whatever the framing on the wire.
+type streamDecoder func(reader io.Reader, handler EventHandler) error
+
+// ndjsonContentTypes are response media types decoded as NDJSON when the
+// agent has no explicit response format. A plain application/json body is a
+// stream of one object.
+var ndjsonContentTypes = map[string]bool{
+	"application/x-ndjson":    true,
+	"application/ndjson":      true,
+	"application/jsonl":       true,
+	"application/x-jsonlines": true,
+	"application/json":        true,
+}
+
+// decoderFor picks the decoder for a response: the configured format if set,
+// otherwise one detected from the Content-Type, falling back to SSE.
+func (c *Client) decoderFor(format domain.AgentResponseFormat, contentType string) streamDecoder {
+	switch format {
+	case domain.AgentResponseFormatSSE:
+		return c.parseSSE
+	case domain.AgentResponseFormatNDJSON:
+		return c.parseNDJSON
+	}
+	if mediaType, _, err := mime.ParseMediaType(contentType); err == nil && ndjsonContentTypes[mediaType] {
+		return c.parseNDJSON
+	}
+	return c.parseSSE
+}
+
+// acceptHeader is the Accept header sent for a configured response format.
+func acceptHeader(format domain.AgentResponseFormat) string {
+	if format == domain.AgentResponseFormatNDJSON {
+		return "application/x-ndjson"
+	}
+	return "text/event-stream"
+}
+
+// parseNDJSON parses a stream of newline-delimited JSON objects. Each object
+// becomes an event named by its "type" field, with the whole line as data, so
+// {"type":"delta","text":"hi"} is handled like an SSE delta event. Blank lines
+// are skipped; lines without a type are passed on with an empty event name.
+func (c *Client) parseNDJSON(reader io.Reader, handler EventHandler) error {
+	lines := c.newLineReader(reader)
+
+	for {
+		line, err := lines.next()
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		line = strings.TrimSpace(line)
+		if line == "" {
+			continue
+		}
+
+		var head struct {
+			Type string `json:"type"`
+		}
+		_ = json.Unmarshal([]byte(line), &head)
+		if err := handler(SSEEvent{Event: head.Type, Data: line}); err != nil {
+			return err
+		}
+	}
+}
+
+// ErrFrameTooLarge is returned when an agent streams an event larger than
+// the client's max frame size.
+var ErrFrameTooLarge = errors.New("agent event exceeds the max frame size")
+
+func (c *Client) frameTooLarge() error {
+	return fmt.Errorf("%w of %d bytes", ErrFrameTooLarge, c.maxFrameSize)
+}
+
+// lineReader reads a stream line by line. Unlike bufio.Scanner it has no
+// fixed line limit: lines longer than its buffer are read in pieces, up to
+// the client's max frame size.
+type lineReader struct {
+	client *Client
+	reader *bufio.Reader
+	line   []byte
+}
+
+func (c *Client) newLineReader(reader io.Reader) *lineReader {
+	return &lineReader{client: c, reader: bufio.NewReaderSize(reader, c.readBufferSize)}
+}
+
+// next returns the next line without its line ending, or io.EOF once the
+// stream is exhausted. A last line without a newline is still returned.
+func (l *lineReader) next() (string, error) {
+	l.line = l.line[:0]
+	for {
+		chunk, err := l.reader.ReadSlice('\n')
+		l.line = append(l.line, chunk...)
+		if limit := l.client.maxFrameSize; limit > 0 && len(bytes.TrimRight(l.line, "\r\n")) > limit {
+			return "", l.client.frameTooLarge()
+		}
+		if err == bufio.ErrBufferFull {
+			continue
+		}
+		if err != nil && (err != io.EOF || len(l.line) == 0) {
+			return "", err
+		}
+		return string(bytes.TrimRight(l.line, "\r\n")), nil
+	}
+}
@@ -0,0 +1,145 @@
+package agentclient
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"strings"
+
+	"github.com/xiaot623/gogo/orchestrator/internal/domain"
+)
+
+// openAIChatRequest is the body sent to agents speaking openai_chat. The agent
+// ID doubles as the model name.
+type openAIChatRequest struct {
+	Model         string              `json:"model"`
+	Messages      []openAIChatMessage `json:"messages"`
+	Stream        bool                `json:"stream"`
+	StreamOptions map[string]bool     `json:"stream_options,omitempty"`
+	User          string              `json:"user,omitempty"`
+}
+
+type openAIChatMessage struct {
+	Role    string `json:"role"`
+	Content string `json:"content"`
+}
+
+// openAIStreamChunk is the subset of an OpenAI streaming chunk we consume.
+type openAIStreamChunk struct {
+	Choices []struct {
+		Delta struct {
+			Content          string `json:"content"`
+			ReasoningContent string `json:"reasoning_content"`
+		} `json:"delta"`
+		FinishReason *string `json:"finish_reason"`
+	} `json:"choices"`
+	Usage *struct {
+		PromptTokens     int `json:"prompt_tokens"`
+		CompletionTokens int `json:"completion_tokens"`
+		TotalTokens      int `json:"total_tokens"`
+	} `json:"usage"`
+	Error *struct {
+		Message string `json:"message"`
+		Type    string `json:"type"`
+		Code    string `json:"code"`
+	} `json:"error"`
+}
+
+// newOpenAIChatRequest maps an invoke request onto a streaming chat completion.
+// Messages already holds the session history including the new user input;
+// the input is appended only if the history does not end with it.
+func newOpenAIChatRequest(req *domain.AgentInvokeRequest) *openAIChatRequest {
+	out := &openAIChatRequest{
+		Model:         req.AgentID,
+		Messages:      make([]openAIChatMessage, 0, len(req.Messages)+1),
+		Stream:        true,
+		StreamOptions: map[string]bool{"include_usage": true},
+		User:          req.SessionID,
+	}
+	for _, m := range req.Messages {
+		out.Messages = append(out.Messages, openAIChatMessage{Role: m.Role, Content: m.Content})
+	}
+	input := openAIChatMessage{Role: req.InputMessage.Role, Content: req.InputMessage.Content}
+	if input.Role == "" {
+		input.Role = "user"
+	}
+	if n := len(out.Messages); n == 0 || out.Messages[n-1] != input {
+		out.Messages = append(out.Messages, input)
+	}
+	return out
+}
+
+// parseOpenAIStream reads an OpenAI chat completion stream and translates it
+// into the native delta/reasoning/done/error events, so callers see the same
+// event sequence regardless of the agent's protocol. reasoning_content deltas
+// (as emitted by reasoning models) become reasoning events.
+func (c *Client) parseOpenAIStream(reader io.Reader, decode streamDecoder, runID string, handler EventHandler) error {
+	var final strings.Builder
+	var usage *domain.UsageData
+	finished := false
+
+	emit := func(event string, v interface{}) error {
+		data, err := json.Marshal(v)
+		if err != nil {
+			return fmt.Errorf("failed to marshal %s event: %w", event, err)
+		}
+		return handler(SSEEvent{Event: event, Data: string(data)})
+	}
+	done := func() error {
+		if finished {
+			return nil
+		}
+		finished = true
+		return emit("done", domain.DoneEventData{Usage: usage, FinalMessage: final.String()})
+	}
+
+	err := decode(reader, func(event SSEEvent) error {
+		if finished {
+			return nil
+		}
+		if strings.TrimSpace(event.Data) == "[DONE]" {
+			return done()
+		}
+
+		var chunk openAIStreamChunk
+		if err := json.Unmarshal([]byte(event.Data), &chunk); err != nil {
+			// Skip malformed chunks
+			return nil
+		}
+		if chunk.Error != nil {
+			finished = true
+			code := chunk.Error.Code
+			if code == "" {
+				code = chunk.Error.Type
+			}
+			return emit("error", domain.ErrorEventData{Code: code, Message: chunk.Error.Message})
+		}
+		if chunk.Usage != nil {
+			usage = &domain.UsageData{
+				PromptTokens:     chunk.Usage.PromptTokens,
+				CompletionTokens: chunk.Usage.CompletionTokens,
+				TotalTokens:      chunk.Usage.TotalTokens,
+			}
+		}
+		for _, choice := range chunk.Choices {
+			if choice.Delta.ReasoningContent != "" {
+				if err := emit("reasoning", domain.DeltaEventData{Text: choice.Delta.ReasoningContent, RunID: runID}); err != nil {
+					return err
+				}
+			}
+			if choice.Delta.Content == "" {
+				continue
+			}
+			final.WriteString(choice.Delta.Content)
+			if err := emit("delta", domain.DeltaEventData{Text: choice.Delta.Content, RunID: runID}); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	// Some servers close the stream without a [DONE] sentinel.
+	return done()
+}
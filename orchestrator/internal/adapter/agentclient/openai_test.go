@@ -0,0 +1,138 @@
+package agentclient
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/xiaot623/gogo/orchestrator/internal/domain"
+)
+
+func TestClientInvokeOpenAIChat(t *testing.T) {
+	var gotReq openAIChatRequest
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/v1/chat/completions" {
+			t.Fatalf("unexpected path: %s", r.URL.Path)
+		}
+		if err := json.NewDecoder(r.Body).Decode(&gotReq); err != nil {
+			t.Fatalf("failed to decode request: %v", err)
+		}
+
+		w.Header().Set("Content-Type", "text/event-stream")
+		fmt.Fprint(w, "data: {\"choices\":[{\"delta\":{\"role\":\"assistant\"}}]}\n\n")
+		fmt.Fprint(w, "data: {\"choices\":[{\"delta\":{\"content\":\"Hel\"}}]}\n\n")
+		fmt.Fprint(w, "data: {\"choices\":[{\"delta\":{\"content\":\"lo\"},\"finish_reason\":\"stop\"}]}\n\n")
+		fmt.Fprint(w, "data: {\"choices\":[],\"usage\":{\"prompt_tokens\":5,\"completion_tokens\":2,\"total_tokens\":7}}\n\n")
+		fmt.Fprint(w, "data: [DONE]\n\n")
+	}))
+	defer server.Close()
+
+	client := &Client{httpClient: server.Client()}
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+
+	req := &domain.AgentInvokeRequest{
+		AgentID:   "gpt-4o-mini",
+		SessionID: "sess-1",
+		RunID:     "run-1",
+		Messages: []domain.Message{
+			{Role: "user", Content: "hi"},
+			{Role: "assistant", Content: "hey"},
+			{Role: "user", Content: "hello"},
+		},
+		InputMessage: domain.InputMessage{Role: "user", Content: "hello"},
+		Protocol:     domain.AgentProtocolOpenAIChat,
+	}
+
+	var events []SSEEvent
+	err := client.Invoke(ctx, server.URL+"/v1", req, func(event SSEEvent) error {
+		events = append(events, event)
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("invoke failed: %v", err)
+	}
+
+	if gotReq.Model != "gpt-4o-mini" || !gotReq.Stream || len(gotReq.Messages) != 3 {
+		t.Fatalf("unexpected request payload: %+v", gotReq)
+	}
+
+	if len(events) != 3 {
+		t.Fatalf("expected 3 events, got %+v", events)
+	}
+	if events[0].Event != "delta" || events[1].Event != "delta" || events[2].Event != "done" {
+		t.Fatalf("unexpected events: %+v", events)
+	}
+	delta, err := ParseDeltaEvent(events[0].Data)
+	if err != nil || delta.Text != "Hel" || delta.RunID != "run-1" {
+		t.Fatalf("unexpected delta: %+v (%v)", delta, err)
+	}
+	done, err := ParseDoneEvent(events[2].Data)
+	if err != nil {
+		t.Fatalf("failed to parse done: %v", err)
+	}
+	if done.FinalMessage != "Hello" || done.Usage == nil || done.Usage.TotalTokens != 7 {
+		t.Fatalf("unexpected done: %+v", done)
+	}
+}
+
+func TestParseOpenAIStreamError(t *testing.T) {
+	input := "data: {\"choices\":[{\"delta\":{\"content\":\"partial\"}}]}\n\n" +
+		"data: {\"error\":{\"message\":\"rate limited\",\"type\":\"rate_limit_error\"}}\n\n"
+
+	var events []SSEEvent
+	client := &Client{}
+	if err := client.parseOpenAIStream(strings.NewReader(input), client.parseSSE, "run-1", func(event SSEEvent) error {
+		events = append(events, event)
+		return nil
+	}); err != nil {
+		t.Fatalf("parse failed: %v", err)
+	}
+
+	if len(events) != 2 || events[1].Event != "error" {
+		t.Fatalf("unexpected events: %+v", events)
+	}
+	errEvt, err := ParseErrorEvent(events[1].Data)
+	if err != nil || errEvt.Code != "rate_limit_error" || errEvt.Message != "rate limited" {
+		t.Fatalf("unexpected error event: %+v (%v)", errEvt, err)
+	}
+}
+
+func TestNewOpenAIChatRequestAppendsInput(t *testing.T) {
+	req := newOpenAIChatRequest(&domain.AgentInvokeRequest{
+		AgentID:      "model",
+		InputMessage: domain.InputMessage{Content: "hello"},
+	})
+	if len(req.Messages) != 1 || req.Messages[0].Role != "user" || req.Messages[0].Content != "hello" {
+		t.Fatalf("unexpected messages: %+v", req.Messages)
+	}
+}
+
+func TestParseOpenAIStreamReasoning(t *testing.T) {
+	input := "data: {\"choices\":[{\"delta\":{\"reasoning_content\":\"think\"}}]}\n\n" +
+		"data: {\"choices\":[{\"delta\":{\"content\":\"answer\"}}]}\n\n" +
+		"data: [DONE]\n\n"
+
+	var events []SSEEvent
+	client := &Client{}
+	if err := client.parseOpenAIStream(strings.NewReader(input), client.parseSSE, "run-1", func(event SSEEvent) error {
+		events = append(events, event)
+		return nil
+	}); err != nil {
+		t.Fatalf("parse failed: %v", err)
+	}
+
+	if len(events) != 3 || events[0].Event != "reasoning" || events[1].Event != "delta" || events[2].Event != "done" {
+		t.Fatalf("unexpected events: %+v", events)
+	}
+	done, err := ParseDoneEvent(events[2].Data)
+	if err != nil || done.FinalMessage != "answer" {
+		t.Fatalf("reasoning must not be part of the final message: %+v (%v)", done, err)
+	}
+}
@@ -0,0 +1,54 @@
+package agentclient
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+
+	"github.com/xiaot623/gogo/orchestrator/internal/domain"
+)
+
+// ValidateEndpoint checks that an agent endpoint is an absolute http(s) URL.
+func ValidateEndpoint(endpoint string) error {
+	u, err := url.Parse(endpoint)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return fmt.Errorf("endpoint must be an http(s) URL")
+	}
+	return nil
+}
+
+// Probe checks that an agent answers before it is registered. Native agents
+// must answer GET {endpoint}/health with a 2xx. openai_chat endpoints are
+// probed with GET {endpoint}/models, and any answer but a 5xx counts, since
+// not every compatible server lists its models.
+func (c *Client) Probe(ctx context.Context, endpoint string, protocol domain.AgentProtocol, headers map[string]string) error {
+	path := "/health"
+	if protocol == domain.AgentProtocolOpenAIChat {
+		path = "/models"
+	}
+	httpReq, err := http.NewRequestWithContext(ctx, http.MethodGet, strings.TrimSuffix(endpoint, "/")+path, nil)
+	if err != nil {
+		return fmt.Errorf("failed to create probe request: %w", err)
+	}
+	for name, value := range headers {
+		httpReq.Header.Set(name, value)
+	}
+
+	resp, err := c.httpClient.Do(httpReq)
+	if err != nil {
+		return fmt.Errorf("agent is unreachable: %w", err)
+	}
+	defer resp.Body.Close()
+	ok := resp.StatusCode >= 200 && resp.StatusCode <= 299
+	if protocol == domain.AgentProtocolOpenAIChat {
+		ok = resp.StatusCode < 500
+	}
+	if !ok {
+		bodyBytes, _ := io.ReadAll(io.LimitReader(resp.Body, 4096))
+		return &StatusError{StatusCode: resp.StatusCode, Body: string(bodyBytes)}
+	}
+	return nil
+}
@@ -2,12 +2,14 @@ package ingress
 
 import (
 	"context"
+	"errors"
 	"fmt"
-	"log"
+	"log/slog"
 	"net"
 	"net/rpc/jsonrpc"
 	"net/url"
 	"strings"
+	"sync"
 	"time"
 )
 
@@ -15,53 +17,192 @@ type Client struct {
 	addr        string
 	dialTimeout time.Duration
 	callTimeout time.Duration
+
+	// detached holds sessions whose events are not pushed because ingress
+	// reported they have no connection left.
+	mu       sync.Mutex
+	detached map[string]bool
+
+	// queueSize bounds each session's outbound queue (0 pushes inline).
+	queueSize int
+	queues    map[string]*sessionQueue
+	dropped   int64
+
+	// streams holds the event streams ingress instances opened, and
+	// subscribers the streams subscribed to each session.
+	streamMu    sync.RWMutex
+	streams     map[*eventStream]bool
+	subscribers map[string]map[*eventStream]bool
+}
+
+// Option configures a Client.
+type Option func(*Client)
+
+// WithQueueSize makes PushEvent enqueue events on a per-session queue of at
+// most size events, drained by one goroutine per session, instead of pushing
+// them inline. A size of 0 keeps pushes inline.
+func WithQueueSize(size int) Option {
+	return func(c *Client) {
+		if size > 0 {
+			c.queueSize = size
+		}
+	}
 }
 
-func NewClient(baseURL string) *Client {
-	return &Client{
+func NewClient(baseURL string, opts ...Option) *Client {
+	c := &Client{
 		addr:        resolveRPCAddr(baseURL),
 		dialTimeout: 5 * time.Second,
 		callTimeout: 5 * time.Second,
+		detached:    make(map[string]bool),
+		queues:      make(map[string]*sessionQueue),
+		streams:     make(map[*eventStream]bool),
+		subscribers: make(map[string]map[*eventStream]bool),
+	}
+	for _, opt := range opts {
+		opt(c)
 	}
+	return c
+}
+
+// DetachSession stops pushing events for a session until AttachSession.
+func (c *Client) DetachSession(sessionID string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.detached[sessionID] = true
+}
+
+// AttachSession resumes pushing events for a detached session.
+func (c *Client) AttachSession(sessionID string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	delete(c.detached, sessionID)
+}
+
+// Detached reports whether events for a session are currently not pushed.
+func (c *Client) Detached(sessionID string) bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.detached[sessionID]
 }
 
-// SendRequest represents the request body for internal event delivery.
+// SendVersion is the version of SendRequest this client sends.
+const SendVersion = 1
+
+// SendRequest represents the request body for internal event delivery. It
+// mirrors ingress's protocol.SendRequest, which validates it on receipt.
 type SendRequest struct {
+	Version   int                    `json:"version,omitempty"`
 	SessionID string                 `json:"session_id"`
 	Event     map[string]interface{} `json:"event"`
 }
 
+// ErrPushRejected is returned when ingress rejects a push as malformed.
+// Resending the same event fails again.
+var ErrPushRejected = errors.New("ingress rejected malformed push")
+
+// invalidSendPrefix starts the error ingress returns for a malformed push.
+const invalidSendPrefix = "invalid send request: "
+
 // SendResponse represents the response for internal event delivery.
 type SendResponse struct {
 	OK        bool `json:"ok"`
 	Delivered bool `json:"delivered"`
 }
 
+// PushEvent delivers an event to the session's connections: as a
+// notification on the event streams subscribed to the session, or else by an
+// Ingress.PushEvent call. With a queue size set the event is only enqueued
+// and delivery errors are logged by the session's drain goroutine.
 func (c *Client) PushEvent(sessionID string, event map[string]interface{}) error {
-	if c.addr == "" {
+	if (c.addr == "" && !c.hasStreams()) || c.Detached(sessionID) {
+		return nil
+	}
+	if c.queueSize > 0 {
+		c.enqueue(sessionID, event)
 		return nil
 	}
+	return c.push(sessionID, event)
+}
 
+func (c *Client) push(sessionID string, event map[string]interface{}) error {
 	req := &SendRequest{
+		Version:   SendVersion,
 		SessionID: sessionID,
 		Event:     event,
 	}
 
+	if streams := c.subscribedStreams(sessionID); len(streams) > 0 {
+		err := c.notify(streams, req)
+		if err == nil || c.addr == "" {
+			return err
+		}
+		slog.Warn("falling back to ingress rpc push", "session_id", sessionID, "error", err)
+	}
+	if c.addr == "" {
+		return nil
+	}
+
 	var resp SendResponse
 	ctx, cancel := context.WithTimeout(context.Background(), c.callTimeout)
 	defer cancel()
 
 	if err := c.call(ctx, "Ingress.PushEvent", req, &resp); err != nil {
+		if msg := err.Error(); strings.HasPrefix(msg, invalidSendPrefix) {
+			return fmt.Errorf("%w: %s", ErrPushRejected, strings.TrimPrefix(msg, invalidSendPrefix))
+		}
 		return fmt.Errorf("failed to push event to ingress: %w", err)
 	}
 	if !resp.OK {
-		log.Printf("WARN: ingress rpc returned ok=false (delivered=%v)", resp.Delivered)
+		slog.Warn("ingress rpc returned ok=false", "session_id", sessionID, "delivered", resp.Delivered)
 		return fmt.Errorf("ingress rpc returned ok=false")
 	}
 
 	return nil
 }
 
+// DisconnectRequest represents the request body for evicting a session's
+// WebSocket connections.
+type DisconnectRequest struct {
+	SessionID string `json:"session_id"`
+	Code      int    `json:"code,omitempty"`
+	Reason    string `json:"reason,omitempty"`
+}
+
+// DisconnectResponse represents the response for evicting a session.
+type DisconnectResponse struct {
+	OK           bool `json:"ok"`
+	Disconnected int  `json:"disconnected"`
+}
+
+// DisconnectSession closes every WebSocket connection of a session with the
+// given close code (0 lets ingress pick its default) and reason, returning
+// how many connections were closed.
+func (c *Client) DisconnectSession(sessionID string, code int, reason string) (int, error) {
+	if c.addr == "" {
+		return 0, nil
+	}
+
+	req := &DisconnectRequest{
+		SessionID: sessionID,
+		Code:      code,
+		Reason:    reason,
+	}
+
+	var resp DisconnectResponse
+	ctx, cancel := context.WithTimeout(context.Background(), c.callTimeout)
+	defer cancel()
+
+	if err := c.call(ctx, "Ingress.DisconnectSession", req, &resp); err != nil {
+		return 0, fmt.Errorf("failed to disconnect session via ingress: %w", err)
+	}
+	if !resp.OK {
+		return 0, fmt.Errorf("ingress rpc returned ok=false")
+	}
+
+	return resp.Disconnected, nil
+}
+
 func (c *Client) call(ctx context.Context, method string, args, reply interface{}) error {
 	conn, err := net.DialTimeout("tcp", c.addr, c.dialTimeout)
 	if err != nil {
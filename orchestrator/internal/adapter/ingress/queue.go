@@ -0,0 +1,115 @@
+package ingress
+
+import "log/slog"
+
+// sessionQueue holds a session's events waiting to be pushed, oldest first.
+// draining is set while a goroutine is pushing them.
+type sessionQueue struct {
+	events   []map[string]interface{}
+	draining bool
+}
+
+// QueueStats is a snapshot of the outbound push queues.
+type QueueStats struct {
+	// Depth is the number of events waiting across all sessions.
+	Depth int
+	// Dropped counts delta events dropped because a queue was full.
+	Dropped int64
+	// Size is the per-session queue bound (0 = pushes are inline).
+	Size int
+}
+
+// QueueStats returns the current queue depth and drop count.
+func (c *Client) QueueStats() QueueStats {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	stats := QueueStats{Dropped: c.dropped, Size: c.queueSize}
+	for _, q := range c.queues {
+		stats.Depth += len(q.events)
+	}
+	return stats
+}
+
+// Backlogged reports whether a session has events queued behind the one
+// being pushed, i.e. ingress is not keeping up with it. Inline pushes never
+// report a backlog.
+func (c *Client) Backlogged(sessionID string) bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	q := c.queues[sessionID]
+	return q != nil && len(q.events) > 0
+}
+
+// droppableEvent reports whether an event may be dropped when its session's
+// queue is full. Only streamed text is: the full text stays in the run's
+// events, while terminal and tool events must reach the client.
+func droppableEvent(event map[string]interface{}) bool {
+	switch event["type"] {
+	case "delta", "reasoning":
+		return true
+	}
+	return false
+}
+
+// enqueue appends an event to the session's queue and starts a drain
+// goroutine if none is running. A full queue makes room by dropping its
+// oldest delta; when it holds none, an incoming delta is dropped and any
+// other event is queued beyond the bound.
+func (c *Client) enqueue(sessionID string, event map[string]interface{}) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	q := c.queues[sessionID]
+	if q == nil {
+		q = &sessionQueue{}
+		c.queues[sessionID] = q
+	}
+	if len(q.events) >= c.queueSize {
+		dropped := false
+		for i, queued := range q.events {
+			if droppableEvent(queued) {
+				q.events = append(q.events[:i], q.events[i+1:]...)
+				dropped = true
+				break
+			}
+		}
+		if !dropped && droppableEvent(event) {
+			c.dropped++
+			return
+		}
+		if dropped {
+			c.dropped++
+		}
+	}
+	q.events = append(q.events, event)
+	if !q.draining {
+		q.draining = true
+		go c.drain(sessionID, q)
+	}
+}
+
+// drain pushes a session's queued events in order until the queue is empty,
+// then removes it.
+func (c *Client) drain(sessionID string, q *sessionQueue) {
+	for {
+		c.mu.Lock()
+		if len(q.events) == 0 {
+			q.draining = false
+			delete(c.queues, sessionID)
+			c.mu.Unlock()
+			return
+		}
+		event := q.events[0]
+		q.events[0] = nil
+		q.events = q.events[1:]
+		detached := c.detached[sessionID]
+		c.mu.Unlock()
+
+		if detached {
+			continue
+		}
+		if err := c.push(sessionID, event); err != nil {
+			slog.Warn("failed to push queued event", "session_id", sessionID, "type", event["type"], "error", err)
+		}
+	}
+}
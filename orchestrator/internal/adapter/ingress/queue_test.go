@@ -0,0 +1,116 @@
+package ingress
+
+import (
+	"net"
+	"net/rpc"
+	"net/rpc/jsonrpc"
+	"sync"
+	"testing"
+	"time"
+)
+
+// blockingIngress records pushed events; each push waits for release.
+type blockingIngress struct {
+	mu       sync.Mutex
+	events   []map[string]interface{}
+	received chan struct{}
+	release  chan struct{}
+}
+
+func (f *blockingIngress) PushEvent(req *SendRequest, resp *SendResponse) error {
+	f.received <- struct{}{}
+	<-f.release
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.events = append(f.events, req.Event)
+	resp.OK = true
+	resp.Delivered = true
+	return nil
+}
+
+func startBlockingIngress(t *testing.T) (*blockingIngress, string) {
+	t.Helper()
+	fake := &blockingIngress{received: make(chan struct{}, 16), release: make(chan struct{})}
+	server := rpc.NewServer()
+	if err := server.RegisterName("Ingress", fake); err != nil {
+		t.Fatalf("RegisterName: %v", err)
+	}
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("Listen: %v", err)
+	}
+	t.Cleanup(func() { ln.Close() })
+	go func() {
+		for {
+			conn, err := ln.Accept()
+			if err != nil {
+				return
+			}
+			go server.ServeCodec(jsonrpc.NewServerCodec(conn))
+		}
+	}()
+	return fake, ln.Addr().String()
+}
+
+func TestQueueDropsOldestDeltaWhenFull(t *testing.T) {
+	fake, addr := startBlockingIngress(t)
+	client := NewClient(addr, WithQueueSize(2))
+
+	push := func(typ, text string) {
+		if err := client.PushEvent("s1", map[string]interface{}{"type": typ, "text": text}); err != nil {
+			t.Fatalf("PushEvent: %v", err)
+		}
+	}
+
+	// The first delta is taken off the queue and blocks in the push.
+	push("delta", "a")
+	select {
+	case <-fake.received:
+	case <-time.After(5 * time.Second):
+		t.Fatal("first push never reached ingress")
+	}
+
+	push("delta", "b")
+	push("delta", "c")
+	push("done", "")   // full: drops "b"
+	push("delta", "d") // full: drops "c", never "done"
+	push("error", "")  // full without deltas but "d": drops "d"
+	push("delta", "e") // full of terminal events: dropped itself
+
+	if stats := client.QueueStats(); stats.Depth != 2 || stats.Dropped != 4 || stats.Size != 2 {
+		t.Fatalf("unexpected stats: %+v", stats)
+	}
+
+	close(fake.release)
+	deadline := time.After(5 * time.Second)
+	for client.QueueStats().Depth != 0 {
+		select {
+		case <-deadline:
+			t.Fatalf("queue not drained: %+v", client.QueueStats())
+		case <-time.After(10 * time.Millisecond):
+		}
+	}
+	for {
+		fake.mu.Lock()
+		n := len(fake.events)
+		fake.mu.Unlock()
+		if n == 3 {
+			break
+		}
+		select {
+		case <-deadline:
+			t.Fatalf("expected 3 pushes, got %d", n)
+		case <-time.After(10 * time.Millisecond):
+		}
+	}
+
+	fake.mu.Lock()
+	defer fake.mu.Unlock()
+	var got []string
+	for _, ev := range fake.events {
+		got = append(got, ev["type"].(string)+":"+ev["text"].(string))
+	}
+	if len(got) != 3 || got[0] != "delta:a" || got[1] != "done:" || got[2] != "error:" {
+		t.Fatalf("unexpected pushes: %v", got)
+	}
+}
@@ -0,0 +1,257 @@
+package ingress
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"net"
+	"sync"
+	"time"
+)
+
+// Event stream methods. An ingress opens an event stream by sending
+// SubscribeEventsMethod as the first request on a connection to the
+// orchestrator RPC port. The connection then carries JSON-RPC 1.0
+// notifications (id null, no reply) both ways: Subscribe and Unsubscribe
+// from ingress, Event from the orchestrator.
+const (
+	SubscribeEventsMethod = "Orchestrator.SubscribeEvents"
+	SubscribeMethod       = "Orchestrator.Subscribe"
+	UnsubscribeMethod     = "Orchestrator.Unsubscribe"
+	EventMethod           = "Ingress.Event"
+)
+
+// StreamMessage is a JSON-RPC 1.0 request on an event stream, or a
+// notification when ID is null.
+type StreamMessage struct {
+	Method string            `json:"method"`
+	Params []json.RawMessage `json:"params"`
+	ID     json.RawMessage   `json:"id"`
+}
+
+// StreamReply answers the SubscribeEvents request that opens a stream.
+type StreamReply struct {
+	ID     json.RawMessage       `json:"id"`
+	Result *SubscribeEventsReply `json:"result"`
+	Error  interface{}           `json:"error"`
+}
+
+// SubscribeEventsArgs opens an event stream for an ingress instance,
+// subscribed to the sessions bound there.
+type SubscribeEventsArgs struct {
+	IngressID  string   `json:"ingress_id"`
+	SessionIDs []string `json:"session_ids,omitempty"`
+}
+
+// SubscribeEventsReply acknowledges an opened event stream.
+type SubscribeEventsReply struct {
+	OK bool `json:"ok"`
+}
+
+// SubscribeArgs are the params of Subscribe and Unsubscribe notifications.
+type SubscribeArgs struct {
+	SessionIDs []string `json:"session_ids"`
+}
+
+// eventStream is an event stream opened by one ingress instance.
+type eventStream struct {
+	ingressID string
+	conn      net.Conn
+	// sessions is guarded by Client.streamMu.
+	sessions map[string]bool
+	// mu serializes writes to conn.
+	mu sync.Mutex
+}
+
+// write sends one encoded message, giving up after timeout.
+func (s *eventStream) write(data []byte, timeout time.Duration) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if timeout > 0 {
+		_ = s.conn.SetWriteDeadline(time.Now().Add(timeout))
+	}
+	_, err := s.conn.Write(data)
+	return err
+}
+
+// ServeEventStream serves an event stream ingress opened on conn, reading
+// from r (which replays any bytes the caller consumed to route the
+// connection). It returns when the stream closes.
+func (c *Client) ServeEventStream(conn net.Conn, r io.Reader) {
+	defer conn.Close()
+	dec := json.NewDecoder(r)
+
+	var hello StreamMessage
+	if err := dec.Decode(&hello); err != nil {
+		return
+	}
+	var args SubscribeEventsArgs
+	if len(hello.Params) == 1 {
+		_ = json.Unmarshal(hello.Params[0], &args)
+	}
+	stream := &eventStream{ingressID: args.IngressID, conn: conn, sessions: make(map[string]bool)}
+	if args.IngressID == "" {
+		stream.reply(hello.ID, nil, "ingress_id is required", c.callTimeout)
+		return
+	}
+	if err := stream.reply(hello.ID, &SubscribeEventsReply{OK: true}, nil, c.callTimeout); err != nil {
+		return
+	}
+
+	logger := slog.With("ingress_id", args.IngressID, "remote_addr", conn.RemoteAddr().String())
+	c.addStream(stream, args.SessionIDs)
+	defer c.removeStream(stream)
+	logger.Info("ingress event stream opened", "sessions", len(args.SessionIDs))
+
+	for {
+		var msg StreamMessage
+		if err := dec.Decode(&msg); err != nil {
+			if errors.Is(err, io.EOF) || errors.Is(err, net.ErrClosed) {
+				logger.Info("ingress event stream closed")
+			} else {
+				logger.Warn("ingress event stream failed", "error", err)
+			}
+			return
+		}
+		var sub SubscribeArgs
+		if len(msg.Params) == 1 {
+			_ = json.Unmarshal(msg.Params[0], &sub)
+		}
+		switch msg.Method {
+		case SubscribeMethod:
+			c.subscribe(stream, sub.SessionIDs)
+		case UnsubscribeMethod:
+			c.unsubscribe(stream, sub.SessionIDs)
+		default:
+			logger.Warn("ignoring unknown event stream message", "method", msg.Method)
+		}
+	}
+}
+
+func (s *eventStream) reply(id json.RawMessage, result *SubscribeEventsReply, errMsg interface{}, timeout time.Duration) error {
+	data, err := json.Marshal(StreamReply{ID: id, Result: result, Error: errMsg})
+	if err != nil {
+		return err
+	}
+	return s.write(append(data, '\n'), timeout)
+}
+
+func (c *Client) addStream(stream *eventStream, sessionIDs []string) {
+	c.streamMu.Lock()
+	c.streams[stream] = true
+	c.streamMu.Unlock()
+	c.subscribe(stream, sessionIDs)
+}
+
+func (c *Client) removeStream(stream *eventStream) {
+	c.streamMu.Lock()
+	defer c.streamMu.Unlock()
+	delete(c.streams, stream)
+	for sessionID := range stream.sessions {
+		c.dropSubscriberLocked(sessionID, stream)
+	}
+}
+
+// subscribe routes the sessions' events to stream. A subscription means the
+// session has a connection again, so it is attached too.
+func (c *Client) subscribe(stream *eventStream, sessionIDs []string) {
+	c.streamMu.Lock()
+	for _, sessionID := range sessionIDs {
+		if sessionID == "" {
+			continue
+		}
+		stream.sessions[sessionID] = true
+		if c.subscribers[sessionID] == nil {
+			c.subscribers[sessionID] = make(map[*eventStream]bool)
+		}
+		c.subscribers[sessionID][stream] = true
+	}
+	c.streamMu.Unlock()
+
+	for _, sessionID := range sessionIDs {
+		c.AttachSession(sessionID)
+	}
+}
+
+func (c *Client) unsubscribe(stream *eventStream, sessionIDs []string) {
+	c.streamMu.Lock()
+	defer c.streamMu.Unlock()
+	for _, sessionID := range sessionIDs {
+		delete(stream.sessions, sessionID)
+		c.dropSubscriberLocked(sessionID, stream)
+	}
+}
+
+// dropSubscriberLocked removes stream from a session's subscribers.
+// c.streamMu must be held for writing.
+func (c *Client) dropSubscriberLocked(sessionID string, stream *eventStream) {
+	delete(c.subscribers[sessionID], stream)
+	if len(c.subscribers[sessionID]) == 0 {
+		delete(c.subscribers, sessionID)
+	}
+}
+
+// subscribedStreams returns the streams subscribed to a session.
+func (c *Client) subscribedStreams(sessionID string) []*eventStream {
+	c.streamMu.RLock()
+	defer c.streamMu.RUnlock()
+	streams := make([]*eventStream, 0, len(c.subscribers[sessionID]))
+	for stream := range c.subscribers[sessionID] {
+		streams = append(streams, stream)
+	}
+	return streams
+}
+
+// hasStreams reports whether any ingress has an event stream open.
+func (c *Client) hasStreams() bool {
+	c.streamMu.RLock()
+	defer c.streamMu.RUnlock()
+	return len(c.streams) > 0
+}
+
+// StreamStats is a snapshot of the open event streams.
+type StreamStats struct {
+	Streams  int
+	Sessions int // Sessions with at least one subscribed stream
+}
+
+// StreamStats returns how many event streams and subscribed sessions there
+// are.
+func (c *Client) StreamStats() StreamStats {
+	c.streamMu.RLock()
+	defer c.streamMu.RUnlock()
+	return StreamStats{Streams: len(c.streams), Sessions: len(c.subscribers)}
+}
+
+// notify sends an Event notification to every stream. A stream whose write
+// fails is closed, which ends its ServeEventStream. It fails only when no
+// stream took the event.
+func (c *Client) notify(streams []*eventStream, req *SendRequest) error {
+	params, err := json.Marshal(req)
+	if err != nil {
+		return fmt.Errorf("failed to encode event: %w", err)
+	}
+	data, err := json.Marshal(StreamMessage{Method: EventMethod, Params: []json.RawMessage{params}})
+	if err != nil {
+		return fmt.Errorf("failed to encode event: %w", err)
+	}
+	data = append(data, '\n')
+
+	var lastErr error
+	sent := 0
+	for _, stream := range streams {
+		if err := stream.write(data, c.callTimeout); err != nil {
+			slog.Warn("closing ingress event stream after failed write", "ingress_id", stream.ingressID, "session_id", req.SessionID, "error", err)
+			stream.conn.Close()
+			lastErr = err
+			continue
+		}
+		sent++
+	}
+	if sent == 0 {
+		return fmt.Errorf("failed to push event over ingress event stream: %w", lastErr)
+	}
+	return nil
+}
@@ -0,0 +1,147 @@
+package ingress
+
+import (
+	"encoding/json"
+	"fmt"
+	"net"
+	"testing"
+	"time"
+)
+
+// fakeStream is the ingress end of an event stream.
+type fakeStream struct {
+	conn net.Conn
+	enc  *json.Encoder
+	dec  *json.Decoder
+}
+
+func openFakeStream(t *testing.T, client *Client, ingressID string, sessionIDs ...string) *fakeStream {
+	t.Helper()
+	ingressEnd, orchestratorEnd := net.Pipe()
+	t.Cleanup(func() { ingressEnd.Close() })
+	go client.ServeEventStream(orchestratorEnd, orchestratorEnd)
+
+	f := &fakeStream{conn: ingressEnd, enc: json.NewEncoder(ingressEnd), dec: json.NewDecoder(ingressEnd)}
+	f.send(t, SubscribeEventsMethod, json.RawMessage("0"), SubscribeEventsArgs{IngressID: ingressID, SessionIDs: sessionIDs})
+	var reply StreamReply
+	if err := f.dec.Decode(&reply); err != nil {
+		t.Fatalf("decode reply: %v", err)
+	}
+	if reply.Error != nil || reply.Result == nil || !reply.Result.OK || string(reply.ID) != "0" {
+		t.Fatalf("unexpected reply %+v", reply)
+	}
+	return f
+}
+
+func (f *fakeStream) send(t *testing.T, method string, id json.RawMessage, params interface{}) {
+	t.Helper()
+	raw, _ := json.Marshal(params)
+	if err := f.enc.Encode(StreamMessage{Method: method, Params: []json.RawMessage{raw}, ID: id}); err != nil {
+		t.Fatalf("send %s: %v", method, err)
+	}
+}
+
+// read returns the next Event notification's params.
+func (f *fakeStream) read() (SendRequest, error) {
+	var req SendRequest
+	_ = f.conn.SetReadDeadline(time.Now().Add(time.Second))
+	var msg StreamMessage
+	if err := f.dec.Decode(&msg); err != nil {
+		return req, err
+	}
+	if msg.Method != EventMethod || len(msg.Params) != 1 || string(msg.ID) != "null" {
+		return req, fmt.Errorf("unexpected notification %+v", msg)
+	}
+	err := json.Unmarshal(msg.Params[0], &req)
+	return req, err
+}
+
+func (f *fakeStream) next(t *testing.T) SendRequest {
+	t.Helper()
+	req, err := f.read()
+	if err != nil {
+		t.Fatalf("read event: %v", err)
+	}
+	return req
+}
+
+func waitForStreamStats(t *testing.T, client *Client, want StreamStats) {
+	t.Helper()
+	deadline := time.Now().Add(time.Second)
+	for client.StreamStats() != want {
+		if time.Now().After(deadline) {
+			t.Fatalf("stream stats = %+v, want %+v", client.StreamStats(), want)
+		}
+		time.Sleep(time.Millisecond)
+	}
+}
+
+func TestEventStreamFansOutToSubscribers(t *testing.T) {
+	client := NewClient("")
+	a := openFakeStream(t, client, "ingress-a", "s1")
+	b := openFakeStream(t, client, "ingress-b")
+	b.send(t, SubscribeMethod, nil, SubscribeArgs{SessionIDs: []string{"s1", "s2"}})
+	waitForStreamStats(t, client, StreamStats{Streams: 2, Sessions: 2})
+
+	// Both ingress instances own s1; only b owns s2. Pipes are unbuffered,
+	// so both ends read while the event is pushed.
+	type result struct {
+		req SendRequest
+		err error
+	}
+	received := make(chan result, 2)
+	for _, f := range []*fakeStream{a, b} {
+		go func(f *fakeStream) {
+			req, err := f.read()
+			received <- result{req, err}
+		}(f)
+	}
+	if err := client.PushEvent("s1", map[string]interface{}{"type": "delta", "text": "hi"}); err != nil {
+		t.Fatalf("PushEvent: %v", err)
+	}
+	for i := 0; i < 2; i++ {
+		r := <-received
+		if r.err != nil || r.req.SessionID != "s1" || r.req.Version != SendVersion || r.req.Event["text"] != "hi" {
+			t.Fatalf("unexpected event %+v (%v)", r.req, r.err)
+		}
+	}
+	go client.PushEvent("s2", map[string]interface{}{"type": "done"})
+	if req := b.next(t); req.SessionID != "s2" || req.Event["type"] != "done" {
+		t.Fatalf("unexpected event %+v", req)
+	}
+
+	b.send(t, UnsubscribeMethod, nil, SubscribeArgs{SessionIDs: []string{"s2"}})
+	waitForStreamStats(t, client, StreamStats{Streams: 2, Sessions: 1})
+	// With no subscriber and no RPC address the event goes nowhere.
+	if err := client.PushEvent("s2", map[string]interface{}{"type": "done"}); err != nil {
+		t.Fatalf("PushEvent: %v", err)
+	}
+
+	// Closing a stream drops its subscriptions.
+	a.conn.Close()
+	waitForStreamStats(t, client, StreamStats{Streams: 1, Sessions: 1})
+	go client.PushEvent("s1", map[string]interface{}{"type": "done"})
+	if req := b.next(t); req.SessionID != "s1" || req.Event["type"] != "done" {
+		t.Fatalf("unexpected event %+v", req)
+	}
+}
+
+func TestEventStreamRequiresIngressID(t *testing.T) {
+	client := NewClient("")
+	ingressEnd, orchestratorEnd := net.Pipe()
+	defer ingressEnd.Close()
+	go client.ServeEventStream(orchestratorEnd, orchestratorEnd)
+
+	f := &fakeStream{conn: ingressEnd, enc: json.NewEncoder(ingressEnd), dec: json.NewDecoder(ingressEnd)}
+	f.send(t, SubscribeEventsMethod, json.RawMessage("1"), SubscribeEventsArgs{})
+	var reply StreamReply
+	if err := f.dec.Decode(&reply); err != nil {
+		t.Fatalf("decode reply: %v", err)
+	}
+	if reply.Error != "ingress_id is required" || reply.Result != nil {
+		t.Fatalf("unexpected reply %+v", reply)
+	}
+	if stats := client.StreamStats(); stats.Streams != 0 {
+		t.Fatalf("expected no stream, got %+v", stats)
+	}
+}
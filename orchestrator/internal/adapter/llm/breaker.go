@@ -0,0 +1,212 @@
+package llm
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/xiaot623/gogo/orchestrator/internal/clock"
+)
+
+// ErrCircuitOpen is returned without contacting the upstream while the
+// circuit breaker is open.
+var ErrCircuitOpen = errors.New("LLM upstream unavailable: circuit breaker open")
+
+// BreakerState is the state of a circuit breaker.
+type BreakerState int
+
+const (
+	// BreakerClosed passes every request through.
+	BreakerClosed BreakerState = iota
+	// BreakerHalfOpen lets a single probe request through after the cooldown.
+	BreakerHalfOpen
+	// BreakerOpen fails requests fast until the cooldown has elapsed.
+	BreakerOpen
+)
+
+func (s BreakerState) String() string {
+	switch s {
+	case BreakerClosed:
+		return "closed"
+	case BreakerHalfOpen:
+		return "half_open"
+	case BreakerOpen:
+		return "open"
+	}
+	return "unknown"
+}
+
+// BreakerStats is a snapshot of a breaker for metrics.
+type BreakerStats struct {
+	State BreakerState
+	// Transitions counts state changes by the state entered.
+	Transitions [3]uint64
+}
+
+// Breaker is an LLMClient that stops calling the upstream after threshold
+// consecutive failures. While open, requests fail with ErrCircuitOpen; once
+// the cooldown has elapsed the next request is let through as a probe, closing
+// the breaker on success and reopening it on failure.
+//
+// Only transport errors and 5xx responses count as failures: 4xx responses
+// and requests cancelled by the caller say nothing about upstream health.
+type Breaker struct {
+	inner     LLMClient
+	threshold int
+	cooldown  time.Duration
+	clock     clock.Clock
+
+	mu          sync.Mutex
+	state       BreakerState
+	failures    int
+	openedAt    time.Time
+	probing     bool
+	transitions [3]uint64
+}
+
+// NewBreaker wraps inner with a circuit breaker.
+func NewBreaker(inner LLMClient, threshold int, cooldown time.Duration) *Breaker {
+	return &Breaker{
+		inner:     inner,
+		threshold: threshold,
+		cooldown:  cooldown,
+		clock:     clock.Default,
+	}
+}
+
+// Ensure Breaker implements LLMClient interface.
+var _ LLMClient = (*Breaker)(nil)
+
+// CreateChatCompletion implements LLMClient.
+func (b *Breaker) CreateChatCompletion(ctx context.Context, req *ChatCompletionRequest) (*ChatCompletionResponse, error) {
+	if err := b.allow(); err != nil {
+		return nil, err
+	}
+	resp, err := b.inner.CreateChatCompletion(ctx, req)
+	b.record(ctx, err)
+	return resp, err
+}
+
+// CreateChatCompletionStream implements LLMClient. Errors returned by the
+// callback (e.g. the client went away) are not upstream failures.
+func (b *Breaker) CreateChatCompletionStream(ctx context.Context, req *ChatCompletionRequest, callback StreamCallback) (*Usage, error) {
+	if err := b.allow(); err != nil {
+		return nil, err
+	}
+	var callbackErr error
+	usage, err := b.inner.CreateChatCompletionStream(ctx, req, func(chunk *StreamChunk) error {
+		callbackErr = callback(chunk)
+		return callbackErr
+	})
+	if err != nil && callbackErr != nil && errors.Is(err, callbackErr) {
+		b.record(ctx, nil)
+	} else {
+		b.record(ctx, err)
+	}
+	return usage, err
+}
+
+// ListModels implements LLMClient.
+func (b *Breaker) ListModels(ctx context.Context) ([]Model, error) {
+	if err := b.allow(); err != nil {
+		return nil, err
+	}
+	models, err := b.inner.ListModels(ctx)
+	b.record(ctx, err)
+	return models, err
+}
+
+// Stats returns the breaker's current state and transition counts.
+func (b *Breaker) Stats() BreakerStats {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return BreakerStats{State: b.state, Transitions: b.transitions}
+}
+
+// allow reports whether a request may go to the upstream.
+func (b *Breaker) allow() error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	switch b.state {
+	case BreakerOpen:
+		if b.clock.Now().Sub(b.openedAt) < b.cooldown {
+			return ErrCircuitOpen
+		}
+		b.setState(BreakerHalfOpen)
+		b.probing = true
+		return nil
+	case BreakerHalfOpen:
+		if b.probing {
+			return ErrCircuitOpen
+		}
+		b.probing = true
+		return nil
+	}
+	return nil
+}
+
+// record updates the breaker with the outcome of an upstream call.
+func (b *Breaker) record(ctx context.Context, err error) {
+	failed := isUpstreamFailure(ctx, err)
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if b.state == BreakerHalfOpen {
+		b.probing = false
+		switch {
+		case failed:
+			b.open()
+		case ctx.Err() == context.Canceled:
+			// Inconclusive probe; the next request probes again.
+		default:
+			b.failures = 0
+			b.setState(BreakerClosed)
+		}
+		return
+	}
+
+	if !failed {
+		b.failures = 0
+		return
+	}
+	b.failures++
+	if b.state == BreakerClosed && b.failures >= b.threshold {
+		b.open()
+	}
+}
+
+func (b *Breaker) open() {
+	b.openedAt = b.clock.Now()
+	b.setState(BreakerOpen)
+}
+
+// setState must be called with mu held.
+func (b *Breaker) setState(state BreakerState) {
+	if b.state == state {
+		return
+	}
+	slog.Warn("LLM circuit breaker state changed", "from", b.state.String(), "to", state.String(), "consecutive_failures", b.failures)
+	b.state = state
+	b.transitions[state]++
+}
+
+// isUpstreamFailure reports whether err says the upstream is unhealthy.
+func isUpstreamFailure(ctx context.Context, err error) bool {
+	if err == nil {
+		return false
+	}
+	// The caller gave up; that is not the upstream's fault.
+	if ctx.Err() == context.Canceled {
+		return false
+	}
+	var statusErr *StatusError
+	if errors.As(err, &statusErr) {
+		return statusErr.StatusCode >= http.StatusInternalServerError
+	}
+	return true
+}
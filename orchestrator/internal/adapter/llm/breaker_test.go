@@ -0,0 +1,107 @@
+package llm
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/xiaot623/gogo/orchestrator/internal/clock"
+)
+
+// scriptedClient fails with err (if set) and counts calls.
+type scriptedClient struct {
+	err   error
+	calls int
+}
+
+func (c *scriptedClient) CreateChatCompletion(ctx context.Context, req *ChatCompletionRequest) (*ChatCompletionResponse, error) {
+	c.calls++
+	if c.err != nil {
+		return nil, c.err
+	}
+	return &ChatCompletionResponse{}, nil
+}
+
+func (c *scriptedClient) CreateChatCompletionStream(ctx context.Context, req *ChatCompletionRequest, callback StreamCallback) (*Usage, error) {
+	c.calls++
+	if c.err != nil {
+		return nil, c.err
+	}
+	return nil, callback(&StreamChunk{})
+}
+
+func (c *scriptedClient) ListModels(ctx context.Context) ([]Model, error) {
+	c.calls++
+	return nil, c.err
+}
+
+func TestBreakerOpensAndRecovers(t *testing.T) {
+	ctx := context.Background()
+	upstream := &scriptedClient{err: errors.New("connection refused")}
+	clk := clock.NewFake(time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC))
+	b := NewBreaker(upstream, 3, 10*time.Second)
+	b.clock = clk
+
+	call := func() error {
+		_, err := b.CreateChatCompletion(ctx, &ChatCompletionRequest{Model: "gpt"})
+		return err
+	}
+
+	for i := 0; i < 3; i++ {
+		if err := call(); err == nil || errors.Is(err, ErrCircuitOpen) {
+			t.Fatalf("call %d: expected upstream error, got %v", i, err)
+		}
+	}
+	if b.Stats().State != BreakerOpen {
+		t.Fatalf("expected breaker open after 3 failures, got %s", b.Stats().State)
+	}
+
+	// Open: fail fast without touching the upstream.
+	if err := call(); !errors.Is(err, ErrCircuitOpen) || upstream.calls != 3 {
+		t.Fatalf("expected fast failure, got %v after %d upstream calls", err, upstream.calls)
+	}
+
+	// A failed probe reopens the breaker for another cooldown.
+	clk.Advance(10 * time.Second)
+	if err := call(); err == nil || errors.Is(err, ErrCircuitOpen) {
+		t.Fatalf("expected probe to reach upstream, got %v", err)
+	}
+	if b.Stats().State != BreakerOpen {
+		t.Fatalf("expected breaker reopened, got %s", b.Stats().State)
+	}
+	if err := call(); !errors.Is(err, ErrCircuitOpen) {
+		t.Fatalf("expected fast failure after failed probe, got %v", err)
+	}
+
+	// A successful probe closes it.
+	upstream.err = nil
+	clk.Advance(10 * time.Second)
+	if err := call(); err != nil {
+		t.Fatalf("expected probe to succeed, got %v", err)
+	}
+	stats := b.Stats()
+	if stats.State != BreakerClosed {
+		t.Fatalf("expected breaker closed, got %s", stats.State)
+	}
+	if stats.Transitions[BreakerOpen] != 2 || stats.Transitions[BreakerHalfOpen] != 2 || stats.Transitions[BreakerClosed] != 1 {
+		t.Fatalf("unexpected transitions: %+v", stats.Transitions)
+	}
+}
+
+func TestBreakerIgnoresClientErrors(t *testing.T) {
+	ctx := context.Background()
+	upstream := &scriptedClient{err: &StatusError{StatusCode: 400, Message: "bad request"}}
+	b := NewBreaker(upstream, 1, time.Minute)
+
+	for i := 0; i < 3; i++ {
+		b.CreateChatCompletion(ctx, &ChatCompletionRequest{Model: "gpt"})
+	}
+	upstream.err = nil
+	writeErr := errors.New("client went away")
+	b.CreateChatCompletionStream(ctx, &ChatCompletionRequest{Model: "gpt"}, func(*StreamChunk) error { return writeErr })
+
+	if b.Stats().State != BreakerClosed {
+		t.Fatalf("expected 4xx and callback errors to leave the breaker closed, got %s", b.Stats().State)
+	}
+}
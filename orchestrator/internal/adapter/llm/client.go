@@ -11,6 +11,8 @@ import (
 	"net/http"
 	"strings"
 	"time"
+
+	"github.com/xiaot623/gogo/orchestrator/internal/telemetry"
 )
 
 // Client is the LiteLLM proxy client.
@@ -160,11 +162,7 @@ func (c *Client) CreateChatCompletion(ctx context.Context, req *ChatCompletionRe
 	}
 
 	if resp.StatusCode != http.StatusOK {
-		var errResp ErrorResponse
-		if err := json.Unmarshal(respBody, &errResp); err == nil && errResp.Error != nil {
-			return nil, fmt.Errorf("LLM API error [%d]: %s (type: %s)", resp.StatusCode, errResp.Error.Message, errResp.Error.Type)
-		}
-		return nil, fmt.Errorf("LLM API error [%d]: %s", resp.StatusCode, string(respBody))
+		return nil, newStatusError(resp.StatusCode, respBody)
 	}
 
 	var result ChatCompletionResponse
@@ -175,6 +173,26 @@ func (c *Client) CreateChatCompletion(ctx context.Context, req *ChatCompletionRe
 	return &result, nil
 }
 
+// StatusError is returned when LiteLLM answers with a non-200 status.
+type StatusError struct {
+	StatusCode int
+	Message    string
+}
+
+func (e *StatusError) Error() string {
+	return e.Message
+}
+
+// newStatusError builds a StatusError, using the OpenAI-style error body when
+// there is one.
+func newStatusError(status int, body []byte) *StatusError {
+	var errResp ErrorResponse
+	if err := json.Unmarshal(body, &errResp); err == nil && errResp.Error != nil {
+		return &StatusError{StatusCode: status, Message: fmt.Sprintf("LLM API error [%d]: %s (type: %s)", status, errResp.Error.Message, errResp.Error.Type)}
+	}
+	return &StatusError{StatusCode: status, Message: fmt.Sprintf("LLM API error [%d]: %s", status, string(body))}
+}
+
 // StreamCallback is called for each chunk in a streaming response.
 type StreamCallback func(chunk *StreamChunk) error
 
@@ -202,11 +220,7 @@ func (c *Client) CreateChatCompletionStream(ctx context.Context, req *ChatComple
 
 	if resp.StatusCode != http.StatusOK {
 		respBody, _ := io.ReadAll(resp.Body)
-		var errResp ErrorResponse
-		if err := json.Unmarshal(respBody, &errResp); err == nil && errResp.Error != nil {
-			return nil, fmt.Errorf("LLM API error [%d]: %s (type: %s)", resp.StatusCode, errResp.Error.Message, errResp.Error.Type)
-		}
-		return nil, fmt.Errorf("LLM API error [%d]: %s", resp.StatusCode, string(respBody))
+		return nil, newStatusError(resp.StatusCode, respBody)
 	}
 
 	// Parse SSE stream
@@ -278,7 +292,7 @@ func (c *Client) ListModels(ctx context.Context) ([]Model, error) {
 	}
 
 	if resp.StatusCode != http.StatusOK {
-		return nil, fmt.Errorf("LLM API error [%d]: %s", resp.StatusCode, string(respBody))
+		return nil, &StatusError{StatusCode: resp.StatusCode, Message: fmt.Sprintf("LLM API error [%d]: %s", resp.StatusCode, string(respBody))}
 	}
 
 	var result ModelsResponse
@@ -306,6 +320,7 @@ type ModelsResponse struct {
 // setHeaders sets common request headers.
 func (c *Client) setHeaders(req *http.Request) {
 	req.Header.Set("Content-Type", "application/json")
+	telemetry.InjectHTTP(req.Context(), req)
 	if c.apiKey != "" {
 		req.Header.Set("Authorization", "Bearer "+c.apiKey)
 	}
@@ -1,7 +1,7 @@
 package llm
 
 import (
-	"log"
+	"log/slog"
 	"os"
 	"time"
 )
@@ -19,7 +19,7 @@ func NewLLMClient(baseURL, apiKey string, timeout time.Duration) LLMClient {
 	mode := os.Getenv(EnvGogoMode)
 
 	if mode == ModeMock {
-		log.Println("GOGO_MODE=MOCK detected, using mock LLM client")
+		slog.Info("GOGO_MODE=MOCK detected, using mock LLM client")
 		return NewMockClient()
 	}
 
@@ -0,0 +1,161 @@
+// Package webhook delivers recorded run events to an external HTTP endpoint
+// (e.g. an analytics pipeline or SIEM).
+package webhook
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"sync/atomic"
+	"time"
+
+	"github.com/xiaot623/gogo/orchestrator/internal/domain"
+)
+
+// Request headers set on every delivery.
+const (
+	HeaderSignature = "X-Gogo-Signature"
+	HeaderEventID   = "X-Gogo-Event-ID"
+	HeaderEventType = "X-Gogo-Event-Type"
+)
+
+// Config configures a Sink.
+type Config struct {
+	// URL receives one POST per event, with the event as the JSON body.
+	URL string
+	// Secret signs each body; see Sign.
+	Secret string
+	// Timeout bounds each delivery attempt.
+	Timeout time.Duration
+	// MaxAttempts bounds how often an event is tried before it is dropped.
+	MaxAttempts int
+	// Backoff is the wait before the first retry; it doubles on each retry.
+	Backoff time.Duration
+	// QueueSize bounds how many events wait for delivery; events arriving at
+	// a full queue are dropped.
+	QueueSize int
+}
+
+// Sink POSTs events to a URL from a background goroutine, so a slow or
+// broken endpoint never holds up the code recording the events.
+type Sink struct {
+	cfg     Config
+	client  *http.Client
+	queue   chan domain.Event
+	dropped atomic.Int64
+	logger  *slog.Logger
+}
+
+// New creates a Sink. Events are only sent while Run is running.
+func New(cfg Config, logger *slog.Logger) *Sink {
+	if cfg.MaxAttempts < 1 {
+		cfg.MaxAttempts = 1
+	}
+	if logger == nil {
+		logger = slog.Default()
+	}
+	return &Sink{
+		cfg:    cfg,
+		client: &http.Client{Timeout: cfg.Timeout},
+		queue:  make(chan domain.Event, cfg.QueueSize),
+		logger: logger,
+	}
+}
+
+// Deliver queues an event for delivery. It never blocks: an event arriving
+// at a full queue is dropped and counted.
+func (s *Sink) Deliver(event domain.Event) {
+	select {
+	case s.queue <- event:
+	default:
+		s.dropped.Add(1)
+		s.logger.Warn("dropped webhook event, queue full", "run_id", event.RunID, "event_id", event.EventID, "type", event.Type)
+	}
+}
+
+// Dropped returns how many events were dropped, either because the queue
+// was full or because every delivery attempt failed.
+func (s *Sink) Dropped() int64 {
+	return s.dropped.Load()
+}
+
+// Run sends queued events in order until ctx is done.
+func (s *Sink) Run(ctx context.Context) {
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case event := <-s.queue:
+			if err := s.send(ctx, event); err != nil && ctx.Err() == nil {
+				s.dropped.Add(1)
+				s.logger.Warn("failed to deliver webhook event", "run_id", event.RunID, "event_id", event.EventID, "type", event.Type, "error", err)
+			}
+		}
+	}
+}
+
+// send tries an event up to MaxAttempts times, backing off between tries.
+// Network errors, 429 and 5xx answers are retried; other answers are final.
+func (s *Sink) send(ctx context.Context, event domain.Event) error {
+	body, err := json.Marshal(event)
+	if err != nil {
+		return fmt.Errorf("failed to marshal event: %w", err)
+	}
+
+	backoff := s.cfg.Backoff
+	for attempt := 1; ; attempt++ {
+		retry, err := s.post(ctx, event, body)
+		if err == nil {
+			return nil
+		}
+		if !retry || attempt >= s.cfg.MaxAttempts {
+			return fmt.Errorf("attempt %d: %w", attempt, err)
+		}
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(backoff):
+		}
+		backoff *= 2
+	}
+}
+
+// post makes one delivery attempt and reports whether a failure is worth
+// retrying.
+func (s *Sink) post(ctx context.Context, event domain.Event, body []byte) (bool, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, s.cfg.URL, bytes.NewReader(body))
+	if err != nil {
+		return false, fmt.Errorf("failed to create request: %w", err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set(HeaderEventID, event.EventID)
+	req.Header.Set(HeaderEventType, string(event.Type))
+	req.Header.Set(HeaderSignature, Sign(s.cfg.Secret, body))
+
+	resp, err := s.client.Do(req)
+	if err != nil {
+		return true, err
+	}
+	defer resp.Body.Close()
+	io.Copy(io.Discard, io.LimitReader(resp.Body, 4096))
+	if resp.StatusCode >= 200 && resp.StatusCode <= 299 {
+		return false, nil
+	}
+	retry := resp.StatusCode == http.StatusTooManyRequests || resp.StatusCode >= 500
+	return retry, fmt.Errorf("webhook answered %d", resp.StatusCode)
+}
+
+// Sign returns the X-Gogo-Signature value for body: "sha256=" followed by
+// the hex HMAC-SHA256 of body keyed with secret.
+func Sign(secret string, body []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write(body)
+	return "sha256=" + hex.EncodeToString(mac.Sum(nil))
+}
@@ -0,0 +1,72 @@
+package webhook
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/xiaot623/gogo/orchestrator/internal/domain"
+)
+
+func TestSinkRetriesAndSigns(t *testing.T) {
+	var attempts atomic.Int32
+	received := make(chan domain.Event, 1)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		if got := r.Header.Get(HeaderSignature); got != Sign("secret", body) {
+			t.Errorf("signature = %q, want %q", got, Sign("secret", body))
+		}
+		if attempts.Add(1) == 1 {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		var event domain.Event
+		if err := json.Unmarshal(body, &event); err != nil {
+			t.Errorf("Unmarshal: %v", err)
+		}
+		received <- event
+	}))
+	defer srv.Close()
+
+	sink := New(Config{URL: srv.URL, Secret: "secret", Timeout: time.Second, MaxAttempts: 3, Backoff: time.Millisecond, QueueSize: 1}, nil)
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go sink.Run(ctx)
+
+	sink.Deliver(domain.Event{EventID: "evt_1", RunID: "run_1", Type: domain.EventTypeRunDone})
+	select {
+	case event := <-received:
+		if event.EventID != "evt_1" || event.Type != domain.EventTypeRunDone {
+			t.Fatalf("unexpected event %+v", event)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("event was not delivered")
+	}
+	if n := attempts.Load(); n != 2 {
+		t.Fatalf("expected 2 attempts, got %d", n)
+	}
+}
+
+func TestSinkDeliverNeverBlocks(t *testing.T) {
+	// Without Run nothing drains the queue, so the second event is dropped.
+	sink := New(Config{URL: "http://127.0.0.1:0", MaxAttempts: 1, QueueSize: 1}, nil)
+	done := make(chan struct{})
+	go func() {
+		sink.Deliver(domain.Event{EventID: "evt_1"})
+		sink.Deliver(domain.Event{EventID: "evt_2"})
+		close(done)
+	}()
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		t.Fatal("Deliver blocked on a full queue")
+	}
+	if n := sink.Dropped(); n != 1 {
+		t.Fatalf("expected 1 dropped event, got %d", n)
+	}
+}
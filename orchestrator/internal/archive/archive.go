@@ -0,0 +1,96 @@
+// Package archive stores archived runs outside the primary database.
+package archive
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// ErrNotFound is returned by Get when nothing is stored at a location.
+var ErrNotFound = errors.New("archive not found")
+
+// Archiver writes and reads archive blobs. The location returned by Put is
+// opaque to callers; it is recorded on the run tombstone and passed back to
+// Get to read the blob.
+type Archiver interface {
+	Put(ctx context.Context, key string, data []byte) (location string, err error)
+	Get(ctx context.Context, location string) ([]byte, error)
+}
+
+// Dir is an Archiver that stores each blob as a file in a local directory.
+// Locations are file:// URLs.
+type Dir struct {
+	root string
+}
+
+// NewDir returns an Archiver writing to root, creating it if needed.
+func NewDir(root string) (*Dir, error) {
+	abs, err := filepath.Abs(root)
+	if err != nil {
+		return nil, fmt.Errorf("failed to resolve archive dir: %w", err)
+	}
+	if err := os.MkdirAll(abs, 0o755); err != nil {
+		return nil, fmt.Errorf("failed to create archive dir: %w", err)
+	}
+	return &Dir{root: abs}, nil
+}
+
+// Ensure Dir implements Archiver interface.
+var _ Archiver = (*Dir)(nil)
+
+// Put writes data to <root>/<key>. The file is written under a temporary name
+// and renamed into place, so a crash never leaves a partial archive behind.
+func (d *Dir) Put(ctx context.Context, key string, data []byte) (string, error) {
+	if key == "" || key != filepath.Base(key) {
+		return "", fmt.Errorf("invalid archive key %q", key)
+	}
+	path := filepath.Join(d.root, key)
+
+	tmp, err := os.CreateTemp(d.root, "."+key+".tmp*")
+	if err != nil {
+		return "", fmt.Errorf("failed to create archive file: %w", err)
+	}
+	defer os.Remove(tmp.Name())
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		return "", fmt.Errorf("failed to write archive file: %w", err)
+	}
+	if err := tmp.Sync(); err != nil {
+		tmp.Close()
+		return "", fmt.Errorf("failed to sync archive file: %w", err)
+	}
+	if err := tmp.Close(); err != nil {
+		return "", fmt.Errorf("failed to write archive file: %w", err)
+	}
+	if err := os.Rename(tmp.Name(), path); err != nil {
+		return "", fmt.Errorf("failed to move archive file into place: %w", err)
+	}
+	return (&url.URL{Scheme: "file", Path: filepath.ToSlash(path)}).String(), nil
+}
+
+// Get reads the blob at a location returned by Put. Locations outside the
+// archive directory are rejected.
+func (d *Dir) Get(ctx context.Context, location string) ([]byte, error) {
+	u, err := url.Parse(location)
+	if err != nil || u.Scheme != "file" {
+		return nil, fmt.Errorf("unsupported archive location %q", location)
+	}
+	path := filepath.Clean(filepath.FromSlash(u.Path))
+	if rel, err := filepath.Rel(d.root, path); err != nil || rel == "." || strings.HasPrefix(rel, "..") {
+		return nil, fmt.Errorf("archive location %q is outside %s", location, d.root)
+	}
+
+	data, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, ErrNotFound
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read archive file: %w", err)
+	}
+	return data, nil
+}
@@ -0,0 +1,56 @@
+package archive
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestDirPutGet(t *testing.T) {
+	ctx := context.Background()
+	root := t.TempDir()
+	d, err := NewDir(filepath.Join(root, "archive"))
+	if err != nil {
+		t.Fatalf("NewDir: %v", err)
+	}
+
+	loc, err := d.Put(ctx, "run_1.json", []byte(`{"run":{}}`))
+	if err != nil {
+		t.Fatalf("Put: %v", err)
+	}
+	data, err := d.Get(ctx, loc)
+	if err != nil {
+		t.Fatalf("Get: %v", err)
+	}
+	if string(data) != `{"run":{}}` {
+		t.Fatalf("unexpected data: %s", data)
+	}
+
+	// Overwriting a key replaces the blob.
+	if _, err := d.Put(ctx, "run_1.json", []byte(`{}`)); err != nil {
+		t.Fatalf("Put again: %v", err)
+	}
+	if data, _ := d.Get(ctx, loc); string(data) != `{}` {
+		t.Fatalf("expected overwritten data, got %s", data)
+	}
+
+	if _, err := d.Put(ctx, "../escape.json", nil); err == nil {
+		t.Fatal("expected keys with path separators to be rejected")
+	}
+	if _, err := d.Get(ctx, "file://"+filepath.ToSlash(filepath.Join(root, "other.json"))); err == nil || errors.Is(err, ErrNotFound) {
+		t.Fatalf("expected location outside the archive dir to be rejected, got %v", err)
+	}
+	if _, err := d.Get(ctx, "s3://bucket/run_1.json"); err == nil {
+		t.Fatal("expected unsupported scheme to be rejected")
+	}
+
+	missing, _ := d.Put(ctx, "run_2.json", nil)
+	if err := os.Remove(filepath.Join(root, "archive", "run_2.json")); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := d.Get(ctx, missing); !errors.Is(err, ErrNotFound) {
+		t.Fatalf("expected ErrNotFound, got %v", err)
+	}
+}
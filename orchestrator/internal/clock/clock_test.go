@@ -0,0 +1,22 @@
+package clock
+
+import (
+	"testing"
+	"time"
+)
+
+func TestFakeOnlyMovesWhenAdvanced(t *testing.T) {
+	start := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	f := NewFake(start)
+	if !f.Now().Equal(start) {
+		t.Fatalf("expected %v, got %v", start, f.Now())
+	}
+	f.Advance(90 * time.Second)
+	if got := f.Now(); !got.Equal(start.Add(90 * time.Second)) {
+		t.Fatalf("expected start+90s, got %v", got)
+	}
+	f.Set(start)
+	if !f.Now().Equal(start) {
+		t.Fatalf("expected reset to %v, got %v", start, f.Now())
+	}
+}
@@ -2,9 +2,20 @@
 package config
 
 import (
+	"encoding/json"
+	"fmt"
+	"net"
+	"net/url"
 	"os"
+	"path/filepath"
+	"sort"
 	"strconv"
+	"strings"
 	"time"
+
+	"github.com/xiaot623/gogo/orchestrator/internal/domain"
+	"github.com/xiaot623/gogo/orchestrator/internal/idgen"
+	"gopkg.in/yaml.v3"
 )
 
 // Config holds the orchestrator configuration.
@@ -13,8 +24,20 @@ type Config struct {
 	HTTPPort     int
 	InternalPort int
 
-	// Database
-	DatabaseURL string
+	// Bearer tokens accepted by the external API; empty disables
+	// authentication. Requests to AuthPublicPaths never need a token.
+	APIKeys         []string
+	AuthPublicPaths []string
+
+	// Database. ReadDatabaseURL, when set, serves the heavy read queries
+	// (events, messages, run lists) so they can go to a read replica; those
+	// reads may briefly lag writes made through DatabaseURL.
+	DatabaseURL     string
+	ReadDatabaseURL string
+
+	// IDNamespace, when set, goes into every generated ID after its type
+	// prefix (run_stg_...), so IDs from different environments never clash.
+	IDNamespace string
 
 	// Ingress settings (RPC address)
 	IngressRPCAddr string
@@ -28,51 +51,814 @@ type Config struct {
 	ToolTimeout     time.Duration
 	ApprovalTimeout time.Duration
 	LLMTimeout      time.Duration
+	// MaxRunDuration caps a run's total wall-clock time across agent turns
+	// and tool calls (0 = no cap); an invoke's max_duration_ms may shorten it.
+	MaxRunDuration time.Duration
+
+	// Connections to agents: dial, TCP keepalive, TLS handshake and response
+	// header timeouts, and the idle pool. Agent streams themselves are only
+	// bounded by AgentTimeout.
+	AgentDialTimeout           time.Duration
+	AgentKeepAlive             time.Duration
+	AgentTLSHandshakeTimeout   time.Duration
+	AgentResponseHeaderTimeout time.Duration
+	AgentIdleConnTimeout       time.Duration
+	AgentMaxIdleConnsPerHost   int
+	// Registrations with verify probe the agent for at most AgentProbeTimeout.
+	AgentProbeTimeout time.Duration
+	// Agent streams are read through AgentReadBufferBytes at a time; a
+	// streamed event larger than AgentMaxFrameBytes fails the run with
+	// agent_frame_too_large (0 = no cap).
+	AgentReadBufferBytes int
+	AgentMaxFrameBytes   int
+
+	// Interval at which streaming chat completions proxied to clients get an
+	// SSE keepalive comment (0 disables keepalives).
+	LLMStreamKeepalive time.Duration
+
+	// After LLMBreakerFailures consecutive LiteLLM failures, LLM requests
+	// fail fast for LLMBreakerCooldown before a probe is let through
+	// (0 failures disables the breaker).
+	LLMBreakerFailures int
+	LLMBreakerCooldown time.Duration
+
+	// Generation params of proxied chat completions. A request without
+	// temperature, max_tokens or top_p gets the LLMDefault* value (nil or 0
+	// leaves it unset); temperature and max_tokens above LLMMaxTemperature /
+	// LLMMaxTokensLimit (0 = unlimited) are handled per LLMParamOverflow.
+	LLMDefaultTemperature *float64
+	LLMMaxTemperature     float64
+	LLMDefaultMaxTokens   int
+	LLMMaxTokensLimit     int
+	LLMDefaultTopP        *float64
+	// LLMParamOverflow is "clamp" or "reject".
+	LLMParamOverflow string
+
+	// Models of proxied chat completions. A request naming an alias in
+	// LLMModelAliases is forwarded with the aliased model; one with no model
+	// or "default" gets LLMDefaultModel (empty leaves it as sent).
+	// LLMListModelAliases adds the aliases to the /v1/models listing.
+	LLMDefaultModel     string
+	LLMModelAliases     map[string]string
+	LLMListModelAliases bool
+
+	// Agent used when an invoke request omits agent_id. With
+	// AgentFallbackToDefault, runs for a missing or unhealthy agent are routed
+	// to it as well.
+	DefaultAgentID         string
+	AgentFallbackToDefault bool
+	// MaxHistoryMessages is how many recent session messages are sent to the
+	// agent with each invoke unless the request sets max_history (0 = none,
+	// -1 = all).
+	MaxHistoryMessages int
+	// MaxHistoryTokens further drops the oldest of those messages until the
+	// rest fit this many tokens; the input is always sent (0 = no budget).
+	MaxHistoryTokens int
+	// InvokeWaitMax caps how long an invoke with wait=true blocks for its
+	// run to finish.
+	InvokeWaitMax time.Duration
+	// An agent is marked unhealthy after AgentUnhealthyAfterFailures
+	// consecutive failed invocations (0 = never); a success or
+	// re-registration marks it healthy again.
+	AgentUnhealthyAfterFailures int
+
+	// agent_stream_delta events are written in batches of up to
+	// EventBatchSize or every EventBatchInterval, whichever comes first
+	// (size <= 1 disables). While ingress is behind on a session, the pushes
+	// of consecutive batches are merged.
+	EventBatchSize     int
+	EventBatchInterval time.Duration
+
+	// At most MaxAgentStreams agent streams run concurrently (0 = unlimited);
+	// up to AgentStreamQueueDepth further invokes wait for a slot and the rest
+	// are rejected.
+	MaxAgentStreams       int
+	AgentStreamQueueDepth int
+
+	// CaptureReasoning records and forwards agents' reasoning events; when
+	// false they are discarded.
+	CaptureReasoning bool
+
+	// ReadOnly starts the orchestrator in maintenance mode: new invokes, tool
+	// invocations and registrations are refused while reads and in-flight
+	// runs go on. It backs the read_only feature flag.
+	ReadOnly bool
+
+	// Tool requests whose serialized args exceed this many bytes are pushed
+	// to ingress as ordered tool_request_chunk messages (0 disables chunking).
+	// Off by default: only enable it when every client reassembles chunks.
+	ToolRequestChunkBytes int
+
+	// A run may have at most MaxConcurrentToolCalls tool calls that have not
+	// finished; further invokes are rejected with too_many_tool_calls (0 = no
+	// cap). An agent's max_concurrent_tool_calls overrides it.
+	MaxConcurrentToolCalls int
+
+	// Client tool results larger than this many bytes are rejected or
+	// truncated according to ToolResultOverflow (0 disables the limit). A
+	// tool's metadata may override it with "max_result_bytes".
+	ToolResultMaxBytes int
+	// ToolResultOverflow is "reject" or "truncate".
+	ToolResultOverflow string
+	// Tool results pushed to ingress carry at most this many bytes of the
+	// result as a text preview.
+	ToolResultPreviewBytes int
+	// A client tool call accepts at most this many tool_progress chunks
+	// (0 = unlimited).
+	ToolProgressMaxChunks int
+
+	// ModerationEnabled screens user input before a run invokes its agent
+	// and the agent's final message before it is saved; ModerateDeltas also
+	// screens each streamed delta. Blocked content fails the run with
+	// content_blocked.
+	ModerationEnabled bool
+	ModerateDeltas    bool
+
+	// A run that is cancelled or fails mid-stream saves the answer text
+	// streamed so far as a partial assistant message, keeping at most
+	// PartialOutputMaxBytes of it (0 disables saving partial output).
+	PartialOutputMaxBytes int
+
+	// A run whose agent stream has recorded no event for RunHeartbeatInterval
+	// gets a run_heartbeat push (0 disables heartbeats).
+	RunHeartbeatInterval time.Duration
+
+	// An approval the user asked to remember auto-approves the same tool for
+	// ApprovalMemoryTTL (0 = approvals are never remembered).
+	ApprovalMemoryTTL time.Duration
+
+	// A tool result or approval decision submitted with a nonce replays its
+	// first response for NonceTTL (0 = nonces are ignored).
+	NonceTTL time.Duration
+
+	// Events pushed to ingress wait on a per-session queue of at most
+	// IngressQueueSize events, so a slow ingress does not hold up agent
+	// streams (0 pushes inline).
+	IngressQueueSize int
+
+	// Recorded run events of EventWebhookEventTypes (all types when empty)
+	// are POSTed to EventWebhookURL, signed with EventWebhookSecret, from a
+	// queue of at most EventWebhookQueueSize events; a failed delivery is
+	// tried up to EventWebhookMaxAttempts times, waiting
+	// EventWebhookRetryBackoff before the first retry and doubling it after.
+	// An empty URL disables the webhook.
+	EventWebhookURL          string
+	EventWebhookSecret       string
+	EventWebhookEventTypes   []string
+	EventWebhookTimeout      time.Duration
+	EventWebhookMaxAttempts  int
+	EventWebhookRetryBackoff time.Duration
+	EventWebhookQueueSize    int
+
+	// CancelRunsOnDisconnect cancels a session's unfinished runs when ingress
+	// reports its last connection gone; when false they continue headless
+	// and their events are no longer pushed to ingress.
+	CancelRunsOnDisconnect bool
+
+	// EventAckTTL is how long the position a client device acknowledged in a
+	// run is kept after its last ack.
+	EventAckTTL time.Duration
 
-	// Logging
-	LogLevel string
+	// RunSummaryPush pushes each run's run_summary event to its session as
+	// well; it is always recorded.
+	RunSummaryPush bool
+
+	// FeatureFlags overrides the initial value of named feature flags; see
+	// Flags.
+	FeatureFlags map[string]bool
+
+	// PolicyFailMode decides a tool call whose policy evaluation errors:
+	// "closed" blocks it, "open" allows it.
+	PolicyFailMode string
+
+	// Terminal runs that ended more than RunArchiveAfter ago are moved to
+	// RunArchiveDir, checked every RunArchiveInterval (0 disables archival).
+	RunArchiveAfter    time.Duration
+	RunArchiveDir      string
+	RunArchiveInterval time.Duration
+
+	// OTLP/HTTP trace collector URL; tracing is a no-op when empty.
+	OTelEndpoint string
+
+	// Logging: LogLevel is debug, info, warn or error; LogFormat is text or
+	// json.
+	LogLevel  string
+	LogFormat string
+
+	// Agents registered (or updated) on startup, so a fresh deployment can
+	// serve invokes without calling the register API first.
+	BootstrapAgents []BootstrapAgent
 }
 
+// BootstrapAgent is an agent definition from BOOTSTRAP_AGENTS. Fields match
+// the POST /v1/agents/register request body.
+type BootstrapAgent struct {
+	AgentID        string            `json:"agent_id"`
+	Name           string            `json:"name"`
+	Endpoint       string            `json:"endpoint"`
+	Capabilities   []string          `json:"capabilities,omitempty"`
+	Headers        map[string]string `json:"headers,omitempty"`
+	Protocol       string            `json:"protocol,omitempty"`
+	ResponseFormat string            `json:"response_format,omitempty"`
+	CancelURL      string            `json:"cancel_url,omitempty"`
+	// MaxConcurrentToolCalls overrides MAX_CONCURRENT_TOOL_CALLS for the
+	// agent's runs (0 = keep it, -1 = no cap).
+	MaxConcurrentToolCalls int `json:"max_concurrent_tool_calls,omitempty"`
+	// RequestFilter limits the invoke context and history the agent is sent.
+	RequestFilter *domain.AgentRequestFilter `json:"request_filter,omitempty"`
+	// LLM configures a built-in agent (protocol llm_tools), which needs no
+	// endpoint.
+	LLM *domain.LLMAgentConfig `json:"llm,omitempty"`
+}
+
+// Values for LLMParamOverflow.
+const (
+	LLMParamOverflowClamp  = "clamp"
+	LLMParamOverflowReject = "reject"
+)
+
+// Values for ToolResultOverflow.
+const (
+	ToolResultOverflowReject   = "reject"
+	ToolResultOverflowTruncate = "truncate"
+)
+
+// Values for PolicyFailMode.
+const (
+	PolicyFailClosed = "closed"
+	PolicyFailOpen   = "open"
+)
+
 // Load loads configuration from environment variables.
 func Load() *Config {
-	cfg := &Config{
-		HTTPPort:        getEnvInt("HTTP_PORT", 8080),
-		InternalPort:    getEnvInt("INTERNAL_PORT", 8081),
-		DatabaseURL:     getEnv("DATABASE_URL", "file:orchestrator.db?cache=shared&mode=rwc"),
-		IngressRPCAddr:  getEnvWithFallback("INGRESS_RPC_ADDR", "INGRESS_URL", "localhost:8091"),
-		LiteLLMURL:      getEnv("LITELLM_URL", "http://localhost:4000"),
-		LiteLLMAPIKey:   getEnv("LITELLM_API_KEY", ""),
-		AgentTimeout:    time.Duration(getEnvInt("AGENT_TIMEOUT_MS", 300000)) * time.Millisecond,
-		ToolTimeout:     time.Duration(getEnvInt("TOOL_TIMEOUT_MS", 60000)) * time.Millisecond,
-		ApprovalTimeout: time.Duration(getEnvInt("APPROVAL_TIMEOUT_MS", 600000)) * time.Millisecond,
-		LLMTimeout:      time.Duration(getEnvInt("LLM_TIMEOUT_MS", 120000)) * time.Millisecond,
-		LogLevel:        getEnv("LOG_LEVEL", "info"),
-	}
-	return cfg
-}
-
-func getEnvWithFallback(primary, fallback, defaultVal string) string {
-	if val := os.Getenv(primary); val != "" {
-		return val
+	return newLoader(nil).load()
+}
+
+// LoadFile loads configuration from an optional YAML or JSON file, overlays
+// environment variables on top of it, and validates the result.
+//
+// File keys use the same names as the environment variables, case-insensitively
+// (e.g. "http_port: 9000" or {"AGENT_TIMEOUT_MS": 1000}). With an empty path
+// only environment variables are read, and they are checked just as strictly:
+// malformed values are reported rather than replaced by defaults.
+func LoadFile(path string) (*Config, error) {
+	var file map[string]interface{}
+	if path != "" {
+		data, err := os.ReadFile(path)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read config file: %w", err)
+		}
+		// JSON is valid YAML, so one decoder handles both formats.
+		if err := yaml.Unmarshal(data, &file); err != nil {
+			return nil, fmt.Errorf("failed to parse config file %s: %w", filepath.Base(path), err)
+		}
+	}
+
+	l := newLoader(file)
+	cfg := l.load()
+
+	problems := append(l.problems, l.unknownKeys()...)
+	problems = append(problems, cfg.problems()...)
+	if len(problems) > 0 {
+		return nil, &ValidationError{Problems: problems}
+	}
+	return cfg, nil
+}
+
+// ValidationError lists every problem found in a configuration.
+type ValidationError struct {
+	Problems []string
+}
+
+func (e *ValidationError) Error() string {
+	return "invalid configuration:\n  - " + strings.Join(e.Problems, "\n  - ")
+}
+
+// Validate checks the configuration for obviously invalid values.
+func (c *Config) Validate() error {
+	if problems := c.problems(); len(problems) > 0 {
+		return &ValidationError{Problems: problems}
+	}
+	return nil
+}
+
+func (c *Config) problems() []string {
+	var problems []string
+
+	checkPort := func(name string, port int) {
+		if port <= 0 || port > 65535 {
+			problems = append(problems, fmt.Sprintf("%s must be between 1 and 65535, got %d", name, port))
+		}
+	}
+	checkPort("HTTP_PORT", c.HTTPPort)
+	checkPort("INTERNAL_PORT", c.InternalPort)
+	if c.HTTPPort == c.InternalPort && c.HTTPPort != 0 {
+		problems = append(problems, "HTTP_PORT and INTERNAL_PORT must differ")
+	}
+
+	for _, p := range c.AuthPublicPaths {
+		if !strings.HasPrefix(p, "/") {
+			problems = append(problems, fmt.Sprintf("AUTH_PUBLIC_PATHS entries must start with /, got %q", p))
+		}
+	}
+
+	if c.DatabaseURL == "" {
+		problems = append(problems, "DATABASE_URL is required")
+	}
+	if c.IDNamespace != "" && !idgen.ValidNamespace(c.IDNamespace) {
+		problems = append(problems, fmt.Sprintf("ID_NAMESPACE must be 1-%d lowercase letters, digits or dashes, got %q", idgen.MaxNamespaceLen, c.IDNamespace))
+	}
+	if c.IngressRPCAddr != "" && !validAddr(c.IngressRPCAddr) {
+		problems = append(problems, fmt.Sprintf("INGRESS_RPC_ADDR must be host:port or a URL, got %q", c.IngressRPCAddr))
+	}
+	if u, err := url.Parse(c.LiteLLMURL); err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		problems = append(problems, fmt.Sprintf("LITELLM_URL must be an http(s) URL, got %q", c.LiteLLMURL))
+	}
+
+	checkTimeout := func(name string, d time.Duration) {
+		if d <= 0 {
+			problems = append(problems, fmt.Sprintf("%s must be positive", name))
+		}
+	}
+	checkTimeout("AGENT_TIMEOUT_MS", c.AgentTimeout)
+	if c.MaxRunDuration < 0 {
+		problems = append(problems, "MAX_RUN_DURATION_MS must not be negative")
+	}
+	checkTimeout("AGENT_DIAL_TIMEOUT_MS", c.AgentDialTimeout)
+	checkTimeout("AGENT_KEEPALIVE_MS", c.AgentKeepAlive)
+	checkTimeout("AGENT_TLS_HANDSHAKE_TIMEOUT_MS", c.AgentTLSHandshakeTimeout)
+	checkTimeout("AGENT_RESPONSE_HEADER_TIMEOUT_MS", c.AgentResponseHeaderTimeout)
+	checkTimeout("AGENT_IDLE_CONN_TIMEOUT_MS", c.AgentIdleConnTimeout)
+	if c.AgentMaxIdleConnsPerHost <= 0 {
+		problems = append(problems, "AGENT_MAX_IDLE_CONNS_PER_HOST must be positive")
+	}
+	checkTimeout("AGENT_PROBE_TIMEOUT_MS", c.AgentProbeTimeout)
+	if c.AgentReadBufferBytes <= 0 {
+		problems = append(problems, "AGENT_READ_BUFFER_BYTES must be positive")
+	}
+	if c.AgentMaxFrameBytes < 0 {
+		problems = append(problems, "AGENT_MAX_FRAME_BYTES must not be negative")
+	}
+	checkTimeout("TOOL_TIMEOUT_MS", c.ToolTimeout)
+	checkTimeout("APPROVAL_TIMEOUT_MS", c.ApprovalTimeout)
+	checkTimeout("LLM_TIMEOUT_MS", c.LLMTimeout)
+	checkTimeout("INVOKE_WAIT_MAX_MS", c.InvokeWaitMax)
+
+	if c.AgentFallbackToDefault && c.DefaultAgentID == "" {
+		problems = append(problems, "AGENT_FALLBACK_TO_DEFAULT requires DEFAULT_AGENT_ID")
+	}
+	if c.MaxHistoryMessages < -1 {
+		problems = append(problems, "MAX_HISTORY_MESSAGES must be -1 (all), 0 (none) or positive")
+	}
+	if c.MaxHistoryTokens < 0 {
+		problems = append(problems, "MAX_HISTORY_TOKENS must not be negative")
+	}
+	if c.AgentUnhealthyAfterFailures < 0 {
+		problems = append(problems, "AGENT_UNHEALTHY_AFTER_FAILURES must not be negative")
+	}
+	if c.EventBatchSize > 1 && c.EventBatchInterval <= 0 {
+		problems = append(problems, "EVENT_BATCH_INTERVAL_MS must be positive when EVENT_BATCH_SIZE > 1")
+	}
+	if c.MaxAgentStreams < 0 {
+		problems = append(problems, "MAX_AGENT_STREAMS must not be negative")
+	}
+	if c.AgentStreamQueueDepth < 0 {
+		problems = append(problems, "AGENT_STREAM_QUEUE_DEPTH must not be negative")
+	}
+	if c.LLMStreamKeepalive < 0 {
+		problems = append(problems, "LLM_STREAM_KEEPALIVE_MS must not be negative")
+	}
+	if c.LLMBreakerFailures < 0 {
+		problems = append(problems, "LLM_BREAKER_FAILURES must not be negative")
+	}
+	if c.LLMBreakerFailures > 0 && c.LLMBreakerCooldown <= 0 {
+		problems = append(problems, "LLM_BREAKER_COOLDOWN_MS must be positive when LLM_BREAKER_FAILURES > 0")
+	}
+	if c.LLMMaxTemperature < 0 {
+		problems = append(problems, "LLM_MAX_TEMPERATURE must not be negative")
+	}
+	if c.LLMMaxTokensLimit < 0 {
+		problems = append(problems, "LLM_MAX_TOKENS_LIMIT must not be negative")
+	}
+	if c.LLMDefaultMaxTokens < 0 {
+		problems = append(problems, "LLM_DEFAULT_MAX_TOKENS must not be negative")
+	}
+	if t := c.LLMDefaultTemperature; t != nil && (*t < 0 || (c.LLMMaxTemperature > 0 && *t > c.LLMMaxTemperature)) {
+		problems = append(problems, fmt.Sprintf("LLM_DEFAULT_TEMPERATURE must be between 0 and LLM_MAX_TEMPERATURE, got %v", *t))
+	}
+	if c.LLMMaxTokensLimit > 0 && c.LLMDefaultMaxTokens > c.LLMMaxTokensLimit {
+		problems = append(problems, "LLM_DEFAULT_MAX_TOKENS must not exceed LLM_MAX_TOKENS_LIMIT")
+	}
+	if p := c.LLMDefaultTopP; p != nil && (*p < 0 || *p > 1) {
+		problems = append(problems, fmt.Sprintf("LLM_DEFAULT_TOP_P must be between 0 and 1, got %v", *p))
+	}
+	switch c.LLMParamOverflow {
+	case LLMParamOverflowClamp, LLMParamOverflowReject:
+	default:
+		problems = append(problems, fmt.Sprintf("LLM_PARAM_OVERFLOW must be clamp or reject, got %q", c.LLMParamOverflow))
+	}
+	for alias, model := range c.LLMModelAliases {
+		if alias == "" || model == "" {
+			problems = append(problems, fmt.Sprintf("LLM_MODEL_ALIASES entries need an alias and a model, got %q=%q", alias, model))
+		}
+	}
+	if c.ToolRequestChunkBytes < 0 {
+		problems = append(problems, "TOOL_REQUEST_CHUNK_BYTES must not be negative")
+	}
+	if c.RunHeartbeatInterval < 0 {
+		problems = append(problems, "RUN_HEARTBEAT_INTERVAL_MS must not be negative")
+	}
+	if c.ApprovalMemoryTTL < 0 {
+		problems = append(problems, "APPROVAL_MEMORY_TTL_MS must not be negative")
 	}
-	if val := os.Getenv(fallback); val != "" {
+	if c.NonceTTL < 0 {
+		problems = append(problems, "NONCE_TTL_MS must not be negative")
+	}
+	if c.IngressQueueSize < 0 {
+		problems = append(problems, "INGRESS_QUEUE_SIZE must not be negative")
+	}
+	if c.MaxConcurrentToolCalls < 0 {
+		problems = append(problems, "MAX_CONCURRENT_TOOL_CALLS must not be negative")
+	}
+	if c.ToolResultMaxBytes < 0 {
+		problems = append(problems, "TOOL_RESULT_MAX_BYTES must not be negative")
+	}
+	switch c.ToolResultOverflow {
+	case ToolResultOverflowReject, ToolResultOverflowTruncate:
+	default:
+		problems = append(problems, fmt.Sprintf("TOOL_RESULT_OVERFLOW must be reject or truncate, got %q", c.ToolResultOverflow))
+	}
+	for name := range c.FeatureFlags {
+		if !KnownFlag(name) {
+			problems = append(problems, fmt.Sprintf("FEATURE_FLAGS: unknown flag %q", name))
+		}
+	}
+	switch c.PolicyFailMode {
+	case PolicyFailClosed, PolicyFailOpen:
+	default:
+		problems = append(problems, fmt.Sprintf("POLICY_FAIL_MODE must be closed or open, got %q", c.PolicyFailMode))
+	}
+	if c.ToolResultPreviewBytes <= 0 {
+		problems = append(problems, "TOOL_RESULT_PREVIEW_BYTES must be positive")
+	}
+	if c.ModerateDeltas && !c.ModerationEnabled {
+		problems = append(problems, "MODERATE_DELTAS requires MODERATION_ENABLED")
+	}
+	if c.PartialOutputMaxBytes < 0 {
+		problems = append(problems, "PARTIAL_OUTPUT_MAX_BYTES must not be negative")
+	}
+	if c.ToolProgressMaxChunks < 0 {
+		problems = append(problems, "TOOL_PROGRESS_MAX_CHUNKS must not be negative")
+	}
+	if c.RunArchiveAfter < 0 {
+		problems = append(problems, "RUN_ARCHIVE_AFTER_MS must not be negative")
+	}
+	if c.RunArchiveAfter > 0 {
+		if c.RunArchiveDir == "" {
+			problems = append(problems, "RUN_ARCHIVE_DIR is required when RUN_ARCHIVE_AFTER_MS > 0")
+		}
+		if c.RunArchiveInterval <= 0 {
+			problems = append(problems, "RUN_ARCHIVE_INTERVAL_MS must be positive when RUN_ARCHIVE_AFTER_MS > 0")
+		}
+	}
+	if c.EventWebhookURL != "" {
+		if u, err := url.Parse(c.EventWebhookURL); err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+			problems = append(problems, fmt.Sprintf("EVENT_WEBHOOK_URL must be an http(s) URL, got %q", c.EventWebhookURL))
+		}
+		if c.EventWebhookSecret == "" {
+			problems = append(problems, "EVENT_WEBHOOK_SECRET is required when EVENT_WEBHOOK_URL is set")
+		}
+		for _, t := range c.EventWebhookEventTypes {
+			if !domain.EventType(t).Known() {
+				problems = append(problems, fmt.Sprintf("EVENT_WEBHOOK_EVENT_TYPES: unknown event type %q", t))
+			}
+		}
+		if c.EventWebhookTimeout <= 0 {
+			problems = append(problems, "EVENT_WEBHOOK_TIMEOUT_MS must be positive")
+		}
+		if c.EventWebhookMaxAttempts < 1 {
+			problems = append(problems, "EVENT_WEBHOOK_MAX_ATTEMPTS must be at least 1")
+		}
+		if c.EventWebhookRetryBackoff < 0 {
+			problems = append(problems, "EVENT_WEBHOOK_RETRY_BACKOFF_MS must not be negative")
+		}
+		if c.EventWebhookQueueSize <= 0 {
+			problems = append(problems, "EVENT_WEBHOOK_QUEUE_SIZE must be positive")
+		}
+	}
+	if c.OTelEndpoint != "" {
+		if u, err := url.Parse(c.OTelEndpoint); err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+			problems = append(problems, fmt.Sprintf("OTEL_EXPORTER_OTLP_ENDPOINT must be an http(s) URL, got %q", c.OTelEndpoint))
+		}
+	}
+
+	seen := make(map[string]bool, len(c.BootstrapAgents))
+	for i, a := range c.BootstrapAgents {
+		switch {
+		case a.AgentID == "":
+			problems = append(problems, fmt.Sprintf("BOOTSTRAP_AGENTS[%d]: agent_id is required", i))
+		case seen[a.AgentID]:
+			problems = append(problems, fmt.Sprintf("BOOTSTRAP_AGENTS[%d]: duplicate agent_id %q", i, a.AgentID))
+		}
+		seen[a.AgentID] = true
+		if domain.AgentProtocol(a.Protocol).Builtin() {
+			if err := a.LLM.Validate(); err != nil {
+				problems = append(problems, fmt.Sprintf("BOOTSTRAP_AGENTS[%d]: %v", i, err))
+			}
+		} else if u, err := url.Parse(a.Endpoint); err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+			problems = append(problems, fmt.Sprintf("BOOTSTRAP_AGENTS[%d]: endpoint must be an http(s) URL, got %q", i, a.Endpoint))
+		}
+		if !domain.AgentProtocol(a.Protocol).Valid() {
+			problems = append(problems, fmt.Sprintf("BOOTSTRAP_AGENTS[%d]: unknown protocol %q", i, a.Protocol))
+		}
+		if !domain.AgentResponseFormat(a.ResponseFormat).Valid() {
+			problems = append(problems, fmt.Sprintf("BOOTSTRAP_AGENTS[%d]: unknown response_format %q", i, a.ResponseFormat))
+		}
+		if a.CancelURL != "" {
+			if u, err := url.Parse(a.CancelURL); err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+				problems = append(problems, fmt.Sprintf("BOOTSTRAP_AGENTS[%d]: cancel_url must be an http(s) URL, got %q", i, a.CancelURL))
+			}
+		}
+		if a.MaxConcurrentToolCalls < -1 {
+			problems = append(problems, fmt.Sprintf("BOOTSTRAP_AGENTS[%d]: max_concurrent_tool_calls must be -1 (no cap), 0 (global cap) or positive", i))
+		}
+	}
+
+	switch strings.ToLower(c.LogLevel) {
+	case "debug", "info", "warn", "error":
+	default:
+		problems = append(problems, fmt.Sprintf("LOG_LEVEL must be one of debug, info, warn, error, got %q", c.LogLevel))
+	}
+	switch strings.ToLower(c.LogFormat) {
+	case "text", "json":
+	default:
+		problems = append(problems, fmt.Sprintf("LOG_FORMAT must be text or json, got %q", c.LogFormat))
+	}
+
+	return problems
+}
+
+func validAddr(addr string) bool {
+	if strings.Contains(addr, "://") {
+		u, err := url.Parse(addr)
+		return err == nil && u.Host != ""
+	}
+	_, port, err := net.SplitHostPort(addr)
+	return err == nil && port != ""
+}
+
+// loader resolves each setting from the environment first, then the config
+// file, then the built-in default.
+type loader struct {
+	file     map[string]string
+	used     map[string]bool
+	problems []string
+}
+
+func newLoader(file map[string]interface{}) *loader {
+	l := &loader{
+		file: make(map[string]string, len(file)),
+		used: make(map[string]bool),
+	}
+	for k, v := range file {
+		switch v.(type) {
+		case []interface{}, map[string]interface{}:
+			// Structured values (e.g. BOOTSTRAP_AGENTS) are kept as JSON,
+			// the same form they take in the environment.
+			data, err := json.Marshal(v)
+			if err != nil {
+				l.problems = append(l.problems, fmt.Sprintf("%s: %v", strings.ToUpper(k), err))
+				continue
+			}
+			l.file[strings.ToUpper(k)] = string(data)
+		default:
+			l.file[strings.ToUpper(k)] = fmt.Sprint(v)
+		}
+	}
+	return l
+}
+
+func (l *loader) load() *Config {
+	return &Config{
+		HTTPPort:                    l.getInt("HTTP_PORT", 8080),
+		InternalPort:                l.getInt("INTERNAL_PORT", 8081),
+		APIKeys:                     l.getList("API_KEYS", ""),
+		AuthPublicPaths:             l.getList("AUTH_PUBLIC_PATHS", "/health,/ready,/metrics"),
+		DatabaseURL:                 l.get("DATABASE_URL", "file:orchestrator.db?cache=shared&mode=rwc"),
+		ReadDatabaseURL:             l.get("READ_DATABASE_URL", ""),
+		IDNamespace:                 l.get("ID_NAMESPACE", ""),
+		IngressRPCAddr:              l.getWithFallback("INGRESS_RPC_ADDR", "INGRESS_URL", "localhost:8091"),
+		LiteLLMURL:                  l.get("LITELLM_URL", "http://localhost:4000"),
+		LiteLLMAPIKey:               l.get("LITELLM_API_KEY", ""),
+		AgentTimeout:                l.getMillis("AGENT_TIMEOUT_MS", 300000),
+		ToolTimeout:                 l.getMillis("TOOL_TIMEOUT_MS", 60000),
+		ApprovalTimeout:             l.getMillis("APPROVAL_TIMEOUT_MS", 600000),
+		LLMTimeout:                  l.getMillis("LLM_TIMEOUT_MS", 120000),
+		MaxRunDuration:              l.getMillis("MAX_RUN_DURATION_MS", 0),
+		AgentDialTimeout:            l.getMillis("AGENT_DIAL_TIMEOUT_MS", 10000),
+		AgentKeepAlive:              l.getMillis("AGENT_KEEPALIVE_MS", 30000),
+		AgentTLSHandshakeTimeout:    l.getMillis("AGENT_TLS_HANDSHAKE_TIMEOUT_MS", 10000),
+		AgentResponseHeaderTimeout:  l.getMillis("AGENT_RESPONSE_HEADER_TIMEOUT_MS", 60000),
+		AgentIdleConnTimeout:        l.getMillis("AGENT_IDLE_CONN_TIMEOUT_MS", 90000),
+		AgentMaxIdleConnsPerHost:    l.getInt("AGENT_MAX_IDLE_CONNS_PER_HOST", 32),
+		AgentProbeTimeout:           l.getMillis("AGENT_PROBE_TIMEOUT_MS", 3000),
+		AgentReadBufferBytes:        l.getInt("AGENT_READ_BUFFER_BYTES", 65536),
+		AgentMaxFrameBytes:          l.getInt("AGENT_MAX_FRAME_BYTES", 16777216),
+		LLMStreamKeepalive:          l.getMillis("LLM_STREAM_KEEPALIVE_MS", 15000),
+		LLMBreakerFailures:          l.getInt("LLM_BREAKER_FAILURES", 5),
+		LLMBreakerCooldown:          l.getMillis("LLM_BREAKER_COOLDOWN_MS", 30000),
+		LLMDefaultTemperature:       l.getOptionalFloat("LLM_DEFAULT_TEMPERATURE"),
+		LLMMaxTemperature:           l.getFloat("LLM_MAX_TEMPERATURE", 0),
+		LLMDefaultMaxTokens:         l.getInt("LLM_DEFAULT_MAX_TOKENS", 0),
+		LLMMaxTokensLimit:           l.getInt("LLM_MAX_TOKENS_LIMIT", 0),
+		LLMDefaultTopP:              l.getOptionalFloat("LLM_DEFAULT_TOP_P"),
+		LLMParamOverflow:            strings.ToLower(l.get("LLM_PARAM_OVERFLOW", LLMParamOverflowClamp)),
+		LLMDefaultModel:             l.get("LLM_DEFAULT_MODEL", ""),
+		LLMModelAliases:             l.getStringMap("LLM_MODEL_ALIASES"),
+		LLMListModelAliases:         l.getBool("LLM_LIST_MODEL_ALIASES", true),
+		DefaultAgentID:              l.get("DEFAULT_AGENT_ID", ""),
+		AgentFallbackToDefault:      l.getBool("AGENT_FALLBACK_TO_DEFAULT", false),
+		AgentUnhealthyAfterFailures: l.getInt("AGENT_UNHEALTHY_AFTER_FAILURES", 3),
+		InvokeWaitMax:               l.getMillis("INVOKE_WAIT_MAX_MS", 120000),
+		MaxHistoryMessages:          l.getInt("MAX_HISTORY_MESSAGES", 50),
+		MaxHistoryTokens:            l.getInt("MAX_HISTORY_TOKENS", 0),
+		EventBatchSize:              l.getInt("EVENT_BATCH_SIZE", 32),
+		EventBatchInterval:          l.getMillis("EVENT_BATCH_INTERVAL_MS", 50),
+		CaptureReasoning:            l.getBool("CAPTURE_REASONING", true),
+		ReadOnly:                    l.getBool("READ_ONLY", false),
+		MaxAgentStreams:             l.getInt("MAX_AGENT_STREAMS", 256),
+		AgentStreamQueueDepth:       l.getInt("AGENT_STREAM_QUEUE_DEPTH", 1024),
+		ToolRequestChunkBytes:       l.getInt("TOOL_REQUEST_CHUNK_BYTES", 0),
+		MaxConcurrentToolCalls:      l.getInt("MAX_CONCURRENT_TOOL_CALLS", 64),
+		ToolResultMaxBytes:          l.getInt("TOOL_RESULT_MAX_BYTES", 1<<20),
+		ToolResultOverflow:          strings.ToLower(l.get("TOOL_RESULT_OVERFLOW", ToolResultOverflowReject)),
+		ToolResultPreviewBytes:      l.getInt("TOOL_RESULT_PREVIEW_BYTES", 1024),
+		ToolProgressMaxChunks:       l.getInt("TOOL_PROGRESS_MAX_CHUNKS", 1000),
+		ModerationEnabled:           l.getBool("MODERATION_ENABLED", false),
+		ModerateDeltas:              l.getBool("MODERATE_DELTAS", false),
+		PartialOutputMaxBytes:       l.getInt("PARTIAL_OUTPUT_MAX_BYTES", 262144),
+		RunHeartbeatInterval:        l.getMillis("RUN_HEARTBEAT_INTERVAL_MS", 15000),
+		ApprovalMemoryTTL:           l.getMillis("APPROVAL_MEMORY_TTL_MS", 86400000),
+		NonceTTL:                    l.getMillis("NONCE_TTL_MS", 86400000),
+		IngressQueueSize:            l.getInt("INGRESS_QUEUE_SIZE", 256),
+		EventWebhookURL:             l.get("EVENT_WEBHOOK_URL", ""),
+		EventWebhookSecret:          l.get("EVENT_WEBHOOK_SECRET", ""),
+		EventWebhookEventTypes:      l.getList("EVENT_WEBHOOK_EVENT_TYPES", ""),
+		EventWebhookTimeout:         l.getMillis("EVENT_WEBHOOK_TIMEOUT_MS", 5000),
+		EventWebhookMaxAttempts:     l.getInt("EVENT_WEBHOOK_MAX_ATTEMPTS", 5),
+		EventWebhookRetryBackoff:    l.getMillis("EVENT_WEBHOOK_RETRY_BACKOFF_MS", 1000),
+		EventWebhookQueueSize:       l.getInt("EVENT_WEBHOOK_QUEUE_SIZE", 1000),
+		CancelRunsOnDisconnect:      l.getBool("CANCEL_RUNS_ON_DISCONNECT", false),
+		RunSummaryPush:              l.getBool("RUN_SUMMARY_PUSH", false),
+		EventAckTTL:                 l.getMillis("EVENT_ACK_TTL_MS", 86400000),
+		FeatureFlags:                l.getFlags("FEATURE_FLAGS"),
+		PolicyFailMode:              strings.ToLower(l.get("POLICY_FAIL_MODE", PolicyFailClosed)),
+		RunArchiveAfter:             l.getMillis("RUN_ARCHIVE_AFTER_MS", 0),
+		RunArchiveDir:               l.get("RUN_ARCHIVE_DIR", "./data/archive"),
+		RunArchiveInterval:          l.getMillis("RUN_ARCHIVE_INTERVAL_MS", 60000),
+		OTelEndpoint:                l.get("OTEL_EXPORTER_OTLP_ENDPOINT", ""),
+		LogLevel:                    l.get("LOG_LEVEL", "info"),
+		LogFormat:                   l.get("LOG_FORMAT", "text"),
+		BootstrapAgents:             l.getBootstrapAgents("BOOTSTRAP_AGENTS"),
+	}
+}
+
+func (l *loader) lookup(key string) (string, bool) {
+	l.used[key] = true
+	if val := os.Getenv(key); val != "" {
+		return val, true
+	}
+	if val, ok := l.file[key]; ok && val != "" {
+		return val, true
+	}
+	return "", false
+}
+
+func (l *loader) get(key, defaultVal string) string {
+	if val, ok := l.lookup(key); ok {
 		return val
 	}
 	return defaultVal
 }
 
-func getEnv(key, defaultVal string) string {
-	if val := os.Getenv(key); val != "" {
+func (l *loader) getWithFallback(primary, fallback, defaultVal string) string {
+	if val, ok := l.lookup(primary); ok {
+		return val
+	}
+	if val, ok := l.lookup(fallback); ok {
 		return val
 	}
 	return defaultVal
 }
 
-func getEnvInt(key string, defaultVal int) int {
-	if val := os.Getenv(key); val != "" {
-		if intVal, err := strconv.Atoi(val); err == nil {
+func (l *loader) getInt(key string, defaultVal int) int {
+	if val, ok := l.lookup(key); ok {
+		intVal, err := strconv.Atoi(val)
+		if err == nil {
 			return intVal
 		}
+		l.problems = append(l.problems, fmt.Sprintf("%s must be an integer, got %q", key, val))
+	}
+	return defaultVal
+}
+
+func (l *loader) getFloat(key string, defaultVal float64) float64 {
+	if v := l.getOptionalFloat(key); v != nil {
+		return *v
+	}
+	return defaultVal
+}
+
+// getOptionalFloat returns nil when key is unset.
+func (l *loader) getOptionalFloat(key string) *float64 {
+	if val, ok := l.lookup(key); ok {
+		floatVal, err := strconv.ParseFloat(val, 64)
+		if err == nil {
+			return &floatVal
+		}
+		l.problems = append(l.problems, fmt.Sprintf("%s must be a number, got %q", key, val))
+	}
+	return nil
+}
+
+func (l *loader) getBool(key string, defaultVal bool) bool {
+	if val, ok := l.lookup(key); ok {
+		boolVal, err := strconv.ParseBool(val)
+		if err == nil {
+			return boolVal
+		}
+		l.problems = append(l.problems, fmt.Sprintf("%s must be a boolean, got %q", key, val))
 	}
 	return defaultVal
 }
+
+// getList splits a comma-separated value, dropping empty entries.
+func (l *loader) getList(key, defaultVal string) []string {
+	var list []string
+	for _, item := range strings.Split(l.get(key, defaultVal), ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			list = append(list, item)
+		}
+	}
+	return list
+}
+
+// getStringMap parses "name=value" pairs separated by commas, or a JSON
+// object of strings as a config file map becomes.
+func (l *loader) getStringMap(key string) map[string]string {
+	val, ok := l.lookup(key)
+	if !ok || strings.TrimSpace(val) == "" {
+		return nil
+	}
+	values := make(map[string]string)
+	if strings.HasPrefix(strings.TrimSpace(val), "{") {
+		if err := json.Unmarshal([]byte(val), &values); err != nil {
+			l.problems = append(l.problems, fmt.Sprintf("%s must map names to strings: %v", key, err))
+			return nil
+		}
+		return values
+	}
+	for _, pair := range strings.Split(val, ",") {
+		if pair = strings.TrimSpace(pair); pair == "" {
+			continue
+		}
+		name, value, found := strings.Cut(pair, "=")
+		if !found {
+			l.problems = append(l.problems, fmt.Sprintf("%s entries must be name=value, got %q", key, pair))
+			continue
+		}
+		values[strings.TrimSpace(name)] = strings.TrimSpace(value)
+	}
+	return values
+}
+
+// getBootstrapAgents parses a JSON array of agent definitions.
+func (l *loader) getBootstrapAgents(key string) []BootstrapAgent {
+	val, ok := l.lookup(key)
+	if !ok {
+		return nil
+	}
+	var agents []BootstrapAgent
+	if err := json.Unmarshal([]byte(val), &agents); err != nil {
+		l.problems = append(l.problems, fmt.Sprintf("%s must be a JSON array of agents: %v", key, err))
+		return nil
+	}
+	return agents
+}
+
+func (l *loader) getMillis(key string, defaultMs int) time.Duration {
+	return time.Duration(l.getInt(key, defaultMs)) * time.Millisecond
+}
+
+// unknownKeys reports config file keys that no setting consumed, which are
+// almost always typos.
+func (l *loader) unknownKeys() []string {
+	var problems []string
+	for key := range l.file {
+		if !l.used[key] {
+			problems = append(problems, fmt.Sprintf("unknown config file key %q", strings.ToLower(key)))
+		}
+	}
+	sort.Strings(problems)
+	return problems
+}
@@ -0,0 +1,175 @@
+package config
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func writeConfigFile(t *testing.T, name, content string) string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), name)
+	if err := os.WriteFile(path, []byte(content), 0o600); err != nil {
+		t.Fatalf("WriteFile failed: %v", err)
+	}
+	return path
+}
+
+func TestLoadFileEnvOverridesFile(t *testing.T) {
+	path := writeConfigFile(t, "config.yaml", "http_port: 9000\nagent_timeout_ms: 1500\nlog_level: debug\n")
+	t.Setenv("HTTP_PORT", "9100")
+
+	cfg, err := LoadFile(path)
+	if err != nil {
+		t.Fatalf("LoadFile failed: %v", err)
+	}
+	if cfg.HTTPPort != 9100 {
+		t.Fatalf("expected env to override file port, got %d", cfg.HTTPPort)
+	}
+	if cfg.AgentTimeout != 1500*time.Millisecond {
+		t.Fatalf("unexpected agent timeout: %v", cfg.AgentTimeout)
+	}
+	if cfg.LogLevel != "debug" || cfg.InternalPort != 8081 {
+		t.Fatalf("unexpected config: %+v", cfg)
+	}
+}
+
+func TestLoadFileJSON(t *testing.T) {
+	path := writeConfigFile(t, "config.json", `{"DATABASE_URL": "file:test.db", "TOOL_REQUEST_CHUNK_BYTES": 4096}`)
+
+	cfg, err := LoadFile(path)
+	if err != nil {
+		t.Fatalf("LoadFile failed: %v", err)
+	}
+	if cfg.DatabaseURL != "file:test.db" || cfg.ToolRequestChunkBytes != 4096 {
+		t.Fatalf("unexpected config: %+v", cfg)
+	}
+}
+
+func TestLoadFileReportsAllProblems(t *testing.T) {
+	path := writeConfigFile(t, "config.yaml", "http_port: 0\nlitellm_url: not-a-url\ntool_timeout_ms: -1\nhttp_prot: 1\n")
+
+	_, err := LoadFile(path)
+	var verr *ValidationError
+	if !errors.As(err, &verr) {
+		t.Fatalf("expected ValidationError, got %v", err)
+	}
+	if len(verr.Problems) != 4 {
+		t.Fatalf("expected 4 problems, got %d: %v", len(verr.Problems), verr.Problems)
+	}
+}
+
+func TestLoadFileBootstrapAgents(t *testing.T) {
+	path := writeConfigFile(t, "config.yaml", `bootstrap_agents:
+  - agent_id: main
+    endpoint: http://agent:8000
+    capabilities: [chat]
+  - agent_id: vllm
+    endpoint: http://vllm:8000/v1
+    protocol: openai_chat
+    headers:
+      Authorization: Bearer x
+`)
+
+	cfg, err := LoadFile(path)
+	if err != nil {
+		t.Fatalf("LoadFile failed: %v", err)
+	}
+	if len(cfg.BootstrapAgents) != 2 {
+		t.Fatalf("expected 2 bootstrap agents, got %+v", cfg.BootstrapAgents)
+	}
+	if a := cfg.BootstrapAgents[0]; a.AgentID != "main" || a.Endpoint != "http://agent:8000" || len(a.Capabilities) != 1 {
+		t.Fatalf("unexpected first agent: %+v", a)
+	}
+	if a := cfg.BootstrapAgents[1]; a.Protocol != "openai_chat" || a.Headers["Authorization"] != "Bearer x" {
+		t.Fatalf("unexpected second agent: %+v", a)
+	}
+
+	t.Setenv("BOOTSTRAP_AGENTS", `[{"agent_id":"main","endpoint":"ftp://x"},{"agent_id":"main","endpoint":"http://a","protocol":"grpc"}]`)
+	_, err = LoadFile(path)
+	var verr *ValidationError
+	if !errors.As(err, &verr) {
+		t.Fatalf("expected ValidationError, got %v", err)
+	}
+	if len(verr.Problems) != 3 {
+		t.Fatalf("expected 3 problems, got %d: %v", len(verr.Problems), verr.Problems)
+	}
+}
+
+func TestLoadWithoutFileUsesDefaults(t *testing.T) {
+	cfg, err := LoadFile("")
+	if err != nil {
+		t.Fatalf("LoadFile failed: %v", err)
+	}
+	if cfg.HTTPPort != 8080 || cfg.ToolTimeout != time.Minute {
+		t.Fatalf("unexpected defaults: %+v", cfg)
+	}
+}
+
+func TestLoadFileIDNamespace(t *testing.T) {
+	t.Setenv("ID_NAMESPACE", "stg")
+	cfg, err := LoadFile("")
+	if err != nil {
+		t.Fatalf("LoadFile failed: %v", err)
+	}
+	if cfg.IDNamespace != "stg" {
+		t.Fatalf("unexpected namespace: %q", cfg.IDNamespace)
+	}
+
+	t.Setenv("ID_NAMESPACE", "stg_eu")
+	var verr *ValidationError
+	if _, err := LoadFile(""); !errors.As(err, &verr) || len(verr.Problems) != 1 {
+		t.Fatalf("expected one ID_NAMESPACE problem, got %v", err)
+	}
+}
+
+func TestLoadFileAPIKeys(t *testing.T) {
+	t.Setenv("API_KEYS", " k1, ,k2 ")
+	cfg, err := LoadFile("")
+	if err != nil {
+		t.Fatalf("LoadFile failed: %v", err)
+	}
+	if len(cfg.APIKeys) != 2 || cfg.APIKeys[0] != "k1" || cfg.APIKeys[1] != "k2" {
+		t.Fatalf("unexpected API keys: %q", cfg.APIKeys)
+	}
+	if len(cfg.AuthPublicPaths) != 3 || cfg.AuthPublicPaths[0] != "/health" {
+		t.Fatalf("unexpected public paths: %q", cfg.AuthPublicPaths)
+	}
+
+	t.Setenv("AUTH_PUBLIC_PATHS", "health")
+	if _, err := LoadFile(""); err == nil {
+		t.Fatalf("expected relative public path to be rejected")
+	}
+}
+
+func TestLoadFileFeatureFlags(t *testing.T) {
+	path := writeConfigFile(t, "config.yaml", "cancel_runs_on_disconnect: true\ncapture_reasoning: false\nfeature_flags:\n  capture_reasoning: true\n")
+	t.Setenv("POLICY_FAIL_MODE", "open")
+
+	cfg, err := LoadFile(path)
+	if err != nil {
+		t.Fatalf("LoadFile failed: %v", err)
+	}
+	flags := cfg.Flags()
+	if !flags[FlagCancelRunsOnDisconnect] || !flags[FlagPolicyFailOpen] || !flags[FlagCaptureReasoning] || flags[FlagEphemeralDefault] {
+		t.Fatalf("unexpected flags: %v", flags)
+	}
+
+	t.Setenv("FEATURE_FLAGS", "ephemeral_default=true, policy_fail_open=false")
+	cfg, err = LoadFile(path)
+	if err != nil {
+		t.Fatalf("LoadFile failed: %v", err)
+	}
+	if flags := cfg.Flags(); !flags[FlagEphemeralDefault] || flags[FlagPolicyFailOpen] {
+		t.Fatalf("expected FEATURE_FLAGS to override, got %v", flags)
+	}
+
+	t.Setenv("FEATURE_FLAGS", "no_such_flag=true,capture_reasoning")
+	_, err = LoadFile(path)
+	var verr *ValidationError
+	if !errors.As(err, &verr) || len(verr.Problems) != 2 {
+		t.Fatalf("expected 2 problems, got %v", err)
+	}
+}
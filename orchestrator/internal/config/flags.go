@@ -0,0 +1,93 @@
+package config
+
+import (
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// Feature flags are booleans the service reads at runtime, so operators can
+// flip them through PUT /internal/flags without a restart.
+const (
+	// FlagCancelRunsOnDisconnect cancels a session's unfinished runs when its
+	// last connection closes.
+	FlagCancelRunsOnDisconnect = "cancel_runs_on_disconnect"
+	// FlagPolicyFailOpen allows tool calls whose policy fails to evaluate.
+	FlagPolicyFailOpen = "policy_fail_open"
+	// FlagEphemeralDefault makes new sessions ephemeral unless the invoke
+	// sets the "ephemeral" context entry to false.
+	FlagEphemeralDefault = "ephemeral_default"
+	// FlagCaptureReasoning records and forwards agents' reasoning events.
+	FlagCaptureReasoning = "capture_reasoning"
+	// FlagReadOnly puts the orchestrator in maintenance mode: new invokes,
+	// tool invocations and registrations are refused with 503 maintenance.
+	FlagReadOnly = "read_only"
+)
+
+// flagDefaults holds every known flag with the value it has when nothing
+// configures it.
+var flagDefaults = map[string]bool{
+	FlagCancelRunsOnDisconnect: false,
+	FlagPolicyFailOpen:         false,
+	FlagEphemeralDefault:       false,
+	FlagCaptureReasoning:       true,
+	FlagReadOnly:               false,
+}
+
+// KnownFlag reports whether name is a feature flag.
+func KnownFlag(name string) bool {
+	_, ok := flagDefaults[name]
+	return ok
+}
+
+// Flags returns the initial value of every feature flag. Flags backed by an
+// older dedicated setting (CANCEL_RUNS_ON_DISCONNECT, POLICY_FAIL_MODE,
+// CAPTURE_REASONING, READ_ONLY) start from it; FEATURE_FLAGS overrides any of
+// them.
+func (c *Config) Flags() map[string]bool {
+	flags := make(map[string]bool, len(flagDefaults))
+	for name, value := range flagDefaults {
+		flags[name] = value
+	}
+	flags[FlagCancelRunsOnDisconnect] = c.CancelRunsOnDisconnect
+	flags[FlagPolicyFailOpen] = c.PolicyFailMode == PolicyFailOpen
+	flags[FlagCaptureReasoning] = c.CaptureReasoning
+	flags[FlagReadOnly] = c.ReadOnly
+	for name, value := range c.FeatureFlags {
+		if KnownFlag(name) {
+			flags[name] = value
+		}
+	}
+	return flags
+}
+
+// getFlags parses "name=bool" pairs separated by commas, or a JSON object of
+// booleans as a config file map becomes.
+func (l *loader) getFlags(key string) map[string]bool {
+	val, ok := l.lookup(key)
+	if !ok || strings.TrimSpace(val) == "" {
+		return nil
+	}
+	flags := make(map[string]bool)
+	if strings.HasPrefix(strings.TrimSpace(val), "{") {
+		if err := json.Unmarshal([]byte(val), &flags); err != nil {
+			l.problems = append(l.problems, fmt.Sprintf("%s must map flag names to booleans: %v", key, err))
+			return nil
+		}
+		return flags
+	}
+	for _, pair := range strings.Split(val, ",") {
+		if pair = strings.TrimSpace(pair); pair == "" {
+			continue
+		}
+		name, raw, found := strings.Cut(pair, "=")
+		value, err := strconv.ParseBool(strings.TrimSpace(raw))
+		if !found || err != nil {
+			l.problems = append(l.problems, fmt.Sprintf("%s entries must be name=true or name=false, got %q", key, pair))
+			continue
+		}
+		flags[strings.TrimSpace(name)] = value
+	}
+	return flags
+}
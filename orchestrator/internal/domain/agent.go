@@ -2,16 +2,148 @@ package domain
 
 import (
 	"encoding/json"
+	"errors"
 	"time"
 )
 
 // Agent represents a registered agent.
 type Agent struct {
-	AgentID       string          `json:"agent_id"`
-	Name          string          `json:"name"`
-	Endpoint      string          `json:"endpoint"`
-	Capabilities  json.RawMessage `json:"capabilities,omitempty"`
-	Status        string          `json:"status"`
-	LastHeartbeat *time.Time      `json:"last_heartbeat,omitempty"`
-	CreatedAt     time.Time       `json:"created_at"`
+	AgentID      string          `json:"agent_id"`
+	Name         string          `json:"name"`
+	Endpoint     string          `json:"endpoint"`
+	Capabilities json.RawMessage `json:"capabilities,omitempty"`
+	// Headers are set on every request to the agent (e.g. auth or tenant
+	// routing). Values may be secrets; redact before exposing them.
+	Headers map[string]string `json:"headers,omitempty"`
+	// Protocol selects the request body and stream format spoken by the
+	// agent. Empty means AgentProtocolNative.
+	Protocol AgentProtocol `json:"protocol,omitempty"`
+	// ResponseFormat is how the agent frames its streamed response. Empty
+	// means detect it from the response Content-Type.
+	ResponseFormat AgentResponseFormat `json:"response_format,omitempty"`
+	// CancelURL, when set, is POSTed the run_id of a run cancelled while the
+	// agent is working on it, so the agent can stop generating.
+	CancelURL string `json:"cancel_url,omitempty"`
+	// MaxConcurrentToolCalls overrides MAX_CONCURRENT_TOOL_CALLS for the
+	// agent's runs: 0 uses the global cap and -1 lifts it.
+	MaxConcurrentToolCalls int `json:"max_concurrent_tool_calls,omitempty"`
+	// RequestFilter limits the run data the agent is sent; nil sends all of
+	// it.
+	RequestFilter *AgentRequestFilter `json:"request_filter,omitempty"`
+	// LLM configures an AgentProtocolLLMTools agent, which has no endpoint.
+	LLM    *LLMAgentConfig `json:"llm,omitempty"`
+	Status string          `json:"status"`
+	// LastError describes the agent's most recent failed invocation and
+	// ConsecutiveFailures counts failures since its last success; both are
+	// cleared by a successful invocation or re-registration.
+	LastError           string     `json:"last_error,omitempty"`
+	ConsecutiveFailures int        `json:"consecutive_failures"`
+	LastHeartbeat       *time.Time `json:"last_heartbeat,omitempty"`
+	CreatedAt           time.Time  `json:"created_at"`
+}
+
+// AgentProtocol is the wire protocol used to invoke an agent.
+type AgentProtocol string
+
+const (
+	// AgentProtocolNative posts an AgentInvokeRequest to {endpoint}/invoke and
+	// expects delta/done/error SSE events.
+	AgentProtocolNative AgentProtocol = "native"
+	// AgentProtocolOpenAIChat posts an OpenAI chat completion request to
+	// {endpoint}/chat/completions and expects OpenAI streaming chunks.
+	AgentProtocolOpenAIChat AgentProtocol = "openai_chat"
+	// AgentProtocolLLMTools is a built-in agent: the orchestrator itself
+	// calls the LLM, runs the tool calls it asks for and feeds the results
+	// back until it answers.
+	AgentProtocolLLMTools AgentProtocol = "llm_tools"
+)
+
+// Valid reports whether p is a known protocol (empty counts as native).
+func (p AgentProtocol) Valid() bool {
+	switch p {
+	case "", AgentProtocolNative, AgentProtocolOpenAIChat, AgentProtocolLLMTools:
+		return true
+	}
+	return false
+}
+
+// Builtin reports whether agents speaking p run inside the orchestrator
+// rather than at an endpoint.
+func (p AgentProtocol) Builtin() bool {
+	return p == AgentProtocolLLMTools
+}
+
+// LLMAgentConfig configures a built-in AgentProtocolLLMTools agent.
+type LLMAgentConfig struct {
+	Model        string `json:"model"`
+	SystemPrompt string `json:"system_prompt,omitempty"`
+	// Tools are the registered tools offered to the model. Calls go through
+	// InvokeTool, so policy and approvals apply.
+	Tools []string `json:"tools,omitempty"`
+	// MaxIterations caps the LLM calls per run; 0 uses the default.
+	MaxIterations int `json:"max_iterations,omitempty"`
+}
+
+// Validate checks an LLM agent config.
+func (c *LLMAgentConfig) Validate() error {
+	if c == nil {
+		return errors.New("llm config is required for protocol llm_tools")
+	}
+	if c.Model == "" {
+		return errors.New("llm.model is required")
+	}
+	if c.MaxIterations < 0 {
+		return errors.New("llm.max_iterations must not be negative")
+	}
+	return nil
+}
+
+// AgentResponseFormat is the framing of an agent's streamed response.
+type AgentResponseFormat string
+
+const (
+	// AgentResponseFormatSSE is a text/event-stream of event/data records.
+	AgentResponseFormatSSE AgentResponseFormat = "sse"
+	// AgentResponseFormatNDJSON is one JSON object per line, whose "type"
+	// field names the event.
+	AgentResponseFormatNDJSON AgentResponseFormat = "ndjson"
+)
+
+// Valid reports whether f is a known format (empty means auto-detect).
+func (f AgentResponseFormat) Valid() bool {
+	switch f {
+	case "", AgentResponseFormatSSE, AgentResponseFormatNDJSON:
+		return true
+	}
+	return false
+}
+
+// AgentRequestFilter limits what an agent is sent with each invoke, so
+// less-trusted agents see only the data they need.
+type AgentRequestFilter struct {
+	// ContextKeys lists the invoke context keys passed to the agent; nil
+	// passes all of them and an empty list none.
+	ContextKeys []string `json:"context_keys"`
+	// LatestInputOnly sends the run's input without the session history.
+	LatestInputOnly bool `json:"latest_input_only,omitempty"`
+}
+
+// FilterContext returns the entries of ctx the filter lets through. A nil
+// filter returns ctx unchanged.
+func (f *AgentRequestFilter) FilterContext(ctx map[string]string) map[string]string {
+	if f == nil || f.ContextKeys == nil || ctx == nil {
+		return ctx
+	}
+	filtered := make(map[string]string, len(f.ContextKeys))
+	for _, k := range f.ContextKeys {
+		if v, ok := ctx[k]; ok {
+			filtered[k] = v
+		}
+	}
+	return filtered
+}
+
+// SendsHistory reports whether the agent is sent session history.
+func (f *AgentRequestFilter) SendsHistory() bool {
+	return f == nil || !f.LatestInputOnly
 }
@@ -14,6 +14,25 @@ const (
 	RunStatusCancelled             RunStatus = "CANCELLED"
 )
 
+// RunPriority orders runs waiting for an agent stream slot: higher ones get
+// a slot first, and lower ones are shed first when the wait queue is full.
+type RunPriority string
+
+const (
+	RunPriorityHigh   RunPriority = "high"
+	RunPriorityNormal RunPriority = "normal"
+	RunPriorityLow    RunPriority = "low"
+)
+
+// Valid reports whether p is one of the priorities above.
+func (p RunPriority) Valid() bool {
+	switch p {
+	case RunPriorityHigh, RunPriorityNormal, RunPriorityLow:
+		return true
+	}
+	return false
+}
+
 // EventType represents the type of an event.
 type EventType string
 
@@ -26,6 +45,16 @@ const (
 	EventTypeRunDone            EventType = "run_done"
 	EventTypeRunFailed          EventType = "run_failed"
 	EventTypeRunCancelled       EventType = "run_cancelled"
+	EventTypeAgentState         EventType = "agent_state"
+	// Digest of a finished run, recorded right after its terminal event
+	EventTypeRunSummary EventType = "run_summary"
+	// Fragments of a tool call's args streamed by the agent before the call
+	// is dispatched
+	EventTypeAgentToolCallDelta EventType = "agent_tool_call_delta"
+
+	// Reasoning ("thinking") deltas, kept apart from the answer text
+	EventTypeAgentReasoningDelta EventType = "agent_reasoning_delta"
+
 	// LLM call events
 	EventTypeLLMCallStarted EventType = "llm_call_started"
 	EventTypeLLMCallDone    EventType = "llm_call_done"
@@ -36,18 +65,43 @@ const (
 	EventTypeToolDispatched   EventType = "tool_dispatched"
 	EventTypeToolResult       EventType = "tool_result"
 	EventTypeToolRequest      EventType = "tool_request" // For client tools
+	EventTypeToolProgress     EventType = "tool_progress"
 	EventTypeApprovalRequired EventType = "approval_required"
 	EventTypeApprovalDecision EventType = "approval_decision"
 )
 
+// Known reports whether t is one of the event types above.
+func (t EventType) Known() bool {
+	switch t {
+	case EventTypeRunStarted, EventTypeUserInput, EventTypeAgentInvokeStarted,
+		EventTypeAgentStreamDelta, EventTypeAgentInvokeDone, EventTypeRunDone,
+		EventTypeRunFailed, EventTypeRunCancelled, EventTypeRunSummary, EventTypeAgentState, EventTypeAgentToolCallDelta,
+		EventTypeAgentReasoningDelta, EventTypeLLMCallStarted, EventTypeLLMCallDone,
+		EventTypeToolCallCreated, EventTypePolicyDecision, EventTypeToolDispatched,
+		EventTypeToolResult, EventTypeToolRequest, EventTypeToolProgress,
+		EventTypeApprovalRequired, EventTypeApprovalDecision:
+		return true
+	}
+	return false
+}
+
 // ToolKind represents the kind of a tool.
 type ToolKind string
 
 const (
 	ToolKindServer ToolKind = "server"
 	ToolKindClient ToolKind = "client"
+	// ToolKindHTTP tools are executed by POSTing their args to the URL in
+	// their metadata.
+	ToolKindHTTP ToolKind = "http"
 )
 
+// RunsOnServer reports whether tool calls of kind k are executed by the
+// orchestrator rather than submitted by a client.
+func (k ToolKind) RunsOnServer() bool {
+	return k == ToolKindServer || k == ToolKindHTTP
+}
+
 // ToolCallStatus represents the status of a tool call.
 type ToolCallStatus string
 
@@ -4,9 +4,14 @@ import "encoding/json"
 
 // RunStartedPayload is the payload for run_started event.
 type RunStartedPayload struct {
-	RequestID string `json:"request_id,omitempty"`
-	SessionID string `json:"session_id"`
-	AgentID   string `json:"agent_id"`
+	RequestID string   `json:"request_id,omitempty"`
+	SessionID string   `json:"session_id"`
+	AgentID   string   `json:"agent_id"`
+	Tags      []string `json:"tags,omitempty"`
+	// Client holds the invoking client's metadata (app version, platform...).
+	Client map[string]string `json:"client,omitempty"`
+	// Priority is the run's effective priority.
+	Priority RunPriority `json:"priority"`
 }
 
 // UserInputPayload is the payload for user_input event.
@@ -15,21 +20,83 @@ type UserInputPayload struct {
 	Content   string `json:"content"`
 }
 
-// AgentStreamDeltaPayload is the payload for agent_stream_delta event.
+// AgentStreamDeltaPayload is the payload for agent_stream_delta and
+// agent_reasoning_delta events.
 type AgentStreamDeltaPayload struct {
 	Text string `json:"text"`
 }
 
+// AgentStatePayload is the payload for agent_state event.
+type AgentStatePayload struct {
+	State  string `json:"state"`
+	Detail string `json:"detail,omitempty"`
+}
+
+// AgentToolCallDeltaPayload is the payload for agent_tool_call_delta event.
+// ToolCallID is the agent's ID for the call, not a tool_calls row.
+type AgentToolCallDeltaPayload struct {
+	ToolCallID string `json:"tool_call_id"`
+	Name       string `json:"name,omitempty"`
+	ArgsDelta  string `json:"args_delta"`
+}
+
 // RunDonePayload is the payload for run_done event.
+// Usage is what the agent reported; LLMUsage is measured from the run's
+// llm_call_done events.
 type RunDonePayload struct {
 	Usage        *UsageData `json:"usage,omitempty"`
+	LLMUsage     *LLMUsage  `json:"llm_usage,omitempty"`
+	TotalTokens  int        `json:"total_tokens,omitempty"`
 	FinalMessage string     `json:"final_message,omitempty"`
 }
 
+// LLMUsage aggregates the token usage of the LLM calls proxied during a run.
+type LLMUsage struct {
+	Calls            int `json:"calls"`
+	PromptTokens     int `json:"prompt_tokens"`
+	CompletionTokens int `json:"completion_tokens"`
+	TotalTokens      int `json:"total_tokens"`
+}
+
 // RunFailedPayload is the payload for run_failed event.
 type RunFailedPayload struct {
 	Code    string `json:"code"`
 	Message string `json:"message"`
+	// PartialMessage is the answer text the agent streamed before the run
+	// failed, if any.
+	PartialMessage string `json:"partial_message,omitempty"`
+}
+
+// RunCancelledPayload is the payload for run_cancelled event. It is also
+// stored as the cancelled run's error. DecidedBy says who cancelled the run
+// (e.g. "user", "admin", "system").
+type RunCancelledPayload struct {
+	Reason    string `json:"reason"`
+	DecidedBy string `json:"decided_by"`
+	// PartialMessage is the answer text the agent streamed before the run
+	// was cancelled, if any. It is not part of the run's stored error.
+	PartialMessage string `json:"partial_message,omitempty"`
+}
+
+// RunSummaryPayload is the payload for run_summary event: one compact row
+// per finished run. MessageLength is the length in bytes of the final
+// message, or of the partial one a failed or cancelled run left; the counts
+// are of the run's recorded events.
+type RunSummaryPayload struct {
+	Status        RunStatus        `json:"status"`
+	DurationMs    int64            `json:"duration_ms"`
+	MessageLength int              `json:"message_length"`
+	DeltaCount    int              `json:"delta_count"`
+	ToolCallCount int              `json:"tool_call_count"`
+	LLMCallCount  int              `json:"llm_call_count"`
+	TotalTokens   int              `json:"total_tokens"`
+	Error         *RunSummaryError `json:"error,omitempty"`
+}
+
+// RunSummaryError is why a failed or cancelled run ended.
+type RunSummaryError struct {
+	Code    string `json:"code"`
+	Message string `json:"message"`
 }
 
 // LLMCallStartedPayload is the payload for llm_call_started event.
@@ -63,6 +130,9 @@ type PolicyDecisionPayload struct {
 	ToolCallID string `json:"tool_call_id"`
 	Decision   string `json:"decision"` // allow, require_approval, block
 	Reason     string `json:"reason,omitempty"`
+	// Error is the policy evaluation failure when the decision is the
+	// POLICY_FAIL_MODE fallback.
+	Error string `json:"error,omitempty"`
 }
 
 // ToolDispatchedPayload is the payload for tool_dispatched event.
@@ -76,6 +146,16 @@ type ToolResultPayload struct {
 	Status     ToolCallStatus  `json:"status"`
 	Result     json.RawMessage `json:"result,omitempty"`
 	Error      json.RawMessage `json:"error,omitempty"`
+	// Truncated is set when Result is a TruncatedToolResult marker.
+	Truncated bool `json:"truncated,omitempty"`
+}
+
+// ToolProgressPayload is the payload for tool_progress event: an incremental
+// piece of output from a running client tool.
+type ToolProgressPayload struct {
+	ToolCallID string `json:"tool_call_id"`
+	Seq        int64  `json:"seq"`
+	Chunk      string `json:"chunk"`
 }
 
 // ToolRequestPayload is the payload for tool_request event (client tool).
@@ -93,6 +173,9 @@ type ApprovalRequiredPayload struct {
 	ToolName    string          `json:"tool_name"`
 	ArgsSummary string          `json:"args_summary"`
 	Args        json.RawMessage `json:"args,omitempty"`
+	// ArgsPreview is the args as sanitized JSON text, cut to a size safe to
+	// display.
+	ArgsPreview string `json:"args_preview,omitempty"`
 }
 
 // ApprovalDecisionPayload is the payload for approval_decision event.
@@ -100,4 +183,7 @@ type ApprovalDecisionPayload struct {
 	ApprovalID string         `json:"approval_id"`
 	Decision   ApprovalStatus `json:"decision"`
 	Reason     string         `json:"reason,omitempty"`
+	DecidedBy  string         `json:"decided_by,omitempty"`
+	// Remember is the scope the approval was remembered for, if any.
+	Remember RememberScope `json:"remember,omitempty"`
 }
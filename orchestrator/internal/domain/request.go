@@ -1,6 +1,9 @@
 package domain
 
-import "encoding/json"
+import (
+	"encoding/json"
+	"time"
+)
 
 // InputMessage represents the input message from the client.
 type InputMessage struct {
@@ -8,6 +11,16 @@ type InputMessage struct {
 	Content string `json:"content"`
 }
 
+// ClientContextPrefix marks InvokeRequest.Context entries that describe the
+// calling client (e.g. "client.platform"); ingress fills them from the
+// connection's hello client_meta.
+const ClientContextPrefix = "client."
+
+// EphemeralContextKey is the InvokeRequest.Context entry that, set to "true"
+// on a session's first invoke, makes the session ephemeral: its messages are
+// not stored and its events are stored without their content.
+const EphemeralContextKey = "ephemeral"
+
 // InvokeRequest represents the request to invoke an agent.
 type InvokeRequest struct {
 	SessionID    string            `json:"session_id"`
@@ -15,13 +28,44 @@ type InvokeRequest struct {
 	InputMessage InputMessage      `json:"input_message"`
 	RequestID    string            `json:"request_id,omitempty"`
 	Context      map[string]string `json:"context,omitempty"`
+	// Tags label the run for grouping and filtering (e.g. "experiment=x").
+	Tags []string `json:"tags,omitempty"`
+	// MaxHistory overrides how many recent session messages are sent to the
+	// agent: 0 sends none (a stateless turn), -1 sends all.
+	MaxHistory *int `json:"max_history,omitempty"`
+	// MaxDurationMs caps the run's wall-clock time; it can shorten but not
+	// extend the configured MAX_RUN_DURATION_MS. 0 uses the configured cap.
+	MaxDurationMs int64 `json:"max_duration_ms,omitempty"`
+	// Priority is the run's claim on agent stream slots when they are all
+	// taken: high, normal (the default) or low.
+	Priority RunPriority `json:"priority,omitempty"`
 }
 
 // InvokeResponse represents the response from invoking an agent.
+// AgentID is the agent that actually handles the run; when it differs from
+// the requested agent, RequestedAgentID is set and Fallback is true.
 type InvokeResponse struct {
-	RunID     string `json:"run_id"`
-	SessionID string `json:"session_id"`
-	AgentID   string `json:"agent_id"`
+	RunID            string   `json:"run_id"`
+	SessionID        string   `json:"session_id"`
+	AgentID          string   `json:"agent_id"`
+	RequestedAgentID string   `json:"requested_agent_id,omitempty"`
+	Fallback         bool     `json:"fallback,omitempty"`
+	Tags             []string `json:"tags,omitempty"`
+	// Duplicate is set when the session already had a run for the invoke's
+	// request_id; that run is returned and no new one is started.
+	Duplicate bool `json:"duplicate,omitempty"`
+}
+
+// InvokeResult is the outcome of an invoke that waited for its run to finish.
+// Status is the run's status when the wait ended, which is still RUNNING (or
+// PENDING) if the wait timed out first.
+type InvokeResult struct {
+	InvokeResponse
+	Status       RunStatus         `json:"status"`
+	FinalMessage string            `json:"final_message,omitempty"`
+	Usage        *UsageData        `json:"usage,omitempty"`
+	TotalTokens  int               `json:"total_tokens,omitempty"`
+	Error        *RunFailedPayload `json:"error,omitempty"`
 }
 
 // AgentInvokeRequest is the request sent to an external agent.
@@ -32,6 +76,46 @@ type AgentInvokeRequest struct {
 	InputMessage InputMessage      `json:"input_message"`
 	Messages     []Message         `json:"messages,omitempty"`
 	Context      map[string]string `json:"context,omitempty"`
+	// Headers are sent as HTTP headers rather than in the body.
+	Headers map[string]string `json:"-"`
+	// Protocol selects how the request is encoded on the wire.
+	Protocol AgentProtocol `json:"-"`
+	// ResponseFormat selects how the streamed response is decoded.
+	ResponseFormat AgentResponseFormat `json:"-"`
+	// LLM configures a built-in AgentProtocolLLMTools agent.
+	LLM *LLMAgentConfig `json:"-"`
+}
+
+// SessionUpdateRequest updates a session's metadata. By default top-level keys
+// are shallow-merged into the existing metadata and null values delete keys;
+// with Replace the metadata is overwritten.
+type SessionUpdateRequest struct {
+	Metadata json.RawMessage `json:"metadata"`
+	Replace  bool            `json:"replace,omitempty"`
+}
+
+// MessageImportRequest imports an existing conversation into a session. The
+// session is created for UserID when it does not exist yet.
+type MessageImportRequest struct {
+	UserID   string              `json:"user_id,omitempty"`
+	Messages []MessageImportItem `json:"messages"`
+}
+
+// MessageImportItem is one imported message. A zero CreatedAt is set to the
+// import time.
+type MessageImportItem struct {
+	Role      string          `json:"role"` // user, assistant, system, tool
+	Content   string          `json:"content"`
+	RunID     string          `json:"run_id,omitempty"`
+	CreatedAt time.Time       `json:"created_at"`
+	Metadata  json.RawMessage `json:"metadata,omitempty"`
+}
+
+// MessageImportResponse lists the imported messages in created_at order.
+type MessageImportResponse struct {
+	SessionID     string    `json:"session_id"`
+	ImportedCount int       `json:"imported_count"`
+	Messages      []Message `json:"messages"`
 }
 
 // ToolInvokeRequest represents the request to invoke a tool.
@@ -51,6 +135,59 @@ type ToolInvokeResponse struct {
 	Error      *ToolError      `json:"error,omitempty"`
 }
 
+// CancelRunRequest carries why a run is being cancelled and by whom. Both
+// fields are optional; DecidedBy defaults to "user".
+type CancelRunRequest struct {
+	Reason    string `json:"reason,omitempty"`
+	DecidedBy string `json:"decided_by,omitempty"`
+}
+
+// EventAckRequest records that a client device has handled a run's events
+// up to Seq. EventID, the event_id of a pushed event, may be given instead
+// of Seq.
+type EventAckRequest struct {
+	SessionID string `json:"session_id"`
+	DeviceID  string `json:"device_id"`
+	RunID     string `json:"run_id"`
+	Seq       int64  `json:"seq,omitempty"`
+	EventID   string `json:"event_id,omitempty"`
+}
+
+// PolicyEvaluateRequest is a dry-run policy evaluation request.
+type PolicyEvaluateRequest struct {
+	ToolName string          `json:"tool_name"`
+	UserID   string          `json:"user_id"`
+	Args     json.RawMessage `json:"args,omitempty"`
+	// Client is the client metadata a real call's session would carry.
+	Client map[string]string `json:"client,omitempty"`
+}
+
+// PolicyEvaluateResponse is the decision a tool call would receive.
+type PolicyEvaluateResponse struct {
+	Decision      string `json:"decision"` // allow, require_approval, block
+	Reason        string `json:"reason,omitempty"`
+	PolicyVersion string `json:"policy_version"`
+	// Error is set when the policy failed to evaluate; Decision is then the
+	// POLICY_FAIL_MODE fallback.
+	Error string `json:"error,omitempty"`
+}
+
+// TokenizeRequest asks how many tokens messages use with a model.
+type TokenizeRequest struct {
+	Model    string         `json:"model"`
+	Messages []InputMessage `json:"messages"`
+}
+
+// TokenizeResponse gives the token count of each message, in request order,
+// and their total. Tokenizer names the counter; "approximate" counts are
+// estimates.
+type TokenizeResponse struct {
+	Model     string `json:"model"`
+	Tokenizer string `json:"tokenizer"`
+	Messages  []int  `json:"messages"`
+	Total     int    `json:"total"`
+}
+
 // ToolError represents a tool error.
 type ToolError struct {
 	Code    string `json:"code"`
@@ -73,11 +210,16 @@ type Timestamps struct {
 	CompletedAt int64 `json:"completed_at,omitempty"`
 }
 
-// ApprovalDecisionRequest represents a decision on an approval.
+// ApprovalDecisionRequest represents a decision on an approval. Remember, on
+// an approval, auto-approves later calls of the same tool in the session or
+// for the user (see RememberScope).
 type ApprovalDecisionRequest struct {
-	Decision  string `json:"decision"` // APPROVED or REJECTED
-	Reason    string `json:"reason,omitempty"`
-	DecidedBy string `json:"decided_by,omitempty"`
+	Decision  string        `json:"decision"` // APPROVED or REJECTED
+	Reason    string        `json:"reason,omitempty"`
+	DecidedBy string        `json:"decided_by,omitempty"`
+	Remember  RememberScope `json:"remember,omitempty"`
+	// Nonce, if set, makes a resent decision return the first one's outcome.
+	Nonce string `json:"nonce,omitempty"`
 }
 
 // ApprovalDecisionResponse represents the response after submitting an approval decision.
@@ -95,6 +237,9 @@ type ToolCallResultRequest struct {
 	Status string          `json:"status"` // SUCCEEDED or FAILED
 	Result json.RawMessage `json:"result,omitempty"`
 	Error  json.RawMessage `json:"error,omitempty"`
+	// Nonce, if set, makes a resent submission return the first one's
+	// response.
+	Nonce string `json:"nonce,omitempty"`
 }
 
 // ToolCallResultResponse represents the response after submitting a tool call result.
@@ -106,12 +251,29 @@ type ToolCallResultResponse struct {
 	CompletedAt int64           `json:"completed_at"`
 }
 
+// ToolProgressRequest carries one chunk of incremental output from a running
+// client tool. Seq orders the chunks of a tool call and must increase.
+type ToolProgressRequest struct {
+	Seq   int64  `json:"seq"`
+	Chunk string `json:"chunk"`
+}
+
+// ToolProgressResponse reports whether a progress chunk was recorded.
+// Accepted is false for a duplicate or stale chunk, which is dropped.
+type ToolProgressResponse struct {
+	ToolCallID string         `json:"tool_call_id"`
+	Status     ToolCallStatus `json:"status"`
+	Seq        int64          `json:"seq"`
+	Accepted   bool           `json:"accepted"`
+}
+
 // ToolListItem represents a tool in the list response.
 type ToolListItem struct {
-	Name      string          `json:"name"`
-	Source    string          `json:"source"` // "server" or "client"
-	Schema    json.RawMessage `json:"schema,omitempty"`
-	TimeoutMs int             `json:"timeout_ms"`
+	Name         string          `json:"name"`
+	Source       string          `json:"source"` // "server" or "client"
+	Schema       json.RawMessage `json:"schema,omitempty"`
+	ResultSchema json.RawMessage `json:"result_schema,omitempty"`
+	TimeoutMs    int             `json:"timeout_ms"`
 }
 
 // ListToolsResponse represents the response for listing tools.
@@ -121,9 +283,14 @@ type ListToolsResponse struct {
 
 // ToolRegistrationItem represents a single tool to register.
 type ToolRegistrationItem struct {
-	Name      string          `json:"name"`
-	Schema    json.RawMessage `json:"schema"`
-	TimeoutMs int             `json:"timeout_ms,omitempty"`
+	Name         string          `json:"name"`
+	Schema       json.RawMessage `json:"schema"`
+	ResultSchema json.RawMessage `json:"result_schema,omitempty"`
+	TimeoutMs    int             `json:"timeout_ms,omitempty"`
+	// Kind is client (the default) or http. An http tool needs an "http"
+	// object with a "url" in Metadata.
+	Kind     ToolKind        `json:"kind,omitempty"`
+	Metadata json.RawMessage `json:"metadata,omitempty"`
 }
 
 // ToolRegistrationRequest represents a request to register tools from a client.
@@ -137,3 +304,18 @@ type ToolRegistrationResponse struct {
 	OK              bool `json:"ok"`
 	RegisteredCount int  `json:"registered_count"`
 }
+
+// FeatureFlags is the current state of the runtime feature flags.
+type FeatureFlags struct {
+	// Flags holds every flag's effective value.
+	Flags map[string]bool `json:"flags"`
+	// Overrides holds the flags set at runtime, which replace the configured
+	// value until the override is cleared or the orchestrator restarts.
+	Overrides map[string]bool `json:"overrides"`
+}
+
+// FeatureFlagsUpdate sets runtime flag overrides; a null value clears the
+// override so the configured value applies again.
+type FeatureFlagsUpdate struct {
+	Flags map[string]*bool `json:"flags"`
+}
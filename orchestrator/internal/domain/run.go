@@ -15,13 +15,102 @@ type Run struct {
 	StartedAt   time.Time       `json:"started_at"`
 	EndedAt     *time.Time      `json:"ended_at,omitempty"`
 	Error       json.RawMessage `json:"error,omitempty"`
+	TotalTokens int             `json:"total_tokens,omitempty"`
+	Tags        []string        `json:"tags,omitempty"`
+	// RequestID is the invoke's request_id; a session has at most one run
+	// per request_id.
+	RequestID string `json:"request_id,omitempty"`
+	// DeadlineAt is when the run fails with run_deadline_exceeded if it has
+	// not finished; nil means no cap.
+	DeadlineAt *time.Time `json:"deadline_at,omitempty"`
+	// Priority is the run's invoke priority; runs from before priorities
+	// existed read as normal.
+	Priority RunPriority `json:"priority,omitempty"`
+	// ArchiveLocation is set once the run has been moved to cold storage; the
+	// run row is then a tombstone without messages, events or tool calls.
+	ArchiveLocation string `json:"archive_location,omitempty"`
+}
+
+// RunArchive is the cold-storage form of a run: the run and every row that
+// belongs to it, enough to restore it to the primary database.
+type RunArchive struct {
+	Run        Run        `json:"run"`
+	Messages   []Message  `json:"messages"`
+	Events     []Event    `json:"events"`
+	ToolCalls  []ToolCall `json:"tool_calls"`
+	Approvals  []Approval `json:"approvals"`
+	ArchivedAt time.Time  `json:"archived_at"`
+}
+
+// RunAggregateOptions selects the rows GetRunAggregate loads with a run.
+// With Events, at most MaxEvents of the run's latest events are loaded.
+type RunAggregateOptions struct {
+	ToolCalls bool
+	Messages  bool
+	Events    bool
+	MaxEvents int
+}
+
+// RunAggregate is a run with the rows a detail view needs. Rows that were
+// not requested, or that the run has none of, are omitted. Events are the
+// run's latest events in order; EventsTruncated is set when earlier ones
+// were left out.
+type RunAggregate struct {
+	Run
+	ToolCalls       []ToolCall `json:"tool_calls,omitempty"`
+	Messages        []Message  `json:"messages,omitempty"`
+	Events          []Event    `json:"events,omitempty"`
+	EventsTruncated bool       `json:"events_truncated,omitempty"`
+}
+
+// RunFilter selects runs for ListRuns. Zero-valued fields are ignored.
+// Results are ordered by started_at descending; BeforeStartedAt/BeforeRunID is
+// the keyset position of the last run on the previous page.
+type RunFilter struct {
+	Status          RunStatus
+	AgentID         string
+	SessionID       string
+	Tag             string // runs carrying this tag
+	StartedAfter    time.Time
+	StartedBefore   time.Time
+	BeforeStartedAt time.Time
+	BeforeRunID     string
+	Unarchived      bool // skip archived runs
+	Active          bool // only runs that have not ended
+	Limit           int
+}
+
+// RunSummary is the list view of a run. DurationMs is the elapsed time so far
+// for runs that have not ended.
+type RunSummary struct {
+	RunID       string     `json:"run_id"`
+	SessionID   string     `json:"session_id"`
+	AgentID     string     `json:"agent_id"`
+	Status      RunStatus  `json:"status"`
+	StartedAt   time.Time  `json:"started_at"`
+	EndedAt     *time.Time `json:"ended_at,omitempty"`
+	DurationMs  int64      `json:"duration_ms"`
+	TotalTokens int        `json:"total_tokens,omitempty"`
+	Tags        []string   `json:"tags,omitempty"`
+}
+
+// RunEventSummary is a run's list view plus tallies of its events, enough for
+// a dashboard card without fetching the event log. The event timestamps are
+// zero when the run has no events.
+type RunEventSummary struct {
+	RunSummary
+	EventCount   int               `json:"event_count"`
+	EventCounts  map[EventType]int `json:"event_counts"`
+	FirstEventTs int64             `json:"first_event_ts,omitempty"`
+	LastEventTs  int64             `json:"last_event_ts,omitempty"`
 }
 
 // Event represents a trace event for replay.
 type Event struct {
 	EventID string          `json:"event_id"`
 	RunID   string          `json:"run_id"`
-	Ts      int64           `json:"ts"` // Unix milliseconds
+	Ts      int64           `json:"ts"`  // Unix milliseconds
+	Seq     int64           `json:"seq"` // Monotonic per run in recording order; events are ordered by it
 	Type    EventType       `json:"type"`
 	Payload json.RawMessage `json:"payload,omitempty"`
 }
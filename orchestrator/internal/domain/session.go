@@ -13,6 +13,23 @@ type Session struct {
 	Metadata  json.RawMessage `json:"metadata,omitempty"`
 }
 
+// SessionDisconnectedResponse reports how the orchestrator handled ingress
+// losing the last connection of a session: the unfinished runs it cancelled,
+// or Detached when runs continue headless and their events are no longer
+// pushed to ingress.
+type SessionDisconnectedResponse struct {
+	SessionID     string   `json:"session_id"`
+	CancelledRuns []string `json:"cancelled_runs"`
+	Detached      bool     `json:"detached"`
+}
+
+// MessageFilter narrows the messages returned for a session. Zero values
+// match everything.
+type MessageFilter struct {
+	Roles []string
+	RunID string
+}
+
 // Message represents a single message in a session.
 type Message struct {
 	MessageID string          `json:"message_id"`
@@ -29,6 +29,30 @@ type UsageData struct {
 	DurationMs       int `json:"duration_ms,omitempty"`
 }
 
+// StateEventData is the data for a state SSE event: the agent's current
+// activity (e.g. "searching", "writing") with optional human-readable detail.
+type StateEventData struct {
+	State  string `json:"state"`
+	Detail string `json:"detail,omitempty"`
+}
+
+// ToolCallDeltaEventData is the data for a tool_call_delta SSE event: the
+// next fragment of a tool call's JSON args as the model generates them. Name
+// need only be set on the call's first delta.
+type ToolCallDeltaEventData struct {
+	ToolCallID string `json:"tool_call_id"`
+	Name       string `json:"name,omitempty"`
+	ArgsDelta  string `json:"args_delta"`
+}
+
+// ToolCallEventData is the data for a tool_call SSE event, which ends a tool
+// call's deltas. Args, when set, replace the args assembled from them.
+type ToolCallEventData struct {
+	ToolCallID string          `json:"tool_call_id"`
+	Name       string          `json:"name,omitempty"`
+	Args       json.RawMessage `json:"args,omitempty"`
+}
+
 // ErrorEventData is the data for an error SSE event.
 type ErrorEventData struct {
 	Code    string `json:"code"`
@@ -7,13 +7,14 @@ import (
 
 // Tool represents a registered tool.
 type Tool struct {
-	Name      string          `json:"name"`
-	Kind      ToolKind        `json:"kind"`                // server or client
-	Schema    json.RawMessage `json:"schema"`              // JSON Schema for tool parameters
-	ClientID  string          `json:"client_id,omitempty"` // client identifier (for client tools)
-	Policy    json.RawMessage `json:"policy"`              // policy config (optional, logic moved to OPA but kept for metadata)
-	TimeoutMs int             `json:"timeout_ms"`
-	Metadata  json.RawMessage `json:"metadata,omitempty"`
+	Name         string          `json:"name"`
+	Kind         ToolKind        `json:"kind"`                    // server, client or http
+	Schema       json.RawMessage `json:"schema"`                  // JSON Schema for tool parameters
+	ResultSchema json.RawMessage `json:"result_schema,omitempty"` // optional JSON Schema for successful results
+	ClientID     string          `json:"client_id,omitempty"`     // client identifier (for client tools)
+	Policy       json.RawMessage `json:"policy"`                  // policy config (optional, logic moved to OPA but kept for metadata)
+	TimeoutMs    int             `json:"timeout_ms"`
+	Metadata     json.RawMessage `json:"metadata,omitempty"`
 }
 
 // ToolCall represents a tool execution record.
@@ -31,6 +32,18 @@ type ToolCall struct {
 	TimeoutMs      int             `json:"timeout_ms"`
 	CreatedAt      time.Time       `json:"created_at"`
 	CompletedAt    *time.Time      `json:"completed_at,omitempty"`
+	// ProgressSeq is the seq of the last accepted tool_progress chunk and
+	// ProgressChunks how many chunks were accepted.
+	ProgressSeq    int64 `json:"progress_seq,omitempty"`
+	ProgressChunks int   `json:"progress_chunks,omitempty"`
+}
+
+// TruncatedToolResult is stored in place of a client tool result that
+// exceeded the size limit when the overflow policy is "truncate".
+type TruncatedToolResult struct {
+	Truncated     bool   `json:"truncated"`
+	OriginalBytes int    `json:"original_bytes"`
+	Preview       string `json:"preview"`
 }
 
 // Approval represents an approval request.
@@ -44,3 +57,83 @@ type Approval struct {
 	DecidedBy  string         `json:"decided_by,omitempty"`
 	Reason     string         `json:"reason,omitempty"`
 }
+
+// RememberScope is how widely a remembered approval applies.
+type RememberScope string
+
+const (
+	// RememberScopeSession applies to later calls in the same session.
+	RememberScopeSession RememberScope = "session"
+	// RememberScopeUser applies to later calls in any of the user's sessions.
+	RememberScopeUser RememberScope = "user"
+)
+
+// ApprovalDecidedByRemembered is the decided_by of approvals granted from a
+// remembered approval.
+const ApprovalDecidedByRemembered = "remembered"
+
+// RememberedApproval is a user's approval of a tool that stands in for
+// prompting them again until ExpiresAt. SessionID is set for session scope.
+type RememberedApproval struct {
+	UserID     string        `json:"user_id,omitempty"`
+	SessionID  string        `json:"session_id,omitempty"`
+	ToolName   string        `json:"tool_name"`
+	Scope      RememberScope `json:"scope"`
+	ApprovalID string        `json:"approval_id"`
+	CreatedAt  time.Time     `json:"created_at"`
+	ExpiresAt  time.Time     `json:"expires_at"`
+}
+
+// RememberedApprovalFilter selects remembered approvals to clear. UserID
+// matches both scopes of that user; an empty ToolName matches every tool.
+type RememberedApprovalFilter struct {
+	UserID    string
+	SessionID string
+	ToolName  string
+}
+
+// NonceKind names the kind of submission a RequestNonce guards; nonces are
+// unique per kind.
+type NonceKind string
+
+const (
+	NonceKindToolResult       NonceKind = "tool_result"
+	NonceKindApprovalDecision NonceKind = "approval_decision"
+)
+
+// RequestNonce records a submission made with a nonce so a replay gets the
+// first outcome. Response is nil while the first submission is in flight.
+type RequestNonce struct {
+	Kind      NonceKind
+	Nonce     string
+	TargetID  string
+	Response  json.RawMessage
+	CreatedAt time.Time
+	ExpiresAt time.Time
+}
+
+// PendingApprovalFilter selects pending approvals for an approver's queue.
+// AfterCreatedAt and AfterApprovalID form the keyset cursor.
+type PendingApprovalFilter struct {
+	ToolName        string
+	UserID          string
+	AfterCreatedAt  time.Time
+	AfterApprovalID string
+	Limit           int
+}
+
+// PendingApproval is an approval awaiting a decision, with the context an
+// approver needs to triage it. ArgsSummary is a prefix of the tool call args;
+// ArgsTruncated reports whether it was cut short.
+type PendingApproval struct {
+	ApprovalID    string    `json:"approval_id"`
+	ToolCallID    string    `json:"tool_call_id"`
+	ToolName      string    `json:"tool_name"`
+	ArgsSummary   string    `json:"args_summary"`
+	ArgsTruncated bool      `json:"args_truncated,omitempty"`
+	RunID         string    `json:"run_id"`
+	SessionID     string    `json:"session_id"`
+	UserID        string    `json:"user_id,omitempty"`
+	CreatedAt     time.Time `json:"created_at"`
+	AgeMs         int64     `json:"age_ms"`
+}
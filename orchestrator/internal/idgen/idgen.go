@@ -0,0 +1,86 @@
+// Package idgen generates the prefixed identifiers used for runs, messages,
+// events and the other orchestrator records.
+package idgen
+
+import (
+	"fmt"
+	"regexp"
+	"sync"
+
+	"github.com/google/uuid"
+)
+
+// Generator returns a new ID of the form "<prefix>_<unique>".
+type Generator interface {
+	New(prefix string) string
+}
+
+// UUIDv7 generates IDs from full UUIDv7 values. They are collision-resistant
+// and, because the leading bits are a millisecond timestamp, IDs created later
+// sort after earlier ones.
+type UUIDv7 struct{}
+
+// New returns prefix + "_" + a UUIDv7 string.
+func (UUIDv7) New(prefix string) string {
+	id, err := uuid.NewV7()
+	if err != nil {
+		// Only fails if the system random source is broken.
+		id = uuid.New()
+	}
+	return prefix + "_" + id.String()
+}
+
+// Default is the generator used when none is injected.
+var Default Generator = UUIDv7{}
+
+// MaxNamespaceLen is the longest namespace Namespaced accepts.
+const MaxNamespaceLen = 16
+
+var namespacePattern = regexp.MustCompile(`^[a-z0-9][a-z0-9-]*$`)
+
+// ValidNamespace reports whether ns can be used as an ID namespace. It may
+// not contain "_", so the type prefix and namespace of an ID stay apart.
+func ValidNamespace(ns string) bool {
+	return len(ns) <= MaxNamespaceLen && namespacePattern.MatchString(ns)
+}
+
+// Namespaced puts a namespace (e.g. an environment name) after the type
+// prefix of the IDs Generator makes: "<prefix>_<namespace>_<unique>".
+type Namespaced struct {
+	Generator Generator
+	Namespace string
+}
+
+// New returns an ID for prefix within the namespace.
+func (n Namespaced) New(prefix string) string {
+	return n.Generator.New(prefix + "_" + n.Namespace)
+}
+
+// WithNamespace returns g with IDs namespaced by ns, or g itself when ns is
+// empty.
+func WithNamespace(g Generator, ns string) Generator {
+	if ns == "" {
+		return g
+	}
+	return Namespaced{Generator: g, Namespace: ns}
+}
+
+// Sequence generates deterministic, zero-padded sequential IDs per prefix
+// (run_000001, run_000002, ...). Intended for tests.
+type Sequence struct {
+	mu     sync.Mutex
+	counts map[string]int
+}
+
+// NewSequence creates a Sequence generator.
+func NewSequence() *Sequence {
+	return &Sequence{counts: make(map[string]int)}
+}
+
+// New returns the next ID for prefix.
+func (s *Sequence) New(prefix string) string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.counts[prefix]++
+	return fmt.Sprintf("%s_%06d", prefix, s.counts[prefix])
+}
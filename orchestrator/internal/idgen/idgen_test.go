@@ -0,0 +1,74 @@
+package idgen
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestUUIDv7IDsAreUniqueAndSortable(t *testing.T) {
+	var g UUIDv7
+	prev := g.New("run")
+	if !strings.HasPrefix(prev, "run_") || len(prev) != len("run_")+36 {
+		t.Fatalf("unexpected id format: %q", prev)
+	}
+	seen := map[string]bool{prev: true}
+	for i := 0; i < 1000; i++ {
+		if i%100 == 0 {
+			time.Sleep(time.Millisecond)
+		}
+		id := g.New("run")
+		if seen[id] {
+			t.Fatalf("duplicate id %q", id)
+		}
+		if id <= prev {
+			t.Fatalf("ids not increasing: %q then %q", prev, id)
+		}
+		seen[id] = true
+		prev = id
+	}
+}
+
+func TestSequenceIsDeterministic(t *testing.T) {
+	g := NewSequence()
+	if got := g.New("run"); got != "run_000001" {
+		t.Fatalf("unexpected id: %q", got)
+	}
+	if got := g.New("evt"); got != "evt_000001" {
+		t.Fatalf("unexpected id: %q", got)
+	}
+	if got := g.New("run"); got != "run_000002" {
+		t.Fatalf("unexpected id: %q", got)
+	}
+}
+
+func TestNamespacedPutsNamespaceAfterPrefix(t *testing.T) {
+	g := WithNamespace(NewSequence(), "stg")
+	if got := g.New("run"); got != "run_stg_000001" {
+		t.Fatalf("unexpected id: %q", got)
+	}
+	if got := g.New("evt"); got != "evt_stg_000001" {
+		t.Fatalf("unexpected id: %q", got)
+	}
+
+	seq := NewSequence()
+	if WithNamespace(seq, "") != Generator(seq) {
+		t.Fatal("expected an empty namespace to return the generator unchanged")
+	}
+}
+
+func TestValidNamespace(t *testing.T) {
+	for ns, want := range map[string]bool{
+		"stg":                true,
+		"eu-west-1":          true,
+		"":                   false,
+		"-stg":               false,
+		"stg_a":              false,
+		"Prod":               false,
+		"a-very-long-prefix": false,
+	} {
+		if got := ValidNamespace(ns); got != want {
+			t.Errorf("ValidNamespace(%q) = %v, want %v", ns, got, want)
+		}
+	}
+}
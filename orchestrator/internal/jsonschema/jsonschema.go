@@ -0,0 +1,83 @@
+// Package jsonschema validates JSON documents against JSON Schemas using
+// OPA's json.match_schema builtin, so no separate schema library is needed.
+package jsonschema
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"sync"
+
+	"github.com/open-policy-agent/opa/rego"
+)
+
+var (
+	prepareOnce sync.Once
+	query       rego.PreparedEvalQuery
+	prepareErr  error
+)
+
+func prepared(ctx context.Context) (rego.PreparedEvalQuery, error) {
+	prepareOnce.Do(func() {
+		query, prepareErr = rego.New(
+			rego.Query("result := json.match_schema(input.document, input.schema)"),
+		).PrepareForEval(ctx)
+	})
+	return query, prepareErr
+}
+
+// Validate reports how doc violates schema; no violations means doc
+// conforms. An error means the schema or document could not be used at all
+// (e.g. the schema is not valid JSON Schema).
+func Validate(ctx context.Context, schema, doc json.RawMessage) ([]string, error) {
+	if !json.Valid(schema) {
+		return nil, fmt.Errorf("invalid schema: not valid JSON")
+	}
+	if len(doc) == 0 {
+		doc = json.RawMessage("null")
+	}
+	if !json.Valid(doc) {
+		return []string{"document is not valid JSON"}, nil
+	}
+
+	q, err := prepared(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to prepare schema validation: %w", err)
+	}
+	// Both are passed as JSON text: json.match_schema parses strings itself,
+	// which also keeps a null document from being undefined in Rego.
+	results, err := q.Eval(ctx, rego.EvalInput(map[string]interface{}{
+		"document": string(doc),
+		"schema":   string(schema),
+	}))
+	if err != nil {
+		return nil, fmt.Errorf("invalid schema: %w", err)
+	}
+	if len(results) == 0 {
+		return nil, fmt.Errorf("invalid schema")
+	}
+
+	// result is [match, [{"error": ..., ...}, ...]]
+	out, ok := results[0].Bindings["result"].([]interface{})
+	if !ok || len(out) != 2 {
+		return nil, fmt.Errorf("unexpected json.match_schema result %v", results[0].Bindings["result"])
+	}
+	if match, _ := out[0].(bool); match {
+		return nil, nil
+	}
+	errs, _ := out[1].([]interface{})
+	violations := make([]string, 0, len(errs))
+	for _, e := range errs {
+		if m, ok := e.(map[string]interface{}); ok {
+			if msg, ok := m["error"].(string); ok {
+				violations = append(violations, msg)
+				continue
+			}
+		}
+		violations = append(violations, fmt.Sprint(e))
+	}
+	if len(violations) == 0 {
+		violations = append(violations, "document does not match schema")
+	}
+	return violations, nil
+}
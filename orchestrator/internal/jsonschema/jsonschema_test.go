@@ -0,0 +1,40 @@
+package jsonschema
+
+import (
+	"context"
+	"encoding/json"
+	"strings"
+	"testing"
+)
+
+func TestValidate(t *testing.T) {
+	ctx := context.Background()
+	schema := json.RawMessage(`{"type":"object","properties":{"temp":{"type":"number"}},"required":["temp"]}`)
+
+	violations, err := Validate(ctx, schema, json.RawMessage(`{"temp":21.5}`))
+	if err != nil || len(violations) != 0 {
+		t.Fatalf("expected conforming document, got %v %v", violations, err)
+	}
+
+	violations, err = Validate(ctx, schema, json.RawMessage(`{"temp":"warm"}`))
+	if err != nil {
+		t.Fatalf("Validate: %v", err)
+	}
+	if len(violations) != 1 || !strings.Contains(violations[0], "temp") {
+		t.Fatalf("expected a violation for temp, got %v", violations)
+	}
+
+	if violations, _ := Validate(ctx, schema, nil); len(violations) == 0 {
+		t.Fatal("expected a missing document to violate an object schema")
+	}
+	if violations, _ := Validate(ctx, schema, json.RawMessage(`{not json`)); len(violations) == 0 {
+		t.Fatal("expected malformed JSON to be a violation")
+	}
+
+	if _, err := Validate(ctx, json.RawMessage(`{"type":`), json.RawMessage(`{}`)); err == nil {
+		t.Fatal("expected malformed schema to be an error")
+	}
+	if _, err := Validate(ctx, json.RawMessage(`{"type":"nonsense"}`), json.RawMessage(`{}`)); err == nil {
+		t.Fatal("expected invalid schema to be an error")
+	}
+}
@@ -0,0 +1,33 @@
+package logging
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"testing"
+
+	"go.opentelemetry.io/otel/trace"
+)
+
+func TestNewJSONLevelAndTraceID(t *testing.T) {
+	var buf bytes.Buffer
+	logger := New(&buf, "info", FormatJSON)
+
+	logger.Debug("dropped")
+	if buf.Len() != 0 {
+		t.Fatalf("debug record written at info level: %s", buf.String())
+	}
+
+	traceID, _ := trace.TraceIDFromHex("0102030405060708090a0b0c0d0e0f10")
+	spanID, _ := trace.SpanIDFromHex("0102030405060708")
+	ctx := trace.ContextWithSpanContext(context.Background(), trace.NewSpanContext(trace.SpanContextConfig{TraceID: traceID, SpanID: spanID}))
+	logger.With("run_id", "run_1").WarnContext(ctx, "agent failed", "error", "boom")
+
+	var record map[string]interface{}
+	if err := json.Unmarshal(buf.Bytes(), &record); err != nil {
+		t.Fatalf("record is not JSON: %v (%s)", err, buf.String())
+	}
+	if record["level"] != "WARN" || record["msg"] != "agent failed" || record["run_id"] != "run_1" || record["error"] != "boom" || record["trace_id"] != traceID.String() {
+		t.Fatalf("unexpected record: %v", record)
+	}
+}
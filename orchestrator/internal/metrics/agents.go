@@ -0,0 +1,48 @@
+package metrics
+
+import (
+	"context"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+
+	"github.com/xiaot623/gogo/orchestrator/internal/service"
+)
+
+// agentLoadTimeout bounds the store query made on each scrape.
+const agentLoadTimeout = 2 * time.Second
+
+// AgentLoadCollector reports the runs currently targeting each agent.
+type AgentLoadCollector struct {
+	svc *service.Service
+
+	activeRuns *prometheus.Desc
+}
+
+// NewAgentLoadCollector creates a collector for the given service.
+func NewAgentLoadCollector(svc *service.Service) *AgentLoadCollector {
+	return &AgentLoadCollector{
+		svc:        svc,
+		activeRuns: prometheus.NewDesc("orchestrator_agent_active_runs", "Runs in CREATED or RUNNING status, by root agent.", []string{"agent_id"}, nil),
+	}
+}
+
+// Describe implements prometheus.Collector.
+func (c *AgentLoadCollector) Describe(ch chan<- *prometheus.Desc) {
+	ch <- c.activeRuns
+}
+
+// Collect implements prometheus.Collector. A failed query reports an invalid
+// metric, so the scrape shows the error instead of silently missing agents.
+func (c *AgentLoadCollector) Collect(ch chan<- prometheus.Metric) {
+	ctx, cancel := context.WithTimeout(context.Background(), agentLoadTimeout)
+	defer cancel()
+	counts, err := c.svc.ActiveRunsByAgent(ctx)
+	if err != nil {
+		ch <- prometheus.NewInvalidMetric(c.activeRuns, err)
+		return
+	}
+	for agentID, n := range counts {
+		ch <- prometheus.MustNewConstMetric(c.activeRuns, prometheus.GaugeValue, float64(n), agentID)
+	}
+}
@@ -0,0 +1,39 @@
+package metrics
+
+import (
+	"github.com/prometheus/client_golang/prometheus"
+
+	"github.com/xiaot623/gogo/orchestrator/internal/adapter/llm"
+)
+
+// BreakerCollector reports the LiteLLM circuit breaker state.
+type BreakerCollector struct {
+	breaker *llm.Breaker
+
+	state       *prometheus.Desc
+	transitions *prometheus.Desc
+}
+
+// NewBreakerCollector creates a collector for the given breaker.
+func NewBreakerCollector(breaker *llm.Breaker) *BreakerCollector {
+	return &BreakerCollector{
+		breaker:     breaker,
+		state:       prometheus.NewDesc("orchestrator_llm_breaker_state", "LLM upstream circuit breaker state (0 = closed, 1 = half-open, 2 = open).", nil, nil),
+		transitions: prometheus.NewDesc("orchestrator_llm_breaker_transitions_total", "LLM upstream circuit breaker state changes by the state entered.", []string{"state"}, nil),
+	}
+}
+
+// Describe implements prometheus.Collector.
+func (c *BreakerCollector) Describe(ch chan<- *prometheus.Desc) {
+	ch <- c.state
+	ch <- c.transitions
+}
+
+// Collect implements prometheus.Collector.
+func (c *BreakerCollector) Collect(ch chan<- prometheus.Metric) {
+	stats := c.breaker.Stats()
+	ch <- prometheus.MustNewConstMetric(c.state, prometheus.GaugeValue, float64(stats.State))
+	for _, state := range []llm.BreakerState{llm.BreakerClosed, llm.BreakerHalfOpen, llm.BreakerOpen} {
+		ch <- prometheus.MustNewConstMetric(c.transitions, prometheus.CounterValue, float64(stats.Transitions[state]), state.String())
+	}
+}
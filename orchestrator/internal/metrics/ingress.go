@@ -0,0 +1,48 @@
+package metrics
+
+import (
+	"github.com/prometheus/client_golang/prometheus"
+
+	"github.com/xiaot623/gogo/orchestrator/internal/adapter/ingress"
+)
+
+// IngressQueueCollector reports the per-session ingress push queues and the
+// event streams ingress instances hold open.
+type IngressQueueCollector struct {
+	client *ingress.Client
+
+	depth          *prometheus.Desc
+	dropped        *prometheus.Desc
+	streams        *prometheus.Desc
+	streamSessions *prometheus.Desc
+}
+
+// NewIngressQueueCollector creates a collector for the given ingress client.
+func NewIngressQueueCollector(client *ingress.Client) *IngressQueueCollector {
+	return &IngressQueueCollector{
+		client:         client,
+		depth:          prometheus.NewDesc("orchestrator_ingress_push_queue_depth", "Events waiting on the per-session ingress push queues.", nil, nil),
+		dropped:        prometheus.NewDesc("orchestrator_ingress_push_dropped_total", "Delta pushes dropped because a session's ingress queue was full.", nil, nil),
+		streams:        prometheus.NewDesc("orchestrator_ingress_event_streams", "Event streams held open by ingress instances.", nil, nil),
+		streamSessions: prometheus.NewDesc("orchestrator_ingress_event_stream_sessions", "Sessions subscribed on at least one ingress event stream.", nil, nil),
+	}
+}
+
+// Describe implements prometheus.Collector.
+func (c *IngressQueueCollector) Describe(ch chan<- *prometheus.Desc) {
+	ch <- c.depth
+	ch <- c.dropped
+	ch <- c.streams
+	ch <- c.streamSessions
+}
+
+// Collect implements prometheus.Collector.
+func (c *IngressQueueCollector) Collect(ch chan<- prometheus.Metric) {
+	stats := c.client.QueueStats()
+	ch <- prometheus.MustNewConstMetric(c.depth, prometheus.GaugeValue, float64(stats.Depth))
+	ch <- prometheus.MustNewConstMetric(c.dropped, prometheus.CounterValue, float64(stats.Dropped))
+
+	streams := c.client.StreamStats()
+	ch <- prometheus.MustNewConstMetric(c.streams, prometheus.GaugeValue, float64(streams.Streams))
+	ch <- prometheus.MustNewConstMetric(c.streamSessions, prometheus.GaugeValue, float64(streams.Sessions))
+}
@@ -0,0 +1,34 @@
+package metrics
+
+import (
+	"github.com/prometheus/client_golang/prometheus"
+
+	"github.com/xiaot623/gogo/orchestrator/internal/service"
+)
+
+// PolicyCollector reports tool calls whose policy evaluation failed.
+type PolicyCollector struct {
+	svc *service.Service
+
+	errors *prometheus.Desc
+}
+
+// NewPolicyCollector creates a collector for the given service.
+func NewPolicyCollector(svc *service.Service) *PolicyCollector {
+	return &PolicyCollector{
+		svc:    svc,
+		errors: prometheus.NewDesc("orchestrator_policy_errors_total", "Tool calls whose policy evaluation failed, by the POLICY_FAIL_MODE decision taken.", []string{"decision"}, nil),
+	}
+}
+
+// Describe implements prometheus.Collector.
+func (c *PolicyCollector) Describe(ch chan<- *prometheus.Desc) {
+	ch <- c.errors
+}
+
+// Collect implements prometheus.Collector.
+func (c *PolicyCollector) Collect(ch chan<- prometheus.Metric) {
+	stats := c.svc.PolicyStats()
+	ch <- prometheus.MustNewConstMetric(c.errors, prometheus.CounterValue, float64(stats.ErrorsAllowed), "allow")
+	ch <- prometheus.MustNewConstMetric(c.errors, prometheus.CounterValue, float64(stats.ErrorsBlocked), "block")
+}
@@ -0,0 +1,51 @@
+// Package metrics exposes orchestrator metrics in Prometheus format.
+package metrics
+
+import (
+	"github.com/prometheus/client_golang/prometheus"
+
+	"github.com/xiaot623/gogo/orchestrator/internal/service"
+)
+
+// StreamCollector reports agent stream concurrency from a single
+// service.StreamStats snapshot per scrape.
+type StreamCollector struct {
+	svc *service.Service
+
+	inFlight *prometheus.Desc
+	queued   *prometheus.Desc
+	max      *prometheus.Desc
+	rejected *prometheus.Desc
+	shed     *prometheus.Desc
+}
+
+// NewStreamCollector creates a collector for the given service.
+func NewStreamCollector(svc *service.Service) *StreamCollector {
+	return &StreamCollector{
+		svc:      svc,
+		inFlight: prometheus.NewDesc("orchestrator_agent_streams_in_flight", "Agent streams currently connected to an agent.", nil, nil),
+		queued:   prometheus.NewDesc("orchestrator_agent_streams_queued", "Invoked runs waiting for an agent stream slot.", nil, nil),
+		max:      prometheus.NewDesc("orchestrator_agent_streams_max", "Maximum concurrent agent streams (0 = unlimited).", nil, nil),
+		rejected: prometheus.NewDesc("orchestrator_agent_streams_rejected_total", "Invokes rejected because stream capacity and queue were exhausted.", nil, nil),
+		shed:     prometheus.NewDesc("orchestrator_agent_streams_shed_total", "Queued runs failed to make room for a higher-priority run.", nil, nil),
+	}
+}
+
+// Describe implements prometheus.Collector.
+func (c *StreamCollector) Describe(ch chan<- *prometheus.Desc) {
+	ch <- c.inFlight
+	ch <- c.queued
+	ch <- c.max
+	ch <- c.rejected
+	ch <- c.shed
+}
+
+// Collect implements prometheus.Collector.
+func (c *StreamCollector) Collect(ch chan<- prometheus.Metric) {
+	stats := c.svc.StreamStats()
+	ch <- prometheus.MustNewConstMetric(c.inFlight, prometheus.GaugeValue, float64(stats.InFlight))
+	ch <- prometheus.MustNewConstMetric(c.queued, prometheus.GaugeValue, float64(stats.Queued))
+	ch <- prometheus.MustNewConstMetric(c.max, prometheus.GaugeValue, float64(stats.Max))
+	ch <- prometheus.MustNewConstMetric(c.rejected, prometheus.CounterValue, float64(stats.Rejected))
+	ch <- prometheus.MustNewConstMetric(c.shed, prometheus.CounterValue, float64(stats.Shed))
+}
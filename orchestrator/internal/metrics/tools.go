@@ -0,0 +1,50 @@
+package metrics
+
+import (
+	"github.com/prometheus/client_golang/prometheus"
+
+	"github.com/xiaot623/gogo/orchestrator/internal/service"
+)
+
+// ToolCollector reports tool call outcomes per tool.
+type ToolCollector struct {
+	svc *service.Service
+
+	invocations *prometheus.Desc
+	results     *prometheus.Desc
+	approvals   *prometheus.Desc
+}
+
+// NewToolCollector creates a collector for the given service.
+func NewToolCollector(svc *service.Service) *ToolCollector {
+	return &ToolCollector{
+		svc:         svc,
+		invocations: prometheus.NewDesc("orchestrator_tool_invocations_total", "Tool calls created, by tool and policy decision.", []string{"tool", "decision"}, nil),
+		results:     prometheus.NewDesc("orchestrator_tool_results_total", "Tool calls completed, by tool and terminal status.", []string{"tool", "status"}, nil),
+		approvals:   prometheus.NewDesc("orchestrator_approvals_total", "Approval decisions, by tool and decision.", []string{"tool", "decision"}, nil),
+	}
+}
+
+// Describe implements prometheus.Collector.
+func (c *ToolCollector) Describe(ch chan<- *prometheus.Desc) {
+	ch <- c.invocations
+	ch <- c.results
+	ch <- c.approvals
+}
+
+// Collect implements prometheus.Collector.
+func (c *ToolCollector) Collect(ch chan<- prometheus.Metric) {
+	stats := c.svc.ToolStats()
+	for _, counter := range []struct {
+		desc   *prometheus.Desc
+		counts map[service.ToolOutcome]int64
+	}{
+		{c.invocations, stats.Invocations},
+		{c.results, stats.Results},
+		{c.approvals, stats.Approvals},
+	} {
+		for key, n := range counter.counts {
+			ch <- prometheus.MustNewConstMetric(counter.desc, prometheus.CounterValue, float64(n), key.Tool, key.Outcome)
+		}
+	}
+}
@@ -0,0 +1,23 @@
+// Package moderation screens conversation content (user input and assistant
+// output) before it is used, for deployments with compliance requirements.
+package moderation
+
+import "context"
+
+// Moderator decides whether content may be used. role is the author of the
+// content ("user" or "assistant"); when content is not allowed, reason says
+// why and is reported to the client.
+type Moderator interface {
+	Check(ctx context.Context, role, content string) (allowed bool, reason string)
+}
+
+// Noop allows all content.
+type Noop struct{}
+
+// Check implements Moderator.
+func (Noop) Check(ctx context.Context, role, content string) (bool, string) {
+	return true, ""
+}
+
+// Default is the moderator used when none is injected.
+var Default Moderator = Noop{}
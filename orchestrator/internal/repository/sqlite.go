@@ -5,20 +5,70 @@ import (
 	"database/sql"
 	"encoding/json"
 	"fmt"
+	"log/slog"
+	"slices"
 	"strings"
 	"time"
 
 	_ "github.com/mattn/go-sqlite3"
+	"github.com/xiaot623/gogo/orchestrator/internal/clock"
 	"github.com/xiaot623/gogo/orchestrator/internal/domain"
 )
 
 // SQLiteStore implements Store using SQLite.
 type SQLiteStore struct {
 	db *sql.DB
+	// readDB serves the heavy read queries (GetEvents, GetMessages,
+	// ListRuns). It is db itself unless a separate read DSN was given, in
+	// which case those reads may lag behind writes made through db.
+	readDB *sql.DB
+	clock  clock.Clock
 }
 
 // NewSQLiteStore creates a new SQLite store.
 func NewSQLiteStore(dsn string) (*SQLiteStore, error) {
+	return NewSQLiteStoreWithReadDSN(dsn, "")
+}
+
+// NewSQLiteStoreWithReadDSN creates a SQLite store that writes through dsn
+// and sends the heavy read queries to readDSN, e.g. a read replica. An empty
+// readDSN, or one equal to dsn, reads through the write pool. Migrations only
+// run on the write pool.
+//
+// Reads routed to a replica are eventually consistent: a run, event or
+// message written moments ago may not be visible yet.
+func NewSQLiteStoreWithReadDSN(dsn, readDSN string) (*SQLiteStore, error) {
+	db, err := openSQLite(dsn)
+	if err != nil {
+		return nil, err
+	}
+
+	store := &SQLiteStore{db: db, readDB: db, clock: clock.Default}
+	if err := store.migrate(); err != nil {
+		db.Close()
+		return nil, fmt.Errorf("failed to migrate database: %w", err)
+	}
+
+	if readDSN != "" && readDSN != dsn {
+		readDB, err := openSQLite(readDSN)
+		if err != nil {
+			db.Close()
+			return nil, fmt.Errorf("read database: %w", err)
+		}
+		store.readDB = readDB
+	}
+
+	// Seed tools
+	if err := store.seedTools(); err != nil {
+		slog.Warn("failed to seed tools", "error", err)
+		// Don't fail startup for this
+	}
+
+	return store, nil
+}
+
+// openSQLite opens a connection pool for dsn with foreign keys enabled.
+func openSQLite(dsn string) (*sql.DB, error) {
 	db, err := sql.Open("sqlite3", dsn)
 	if err != nil {
 		return nil, fmt.Errorf("failed to open database: %w", err)
@@ -35,20 +85,15 @@ func NewSQLiteStore(dsn string) (*SQLiteStore, error) {
 		db.Close()
 		return nil, fmt.Errorf("failed to enable foreign keys: %w", err)
 	}
+	return db, nil
+}
 
-	store := &SQLiteStore{db: db}
-	if err := store.migrate(); err != nil {
-		db.Close()
-		return nil, fmt.Errorf("failed to migrate database: %w", err)
-	}
-
-	// Seed tools
-	if err := store.seedTools(); err != nil {
-		fmt.Printf("Failed to seed tools: %v\n", err)
-		// Don't fail startup for this
+// SetClock overrides the clock used for the timestamps the store sets itself
+// (completed_at, decided_at, ...).
+func (s *SQLiteStore) SetClock(c clock.Clock) {
+	if c != nil {
+		s.clock = c
 	}
-
-	return store, nil
 }
 
 // migrate runs database migrations.
@@ -83,6 +128,7 @@ func (s *SQLiteStore) migrate() error {
 			FOREIGN KEY (session_id) REFERENCES sessions(session_id)
 		)`,
 		`CREATE INDEX IF NOT EXISTS idx_runs_session ON runs(session_id, started_at)`,
+		`CREATE INDEX IF NOT EXISTS idx_runs_agent_status ON runs(root_agent_id, status)`,
 		`CREATE TABLE IF NOT EXISTS events (
 			event_id TEXT PRIMARY KEY,
 			run_id TEXT NOT NULL,
@@ -111,7 +157,6 @@ func (s *SQLiteStore) migrate() error {
 			timeout_ms INTEGER NOT NULL DEFAULT 60000,
 			metadata TEXT
 		)`,
-		`CREATE INDEX IF NOT EXISTS idx_tools_client ON tools(client_id)`,
 		`CREATE TABLE IF NOT EXISTS tool_calls (
 			tool_call_id TEXT PRIMARY KEY,
 			run_id TEXT NOT NULL,
@@ -142,6 +187,27 @@ func (s *SQLiteStore) migrate() error {
 			FOREIGN KEY (run_id) REFERENCES runs(run_id),
 			FOREIGN KEY (tool_call_id) REFERENCES tool_calls(tool_call_id)
 		)`,
+		`CREATE INDEX IF NOT EXISTS idx_approvals_status_created ON approvals(status, created_at)`,
+		`CREATE TABLE IF NOT EXISTS remembered_approvals (
+			scope TEXT NOT NULL,
+			user_id TEXT NOT NULL DEFAULT '',
+			session_id TEXT NOT NULL DEFAULT '',
+			tool_name TEXT NOT NULL,
+			approval_id TEXT NOT NULL,
+			created_at DATETIME NOT NULL,
+			expires_at DATETIME NOT NULL,
+			PRIMARY KEY (scope, user_id, session_id, tool_name)
+		)`,
+		`CREATE TABLE IF NOT EXISTS request_nonces (
+			kind TEXT NOT NULL,
+			nonce TEXT NOT NULL,
+			target_id TEXT NOT NULL,
+			response TEXT,
+			created_at DATETIME NOT NULL,
+			expires_at DATETIME NOT NULL,
+			PRIMARY KEY (kind, nonce)
+		)`,
+		`CREATE INDEX IF NOT EXISTS idx_request_nonces_expires ON request_nonces(expires_at)`,
 	}
 
 	for _, m := range migrations {
@@ -151,6 +217,20 @@ func (s *SQLiteStore) migrate() error {
 	}
 
 	// Add new columns for existing DBs (SQLite has limited ALTER TABLE support).
+	// Databases created by the early store have a tools table without the
+	// schema, client_id and timeout_ms columns.
+	if err := s.ensureColumn("tools", "schema", "ALTER TABLE tools ADD COLUMN schema TEXT"); err != nil {
+		return err
+	}
+	if err := s.ensureColumn("tools", "client_id", "ALTER TABLE tools ADD COLUMN client_id TEXT"); err != nil {
+		return err
+	}
+	if err := s.ensureColumn("tools", "timeout_ms", "ALTER TABLE tools ADD COLUMN timeout_ms INTEGER NOT NULL DEFAULT 60000"); err != nil {
+		return err
+	}
+	if _, err := s.db.Exec(`CREATE INDEX IF NOT EXISTS idx_tools_client ON tools(client_id)`); err != nil {
+		return err
+	}
 	if err := s.ensureColumn("tool_calls", "timeout_ms", "ALTER TABLE tool_calls ADD COLUMN timeout_ms INTEGER NOT NULL DEFAULT 60000"); err != nil {
 		return err
 	}
@@ -160,6 +240,97 @@ func (s *SQLiteStore) migrate() error {
 	if _, err := s.db.Exec(`CREATE INDEX IF NOT EXISTS idx_tool_calls_idempotency ON tool_calls(run_id, tool_name, idempotency_key, created_at)`); err != nil {
 		return err
 	}
+	if err := s.ensureColumn("runs", "total_tokens", "ALTER TABLE runs ADD COLUMN total_tokens INTEGER NOT NULL DEFAULT 0"); err != nil {
+		return err
+	}
+	if err := s.ensureColumn("agents", "headers", "ALTER TABLE agents ADD COLUMN headers TEXT"); err != nil {
+		return err
+	}
+	if err := s.ensureColumn("agents", "protocol", "ALTER TABLE agents ADD COLUMN protocol TEXT NOT NULL DEFAULT ''"); err != nil {
+		return err
+	}
+	if err := s.ensureColumn("agents", "response_format", "ALTER TABLE agents ADD COLUMN response_format TEXT NOT NULL DEFAULT ''"); err != nil {
+		return err
+	}
+	if err := s.ensureColumn("agents", "cancel_url", "ALTER TABLE agents ADD COLUMN cancel_url TEXT NOT NULL DEFAULT ''"); err != nil {
+		return err
+	}
+	if err := s.ensureColumn("agents", "last_error", "ALTER TABLE agents ADD COLUMN last_error TEXT"); err != nil {
+		return err
+	}
+	if err := s.ensureColumn("agents", "consecutive_failures", "ALTER TABLE agents ADD COLUMN consecutive_failures INTEGER NOT NULL DEFAULT 0"); err != nil {
+		return err
+	}
+	if err := s.ensureColumn("agents", "llm_config", "ALTER TABLE agents ADD COLUMN llm_config TEXT"); err != nil {
+		return err
+	}
+	if err := s.ensureColumn("agents", "max_concurrent_tool_calls", "ALTER TABLE agents ADD COLUMN max_concurrent_tool_calls INTEGER NOT NULL DEFAULT 0"); err != nil {
+		return err
+	}
+	if err := s.ensureColumn("agents", "request_filter", "ALTER TABLE agents ADD COLUMN request_filter TEXT"); err != nil {
+		return err
+	}
+	if err := s.ensureColumn("events", "seq", "ALTER TABLE events ADD COLUMN seq INTEGER NOT NULL DEFAULT 0"); err != nil {
+		return err
+	}
+	// Backfill seq for events written before the column existed, in (ts, insertion) order.
+	if _, err := s.db.Exec(`UPDATE events SET seq = (
+		SELECT COUNT(*) FROM events e2
+		WHERE e2.run_id = events.run_id AND (e2.ts < events.ts OR (e2.ts = events.ts AND e2.rowid <= events.rowid))
+	) WHERE seq = 0`); err != nil {
+		return err
+	}
+	if _, err := s.db.Exec(`CREATE INDEX IF NOT EXISTS idx_events_run_seq ON events(run_id, ts, seq)`); err != nil {
+		return err
+	}
+	// Renumber runs that ended up with two events on one seq, so seq can be
+	// made unique per run.
+	if _, err := s.db.Exec(`UPDATE events SET seq = ranked.rn FROM (
+		SELECT rowid AS rid, ROW_NUMBER() OVER (PARTITION BY run_id ORDER BY seq, rowid) AS rn
+		FROM events
+		WHERE run_id IN (SELECT run_id FROM events GROUP BY run_id, seq HAVING COUNT(*) > 1)
+	) AS ranked WHERE events.rowid = ranked.rid`); err != nil {
+		return err
+	}
+	if _, err := s.db.Exec(`DROP INDEX IF EXISTS idx_events_run_order`); err != nil {
+		return err
+	}
+	if _, err := s.db.Exec(`CREATE UNIQUE INDEX IF NOT EXISTS idx_events_run_seq_unique ON events(run_id, seq)`); err != nil {
+		return err
+	}
+	if err := s.ensureColumn("runs", "archive_location", "ALTER TABLE runs ADD COLUMN archive_location TEXT"); err != nil {
+		return err
+	}
+	if err := s.ensureColumn("runs", "restored_at", "ALTER TABLE runs ADD COLUMN restored_at DATETIME"); err != nil {
+		return err
+	}
+	if err := s.ensureColumn("runs", "deadline_at", "ALTER TABLE runs ADD COLUMN deadline_at DATETIME"); err != nil {
+		return err
+	}
+	if _, err := s.db.Exec(`CREATE INDEX IF NOT EXISTS idx_messages_run ON messages(run_id)`); err != nil {
+		return err
+	}
+	if err := s.ensureColumn("tools", "result_schema", "ALTER TABLE tools ADD COLUMN result_schema TEXT"); err != nil {
+		return err
+	}
+	if err := s.ensureColumn("tool_calls", "progress_seq", "ALTER TABLE tool_calls ADD COLUMN progress_seq INTEGER NOT NULL DEFAULT 0"); err != nil {
+		return err
+	}
+	if err := s.ensureColumn("tool_calls", "progress_chunks", "ALTER TABLE tool_calls ADD COLUMN progress_chunks INTEGER NOT NULL DEFAULT 0"); err != nil {
+		return err
+	}
+	if err := s.ensureColumn("runs", "tags", "ALTER TABLE runs ADD COLUMN tags TEXT"); err != nil {
+		return err
+	}
+	if err := s.ensureColumn("runs", "request_id", "ALTER TABLE runs ADD COLUMN request_id TEXT"); err != nil {
+		return err
+	}
+	if _, err := s.db.Exec(`CREATE INDEX IF NOT EXISTS idx_runs_session_request ON runs(session_id, request_id)`); err != nil {
+		return err
+	}
+	if err := s.ensureColumn("runs", "priority", "ALTER TABLE runs ADD COLUMN priority TEXT NOT NULL DEFAULT 'normal'"); err != nil {
+		return err
+	}
 
 	return nil
 }
@@ -209,6 +380,7 @@ func (s *SQLiteStore) seedTools() error {
 			Name:      "payments.transfer",
 			Kind:      domain.ToolKindServer,
 			TimeoutMs: 10000,
+			Metadata:  json.RawMessage(`{"approval_summary":"Transfer {amount} {currency} to {recipient}"}`),
 		},
 		{
 			Name:      "dangerous.command",
@@ -228,9 +400,28 @@ func (s *SQLiteStore) seedTools() error {
 	return nil
 }
 
-// Close closes the database connection.
+// Close closes the database connections.
 func (s *SQLiteStore) Close() error {
-	return s.db.Close()
+	err := s.db.Close()
+	if s.readDB != s.db {
+		if rerr := s.readDB.Close(); err == nil {
+			err = rerr
+		}
+	}
+	return err
+}
+
+// Ping verifies the database connections are usable.
+func (s *SQLiteStore) Ping(ctx context.Context) error {
+	if err := s.db.PingContext(ctx); err != nil {
+		return fmt.Errorf("failed to ping database: %w", err)
+	}
+	if s.readDB != s.db {
+		if err := s.readDB.PingContext(ctx); err != nil {
+			return fmt.Errorf("failed to ping read database: %w", err)
+		}
+	}
+	return nil
 }
 
 // CreateSession creates a new session.
@@ -275,7 +466,7 @@ func (s *SQLiteStore) GetOrCreateSession(ctx context.Context, sessionID, userID
 	session = &domain.Session{
 		SessionID: sessionID,
 		UserID:    userID,
-		CreatedAt: time.Now(),
+		CreatedAt: s.clock.Now(),
 	}
 	if err := s.CreateSession(ctx, session); err != nil {
 		return nil, err
@@ -283,6 +474,59 @@ func (s *SQLiteStore) GetOrCreateSession(ctx context.Context, sessionID, userID
 	return session, nil
 }
 
+// UpdateSessionMetadata merges or replaces a session's metadata.
+func (s *SQLiteStore) UpdateSessionMetadata(ctx context.Context, sessionID string, metadata json.RawMessage, replace bool) (*domain.Session, error) {
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	var session domain.Session
+	var current sql.NullString
+	err = tx.QueryRowContext(ctx,
+		`SELECT session_id, user_id, created_at, metadata FROM sessions WHERE session_id = ?`,
+		sessionID).Scan(&session.SessionID, &session.UserID, &session.CreatedAt, &current)
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	merged := map[string]json.RawMessage{}
+	if !replace && current.Valid && current.String != "" && current.String != "null" {
+		if err := json.Unmarshal([]byte(current.String), &merged); err != nil {
+			return nil, fmt.Errorf("existing metadata is not an object: %w", err)
+		}
+	}
+	var patch map[string]json.RawMessage
+	if err := json.Unmarshal(metadata, &patch); err != nil {
+		return nil, fmt.Errorf("metadata must be a JSON object: %w", err)
+	}
+	for k, v := range patch {
+		if string(v) == "null" {
+			delete(merged, k)
+		} else {
+			merged[k] = v
+		}
+	}
+
+	data, err := json.Marshal(merged)
+	if err != nil {
+		return nil, err
+	}
+	if _, err := tx.ExecContext(ctx, `UPDATE sessions SET metadata = ? WHERE session_id = ?`, string(data), sessionID); err != nil {
+		return nil, err
+	}
+	if err := tx.Commit(); err != nil {
+		return nil, err
+	}
+
+	session.Metadata = data
+	return &session, nil
+}
+
 // CreateMessage creates a new message.
 func (s *SQLiteStore) CreateMessage(ctx context.Context, message *domain.Message) error {
 	metadata, _ := json.Marshal(message.Metadata)
@@ -292,8 +536,40 @@ func (s *SQLiteStore) CreateMessage(ctx context.Context, message *domain.Message
 	return err
 }
 
-// GetMessages retrieves messages for a session.
-func (s *SQLiteStore) GetMessages(ctx context.Context, sessionID string, limit int, before string) ([]domain.Message, error) {
+// createMessagesBatch is how many rows one INSERT of CreateMessages carries,
+// keeping its bound parameters well under SQLite's limit.
+const createMessagesBatch = 100
+
+// CreateMessages inserts messages in one transaction with multi-row INSERTs,
+// in the order given so that messages with equal created_at keep it.
+func (s *SQLiteStore) CreateMessages(ctx context.Context, messages []domain.Message) error {
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	for start := 0; start < len(messages); start += createMessagesBatch {
+		batch := messages[start:min(start+createMessagesBatch, len(messages))]
+		rows := make([]string, len(batch))
+		args := make([]interface{}, 0, len(batch)*7)
+		for i, msg := range batch {
+			metadata, _ := json.Marshal(msg.Metadata)
+			rows[i] = "(?, ?, ?, ?, ?, ?, ?)"
+			args = append(args, msg.MessageID, msg.SessionID, msg.RunID, msg.Role, msg.Content, msg.CreatedAt, string(metadata))
+		}
+		if _, err := tx.ExecContext(ctx,
+			`INSERT INTO messages (message_id, session_id, run_id, role, content, created_at, metadata) VALUES `+strings.Join(rows, ", "),
+			args...); err != nil {
+			return err
+		}
+	}
+	return tx.Commit()
+}
+
+// GetMessages retrieves messages for a session, optionally restricted to some
+// roles or to a single run.
+func (s *SQLiteStore) GetMessages(ctx context.Context, sessionID string, limit int, before string, filter domain.MessageFilter) ([]domain.Message, error) {
 	query := `SELECT message_id, session_id, run_id, role, content, created_at, metadata FROM messages WHERE session_id = ?`
 	args := []interface{}{sessionID}
 
@@ -302,17 +578,58 @@ func (s *SQLiteStore) GetMessages(ctx context.Context, sessionID string, limit i
 		args = append(args, before)
 	}
 
+	if filter.RunID != "" {
+		query += ` AND run_id = ?`
+		args = append(args, filter.RunID)
+	}
+
+	if len(filter.Roles) > 0 {
+		placeholders := make([]string, len(filter.Roles))
+		for i, r := range filter.Roles {
+			placeholders[i] = "?"
+			args = append(args, r)
+		}
+		query += fmt.Sprintf(" AND role IN (%s)", strings.Join(placeholders, ","))
+	}
+
 	query += ` ORDER BY created_at ASC`
 	if limit > 0 {
 		query += fmt.Sprintf(" LIMIT %d", limit)
 	}
 
-	rows, err := s.db.QueryContext(ctx, query, args...)
+	rows, err := s.readDB.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	return scanMessages(rows)
+}
+
+// GetRecentMessages returns a session's latest limit messages (all when
+// limit <= 0) in chronological order.
+func (s *SQLiteStore) GetRecentMessages(ctx context.Context, sessionID string, limit int) ([]domain.Message, error) {
+	query := `SELECT message_id, session_id, run_id, role, content, created_at, metadata FROM messages WHERE session_id = ?
+		ORDER BY created_at DESC, rowid DESC`
+	if limit > 0 {
+		query += fmt.Sprintf(" LIMIT %d", limit)
+	}
+
+	rows, err := s.db.QueryContext(ctx, query, sessionID)
 	if err != nil {
 		return nil, err
 	}
 	defer rows.Close()
+	messages, err := scanMessages(rows)
+	if err != nil {
+		return nil, err
+	}
+	for i, j := 0, len(messages)-1; i < j; i, j = i+1, j-1 {
+		messages[i], messages[j] = messages[j], messages[i]
+	}
+	return messages, nil
+}
 
+func scanMessages(rows *sql.Rows) ([]domain.Message, error) {
 	var messages []domain.Message
 	for rows.Next() {
 		var msg domain.Message
@@ -333,42 +650,203 @@ func (s *SQLiteStore) GetMessages(ctx context.Context, sessionID string, limit i
 
 // CreateRun creates a new run.
 func (s *SQLiteStore) CreateRun(ctx context.Context, run *domain.Run) error {
+	args, err := runInsertArgs(run)
+	if err != nil {
+		return err
+	}
+	_, err = s.db.ExecContext(ctx,
+		`INSERT INTO runs (run_id, session_id, root_agent_id, parent_run_id, status, started_at, tags, deadline_at, request_id, priority) VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`,
+		args...)
+	return err
+}
+
+// CreateRunIdempotent inserts a run guarded by its session's request_id. The
+// existence check and the insert are a single statement, so concurrent
+// invokes with the same request_id cannot both insert.
+func (s *SQLiteStore) CreateRunIdempotent(ctx context.Context, run *domain.Run) (*domain.Run, error) {
+	if run.RequestID == "" {
+		return nil, s.CreateRun(ctx, run)
+	}
+	args, err := runInsertArgs(run)
+	if err != nil {
+		return nil, err
+	}
+	res, err := s.db.ExecContext(ctx,
+		`INSERT INTO runs (run_id, session_id, root_agent_id, parent_run_id, status, started_at, tags, deadline_at, request_id, priority)
+		 SELECT ?, ?, ?, ?, ?, ?, ?, ?, ?, ?
+		 WHERE NOT EXISTS (SELECT 1 FROM runs WHERE session_id = ? AND request_id = ?)`,
+		append(args, run.SessionID, run.RequestID)...)
+	if err != nil {
+		return nil, err
+	}
+	affected, err := res.RowsAffected()
+	if err != nil {
+		return nil, err
+	}
+	if affected > 0 {
+		return nil, nil
+	}
+	existing, err := s.GetRunByRequestID(ctx, run.SessionID, run.RequestID)
+	if err != nil {
+		return nil, err
+	}
+	if existing == nil {
+		return nil, fmt.Errorf("run for request %s disappeared", run.RequestID)
+	}
+	return existing, nil
+}
+
+// runInsertArgs returns the values of a run's INSERT INTO runs columns.
+func runInsertArgs(run *domain.Run) ([]interface{}, error) {
 	var parentRunID sql.NullString
 	if run.ParentRunID != "" {
 		parentRunID = sql.NullString{String: run.ParentRunID, Valid: true}
 	}
-	_, err := s.db.ExecContext(ctx,
-		`INSERT INTO runs (run_id, session_id, root_agent_id, parent_run_id, status, started_at) VALUES (?, ?, ?, ?, ?, ?)`,
-		run.RunID, run.SessionID, run.RootAgentID, parentRunID, run.Status, run.StartedAt)
-	return err
+	var tags sql.NullString
+	if len(run.Tags) > 0 {
+		data, err := json.Marshal(run.Tags)
+		if err != nil {
+			return nil, err
+		}
+		tags = sql.NullString{String: string(data), Valid: true}
+	}
+	var deadlineAt sql.NullTime
+	if run.DeadlineAt != nil {
+		deadlineAt = sql.NullTime{Time: *run.DeadlineAt, Valid: true}
+	}
+	priority := run.Priority
+	if priority == "" {
+		priority = domain.RunPriorityNormal
+	}
+	return []interface{}{run.RunID, run.SessionID, run.RootAgentID, parentRunID, run.Status, run.StartedAt, tags, deadlineAt, nullString(run.RequestID), priority}, nil
+}
+
+// GetRunByRequestID retrieves the run created for a session's request_id.
+// Returns nil if there is none.
+func (s *SQLiteStore) GetRunByRequestID(ctx context.Context, sessionID, requestID string) (*domain.Run, error) {
+	run, err := scanRun(s.db.QueryRowContext(ctx,
+		`SELECT `+runColumns+` FROM runs WHERE session_id = ? AND request_id = ? ORDER BY julianday(started_at) ASC LIMIT 1`,
+		sessionID, requestID))
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return run, nil
 }
 
 // GetRun retrieves a run by ID.
 func (s *SQLiteStore) GetRun(ctx context.Context, runID string) (*domain.Run, error) {
-	var run domain.Run
-	var parentRunID, errData sql.NullString
-	var endedAt sql.NullTime
-	err := s.db.QueryRowContext(ctx,
-		`SELECT run_id, session_id, root_agent_id, parent_run_id, status, started_at, ended_at, error FROM runs WHERE run_id = ?`,
-		runID).Scan(&run.RunID, &run.SessionID, &run.RootAgentID, &parentRunID, &run.Status, &run.StartedAt, &endedAt, &errData)
+	run, err := scanRun(s.db.QueryRowContext(ctx,
+		`SELECT `+runColumns+` FROM runs WHERE run_id = ?`, runID))
 	if err == sql.ErrNoRows {
 		return nil, nil
 	}
 	if err != nil {
 		return nil, err
 	}
+	return run, nil
+}
+
+const runColumns = `run_id, session_id, root_agent_id, parent_run_id, status, started_at, ended_at, error, total_tokens, archive_location, tags, deadline_at, request_id, priority`
+
+// scanRun scans a row selected with runColumns.
+func scanRun(row interface{ Scan(...interface{}) error }) (*domain.Run, error) {
+	var run domain.Run
+	var parentRunID, errData, archiveLocation, tags, requestID sql.NullString
+	var endedAt, deadlineAt sql.NullTime
+	if err := row.Scan(&run.RunID, &run.SessionID, &run.RootAgentID, &parentRunID, &run.Status, &run.StartedAt, &endedAt, &errData, &run.TotalTokens, &archiveLocation, &tags, &deadlineAt, &requestID, &run.Priority); err != nil {
+		return nil, err
+	}
+	run.RequestID = requestID.String
 	if parentRunID.Valid {
 		run.ParentRunID = parentRunID.String
 	}
 	if endedAt.Valid {
 		run.EndedAt = &endedAt.Time
 	}
+	if deadlineAt.Valid {
+		run.DeadlineAt = &deadlineAt.Time
+	}
 	if errData.Valid {
 		run.Error = json.RawMessage(errData.String)
 	}
+	if archiveLocation.Valid {
+		run.ArchiveLocation = archiveLocation.String
+	}
+	if tags.Valid {
+		if err := json.Unmarshal([]byte(tags.String), &run.Tags); err != nil {
+			return nil, fmt.Errorf("invalid tags for run %s: %w", run.RunID, err)
+		}
+	}
 	return &run, nil
 }
 
+// ListRuns lists runs ordered by (started_at, run_id) descending. Timestamps
+// are compared through julianday() so values written with different zone
+// offsets still order correctly.
+func (s *SQLiteStore) ListRuns(ctx context.Context, filter domain.RunFilter) ([]domain.Run, error) {
+	query := `SELECT ` + runColumns + ` FROM runs WHERE 1 = 1`
+	var args []interface{}
+
+	if filter.Status != "" {
+		query += ` AND status = ?`
+		args = append(args, filter.Status)
+	}
+	if filter.AgentID != "" {
+		query += ` AND root_agent_id = ?`
+		args = append(args, filter.AgentID)
+	}
+	if filter.SessionID != "" {
+		query += ` AND session_id = ?`
+		args = append(args, filter.SessionID)
+	}
+	if filter.Tag != "" {
+		query += ` AND EXISTS (SELECT 1 FROM json_each(runs.tags) WHERE json_each.value = ?)`
+		args = append(args, filter.Tag)
+	}
+	if !filter.StartedAfter.IsZero() {
+		query += ` AND julianday(started_at) >= julianday(?)`
+		args = append(args, filter.StartedAfter)
+	}
+	if !filter.StartedBefore.IsZero() {
+		query += ` AND julianday(started_at) < julianday(?)`
+		args = append(args, filter.StartedBefore)
+	}
+	if !filter.BeforeStartedAt.IsZero() {
+		query += ` AND (julianday(started_at) < julianday(?) OR (julianday(started_at) = julianday(?) AND run_id < ?))`
+		args = append(args, filter.BeforeStartedAt, filter.BeforeStartedAt, filter.BeforeRunID)
+	}
+	if filter.Unarchived {
+		query += ` AND archive_location IS NULL`
+	}
+	if filter.Active {
+		query += ` AND ended_at IS NULL`
+	}
+
+	query += ` ORDER BY julianday(started_at) DESC, run_id DESC`
+	if filter.Limit > 0 {
+		query += fmt.Sprintf(" LIMIT %d", filter.Limit)
+	}
+
+	rows, err := s.readDB.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var runs []domain.Run
+	for rows.Next() {
+		run, err := scanRun(rows)
+		if err != nil {
+			return nil, err
+		}
+		runs = append(runs, *run)
+	}
+	return runs, rows.Err()
+}
+
 // UpdateRunStatus updates the status of a run.
 func (s *SQLiteStore) UpdateRunStatus(ctx context.Context, runID string, status domain.RunStatus) error {
 	_, err := s.db.ExecContext(ctx,
@@ -379,7 +857,7 @@ func (s *SQLiteStore) UpdateRunStatus(ctx context.Context, runID string, status
 
 // UpdateRunCompleted updates a run to completed state.
 func (s *SQLiteStore) UpdateRunCompleted(ctx context.Context, runID string, status domain.RunStatus, errData []byte) error {
-	now := time.Now()
+	now := s.clock.Now()
 	var errStr sql.NullString
 	if errData != nil {
 		errStr = sql.NullString{String: string(errData), Valid: true}
@@ -390,24 +868,198 @@ func (s *SQLiteStore) UpdateRunCompleted(ctx context.Context, runID string, stat
 	return err
 }
 
-// CreateEvent creates a new event.
-func (s *SQLiteStore) CreateEvent(ctx context.Context, event *domain.Event) error {
-	payload := ""
-	if event.Payload != nil {
-		payload = string(event.Payload)
+// CompleteRunIfActive updates a run to completed state unless it already is.
+func (s *SQLiteStore) CompleteRunIfActive(ctx context.Context, runID string, status domain.RunStatus, errData []byte) (bool, error) {
+	now := s.clock.Now()
+	var errStr sql.NullString
+	if errData != nil {
+		errStr = sql.NullString{String: string(errData), Valid: true}
 	}
+	res, err := s.db.ExecContext(ctx,
+		`UPDATE runs SET status = ?, ended_at = ?, error = ?
+		 WHERE run_id = ? AND status NOT IN (?, ?, ?)`,
+		status, now, errStr, runID, domain.RunStatusDone, domain.RunStatusFailed, domain.RunStatusCancelled)
+	if err != nil {
+		return false, err
+	}
+	affected, err := res.RowsAffected()
+	if err != nil {
+		return false, err
+	}
+	return affected > 0, nil
+}
+
+// UpdateRunTotalTokens records the authoritative token total for a run.
+func (s *SQLiteStore) UpdateRunTotalTokens(ctx context.Context, runID string, totalTokens int) error {
 	_, err := s.db.ExecContext(ctx,
-		`INSERT INTO events (event_id, run_id, ts, type, payload) VALUES (?, ?, ?, ?, ?)`,
-		event.EventID, event.RunID, event.Ts, event.Type, payload)
+		`UPDATE runs SET total_tokens = ? WHERE run_id = ?`,
+		totalTokens, runID)
 	return err
 }
 
+// SumLLMUsage sums the token counts recorded in a run's llm_call_done events.
+func (s *SQLiteStore) SumLLMUsage(ctx context.Context, runID string) (*domain.LLMUsage, error) {
+	var usage domain.LLMUsage
+	err := s.db.QueryRowContext(ctx,
+		`SELECT COUNT(*),
+			COALESCE(SUM(json_extract(payload, '$.prompt_tokens')), 0),
+			COALESCE(SUM(json_extract(payload, '$.completion_tokens')), 0),
+			COALESCE(SUM(json_extract(payload, '$.total_tokens')), 0)
+		 FROM events WHERE run_id = ? AND type = ?`,
+		runID, domain.EventTypeLLMCallDone).Scan(&usage.Calls, &usage.PromptTokens, &usage.CompletionTokens, &usage.TotalTokens)
+	if err != nil {
+		return nil, err
+	}
+	return &usage, nil
+}
+
+// CreateEvent creates a new event.
+func (s *SQLiteStore) CreateEvent(ctx context.Context, event *domain.Event) error {
+	payload := ""
+	if event.Payload != nil {
+		payload = string(event.Payload)
+	}
+	err := s.db.QueryRowContext(ctx, insertEventSQL,
+		event.EventID, event.RunID, event.Ts, event.Type, payload, event.Seq, event.RunID).Scan(&event.Seq)
+	return eventInsertError(err)
+}
+
+// eventInsertError maps a violation of idx_events_run_seq_unique to
+// ErrEventSeqTaken.
+func eventInsertError(err error) error {
+	if err != nil && strings.Contains(err.Error(), "UNIQUE constraint failed: events.run_id, events.seq") {
+		return ErrEventSeqTaken
+	}
+	return err
+}
+
+// insertEventSQL keeps a seq assigned by the caller. Without one (seq 0) the
+// next seq is allocated in the same statement so concurrent writers to a run
+// can never observe or allocate the same value.
+const insertEventSQL = `INSERT INTO events (event_id, run_id, ts, type, payload, seq)
+	SELECT ?, ?, ?, ?, ?, COALESCE(NULLIF(?, 0), COALESCE(MAX(seq), 0) + 1) FROM events WHERE run_id = ?
+	RETURNING seq`
+
+// GetLastEventPosition returns the highest seq recorded for a run and the ts
+// of that event, or zeros if the run has no events.
+func (s *SQLiteStore) GetLastEventPosition(ctx context.Context, runID string) (int64, int64, error) {
+	var seq, ts int64
+	err := s.db.QueryRowContext(ctx,
+		`SELECT seq, ts FROM events WHERE run_id = ? ORDER BY seq DESC LIMIT 1`, runID).Scan(&seq, &ts)
+	if err == sql.ErrNoRows {
+		return 0, 0, nil
+	}
+	return seq, ts, err
+}
+
+// GetEventSeq returns the seq of a run's event, or 0 if it has none with
+// that ID.
+func (s *SQLiteStore) GetEventSeq(ctx context.Context, runID, eventID string) (int64, error) {
+	var seq int64
+	err := s.db.QueryRowContext(ctx,
+		`SELECT seq FROM events WHERE run_id = ? AND event_id = ?`, runID, eventID).Scan(&seq)
+	if err == sql.ErrNoRows {
+		return 0, nil
+	}
+	return seq, err
+}
+
+// CountEventsByType returns the number of a run's events of each type.
+func (s *SQLiteStore) CountEventsByType(ctx context.Context, runID string) (map[domain.EventType]int, error) {
+	rows, err := s.db.QueryContext(ctx,
+		`SELECT type, COUNT(*) FROM events WHERE run_id = ? GROUP BY type`, runID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	counts := make(map[domain.EventType]int)
+	for rows.Next() {
+		var typ string
+		var n int
+		if err := rows.Scan(&typ, &n); err != nil {
+			return nil, err
+		}
+		counts[domain.EventType(typ)] = n
+	}
+	return counts, rows.Err()
+}
+
+// CountActiveRunsByAgent returns the number of CREATED or RUNNING runs per
+// root agent, served by idx_runs_agent_status.
+func (s *SQLiteStore) CountActiveRunsByAgent(ctx context.Context) (map[string]int, error) {
+	rows, err := s.db.QueryContext(ctx,
+		`SELECT root_agent_id, COUNT(*) FROM runs WHERE status IN (?, ?) GROUP BY root_agent_id`,
+		domain.RunStatusCreated, domain.RunStatusRunning)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	counts := make(map[string]int)
+	for rows.Next() {
+		var agentID string
+		var n int
+		if err := rows.Scan(&agentID, &n); err != nil {
+			return nil, err
+		}
+		counts[agentID] = n
+	}
+	return counts, rows.Err()
+}
+
+// GetEventTimeRange returns the ts of a run's first and last events (zeros
+// when there are none).
+func (s *SQLiteStore) GetEventTimeRange(ctx context.Context, runID string) (int64, int64, error) {
+	var first, last sql.NullInt64
+	err := s.db.QueryRowContext(ctx,
+		`SELECT MIN(ts), MAX(ts) FROM events WHERE run_id = ?`, runID).Scan(&first, &last)
+	if err != nil {
+		return 0, 0, err
+	}
+	return first.Int64, last.Int64, nil
+}
+
+// CreateEvents inserts events in order within a single transaction.
+func (s *SQLiteStore) CreateEvents(ctx context.Context, events []*domain.Event) error {
+	if len(events) == 0 {
+		return nil
+	}
+
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	stmt, err := tx.PrepareContext(ctx, insertEventSQL)
+	if err != nil {
+		return err
+	}
+	defer stmt.Close()
+
+	for _, event := range events {
+		payload := ""
+		if event.Payload != nil {
+			payload = string(event.Payload)
+		}
+		if err := stmt.QueryRowContext(ctx,
+			event.EventID, event.RunID, event.Ts, event.Type, payload, event.Seq, event.RunID).Scan(&event.Seq); err != nil {
+			return eventInsertError(err)
+		}
+	}
+	return tx.Commit()
+}
+
 // GetEvents retrieves events for a run.
-func (s *SQLiteStore) GetEvents(ctx context.Context, runID string, afterTs int64, types []string, limit int) ([]domain.Event, error) {
-	query := `SELECT event_id, run_id, ts, type, payload FROM events WHERE run_id = ?`
+func (s *SQLiteStore) GetEvents(ctx context.Context, runID string, afterTs, afterSeq int64, types []string, limit int) ([]domain.Event, error) {
+	query := `SELECT event_id, run_id, ts, seq, type, payload FROM events WHERE run_id = ?`
 	args := []interface{}{runID}
 
-	if afterTs > 0 {
+	if afterSeq > 0 {
+		query += ` AND seq > ?`
+		args = append(args, afterSeq)
+	} else if afterTs > 0 {
 		query += ` AND ts > ?`
 		args = append(args, afterTs)
 	}
@@ -421,12 +1073,12 @@ func (s *SQLiteStore) GetEvents(ctx context.Context, runID string, afterTs int64
 		query += fmt.Sprintf(" AND type IN (%s)", strings.Join(placeholders, ","))
 	}
 
-	query += ` ORDER BY ts ASC`
+	query += ` ORDER BY seq ASC`
 	if limit > 0 {
 		query += fmt.Sprintf(" LIMIT %d", limit)
 	}
 
-	rows, err := s.db.QueryContext(ctx, query, args...)
+	rows, err := s.readDB.QueryContext(ctx, query, args...)
 	if err != nil {
 		return nil, err
 	}
@@ -436,7 +1088,7 @@ func (s *SQLiteStore) GetEvents(ctx context.Context, runID string, afterTs int64
 	for rows.Next() {
 		var event domain.Event
 		var payload sql.NullString
-		if err := rows.Scan(&event.EventID, &event.RunID, &event.Ts, &event.Type, &payload); err != nil {
+		if err := rows.Scan(&event.EventID, &event.RunID, &event.Ts, &event.Seq, &event.Type, &payload); err != nil {
 			return nil, err
 		}
 		if payload.Valid {
@@ -450,21 +1102,50 @@ func (s *SQLiteStore) GetEvents(ctx context.Context, runID string, afterTs int64
 // RegisterAgent registers or updates an agent.
 func (s *SQLiteStore) RegisterAgent(ctx context.Context, agent *domain.Agent) error {
 	caps, _ := json.Marshal(agent.Capabilities)
+	var headers []byte
+	if len(agent.Headers) > 0 {
+		headers, _ = json.Marshal(agent.Headers)
+	}
+	var llmConfig []byte
+	if agent.LLM != nil {
+		llmConfig, _ = json.Marshal(agent.LLM)
+	}
+	var requestFilter []byte
+	if agent.RequestFilter != nil {
+		requestFilter, _ = json.Marshal(agent.RequestFilter)
+	}
+	// Re-registering updates the agent's definition in place and clears its
+	// failure streak; created_at and a recorded last_heartbeat are kept.
 	_, err := s.db.ExecContext(ctx,
-		`INSERT OR REPLACE INTO agents (agent_id, name, endpoint, capabilities, status, last_heartbeat, created_at) 
-		 VALUES (?, ?, ?, ?, ?, ?, ?)`,
-		agent.AgentID, agent.Name, agent.Endpoint, string(caps), agent.Status, agent.LastHeartbeat, agent.CreatedAt)
+		`INSERT INTO agents (agent_id, name, endpoint, capabilities, headers, protocol, response_format, cancel_url, max_concurrent_tool_calls, request_filter, llm_config, status, last_heartbeat, created_at)
+		 VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)
+		 ON CONFLICT(agent_id) DO UPDATE SET
+			name = excluded.name,
+			endpoint = excluded.endpoint,
+			capabilities = excluded.capabilities,
+			headers = excluded.headers,
+			protocol = excluded.protocol,
+			response_format = excluded.response_format,
+			cancel_url = excluded.cancel_url,
+			max_concurrent_tool_calls = excluded.max_concurrent_tool_calls,
+			request_filter = excluded.request_filter,
+			llm_config = excluded.llm_config,
+			status = excluded.status,
+			last_error = NULL,
+			consecutive_failures = 0,
+			last_heartbeat = COALESCE(excluded.last_heartbeat, agents.last_heartbeat)`,
+		agent.AgentID, agent.Name, agent.Endpoint, string(caps), nullStringBytes(headers), string(agent.Protocol), string(agent.ResponseFormat), agent.CancelURL, agent.MaxConcurrentToolCalls, nullStringBytes(requestFilter), nullStringBytes(llmConfig), agent.Status, agent.LastHeartbeat, agent.CreatedAt)
 	return err
 }
 
 // GetAgent retrieves an agent by ID.
 func (s *SQLiteStore) GetAgent(ctx context.Context, agentID string) (*domain.Agent, error) {
 	var agent domain.Agent
-	var caps sql.NullString
+	var caps, headers, requestFilter, llmConfig, lastError sql.NullString
 	var lastHeartbeat sql.NullTime
 	err := s.db.QueryRowContext(ctx,
-		`SELECT agent_id, name, endpoint, capabilities, status, last_heartbeat, created_at FROM agents WHERE agent_id = ?`,
-		agentID).Scan(&agent.AgentID, &agent.Name, &agent.Endpoint, &caps, &agent.Status, &lastHeartbeat, &agent.CreatedAt)
+		`SELECT agent_id, name, endpoint, capabilities, headers, protocol, response_format, cancel_url, max_concurrent_tool_calls, request_filter, llm_config, status, last_error, consecutive_failures, last_heartbeat, created_at FROM agents WHERE agent_id = ?`,
+		agentID).Scan(&agent.AgentID, &agent.Name, &agent.Endpoint, &caps, &headers, &agent.Protocol, &agent.ResponseFormat, &agent.CancelURL, &agent.MaxConcurrentToolCalls, &requestFilter, &llmConfig, &agent.Status, &lastError, &agent.ConsecutiveFailures, &lastHeartbeat, &agent.CreatedAt)
 	if err == sql.ErrNoRows {
 		return nil, nil
 	}
@@ -474,6 +1155,18 @@ func (s *SQLiteStore) GetAgent(ctx context.Context, agentID string) (*domain.Age
 	if caps.Valid {
 		agent.Capabilities = json.RawMessage(caps.String)
 	}
+	if headers.Valid {
+		_ = json.Unmarshal([]byte(headers.String), &agent.Headers)
+	}
+	if requestFilter.Valid {
+		agent.RequestFilter = &domain.AgentRequestFilter{}
+		_ = json.Unmarshal([]byte(requestFilter.String), agent.RequestFilter)
+	}
+	if llmConfig.Valid {
+		agent.LLM = &domain.LLMAgentConfig{}
+		_ = json.Unmarshal([]byte(llmConfig.String), agent.LLM)
+	}
+	agent.LastError = lastError.String
 	if lastHeartbeat.Valid {
 		agent.LastHeartbeat = &lastHeartbeat.Time
 	}
@@ -483,7 +1176,7 @@ func (s *SQLiteStore) GetAgent(ctx context.Context, agentID string) (*domain.Age
 // ListAgents lists all agents.
 func (s *SQLiteStore) ListAgents(ctx context.Context) ([]domain.Agent, error) {
 	rows, err := s.db.QueryContext(ctx,
-		`SELECT agent_id, name, endpoint, capabilities, status, last_heartbeat, created_at FROM agents ORDER BY created_at`)
+		`SELECT agent_id, name, endpoint, capabilities, headers, protocol, response_format, cancel_url, max_concurrent_tool_calls, request_filter, llm_config, status, last_error, consecutive_failures, last_heartbeat, created_at FROM agents ORDER BY created_at`)
 	if err != nil {
 		return nil, err
 	}
@@ -492,14 +1185,26 @@ func (s *SQLiteStore) ListAgents(ctx context.Context) ([]domain.Agent, error) {
 	var agents []domain.Agent
 	for rows.Next() {
 		var agent domain.Agent
-		var caps sql.NullString
+		var caps, headers, requestFilter, llmConfig, lastError sql.NullString
 		var lastHeartbeat sql.NullTime
-		if err := rows.Scan(&agent.AgentID, &agent.Name, &agent.Endpoint, &caps, &agent.Status, &lastHeartbeat, &agent.CreatedAt); err != nil {
+		if err := rows.Scan(&agent.AgentID, &agent.Name, &agent.Endpoint, &caps, &headers, &agent.Protocol, &agent.ResponseFormat, &agent.CancelURL, &agent.MaxConcurrentToolCalls, &requestFilter, &llmConfig, &agent.Status, &lastError, &agent.ConsecutiveFailures, &lastHeartbeat, &agent.CreatedAt); err != nil {
 			return nil, err
 		}
 		if caps.Valid {
 			agent.Capabilities = json.RawMessage(caps.String)
 		}
+		if headers.Valid {
+			_ = json.Unmarshal([]byte(headers.String), &agent.Headers)
+		}
+		if requestFilter.Valid {
+			agent.RequestFilter = &domain.AgentRequestFilter{}
+			_ = json.Unmarshal([]byte(requestFilter.String), agent.RequestFilter)
+		}
+		if llmConfig.Valid {
+			agent.LLM = &domain.LLMAgentConfig{}
+			_ = json.Unmarshal([]byte(llmConfig.String), agent.LLM)
+		}
+		agent.LastError = lastError.String
 		if lastHeartbeat.Valid {
 			agent.LastHeartbeat = &lastHeartbeat.Time
 		}
@@ -508,14 +1213,36 @@ func (s *SQLiteStore) ListAgents(ctx context.Context) ([]domain.Agent, error) {
 	return agents, rows.Err()
 }
 
+// RecordAgentFailure stores an agent's latest invocation error and bumps its
+// consecutive failure count, marking it unhealthy once the count reaches
+// unhealthyAfter (0 = never).
+func (s *SQLiteStore) RecordAgentFailure(ctx context.Context, agentID, lastError string, unhealthyAfter int) error {
+	_, err := s.db.ExecContext(ctx,
+		`UPDATE agents SET
+			last_error = ?,
+			consecutive_failures = consecutive_failures + 1,
+			status = CASE WHEN ? > 0 AND consecutive_failures + 1 >= ? THEN 'unhealthy' ELSE status END
+		 WHERE agent_id = ?`,
+		lastError, unhealthyAfter, unhealthyAfter, agentID)
+	return err
+}
+
+// RecordAgentSuccess clears an agent's failure streak and marks it healthy.
+func (s *SQLiteStore) RecordAgentSuccess(ctx context.Context, agentID string) error {
+	_, err := s.db.ExecContext(ctx,
+		`UPDATE agents SET last_error = NULL, consecutive_failures = 0, status = 'healthy' WHERE agent_id = ?`,
+		agentID)
+	return err
+}
+
 // CreateTool creates a new tool.
 func (s *SQLiteStore) CreateTool(ctx context.Context, tool *domain.Tool) error {
 	schema, _ := json.Marshal(tool.Schema)
 	policy, _ := json.Marshal(tool.Policy)
 	metadata, _ := json.Marshal(tool.Metadata)
 	_, err := s.db.ExecContext(ctx,
-		`INSERT INTO tools (name, kind, schema, client_id, policy, timeout_ms, metadata) VALUES (?, ?, ?, ?, ?, ?, ?)`,
-		tool.Name, tool.Kind, string(schema), tool.ClientID, string(policy), tool.TimeoutMs, string(metadata))
+		`INSERT INTO tools (name, kind, schema, result_schema, client_id, policy, timeout_ms, metadata) VALUES (?, ?, ?, ?, ?, ?, ?, ?)`,
+		tool.Name, tool.Kind, string(schema), nullStringBytes(tool.ResultSchema), tool.ClientID, string(policy), tool.TimeoutMs, string(metadata))
 	return err
 }
 
@@ -525,18 +1252,18 @@ func (s *SQLiteStore) UpsertTool(ctx context.Context, tool *domain.Tool) error {
 	policy, _ := json.Marshal(tool.Policy)
 	metadata, _ := json.Marshal(tool.Metadata)
 	_, err := s.db.ExecContext(ctx,
-		`INSERT OR REPLACE INTO tools (name, kind, schema, client_id, policy, timeout_ms, metadata) VALUES (?, ?, ?, ?, ?, ?, ?)`,
-		tool.Name, tool.Kind, string(schema), tool.ClientID, string(policy), tool.TimeoutMs, string(metadata))
+		`INSERT OR REPLACE INTO tools (name, kind, schema, result_schema, client_id, policy, timeout_ms, metadata) VALUES (?, ?, ?, ?, ?, ?, ?, ?)`,
+		tool.Name, tool.Kind, string(schema), nullStringBytes(tool.ResultSchema), tool.ClientID, string(policy), tool.TimeoutMs, string(metadata))
 	return err
 }
 
 // GetTool retrieves a tool by name.
 func (s *SQLiteStore) GetTool(ctx context.Context, toolName string) (*domain.Tool, error) {
 	var tool domain.Tool
-	var schema, clientID, policy, metadata sql.NullString
+	var schema, resultSchema, clientID, policy, metadata sql.NullString
 	err := s.db.QueryRowContext(ctx,
-		`SELECT name, kind, schema, client_id, policy, timeout_ms, metadata FROM tools WHERE name = ?`,
-		toolName).Scan(&tool.Name, &tool.Kind, &schema, &clientID, &policy, &tool.TimeoutMs, &metadata)
+		`SELECT name, kind, schema, result_schema, client_id, policy, timeout_ms, metadata FROM tools WHERE name = ?`,
+		toolName).Scan(&tool.Name, &tool.Kind, &schema, &resultSchema, &clientID, &policy, &tool.TimeoutMs, &metadata)
 	if err == sql.ErrNoRows {
 		return nil, nil
 	}
@@ -546,6 +1273,9 @@ func (s *SQLiteStore) GetTool(ctx context.Context, toolName string) (*domain.Too
 	if schema.Valid {
 		tool.Schema = json.RawMessage(schema.String)
 	}
+	if resultSchema.Valid {
+		tool.ResultSchema = json.RawMessage(resultSchema.String)
+	}
 	if clientID.Valid {
 		tool.ClientID = clientID.String
 	}
@@ -560,7 +1290,7 @@ func (s *SQLiteStore) GetTool(ctx context.Context, toolName string) (*domain.Too
 
 // ListTools lists all tools.
 func (s *SQLiteStore) ListTools(ctx context.Context) ([]domain.Tool, error) {
-	rows, err := s.db.QueryContext(ctx, `SELECT name, kind, schema, client_id, policy, timeout_ms, metadata FROM tools`)
+	rows, err := s.db.QueryContext(ctx, `SELECT name, kind, schema, result_schema, client_id, policy, timeout_ms, metadata FROM tools`)
 	if err != nil {
 		return nil, err
 	}
@@ -569,13 +1299,16 @@ func (s *SQLiteStore) ListTools(ctx context.Context) ([]domain.Tool, error) {
 	var tools []domain.Tool
 	for rows.Next() {
 		var tool domain.Tool
-		var schema, clientID, policy, metadata sql.NullString
-		if err := rows.Scan(&tool.Name, &tool.Kind, &schema, &clientID, &policy, &tool.TimeoutMs, &metadata); err != nil {
+		var schema, resultSchema, clientID, policy, metadata sql.NullString
+		if err := rows.Scan(&tool.Name, &tool.Kind, &schema, &resultSchema, &clientID, &policy, &tool.TimeoutMs, &metadata); err != nil {
 			return nil, err
 		}
 		if schema.Valid {
 			tool.Schema = json.RawMessage(schema.String)
 		}
+		if resultSchema.Valid {
+			tool.ResultSchema = json.RawMessage(resultSchema.String)
+		}
 		if clientID.Valid {
 			tool.ClientID = clientID.String
 		}
@@ -599,6 +1332,45 @@ func (s *SQLiteStore) CreateToolCall(ctx context.Context, toolCall *domain.ToolC
 	return err
 }
 
+// CreateToolCallIdempotent inserts a tool call guarded by its idempotency key.
+// The existence check and the insert are a single statement, so concurrent
+// invokes with the same key cannot both insert. The window is measured back
+// from toolCall.CreatedAt, so it follows the caller's clock.
+func (s *SQLiteStore) CreateToolCallIdempotent(ctx context.Context, toolCall *domain.ToolCall, window time.Duration) (*domain.ToolCall, error) {
+	if toolCall.IdempotencyKey == "" {
+		return nil, s.CreateToolCall(ctx, toolCall)
+	}
+	args, _ := json.Marshal(toolCall.Args)
+	res, err := s.db.ExecContext(ctx,
+		`INSERT INTO tool_calls (tool_call_id, run_id, tool_name, kind, status, args, result, error, approval_id, idempotency_key, timeout_ms, created_at, completed_at)
+		 SELECT ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?
+		 WHERE NOT EXISTS (
+			SELECT 1 FROM tool_calls
+			WHERE run_id = ? AND tool_name = ? AND idempotency_key = ?
+			  AND julianday(created_at) >= julianday(?)
+		 )`,
+		toolCall.ToolCallID, toolCall.RunID, toolCall.ToolName, toolCall.Kind, toolCall.Status, string(args), nullStringBytes(toolCall.Result), nullStringBytes(toolCall.Error), nullString(toolCall.ApprovalID), toolCall.IdempotencyKey, toolCall.TimeoutMs, toolCall.CreatedAt, toolCall.CompletedAt,
+		toolCall.RunID, toolCall.ToolName, toolCall.IdempotencyKey, toolCall.CreatedAt.Add(-window))
+	if err != nil {
+		return nil, err
+	}
+	affected, err := res.RowsAffected()
+	if err != nil {
+		return nil, err
+	}
+	if affected > 0 {
+		return nil, nil
+	}
+	existing, err := s.GetToolCallByIdempotencyKey(ctx, toolCall.RunID, toolCall.ToolName, toolCall.IdempotencyKey)
+	if err != nil {
+		return nil, err
+	}
+	if existing == nil {
+		return nil, fmt.Errorf("idempotent tool call %s disappeared", toolCall.IdempotencyKey)
+	}
+	return existing, nil
+}
+
 // GetToolCall retrieves a tool call by ID.
 func (s *SQLiteStore) GetToolCall(ctx context.Context, toolCallID string) (*domain.ToolCall, error) {
 	var tc domain.ToolCall
@@ -606,8 +1378,8 @@ func (s *SQLiteStore) GetToolCall(ctx context.Context, toolCallID string) (*doma
 	var completedAt sql.NullTime
 
 	err := s.db.QueryRowContext(ctx,
-		`SELECT tool_call_id, run_id, tool_name, kind, status, args, result, error, approval_id, idempotency_key, timeout_ms, created_at, completed_at FROM tool_calls WHERE tool_call_id = ?`,
-		toolCallID).Scan(&tc.ToolCallID, &tc.RunID, &tc.ToolName, &tc.Kind, &tc.Status, &args, &result, &errData, &approvalID, &idempotencyKey, &tc.TimeoutMs, &tc.CreatedAt, &completedAt)
+		`SELECT tool_call_id, run_id, tool_name, kind, status, args, result, error, approval_id, idempotency_key, timeout_ms, created_at, completed_at, progress_seq, progress_chunks FROM tool_calls WHERE tool_call_id = ?`,
+		toolCallID).Scan(&tc.ToolCallID, &tc.RunID, &tc.ToolName, &tc.Kind, &tc.Status, &args, &result, &errData, &approvalID, &idempotencyKey, &tc.TimeoutMs, &tc.CreatedAt, &completedAt, &tc.ProgressSeq, &tc.ProgressChunks)
 	if err == sql.ErrNoRows {
 		return nil, nil
 	}
@@ -642,12 +1414,12 @@ func (s *SQLiteStore) GetToolCallByIdempotencyKey(ctx context.Context, runID str
 	var completedAt sql.NullTime
 
 	err := s.db.QueryRowContext(ctx,
-		`SELECT tool_call_id, run_id, tool_name, kind, status, args, result, error, approval_id, idempotency_key, timeout_ms, created_at, completed_at
+		`SELECT tool_call_id, run_id, tool_name, kind, status, args, result, error, approval_id, idempotency_key, timeout_ms, created_at, completed_at, progress_seq, progress_chunks
 		 FROM tool_calls
 		 WHERE run_id = ? AND tool_name = ? AND idempotency_key = ?
 		 ORDER BY created_at DESC
 		 LIMIT 1`,
-		runID, toolName, idempotencyKey).Scan(&tc.ToolCallID, &tc.RunID, &tc.ToolName, &tc.Kind, &tc.Status, &args, &result, &errData, &approvalID, &idemKey, &tc.TimeoutMs, &tc.CreatedAt, &completedAt)
+		runID, toolName, idempotencyKey).Scan(&tc.ToolCallID, &tc.RunID, &tc.ToolName, &tc.Kind, &tc.Status, &args, &result, &errData, &approvalID, &idemKey, &tc.TimeoutMs, &tc.CreatedAt, &completedAt, &tc.ProgressSeq, &tc.ProgressChunks)
 	if err == sql.ErrNoRows {
 		return nil, nil
 	}
@@ -692,7 +1464,7 @@ func (s *SQLiteStore) UpdateToolCallStatus(ctx context.Context, toolCallID strin
 
 // UpdateToolCallResult updates the result of a tool call.
 func (s *SQLiteStore) UpdateToolCallResult(ctx context.Context, toolCallID string, status domain.ToolCallStatus, result []byte, errData []byte) (bool, error) {
-	now := time.Now()
+	now := s.clock.Now()
 	var resStr, errStr sql.NullString
 	if result != nil {
 		resStr = sql.NullString{String: string(result), Valid: true}
@@ -728,16 +1500,50 @@ func (s *SQLiteStore) UpdateToolCallApproval(ctx context.Context, toolCallID str
 	return affected > 0, nil
 }
 
-func (s *SQLiteStore) ListExpiredToolCalls(ctx context.Context, limit int) ([]domain.ToolCall, error) {
+// RecordToolProgress accepts progress chunk seq for a dispatched or running
+// tool call, moving it to RUNNING. Returns false without changes if the call
+// has completed, seq is not greater than the last accepted seq, or maxChunks
+// (0 = unlimited) chunks were already accepted.
+func (s *SQLiteStore) RecordToolProgress(ctx context.Context, toolCallID string, seq int64, maxChunks int) (bool, error) {
+	res, err := s.db.ExecContext(ctx,
+		`UPDATE tool_calls SET status = ?, progress_seq = ?, progress_chunks = progress_chunks + 1
+		 WHERE tool_call_id = ? AND completed_at IS NULL AND status IN (?, ?)
+		   AND progress_seq < ? AND (? = 0 OR progress_chunks < ?)`,
+		domain.ToolCallStatusRunning, seq, toolCallID, domain.ToolCallStatusDispatched, domain.ToolCallStatusRunning, seq, maxChunks, maxChunks)
+	if err != nil {
+		return false, err
+	}
+	affected, err := res.RowsAffected()
+	if err != nil {
+		return false, err
+	}
+	return affected > 0, nil
+}
+
+// CountActiveToolCalls counts a run's tool calls that have not reached a
+// terminal status.
+func (s *SQLiteStore) CountActiveToolCalls(ctx context.Context, runID string) (int, error) {
+	var n int
+	err := s.db.QueryRowContext(ctx, `
+		SELECT COUNT(*) FROM tool_calls
+		WHERE run_id = ? AND completed_at IS NULL
+		  AND status NOT IN ('SUCCEEDED', 'FAILED', 'TIMEOUT', 'BLOCKED', 'REJECTED')
+	`, runID).Scan(&n)
+	return n, err
+}
+
+// ListExpiredToolCalls returns unfinished tool calls whose timeout elapsed by
+// now, oldest first.
+func (s *SQLiteStore) ListExpiredToolCalls(ctx context.Context, now time.Time, limit int) ([]domain.ToolCall, error) {
 	rows, err := s.db.QueryContext(ctx, `
 		SELECT tool_call_id, run_id, tool_name, kind, status, args, approval_id, timeout_ms, created_at
 		FROM tool_calls
 		WHERE completed_at IS NULL
 		  AND status NOT IN ('SUCCEEDED', 'FAILED', 'TIMEOUT', 'BLOCKED', 'REJECTED')
-		  AND ((julianday('now') - julianday(created_at)) * 86400000.0) >= timeout_ms
+		  AND ROUND((julianday(?) - julianday(created_at)) * 86400000.0) >= timeout_ms
 		ORDER BY created_at ASC
 		LIMIT ?
-	`, limit)
+	`, now, limit)
 	if err != nil {
 		return nil, err
 	}
@@ -799,9 +1605,61 @@ func (s *SQLiteStore) GetApproval(ctx context.Context, approvalID string) (*doma
 	return &ap, nil
 }
 
+// pendingApprovalArgsChars bounds the args summary returned with each pending
+// approval; approvers open the tool call for the full arguments.
+const pendingApprovalArgsChars = 200
+
+// ListPendingApprovals returns PENDING approvals with their tool call, run and
+// session context, oldest first.
+func (s *SQLiteStore) ListPendingApprovals(ctx context.Context, filter domain.PendingApprovalFilter) ([]domain.PendingApproval, error) {
+	query := `SELECT a.approval_id, a.tool_call_id, tc.tool_name, substr(COALESCE(tc.args, ''), 1, ?), length(COALESCE(tc.args, '')) > ?,
+		a.run_id, r.session_id, COALESCE(sess.user_id, ''), a.created_at
+		FROM approvals a
+		JOIN tool_calls tc ON tc.tool_call_id = a.tool_call_id
+		JOIN runs r ON r.run_id = a.run_id
+		LEFT JOIN sessions sess ON sess.session_id = r.session_id
+		WHERE a.status = ?`
+	args := []interface{}{pendingApprovalArgsChars, pendingApprovalArgsChars, domain.ApprovalStatusPending}
+
+	if filter.ToolName != "" {
+		query += ` AND tc.tool_name = ?`
+		args = append(args, filter.ToolName)
+	}
+	if filter.UserID != "" {
+		query += ` AND sess.user_id = ?`
+		args = append(args, filter.UserID)
+	}
+	if !filter.AfterCreatedAt.IsZero() {
+		query += ` AND (julianday(a.created_at) > julianday(?) OR (julianday(a.created_at) = julianday(?) AND a.approval_id > ?))`
+		args = append(args, filter.AfterCreatedAt, filter.AfterCreatedAt, filter.AfterApprovalID)
+	}
+
+	query += ` ORDER BY julianday(a.created_at) ASC, a.approval_id ASC`
+	if filter.Limit > 0 {
+		query += fmt.Sprintf(" LIMIT %d", filter.Limit)
+	}
+
+	rows, err := s.db.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var approvals []domain.PendingApproval
+	for rows.Next() {
+		var ap domain.PendingApproval
+		if err := rows.Scan(&ap.ApprovalID, &ap.ToolCallID, &ap.ToolName, &ap.ArgsSummary, &ap.ArgsTruncated,
+			&ap.RunID, &ap.SessionID, &ap.UserID, &ap.CreatedAt); err != nil {
+			return nil, err
+		}
+		approvals = append(approvals, ap)
+	}
+	return approvals, rows.Err()
+}
+
 // UpdateApprovalStatus updates the status of an approval.
 func (s *SQLiteStore) UpdateApprovalStatus(ctx context.Context, approvalID string, status domain.ApprovalStatus, decidedBy string, reason string) error {
-	now := time.Now()
+	now := s.clock.Now()
 	_, err := s.db.ExecContext(ctx,
 		`UPDATE approvals SET status = ?, decided_at = ?, decided_by = ?, reason = ? WHERE approval_id = ?`,
 		status, now, decidedBy, reason, approvalID)
@@ -809,7 +1667,7 @@ func (s *SQLiteStore) UpdateApprovalStatus(ctx context.Context, approvalID strin
 }
 
 func (s *SQLiteStore) ExpireApprovalIfPending(ctx context.Context, approvalID string, reason string) (bool, error) {
-	now := time.Now()
+	now := s.clock.Now()
 	res, err := s.db.ExecContext(ctx,
 		`UPDATE approvals SET status = ?, decided_at = ?, reason = ? WHERE approval_id = ? AND status = ?`,
 		domain.ApprovalStatusExpired, now, reason, approvalID, domain.ApprovalStatusPending)
@@ -823,6 +1681,510 @@ func (s *SQLiteStore) ExpireApprovalIfPending(ctx context.Context, approvalID st
 	return affected > 0, nil
 }
 
+// RememberApproval stores a remembered approval, replacing any earlier one for
+// the same scope, user, session and tool.
+func (s *SQLiteStore) RememberApproval(ctx context.Context, ra *domain.RememberedApproval) error {
+	_, err := s.db.ExecContext(ctx,
+		`INSERT INTO remembered_approvals (scope, user_id, session_id, tool_name, approval_id, created_at, expires_at)
+		 VALUES (?, ?, ?, ?, ?, ?, ?)
+		 ON CONFLICT(scope, user_id, session_id, tool_name) DO UPDATE SET
+			approval_id = excluded.approval_id,
+			created_at = excluded.created_at,
+			expires_at = excluded.expires_at`,
+		ra.Scope, ra.UserID, ra.SessionID, ra.ToolName, ra.ApprovalID, ra.CreatedAt, ra.ExpiresAt)
+	return err
+}
+
+// FindRememberedApproval returns an unexpired remembered approval of toolName
+// for the session, or for userID in any session. Session scope wins when both
+// exist. Returns nil if there is none.
+func (s *SQLiteStore) FindRememberedApproval(ctx context.Context, userID, sessionID, toolName string, now time.Time) (*domain.RememberedApproval, error) {
+	var ra domain.RememberedApproval
+	err := s.db.QueryRowContext(ctx,
+		`SELECT scope, user_id, session_id, tool_name, approval_id, created_at, expires_at
+		 FROM remembered_approvals
+		 WHERE tool_name = ? AND julianday(expires_at) > julianday(?)
+		   AND ((scope = ? AND session_id = ?) OR (scope = ? AND user_id = ? AND user_id != ''))
+		 ORDER BY scope = ? DESC
+		 LIMIT 1`,
+		toolName, now, domain.RememberScopeSession, sessionID, domain.RememberScopeUser, userID, domain.RememberScopeSession,
+	).Scan(&ra.Scope, &ra.UserID, &ra.SessionID, &ra.ToolName, &ra.ApprovalID, &ra.CreatedAt, &ra.ExpiresAt)
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &ra, nil
+}
+
+// ClearRememberedApprovals deletes the remembered approvals matching filter
+// and returns how many there were.
+func (s *SQLiteStore) ClearRememberedApprovals(ctx context.Context, filter domain.RememberedApprovalFilter) (int64, error) {
+	query := `DELETE FROM remembered_approvals WHERE 1 = 1`
+	var args []interface{}
+	if filter.UserID != "" {
+		query += ` AND user_id = ?`
+		args = append(args, filter.UserID)
+	}
+	if filter.SessionID != "" {
+		query += ` AND session_id = ?`
+		args = append(args, filter.SessionID)
+	}
+	if filter.ToolName != "" {
+		query += ` AND tool_name = ?`
+		args = append(args, filter.ToolName)
+	}
+	res, err := s.db.ExecContext(ctx, query, args...)
+	if err != nil {
+		return 0, err
+	}
+	return res.RowsAffected()
+}
+
+// ClaimNonce records n unless its kind and nonce are already taken, in which
+// case the existing record is returned instead. Expired nonces are purged
+// first. Returns nil if n was recorded.
+func (s *SQLiteStore) ClaimNonce(ctx context.Context, n *domain.RequestNonce) (*domain.RequestNonce, error) {
+	if _, err := s.db.ExecContext(ctx,
+		`DELETE FROM request_nonces WHERE julianday(expires_at) <= julianday(?)`, n.CreatedAt); err != nil {
+		return nil, err
+	}
+	res, err := s.db.ExecContext(ctx,
+		`INSERT INTO request_nonces (kind, nonce, target_id, created_at, expires_at)
+		 VALUES (?, ?, ?, ?, ?)
+		 ON CONFLICT(kind, nonce) DO NOTHING`,
+		n.Kind, n.Nonce, n.TargetID, n.CreatedAt, n.ExpiresAt)
+	if err != nil {
+		return nil, err
+	}
+	affected, err := res.RowsAffected()
+	if err != nil {
+		return nil, err
+	}
+	if affected > 0 {
+		return nil, nil
+	}
+
+	var existing domain.RequestNonce
+	var response sql.NullString
+	err = s.db.QueryRowContext(ctx,
+		`SELECT kind, nonce, target_id, response, created_at, expires_at
+		 FROM request_nonces WHERE kind = ? AND nonce = ?`,
+		n.Kind, n.Nonce,
+	).Scan(&existing.Kind, &existing.Nonce, &existing.TargetID, &response, &existing.CreatedAt, &existing.ExpiresAt)
+	if err != nil {
+		return nil, err
+	}
+	if response.Valid {
+		existing.Response = json.RawMessage(response.String)
+	}
+	return &existing, nil
+}
+
+// SaveNonceResponse stores the response a claimed nonce replays.
+func (s *SQLiteStore) SaveNonceResponse(ctx context.Context, kind domain.NonceKind, nonce string, response json.RawMessage) error {
+	_, err := s.db.ExecContext(ctx,
+		`UPDATE request_nonces SET response = ? WHERE kind = ? AND nonce = ?`,
+		string(response), kind, nonce)
+	return err
+}
+
+// DeleteNonce releases a claimed nonce so it can be used again.
+func (s *SQLiteStore) DeleteNonce(ctx context.Context, kind domain.NonceKind, nonce string) error {
+	_, err := s.db.ExecContext(ctx,
+		`DELETE FROM request_nonces WHERE kind = ? AND nonce = ?`, kind, nonce)
+	return err
+}
+
+// ListOverdueRuns returns unfinished runs whose deadline is at or before now,
+// earliest deadline first.
+func (s *SQLiteStore) ListOverdueRuns(ctx context.Context, now time.Time, limit int) ([]domain.Run, error) {
+	rows, err := s.db.QueryContext(ctx,
+		`SELECT `+runColumns+` FROM runs
+		 WHERE deadline_at IS NOT NULL
+		   AND status NOT IN (?, ?, ?)
+		   AND julianday(deadline_at) <= julianday(?)
+		 ORDER BY julianday(deadline_at) ASC
+		 LIMIT ?`,
+		domain.RunStatusDone, domain.RunStatusFailed, domain.RunStatusCancelled, now, limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var runs []domain.Run
+	for rows.Next() {
+		run, err := scanRun(rows)
+		if err != nil {
+			return nil, err
+		}
+		runs = append(runs, *run)
+	}
+	return runs, rows.Err()
+}
+
+// ListArchivableRuns returns terminal runs that ended before cutoff and have
+// not been archived, oldest first. A restored run counts from its restore
+// time, so it stays in the database for another full retention period.
+func (s *SQLiteStore) ListArchivableRuns(ctx context.Context, cutoff time.Time, limit int) ([]domain.Run, error) {
+	rows, err := s.db.QueryContext(ctx,
+		`SELECT `+runColumns+` FROM runs
+		 WHERE archive_location IS NULL
+		   AND status IN (?, ?, ?)
+		   AND ended_at IS NOT NULL
+		   AND julianday(COALESCE(restored_at, ended_at)) < julianday(?)
+		 ORDER BY julianday(ended_at) ASC
+		 LIMIT ?`,
+		domain.RunStatusDone, domain.RunStatusFailed, domain.RunStatusCancelled, cutoff, limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var runs []domain.Run
+	for rows.Next() {
+		run, err := scanRun(rows)
+		if err != nil {
+			return nil, err
+		}
+		runs = append(runs, *run)
+	}
+	return runs, rows.Err()
+}
+
+const toolCallColumns = `tool_call_id, run_id, tool_name, kind, status, args, result, error, approval_id, idempotency_key, timeout_ms, created_at, completed_at, progress_seq, progress_chunks`
+
+func scanToolCall(row interface{ Scan(...interface{}) error }) (*domain.ToolCall, error) {
+	var tc domain.ToolCall
+	var args, result, errData, approvalID, idempotencyKey sql.NullString
+	var completedAt sql.NullTime
+	if err := row.Scan(&tc.ToolCallID, &tc.RunID, &tc.ToolName, &tc.Kind, &tc.Status, &args, &result, &errData, &approvalID, &idempotencyKey, &tc.TimeoutMs, &tc.CreatedAt, &completedAt, &tc.ProgressSeq, &tc.ProgressChunks); err != nil {
+		return nil, err
+	}
+	if args.Valid {
+		tc.Args = json.RawMessage(args.String)
+	}
+	if result.Valid {
+		tc.Result = json.RawMessage(result.String)
+	}
+	if errData.Valid {
+		tc.Error = json.RawMessage(errData.String)
+	}
+	if approvalID.Valid {
+		tc.ApprovalID = approvalID.String
+	}
+	if idempotencyKey.Valid {
+		tc.IdempotencyKey = idempotencyKey.String
+	}
+	if completedAt.Valid {
+		tc.CompletedAt = &completedAt.Time
+	}
+	return &tc, nil
+}
+
+// GetRunAggregate reads a run with the rows opts selects in a single read
+// transaction, so the parts are consistent with each other.
+func (s *SQLiteStore) GetRunAggregate(ctx context.Context, runID string, opts domain.RunAggregateOptions) (*domain.RunAggregate, error) {
+	tx, err := s.db.BeginTx(ctx, &sql.TxOptions{ReadOnly: true})
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	run, err := scanRun(tx.QueryRowContext(ctx, `SELECT `+runColumns+` FROM runs WHERE run_id = ?`, runID))
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	agg := &domain.RunAggregate{Run: *run}
+
+	if opts.ToolCalls {
+		rows, err := tx.QueryContext(ctx,
+			`SELECT `+toolCallColumns+` FROM tool_calls WHERE run_id = ? ORDER BY created_at ASC, tool_call_id ASC`, runID)
+		if err != nil {
+			return nil, err
+		}
+		defer rows.Close()
+		for rows.Next() {
+			tc, err := scanToolCall(rows)
+			if err != nil {
+				return nil, err
+			}
+			agg.ToolCalls = append(agg.ToolCalls, *tc)
+		}
+		if err := rows.Err(); err != nil {
+			return nil, err
+		}
+	}
+
+	if opts.Messages {
+		rows, err := tx.QueryContext(ctx,
+			`SELECT message_id, session_id, run_id, role, content, created_at, metadata FROM messages WHERE run_id = ? ORDER BY created_at ASC, rowid ASC`, runID)
+		if err != nil {
+			return nil, err
+		}
+		defer rows.Close()
+		if agg.Messages, err = scanMessages(rows); err != nil {
+			return nil, err
+		}
+	}
+
+	if opts.Events && opts.MaxEvents > 0 {
+		// Read one extra event to tell whether earlier ones were left out.
+		rows, err := tx.QueryContext(ctx,
+			`SELECT event_id, run_id, ts, seq, type, payload FROM events WHERE run_id = ? ORDER BY seq DESC`+fmt.Sprintf(" LIMIT %d", opts.MaxEvents+1), runID)
+		if err != nil {
+			return nil, err
+		}
+		defer rows.Close()
+		for rows.Next() {
+			var event domain.Event
+			var payload sql.NullString
+			if err := rows.Scan(&event.EventID, &event.RunID, &event.Ts, &event.Seq, &event.Type, &payload); err != nil {
+				return nil, err
+			}
+			if payload.Valid {
+				event.Payload = json.RawMessage(payload.String)
+			}
+			agg.Events = append(agg.Events, event)
+		}
+		if err := rows.Err(); err != nil {
+			return nil, err
+		}
+		if len(agg.Events) > opts.MaxEvents {
+			agg.Events = agg.Events[:opts.MaxEvents]
+			agg.EventsTruncated = true
+		}
+		slices.Reverse(agg.Events)
+	}
+
+	return agg, nil
+}
+
+// ExportRun reads a run together with its messages, events, tool calls and
+// approvals. Returns nil if the run does not exist.
+func (s *SQLiteStore) ExportRun(ctx context.Context, runID string) (*domain.RunArchive, error) {
+	tx, err := s.db.BeginTx(ctx, &sql.TxOptions{ReadOnly: true})
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	run, err := scanRun(tx.QueryRowContext(ctx, `SELECT `+runColumns+` FROM runs WHERE run_id = ?`, runID))
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	archive := &domain.RunArchive{Run: *run}
+
+	msgRows, err := tx.QueryContext(ctx,
+		`SELECT message_id, session_id, role, content, created_at, metadata FROM messages WHERE run_id = ? ORDER BY created_at ASC`, runID)
+	if err != nil {
+		return nil, err
+	}
+	defer msgRows.Close()
+	for msgRows.Next() {
+		msg := domain.Message{RunID: runID}
+		var metadata sql.NullString
+		if err := msgRows.Scan(&msg.MessageID, &msg.SessionID, &msg.Role, &msg.Content, &msg.CreatedAt, &metadata); err != nil {
+			return nil, err
+		}
+		if metadata.Valid {
+			msg.Metadata = json.RawMessage(metadata.String)
+		}
+		archive.Messages = append(archive.Messages, msg)
+	}
+	if err := msgRows.Err(); err != nil {
+		return nil, err
+	}
+
+	eventRows, err := tx.QueryContext(ctx,
+		`SELECT event_id, ts, seq, type, payload FROM events WHERE run_id = ? ORDER BY seq ASC`, runID)
+	if err != nil {
+		return nil, err
+	}
+	defer eventRows.Close()
+	for eventRows.Next() {
+		event := domain.Event{RunID: runID}
+		var payload sql.NullString
+		if err := eventRows.Scan(&event.EventID, &event.Ts, &event.Seq, &event.Type, &payload); err != nil {
+			return nil, err
+		}
+		if payload.Valid {
+			event.Payload = json.RawMessage(payload.String)
+		}
+		archive.Events = append(archive.Events, event)
+	}
+	if err := eventRows.Err(); err != nil {
+		return nil, err
+	}
+
+	tcRows, err := tx.QueryContext(ctx,
+		`SELECT tool_call_id, tool_name, kind, status, args, result, error, approval_id, idempotency_key, timeout_ms, created_at, completed_at, progress_seq, progress_chunks FROM tool_calls WHERE run_id = ? ORDER BY created_at ASC`, runID)
+	if err != nil {
+		return nil, err
+	}
+	defer tcRows.Close()
+	for tcRows.Next() {
+		tc := domain.ToolCall{RunID: runID}
+		var args, result, errData, approvalID, idempotencyKey sql.NullString
+		var completedAt sql.NullTime
+		if err := tcRows.Scan(&tc.ToolCallID, &tc.ToolName, &tc.Kind, &tc.Status, &args, &result, &errData, &approvalID, &idempotencyKey, &tc.TimeoutMs, &tc.CreatedAt, &completedAt, &tc.ProgressSeq, &tc.ProgressChunks); err != nil {
+			return nil, err
+		}
+		if args.Valid {
+			tc.Args = json.RawMessage(args.String)
+		}
+		if result.Valid {
+			tc.Result = json.RawMessage(result.String)
+		}
+		if errData.Valid {
+			tc.Error = json.RawMessage(errData.String)
+		}
+		if approvalID.Valid {
+			tc.ApprovalID = approvalID.String
+		}
+		if idempotencyKey.Valid {
+			tc.IdempotencyKey = idempotencyKey.String
+		}
+		if completedAt.Valid {
+			tc.CompletedAt = &completedAt.Time
+		}
+		archive.ToolCalls = append(archive.ToolCalls, tc)
+	}
+	if err := tcRows.Err(); err != nil {
+		return nil, err
+	}
+
+	apRows, err := tx.QueryContext(ctx,
+		`SELECT approval_id, tool_call_id, status, created_at, decided_at, decided_by, reason FROM approvals WHERE run_id = ? ORDER BY created_at ASC`, runID)
+	if err != nil {
+		return nil, err
+	}
+	defer apRows.Close()
+	for apRows.Next() {
+		ap := domain.Approval{RunID: runID}
+		var decidedAt sql.NullTime
+		var decidedBy, reason sql.NullString
+		if err := apRows.Scan(&ap.ApprovalID, &ap.ToolCallID, &ap.Status, &ap.CreatedAt, &decidedAt, &decidedBy, &reason); err != nil {
+			return nil, err
+		}
+		if decidedAt.Valid {
+			ap.DecidedAt = &decidedAt.Time
+		}
+		if decidedBy.Valid {
+			ap.DecidedBy = decidedBy.String
+		}
+		if reason.Valid {
+			ap.Reason = reason.String
+		}
+		archive.Approvals = append(archive.Approvals, ap)
+	}
+	if err := apRows.Err(); err != nil {
+		return nil, err
+	}
+
+	return archive, nil
+}
+
+// MarkRunArchived deletes a run's messages, events, tool calls and approvals
+// and records the archive location on the run row, which stays behind as a
+// tombstone. Returns false if the run does not exist or is already archived.
+func (s *SQLiteStore) MarkRunArchived(ctx context.Context, runID string, location string) (bool, error) {
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return false, err
+	}
+	defer tx.Rollback()
+
+	res, err := tx.ExecContext(ctx,
+		`UPDATE runs SET archive_location = ?, restored_at = NULL WHERE run_id = ? AND archive_location IS NULL`,
+		location, runID)
+	if err != nil {
+		return false, err
+	}
+	affected, err := res.RowsAffected()
+	if err != nil {
+		return false, err
+	}
+	if affected == 0 {
+		return false, nil
+	}
+
+	for _, table := range []string{"approvals", "tool_calls", "events", "messages"} {
+		if _, err := tx.ExecContext(ctx, `DELETE FROM `+table+` WHERE run_id = ?`, runID); err != nil {
+			return false, fmt.Errorf("failed to delete archived %s: %w", table, err)
+		}
+	}
+	return true, tx.Commit()
+}
+
+// RestoreRun re-inserts the rows of an archived run and clears its tombstone.
+// Returns false if the run is not archived (e.g. a concurrent restore won).
+func (s *SQLiteStore) RestoreRun(ctx context.Context, archive *domain.RunArchive) (bool, error) {
+	runID := archive.Run.RunID
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return false, err
+	}
+	defer tx.Rollback()
+
+	res, err := tx.ExecContext(ctx,
+		`UPDATE runs SET archive_location = NULL, restored_at = ? WHERE run_id = ? AND archive_location IS NOT NULL`,
+		s.clock.Now(), runID)
+	if err != nil {
+		return false, err
+	}
+	affected, err := res.RowsAffected()
+	if err != nil {
+		return false, err
+	}
+	if affected == 0 {
+		return false, nil
+	}
+
+	for _, msg := range archive.Messages {
+		metadata, _ := json.Marshal(msg.Metadata)
+		if _, err := tx.ExecContext(ctx,
+			`INSERT INTO messages (message_id, session_id, run_id, role, content, created_at, metadata) VALUES (?, ?, ?, ?, ?, ?, ?)`,
+			msg.MessageID, msg.SessionID, runID, msg.Role, msg.Content, msg.CreatedAt, string(metadata)); err != nil {
+			return false, fmt.Errorf("failed to restore message %s: %w", msg.MessageID, err)
+		}
+	}
+	for _, event := range archive.Events {
+		payload := ""
+		if event.Payload != nil {
+			payload = string(event.Payload)
+		}
+		var seq int64
+		if err := tx.QueryRowContext(ctx, insertEventSQL,
+			event.EventID, runID, event.Ts, event.Type, payload, event.Seq, runID).Scan(&seq); err != nil {
+			return false, fmt.Errorf("failed to restore event %s: %w", event.EventID, err)
+		}
+	}
+	for _, tc := range archive.ToolCalls {
+		args, _ := json.Marshal(tc.Args)
+		if _, err := tx.ExecContext(ctx,
+			`INSERT INTO tool_calls (tool_call_id, run_id, tool_name, kind, status, args, result, error, approval_id, idempotency_key, timeout_ms, created_at, completed_at, progress_seq, progress_chunks) VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`,
+			tc.ToolCallID, runID, tc.ToolName, tc.Kind, tc.Status, string(args), nullStringBytes(tc.Result), nullStringBytes(tc.Error), nullString(tc.ApprovalID), nullString(tc.IdempotencyKey), tc.TimeoutMs, tc.CreatedAt, tc.CompletedAt, tc.ProgressSeq, tc.ProgressChunks); err != nil {
+			return false, fmt.Errorf("failed to restore tool call %s: %w", tc.ToolCallID, err)
+		}
+	}
+	for _, ap := range archive.Approvals {
+		if _, err := tx.ExecContext(ctx,
+			`INSERT INTO approvals (approval_id, run_id, tool_call_id, status, created_at, decided_at, decided_by, reason) VALUES (?, ?, ?, ?, ?, ?, ?, ?)`,
+			ap.ApprovalID, runID, ap.ToolCallID, ap.Status, ap.CreatedAt, ap.DecidedAt, nullString(ap.DecidedBy), nullString(ap.Reason)); err != nil {
+			return false, fmt.Errorf("failed to restore approval %s: %w", ap.ApprovalID, err)
+		}
+	}
+	return true, tx.Commit()
+}
+
 func nullString(s string) sql.NullString {
 	if s == "" {
 		return sql.NullString{}
@@ -3,9 +3,14 @@ package store
 import (
 	"context"
 	"encoding/json"
+	"errors"
+	"fmt"
+	"path/filepath"
+	"strings"
 	"testing"
 	"time"
 
+	"github.com/xiaot623/gogo/orchestrator/internal/clock"
 	"github.com/xiaot623/gogo/orchestrator/internal/domain"
 )
 
@@ -53,7 +58,7 @@ func TestSQLiteStoreSessionAndMessages(t *testing.T) {
 		t.Fatalf("CreateMessage failed: %v", err)
 	}
 
-	messages, err := store.GetMessages(ctx, "s1", 10, "")
+	messages, err := store.GetMessages(ctx, "s1", 10, "", domain.MessageFilter{})
 	if err != nil {
 		t.Fatalf("GetMessages failed: %v", err)
 	}
@@ -111,7 +116,7 @@ func TestSQLiteStoreRunAndEvents(t *testing.T) {
 		t.Fatalf("CreateEvent failed: %v", err)
 	}
 
-	events, err := store.GetEvents(ctx, "r1", 0, []string{}, 10)
+	events, err := store.GetEvents(ctx, "r1", 0, 0, []string{}, 10)
 	if err != nil {
 		t.Fatalf("GetEvents failed: %v", err)
 	}
@@ -153,3 +158,420 @@ func TestSQLiteStoreAgents(t *testing.T) {
 		t.Fatalf("expected 1 agent, got %d", len(agents))
 	}
 }
+
+func TestSQLiteStoreCountActiveRunsByAgent(t *testing.T) {
+	ctx := context.Background()
+	store := newTestStore(t)
+	defer store.Close()
+
+	if err := store.CreateSession(ctx, &domain.Session{SessionID: "s1", UserID: "u1", CreatedAt: time.Now()}); err != nil {
+		t.Fatalf("CreateSession failed: %v", err)
+	}
+	for i, r := range []struct {
+		agentID string
+		status  domain.RunStatus
+	}{
+		{"a1", domain.RunStatusCreated},
+		{"a1", domain.RunStatusRunning},
+		{"a1", domain.RunStatusPausedWaitingTool},
+		{"a1", domain.RunStatusDone},
+		{"a2", domain.RunStatusRunning},
+		{"a3", domain.RunStatusFailed},
+	} {
+		run := &domain.Run{RunID: fmt.Sprintf("r%d", i), SessionID: "s1", RootAgentID: r.agentID, Status: r.status, StartedAt: time.Now()}
+		if err := store.CreateRun(ctx, run); err != nil {
+			t.Fatalf("CreateRun failed: %v", err)
+		}
+	}
+
+	counts, err := store.CountActiveRunsByAgent(ctx)
+	if err != nil {
+		t.Fatalf("CountActiveRunsByAgent failed: %v", err)
+	}
+	if len(counts) != 2 || counts["a1"] != 2 || counts["a2"] != 1 {
+		t.Fatalf("unexpected counts: %v", counts)
+	}
+}
+
+func TestSQLiteStoreCreateToolCallIdempotent(t *testing.T) {
+	ctx := context.Background()
+	store := newTestStore(t)
+	defer store.Close()
+
+	if err := store.CreateSession(ctx, &domain.Session{SessionID: "s1", UserID: "u1", CreatedAt: time.Now()}); err != nil {
+		t.Fatalf("CreateSession failed: %v", err)
+	}
+	if err := store.CreateRun(ctx, &domain.Run{RunID: "r1", SessionID: "s1", RootAgentID: "a1", Status: domain.RunStatusRunning, StartedAt: time.Now()}); err != nil {
+		t.Fatalf("CreateRun failed: %v", err)
+	}
+
+	created := time.Now().Add(-2 * time.Minute)
+	newCall := func(id string, created time.Time) *domain.ToolCall {
+		return &domain.ToolCall{
+			ToolCallID:     id,
+			RunID:          "r1",
+			ToolName:       "calc",
+			Kind:           domain.ToolKindServer,
+			Status:         domain.ToolCallStatusRunning,
+			Args:           json.RawMessage(`{}`),
+			IdempotencyKey: "k1",
+			CreatedAt:      created,
+		}
+	}
+
+	existing, err := store.CreateToolCallIdempotent(ctx, newCall("tc1", created), time.Hour)
+	if err != nil || existing != nil {
+		t.Fatalf("expected first insert to succeed, got %+v, %v", existing, err)
+	}
+
+	existing, err = store.CreateToolCallIdempotent(ctx, newCall("tc2", created.Add(time.Minute)), time.Hour)
+	if err != nil {
+		t.Fatalf("CreateToolCallIdempotent failed: %v", err)
+	}
+	if existing == nil || existing.ToolCallID != "tc1" {
+		t.Fatalf("expected existing tc1, got %+v", existing)
+	}
+	if got, _ := store.GetToolCall(ctx, "tc2"); got != nil {
+		t.Fatalf("duplicate tool call was inserted")
+	}
+
+	// Outside the window the key may be reused. The window is measured from
+	// the new call's CreatedAt, not the wall clock.
+	existing, err = store.CreateToolCallIdempotent(ctx, newCall("tc3", created.Add(time.Minute)), 30*time.Second)
+	if err != nil || existing != nil {
+		t.Fatalf("expected insert after window, got %+v, %v", existing, err)
+	}
+}
+
+func newBenchStore(b *testing.B) *SQLiteStore {
+	b.Helper()
+	store, err := NewSQLiteStore("file:" + b.TempDir() + "/bench.db?cache=shared&mode=rwc")
+	if err != nil {
+		b.Fatalf("failed to create store: %v", err)
+	}
+	b.Cleanup(func() { store.Close() })
+
+	ctx := context.Background()
+	if err := store.CreateSession(ctx, &domain.Session{SessionID: "s1", UserID: "u1", CreatedAt: time.Now()}); err != nil {
+		b.Fatalf("CreateSession failed: %v", err)
+	}
+	if err := store.CreateRun(ctx, &domain.Run{RunID: "r1", SessionID: "s1", RootAgentID: "a1", Status: domain.RunStatusRunning, StartedAt: time.Now()}); err != nil {
+		b.Fatalf("CreateRun failed: %v", err)
+	}
+	return store
+}
+
+func benchDeltaEvent(i int) *domain.Event {
+	return &domain.Event{
+		EventID: fmt.Sprintf("e%d", i),
+		RunID:   "r1",
+		Ts:      time.Now().UnixMilli(),
+		Type:    domain.EventTypeAgentStreamDelta,
+		Payload: json.RawMessage(`{"text":"tok"}`),
+	}
+}
+
+func BenchmarkCreateEventPerEvent(b *testing.B) {
+	ctx := context.Background()
+	store := newBenchStore(b)
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		if err := store.CreateEvent(ctx, benchDeltaEvent(i)); err != nil {
+			b.Fatalf("CreateEvent failed: %v", err)
+		}
+	}
+}
+
+func BenchmarkCreateEventsBatched(b *testing.B) {
+	const batchSize = 32
+	ctx := context.Background()
+	store := newBenchStore(b)
+	b.ResetTimer()
+	batch := make([]*domain.Event, 0, batchSize)
+	for i := 0; i < b.N; i++ {
+		batch = append(batch, benchDeltaEvent(i))
+		if len(batch) == batchSize || i == b.N-1 {
+			if err := store.CreateEvents(ctx, batch); err != nil {
+				b.Fatalf("CreateEvents failed: %v", err)
+			}
+			batch = batch[:0]
+		}
+	}
+}
+
+func TestSQLiteStoreUsesInjectedClock(t *testing.T) {
+	ctx := context.Background()
+	store := newTestStore(t)
+	defer store.Close()
+
+	now := time.Date(2024, 1, 1, 12, 0, 0, 0, time.UTC)
+	store.SetClock(clock.NewFake(now))
+
+	if err := store.CreateSession(ctx, &domain.Session{SessionID: "s1", UserID: "u1", CreatedAt: now}); err != nil {
+		t.Fatalf("CreateSession failed: %v", err)
+	}
+	if err := store.CreateRun(ctx, &domain.Run{RunID: "r1", SessionID: "s1", RootAgentID: "a1", Status: domain.RunStatusRunning, StartedAt: now}); err != nil {
+		t.Fatalf("CreateRun failed: %v", err)
+	}
+	if err := store.CreateToolCall(ctx, &domain.ToolCall{ToolCallID: "tc1", RunID: "r1", ToolName: "calc", Kind: domain.ToolKindServer, Status: domain.ToolCallStatusRunning, Args: json.RawMessage(`{}`), CreatedAt: now}); err != nil {
+		t.Fatalf("CreateToolCall failed: %v", err)
+	}
+	if _, err := store.UpdateToolCallResult(ctx, "tc1", domain.ToolCallStatusSucceeded, []byte(`{}`), nil); err != nil {
+		t.Fatalf("UpdateToolCallResult failed: %v", err)
+	}
+
+	tc, err := store.GetToolCall(ctx, "tc1")
+	if err != nil || tc == nil || tc.CompletedAt == nil {
+		t.Fatalf("GetToolCall failed: %+v, %v", tc, err)
+	}
+	if !tc.CompletedAt.Equal(now) {
+		t.Fatalf("expected completed_at %v, got %v", now, tc.CompletedAt)
+	}
+}
+
+func TestSQLiteStoreCreateMessages(t *testing.T) {
+	ctx := context.Background()
+	store := newTestStore(t)
+	defer store.Close()
+
+	if err := store.CreateSession(ctx, &domain.Session{SessionID: "s1", UserID: "u1", CreatedAt: time.Now()}); err != nil {
+		t.Fatalf("CreateSession failed: %v", err)
+	}
+
+	// More than one INSERT's worth, all with the same timestamp.
+	base := time.Now().Add(-time.Hour)
+	messages := make([]domain.Message, createMessagesBatch+5)
+	for i := range messages {
+		messages[i] = domain.Message{MessageID: fmt.Sprintf("m%03d", i), SessionID: "s1", Role: "user", Content: fmt.Sprint(i), CreatedAt: base}
+	}
+	if err := store.CreateMessages(ctx, messages); err != nil {
+		t.Fatalf("CreateMessages failed: %v", err)
+	}
+	got, err := store.GetRecentMessages(ctx, "s1", 0)
+	if err != nil || len(got) != len(messages) {
+		t.Fatalf("GetRecentMessages = %d messages, %v", len(got), err)
+	}
+	for i, msg := range got {
+		if msg.MessageID != messages[i].MessageID {
+			t.Fatalf("message %d: got %s, want %s", i, msg.MessageID, messages[i].MessageID)
+		}
+	}
+
+	// A duplicate ID fails the whole call.
+	dup := []domain.Message{
+		{MessageID: "new", SessionID: "s1", Role: "user", CreatedAt: base},
+		{MessageID: "m000", SessionID: "s1", Role: "user", CreatedAt: base},
+	}
+	if err := store.CreateMessages(ctx, dup); err == nil {
+		t.Fatal("expected a duplicate message_id to fail")
+	}
+	if got, _ := store.GetRecentMessages(ctx, "s1", 0); len(got) != len(messages) {
+		t.Fatalf("expected no message from the failed call, got %d messages", len(got))
+	}
+}
+
+func TestSQLiteStoreRunPriority(t *testing.T) {
+	ctx := context.Background()
+	store := newTestStore(t)
+	defer store.Close()
+
+	now := time.Now()
+	if err := store.CreateSession(ctx, &domain.Session{SessionID: "s1", UserID: "u1", CreatedAt: now}); err != nil {
+		t.Fatalf("CreateSession failed: %v", err)
+	}
+	for _, run := range []*domain.Run{
+		{RunID: "r1", SessionID: "s1", RootAgentID: "a1", Status: domain.RunStatusRunning, StartedAt: now},
+		{RunID: "r2", SessionID: "s1", RootAgentID: "a1", Status: domain.RunStatusRunning, StartedAt: now, Priority: domain.RunPriorityHigh},
+	} {
+		if err := store.CreateRun(ctx, run); err != nil {
+			t.Fatalf("CreateRun failed: %v", err)
+		}
+	}
+	for runID, want := range map[string]domain.RunPriority{"r1": domain.RunPriorityNormal, "r2": domain.RunPriorityHigh} {
+		run, err := store.GetRun(ctx, runID)
+		if err != nil || run == nil || run.Priority != want {
+			t.Fatalf("GetRun(%s) = %+v, %v; want priority %s", runID, run, err, want)
+		}
+	}
+}
+
+func TestSQLiteStoreMigratesLegacyToolsTable(t *testing.T) {
+	ctx := context.Background()
+	path := filepath.Join(t.TempDir(), "orchestrator.db")
+
+	// The tools table as the early store created it.
+	legacy, err := openSQLite("file:" + path)
+	if err != nil {
+		t.Fatalf("failed to open database: %v", err)
+	}
+	if _, err := legacy.Exec(`CREATE TABLE tools (name TEXT PRIMARY KEY, kind TEXT NOT NULL, policy TEXT, metadata TEXT)`); err != nil {
+		t.Fatalf("failed to create legacy table: %v", err)
+	}
+	if _, err := legacy.Exec(`INSERT INTO tools (name, kind) VALUES ('legacy.tool', 'server')`); err != nil {
+		t.Fatalf("failed to insert legacy tool: %v", err)
+	}
+	legacy.Close()
+
+	store, err := NewSQLiteStore("file:" + path)
+	if err != nil {
+		t.Fatalf("failed to migrate legacy database: %v", err)
+	}
+	defer store.Close()
+
+	tool, err := store.GetTool(ctx, "legacy.tool")
+	if err != nil || tool == nil {
+		t.Fatalf("GetTool failed: %+v, %v", tool, err)
+	}
+	if tool.TimeoutMs != 60000 || tool.ClientID != "" {
+		t.Fatalf("unexpected migrated tool: %+v", tool)
+	}
+
+	if err := store.UpsertTool(ctx, &domain.Tool{Name: "client.tool", Kind: domain.ToolKindClient, Schema: json.RawMessage(`{"type":"object"}`), ClientID: "c1", TimeoutMs: 1000}); err != nil {
+		t.Fatalf("UpsertTool failed: %v", err)
+	}
+	tool, err = store.GetTool(ctx, "client.tool")
+	if err != nil || tool == nil || tool.ClientID != "c1" || tool.TimeoutMs != 1000 || string(tool.Schema) != `{"type":"object"}` {
+		t.Fatalf("unexpected tool: %+v, %v", tool, err)
+	}
+}
+
+func TestSQLiteStoreEventSeqIsUniquePerRun(t *testing.T) {
+	ctx := context.Background()
+	store := newTestStore(t)
+	defer store.Close()
+
+	if err := store.CreateSession(ctx, &domain.Session{SessionID: "s1", UserID: "u1", CreatedAt: time.Now()}); err != nil {
+		t.Fatalf("CreateSession failed: %v", err)
+	}
+	if err := store.CreateRun(ctx, &domain.Run{RunID: "r1", SessionID: "s1", RootAgentID: "a1", Status: domain.RunStatusRunning, StartedAt: time.Now()}); err != nil {
+		t.Fatalf("CreateRun failed: %v", err)
+	}
+
+	event := func(id string, seq int64) *domain.Event {
+		return &domain.Event{EventID: id, RunID: "r1", Ts: 1, Seq: seq, Type: domain.EventTypeAgentStreamDelta}
+	}
+	if err := store.CreateEvent(ctx, event("e1", 1)); err != nil {
+		t.Fatalf("CreateEvent failed: %v", err)
+	}
+	if err := store.CreateEvent(ctx, event("e2", 1)); !errors.Is(err, ErrEventSeqTaken) {
+		t.Fatalf("expected ErrEventSeqTaken, got %v", err)
+	}
+	if err := store.CreateEvents(ctx, []*domain.Event{event("e3", 2), event("e4", 1)}); !errors.Is(err, ErrEventSeqTaken) {
+		t.Fatalf("expected ErrEventSeqTaken from CreateEvents, got %v", err)
+	}
+	if seq, _ := store.GetEventSeq(ctx, "r1", "e3"); seq != 0 {
+		t.Fatalf("failed batch was partly written: e3 has seq %d", seq)
+	}
+
+	// Without a seq the store picks the next free one.
+	retry := event("e2", 0)
+	if err := store.CreateEvent(ctx, retry); err != nil || retry.Seq != 2 {
+		t.Fatalf("expected seq 2, got %d, %v", retry.Seq, err)
+	}
+}
+
+func TestSQLiteStoreRenumbersDuplicateEventSeqs(t *testing.T) {
+	ctx := context.Background()
+	path := filepath.Join(t.TempDir(), "orchestrator.db")
+
+	store, err := NewSQLiteStore("file:" + path)
+	if err != nil {
+		t.Fatalf("failed to create store: %v", err)
+	}
+	if err := store.CreateSession(ctx, &domain.Session{SessionID: "s1", UserID: "u1", CreatedAt: time.Now()}); err != nil {
+		t.Fatalf("CreateSession failed: %v", err)
+	}
+	for _, runID := range []string{"r1", "r2"} {
+		if err := store.CreateRun(ctx, &domain.Run{RunID: runID, SessionID: "s1", RootAgentID: "a1", Status: domain.RunStatusRunning, StartedAt: time.Now()}); err != nil {
+			t.Fatalf("CreateRun failed: %v", err)
+		}
+	}
+	// Events as a store without the unique index could have written them.
+	if _, err := store.db.Exec(`DROP INDEX idx_events_run_seq_unique`); err != nil {
+		t.Fatalf("failed to drop index: %v", err)
+	}
+	for _, row := range []struct {
+		id      string
+		run     string
+		seq, ts int64
+	}{{"a1", "r1", 1, 10}, {"a2", "r1", 2, 20}, {"a3", "r1", 2, 21}, {"a4", "r1", 3, 30}, {"b1", "r2", 1, 10}} {
+		if _, err := store.db.Exec(`INSERT INTO events (event_id, run_id, ts, type, seq) VALUES (?, ?, ?, 'agent_stream_delta', ?)`, row.id, row.run, row.ts, row.seq); err != nil {
+			t.Fatalf("failed to insert event: %v", err)
+		}
+	}
+	store.Close()
+
+	store, err = NewSQLiteStore("file:" + path)
+	if err != nil {
+		t.Fatalf("failed to migrate database: %v", err)
+	}
+	defer store.Close()
+
+	events, err := store.GetEvents(ctx, "r1", 0, 0, nil, 0)
+	if err != nil {
+		t.Fatalf("GetEvents failed: %v", err)
+	}
+	var got []string
+	for _, ev := range events {
+		got = append(got, fmt.Sprintf("%s:%d", ev.EventID, ev.Seq))
+	}
+	if strings.Join(got, " ") != "a1:1 a2:2 a3:3 a4:4" {
+		t.Fatalf("unexpected renumbered events: %v", got)
+	}
+	if seq, _ := store.GetEventSeq(ctx, "r2", "b1"); seq != 1 {
+		t.Fatalf("unaffected run was renumbered: seq %d", seq)
+	}
+}
+
+func TestSQLiteStoreRoutesReadsToReadDSN(t *testing.T) {
+	ctx := context.Background()
+	path := filepath.Join(t.TempDir(), "orchestrator.db")
+	store, err := NewSQLiteStoreWithReadDSN("file:"+path, "file:"+path+"?mode=ro")
+	if err != nil {
+		t.Fatalf("failed to create store: %v", err)
+	}
+	defer store.Close()
+
+	if store.readDB == store.db {
+		t.Fatal("expected a separate read pool")
+	}
+	if err := store.Ping(ctx); err != nil {
+		t.Fatalf("Ping failed: %v", err)
+	}
+
+	now := time.Now()
+	if err := store.CreateSession(ctx, &domain.Session{SessionID: "s1", UserID: "u1", CreatedAt: now}); err != nil {
+		t.Fatalf("CreateSession failed: %v", err)
+	}
+	if err := store.CreateRun(ctx, &domain.Run{RunID: "r1", SessionID: "s1", RootAgentID: "a1", Status: domain.RunStatusRunning, StartedAt: now}); err != nil {
+		t.Fatalf("CreateRun failed: %v", err)
+	}
+	if err := store.CreateEvent(ctx, &domain.Event{EventID: "e1", RunID: "r1", Ts: now.UnixMilli(), Type: domain.EventTypeRunStarted, Payload: json.RawMessage(`{}`)}); err != nil {
+		t.Fatalf("CreateEvent failed: %v", err)
+	}
+
+	events, err := store.GetEvents(ctx, "r1", 0, 0, nil, 0)
+	if err != nil || len(events) != 1 {
+		t.Fatalf("GetEvents = %v, %v; want 1 event", events, err)
+	}
+	runs, err := store.ListRuns(ctx, domain.RunFilter{SessionID: "s1"})
+	if err != nil || len(runs) != 1 {
+		t.Fatalf("ListRuns = %v, %v; want 1 run", runs, err)
+	}
+
+	if _, err := store.readDB.ExecContext(ctx, `DELETE FROM events`); err == nil {
+		t.Fatal("expected the read pool to be read-only")
+	}
+}
+
+func TestSQLiteStoreReadDSNFallsBackToWritePool(t *testing.T) {
+	store, err := NewSQLiteStoreWithReadDSN(":memory:", "")
+	if err != nil {
+		t.Fatalf("failed to create store: %v", err)
+	}
+	defer store.Close()
+
+	if store.readDB != store.db {
+		t.Fatal("expected reads to use the write pool")
+	}
+}
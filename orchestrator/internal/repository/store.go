@@ -3,35 +3,115 @@ package store
 
 import (
 	"context"
+	"encoding/json"
+	"errors"
+	"time"
 
 	"github.com/xiaot623/gogo/orchestrator/internal/domain"
 )
 
+// ErrEventSeqTaken is returned by CreateEvent and CreateEvents when an
+// event's caller-assigned seq is already used by another event of its run.
+var ErrEventSeqTaken = errors.New("event seq already taken")
+
 // Store defines the interface for data persistence.
 type Store interface {
 	// Session operations
 	CreateSession(ctx context.Context, session *domain.Session) error
 	GetSession(ctx context.Context, sessionID string) (*domain.Session, error)
 	GetOrCreateSession(ctx context.Context, sessionID, userID string) (*domain.Session, error)
+	// UpdateSessionMetadata shallow-merges metadata into the session's existing
+	// metadata object (null values delete keys), or replaces it when replace is
+	// true. Returns nil if the session does not exist.
+	UpdateSessionMetadata(ctx context.Context, sessionID string, metadata json.RawMessage, replace bool) (*domain.Session, error)
 
 	// Message operations
 	CreateMessage(ctx context.Context, message *domain.Message) error
-	GetMessages(ctx context.Context, sessionID string, limit int, before string) ([]domain.Message, error)
+	// CreateMessages inserts messages in one transaction, in the order given;
+	// either all of them are stored or none is.
+	CreateMessages(ctx context.Context, messages []domain.Message) error
+	GetMessages(ctx context.Context, sessionID string, limit int, before string, filter domain.MessageFilter) ([]domain.Message, error)
+	// GetRecentMessages returns a session's latest limit messages (all when
+	// limit <= 0) in chronological order.
+	GetRecentMessages(ctx context.Context, sessionID string, limit int) ([]domain.Message, error)
 
 	// Run operations
 	CreateRun(ctx context.Context, run *domain.Run) error
+	// CreateRunIdempotent inserts run unless the session already has a run
+	// with the same RequestID, which is then returned instead (nil when run
+	// was inserted). An empty RequestID always inserts.
+	CreateRunIdempotent(ctx context.Context, run *domain.Run) (*domain.Run, error)
+	// GetRunByRequestID returns the run created for a session's request_id,
+	// or nil if there is none.
+	GetRunByRequestID(ctx context.Context, sessionID, requestID string) (*domain.Run, error)
 	GetRun(ctx context.Context, runID string) (*domain.Run, error)
+	// GetRunAggregate reads a run with the tool calls, messages and latest
+	// events opts asks for, in one read transaction. Returns nil if not
+	// found.
+	GetRunAggregate(ctx context.Context, runID string, opts domain.RunAggregateOptions) (*domain.RunAggregate, error)
+	// ListRuns returns runs matching filter, newest first.
+	ListRuns(ctx context.Context, filter domain.RunFilter) ([]domain.Run, error)
 	UpdateRunStatus(ctx context.Context, runID string, status domain.RunStatus) error
 	UpdateRunCompleted(ctx context.Context, runID string, status domain.RunStatus, errData []byte) error
+	// CompleteRunIfActive is UpdateRunCompleted for a run that has not yet
+	// finished. It reports false, changing nothing, if the run is done,
+	// failed or cancelled.
+	CompleteRunIfActive(ctx context.Context, runID string, status domain.RunStatus, errData []byte) (bool, error)
+	UpdateRunTotalTokens(ctx context.Context, runID string, totalTokens int) error
+	// SumLLMUsage aggregates token counts over a run's llm_call_done events.
+	SumLLMUsage(ctx context.Context, runID string) (*domain.LLMUsage, error)
+
+	// Archival operations
+	// ListArchivableRuns returns unarchived terminal runs that ended (or were
+	// last restored) before cutoff, oldest first.
+	ListArchivableRuns(ctx context.Context, cutoff time.Time, limit int) ([]domain.Run, error)
+	// ListOverdueRuns returns unfinished runs whose deadline_at is at or
+	// before now, earliest first.
+	ListOverdueRuns(ctx context.Context, now time.Time, limit int) ([]domain.Run, error)
+	// ExportRun reads a run with all of its rows. Returns nil if not found.
+	ExportRun(ctx context.Context, runID string) (*domain.RunArchive, error)
+	// MarkRunArchived deletes the run's rows, leaving the run as a tombstone
+	// pointing at location. Returns false if it was already archived.
+	MarkRunArchived(ctx context.Context, runID string, location string) (bool, error)
+	// RestoreRun re-inserts an archived run's rows and clears the tombstone.
+	// Returns false if the run was not archived.
+	RestoreRun(ctx context.Context, archive *domain.RunArchive) (bool, error)
 
 	// Event operations
+	// CreateEvent inserts an event. A zero Seq is assigned the run's next seq;
+	// a taken one fails with ErrEventSeqTaken.
 	CreateEvent(ctx context.Context, event *domain.Event) error
-	GetEvents(ctx context.Context, runID string, afterTs int64, types []string, limit int) ([]domain.Event, error)
+	// CreateEvents inserts events in order within a single transaction, with
+	// seqs handled as in CreateEvent.
+	CreateEvents(ctx context.Context, events []*domain.Event) error
+	// GetLastEventPosition returns the highest seq of a run's events and
+	// that event's ts (zeros when there are none).
+	GetLastEventPosition(ctx context.Context, runID string) (seq, ts int64, err error)
+	// GetEventSeq returns the seq of one of a run's events, or 0 when the
+	// run has no such event.
+	GetEventSeq(ctx context.Context, runID, eventID string) (int64, error)
+	// GetEvents returns events ordered by (ts, seq) that come after the given
+	// position. With afterSeq == 0 every event at afterTs is skipped.
+	GetEvents(ctx context.Context, runID string, afterTs, afterSeq int64, types []string, limit int) ([]domain.Event, error)
+	// CountEventsByType returns the number of a run's events of each type.
+	CountEventsByType(ctx context.Context, runID string) (map[domain.EventType]int, error)
+	// GetEventTimeRange returns the ts of a run's first and last events
+	// (zeros when there are none).
+	GetEventTimeRange(ctx context.Context, runID string) (firstTs, lastTs int64, err error)
 
 	// Agent operations
 	RegisterAgent(ctx context.Context, agent *domain.Agent) error
 	GetAgent(ctx context.Context, agentID string) (*domain.Agent, error)
 	ListAgents(ctx context.Context) ([]domain.Agent, error)
+	// CountActiveRunsByAgent returns the number of CREATED or RUNNING runs
+	// per root agent. Agents without such runs are absent from the map.
+	CountActiveRunsByAgent(ctx context.Context) (map[string]int, error)
+	// RecordAgentFailure stores an agent's latest invocation error and bumps
+	// its consecutive failure count, marking it unhealthy once the count
+	// reaches unhealthyAfter (0 = never).
+	RecordAgentFailure(ctx context.Context, agentID, lastError string, unhealthyAfter int) error
+	// RecordAgentSuccess clears an agent's failure streak and marks it healthy.
+	RecordAgentSuccess(ctx context.Context, agentID string) error
 
 	// Tool operations
 	CreateTool(ctx context.Context, tool *domain.Tool) error
@@ -41,20 +121,55 @@ type Store interface {
 
 	// ToolCall operations
 	CreateToolCall(ctx context.Context, toolCall *domain.ToolCall) error
+	// CreateToolCallIdempotent inserts toolCall unless a tool call with the same
+	// (run_id, tool_name, idempotency_key) was created within window before
+	// toolCall.CreatedAt, in which case nothing is written and the existing
+	// tool call is returned.
+	CreateToolCallIdempotent(ctx context.Context, toolCall *domain.ToolCall, window time.Duration) (*domain.ToolCall, error)
 	GetToolCall(ctx context.Context, toolCallID string) (*domain.ToolCall, error)
 	GetToolCallByIdempotencyKey(ctx context.Context, runID string, toolName string, idempotencyKey string) (*domain.ToolCall, error)
 	UpdateToolCallStatus(ctx context.Context, toolCallID string, status domain.ToolCallStatus) (bool, error)
 	UpdateToolCallResult(ctx context.Context, toolCallID string, status domain.ToolCallStatus, result []byte, errData []byte) (bool, error)
 	UpdateToolCallApproval(ctx context.Context, toolCallID string, approvalID string, status domain.ToolCallStatus) (bool, error)
-	ListExpiredToolCalls(ctx context.Context, limit int) ([]domain.ToolCall, error)
+	// RecordToolProgress accepts a progress chunk for a dispatched or running
+	// tool call if seq is beyond the last accepted one and fewer than
+	// maxChunks (0 = unlimited) were accepted; it moves the call to RUNNING.
+	RecordToolProgress(ctx context.Context, toolCallID string, seq int64, maxChunks int) (bool, error)
+	// ListExpiredToolCalls returns unfinished tool calls whose timeout_ms had
+	// elapsed by now.
+	ListExpiredToolCalls(ctx context.Context, now time.Time, limit int) ([]domain.ToolCall, error)
+	// CountActiveToolCalls counts a run's tool calls that have not reached a
+	// terminal status.
+	CountActiveToolCalls(ctx context.Context, runID string) (int, error)
 
 	// Approval operations
 	CreateApproval(ctx context.Context, approval *domain.Approval) error
 	GetApproval(ctx context.Context, approvalID string) (*domain.Approval, error)
+	// ListPendingApprovals returns pending approvals matching filter, oldest first.
+	ListPendingApprovals(ctx context.Context, filter domain.PendingApprovalFilter) ([]domain.PendingApproval, error)
 	UpdateApprovalStatus(ctx context.Context, approvalID string, status domain.ApprovalStatus, decidedBy string, reason string) error
 	ExpireApprovalIfPending(ctx context.Context, approvalID string, reason string) (bool, error)
+	// RememberApproval stores ra, replacing an earlier one for the same scope,
+	// user, session and tool.
+	RememberApproval(ctx context.Context, ra *domain.RememberedApproval) error
+	// FindRememberedApproval returns an unexpired remembered approval of
+	// toolName for the session or user, or nil.
+	FindRememberedApproval(ctx context.Context, userID, sessionID, toolName string, now time.Time) (*domain.RememberedApproval, error)
+	// ClearRememberedApprovals deletes those matching filter and returns how
+	// many were deleted.
+	ClearRememberedApprovals(ctx context.Context, filter domain.RememberedApprovalFilter) (int64, error)
+
+	// Request nonces
+	// ClaimNonce records n unless its kind and nonce are already taken, in
+	// which case the existing record is returned. Expired nonces are purged
+	// first, so they can be claimed again.
+	ClaimNonce(ctx context.Context, n *domain.RequestNonce) (*domain.RequestNonce, error)
+	SaveNonceResponse(ctx context.Context, kind domain.NonceKind, nonce string, response json.RawMessage) error
+	DeleteNonce(ctx context.Context, kind domain.NonceKind, nonce string) error
 
 	// Lifecycle
+	// Ping verifies the database connection is usable.
+	Ping(ctx context.Context) error
 	Close() error
 }
 
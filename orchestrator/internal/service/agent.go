@@ -3,22 +3,47 @@ package service
 import (
 	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
+	"net"
 	"time"
 
+	"github.com/xiaot623/gogo/orchestrator/internal/adapter/agentclient"
 	"github.com/xiaot623/gogo/orchestrator/internal/domain"
 )
 
-func (s *Service) RegisterAgent(ctx context.Context, agentID, name, endpoint string, capabilities []string) (*domain.Agent, error) {
+// RegisterAgent registers or updates an agent. maxConcurrentToolCalls
+// overrides MaxConcurrentToolCalls for the agent's runs (0 = keep it, -1 =
+// no cap). requestFilter limits what the agent is sent (nil = everything).
+// llmConfig configures a built-in AgentProtocolLLMTools agent and is ignored
+// for other protocols. It fails with ErrMaintenance while read-only.
+func (s *Service) RegisterAgent(ctx context.Context, agentID, name, endpoint string, capabilities []string, headers map[string]string, protocol domain.AgentProtocol, responseFormat domain.AgentResponseFormat, cancelURL string, maxConcurrentToolCalls int, requestFilter *domain.AgentRequestFilter, llmConfig *domain.LLMAgentConfig) (*domain.Agent, error) {
+	if err := s.checkWritable(); err != nil {
+		return nil, err
+	}
+	return s.registerAgent(ctx, agentID, name, endpoint, capabilities, headers, protocol, responseFormat, cancelURL, maxConcurrentToolCalls, requestFilter, llmConfig)
+}
+
+func (s *Service) registerAgent(ctx context.Context, agentID, name, endpoint string, capabilities []string, headers map[string]string, protocol domain.AgentProtocol, responseFormat domain.AgentResponseFormat, cancelURL string, maxConcurrentToolCalls int, requestFilter *domain.AgentRequestFilter, llmConfig *domain.LLMAgentConfig) (*domain.Agent, error) {
+	if !protocol.Builtin() {
+		llmConfig = nil
+	}
 	caps, _ := json.Marshal(capabilities)
-	now := time.Now()
+	now := s.clock.Now()
 	agent := &domain.Agent{
-		AgentID:      agentID,
-		Name:         name,
-		Endpoint:     endpoint,
-		Capabilities: caps,
-		Status:       "healthy",
-		CreatedAt:    now,
+		AgentID:                agentID,
+		Name:                   name,
+		Endpoint:               endpoint,
+		Capabilities:           caps,
+		Headers:                headers,
+		Protocol:               protocol,
+		ResponseFormat:         responseFormat,
+		CancelURL:              cancelURL,
+		MaxConcurrentToolCalls: maxConcurrentToolCalls,
+		RequestFilter:          requestFilter,
+		LLM:                    llmConfig,
+		Status:                 "healthy",
+		CreatedAt:              now,
 	}
 
 	if err := s.store.RegisterAgent(ctx, agent); err != nil {
@@ -28,6 +53,46 @@ func (s *Service) RegisterAgent(ctx context.Context, agentID, name, endpoint str
 	return agent, nil
 }
 
+// ErrAgentUnreachable is returned when a registration's probe finds the
+// agent down or answering with an error.
+var ErrAgentUnreachable = errors.New("agent endpoint failed verification")
+
+// ProbeAgent checks that an agent about to be registered answers its probe
+// within AgentProbeTimeout (see agentclient.Client.Probe). Built-in agents
+// have nothing to probe.
+func (s *Service) ProbeAgent(ctx context.Context, endpoint string, protocol domain.AgentProtocol, headers map[string]string) error {
+	if protocol.Builtin() {
+		return nil
+	}
+	timeout := s.config.AgentProbeTimeout
+	if timeout <= 0 {
+		timeout = 3 * time.Second
+	}
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+	if err := s.agentClient.Probe(ctx, endpoint, protocol, headers); err != nil {
+		return fmt.Errorf("%w: %v", ErrAgentUnreachable, err)
+	}
+	return nil
+}
+
+// BootstrapAgents registers the agents listed in BOOTSTRAP_AGENTS. Agents
+// that already exist are updated in place, keeping their last heartbeat.
+// Bootstrapping is configuration, so it runs even in read-only mode.
+func (s *Service) BootstrapAgents(ctx context.Context) error {
+	for _, a := range s.config.BootstrapAgents {
+		name := a.Name
+		if name == "" {
+			name = a.AgentID
+		}
+		if _, err := s.registerAgent(ctx, a.AgentID, name, a.Endpoint, a.Capabilities, a.Headers, domain.AgentProtocol(a.Protocol), domain.AgentResponseFormat(a.ResponseFormat), a.CancelURL, a.MaxConcurrentToolCalls, a.RequestFilter, a.LLM); err != nil {
+			return fmt.Errorf("agent %s: %w", a.AgentID, err)
+		}
+		s.logger.InfoContext(ctx, "registered bootstrap agent", "agent_id", a.AgentID, "endpoint", a.Endpoint)
+	}
+	return nil
+}
+
 func (s *Service) ListAgents(ctx context.Context) ([]domain.Agent, error) {
 	agents, err := s.store.ListAgents(ctx)
 	if err != nil {
@@ -36,6 +101,16 @@ func (s *Service) ListAgents(ctx context.Context) ([]domain.Agent, error) {
 	return agents, nil
 }
 
+// ActiveRunsByAgent returns how many runs are CREATED or RUNNING per agent,
+// so operators can spot overloaded agents.
+func (s *Service) ActiveRunsByAgent(ctx context.Context) (map[string]int, error) {
+	counts, err := s.store.CountActiveRunsByAgent(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to count active runs: %w", err)
+	}
+	return counts, nil
+}
+
 func (s *Service) GetAgent(ctx context.Context, agentID string) (*domain.Agent, error) {
 	agent, err := s.store.GetAgent(ctx, agentID)
 	if err != nil {
@@ -43,3 +118,71 @@ func (s *Service) GetAgent(ctx context.Context, agentID string) (*domain.Agent,
 	}
 	return agent, nil
 }
+
+// resolveAgent looks up the agent for a run. When AgentFallbackToDefault is
+// enabled and the agent is missing or unhealthy, the configured default agent
+// is returned instead, provided it is itself registered and healthy.
+func (s *Service) resolveAgent(ctx context.Context, agentID string) (*domain.Agent, error) {
+	agent, err := s.store.GetAgent(ctx, agentID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get agent: %w", err)
+	}
+	if agent != nil && agent.Status == "healthy" {
+		return agent, nil
+	}
+
+	defaultID := s.config.DefaultAgentID
+	if s.config.AgentFallbackToDefault && defaultID != "" && defaultID != agentID {
+		fallback, err := s.store.GetAgent(ctx, defaultID)
+		if err != nil {
+			return nil, fmt.Errorf("failed to get default agent: %w", err)
+		}
+		if fallback != nil && fallback.Status == "healthy" {
+			return fallback, nil
+		}
+	}
+
+	if agent == nil {
+		return nil, fmt.Errorf("agent %s not found", agentID)
+	}
+	return agent, nil
+}
+
+// agentUnavailable reports whether an invocation error means the agent itself
+// is failing (unreachable, timed out or answering 5xx) rather than the run.
+func agentUnavailable(err error) bool {
+	var statusErr *agentclient.StatusError
+	if errors.As(err, &statusErr) {
+		return statusErr.StatusCode >= 500
+	}
+	var netErr net.Error
+	if errors.As(err, &netErr) {
+		return true
+	}
+	return errors.Is(err, context.DeadlineExceeded)
+}
+
+// agentErrorCode is the run_failed code for an invocation that failed with
+// err.
+func agentErrorCode(err error) string {
+	if errors.Is(err, agentclient.ErrFrameTooLarge) {
+		return "agent_frame_too_large"
+	}
+	return "agent_error"
+}
+
+// recordAgentFailure notes a failed invocation on the agent, marking it
+// unhealthy after AgentUnhealthyAfterFailures in a row.
+func (s *Service) recordAgentFailure(ctx context.Context, agentID string, err error) {
+	if err := s.store.RecordAgentFailure(ctx, agentID, err.Error(), s.config.AgentUnhealthyAfterFailures); err != nil {
+		s.logger.WarnContext(ctx, "failed to record agent failure", "agent_id", agentID, "error", err)
+	}
+}
+
+// recordAgentSuccess clears the agent's failure streak after a successful
+// invocation.
+func (s *Service) recordAgentSuccess(ctx context.Context, agentID string) {
+	if err := s.store.RecordAgentSuccess(ctx, agentID); err != nil {
+		s.logger.WarnContext(ctx, "failed to record agent success", "agent_id", agentID, "error", err)
+	}
+}
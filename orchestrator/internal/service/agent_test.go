@@ -0,0 +1,177 @@
+package service
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/xiaot623/gogo/orchestrator/internal/adapter/agentclient"
+	"github.com/xiaot623/gogo/orchestrator/internal/adapter/ingress"
+	"github.com/xiaot623/gogo/orchestrator/internal/adapter/llm"
+	"github.com/xiaot623/gogo/orchestrator/internal/config"
+	"github.com/xiaot623/gogo/orchestrator/internal/domain"
+	"github.com/xiaot623/gogo/orchestrator/policy"
+	"github.com/xiaot623/gogo/orchestrator/tests/helpers"
+)
+
+func TestInvokeAgentDefaultAndFallback(t *testing.T) {
+	ctx := context.Background()
+	db := helpers.NewTestSQLiteStore(t)
+
+	cfg := &config.Config{AgentTimeout: time.Second, DefaultAgentID: "main", AgentFallbackToDefault: true}
+	policyEngine, err := policy.NewEngine(ctx, policy.DefaultPolicy)
+	if err != nil {
+		t.Fatalf("NewEngine failed: %v", err)
+	}
+	svc := New(db, agentclient.NewClient(), ingress.NewClient(""), llm.NewClient("", "", time.Second), cfg, policyEngine)
+
+	// Endpoints are unreachable; only the synchronous part of InvokeAgent matters here.
+	for _, agent := range []*domain.Agent{
+		{AgentID: "main", Name: "Main", Endpoint: "http://127.0.0.1:1", Status: "healthy", CreatedAt: time.Now()},
+		{AgentID: "sick", Name: "Sick", Endpoint: "http://127.0.0.1:1", Status: "unhealthy", CreatedAt: time.Now()},
+	} {
+		if err := db.RegisterAgent(ctx, agent); err != nil {
+			t.Fatalf("RegisterAgent: %v", err)
+		}
+	}
+
+	input := domain.InputMessage{Role: "user", Content: "hi"}
+
+	resp, err := svc.InvokeAgent(ctx, domain.InvokeRequest{SessionID: "s1", InputMessage: input})
+	if err != nil {
+		t.Fatalf("InvokeAgent without agent_id: %v", err)
+	}
+	if resp.AgentID != "main" || resp.Fallback {
+		t.Fatalf("expected default agent without fallback, got %+v", resp)
+	}
+
+	for _, requested := range []string{"sick", "missing"} {
+		resp, err = svc.InvokeAgent(ctx, domain.InvokeRequest{SessionID: "s1", AgentID: requested, InputMessage: input})
+		if err != nil {
+			t.Fatalf("InvokeAgent(%s): %v", requested, err)
+		}
+		if resp.AgentID != "main" || !resp.Fallback || resp.RequestedAgentID != requested {
+			t.Fatalf("expected fallback from %s to main, got %+v", requested, resp)
+		}
+	}
+
+	cfg.AgentFallbackToDefault = false
+	if _, err := svc.InvokeAgent(ctx, domain.InvokeRequest{SessionID: "s1", AgentID: "missing", InputMessage: input}); err == nil {
+		t.Fatal("expected not found error without fallback")
+	}
+}
+
+func TestBootstrapAgentsKeepsHeartbeat(t *testing.T) {
+	ctx := context.Background()
+	db := helpers.NewTestSQLiteStore(t)
+
+	heartbeat := time.Now().Add(-time.Minute).Truncate(time.Second)
+	if err := db.RegisterAgent(ctx, &domain.Agent{AgentID: "main", Name: "Old", Endpoint: "http://old:8000", Status: "healthy", LastHeartbeat: &heartbeat, CreatedAt: heartbeat}); err != nil {
+		t.Fatalf("RegisterAgent: %v", err)
+	}
+
+	cfg := &config.Config{AgentTimeout: time.Second, BootstrapAgents: []config.BootstrapAgent{
+		{AgentID: "main", Name: "Main", Endpoint: "http://main:8000"},
+		{AgentID: "vllm", Endpoint: "http://vllm:8000/v1", Protocol: "openai_chat"},
+	}}
+	svc := New(db, agentclient.NewClient(), ingress.NewClient(""), llm.NewClient("", "", time.Second), cfg, nil)
+	if err := svc.BootstrapAgents(ctx); err != nil {
+		t.Fatalf("BootstrapAgents: %v", err)
+	}
+
+	primary, err := db.GetAgent(ctx, "main")
+	if err != nil || primary == nil {
+		t.Fatalf("GetAgent main: %+v, %v", primary, err)
+	}
+	if primary.Name != "Main" || primary.Endpoint != "http://main:8000" {
+		t.Fatalf("expected definition to be updated, got %+v", primary)
+	}
+	if primary.LastHeartbeat == nil || !primary.LastHeartbeat.Equal(heartbeat) || !primary.CreatedAt.Equal(heartbeat) {
+		t.Fatalf("expected heartbeat and created_at to be kept, got %+v", primary)
+	}
+
+	vllm, err := db.GetAgent(ctx, "vllm")
+	if err != nil || vllm == nil {
+		t.Fatalf("GetAgent vllm: %+v, %v", vllm, err)
+	}
+	if vllm.Name != "vllm" || vllm.Protocol != domain.AgentProtocolOpenAIChat {
+		t.Fatalf("unexpected bootstrap agent: %+v", vllm)
+	}
+}
+
+func TestAgentFailuresMarkUnhealthy(t *testing.T) {
+	ctx := context.Background()
+	db := helpers.NewTestSQLiteStore(t)
+
+	var failing atomic.Bool
+	failing.Store(true)
+	agent := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if failing.Load() {
+			http.Error(w, "overloaded", http.StatusServiceUnavailable)
+			return
+		}
+		w.Header().Set("Content-Type", "text/event-stream")
+		fmt.Fprint(w, "event: done\ndata: {\"final_message\":\"ok\"}\n\n")
+	}))
+	defer agent.Close()
+
+	cfg := &config.Config{AgentTimeout: time.Second, AgentUnhealthyAfterFailures: 2}
+	svc := New(db, agentclient.NewClient(), ingress.NewClient(""), llm.NewClient("", "", time.Second), cfg, nil)
+	if _, err := svc.RegisterAgent(ctx, "a1", "Agent", agent.URL, nil, nil, "", "", "", 0, nil, nil); err != nil {
+		t.Fatalf("RegisterAgent: %v", err)
+	}
+
+	invoke := func(want domain.RunStatus) {
+		t.Helper()
+		resp, err := svc.InvokeAgent(ctx, domain.InvokeRequest{
+			SessionID:    "s1",
+			AgentID:      "a1",
+			InputMessage: domain.InputMessage{Role: "user", Content: "hi"},
+		})
+		if err != nil {
+			t.Fatalf("InvokeAgent: %v", err)
+		}
+		deadline := time.Now().Add(2 * time.Second)
+		for {
+			run, err := db.GetRun(ctx, resp.RunID)
+			if err != nil {
+				t.Fatalf("GetRun: %v", err)
+			}
+			if run.Status == want {
+				return
+			}
+			if time.Now().After(deadline) {
+				t.Fatalf("run %s stuck in %s, want %s", resp.RunID, run.Status, want)
+			}
+			time.Sleep(10 * time.Millisecond)
+		}
+	}
+	getAgent := func() *domain.Agent {
+		t.Helper()
+		a, err := db.GetAgent(ctx, "a1")
+		if err != nil || a == nil {
+			t.Fatalf("GetAgent: %v", err)
+		}
+		return a
+	}
+
+	invoke(domain.RunStatusFailed)
+	if a := getAgent(); a.Status != "healthy" || a.ConsecutiveFailures != 1 || !strings.Contains(a.LastError, "503") {
+		t.Fatalf("unexpected agent after one failure: %+v", a)
+	}
+	invoke(domain.RunStatusFailed)
+	if a := getAgent(); a.Status != "unhealthy" || a.ConsecutiveFailures != 2 {
+		t.Fatalf("expected agent to be unhealthy after two failures: %+v", a)
+	}
+
+	failing.Store(false)
+	invoke(domain.RunStatusDone)
+	if a := getAgent(); a.Status != "healthy" || a.ConsecutiveFailures != 0 || a.LastError != "" {
+		t.Fatalf("expected success to reset the agent: %+v", a)
+	}
+}
@@ -0,0 +1,117 @@
+package service
+
+import (
+	"context"
+	"encoding/json"
+	"strings"
+
+	"github.com/xiaot623/gogo/orchestrator/internal/domain"
+)
+
+// streamedToolCall is a tool call whose args an agent is still streaming.
+type streamedToolCall struct {
+	name string
+	args strings.Builder
+}
+
+// toolCallAssembler collects the args deltas of the tool calls an agent
+// streams, keyed by the agent's tool_call_id, so deltas of several calls and
+// text deltas may interleave.
+type toolCallAssembler struct {
+	calls map[string]*streamedToolCall
+}
+
+func newToolCallAssembler() *toolCallAssembler {
+	return &toolCallAssembler{calls: make(map[string]*streamedToolCall)}
+}
+
+// add appends a delta to its call and returns the call's tool name so far.
+func (a *toolCallAssembler) add(delta *domain.ToolCallDeltaEventData) string {
+	call := a.calls[delta.ToolCallID]
+	if call == nil {
+		call = &streamedToolCall{}
+		a.calls[delta.ToolCallID] = call
+	}
+	if delta.Name != "" {
+		call.name = delta.Name
+	}
+	call.args.WriteString(delta.ArgsDelta)
+	return call.name
+}
+
+// finish removes a call and returns its tool name and args: those of the
+// terminal event when set, else the ones assembled from its deltas. Args
+// default to {}.
+func (a *toolCallAssembler) finish(end *domain.ToolCallEventData) (string, json.RawMessage) {
+	name, args := end.Name, end.Args
+	if call := a.calls[end.ToolCallID]; call != nil {
+		delete(a.calls, end.ToolCallID)
+		if name == "" {
+			name = call.name
+		}
+		if len(args) == 0 {
+			args = json.RawMessage(call.args.String())
+		}
+	}
+	if len(strings.TrimSpace(string(args))) == 0 {
+		args = json.RawMessage(`{}`)
+	}
+	return name, args
+}
+
+// pending returns the IDs of calls that got deltas but no terminal event.
+func (a *toolCallAssembler) pending() []string {
+	ids := make([]string, 0, len(a.calls))
+	for id := range a.calls {
+		ids = append(ids, id)
+	}
+	return ids
+}
+
+// recordToolCallDelta records an agent's tool call args delta and pushes it
+// to the session as tool_call_delta, so clients can show the call forming.
+func (s *Service) recordToolCallDelta(ctx context.Context, runID, sessionID string, delta *domain.ToolCallDeltaEventData, name string) {
+	eventID, err := s.recordEventID(ctx, runID, domain.EventTypeAgentToolCallDelta, domain.AgentToolCallDeltaPayload{
+		ToolCallID: delta.ToolCallID,
+		Name:       delta.Name,
+		ArgsDelta:  delta.ArgsDelta,
+	})
+	if err != nil {
+		s.logger.ErrorContext(ctx, "failed to record agent_tool_call_delta event", "run_id", runID, "error", err)
+	}
+
+	if s.ingressClient != nil {
+		s.ingressClient.PushEvent(sessionID, map[string]interface{}{
+			"type":         "tool_call_delta",
+			"ts":           s.clock.Now().UnixMilli(),
+			"run_id":       runID,
+			"event_id":     eventID,
+			"tool_call_id": delta.ToolCallID,
+			"name":         name,
+			"args_delta":   delta.ArgsDelta,
+		})
+	}
+}
+
+// dispatchStreamedToolCall invokes a tool call an agent finished streaming.
+// The agent's tool_call_id is the idempotency key, so the agent can fetch
+// the outcome by invoking the same tool with that key. Failures are logged;
+// the stream goes on.
+func (s *Service) dispatchStreamedToolCall(ctx context.Context, runID string, toolCallID, toolName string, args json.RawMessage) {
+	logger := s.logger.With("run_id", runID, "agent_tool_call_id", toolCallID, "tool_name", toolName)
+	if toolName == "" {
+		logger.WarnContext(ctx, "dropping streamed tool call without a tool name")
+		return
+	}
+	if !json.Valid(args) {
+		logger.WarnContext(ctx, "dropping streamed tool call with invalid JSON args")
+		return
+	}
+
+	resp, err := s.invokeTool(ctx, toolName, domain.ToolInvokeRequest{RunID: runID, Args: args, IdempotencyKey: toolCallID})
+	if err != nil {
+		logger.WarnContext(ctx, "streamed tool call failed", "error", err)
+		return
+	}
+	logger.DebugContext(ctx, "dispatched streamed tool call", "tool_call_id", resp.ToolCallID, "status", resp.Status)
+}
@@ -0,0 +1,106 @@
+package service
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/xiaot623/gogo/orchestrator/internal/adapter/agentclient"
+	"github.com/xiaot623/gogo/orchestrator/internal/adapter/ingress"
+	"github.com/xiaot623/gogo/orchestrator/internal/adapter/llm"
+	"github.com/xiaot623/gogo/orchestrator/internal/config"
+	"github.com/xiaot623/gogo/orchestrator/internal/domain"
+	"github.com/xiaot623/gogo/orchestrator/policy"
+	"github.com/xiaot623/gogo/orchestrator/tests/helpers"
+)
+
+func TestAgentStreamedToolCall(t *testing.T) {
+	ctx := context.Background()
+	db := helpers.NewTestSQLiteStore(t)
+
+	// Args of two calls stream interleaved with each other and with text.
+	agent := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/event-stream")
+		for _, e := range []struct{ event, data string }{
+			{"delta", `{"text":"Let me check. "}`},
+			{"tool_call_delta", `{"tool_call_id":"c1","name":"browser.screenshot","args_delta":"{\"url\":"}`},
+			{"tool_call_delta", `{"tool_call_id":"c2","name":"browser.screenshot","args_delta":"{\"url\":\"b\"}"}`},
+			{"delta", `{"text":"Still working. "}`},
+			{"tool_call_delta", `{"tool_call_id":"c1","args_delta":"\"a\"}"}`},
+			{"tool_call", `{"tool_call_id":"c1"}`},
+			{"tool_call", `{"tool_call_id":"c2","args":{"url":"override"}}`},
+			{"done", `{"final_message":"Let me check. Still working. "}`},
+		} {
+			fmt.Fprintf(w, "event: %s\ndata: %s\n\n", e.event, e.data)
+		}
+	}))
+	defer agent.Close()
+
+	policyEngine, err := policy.NewEngine(ctx, policy.DefaultPolicy)
+	if err != nil {
+		t.Fatalf("NewEngine failed: %v", err)
+	}
+	cfg := &config.Config{AgentTimeout: time.Second, ToolTimeout: time.Minute, InvokeWaitMax: time.Second}
+	svc := New(db, agentclient.NewClient(), ingress.NewClient(""), llm.NewClient("", "", time.Second), cfg, policyEngine)
+	if _, err := svc.RegisterAgent(ctx, "a1", "Agent", agent.URL, nil, nil, "", "", "", 0, nil, nil); err != nil {
+		t.Fatalf("RegisterAgent: %v", err)
+	}
+
+	result, err := svc.InvokeAgentAndWait(ctx, domain.InvokeRequest{
+		SessionID:    "s1",
+		AgentID:      "a1",
+		InputMessage: domain.InputMessage{Role: "user", Content: "screenshot a and b"},
+	}, 0)
+	if err != nil {
+		t.Fatalf("InvokeAgentAndWait: %v", err)
+	}
+	if result.FinalMessage != "Let me check. Still working. " {
+		t.Fatalf("unexpected final message %q", result.FinalMessage)
+	}
+
+	deltas, err := db.GetEvents(ctx, result.RunID, 0, 0, []string{string(domain.EventTypeAgentToolCallDelta)}, 0)
+	if err != nil || len(deltas) != 3 {
+		t.Fatalf("expected 3 agent_tool_call_delta events, got %d (%v)", len(deltas), err)
+	}
+
+	// Each call is dispatched once with its assembled (or overriding) args,
+	// keyed by the agent's tool_call_id.
+	for id, want := range map[string]string{"c1": `{"url":"a"}`, "c2": `{"url":"override"}`} {
+		tc, err := db.GetToolCallByIdempotencyKey(ctx, result.RunID, "browser.screenshot", id)
+		if err != nil || tc == nil {
+			t.Fatalf("tool call %s was not dispatched: %v", id, err)
+		}
+		var got, expected interface{}
+		_ = json.Unmarshal(tc.Args, &got)
+		_ = json.Unmarshal([]byte(want), &expected)
+		if fmt.Sprint(got) != fmt.Sprint(expected) {
+			t.Fatalf("tool call %s args = %s, want %s", id, tc.Args, want)
+		}
+	}
+}
+
+func TestToolCallAssembler(t *testing.T) {
+	a := newToolCallAssembler()
+	a.add(&domain.ToolCallDeltaEventData{ToolCallID: "c1", Name: "weather.query", ArgsDelta: `{"city":`})
+	if name := a.add(&domain.ToolCallDeltaEventData{ToolCallID: "c1", ArgsDelta: `"Paris"}`}); name != "weather.query" {
+		t.Fatalf("expected the name from the first delta, got %q", name)
+	}
+	a.add(&domain.ToolCallDeltaEventData{ToolCallID: "c2", Name: "weather.query", ArgsDelta: `{`})
+
+	name, args := a.finish(&domain.ToolCallEventData{ToolCallID: "c1"})
+	if name != "weather.query" || string(args) != `{"city":"Paris"}` {
+		t.Fatalf("unexpected assembled call %s %s", name, args)
+	}
+	if pending := a.pending(); len(pending) != 1 || pending[0] != "c2" {
+		t.Fatalf("expected c2 to be pending, got %v", pending)
+	}
+
+	// A call without deltas gets empty args.
+	if name, args := a.finish(&domain.ToolCallEventData{ToolCallID: "c3", Name: "weather.query"}); name != "weather.query" || string(args) != `{}` {
+		t.Fatalf("unexpected call without deltas %s %s", name, args)
+	}
+}
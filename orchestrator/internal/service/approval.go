@@ -7,9 +7,27 @@ import (
 	"time"
 
 	"github.com/xiaot623/gogo/orchestrator/internal/domain"
+	"github.com/xiaot623/gogo/orchestrator/internal/telemetry"
 )
 
+// UpdateApproval records a decision on a pending approval. A decision resent
+// with the same nonce succeeds without being applied again.
 func (s *Service) UpdateApproval(ctx context.Context, approvalID string, req domain.ApprovalDecisionRequest) error {
+	claimed, replay, err := s.claimNonce(ctx, domain.NonceKindApprovalDecision, req.Nonce, approvalID)
+	if err != nil {
+		return err
+	}
+	if replay != nil {
+		return nil
+	}
+	err = s.updateApproval(ctx, approvalID, req)
+	if claimed {
+		s.finishNonce(ctx, domain.NonceKindApprovalDecision, req.Nonce, map[string]bool{"ok": true}, err)
+	}
+	return err
+}
+
+func (s *Service) updateApproval(ctx context.Context, approvalID string, req domain.ApprovalDecisionRequest) error {
 	approval, err := s.store.GetApproval(ctx, approvalID)
 	if err != nil {
 		return fmt.Errorf("failed to get approval: %w", err)
@@ -39,15 +57,34 @@ func (s *Service) UpdateApproval(ctx context.Context, approvalID string, req dom
 		newStatus = domain.ApprovalStatusRejected
 	}
 
+	// Only approvals are remembered; a rejection prompts again next time.
+	var remembered *domain.RememberedApproval
+	if newStatus == domain.ApprovalStatusApproved && req.Remember != "" {
+		if remembered, err = s.newRememberedApproval(ctx, approval, tc, req.Remember); err != nil {
+			return err
+		}
+	}
+
 	if err := s.store.UpdateApprovalStatus(ctx, approvalID, newStatus, req.DecidedBy, req.Reason); err != nil {
 		return fmt.Errorf("failed to update approval status: %w", err)
 	}
+	s.countApproval(tc.ToolName, newStatus)
+	if remembered != nil {
+		if err := s.store.RememberApproval(ctx, remembered); err != nil {
+			s.logger.WarnContext(ctx, "failed to remember approval", "approval_id", approvalID, "tool_name", tc.ToolName, "error", err)
+			remembered = nil
+		}
+	}
 
 	// Record event
 	decisionPayload := domain.ApprovalDecisionPayload{
 		ApprovalID: approvalID,
 		Decision:   newStatus,
 		Reason:     req.Reason,
+		DecidedBy:  req.DecidedBy,
+	}
+	if remembered != nil {
+		decisionPayload.Remember = remembered.Scope
 	}
 	s.recordEvent(ctx, approval.RunID, domain.EventTypeApprovalDecision, decisionPayload)
 
@@ -59,6 +96,7 @@ func (s *Service) UpdateApproval(ctx context.Context, approvalID string, req dom
 			return fmt.Errorf("failed to update tool call: %w", err)
 		}
 		if updated {
+			s.countToolResult(tc.ToolName, domain.ToolCallStatusRejected)
 			payload := domain.ToolResultPayload{
 				ToolCallID: approval.ToolCallID,
 				Status:     domain.ToolCallStatusRejected,
@@ -70,7 +108,7 @@ func (s *Service) UpdateApproval(ctx context.Context, approvalID string, req dom
 	}
 
 	// Approved: dispatch/execute tool call.
-	if tc.Kind == domain.ToolKindServer {
+	if tc.Kind.RunsOnServer() {
 		_, _ = s.store.UpdateToolCallStatus(ctx, tc.ToolCallID, domain.ToolCallStatusRunning)
 
 		tool, err := s.store.GetTool(ctx, tc.ToolName)
@@ -80,38 +118,52 @@ func (s *Service) UpdateApproval(ctx context.Context, approvalID string, req dom
 		if tool == nil {
 			return fmt.Errorf("tool not found")
 		}
-		go s.executeServerToolAsync(tc, tool)
+		go s.executeServerToolAsync(telemetry.Detach(ctx), tc, tool)
 		return nil
 	}
 
 	_, _ = s.store.UpdateToolCallStatus(ctx, tc.ToolCallID, domain.ToolCallStatusDispatched)
 
-	nowMs := time.Now().UnixMilli()
-	deadlineTs := time.Now().Add(time.Duration(tc.TimeoutMs) * time.Millisecond).UnixMilli()
+	nowMs := s.clock.Now().UnixMilli()
+	deadlineTs := s.clock.Now().Add(time.Duration(tc.TimeoutMs) * time.Millisecond).UnixMilli()
 	requestPayload := domain.ToolRequestPayload{
 		ToolCallID: tc.ToolCallID,
 		ToolName:   tc.ToolName,
 		Args:       tc.Args,
 		DeadlineTs: deadlineTs,
 	}
-	s.recordEvent(ctx, tc.RunID, domain.EventTypeToolRequest, requestPayload)
+	eventID, _ := s.recordEventID(ctx, tc.RunID, domain.EventTypeToolRequest, requestPayload)
 
+	// The client that triggered the call may have moved on, so the approved
+	// request is pushed to the run's session rather than any single connection.
 	if s.ingressClient != nil {
-		var argsObj interface{}
-		_ = json.Unmarshal(tc.Args, &argsObj)
-		run, _ := s.store.GetRun(ctx, tc.RunID)
-		if run != nil {
-			s.ingressClient.PushEvent(run.SessionID, map[string]interface{}{
-				"type":         "tool_request",
-				"ts":           nowMs,
-				"run_id":       tc.RunID,
-				"tool_call_id": tc.ToolCallID,
-				"tool_name":    tc.ToolName,
-				"args":         argsObj,
-				"deadline_ts":  deadlineTs,
-			})
+		run, err := s.store.GetRun(ctx, tc.RunID)
+		if err != nil || run == nil {
+			s.logger.WarnContext(ctx, "cannot push approved tool_request: run not found", "tool_call_id", tc.ToolCallID, "run_id", tc.RunID, "error", err)
+			return nil
+		}
+		if err := s.pushToolRequest(run.SessionID, tc.RunID, eventID, tc.ToolCallID, tc.ToolName, tc.Args, nowMs, deadlineTs); err != nil {
+			s.logger.ErrorContext(ctx, "failed to push approved tool_request", "tool_call_id", tc.ToolCallID, "run_id", tc.RunID, "error", err)
 		}
 	}
 
 	return nil
 }
+
+// ListPendingApprovals returns the approvals awaiting a decision, oldest
+// first, with each one's age as of now.
+func (s *Service) ListPendingApprovals(ctx context.Context, filter domain.PendingApprovalFilter) ([]domain.PendingApproval, error) {
+	approvals, err := s.store.ListPendingApprovals(ctx, filter)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list pending approvals: %w", err)
+	}
+
+	now := s.clock.Now()
+	for i := range approvals {
+		approvals[i].AgeMs = now.Sub(approvals[i].CreatedAt).Milliseconds()
+	}
+	if approvals == nil {
+		approvals = []domain.PendingApproval{}
+	}
+	return approvals, nil
+}
@@ -0,0 +1,128 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"github.com/xiaot623/gogo/orchestrator/internal/domain"
+)
+
+// ErrInvalidRememberScope is returned when an approval decision asks to be
+// remembered for an unknown scope.
+var ErrInvalidRememberScope = errors.New("remember must be session or user")
+
+// ErrRememberNeedsUser is returned when an approval is remembered for the
+// user but the session has no user_id.
+var ErrRememberNeedsUser = errors.New("remember=user requires a session with a user_id")
+
+// ErrRememberFilterRequired is returned when clearing remembered approvals
+// without a user_id or session_id.
+var ErrRememberFilterRequired = errors.New("user_id or session_id is required")
+
+// ValidRememberScope reports whether scope may be sent with a decision.
+func ValidRememberScope(scope domain.RememberScope) bool {
+	switch scope {
+	case "", domain.RememberScopeSession, domain.RememberScopeUser:
+		return true
+	}
+	return false
+}
+
+// newRememberedApproval builds the memory of an approval decided with
+// remember. Returns nil when approvals are not remembered
+// (APPROVAL_MEMORY_TTL_MS=0).
+func (s *Service) newRememberedApproval(ctx context.Context, approval *domain.Approval, tc *domain.ToolCall, scope domain.RememberScope) (*domain.RememberedApproval, error) {
+	if !ValidRememberScope(scope) {
+		return nil, ErrInvalidRememberScope
+	}
+	run, err := s.store.GetRun(ctx, approval.RunID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get run: %w", err)
+	}
+	if run == nil {
+		return nil, fmt.Errorf("run not found")
+	}
+	session, err := s.store.GetSession(ctx, run.SessionID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get session: %w", err)
+	}
+	if session == nil {
+		return nil, fmt.Errorf("session not found")
+	}
+	if scope == domain.RememberScopeUser && session.UserID == "" {
+		return nil, ErrRememberNeedsUser
+	}
+	if s.config.ApprovalMemoryTTL <= 0 {
+		return nil, nil
+	}
+
+	now := s.clock.Now()
+	ra := &domain.RememberedApproval{
+		UserID:     session.UserID,
+		ToolName:   tc.ToolName,
+		Scope:      scope,
+		ApprovalID: approval.ApprovalID,
+		CreatedAt:  now,
+		ExpiresAt:  now.Add(s.config.ApprovalMemoryTTL),
+	}
+	if scope == domain.RememberScopeSession {
+		ra.SessionID = session.SessionID
+	}
+	return ra, nil
+}
+
+// findRememberedApproval returns the user's unexpired approval of toolName for
+// this session, or nil. Lookup failures only cost the user a prompt, so they
+// are logged rather than returned.
+func (s *Service) findRememberedApproval(ctx context.Context, session *domain.Session, toolName string) *domain.RememberedApproval {
+	if s.config.ApprovalMemoryTTL <= 0 {
+		return nil
+	}
+	ra, err := s.store.FindRememberedApproval(ctx, session.UserID, session.SessionID, toolName, s.clock.Now())
+	if err != nil {
+		s.logger.WarnContext(ctx, "failed to look up remembered approval", "session_id", session.SessionID, "tool_name", toolName, "error", err)
+		return nil
+	}
+	return ra
+}
+
+// applyRememberedApproval records an approval of toolCall granted by ra, so
+// the tool call's history shows why it ran without a prompt.
+func (s *Service) applyRememberedApproval(ctx context.Context, toolCall *domain.ToolCall, ra *domain.RememberedApproval) {
+	approvalID := s.ids.New("ap")
+	reason := fmt.Sprintf("remembered %s approval %s", ra.Scope, ra.ApprovalID)
+	if err := s.store.CreateApproval(ctx, &domain.Approval{
+		ApprovalID: approvalID,
+		RunID:      toolCall.RunID,
+		ToolCallID: toolCall.ToolCallID,
+		Status:     domain.ApprovalStatusApproved,
+		CreatedAt:  s.clock.Now(),
+	}); err != nil {
+		s.logger.WarnContext(ctx, "failed to record remembered approval", "tool_call_id", toolCall.ToolCallID, "error", err)
+		return
+	}
+	_ = s.store.UpdateApprovalStatus(ctx, approvalID, domain.ApprovalStatusApproved, domain.ApprovalDecidedByRemembered, reason)
+	s.countApproval(toolCall.ToolName, domain.ApprovalStatusApproved)
+	_, _ = s.store.UpdateToolCallApproval(ctx, toolCall.ToolCallID, approvalID, toolCall.Status)
+
+	s.recordEvent(ctx, toolCall.RunID, domain.EventTypeApprovalDecision, domain.ApprovalDecisionPayload{
+		ApprovalID: approvalID,
+		Decision:   domain.ApprovalStatusApproved,
+		Reason:     reason,
+		DecidedBy:  domain.ApprovalDecidedByRemembered,
+	})
+}
+
+// ClearRememberedApprovals forgets the remembered approvals matching filter,
+// so those tools prompt again. It returns how many were cleared.
+func (s *Service) ClearRememberedApprovals(ctx context.Context, filter domain.RememberedApprovalFilter) (int64, error) {
+	if filter.UserID == "" && filter.SessionID == "" {
+		return 0, ErrRememberFilterRequired
+	}
+	n, err := s.store.ClearRememberedApprovals(ctx, filter)
+	if err != nil {
+		return 0, fmt.Errorf("failed to clear remembered approvals: %w", err)
+	}
+	return n, nil
+}
@@ -0,0 +1,140 @@
+package service
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"regexp"
+	"sort"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+
+	"github.com/xiaot623/gogo/orchestrator/internal/domain"
+)
+
+// Limits on the text an approval request shows an approver.
+const (
+	approvalSummaryValueChars = 100
+	approvalArgsPreviewBytes  = 512
+)
+
+// approvalSummaryField matches a {field} placeholder of an approval summary
+// template; dotted paths reach nested objects, e.g. {recipient.name}.
+var approvalSummaryField = regexp.MustCompile(`\{([a-zA-Z0-9_]+(?:\.[a-zA-Z0-9_]+)*)\}`)
+
+// approvalSummary renders the args_summary of an approval request. Tools
+// whose metadata sets "approval_summary" get that template with each {field}
+// replaced by the arg's value ("?" when absent); others get a sorted
+// "key: value" list of the top-level args.
+func approvalSummary(tool *domain.Tool, args json.RawMessage) string {
+	var argMap map[string]interface{}
+	if err := json.Unmarshal(args, &argMap); err != nil || argMap == nil {
+		argMap = map[string]interface{}{}
+	}
+
+	if template := approvalSummaryTemplate(tool); template != "" {
+		return approvalSummaryField.ReplaceAllStringFunc(template, func(placeholder string) string {
+			path := strings.Split(placeholder[1:len(placeholder)-1], ".")
+			value, ok := lookupArg(argMap, path)
+			if !ok {
+				return "?"
+			}
+			return summaryValue(value)
+		})
+	}
+
+	keys := make([]string, 0, len(argMap))
+	for k := range argMap {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	parts := make([]string, 0, len(keys))
+	for _, k := range keys {
+		parts = append(parts, sanitizeSummaryText(k)+": "+summaryValue(argMap[k]))
+	}
+	if len(parts) == 0 {
+		return tool.Name + " (no arguments)"
+	}
+	return tool.Name + ": " + strings.Join(parts, ", ")
+}
+
+// approvalSummaryTemplate returns the tool's "approval_summary" metadata, if
+// any.
+func approvalSummaryTemplate(tool *domain.Tool) string {
+	if tool == nil || len(tool.Metadata) == 0 {
+		return ""
+	}
+	var meta struct {
+		ApprovalSummary string `json:"approval_summary"`
+	}
+	if err := json.Unmarshal(tool.Metadata, &meta); err != nil {
+		slog.Warn("ignoring invalid tool metadata", "tool_name", tool.Name, "error", err)
+		return ""
+	}
+	return meta.ApprovalSummary
+}
+
+func lookupArg(args map[string]interface{}, path []string) (interface{}, bool) {
+	var value interface{} = args
+	for _, key := range path {
+		obj, ok := value.(map[string]interface{})
+		if !ok {
+			return nil, false
+		}
+		if value, ok = obj[key]; !ok {
+			return nil, false
+		}
+	}
+	return value, true
+}
+
+// summaryValue renders one arg value for a summary: strings as is, anything
+// else as compact JSON, sanitized and capped at approvalSummaryValueChars.
+func summaryValue(value interface{}) string {
+	text, ok := value.(string)
+	if !ok {
+		data, err := json.Marshal(value)
+		if err != nil {
+			text = fmt.Sprint(value)
+		} else {
+			text = string(data)
+		}
+	}
+	text = sanitizeSummaryText(text)
+	if utf8.RuneCountInString(text) > approvalSummaryValueChars {
+		text = string([]rune(text)[:approvalSummaryValueChars]) + "…"
+	}
+	return text
+}
+
+// sanitizeSummaryText replaces control characters (newlines, terminal escape
+// sequences) with spaces so arg values cannot reshape what the approver sees.
+func sanitizeSummaryText(text string) string {
+	return strings.Map(func(r rune) rune {
+		if unicode.IsControl(r) {
+			return ' '
+		}
+		return r
+	}, text)
+}
+
+// approvalArgsPreview returns the args as sanitized JSON text of at most
+// approvalArgsPreviewBytes, with "…" appended when cut short.
+func approvalArgsPreview(args json.RawMessage) string {
+	var compact bytes.Buffer
+	if err := json.Compact(&compact, args); err != nil {
+		compact.Reset()
+		compact.Write(args)
+	}
+	text := sanitizeSummaryText(compact.String())
+	if len(text) <= approvalArgsPreviewBytes {
+		return text
+	}
+	n := approvalArgsPreviewBytes
+	for n > 0 && !utf8.RuneStart(text[n]) {
+		n--
+	}
+	return text[:n] + "…"
+}
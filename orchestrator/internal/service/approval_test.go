@@ -0,0 +1,249 @@
+package service
+
+import (
+	"context"
+	"encoding/json"
+	"net"
+	"net/rpc"
+	"net/rpc/jsonrpc"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/xiaot623/gogo/orchestrator/internal/adapter/agentclient"
+	"github.com/xiaot623/gogo/orchestrator/internal/adapter/ingress"
+	"github.com/xiaot623/gogo/orchestrator/internal/adapter/llm"
+	"github.com/xiaot623/gogo/orchestrator/internal/config"
+	"github.com/xiaot623/gogo/orchestrator/internal/domain"
+	"github.com/xiaot623/gogo/orchestrator/policy"
+	"github.com/xiaot623/gogo/orchestrator/tests/helpers"
+)
+
+// fakeIngress records events pushed over the Ingress.PushEvent RPC and
+// session evictions over Ingress.DisconnectSession. When release is set,
+// each push signals received and then waits for release.
+type fakeIngress struct {
+	mu          sync.Mutex
+	events      []ingress.SendRequest
+	disconnects []ingress.DisconnectRequest
+
+	received chan struct{}
+	release  chan struct{}
+}
+
+func (f *fakeIngress) PushEvent(req *ingress.SendRequest, resp *ingress.SendResponse) error {
+	if f.release != nil {
+		f.received <- struct{}{}
+		<-f.release
+	}
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.events = append(f.events, *req)
+	resp.OK = true
+	resp.Delivered = true
+	return nil
+}
+
+func (f *fakeIngress) DisconnectSession(req *ingress.DisconnectRequest, resp *ingress.DisconnectResponse) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.disconnects = append(f.disconnects, *req)
+	resp.OK = true
+	resp.Disconnected = 2
+	return nil
+}
+
+func (f *fakeIngress) eventTypes() []string {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	var types []string
+	for _, ev := range f.events {
+		types = append(types, ev.Event["type"].(string))
+	}
+	return types
+}
+
+func startFakeIngress(t *testing.T) (*fakeIngress, string) {
+	t.Helper()
+	fake := &fakeIngress{}
+	server := rpc.NewServer()
+	if err := server.RegisterName("Ingress", fake); err != nil {
+		t.Fatalf("RegisterName: %v", err)
+	}
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("Listen: %v", err)
+	}
+	t.Cleanup(func() { ln.Close() })
+	go func() {
+		for {
+			conn, err := ln.Accept()
+			if err != nil {
+				return
+			}
+			go server.ServeCodec(jsonrpc.NewServerCodec(conn))
+		}
+	}()
+	return fake, ln.Addr().String()
+}
+
+const clientApprovalPolicy = `
+package tool_policy
+
+default decision = "allow"
+
+decision = "require_approval" {
+	input.tool_name == "browser.screenshot"
+}
+`
+
+func TestApprovedClientToolPushesToolRequest(t *testing.T) {
+	ctx := context.Background()
+	db := helpers.NewTestSQLiteStore(t)
+	fake, addr := startFakeIngress(t)
+
+	policyEngine, err := policy.NewEngine(ctx, clientApprovalPolicy)
+	if err != nil {
+		t.Fatalf("NewEngine failed: %v", err)
+	}
+	cfg := &config.Config{ToolTimeout: time.Minute}
+	svc := New(db, agentclient.NewClient(), ingress.NewClient(addr), llm.NewClient("", "", time.Second), cfg, policyEngine)
+
+	if err := db.CreateSession(ctx, &domain.Session{SessionID: "s1", UserID: "u1", CreatedAt: time.Now()}); err != nil {
+		t.Fatalf("CreateSession: %v", err)
+	}
+	if err := db.CreateRun(ctx, &domain.Run{RunID: "r1", SessionID: "s1", RootAgentID: "a1", Status: domain.RunStatusRunning, StartedAt: time.Now()}); err != nil {
+		t.Fatalf("CreateRun: %v", err)
+	}
+
+	resp, err := svc.InvokeTool(ctx, "browser.screenshot", domain.ToolInvokeRequest{RunID: "r1", Args: json.RawMessage(`{"url":"https://example.com"}`)})
+	if err != nil {
+		t.Fatalf("InvokeTool: %v", err)
+	}
+	if resp.Reason != "waiting_approval" {
+		t.Fatalf("expected waiting_approval, got %+v", resp)
+	}
+	tc, err := db.GetToolCall(ctx, resp.ToolCallID)
+	if err != nil || tc == nil {
+		t.Fatalf("GetToolCall: %v", err)
+	}
+
+	if err := svc.UpdateApproval(ctx, tc.ApprovalID, domain.ApprovalDecisionRequest{Decision: "approve"}); err != nil {
+		t.Fatalf("UpdateApproval: %v", err)
+	}
+
+	types := fake.eventTypes()
+	if len(types) != 2 || types[0] != "approval_required" || types[1] != "tool_request" {
+		t.Fatalf("unexpected pushed events: %v", types)
+	}
+	fake.mu.Lock()
+	required, pushed := fake.events[0], fake.events[1]
+	fake.mu.Unlock()
+	if required.Event["args_summary"] != "browser.screenshot: url: https://example.com" || required.Event["args_preview"] != `{"url":"https://example.com"}` {
+		t.Fatalf("unexpected approval_required push: %+v", required)
+	}
+	if pushed.SessionID != "s1" || pushed.Event["tool_call_id"] != resp.ToolCallID {
+		t.Fatalf("unexpected tool_request push: %+v", pushed)
+	}
+
+	tc, _ = db.GetToolCall(ctx, resp.ToolCallID)
+	if tc.Status != domain.ToolCallStatusDispatched {
+		t.Fatalf("expected DISPATCHED, got %s", tc.Status)
+	}
+}
+
+func TestApprovalSummary(t *testing.T) {
+	transfer := &domain.Tool{
+		Name:     "payments.transfer",
+		Metadata: json.RawMessage(`{"approval_summary":"Transfer {amount} {currency} to {recipient.name}"}`),
+	}
+	plain := &domain.Tool{Name: "dangerous.command"}
+
+	cases := []struct {
+		name string
+		tool *domain.Tool
+		args string
+		want string
+	}{
+		{"template", transfer, `{"amount":500,"currency":"USD","recipient":{"name":"Acme"}}`, "Transfer 500 USD to Acme"},
+		{"template missing field", transfer, `{"amount":500}`, "Transfer 500 ? to ?"},
+		{"template sanitizes values", transfer, `{"amount":1,"currency":"USD","recipient":{"name":"Acme\nApproved: yes"}}`, "Transfer 1 USD to Acme Approved: yes"},
+		{"generic", plain, `{"cmd":"rm -rf /","force":true}`, "dangerous.command: cmd: rm -rf /, force: true"},
+		{"generic nested", plain, `{"opts":{"a":1}}`, `dangerous.command: opts: {"a":1}`},
+		{"no args", plain, `{}`, "dangerous.command (no arguments)"},
+	}
+	for _, tc := range cases {
+		if got := approvalSummary(tc.tool, json.RawMessage(tc.args)); got != tc.want {
+			t.Errorf("%s: got %q, want %q", tc.name, got, tc.want)
+		}
+	}
+
+	long := `{"data":"` + strings.Repeat("x", 1000) + `"}`
+	if preview := approvalArgsPreview(json.RawMessage(long)); len(preview) != approvalArgsPreviewBytes+len("…") {
+		t.Errorf("expected preview cut to %d bytes, got %d", approvalArgsPreviewBytes, len(preview))
+	}
+}
+
+func TestRememberedApprovalAutoApproves(t *testing.T) {
+	ctx := context.Background()
+	db := helpers.NewTestSQLiteStore(t)
+
+	policyEngine, err := policy.NewEngine(ctx, clientApprovalPolicy)
+	if err != nil {
+		t.Fatalf("NewEngine failed: %v", err)
+	}
+	cfg := &config.Config{ToolTimeout: time.Minute, ApprovalMemoryTTL: time.Hour}
+	svc := New(db, agentclient.NewClient(), nil, llm.NewClient("", "", time.Second), cfg, policyEngine)
+
+	if err := db.CreateSession(ctx, &domain.Session{SessionID: "s1", UserID: "u1", CreatedAt: time.Now()}); err != nil {
+		t.Fatalf("CreateSession: %v", err)
+	}
+	if err := db.CreateRun(ctx, &domain.Run{RunID: "r1", SessionID: "s1", RootAgentID: "a1", Status: domain.RunStatusRunning, StartedAt: time.Now()}); err != nil {
+		t.Fatalf("CreateRun: %v", err)
+	}
+	invoke := func() *domain.ToolInvokeResponse {
+		t.Helper()
+		resp, err := svc.InvokeTool(ctx, "browser.screenshot", domain.ToolInvokeRequest{RunID: "r1", Args: json.RawMessage(`{"url":"https://example.com"}`)})
+		if err != nil {
+			t.Fatalf("InvokeTool: %v", err)
+		}
+		return resp
+	}
+
+	first := invoke()
+	if first.Reason != "waiting_approval" {
+		t.Fatalf("expected waiting_approval, got %+v", first)
+	}
+	tc, _ := db.GetToolCall(ctx, first.ToolCallID)
+	if err := svc.UpdateApproval(ctx, tc.ApprovalID, domain.ApprovalDecisionRequest{Decision: "approve", Remember: "everywhere"}); err != ErrInvalidRememberScope {
+		t.Fatalf("expected ErrInvalidRememberScope, got %v", err)
+	}
+	if err := svc.UpdateApproval(ctx, tc.ApprovalID, domain.ApprovalDecisionRequest{Decision: "approve", Remember: domain.RememberScopeSession}); err != nil {
+		t.Fatalf("UpdateApproval: %v", err)
+	}
+
+	second := invoke()
+	if second.Reason != "waiting_client" {
+		t.Fatalf("expected the remembered approval to dispatch, got %+v", second)
+	}
+	tc, _ = db.GetToolCall(ctx, second.ToolCallID)
+	if tc.Status != domain.ToolCallStatusDispatched || tc.ApprovalID == "" {
+		t.Fatalf("unexpected tool call: %+v", tc)
+	}
+	approval, _ := db.GetApproval(ctx, tc.ApprovalID)
+	if approval.Status != domain.ApprovalStatusApproved || approval.DecidedBy != domain.ApprovalDecidedByRemembered {
+		t.Fatalf("unexpected approval: %+v", approval)
+	}
+
+	if _, err := svc.ClearRememberedApprovals(ctx, domain.RememberedApprovalFilter{}); err != ErrRememberFilterRequired {
+		t.Fatalf("expected ErrRememberFilterRequired, got %v", err)
+	}
+	cleared, err := svc.ClearRememberedApprovals(ctx, domain.RememberedApprovalFilter{SessionID: "s1"})
+	if err != nil || cleared != 1 {
+		t.Fatalf("ClearRememberedApprovals = %d, %v", cleared, err)
+	}
+	if third := invoke(); third.Reason != "waiting_approval" {
+		t.Fatalf("expected a prompt after clearing, got %+v", third)
+	}
+}
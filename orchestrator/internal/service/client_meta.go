@@ -0,0 +1,58 @@
+package service
+
+import (
+	"context"
+	"encoding/json"
+	"maps"
+	"strings"
+
+	"github.com/xiaot623/gogo/orchestrator/internal/domain"
+)
+
+// clientMetaFromContext extracts the client attributes ingress forwards from
+// the connection's hello as "client.<key>" entries of an invoke's context.
+func clientMetaFromContext(reqContext map[string]string) map[string]string {
+	var meta map[string]string
+	for k, v := range reqContext {
+		key, ok := strings.CutPrefix(k, domain.ClientContextPrefix)
+		if !ok || key == "" {
+			continue
+		}
+		if meta == nil {
+			meta = make(map[string]string)
+		}
+		meta[key] = v
+	}
+	return meta
+}
+
+// sessionClientMeta returns the client attributes stored in a session's
+// metadata under "client", or nil if there are none.
+func sessionClientMeta(session *domain.Session) map[string]string {
+	if session == nil || len(session.Metadata) == 0 {
+		return nil
+	}
+	var metadata struct {
+		Client map[string]string `json:"client"`
+	}
+	if err := json.Unmarshal(session.Metadata, &metadata); err != nil {
+		return nil
+	}
+	return metadata.Client
+}
+
+// rememberClientMeta stores the invoking client's attributes in the session's
+// metadata under "client", replacing earlier ones, so tool policy can key on
+// them. The session is only written when the attributes changed.
+func (s *Service) rememberClientMeta(ctx context.Context, session *domain.Session, meta map[string]string) {
+	if len(meta) == 0 || maps.Equal(meta, sessionClientMeta(session)) {
+		return
+	}
+	patch, err := json.Marshal(map[string]interface{}{"client": meta})
+	if err != nil {
+		return
+	}
+	if _, err := s.store.UpdateSessionMetadata(ctx, session.SessionID, patch, false); err != nil {
+		s.logger.WarnContext(ctx, "failed to store client metadata", "session_id", session.SessionID, "error", err)
+	}
+}
@@ -0,0 +1,81 @@
+package service
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/xiaot623/gogo/orchestrator/internal/adapter/agentclient"
+	"github.com/xiaot623/gogo/orchestrator/internal/adapter/ingress"
+	"github.com/xiaot623/gogo/orchestrator/internal/adapter/llm"
+	"github.com/xiaot623/gogo/orchestrator/internal/config"
+	"github.com/xiaot623/gogo/orchestrator/internal/domain"
+	"github.com/xiaot623/gogo/orchestrator/tests/helpers"
+)
+
+func TestInvokeRecordsClientMeta(t *testing.T) {
+	ctx := context.Background()
+	db := helpers.NewTestSQLiteStore(t)
+
+	agent := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/event-stream")
+		fmt.Fprint(w, "event: done\ndata: {\"final_message\":\"ok\"}\n\n")
+	}))
+	defer agent.Close()
+
+	cfg := &config.Config{AgentTimeout: time.Second, InvokeWaitMax: time.Second}
+	svc := New(db, agentclient.NewClient(), ingress.NewClient(""), llm.NewClient("", "", time.Second), cfg, nil)
+	if _, err := svc.RegisterAgent(ctx, "a1", "Agent", agent.URL, nil, nil, "", "", "", 0, nil, nil); err != nil {
+		t.Fatalf("RegisterAgent: %v", err)
+	}
+	if _, err := db.GetOrCreateSession(ctx, "s1", "u1"); err != nil {
+		t.Fatalf("GetOrCreateSession: %v", err)
+	}
+	if _, err := db.UpdateSessionMetadata(ctx, "s1", json.RawMessage(`{"title":"chat"}`), false); err != nil {
+		t.Fatalf("UpdateSessionMetadata: %v", err)
+	}
+
+	res, err := svc.InvokeAgentAndWait(ctx, domain.InvokeRequest{
+		SessionID:    "s1",
+		AgentID:      "a1",
+		InputMessage: domain.InputMessage{Role: "user", Content: "hi"},
+		Context:      map[string]string{"user_id": "u1", "client.platform": "ios", "client.app_version": "2.1.0"},
+	}, 0)
+	if err != nil {
+		t.Fatalf("InvokeAgentAndWait: %v", err)
+	}
+	want := map[string]string{"platform": "ios", "app_version": "2.1.0"}
+
+	events, err := db.GetEvents(ctx, res.RunID, 0, 0, []string{string(domain.EventTypeRunStarted)}, 1)
+	if err != nil || len(events) != 1 {
+		t.Fatalf("expected a run_started event, got %d (%v)", len(events), err)
+	}
+	var started domain.RunStartedPayload
+	if err := json.Unmarshal(events[0].Payload, &started); err != nil {
+		t.Fatalf("unmarshal run_started: %v", err)
+	}
+	if fmt.Sprint(started.Client) != fmt.Sprint(want) {
+		t.Fatalf("unexpected run_started client: %v", started.Client)
+	}
+
+	session, err := db.GetSession(ctx, "s1")
+	if err != nil {
+		t.Fatalf("GetSession: %v", err)
+	}
+	if got := sessionClientMeta(session); fmt.Sprint(got) != fmt.Sprint(want) {
+		t.Fatalf("unexpected session client metadata: %s", session.Metadata)
+	}
+	var metadata map[string]interface{}
+	if err := json.Unmarshal(session.Metadata, &metadata); err != nil || metadata["title"] != "chat" {
+		t.Fatalf("existing session metadata lost: %s", session.Metadata)
+	}
+
+	input := policyInput("search", session.UserID, sessionClientMeta(session), nil)
+	if fmt.Sprint(input["client"]) != fmt.Sprint(want) {
+		t.Fatalf("expected client in policy input, got %v", input)
+	}
+}
@@ -0,0 +1,133 @@
+package service
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strconv"
+
+	"github.com/xiaot623/gogo/orchestrator/internal/config"
+	"github.com/xiaot623/gogo/orchestrator/internal/domain"
+)
+
+// ephemeralContentFields are the event payload fields that carry conversation
+// or tool content. They are dropped from the stored copy of an ephemeral run's
+// events; subscribers and ingress still receive them live.
+var ephemeralContentFields = []string{
+	"content", "text", "final_message", "partial_message", "args", "args_summary", "args_preview", "result", "chunk",
+}
+
+// sessionEphemeral reports whether a session was created ephemeral.
+func sessionEphemeral(session *domain.Session) bool {
+	if session == nil || len(session.Metadata) == 0 {
+		return false
+	}
+	var metadata struct {
+		Ephemeral bool `json:"ephemeral"`
+	}
+	if err := json.Unmarshal(session.Metadata, &metadata); err != nil {
+		return false
+	}
+	return metadata.Ephemeral
+}
+
+// resolveEphemeral reports whether an invoke runs in ephemeral mode. A session
+// becomes ephemeral when the invoke that creates it (its first run) sets the
+// "ephemeral" context entry, or leaves it out while the ephemeral_default flag
+// is on; the flag is then kept in the session's metadata and later invokes
+// cannot turn it on or off.
+func (s *Service) resolveEphemeral(ctx context.Context, session *domain.Session, reqContext map[string]string) (bool, error) {
+	if sessionEphemeral(session) {
+		return true, nil
+	}
+	requested := s.flag(config.FlagEphemeralDefault)
+	raw, explicit := reqContext[domain.EphemeralContextKey]
+	if explicit {
+		var err error
+		if requested, err = strconv.ParseBool(raw); err != nil {
+			return false, fmt.Errorf("context %s must be true or false", domain.EphemeralContextKey)
+		}
+	}
+	if !requested {
+		return false, nil
+	}
+
+	runs, err := s.store.ListRuns(ctx, domain.RunFilter{SessionID: session.SessionID, Limit: 1})
+	if err != nil {
+		return false, fmt.Errorf("failed to list runs: %w", err)
+	}
+	if len(runs) > 0 {
+		if !explicit {
+			return false, nil
+		}
+		return false, fmt.Errorf("session %s already has runs; ephemeral can only be set when the session is created", session.SessionID)
+	}
+	updated, err := s.store.UpdateSessionMetadata(ctx, session.SessionID, json.RawMessage(`{"ephemeral":true}`), false)
+	if err != nil {
+		return false, fmt.Errorf("failed to mark session ephemeral: %w", err)
+	}
+	if updated != nil {
+		session.Metadata = updated.Metadata
+	}
+	return true, nil
+}
+
+// runEphemeral reports whether a run belongs to an ephemeral session. The
+// answer is cached while the run's agent stream is live and read from the
+// store otherwise.
+func (s *Service) runEphemeral(ctx context.Context, runID string) bool {
+	if v, ok := s.ephemeralRuns.Load(runID); ok {
+		return v.(bool)
+	}
+	run, err := s.store.GetRun(ctx, runID)
+	if err != nil || run == nil {
+		return false
+	}
+	session, err := s.store.GetSession(ctx, run.SessionID)
+	if err != nil {
+		s.logger.WarnContext(ctx, "failed to get session of run", "run_id", runID, "error", err)
+		return false
+	}
+	return sessionEphemeral(session)
+}
+
+// forgetRunEphemeral drops a run's cached ephemeral flag once its agent stream
+// is over.
+func (s *Service) forgetRunEphemeral(runID string) {
+	s.ephemeralRuns.Delete(runID)
+}
+
+// storedEvent returns the copy of event to persist: event itself, or for an
+// ephemeral run a copy whose payload lacks the content fields and is marked
+// "redacted".
+func (s *Service) storedEvent(ctx context.Context, event *domain.Event) *domain.Event {
+	if !s.runEphemeral(ctx, event.RunID) {
+		return event
+	}
+	stored := *event
+	stored.Payload = redactEventPayload(event.Payload)
+	return &stored
+}
+
+func redactEventPayload(payload json.RawMessage) json.RawMessage {
+	var fields map[string]json.RawMessage
+	if err := json.Unmarshal(payload, &fields); err != nil || fields == nil {
+		return payload
+	}
+	redacted := false
+	for _, name := range ephemeralContentFields {
+		if _, ok := fields[name]; ok {
+			delete(fields, name)
+			redacted = true
+		}
+	}
+	if !redacted {
+		return payload
+	}
+	fields["redacted"] = json.RawMessage("true")
+	data, err := json.Marshal(fields)
+	if err != nil {
+		return json.RawMessage(`{"redacted":true}`)
+	}
+	return data
+}
@@ -0,0 +1,79 @@
+package service
+
+import (
+	"context"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/xiaot623/gogo/orchestrator/internal/adapter/llm"
+	"github.com/xiaot623/gogo/orchestrator/internal/domain"
+)
+
+func TestEphemeralSessionKeepsNoTranscript(t *testing.T) {
+	ctx := context.Background()
+	svc, _, db := newLLMAgentService(t, []llm.ChatMessage{
+		{Role: "assistant", Content: "positive"},
+	})
+
+	result, err := svc.InvokeAgentAndWait(ctx, domain.InvokeRequest{
+		SessionID:    "s_eph",
+		AgentID:      "calc",
+		InputMessage: domain.InputMessage{Role: "user", Content: "classify: I love it"},
+		Context:      map[string]string{domain.EphemeralContextKey: "true"},
+	}, 5*time.Second)
+	if err != nil {
+		t.Fatalf("InvokeAgentAndWait: %v", err)
+	}
+	if result.Status != domain.RunStatusDone || result.FinalMessage != "positive" {
+		t.Fatalf("expected the live final message, got %+v", result)
+	}
+
+	messages, err := db.GetRecentMessages(ctx, "s_eph", -1)
+	if err != nil {
+		t.Fatalf("GetRecentMessages: %v", err)
+	}
+	if len(messages) != 0 {
+		t.Fatalf("expected no stored messages, got %+v", messages)
+	}
+	events, err := db.GetEvents(ctx, result.RunID, 0, 0, nil, 100)
+	if err != nil {
+		t.Fatalf("GetEvents: %v", err)
+	}
+	if len(events) == 0 {
+		t.Fatal("expected events to be stored")
+	}
+	for _, e := range events {
+		payload := string(e.Payload)
+		if strings.Contains(payload, "I love it") || strings.Contains(payload, "positive") {
+			t.Fatalf("stored %s event leaks content: %s", e.Type, payload)
+		}
+		if e.Type == domain.EventTypeRunDone && !strings.Contains(payload, `"redacted":true`) {
+			t.Fatalf("expected run_done to be marked redacted: %s", payload)
+		}
+	}
+
+	// The flag only applies when the session is created.
+	if _, err := svc.InvokeAgent(ctx, domain.InvokeRequest{
+		SessionID:    "s_eph",
+		AgentID:      "calc",
+		InputMessage: domain.InputMessage{Role: "user", Content: "again"},
+	}); err != nil {
+		t.Fatalf("InvokeAgent on ephemeral session: %v", err)
+	}
+	if _, err := svc.InvokeAgentAndWait(ctx, domain.InvokeRequest{
+		SessionID:    "s_plain",
+		AgentID:      "calc",
+		InputMessage: domain.InputMessage{Role: "user", Content: "hi"},
+	}, 5*time.Second); err != nil {
+		t.Fatalf("InvokeAgentAndWait: %v", err)
+	}
+	if _, err := svc.InvokeAgent(ctx, domain.InvokeRequest{
+		SessionID:    "s_plain",
+		AgentID:      "calc",
+		InputMessage: domain.InputMessage{Role: "user", Content: "hi"},
+		Context:      map[string]string{domain.EphemeralContextKey: "true"},
+	}); err == nil || !strings.Contains(err.Error(), "ephemeral") {
+		t.Fatalf("expected error making an existing session ephemeral, got %v", err)
+	}
+}
@@ -4,26 +4,38 @@ import (
 	"context"
 	"encoding/json"
 	"fmt"
-	"time"
 
-	"github.com/google/uuid"
 	"github.com/xiaot623/gogo/orchestrator/internal/domain"
 )
 
 // recordEvent records an event to the store.
 func (s *Service) recordEvent(ctx context.Context, runID string, eventType domain.EventType, payload interface{}) error {
+	_, err := s.recordEventID(ctx, runID, eventType, payload)
+	return err
+}
+
+// recordEventID records an event and returns its ID. Pushes of the event to
+// ingress carry the ID as event_id, so clients that combine a replayed backlog
+// with live events can drop the copies they already have. The ID is returned
+// even when the store write fails, since the push still goes out.
+func (s *Service) recordEventID(ctx context.Context, runID string, eventType domain.EventType, payload interface{}) (string, error) {
 	payloadBytes, err := json.Marshal(payload)
 	if err != nil {
-		return fmt.Errorf("failed to marshal payload: %w", err)
+		return "", fmt.Errorf("failed to marshal payload: %w", err)
 	}
 
 	event := &domain.Event{
-		EventID: "evt_" + uuid.New().String()[:8],
+		EventID: s.ids.New("evt"),
 		RunID:   runID,
-		Ts:      time.Now().UnixMilli(),
 		Type:    eventType,
 		Payload: payloadBytes,
 	}
-
-	return s.store.CreateEvent(ctx, event)
+	s.batchers.flush(runID)
+	stored, err := s.writeEvents(ctx, []*domain.Event{event})
+	if err != nil {
+		return event.EventID, err
+	}
+	s.events.publish(event)
+	s.notifySinks(stored...)
+	return event.EventID, nil
 }
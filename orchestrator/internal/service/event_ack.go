@@ -0,0 +1,116 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/xiaot623/gogo/orchestrator/internal/domain"
+)
+
+// ErrInvalidEventAck is returned for an ack that does not name a device, a
+// run of the session and a position in it.
+var ErrInvalidEventAck = errors.New("invalid event ack")
+
+// eventAckKey identifies the position a client device acknowledged in a run.
+type eventAckKey struct {
+	sessionID string
+	deviceID  string
+	runID     string
+}
+
+type eventAck struct {
+	seq      int64
+	lastSeen time.Time
+}
+
+// eventAcks holds the last event each client device acknowledged per run, so
+// a device can resume a run's events without tracking a cursor itself. It is
+// kept in memory: after a restart devices resume from their own after_ts or
+// cursor, as before.
+type eventAcks struct {
+	mu        sync.Mutex
+	acks      map[eventAckKey]eventAck
+	lastSweep time.Time
+}
+
+func newEventAcks() *eventAcks {
+	return &eventAcks{acks: make(map[eventAckKey]eventAck)}
+}
+
+// record moves key's position forward to seq; an older seq is ignored, as
+// acks may arrive out of order. Entries idle for longer than ttl are dropped
+// along the way.
+func (a *eventAcks) record(key eventAckKey, seq int64, now time.Time, ttl time.Duration) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	if ttl > 0 && now.Sub(a.lastSweep) > ttl {
+		for k, ack := range a.acks {
+			if now.Sub(ack.lastSeen) > ttl {
+				delete(a.acks, k)
+			}
+		}
+		a.lastSweep = now
+	}
+
+	ack := a.acks[key]
+	ack.seq = max(ack.seq, seq)
+	ack.lastSeen = now
+	a.acks[key] = ack
+}
+
+// position returns key's acknowledged seq, or 0 when it has none or it
+// expired.
+func (a *eventAcks) position(key eventAckKey, now time.Time, ttl time.Duration) int64 {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	ack, ok := a.acks[key]
+	if !ok || (ttl > 0 && now.Sub(ack.lastSeen) > ttl) {
+		return 0
+	}
+	return ack.seq
+}
+
+// AckEvents records that a client device of the session has handled the
+// run's events up to req.Seq, or up to the event req.EventID names.
+func (s *Service) AckEvents(ctx context.Context, req domain.EventAckRequest) error {
+	if req.SessionID == "" || req.DeviceID == "" || req.RunID == "" {
+		return fmt.Errorf("%w: session_id, device_id and run_id are required", ErrInvalidEventAck)
+	}
+	run, err := s.store.GetRun(ctx, req.RunID)
+	if err != nil {
+		return fmt.Errorf("failed to get run: %w", err)
+	}
+	if run == nil || run.SessionID != req.SessionID {
+		return fmt.Errorf("%w: run %s not found in session", ErrInvalidEventAck, req.RunID)
+	}
+
+	seq := req.Seq
+	if seq <= 0 && req.EventID != "" {
+		if seq, err = s.store.GetEventSeq(ctx, req.RunID, req.EventID); err != nil {
+			return fmt.Errorf("failed to look up event: %w", err)
+		}
+	}
+	if seq <= 0 {
+		return fmt.Errorf("%w: seq or a recorded event_id is required", ErrInvalidEventAck)
+	}
+
+	s.acks.record(eventAckKey{req.SessionID, req.DeviceID, req.RunID}, seq, s.clock.Now(), s.config.EventAckTTL)
+	return nil
+}
+
+// AckedEventSeq returns the seq of the last of the run's events the device
+// acknowledged, or 0 when it acknowledged none.
+func (s *Service) AckedEventSeq(ctx context.Context, runID, deviceID string) (int64, error) {
+	run, err := s.store.GetRun(ctx, runID)
+	if err != nil {
+		return 0, fmt.Errorf("failed to get run: %w", err)
+	}
+	if run == nil {
+		return 0, nil
+	}
+	return s.acks.position(eventAckKey{run.SessionID, deviceID, runID}, s.clock.Now(), s.config.EventAckTTL), nil
+}
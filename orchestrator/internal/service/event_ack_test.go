@@ -0,0 +1,78 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/xiaot623/gogo/orchestrator/internal/adapter/agentclient"
+	"github.com/xiaot623/gogo/orchestrator/internal/adapter/ingress"
+	"github.com/xiaot623/gogo/orchestrator/internal/adapter/llm"
+	"github.com/xiaot623/gogo/orchestrator/internal/config"
+	"github.com/xiaot623/gogo/orchestrator/internal/domain"
+	"github.com/xiaot623/gogo/orchestrator/tests/helpers"
+)
+
+func TestAckEventsTracksDevicePosition(t *testing.T) {
+	ctx := context.Background()
+	db := helpers.NewTestSQLiteStore(t)
+	svc := New(db, agentclient.NewClient(), ingress.NewClient(""), llm.NewClient("", "", time.Second), &config.Config{EventAckTTL: time.Hour}, nil)
+
+	if err := db.CreateSession(ctx, &domain.Session{SessionID: "s1", UserID: "u1", CreatedAt: time.Now()}); err != nil {
+		t.Fatalf("CreateSession: %v", err)
+	}
+	if err := db.CreateRun(ctx, &domain.Run{RunID: "r1", SessionID: "s1", RootAgentID: "a1", Status: domain.RunStatusRunning, StartedAt: time.Now()}); err != nil {
+		t.Fatalf("CreateRun: %v", err)
+	}
+	var eventIDs []string
+	for i := 0; i < 3; i++ {
+		id, err := svc.recordEventID(ctx, "r1", domain.EventTypeAgentStreamDelta, domain.AgentStreamDeltaPayload{Text: "x"})
+		if err != nil {
+			t.Fatalf("recordEventID: %v", err)
+		}
+		eventIDs = append(eventIDs, id)
+	}
+
+	acked := func(deviceID string) int64 {
+		t.Helper()
+		seq, err := svc.AckedEventSeq(ctx, "r1", deviceID)
+		if err != nil {
+			t.Fatalf("AckedEventSeq: %v", err)
+		}
+		return seq
+	}
+
+	// A pushed event's event_id stands in for its seq.
+	if err := svc.AckEvents(ctx, domain.EventAckRequest{SessionID: "s1", DeviceID: "phone", RunID: "r1", EventID: eventIDs[1]}); err != nil {
+		t.Fatalf("AckEvents: %v", err)
+	}
+	if seq := acked("phone"); seq != 2 {
+		t.Fatalf("expected phone at seq 2, got %d", seq)
+	}
+	// An ack arriving late does not move the position back.
+	if err := svc.AckEvents(ctx, domain.EventAckRequest{SessionID: "s1", DeviceID: "phone", RunID: "r1", Seq: 1}); err != nil {
+		t.Fatalf("AckEvents: %v", err)
+	}
+	if seq := acked("phone"); seq != 2 {
+		t.Fatalf("expected phone to stay at seq 2, got %d", seq)
+	}
+	if seq := acked("laptop"); seq != 0 {
+		t.Fatalf("expected no position for laptop, got %d", seq)
+	}
+
+	events, err := svc.GetRunEvents(ctx, "r1", 0, acked("phone"), nil, 10)
+	if err != nil || len(events) != 1 || events[0].EventID != eventIDs[2] {
+		t.Fatalf("expected to resume with the last event, got %+v (%v)", events, err)
+	}
+
+	for _, req := range []domain.EventAckRequest{
+		{SessionID: "s2", DeviceID: "phone", RunID: "r1", Seq: 3},
+		{SessionID: "s1", RunID: "r1", Seq: 3},
+		{SessionID: "s1", DeviceID: "phone", RunID: "r1", EventID: "evt_unknown"},
+	} {
+		if err := svc.AckEvents(ctx, req); !errors.Is(err, ErrInvalidEventAck) {
+			t.Fatalf("expected ErrInvalidEventAck for %+v, got %v", req, err)
+		}
+	}
+}
@@ -0,0 +1,224 @@
+package service
+
+import (
+	"context"
+	"encoding/json"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/xiaot623/gogo/orchestrator/internal/domain"
+	"github.com/xiaot623/gogo/orchestrator/internal/telemetry"
+)
+
+// deltaBatcher buffers a run's text delta events (agent_stream_delta or
+// agent_reasoning_delta) and writes them in a single transaction once
+// maxEvents are pending or interval has elapsed since the first pending delta.
+// The text of each written batch is pushed to ingress as one combined message
+// of pushType, identified by the last delta's event_id and listing every
+// delta it covers in event_ids. While ingress is backlogged on the session,
+// the push is held and merged with the next batch's. Callers must flush
+// before recording any other event for the run so event order is preserved;
+// flush always pushes.
+type deltaBatcher struct {
+	s *Service
+	// ctx is detached from the run's context, so the final flush of a
+	// cancelled run still records its deltas.
+	ctx       context.Context
+	runID     string
+	sessionID string
+	maxEvents int
+	interval  time.Duration
+	eventType domain.EventType
+	pushType  string
+
+	mu     sync.Mutex
+	events []*domain.Event
+	timer  *time.Timer
+
+	// The push not yet sent, which may cover deltas already written.
+	pushText strings.Builder
+	pushIDs  []string
+	pushLast *domain.Event
+}
+
+// newDeltaBatcher batches a run's agent_stream_delta events. It is flushed
+// whenever another event is recorded for the run until it is closed.
+func (s *Service) newDeltaBatcher(ctx context.Context, runID, sessionID string) *deltaBatcher {
+	b := &deltaBatcher{
+		s:         s,
+		ctx:       telemetry.Detach(ctx),
+		runID:     runID,
+		sessionID: sessionID,
+		maxEvents: s.config.EventBatchSize,
+		interval:  s.config.EventBatchInterval,
+		eventType: domain.EventTypeAgentStreamDelta,
+		pushType:  "delta",
+	}
+	s.batchers.add(b)
+	return b
+}
+
+// newReasoningBatcher batches agent_reasoning_delta events, pushed to ingress
+// as "reasoning" messages.
+func (s *Service) newReasoningBatcher(ctx context.Context, runID, sessionID string) *deltaBatcher {
+	b := s.newDeltaBatcher(ctx, runID, sessionID)
+	b.eventType = domain.EventTypeAgentReasoningDelta
+	b.pushType = "reasoning"
+	return b
+}
+
+// add buffers one delta, flushing when the batch is full.
+func (b *deltaBatcher) add(text string) {
+	payload, err := json.Marshal(domain.AgentStreamDeltaPayload{Text: text})
+	if err != nil {
+		b.s.logger.ErrorContext(b.ctx, "failed to marshal delta payload", "run_id", b.runID, "error", err)
+		return
+	}
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	event := &domain.Event{
+		EventID: b.s.ids.New("evt"),
+		RunID:   b.runID,
+		Type:    b.eventType,
+		Payload: payload,
+	}
+	b.events = append(b.events, event)
+	b.pushText.WriteString(text)
+	b.pushIDs = append(b.pushIDs, event.EventID)
+	b.pushLast = event
+
+	if b.maxEvents <= 1 || b.interval <= 0 {
+		b.flushLocked(true)
+		return
+	}
+	if len(b.events) >= b.maxEvents {
+		b.flushLocked(false)
+		return
+	}
+	if b.timer == nil {
+		b.timer = time.AfterFunc(b.interval, b.flushDue)
+	}
+}
+
+// backlogged reports whether ingress is behind on the run's session.
+func (b *deltaBatcher) backlogged() bool {
+	return b.s.ingressClient != nil && b.s.ingressClient.Backlogged(b.sessionID)
+}
+
+// flush writes and pushes any pending deltas.
+func (b *deltaBatcher) flush() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.flushLocked(true)
+}
+
+// close flushes the batcher and stops other events from flushing it.
+func (b *deltaBatcher) close() {
+	b.s.batchers.remove(b)
+	b.flush()
+}
+
+// flushDue writes pending deltas once interval has elapsed, holding their
+// push while ingress is backlogged.
+func (b *deltaBatcher) flushDue() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.flushLocked(false)
+}
+
+// flushLocked writes pending deltas and adds them to the pending push, which
+// is sent unless ingress is backlogged and force is unset; a held push is
+// retried after interval.
+func (b *deltaBatcher) flushLocked(force bool) {
+	if b.timer != nil {
+		b.timer.Stop()
+		b.timer = nil
+	}
+	if len(b.events) > 0 {
+		b.writeLocked()
+	}
+	if b.pushLast == nil {
+		return
+	}
+	if !force && b.backlogged() {
+		b.timer = time.AfterFunc(b.interval, b.flushDue)
+		return
+	}
+	b.pushLocked()
+}
+
+// writeLocked records the pending deltas in one transaction.
+func (b *deltaBatcher) writeLocked() {
+	stored, err := b.s.writeEvents(b.ctx, b.events)
+	if err != nil {
+		b.s.logger.ErrorContext(b.ctx, "failed to record batched events", "run_id", b.runID, "type", b.eventType, "count", len(b.events), "error", err)
+	} else {
+		b.s.events.publish(b.events...)
+		b.s.notifySinks(stored...)
+	}
+	b.events = nil
+}
+
+// pushLocked sends the pending push as one combined message.
+func (b *deltaBatcher) pushLocked() {
+	if b.s.ingressClient != nil {
+		b.s.ingressClient.PushEvent(b.sessionID, map[string]interface{}{
+			"type":      b.pushType,
+			"ts":        b.pushLast.Ts,
+			"run_id":    b.runID,
+			"event_id":  b.pushLast.EventID,
+			"event_ids": b.pushIDs,
+			"text":      b.pushText.String(),
+		})
+	}
+	b.pushText.Reset()
+	b.pushIDs = nil
+	b.pushLast = nil
+}
+
+// deltaBatcherSet tracks the open batchers of each run.
+type deltaBatcherSet struct {
+	mu   sync.Mutex
+	runs map[string][]*deltaBatcher
+}
+
+func newDeltaBatcherSet() *deltaBatcherSet {
+	return &deltaBatcherSet{runs: make(map[string][]*deltaBatcher)}
+}
+
+func (s *deltaBatcherSet) add(b *deltaBatcher) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.runs[b.runID] = append(s.runs[b.runID], b)
+}
+
+func (s *deltaBatcherSet) remove(b *deltaBatcher) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	open := s.runs[b.runID]
+	for i, other := range open {
+		if other == b {
+			open = append(open[:i:i], open[i+1:]...)
+			break
+		}
+	}
+	if len(open) == 0 {
+		delete(s.runs, b.runID)
+		return
+	}
+	s.runs[b.runID] = open
+}
+
+// flush writes and pushes the pending deltas of a run's open batchers, so
+// they keep their place ahead of an event about to be recorded.
+func (s *deltaBatcherSet) flush(runID string) {
+	s.mu.Lock()
+	open := append([]*deltaBatcher(nil), s.runs[runID]...)
+	s.mu.Unlock()
+	for _, b := range open {
+		b.flush()
+	}
+}
@@ -0,0 +1,375 @@
+package service
+
+import (
+	"context"
+	"encoding/json"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/xiaot623/gogo/orchestrator/internal/adapter/agentclient"
+	"github.com/xiaot623/gogo/orchestrator/internal/adapter/ingress"
+	"github.com/xiaot623/gogo/orchestrator/internal/adapter/llm"
+	"github.com/xiaot623/gogo/orchestrator/internal/clock"
+	"github.com/xiaot623/gogo/orchestrator/internal/config"
+	"github.com/xiaot623/gogo/orchestrator/internal/domain"
+	"github.com/xiaot623/gogo/orchestrator/internal/repository"
+	"github.com/xiaot623/gogo/orchestrator/tests/helpers"
+)
+
+// countingStore counts event inserts.
+type countingStore struct {
+	store.Store
+	mu           sync.Mutex
+	creates      int
+	batchCreates int
+}
+
+func (c *countingStore) CreateEvent(ctx context.Context, event *domain.Event) error {
+	c.mu.Lock()
+	c.creates++
+	c.mu.Unlock()
+	return c.Store.CreateEvent(ctx, event)
+}
+
+func (c *countingStore) CreateEvents(ctx context.Context, events []*domain.Event) error {
+	c.mu.Lock()
+	c.batchCreates++
+	c.mu.Unlock()
+	return c.Store.CreateEvents(ctx, events)
+}
+
+func TestDeltaBatcherWritesFullBatchInOneTransaction(t *testing.T) {
+	ctx := context.Background()
+	db := &countingStore{Store: helpers.NewTestSQLiteStore(t)}
+	fake, addr := startFakeIngress(t)
+
+	cfg := &config.Config{EventBatchSize: 5, EventBatchInterval: time.Hour}
+	svc := New(db, agentclient.NewClient(), ingress.NewClient(addr), llm.NewClient("", "", time.Second), cfg, nil)
+	createSessionAndRun(t, db)
+
+	b := svc.newDeltaBatcher(ctx, "r1", "s1")
+	for _, text := range []string{"He", "ll", "o", " wor", "ld"} {
+		b.add(text)
+	}
+
+	db.mu.Lock()
+	creates, batchCreates := db.creates, db.batchCreates
+	db.mu.Unlock()
+	if creates != 0 || batchCreates != 1 {
+		t.Fatalf("expected one batch insert, got %d single and %d batch inserts", creates, batchCreates)
+	}
+
+	events, err := db.GetEvents(ctx, "r1", 0, 0, nil, 10)
+	if err != nil {
+		t.Fatalf("GetEvents: %v", err)
+	}
+	if len(events) != 5 {
+		t.Fatalf("expected 5 delta events, got %d", len(events))
+	}
+
+	// Without a backlog the batch goes out as soon as it is written, as one
+	// push identified by its last delta and listing all of them, so clients
+	// can dedupe it against a replayed backlog.
+	waitForPushes(t, fake, 1)
+	fake.mu.Lock()
+	defer fake.mu.Unlock()
+	if len(fake.events) != 1 || fake.events[0].Event["text"] != "Hello world" {
+		t.Fatalf("unexpected pushes: %+v", fake.events)
+	}
+	push := fake.events[0].Event
+	if push["event_id"] != events[4].EventID {
+		t.Fatalf("expected event_id %s, got %v", events[4].EventID, push["event_id"])
+	}
+	ids, _ := push["event_ids"].([]interface{})
+	if len(ids) != 5 || ids[0] != events[0].EventID || ids[4] != events[4].EventID {
+		t.Fatalf("unexpected event_ids %v", push["event_ids"])
+	}
+}
+
+func TestDeltaBatcherMergesPushesWhileIngressIsBacklogged(t *testing.T) {
+	ctx := context.Background()
+	db := helpers.NewTestSQLiteStore(t)
+	fake, addr := startFakeIngress(t)
+	fake.received = make(chan struct{}, 16)
+	fake.release = make(chan struct{})
+
+	cfg := &config.Config{EventBatchSize: 2, EventBatchInterval: time.Hour}
+	svc := New(db, agentclient.NewClient(), ingress.NewClient(addr, ingress.WithQueueSize(16)), llm.NewClient("", "", time.Second), cfg, nil)
+	createSessionAndRun(t, db)
+
+	b := svc.newDeltaBatcher(ctx, "r1", "s1")
+
+	// The first batch's push is taken off the queue and blocks in ingress;
+	// the second waits behind it, so ingress is now backlogged.
+	b.add("He")
+	b.add("ll")
+	select {
+	case <-fake.received:
+	case <-time.After(5 * time.Second):
+		t.Fatal("first push never reached ingress")
+	}
+	b.add("o ")
+	b.add("wo")
+
+	// The third batch is still written, but its push is held and merged with
+	// the pending delta's when the run flushes.
+	b.add("rl")
+	b.add("d")
+	events, err := db.GetEvents(ctx, "r1", 0, 0, nil, 10)
+	if err != nil {
+		t.Fatalf("GetEvents: %v", err)
+	}
+	if len(events) != 6 {
+		t.Fatalf("expected 6 delta events written, got %d", len(events))
+	}
+	b.add("!")
+	b.flush()
+	close(fake.release)
+
+	events, err = db.GetEvents(ctx, "r1", 0, 0, nil, 10)
+	if err != nil {
+		t.Fatalf("GetEvents: %v", err)
+	}
+	var got string
+	for i, ev := range events {
+		if ev.Seq != int64(i+1) {
+			t.Fatalf("event %d has seq %d", i, ev.Seq)
+		}
+		var payload domain.AgentStreamDeltaPayload
+		_ = json.Unmarshal(ev.Payload, &payload)
+		got += payload.Text
+	}
+	if got != "Hello world!" {
+		t.Fatalf("unexpected recorded text %q", got)
+	}
+
+	waitForPushes(t, fake, 3)
+	fake.mu.Lock()
+	defer fake.mu.Unlock()
+	if len(fake.events) != 3 || fake.events[0].Event["text"] != "Hell" || fake.events[1].Event["text"] != "o wo" || fake.events[2].Event["text"] != "rld!" {
+		t.Fatalf("unexpected pushes: %+v", fake.events)
+	}
+	merged := fake.events[2].Event
+	if merged["event_id"] != events[6].EventID {
+		t.Fatalf("expected event_id %s, got %v", events[6].EventID, merged["event_id"])
+	}
+	ids, _ := merged["event_ids"].([]interface{})
+	if len(ids) != 3 || ids[0] != events[4].EventID || ids[2] != events[6].EventID {
+		t.Fatalf("unexpected event_ids %v", merged["event_ids"])
+	}
+}
+
+func TestDeltaBatcherFlushesAfterRunCancelled(t *testing.T) {
+	db := helpers.NewTestSQLiteStore(t)
+	fake, addr := startFakeIngress(t)
+
+	cfg := &config.Config{EventBatchSize: 10, EventBatchInterval: time.Hour}
+	svc := New(db, agentclient.NewClient(), ingress.NewClient(addr), llm.NewClient("", "", time.Second), cfg, nil)
+	createSessionAndRun(t, db)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	b := svc.newDeltaBatcher(ctx, "r1", "s1")
+	b.add("a")
+	b.add("b")
+
+	cancel()
+	b.flush()
+
+	events, err := db.GetEvents(context.Background(), "r1", 0, 0, nil, 10)
+	if err != nil {
+		t.Fatalf("GetEvents: %v", err)
+	}
+	if len(events) != 2 {
+		t.Fatalf("expected the pending deltas to be recorded after cancel, got %d events", len(events))
+	}
+	waitForPushes(t, fake, 1)
+}
+
+// waitForPushes waits until fake has received n pushes.
+func waitForPushes(t *testing.T, fake *fakeIngress, n int) {
+	t.Helper()
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		fake.mu.Lock()
+		got := len(fake.events)
+		fake.mu.Unlock()
+		if got >= n {
+			return
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("expected %d pushes, got %d", n, got)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+// createSessionAndRun creates session s1 with running run r1.
+func createSessionAndRun(t *testing.T, db store.Store) {
+	t.Helper()
+	ctx := context.Background()
+	if err := db.CreateSession(ctx, &domain.Session{SessionID: "s1", UserID: "u1", CreatedAt: time.Now()}); err != nil {
+		t.Fatalf("CreateSession: %v", err)
+	}
+	if err := db.CreateRun(ctx, &domain.Run{RunID: "r1", SessionID: "s1", RootAgentID: "a1", Status: domain.RunStatusRunning, StartedAt: time.Now()}); err != nil {
+		t.Fatalf("CreateRun: %v", err)
+	}
+}
+
+func TestEventsKeepRecordingOrderAcrossWriters(t *testing.T) {
+	ctx := context.Background()
+	db := helpers.NewTestSQLiteStore(t)
+
+	clk := clock.NewFake(time.Date(2024, 1, 1, 0, 0, 1, 0, time.UTC))
+	cfg := &config.Config{EventBatchSize: 10, EventBatchInterval: time.Hour}
+	svc := New(db, agentclient.NewClient(), nil, llm.NewClient("", "", time.Second), cfg, nil, WithClock(clk))
+
+	if err := db.CreateSession(ctx, &domain.Session{SessionID: "s1", UserID: "u1", CreatedAt: clk.Now()}); err != nil {
+		t.Fatalf("CreateSession: %v", err)
+	}
+	if err := db.CreateRun(ctx, &domain.Run{RunID: "r1", SessionID: "s1", RootAgentID: "a1", Status: domain.RunStatusRunning, StartedAt: clk.Now()}); err != nil {
+		t.Fatalf("CreateRun: %v", err)
+	}
+
+	// The delta waits in the batch while a tool result is recorded from a
+	// clock that has stepped backwards. Recording it writes the delta first,
+	// so a reader paging by seq cannot skip past the delta.
+	batcher := svc.newDeltaBatcher(ctx, "r1", "s1")
+	defer batcher.close()
+	batcher.add("hello")
+	clk.Advance(-time.Second)
+	if err := svc.recordEvent(ctx, "r1", domain.EventTypeToolResult, domain.ToolResultPayload{ToolCallID: "tc1", Status: domain.ToolCallStatusSucceeded}); err != nil {
+		t.Fatalf("recordEvent: %v", err)
+	}
+
+	events, err := db.GetEvents(ctx, "r1", 0, 0, nil, 0)
+	if err != nil {
+		t.Fatalf("GetEvents: %v", err)
+	}
+	if len(events) != 2 || events[0].Type != domain.EventTypeAgentStreamDelta || events[1].Type != domain.EventTypeToolResult {
+		t.Fatalf("expected delta then tool_result, got %+v", events)
+	}
+	if events[0].Seq >= events[1].Seq || events[0].Ts > events[1].Ts {
+		t.Fatalf("expected increasing seq and non-decreasing ts, got %+v", events)
+	}
+
+	// A closed batcher is no longer flushed by other events.
+	batcher.close()
+	batcher.add("again")
+	if err := svc.recordEvent(ctx, "r1", domain.EventTypeRunDone, domain.RunDonePayload{}); err != nil {
+		t.Fatalf("recordEvent: %v", err)
+	}
+	if seq, _, _ := db.GetLastEventPosition(ctx, "r1"); seq != 3 {
+		t.Fatalf("expected the closed batcher's delta to stay pending, got last seq %d", seq)
+	}
+}
+
+func TestEventSeqTakenByAnotherWriterIsReassigned(t *testing.T) {
+	ctx := context.Background()
+	db := helpers.NewTestSQLiteStore(t)
+	svc := New(db, agentclient.NewClient(), nil, llm.NewClient("", "", time.Second), &config.Config{}, nil)
+	createSessionAndRun(t, db)
+
+	if err := svc.recordEvent(ctx, "r1", domain.EventTypeToolResult, domain.ToolResultPayload{ToolCallID: "tc1"}); err != nil {
+		t.Fatalf("recordEvent: %v", err)
+	}
+
+	// Another writer takes the seq the run's clock would assign next.
+	if err := db.CreateEvent(ctx, &domain.Event{EventID: "evt_other", RunID: "r1", Seq: 2, Ts: time.Now().UnixMilli(), Type: domain.EventTypeToolResult, Payload: []byte(`{}`)}); err != nil {
+		t.Fatalf("CreateEvent: %v", err)
+	}
+	if err := svc.recordEvent(ctx, "r1", domain.EventTypeRunDone, domain.RunDonePayload{}); err != nil {
+		t.Fatalf("recordEvent: %v", err)
+	}
+	if err := svc.recordEvent(ctx, "r1", domain.EventTypeToolResult, domain.ToolResultPayload{ToolCallID: "tc2"}); err != nil {
+		t.Fatalf("recordEvent: %v", err)
+	}
+
+	events, err := db.GetEvents(ctx, "r1", 0, 0, nil, 0)
+	if err != nil {
+		t.Fatalf("GetEvents: %v", err)
+	}
+	if len(events) != 4 {
+		t.Fatalf("expected 4 events, got %+v", events)
+	}
+	for i, ev := range events {
+		if ev.Seq != int64(i+1) {
+			t.Fatalf("event %d has seq %d: %+v", i, ev.Seq, events)
+		}
+	}
+	if events[1].EventID != "evt_other" || events[2].Type != domain.EventTypeRunDone {
+		t.Fatalf("expected the conflicting event to move past the other writer's, got %+v", events)
+	}
+}
+
+func TestIdleEventClocksAreEvicted(t *testing.T) {
+	ctx := context.Background()
+	db := helpers.NewTestSQLiteStore(t)
+	fake := clock.NewFake(time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC))
+	svc := New(db, agentclient.NewClient(), nil, llm.NewClient("", "", time.Second), &config.Config{}, nil, WithClock(fake))
+	createSessionAndRun(t, db)
+
+	if err := svc.recordEvent(ctx, "r1", domain.EventTypeToolResult, domain.ToolResultPayload{ToolCallID: "tc1"}); err != nil {
+		t.Fatalf("recordEvent: %v", err)
+	}
+	v, ok := svc.eventSeqs.Load("r1")
+	if !ok {
+		t.Fatal("expected a clock for r1")
+	}
+	clk := v.(*runEventSeq)
+
+	fake.Advance(eventSeqIdleTTL - time.Second)
+	svc.sweepEventSeqs(fake.Now())
+	if _, ok := svc.eventSeqs.Load("r1"); !ok {
+		t.Fatal("expected the clock to be kept before the TTL")
+	}
+
+	fake.Advance(time.Second)
+	svc.sweepEventSeqs(fake.Now())
+	if _, ok := svc.eventSeqs.Load("r1"); ok {
+		t.Fatal("expected the idle clock to be evicted")
+	}
+	if !clk.evicted {
+		t.Fatal("expected the evicted clock to be marked")
+	}
+}
+
+// recordingSink collects the events an EventSink is handed.
+type recordingSink struct {
+	events []domain.Event
+}
+
+func (r *recordingSink) Deliver(event domain.Event) {
+	r.events = append(r.events, event)
+}
+
+func TestEventSinksReceiveSelectedTypes(t *testing.T) {
+	ctx := context.Background()
+	db := helpers.NewTestSQLiteStore(t)
+
+	all, selected := &recordingSink{}, &recordingSink{}
+	cfg := &config.Config{EventBatchSize: 10, EventBatchInterval: time.Hour}
+	svc := New(db, agentclient.NewClient(), nil, llm.NewClient("", "", time.Second), cfg, nil,
+		WithEventSink(all), WithEventSink(selected, domain.EventTypeRunDone))
+
+	if err := db.CreateSession(ctx, &domain.Session{SessionID: "s1", UserID: "u1", CreatedAt: time.Now()}); err != nil {
+		t.Fatalf("CreateSession: %v", err)
+	}
+	if err := db.CreateRun(ctx, &domain.Run{RunID: "r1", SessionID: "s1", RootAgentID: "a1", Status: domain.RunStatusRunning, StartedAt: time.Now()}); err != nil {
+		t.Fatalf("CreateRun: %v", err)
+	}
+
+	batcher := svc.newDeltaBatcher(ctx, "r1", "s1")
+	batcher.add("hello")
+	batcher.flush()
+	if err := svc.recordEvent(ctx, "r1", domain.EventTypeRunDone, domain.RunDonePayload{}); err != nil {
+		t.Fatalf("recordEvent: %v", err)
+	}
+
+	if len(all.events) != 2 || all.events[0].Type != domain.EventTypeAgentStreamDelta || all.events[1].Type != domain.EventTypeRunDone {
+		t.Fatalf("expected delta then run_done, got %+v", all.events)
+	}
+	if len(selected.events) != 1 || selected.events[0].Type != domain.EventTypeRunDone || selected.events[0].Seq == 0 {
+		t.Fatalf("expected only a stamped run_done, got %+v", selected.events)
+	}
+}
@@ -0,0 +1,70 @@
+package service
+
+import (
+	"sync"
+
+	"github.com/xiaot623/gogo/orchestrator/internal/domain"
+)
+
+// eventBus fans recorded run events out to in-process subscribers, so callers
+// can wait for a run's events without polling the store.
+type eventBus struct {
+	mu   sync.Mutex
+	subs map[string]map[*eventSub]struct{} // run ID -> subscribers
+}
+
+type eventSub struct {
+	types map[domain.EventType]bool
+	ch    chan domain.Event
+}
+
+func newEventBus() *eventBus {
+	return &eventBus{subs: make(map[string]map[*eventSub]struct{})}
+}
+
+// subscribe delivers the run's recorded events of the given types (all types
+// if none are given) until the returned function is called. Publishing never
+// blocks: a subscriber that falls a full buffer behind misses events, so a
+// delivery is best treated as a cue to read the run's state from the store.
+func (b *eventBus) subscribe(runID string, types ...domain.EventType) (<-chan domain.Event, func()) {
+	sub := &eventSub{ch: make(chan domain.Event, 16)}
+	if len(types) > 0 {
+		sub.types = make(map[domain.EventType]bool, len(types))
+		for _, t := range types {
+			sub.types[t] = true
+		}
+	}
+
+	b.mu.Lock()
+	if b.subs[runID] == nil {
+		b.subs[runID] = make(map[*eventSub]struct{})
+	}
+	b.subs[runID][sub] = struct{}{}
+	b.mu.Unlock()
+
+	return sub.ch, func() {
+		b.mu.Lock()
+		defer b.mu.Unlock()
+		delete(b.subs[runID], sub)
+		if len(b.subs[runID]) == 0 {
+			delete(b.subs, runID)
+		}
+	}
+}
+
+// publish delivers events to their runs' subscribers.
+func (b *eventBus) publish(events ...*domain.Event) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	for _, event := range events {
+		for sub := range b.subs[event.RunID] {
+			if sub.types != nil && !sub.types[event.Type] {
+				continue
+			}
+			select {
+			case sub.ch <- *event:
+			default:
+			}
+		}
+	}
+}
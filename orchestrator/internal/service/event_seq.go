@@ -0,0 +1,168 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"time"
+
+	"github.com/xiaot623/gogo/orchestrator/internal/domain"
+	"github.com/xiaot623/gogo/orchestrator/internal/repository"
+)
+
+// eventSeqIdleTTL is how long a run's logical clock is kept after its last
+// stamp. Runs record events after their agent stream is over (tool results,
+// the timeout reaper), so clocks are also evicted when idle rather than only
+// when the stream ends.
+const eventSeqIdleTTL = 10 * time.Minute
+
+// runEventSeq is a run's logical event clock. Events are stamped and written
+// under its lock, so seqs reach the store in order: a reader paging by seq
+// never sees an event before every lower seq of the run is visible. An
+// evicted clock is no longer in Service.eventSeqs and must not stamp.
+type runEventSeq struct {
+	mu       sync.Mutex
+	loaded   bool
+	evicted  bool
+	seq      int64
+	ts       int64
+	lastUsed time.Time
+}
+
+// writeEvents stamps events, all of one run, with the run's next seqs and a
+// ts that never goes backwards within the run, and writes them. It returns
+// the events as stored, which are redacted for ephemeral runs; the assigned
+// Seq and Ts are set on events as well.
+func (s *Service) writeEvents(ctx context.Context, events []*domain.Event) ([]*domain.Event, error) {
+	now := s.clock.Now()
+	s.sweepEventSeqs(now)
+
+	runID := events[0].RunID
+	for {
+		v, _ := s.eventSeqs.LoadOrStore(runID, &runEventSeq{})
+		clk := v.(*runEventSeq)
+		clk.mu.Lock()
+		if clk.evicted {
+			clk.mu.Unlock()
+			continue
+		}
+		stored, err := s.writeEventsLocked(ctx, clk, events)
+		clk.lastUsed = now
+		clk.mu.Unlock()
+		return stored, err
+	}
+}
+
+// writeEventsLocked stamps and writes events from clk. clk.mu must be held.
+// If the run's position cannot be loaded, or a seq was taken by a writer
+// outside this service, seqs are left to the store and the position is
+// reloaded for the next write.
+func (s *Service) writeEventsLocked(ctx context.Context, clk *runEventSeq, events []*domain.Event) ([]*domain.Event, error) {
+	s.stampLocked(ctx, clk, events)
+	stored := make([]*domain.Event, len(events))
+	for i, event := range events {
+		stored[i] = s.storedEvent(ctx, event)
+	}
+
+	err := s.createEvents(ctx, stored)
+	if errors.Is(err, store.ErrEventSeqTaken) {
+		s.logger.WarnContext(ctx, "event seq taken, letting the store assign it", "run_id", events[0].RunID, "count", len(events))
+		clk.loaded = false
+		for _, event := range stored {
+			event.Seq = 0
+		}
+		err = s.createEvents(ctx, stored)
+	}
+	if err != nil {
+		clk.loaded = false
+		return stored, err
+	}
+	for i, event := range events {
+		event.Seq = stored[i].Seq
+	}
+	return stored, nil
+}
+
+func (s *Service) createEvents(ctx context.Context, events []*domain.Event) error {
+	if len(events) == 1 {
+		return s.store.CreateEvent(ctx, events[0])
+	}
+	return s.store.CreateEvents(ctx, events)
+}
+
+// stampLocked stamps events from clk. clk.mu must be held.
+func (s *Service) stampLocked(ctx context.Context, clk *runEventSeq, events []*domain.Event) {
+	ts := s.clock.Now().UnixMilli()
+	for _, event := range events {
+		event.Ts = ts
+		event.Seq = 0
+	}
+	if !clk.loaded {
+		seq, lastTs, err := s.store.GetLastEventPosition(ctx, events[0].RunID)
+		if err != nil {
+			s.logger.WarnContext(ctx, "failed to load event position", "run_id", events[0].RunID, "error", err)
+			return
+		}
+		clk.seq, clk.ts, clk.loaded = seq, lastTs, true
+	}
+
+	if ts < clk.ts {
+		ts = clk.ts
+	}
+	clk.ts = ts
+	for _, event := range events {
+		clk.seq++
+		event.Ts = ts
+		event.Seq = clk.seq
+	}
+}
+
+// sweepEventSeqs evicts clocks idle for eventSeqIdleTTL, at most once per
+// eventSeqIdleTTL.
+func (s *Service) sweepEventSeqs(now time.Time) {
+	last := s.eventSeqsSweptAt.Load()
+	if now.UnixNano()-last < int64(eventSeqIdleTTL) || !s.eventSeqsSweptAt.CompareAndSwap(last, now.UnixNano()) {
+		return
+	}
+	s.eventSeqs.Range(func(runID, v interface{}) bool {
+		clk := v.(*runEventSeq)
+		clk.mu.Lock()
+		if now.Sub(clk.lastUsed) >= eventSeqIdleTTL {
+			s.evictLocked(runID.(string), clk)
+		}
+		clk.mu.Unlock()
+		return true
+	})
+}
+
+// evictLocked removes clk from eventSeqs. clk.mu must be held.
+func (s *Service) evictLocked(runID string, clk *runEventSeq) {
+	clk.evicted = true
+	s.eventSeqs.CompareAndDelete(runID, clk)
+}
+
+// lastEventTs returns the ts of the run's latest stamped event, or 0 if the
+// run has no logical clock loaded.
+func (s *Service) lastEventTs(runID string) int64 {
+	v, ok := s.eventSeqs.Load(runID)
+	if !ok {
+		return 0
+	}
+	clk := v.(*runEventSeq)
+	clk.mu.Lock()
+	defer clk.mu.Unlock()
+	return clk.ts
+}
+
+// forgetEventSeq drops a run's logical clock once its agent stream is over.
+// Events recorded later reload the position from the store.
+func (s *Service) forgetEventSeq(runID string) {
+	v, ok := s.eventSeqs.Load(runID)
+	if !ok {
+		return
+	}
+	clk := v.(*runEventSeq)
+	clk.mu.Lock()
+	defer clk.mu.Unlock()
+	s.evictLocked(runID, clk)
+}
@@ -0,0 +1,48 @@
+package service
+
+import (
+	"github.com/xiaot623/gogo/orchestrator/internal/domain"
+)
+
+// EventSink receives run events once they are recorded, for systems other
+// than the run's clients (e.g. webhook.Sink). Deliver is called on the
+// recording goroutine and must not block. Events of ephemeral runs arrive
+// redacted, as they are stored.
+type EventSink interface {
+	Deliver(event domain.Event)
+}
+
+type eventSinkEntry struct {
+	sink  EventSink
+	types map[domain.EventType]bool // nil = all types
+}
+
+// WithEventSink notifies sink of recorded events of the given types (all
+// types if none are given).
+func WithEventSink(sink EventSink, types ...domain.EventType) Option {
+	return func(s *Service) {
+		if sink == nil {
+			return
+		}
+		entry := eventSinkEntry{sink: sink}
+		if len(types) > 0 {
+			entry.types = make(map[domain.EventType]bool, len(types))
+			for _, t := range types {
+				entry.types[t] = true
+			}
+		}
+		s.sinks = append(s.sinks, entry)
+	}
+}
+
+// notifySinks hands stored events to the sinks that want their type.
+func (s *Service) notifySinks(events ...*domain.Event) {
+	for _, entry := range s.sinks {
+		for _, event := range events {
+			if entry.types != nil && !entry.types[event.Type] {
+				continue
+			}
+			entry.sink.Deliver(*event)
+		}
+	}
+}
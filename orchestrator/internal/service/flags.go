@@ -0,0 +1,83 @@
+package service
+
+import (
+	"errors"
+	"fmt"
+	"maps"
+	"sync"
+
+	"github.com/xiaot623/gogo/orchestrator/internal/config"
+	"github.com/xiaot623/gogo/orchestrator/internal/domain"
+)
+
+// ErrUnknownFlag is returned when an update names a flag that does not exist.
+var ErrUnknownFlag = errors.New("unknown feature flag")
+
+// ErrMaintenance is returned by InvokeAgent, InvokeTool, RegisterAgent,
+// RegisterTools and ImportMessages while the read_only flag is on. The "maintenance:" prefix
+// lets RPC callers recognize it as retryable.
+var ErrMaintenance = errors.New("maintenance: orchestrator is read-only, retry later")
+
+// flagSet holds the configured feature flag values and the overrides set at
+// runtime. Overrides live in memory only.
+type flagSet struct {
+	mu         sync.RWMutex
+	configured map[string]bool
+	overrides  map[string]bool
+}
+
+func newFlagSet(configured map[string]bool) *flagSet {
+	return &flagSet{configured: configured, overrides: make(map[string]bool)}
+}
+
+// flag returns a feature flag's current value.
+func (s *Service) flag(name string) bool {
+	s.flags.mu.RLock()
+	defer s.flags.mu.RUnlock()
+	if value, ok := s.flags.overrides[name]; ok {
+		return value
+	}
+	return s.flags.configured[name]
+}
+
+// checkWritable returns ErrMaintenance while the orchestrator is read-only.
+func (s *Service) checkWritable() error {
+	if s.flag(config.FlagReadOnly) {
+		return ErrMaintenance
+	}
+	return nil
+}
+
+// Flags returns every feature flag's current value and the runtime overrides.
+func (s *Service) Flags() domain.FeatureFlags {
+	s.flags.mu.RLock()
+	defer s.flags.mu.RUnlock()
+	flags := maps.Clone(s.flags.configured)
+	maps.Copy(flags, s.flags.overrides)
+	return domain.FeatureFlags{Flags: flags, Overrides: maps.Clone(s.flags.overrides)}
+}
+
+// SetFlags applies runtime overrides: a value sets the flag, nil clears its
+// override. The update is all or nothing; an unknown name fails it with
+// ErrUnknownFlag.
+func (s *Service) SetFlags(update domain.FeatureFlagsUpdate) (domain.FeatureFlags, error) {
+	for name := range update.Flags {
+		if !config.KnownFlag(name) {
+			return domain.FeatureFlags{}, fmt.Errorf("%w: %s", ErrUnknownFlag, name)
+		}
+	}
+
+	s.flags.mu.Lock()
+	for name, value := range update.Flags {
+		if value == nil {
+			delete(s.flags.overrides, name)
+			s.logger.Info("feature flag override cleared", "flag", name)
+			continue
+		}
+		s.flags.overrides[name] = *value
+		s.logger.Info("feature flag overridden", "flag", name, "value", *value)
+	}
+	s.flags.mu.Unlock()
+
+	return s.Flags(), nil
+}
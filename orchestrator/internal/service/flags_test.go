@@ -0,0 +1,118 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/xiaot623/gogo/orchestrator/internal/adapter/agentclient"
+	"github.com/xiaot623/gogo/orchestrator/internal/adapter/ingress"
+	"github.com/xiaot623/gogo/orchestrator/internal/adapter/llm"
+	"github.com/xiaot623/gogo/orchestrator/internal/config"
+	"github.com/xiaot623/gogo/orchestrator/internal/domain"
+	"github.com/xiaot623/gogo/orchestrator/tests/helpers"
+)
+
+func TestFeatureFlagOverrides(t *testing.T) {
+	ctx := context.Background()
+	db := helpers.NewTestSQLiteStore(t)
+	cfg := &config.Config{PolicyFailMode: config.PolicyFailClosed, CaptureReasoning: true}
+	svc := New(db, agentclient.NewClient(), ingress.NewClient(""), llm.NewClient("", "", time.Second), cfg, nil)
+
+	if svc.policyFailDecision() != "block" || !svc.flag(config.FlagCaptureReasoning) {
+		t.Fatalf("unexpected initial flags: %+v", svc.Flags())
+	}
+
+	on, off := true, false
+	flags, err := svc.SetFlags(domain.FeatureFlagsUpdate{Flags: map[string]*bool{
+		config.FlagPolicyFailOpen:   &on,
+		config.FlagCaptureReasoning: &off,
+	}})
+	if err != nil {
+		t.Fatalf("SetFlags: %v", err)
+	}
+	if !flags.Flags[config.FlagPolicyFailOpen] || len(flags.Overrides) != 2 || svc.policyFailDecision() != "allow" {
+		t.Fatalf("override not applied: %+v", flags)
+	}
+
+	if _, err := svc.SetFlags(domain.FeatureFlagsUpdate{Flags: map[string]*bool{
+		config.FlagPolicyFailOpen: nil,
+		"no_such_flag":            &on,
+	}}); !errors.Is(err, ErrUnknownFlag) {
+		t.Fatalf("expected ErrUnknownFlag, got %v", err)
+	}
+	if svc.policyFailDecision() != "allow" {
+		t.Fatal("rejected update was partly applied")
+	}
+
+	flags, err = svc.SetFlags(domain.FeatureFlagsUpdate{Flags: map[string]*bool{config.FlagPolicyFailOpen: nil}})
+	if err != nil {
+		t.Fatalf("SetFlags: %v", err)
+	}
+	if flags.Flags[config.FlagPolicyFailOpen] || len(flags.Overrides) != 1 || svc.policyFailDecision() != "block" {
+		t.Fatalf("clearing the override did not restore the configured value: %+v", flags)
+	}
+
+	// ephemeral_default makes a new session ephemeral; an explicit context
+	// entry still wins.
+	if _, err := svc.SetFlags(domain.FeatureFlagsUpdate{Flags: map[string]*bool{config.FlagEphemeralDefault: &on}}); err != nil {
+		t.Fatalf("SetFlags: %v", err)
+	}
+	for _, tc := range []struct {
+		session string
+		context map[string]string
+		want    bool
+	}{
+		{"s1", nil, true},
+		{"s2", map[string]string{domain.EphemeralContextKey: "false"}, false},
+	} {
+		session := &domain.Session{SessionID: tc.session, UserID: "u1", CreatedAt: time.Now()}
+		if err := db.CreateSession(ctx, session); err != nil {
+			t.Fatalf("CreateSession: %v", err)
+		}
+		got, err := svc.resolveEphemeral(ctx, session, tc.context)
+		if err != nil || got != tc.want {
+			t.Fatalf("%s: expected ephemeral=%v, got %v (%v)", tc.session, tc.want, got, err)
+		}
+	}
+}
+
+func TestReadOnlyMode(t *testing.T) {
+	ctx := context.Background()
+	db := helpers.NewTestSQLiteStore(t)
+	cfg := &config.Config{
+		ReadOnly:        true,
+		BootstrapAgents: []config.BootstrapAgent{{AgentID: "a1", Endpoint: "http://agent.invalid"}},
+	}
+	svc := New(db, agentclient.NewClient(), ingress.NewClient(""), llm.NewClient("", "", time.Second), cfg, nil)
+
+	// Bootstrap agents are configuration and register regardless.
+	if err := svc.BootstrapAgents(ctx); err != nil {
+		t.Fatalf("BootstrapAgents: %v", err)
+	}
+	if agents, err := svc.ListAgents(ctx); err != nil || len(agents) != 1 {
+		t.Fatalf("expected reads to be served, got %d agents (%v)", len(agents), err)
+	}
+
+	if _, err := svc.RegisterAgent(ctx, "a2", "Agent", "http://agent.invalid", nil, nil, "", "", "", 0, nil, nil); !errors.Is(err, ErrMaintenance) {
+		t.Fatalf("RegisterAgent: expected ErrMaintenance, got %v", err)
+	}
+	if _, err := svc.RegisterTools(ctx, domain.ToolRegistrationRequest{ClientID: "c1", Tools: []domain.ToolRegistrationItem{{Name: "t1"}}}); !errors.Is(err, ErrMaintenance) {
+		t.Fatalf("RegisterTools: expected ErrMaintenance, got %v", err)
+	}
+	if _, err := svc.InvokeAgent(ctx, domain.InvokeRequest{SessionID: "s1", AgentID: "a1", InputMessage: domain.InputMessage{Role: "user", Content: "hi"}}); !errors.Is(err, ErrMaintenance) {
+		t.Fatalf("InvokeAgent: expected ErrMaintenance, got %v", err)
+	}
+	if _, err := svc.InvokeTool(ctx, "t1", domain.ToolInvokeRequest{RunID: "r1"}); !errors.Is(err, ErrMaintenance) {
+		t.Fatalf("InvokeTool: expected ErrMaintenance, got %v", err)
+	}
+
+	off := false
+	if _, err := svc.SetFlags(domain.FeatureFlagsUpdate{Flags: map[string]*bool{config.FlagReadOnly: &off}}); err != nil {
+		t.Fatalf("SetFlags: %v", err)
+	}
+	if _, err := svc.RegisterAgent(ctx, "a2", "Agent", "http://agent.invalid", nil, nil, "", "", "", 0, nil, nil); err != nil {
+		t.Fatalf("RegisterAgent after leaving read-only mode: %v", err)
+	}
+}
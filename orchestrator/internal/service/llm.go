@@ -2,18 +2,97 @@ package service
 
 import (
 	"context"
-	"log"
+	"errors"
+	"fmt"
+	"sort"
 	"time"
 
-	"github.com/google/uuid"
 	"github.com/xiaot623/gogo/orchestrator/internal/adapter/llm"
+	"github.com/xiaot623/gogo/orchestrator/internal/config"
 	"github.com/xiaot623/gogo/orchestrator/internal/domain"
+	"github.com/xiaot623/gogo/orchestrator/internal/telemetry"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
 )
 
+// LLMStreamKeepalive returns how long a proxied streaming completion may stay
+// silent before the client is sent a keepalive comment (0 disables).
+func (s *Service) LLMStreamKeepalive() time.Duration {
+	return s.config.LLMStreamKeepalive
+}
+
+// defaultModelName asks for LLM_DEFAULT_MODEL by name.
+const defaultModelName = "default"
+
+// ResolveLLMModel rewrites req.Model to the model it stands for: an alias
+// from LLM_MODEL_ALIASES becomes its model, and an empty model or "default"
+// becomes LLM_DEFAULT_MODEL when one is set. Other models are left as sent.
+func (s *Service) ResolveLLMModel(req *llm.ChatCompletionRequest) {
+	requested := req.Model
+	if (requested == "" || requested == defaultModelName) && s.config.LLMDefaultModel != "" {
+		req.Model = s.config.LLMDefaultModel
+	}
+	if model, ok := s.config.LLMModelAliases[req.Model]; ok {
+		req.Model = model
+	}
+	if req.Model != requested {
+		s.logger.Debug("resolved model", "requested", requested, "model", req.Model)
+	}
+}
+
+// ErrLLMParamOutOfRange is returned when a chat completion asks for a
+// generation param above its configured maximum and LLM_PARAM_OVERFLOW is
+// "reject".
+var ErrLLMParamOutOfRange = errors.New("generation param out of range")
+
+// ApplyLLMParamLimits fills in default generation params missing from req and
+// clamps (or, per LLM_PARAM_OVERFLOW, rejects) ones above their maximum.
+func (s *Service) ApplyLLMParamLimits(req *llm.ChatCompletionRequest) error {
+	reject := s.config.LLMParamOverflow == config.LLMParamOverflowReject
+
+	if req.Temperature == nil && s.config.LLMDefaultTemperature != nil {
+		t := *s.config.LLMDefaultTemperature
+		req.Temperature = &t
+	}
+	if max := s.config.LLMMaxTemperature; max > 0 && req.Temperature != nil && *req.Temperature > max {
+		if reject {
+			return fmt.Errorf("temperature %v exceeds the limit of %v: %w", *req.Temperature, max, ErrLLMParamOutOfRange)
+		}
+		s.logger.Info("clamping temperature", "model", req.Model, "requested", *req.Temperature, "max", max)
+		req.Temperature = &max
+	}
+
+	if req.MaxTokens == nil && s.config.LLMDefaultMaxTokens > 0 {
+		n := s.config.LLMDefaultMaxTokens
+		req.MaxTokens = &n
+	}
+	if max := s.config.LLMMaxTokensLimit; max > 0 && req.MaxTokens != nil && *req.MaxTokens > max {
+		if reject {
+			return fmt.Errorf("max_tokens %d exceeds the limit of %d: %w", *req.MaxTokens, max, ErrLLMParamOutOfRange)
+		}
+		s.logger.Info("clamping max_tokens", "model", req.Model, "requested", *req.MaxTokens, "max", max)
+		req.MaxTokens = &max
+	}
+
+	if req.TopP == nil && s.config.LLMDefaultTopP != nil {
+		p := *s.config.LLMDefaultTopP
+		req.TopP = &p
+	}
+	return nil
+}
+
 // ProxyChatCompletion handles non-streaming chat completion proxying.
 func (s *Service) ProxyChatCompletion(ctx context.Context, runID string, req *llm.ChatCompletionRequest) (*llm.ChatCompletionResponse, error) {
-	requestID := "llm_" + uuid.New().String()[:8]
-	startTime := time.Now()
+	requestID := s.ids.New("llm")
+	startTime := s.clock.Now()
+
+	ctx, span := telemetry.Tracer().Start(ctx, "ProxyChatCompletion")
+	defer span.End()
+	span.SetAttributes(
+		attribute.String("model", req.Model),
+		attribute.String("run_id", runID),
+		attribute.Bool("stream", req.Stream),
+	)
 
 	// Record llm_call_started event
 	if runID != "" {
@@ -22,13 +101,15 @@ func (s *Service) ProxyChatCompletion(ctx context.Context, runID string, req *ll
 			Model:     req.Model,
 			Stream:    req.Stream,
 		}); err != nil {
-			log.Printf("WARN: failed to record llm_call_started event: %v", err)
+			s.logger.WarnContext(ctx, "failed to record llm_call_started event", "run_id", runID, "error", err)
 		}
 	}
 
 	resp, err := s.llmClient.CreateChatCompletion(ctx, req)
 	if err != nil {
-		latencyMs := time.Since(startTime).Milliseconds()
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+		latencyMs := s.clock.Now().Sub(startTime).Milliseconds()
 		// Record llm_call_done with error
 		if runID != "" {
 			s.recordEvent(ctx, runID, domain.EventTypeLLMCallDone, domain.LLMCallDonePayload{
@@ -40,8 +121,11 @@ func (s *Service) ProxyChatCompletion(ctx context.Context, runID string, req *ll
 		}
 		return nil, err
 	}
+	if resp.Model == "" {
+		resp.Model = req.Model
+	}
 
-	latencyMs := time.Since(startTime).Milliseconds()
+	latencyMs := s.clock.Now().Sub(startTime).Milliseconds()
 
 	// Record llm_call_done event
 	if runID != "" {
@@ -56,7 +140,7 @@ func (s *Service) ProxyChatCompletion(ctx context.Context, runID string, req *ll
 			payload.TotalTokens = resp.Usage.TotalTokens
 		}
 		if err := s.recordEvent(ctx, runID, domain.EventTypeLLMCallDone, payload); err != nil {
-			log.Printf("WARN: failed to record llm_call_done event: %v", err)
+			s.logger.WarnContext(ctx, "failed to record llm_call_done event", "run_id", runID, "error", err)
 		}
 	}
 
@@ -65,8 +149,16 @@ func (s *Service) ProxyChatCompletion(ctx context.Context, runID string, req *ll
 
 // ProxyChatCompletionStream handles streaming chat completion proxying.
 func (s *Service) ProxyChatCompletionStream(ctx context.Context, runID string, req *llm.ChatCompletionRequest, callback llm.StreamCallback) error {
-	requestID := "llm_" + uuid.New().String()[:8]
-	startTime := time.Now()
+	requestID := s.ids.New("llm")
+	startTime := s.clock.Now()
+
+	ctx, span := telemetry.Tracer().Start(ctx, "ProxyChatCompletionStream")
+	defer span.End()
+	span.SetAttributes(
+		attribute.String("model", req.Model),
+		attribute.String("run_id", runID),
+		attribute.Bool("stream", req.Stream),
+	)
 
 	// Record llm_call_started event
 	if runID != "" {
@@ -75,23 +167,33 @@ func (s *Service) ProxyChatCompletionStream(ctx context.Context, runID string, r
 			Model:     req.Model,
 			Stream:    req.Stream,
 		}); err != nil {
-			log.Printf("WARN: failed to record llm_call_started event: %v", err)
+			s.logger.WarnContext(ctx, "failed to record llm_call_started event", "run_id", runID, "error", err)
 		}
 	}
 
-	var responseModel string
+	responseModel := req.Model
 
-	// Wrap callback to capture model
+	// Wrap callback to capture the model the upstream reports and fill it
+	// in on chunks that omit it
+	reported := false
 	wrapperCallback := func(chunk *llm.StreamChunk) error {
-		if responseModel == "" && chunk.Model != "" {
+		if !reported && chunk.Model != "" {
 			responseModel = chunk.Model
+			reported = true
+		}
+		if chunk.Model == "" {
+			chunk.Model = responseModel
 		}
 		return callback(chunk)
 	}
 
 	usage, err := s.llmClient.CreateChatCompletionStream(ctx, req, wrapperCallback)
+	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+	}
 
-	latencyMs := time.Since(startTime).Milliseconds()
+	latencyMs := s.clock.Now().Sub(startTime).Milliseconds()
 
 	// Record llm_call_done event
 	if runID != "" {
@@ -109,14 +211,27 @@ func (s *Service) ProxyChatCompletionStream(ctx context.Context, runID string, r
 			payload.Error = err.Error()
 		}
 		if recordErr := s.recordEvent(ctx, runID, domain.EventTypeLLMCallDone, payload); recordErr != nil {
-			log.Printf("WARN: failed to record llm_call_done event: %v", recordErr)
+			s.logger.WarnContext(ctx, "failed to record llm_call_done event", "run_id", runID, "error", recordErr)
 		}
 	}
 
 	return err
 }
 
-// ListModels retrieves the list of available models.
+// ListModels retrieves the list of available models, followed by the model
+// aliases when LLM_LIST_MODEL_ALIASES is on.
 func (s *Service) ListModels(ctx context.Context) ([]llm.Model, error) {
-	return s.llmClient.ListModels(ctx)
+	models, err := s.llmClient.ListModels(ctx)
+	if err != nil || !s.config.LLMListModelAliases || len(s.config.LLMModelAliases) == 0 {
+		return models, err
+	}
+	aliases := make([]string, 0, len(s.config.LLMModelAliases))
+	for alias := range s.config.LLMModelAliases {
+		aliases = append(aliases, alias)
+	}
+	sort.Strings(aliases)
+	for _, alias := range aliases {
+		models = append(models, llm.Model{ID: alias, Object: "model", OwnedBy: "alias:" + s.config.LLMModelAliases[alias]})
+	}
+	return models, nil
 }
@@ -0,0 +1,217 @@
+package service
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/xiaot623/gogo/orchestrator/internal/adapter/agentclient"
+	"github.com/xiaot623/gogo/orchestrator/internal/adapter/llm"
+	"github.com/xiaot623/gogo/orchestrator/internal/domain"
+)
+
+// defaultLLMAgentMaxIterations caps the LLM calls of an llm_tools run whose
+// agent does not set max_iterations.
+const defaultLLMAgentMaxIterations = 8
+
+// llmToolNameInvalid matches characters not allowed in an OpenAI function
+// name; tool names like "payments.transfer" are offered as
+// "payments_transfer".
+var llmToolNameInvalid = regexp.MustCompile(`[^a-zA-Z0-9_-]`)
+
+// invokeLLMToolsAgent runs a built-in llm_tools agent: it calls the LLM,
+// executes the tool calls it asks for through InvokeTool (so policy and
+// approvals apply), feeds the results back, and repeats until the LLM answers
+// without tool calls or MaxIterations is reached. It reports progress through
+// handler as the same delta/state/done events an external agent streams. It
+// has the signature of agentclient.Client.Invoke; endpoint is unused.
+func (s *Service) invokeLLMToolsAgent(ctx context.Context, endpoint string, req *domain.AgentInvokeRequest, handler agentclient.EventHandler) error {
+	cfg := req.LLM
+	if err := cfg.Validate(); err != nil {
+		return err
+	}
+	maxIterations := cfg.MaxIterations
+	if maxIterations == 0 {
+		maxIterations = defaultLLMAgentMaxIterations
+	}
+
+	tools, toolNames, err := s.llmAgentTools(ctx, cfg.Tools)
+	if err != nil {
+		return err
+	}
+
+	messages := make([]llm.ChatMessage, 0, len(req.Messages)+2)
+	if cfg.SystemPrompt != "" {
+		messages = append(messages, llm.ChatMessage{Role: "system", Content: cfg.SystemPrompt})
+	}
+	for _, m := range req.Messages {
+		messages = append(messages, llm.ChatMessage{Role: m.Role, Content: m.Content})
+	}
+	if len(req.Messages) == 0 {
+		messages = append(messages, llm.ChatMessage{Role: req.InputMessage.Role, Content: req.InputMessage.Content})
+	}
+
+	usage := &domain.UsageData{}
+	for i := 0; i < maxIterations; i++ {
+		if i > 0 {
+			if err := s.checkRunDeadline(ctx, req.RunID); err != nil {
+				return err
+			}
+		}
+		chatReq := &llm.ChatCompletionRequest{Model: cfg.Model, Messages: messages, Tools: tools}
+		if err := s.ApplyLLMParamLimits(chatReq); err != nil {
+			return err
+		}
+		resp, err := s.ProxyChatCompletion(ctx, req.RunID, chatReq)
+		if err != nil {
+			return fmt.Errorf("llm call failed: %w", err)
+		}
+		if resp.Usage != nil {
+			usage.PromptTokens += resp.Usage.PromptTokens
+			usage.CompletionTokens += resp.Usage.CompletionTokens
+			usage.TotalTokens += resp.Usage.TotalTokens
+		}
+		if len(resp.Choices) == 0 || resp.Choices[0].Message == nil {
+			return fmt.Errorf("llm returned no message")
+		}
+		msg := *resp.Choices[0].Message
+
+		if len(msg.ToolCalls) == 0 {
+			if msg.Content != "" {
+				if err := emitAgentEvent(handler, "delta", domain.DeltaEventData{Text: msg.Content, RunID: req.RunID}); err != nil {
+					return err
+				}
+			}
+			return emitAgentEvent(handler, "done", domain.DoneEventData{FinalMessage: msg.Content, Usage: usage})
+		}
+
+		messages = append(messages, llm.ChatMessage{Role: "assistant", Content: msg.Content, ToolCalls: msg.ToolCalls})
+		called := make([]string, 0, len(msg.ToolCalls))
+		for _, tc := range msg.ToolCalls {
+			called = append(called, tc.Function.Name)
+		}
+		if err := emitAgentEvent(handler, "state", domain.StateEventData{State: "calling_tools", Detail: strings.Join(called, ", ")}); err != nil {
+			return err
+		}
+		for _, tc := range msg.ToolCalls {
+			content := s.runLLMToolCall(ctx, req.RunID, toolNames[tc.Function.Name], tc)
+			messages = append(messages, llm.ChatMessage{Role: "tool", ToolCallID: tc.ID, Content: content})
+		}
+	}
+	return fmt.Errorf("llm tool loop reached max_iterations (%d) without a final message", maxIterations)
+}
+
+// llmAgentTools builds the tool definitions offered to the LLM from registered
+// tools, with a map from each offered function name back to its tool name.
+func (s *Service) llmAgentTools(ctx context.Context, names []string) ([]llm.Tool, map[string]string, error) {
+	tools := make([]llm.Tool, 0, len(names))
+	toolNames := make(map[string]string, len(names))
+	for _, name := range names {
+		tool, err := s.store.GetTool(ctx, name)
+		if err != nil {
+			return nil, nil, fmt.Errorf("failed to get tool %s: %w", name, err)
+		}
+		if tool == nil {
+			return nil, nil, fmt.Errorf("tool %s not found", name)
+		}
+		fn := llmToolNameInvalid.ReplaceAllString(name, "_")
+		toolNames[fn] = name
+		def := llm.Tool{Type: "function", Function: llm.ToolFunction{Name: fn}}
+		if len(tool.Schema) > 0 {
+			def.Function.Parameters = tool.Schema
+		}
+		tools = append(tools, def)
+	}
+	return tools, toolNames, nil
+}
+
+// runLLMToolCall invokes one tool call requested by the LLM, waits for it to
+// finish (including any approval), and returns the tool message content: the
+// result on success, else {"error": {...}}.
+func (s *Service) runLLMToolCall(ctx context.Context, runID, toolName string, call llm.ToolCall) string {
+	if toolName == "" {
+		return llmToolError("unknown_tool", "tool "+call.Function.Name+" is not available")
+	}
+	args := json.RawMessage(call.Function.Arguments)
+	if len(args) == 0 {
+		args = json.RawMessage(`{}`)
+	}
+	if !json.Valid(args) {
+		return llmToolError("invalid_args", "arguments are not valid JSON")
+	}
+
+	resp, err := s.invokeTool(ctx, toolName, domain.ToolInvokeRequest{RunID: runID, Args: args})
+	if err != nil {
+		if errors.Is(err, ErrTooManyToolCalls) {
+			return llmToolError("too_many_tool_calls", err.Error())
+		}
+		s.logger.WarnContext(ctx, "llm tool call failed", "tool_name", toolName, "run_id", runID, "error", err)
+		return llmToolError("invoke_failed", err.Error())
+	}
+	if resp.Status == "pending" {
+		tc, err := s.awaitToolCall(ctx, runID, resp.ToolCallID)
+		if err != nil {
+			return llmToolError("wait_failed", err.Error())
+		}
+		resp = toolInvokeResponseFromToolCall(tc)
+	}
+
+	switch {
+	case resp.Status == "succeeded":
+		if len(resp.Result) == 0 {
+			return "null"
+		}
+		return string(resp.Result)
+	case resp.Error != nil:
+		return llmToolError(resp.Error.Code, resp.Error.Message)
+	default:
+		return llmToolError("failed", "tool call did not succeed")
+	}
+}
+
+// awaitToolCall blocks until the tool call is terminal or ctx ends. Run events
+// are the cue to re-read the tool call; a slow poll covers missed deliveries.
+func (s *Service) awaitToolCall(ctx context.Context, runID, toolCallID string) (*domain.ToolCall, error) {
+	events, unsubscribe := s.events.subscribe(runID)
+	defer unsubscribe()
+
+	poll := time.NewTicker(time.Second)
+	defer poll.Stop()
+	for {
+		tc, err := s.store.GetToolCall(ctx, toolCallID)
+		if err != nil {
+			return nil, fmt.Errorf("failed to get tool call: %w", err)
+		}
+		if tc == nil {
+			return nil, fmt.Errorf("tool call not found")
+		}
+		if isTerminalStatus(tc.Status) {
+			return tc, nil
+		}
+		select {
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		case <-events:
+		case <-poll.C:
+		}
+	}
+}
+
+func llmToolError(code, message string) string {
+	data, _ := json.Marshal(map[string]domain.ToolError{"error": {Code: code, Message: message}})
+	return string(data)
+}
+
+// emitAgentEvent passes a built-in agent's event to the stream handler as if
+// an external agent had sent it.
+func emitAgentEvent(handler agentclient.EventHandler, event string, data interface{}) error {
+	payload, err := json.Marshal(data)
+	if err != nil {
+		return err
+	}
+	return handler(agentclient.SSEEvent{Event: event, Data: string(payload)})
+}
@@ -0,0 +1,162 @@
+package service
+
+import (
+	"context"
+	"encoding/json"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/xiaot623/gogo/orchestrator/internal/adapter/agentclient"
+	"github.com/xiaot623/gogo/orchestrator/internal/adapter/ingress"
+	"github.com/xiaot623/gogo/orchestrator/internal/adapter/llm"
+	"github.com/xiaot623/gogo/orchestrator/internal/config"
+	"github.com/xiaot623/gogo/orchestrator/internal/domain"
+	"github.com/xiaot623/gogo/orchestrator/internal/repository"
+	"github.com/xiaot623/gogo/orchestrator/internal/tools"
+	"github.com/xiaot623/gogo/orchestrator/policy"
+	"github.com/xiaot623/gogo/orchestrator/tests/helpers"
+)
+
+// scriptedLLM answers chat completions with a fixed sequence of assistant
+// messages and records the requests it saw.
+type scriptedLLM struct {
+	mu       sync.Mutex
+	replies  []llm.ChatMessage
+	requests []*llm.ChatCompletionRequest
+}
+
+func (l *scriptedLLM) CreateChatCompletion(ctx context.Context, req *llm.ChatCompletionRequest) (*llm.ChatCompletionResponse, error) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	reply := l.replies[len(l.requests)%len(l.replies)]
+	copied := *req
+	copied.Messages = append([]llm.ChatMessage(nil), req.Messages...)
+	l.requests = append(l.requests, &copied)
+	return &llm.ChatCompletionResponse{
+		Model:   req.Model,
+		Choices: []llm.Choice{{Message: &reply, FinishReason: "stop"}},
+		Usage:   &llm.Usage{PromptTokens: 10, CompletionTokens: 5, TotalTokens: 15},
+	}, nil
+}
+
+func (l *scriptedLLM) CreateChatCompletionStream(ctx context.Context, req *llm.ChatCompletionRequest, callback llm.StreamCallback) (*llm.Usage, error) {
+	return nil, nil
+}
+
+func (l *scriptedLLM) ListModels(ctx context.Context) ([]llm.Model, error) {
+	return nil, nil
+}
+
+func newLLMAgentService(t *testing.T, replies []llm.ChatMessage) (*Service, *scriptedLLM, *store.SQLiteStore) {
+	t.Helper()
+	ctx := context.Background()
+	db := helpers.NewTestSQLiteStore(t)
+
+	registry := tools.NewRegistry()
+	if err := registry.Register("math.add", func(ctx context.Context, args json.RawMessage) (json.RawMessage, error) {
+		var in struct{ A, B int }
+		if err := json.Unmarshal(args, &in); err != nil {
+			return nil, err
+		}
+		return json.Marshal(map[string]int{"sum": in.A + in.B})
+	}); err != nil {
+		t.Fatalf("Register: %v", err)
+	}
+	if err := db.UpsertTool(ctx, &domain.Tool{Name: "math.add", Kind: domain.ToolKindServer, Schema: json.RawMessage(`{"type":"object"}`)}); err != nil {
+		t.Fatalf("UpsertTool: %v", err)
+	}
+
+	policyEngine, err := policy.NewEngine(ctx, policy.DefaultPolicy)
+	if err != nil {
+		t.Fatalf("NewEngine failed: %v", err)
+	}
+	client := &scriptedLLM{replies: replies}
+	cfg := &config.Config{AgentTimeout: 5 * time.Second, InvokeWaitMax: 5 * time.Second, ToolTimeout: time.Minute, MaxHistoryMessages: 10}
+	svc := New(db, agentclient.NewClient(), ingress.NewClient(""), client, cfg, policyEngine, WithToolRegistry(registry))
+	if _, err := svc.RegisterAgent(ctx, "calc", "Calculator", "", nil, nil, domain.AgentProtocolLLMTools, "", "", 0, nil, &domain.LLMAgentConfig{
+		Model:         "gpt-test",
+		SystemPrompt:  "You add numbers.",
+		Tools:         []string{"math.add"},
+		MaxIterations: 3,
+	}); err != nil {
+		t.Fatalf("RegisterAgent: %v", err)
+	}
+	return svc, client, db
+}
+
+func TestLLMToolsAgentRunsToolLoop(t *testing.T) {
+	ctx := context.Background()
+	svc, client, db := newLLMAgentService(t, []llm.ChatMessage{
+		{Role: "assistant", ToolCalls: []llm.ToolCall{{ID: "call_1", Type: "function", Function: llm.ToolCallFunction{Name: "math_add", Arguments: `{"a":2,"b":3}`}}}},
+		{Role: "assistant", Content: "2 + 3 = 5"},
+	})
+
+	result, err := svc.InvokeAgentAndWait(ctx, domain.InvokeRequest{
+		SessionID:    "s1",
+		AgentID:      "calc",
+		InputMessage: domain.InputMessage{Role: "user", Content: "what is 2 + 3?"},
+	}, 5*time.Second)
+	if err != nil {
+		t.Fatalf("InvokeAgentAndWait: %v", err)
+	}
+	if result.Status != domain.RunStatusDone || result.FinalMessage != "2 + 3 = 5" {
+		t.Fatalf("unexpected result: %+v", result)
+	}
+
+	if len(client.requests) != 2 {
+		t.Fatalf("expected 2 LLM calls, got %d", len(client.requests))
+	}
+	first := client.requests[0]
+	if first.Model != "gpt-test" || len(first.Tools) != 1 || first.Tools[0].Function.Name != "math_add" {
+		t.Fatalf("unexpected first request: %+v", first)
+	}
+	if first.Messages[0].Role != "system" || first.Messages[len(first.Messages)-1].Content != "what is 2 + 3?" {
+		t.Fatalf("unexpected first messages: %+v", first.Messages)
+	}
+	toolMsg := client.requests[1].Messages[len(client.requests[1].Messages)-1]
+	if toolMsg.Role != "tool" || toolMsg.ToolCallID != "call_1" || toolMsg.Content != `{"sum":5}` {
+		t.Fatalf("unexpected tool message: %+v", toolMsg)
+	}
+
+	events, err := db.GetEvents(ctx, result.RunID, 0, 0, nil, 100)
+	if err != nil {
+		t.Fatalf("GetEvents: %v", err)
+	}
+	var types []string
+	for _, e := range events {
+		types = append(types, string(e.Type))
+	}
+	got := strings.Join(types, ",")
+	for _, want := range []string{"llm_call_started", "llm_call_done", "agent_state", "tool_result", "agent_stream_delta", "agent_invoke_done", "run_done"} {
+		if !strings.Contains(got, want) {
+			t.Fatalf("expected %s event, got %s", want, got)
+		}
+	}
+}
+
+func TestLLMToolsAgentStopsAtMaxIterations(t *testing.T) {
+	ctx := context.Background()
+	svc, client, _ := newLLMAgentService(t, []llm.ChatMessage{
+		{Role: "assistant", ToolCalls: []llm.ToolCall{{ID: "call_1", Type: "function", Function: llm.ToolCallFunction{Name: "unknown_tool", Arguments: `{}`}}}},
+	})
+
+	result, err := svc.InvokeAgentAndWait(ctx, domain.InvokeRequest{
+		SessionID:    "s1",
+		AgentID:      "calc",
+		InputMessage: domain.InputMessage{Role: "user", Content: "loop forever"},
+	}, 5*time.Second)
+	if err != nil {
+		t.Fatalf("InvokeAgentAndWait: %v", err)
+	}
+	if result.Status != domain.RunStatusFailed || result.Error == nil || !strings.Contains(result.Error.Message, "max_iterations") {
+		t.Fatalf("expected run to fail at max_iterations, got %+v", result)
+	}
+	if len(client.requests) != 3 {
+		t.Fatalf("expected 3 LLM calls, got %d", len(client.requests))
+	}
+	if msg := client.requests[1].Messages[len(client.requests[1].Messages)-1]; !strings.Contains(msg.Content, "unknown_tool") {
+		t.Fatalf("expected unknown tool error fed back, got %+v", msg)
+	}
+}
@@ -2,15 +2,99 @@ package service
 
 import (
 	"context"
+	"errors"
 	"fmt"
+	"sort"
 
 	"github.com/xiaot623/gogo/orchestrator/internal/domain"
 )
 
-func (s *Service) GetMessages(ctx context.Context, sessionID string, limit int, before string) ([]domain.Message, error) {
-	messages, err := s.store.GetMessages(ctx, sessionID, limit, before)
+// ErrInvalidMessageImport is returned for an import with no messages, too
+// many of them, or a message of an unknown role.
+var ErrInvalidMessageImport = errors.New("invalid message import")
+
+// ErrSessionNotFound is returned when importing into a session that does not
+// exist without a user_id to create it for.
+var ErrSessionNotFound = errors.New("session not found")
+
+// maxImportMessages caps the messages of one ImportMessages call.
+const maxImportMessages = 10000
+
+// importRoles are the roles an imported message may have.
+var importRoles = map[string]bool{"user": true, "assistant": true, "system": true, "tool": true}
+
+func (s *Service) GetMessages(ctx context.Context, sessionID string, limit int, before string, filter domain.MessageFilter) ([]domain.Message, error) {
+	messages, err := s.store.GetMessages(ctx, sessionID, limit, before, filter)
 	if err != nil {
 		return nil, fmt.Errorf("failed to get messages: %w", err)
 	}
 	return messages, nil
 }
+
+// ImportMessages stores an existing conversation in a session at once, e.g.
+// when migrating from another system. The messages are stored in created_at
+// order, keeping the request order for equal timestamps, and either all of
+// them are stored or none is. It fails with ErrMaintenance while read-only.
+func (s *Service) ImportMessages(ctx context.Context, sessionID string, req domain.MessageImportRequest) (*domain.MessageImportResponse, error) {
+	if err := s.checkWritable(); err != nil {
+		return nil, err
+	}
+	if len(req.Messages) == 0 || len(req.Messages) > maxImportMessages {
+		return nil, fmt.Errorf("%w: 1-%d messages are required", ErrInvalidMessageImport, maxImportMessages)
+	}
+	for i, m := range req.Messages {
+		if !importRoles[m.Role] {
+			return nil, fmt.Errorf("%w: message %d has unknown role %q", ErrInvalidMessageImport, i, m.Role)
+		}
+	}
+
+	session, err := s.store.GetSession(ctx, sessionID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get session: %w", err)
+	}
+	if session == nil {
+		if req.UserID == "" {
+			return nil, fmt.Errorf("%w: user_id is required to create it", ErrSessionNotFound)
+		}
+		if _, err := s.store.GetOrCreateSession(ctx, sessionID, req.UserID); err != nil {
+			return nil, fmt.Errorf("failed to create session: %w", err)
+		}
+	}
+
+	now := s.clock.Now()
+	messages := make([]domain.Message, len(req.Messages))
+	for i, m := range req.Messages {
+		createdAt := m.CreatedAt
+		if createdAt.IsZero() {
+			createdAt = now
+		}
+		messages[i] = domain.Message{
+			SessionID: sessionID,
+			RunID:     m.RunID,
+			Role:      m.Role,
+			Content:   m.Content,
+			CreatedAt: createdAt,
+			Metadata:  m.Metadata,
+		}
+	}
+	sort.SliceStable(messages, func(i, j int) bool {
+		return messages[i].CreatedAt.Before(messages[j].CreatedAt)
+	})
+	// IDs are assigned in created_at order so that they sort the same way.
+	for i := range messages {
+		messages[i].MessageID = s.ids.New("msg")
+	}
+
+	if err := s.store.CreateMessages(ctx, messages); err != nil {
+		return nil, fmt.Errorf("failed to import messages: %w", err)
+	}
+	return &domain.MessageImportResponse{SessionID: sessionID, ImportedCount: len(messages), Messages: messages}, nil
+}
+
+func (s *Service) UpdateSessionMetadata(ctx context.Context, sessionID string, req domain.SessionUpdateRequest) (*domain.Session, error) {
+	session, err := s.store.UpdateSessionMetadata(ctx, sessionID, req.Metadata, req.Replace)
+	if err != nil {
+		return nil, fmt.Errorf("failed to update session metadata: %w", err)
+	}
+	return session, nil
+}
@@ -0,0 +1,62 @@
+package service
+
+import (
+	"context"
+	"encoding/json"
+
+	"github.com/xiaot623/gogo/orchestrator/internal/domain"
+)
+
+// contentBlockedCode fails runs whose input or output the moderator blocked.
+const contentBlockedCode = "content_blocked"
+
+// contentBlockedError aborts an agent stream whose output the moderator
+// blocked mid-stream.
+type contentBlockedError struct {
+	reason string
+}
+
+func (e *contentBlockedError) Error() string {
+	return "content blocked: " + e.reason
+}
+
+// moderate checks content with the moderator when ModerationEnabled is set,
+// and otherwise allows it.
+func (s *Service) moderate(ctx context.Context, role, content string) (bool, string) {
+	if !s.config.ModerationEnabled || content == "" {
+		return true, ""
+	}
+	allowed, reason := s.moderator.Check(ctx, role, content)
+	if !allowed && reason == "" {
+		reason = "content not allowed"
+	}
+	return allowed, reason
+}
+
+// failContentBlocked fails a run with content_blocked and reason, and tells
+// the session's clients.
+func (s *Service) failContentBlocked(ctx context.Context, runID, sessionID, reason string) {
+	logger := s.logger.With("run_id", runID, "session_id", sessionID)
+	payload := domain.RunFailedPayload{Code: contentBlockedCode, Message: reason}
+
+	eventID, err := s.recordEventID(ctx, runID, domain.EventTypeRunFailed, payload)
+	if err != nil {
+		logger.ErrorContext(ctx, "failed to record run_failed event", "error", err)
+	}
+	errData, _ := json.Marshal(payload)
+	if err := s.store.UpdateRunCompleted(ctx, runID, domain.RunStatusFailed, errData); err != nil {
+		logger.ErrorContext(ctx, "failed to update run status", "error", err)
+	}
+	if s.ingressClient != nil {
+		s.ingressClient.PushEvent(sessionID, map[string]interface{}{
+			"type":     "error",
+			"ts":       s.clock.Now().UnixMilli(),
+			"run_id":   runID,
+			"event_id": eventID,
+			"code":     contentBlockedCode,
+			"message":  reason,
+		})
+	}
+	// Blocked output is not kept, so it does not count as a message.
+	s.recordRunSummary(ctx, runID, sessionID, domain.RunStatusFailed, "", &domain.RunSummaryError{Code: contentBlockedCode, Message: reason})
+}
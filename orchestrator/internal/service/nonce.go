@@ -0,0 +1,68 @@
+package service
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+
+	"github.com/xiaot623/gogo/orchestrator/internal/domain"
+)
+
+// ErrNonceReused is returned when a nonce is resent for a different tool call
+// or approval than the one it was first used for.
+var ErrNonceReused = errors.New("nonce was already used for a different request")
+
+// ErrNonceInFlight is returned when a nonce is resent while the submission
+// that first used it is still being processed.
+var ErrNonceInFlight = errors.New("a request with this nonce is still in progress")
+
+// claimNonce records nonce for targetID. If the nonce was already used for
+// targetID and that submission finished, its response is returned for the
+// caller to replay. claimed is false when there is nothing to release
+// afterwards: the nonce is empty, nonces are ignored (NONCE_TTL_MS=0), or
+// the request is a replay.
+func (s *Service) claimNonce(ctx context.Context, kind domain.NonceKind, nonce, targetID string) (claimed bool, replay json.RawMessage, err error) {
+	if nonce == "" || s.config.NonceTTL <= 0 {
+		return false, nil, nil
+	}
+	now := s.clock.Now()
+	existing, err := s.store.ClaimNonce(ctx, &domain.RequestNonce{
+		Kind:      kind,
+		Nonce:     nonce,
+		TargetID:  targetID,
+		CreatedAt: now,
+		ExpiresAt: now.Add(s.config.NonceTTL),
+	})
+	if err != nil {
+		return false, nil, fmt.Errorf("failed to claim nonce: %w", err)
+	}
+	if existing == nil {
+		return true, nil, nil
+	}
+	if existing.TargetID != targetID {
+		return false, nil, ErrNonceReused
+	}
+	if existing.Response == nil {
+		return false, nil, ErrNonceInFlight
+	}
+	return false, existing.Response, nil
+}
+
+// finishNonce stores response for replays of a claimed nonce, or releases the
+// nonce when the submission failed so that it can be retried.
+func (s *Service) finishNonce(ctx context.Context, kind domain.NonceKind, nonce string, response any, failed error) {
+	if failed != nil {
+		if err := s.store.DeleteNonce(ctx, kind, nonce); err != nil {
+			s.logger.WarnContext(ctx, "failed to release nonce", "kind", kind, "error", err)
+		}
+		return
+	}
+	data, err := json.Marshal(response)
+	if err == nil {
+		err = s.store.SaveNonceResponse(ctx, kind, nonce, data)
+	}
+	if err != nil {
+		s.logger.WarnContext(ctx, "failed to save nonce response", "kind", kind, "error", err)
+	}
+}
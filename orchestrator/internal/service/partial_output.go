@@ -0,0 +1,104 @@
+package service
+
+import (
+	"context"
+	"encoding/json"
+	"strings"
+	"sync"
+	"unicode/utf8"
+
+	"github.com/xiaot623/gogo/orchestrator/internal/domain"
+)
+
+// partialOutput accumulates the answer text a run's agent streams, so text
+// generated before the run is cancelled or fails is not lost with it. It
+// keeps at most max bytes. take freezes it: text streamed afterwards (while
+// the stream winds down) is ignored, so the text recorded on the run's
+// terminal event matches the partial message saved for it.
+type partialOutput struct {
+	mu        sync.Mutex
+	text      strings.Builder
+	max       int
+	truncated bool
+	frozen    bool
+}
+
+func (p *partialOutput) add(text string) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.frozen || p.truncated {
+		return
+	}
+	if room := p.max - p.text.Len(); len(text) > room {
+		// Cut on a rune boundary so the kept text stays valid UTF-8.
+		for room > 0 && !utf8.RuneStart(text[room]) {
+			room--
+		}
+		text = text[:room]
+		p.truncated = true
+	}
+	p.text.WriteString(text)
+}
+
+// take freezes the output and returns its text and whether it was cut short
+// at max bytes.
+func (p *partialOutput) take() (string, bool) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.frozen = true
+	return p.text.String(), p.truncated
+}
+
+// trackPartialOutput starts accumulating a run's streamed text, returning
+// nil when PartialOutputMaxBytes disables it. The returned function stops
+// tracking.
+func (s *Service) trackPartialOutput(runID string) (*partialOutput, func()) {
+	if s.config.PartialOutputMaxBytes <= 0 {
+		return nil, func() {}
+	}
+	p := &partialOutput{max: s.config.PartialOutputMaxBytes}
+	s.partials.Store(runID, p)
+	return p, func() { s.partials.Delete(runID) }
+}
+
+// takePartialOutput freezes a live run's partial output and returns its
+// text, or "" when the run has no agent stream or streamed no text. It is
+// called before stopping a run's stream so the text is recorded on the
+// run's terminal event.
+func (s *Service) takePartialOutput(runID string) string {
+	p, ok := s.partials.Load(runID)
+	if !ok {
+		return ""
+	}
+	text, _ := p.(*partialOutput).take()
+	return text
+}
+
+// savePartialMessage saves the text a run streamed before it was cancelled
+// or failed as an assistant message flagged partial in its metadata.
+func (s *Service) savePartialMessage(ctx context.Context, runID, sessionID string, p *partialOutput) {
+	if p == nil {
+		return
+	}
+	text, truncated := p.take()
+	if text == "" || s.runEphemeral(ctx, runID) {
+		return
+	}
+	metadata := map[string]bool{"partial": true}
+	if truncated {
+		metadata["truncated"] = true
+	}
+	metadataBytes, _ := json.Marshal(metadata)
+	msg := &domain.Message{
+		MessageID: s.ids.New("msg"),
+		SessionID: sessionID,
+		RunID:     runID,
+		Role:      "assistant",
+		Content:   text,
+		CreatedAt: s.clock.Now(),
+		Metadata:  metadataBytes,
+	}
+	if err := s.store.CreateMessage(ctx, msg); err != nil {
+		s.logger.ErrorContext(ctx, "failed to save partial assistant message", "run_id", runID, "error", err)
+	}
+}
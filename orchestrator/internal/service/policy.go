@@ -0,0 +1,95 @@
+package service
+
+import (
+	"context"
+	"encoding/json"
+
+	"github.com/xiaot623/gogo/orchestrator/internal/config"
+	"github.com/xiaot623/gogo/orchestrator/internal/domain"
+)
+
+// policyErrorReason is the reason given for a decision taken because the
+// policy failed to evaluate.
+const policyErrorReason = "policy_error"
+
+// PolicyStats reports tool calls decided by POLICY_FAIL_MODE because their
+// policy evaluation failed, by the decision taken.
+type PolicyStats struct {
+	ErrorsAllowed int64
+	ErrorsBlocked int64
+}
+
+// policyInput builds the OPA input document for a tool invocation. client is
+// the calling client's metadata, exposed as input.client when present.
+func policyInput(toolName, userID string, client map[string]string, args json.RawMessage) map[string]interface{} {
+	input := map[string]interface{}{
+		"tool_name": toolName,
+		"user_id":   userID,
+	}
+	if len(client) > 0 {
+		input["client"] = client
+	}
+	var argsMap map[string]interface{}
+	if len(args) > 0 {
+		if err := json.Unmarshal(args, &argsMap); err == nil {
+			input["args"] = argsMap
+		}
+	} else {
+		input["args"] = map[string]interface{}{}
+	}
+	return input
+}
+
+// policyFailDecision is the decision for a tool call whose policy
+// evaluation failed: block unless the policy_fail_open flag is on.
+func (s *Service) policyFailDecision() string {
+	if s.flag(config.FlagPolicyFailOpen) {
+		return "allow"
+	}
+	return "block"
+}
+
+// evaluateToolPolicy returns the policy decision for a tool call. If the
+// policy fails to evaluate, the decision falls back to policyFailDecision
+// with reason policy_error and evalErr describes the failure.
+func (s *Service) evaluateToolPolicy(ctx context.Context, toolName, runID string, input map[string]interface{}) (decision, reason string, evalErr error) {
+	decision, reason, err := s.policyEngine.Evaluate(ctx, input)
+	if err == nil {
+		return decision, reason, nil
+	}
+
+	decision = s.policyFailDecision()
+	if decision == "allow" {
+		s.policyErrorsAllowed.Add(1)
+		s.logger.WarnContext(ctx, "policy evaluation failed; ALLOWING the call because policy_fail_open is on", "tool_name", toolName, "run_id", runID, "error", err)
+	} else {
+		s.policyErrorsBlocked.Add(1)
+		s.logger.ErrorContext(ctx, "policy evaluation failed; blocking the call", "tool_name", toolName, "run_id", runID, "error", err)
+	}
+	return decision, policyErrorReason, err
+}
+
+// PolicyStats reports policy evaluation failures for metrics.
+func (s *Service) PolicyStats() PolicyStats {
+	return PolicyStats{
+		ErrorsAllowed: s.policyErrorsAllowed.Load(),
+		ErrorsBlocked: s.policyErrorsBlocked.Load(),
+	}
+}
+
+// EvaluatePolicy returns the decision a tool call would receive without
+// creating a tool call or recording any events. A policy that fails to
+// evaluate yields the POLICY_FAIL_MODE decision with the error.
+func (s *Service) EvaluatePolicy(ctx context.Context, req domain.PolicyEvaluateRequest) (*domain.PolicyEvaluateResponse, error) {
+	resp := &domain.PolicyEvaluateResponse{PolicyVersion: s.policyEngine.Version()}
+	decision, reason, err := s.policyEngine.Evaluate(ctx, policyInput(req.ToolName, req.UserID, req.Client, req.Args))
+	if err != nil {
+		resp.Decision = s.policyFailDecision()
+		resp.Reason = policyErrorReason
+		resp.Error = err.Error()
+		return resp, nil
+	}
+	resp.Decision = decision
+	resp.Reason = reason
+	return resp, nil
+}
@@ -0,0 +1,91 @@
+package service
+
+import (
+	"context"
+	"encoding/json"
+	"testing"
+	"time"
+
+	"github.com/xiaot623/gogo/orchestrator/internal/adapter/agentclient"
+	"github.com/xiaot623/gogo/orchestrator/internal/adapter/ingress"
+	"github.com/xiaot623/gogo/orchestrator/internal/adapter/llm"
+	"github.com/xiaot623/gogo/orchestrator/internal/config"
+	"github.com/xiaot623/gogo/orchestrator/internal/domain"
+	"github.com/xiaot623/gogo/orchestrator/policy"
+	"github.com/xiaot623/gogo/orchestrator/tests/helpers"
+)
+
+// brokenPolicy compiles but fails every evaluation: the complete rule
+// produces two different values.
+const brokenPolicy = `
+package tool_policy
+
+decision = "allow" { true }
+decision = "block" { true }
+`
+
+func TestInvokeToolPolicyErrorFailMode(t *testing.T) {
+	ctx := context.Background()
+	policyEngine, err := policy.NewEngine(ctx, brokenPolicy)
+	if err != nil {
+		t.Fatalf("NewEngine failed: %v", err)
+	}
+
+	invoke := func(t *testing.T, mode string) (*Service, *domain.ToolInvokeResponse, domain.PolicyDecisionPayload) {
+		t.Helper()
+		db := helpers.NewTestSQLiteStore(t)
+		_, addr := startFakeIngress(t)
+		cfg := &config.Config{ToolTimeout: time.Minute, PolicyFailMode: mode}
+		svc := New(db, agentclient.NewClient(), ingress.NewClient(addr), llm.NewClient("", "", time.Second), cfg, policyEngine)
+
+		if err := db.CreateSession(ctx, &domain.Session{SessionID: "s1", UserID: "u1", CreatedAt: time.Now()}); err != nil {
+			t.Fatalf("CreateSession: %v", err)
+		}
+		if err := db.CreateRun(ctx, &domain.Run{RunID: "r1", SessionID: "s1", RootAgentID: "a1", Status: domain.RunStatusRunning, StartedAt: time.Now()}); err != nil {
+			t.Fatalf("CreateRun: %v", err)
+		}
+		resp, err := svc.InvokeTool(ctx, "browser.screenshot", domain.ToolInvokeRequest{RunID: "r1", Args: json.RawMessage(`{}`)})
+		if err != nil {
+			t.Fatalf("InvokeTool: %v", err)
+		}
+
+		events, err := db.GetEvents(ctx, "r1", 0, 0, []string{string(domain.EventTypePolicyDecision)}, 10)
+		if err != nil {
+			t.Fatalf("GetEvents: %v", err)
+		}
+		if len(events) != 1 {
+			t.Fatalf("expected one policy_decision event, got %d", len(events))
+		}
+		var payload domain.PolicyDecisionPayload
+		if err := json.Unmarshal(events[0].Payload, &payload); err != nil {
+			t.Fatalf("decode payload: %v", err)
+		}
+		return svc, resp, payload
+	}
+
+	t.Run("closed", func(t *testing.T) {
+		svc, resp, payload := invoke(t, config.PolicyFailClosed)
+		if resp.Status != "failed" || resp.Error == nil || resp.Error.Code != "blocked" || resp.Error.Message != "policy_error" {
+			t.Fatalf("expected call blocked with policy_error, got %+v", resp)
+		}
+		if payload.Decision != "block" || payload.Reason != "policy_error" || payload.Error == "" {
+			t.Fatalf("unexpected policy_decision payload: %+v", payload)
+		}
+		if stats := svc.PolicyStats(); stats.ErrorsBlocked != 1 || stats.ErrorsAllowed != 0 {
+			t.Fatalf("unexpected policy stats: %+v", stats)
+		}
+	})
+
+	t.Run("open", func(t *testing.T) {
+		svc, resp, payload := invoke(t, config.PolicyFailOpen)
+		if resp.Status != "pending" || resp.Error != nil {
+			t.Fatalf("expected call allowed, got %+v", resp)
+		}
+		if payload.Decision != "allow" || payload.Reason != "policy_error" || payload.Error == "" {
+			t.Fatalf("unexpected policy_decision payload: %+v", payload)
+		}
+		if stats := svc.PolicyStats(); stats.ErrorsAllowed != 1 || stats.ErrorsBlocked != 0 {
+			t.Fatalf("unexpected policy stats: %+v", stats)
+		}
+	})
+}
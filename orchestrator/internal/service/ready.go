@@ -0,0 +1,24 @@
+package service
+
+import (
+	"context"
+	"errors"
+)
+
+// errNotReady is returned by Ready until MarkReady has been called.
+var errNotReady = errors.New("orchestrator is starting")
+
+// MarkReady records that startup (migrations, connectivity checks, listeners)
+// has completed and the service may receive traffic.
+func (s *Service) MarkReady() {
+	s.ready.Store(true)
+}
+
+// Ready reports whether the service can serve traffic: startup must have
+// completed and the store must still be reachable.
+func (s *Service) Ready(ctx context.Context) error {
+	if !s.ready.Load() {
+		return errNotReady
+	}
+	return s.store.Ping(ctx)
+}
@@ -3,27 +3,70 @@ package service
 import (
 	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
-	"log"
 	"time"
 
-	"github.com/google/uuid"
 	"github.com/xiaot623/gogo/orchestrator/internal/adapter/agentclient"
+	"github.com/xiaot623/gogo/orchestrator/internal/config"
 	"github.com/xiaot623/gogo/orchestrator/internal/domain"
+	"github.com/xiaot623/gogo/orchestrator/internal/telemetry"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
 )
 
-// InvokeAgent handles the agent invocation logic.
+// InvokeAgent handles the agent invocation logic. It fails with
+// ErrMaintenance while read-only.
 func (s *Service) InvokeAgent(ctx context.Context, req domain.InvokeRequest) (*domain.InvokeResponse, error) {
+	ctx, span := telemetry.Tracer().Start(ctx, "InvokeAgent")
+	defer span.End()
+	span.SetAttributes(attribute.String("session_id", req.SessionID), attribute.String("agent_id", req.AgentID))
+
+	if err := s.checkWritable(); err != nil {
+		return nil, err
+	}
+
 	// Validate required fields
 	if req.SessionID == "" {
 		return nil, fmt.Errorf("session_id is required")
 	}
+	if req.AgentID == "" {
+		req.AgentID = s.config.DefaultAgentID
+	}
 	if req.AgentID == "" {
 		return nil, fmt.Errorf("agent_id is required")
 	}
 	if req.InputMessage.Content == "" {
 		return nil, fmt.Errorf("input_message.content is required")
 	}
+	tags, err := normalizeRunTags(req.Tags)
+	if err != nil {
+		return nil, err
+	}
+	if req.MaxHistory != nil && *req.MaxHistory < -1 {
+		return nil, fmt.Errorf("max_history must be -1 (all), 0 (none) or positive")
+	}
+	if req.MaxDurationMs < 0 {
+		return nil, fmt.Errorf("max_duration_ms must not be negative")
+	}
+	if req.Priority == "" {
+		req.Priority = domain.RunPriorityNormal
+	}
+	if !req.Priority.Valid() {
+		return nil, fmt.Errorf("priority must be high, normal or low")
+	}
+
+	// A resent invoke (same session and request_id, e.g. after a reconnect)
+	// gets the run it already started instead of a new one.
+	if req.RequestID != "" {
+		existing, err := s.store.GetRunByRequestID(ctx, req.SessionID, req.RequestID)
+		if err != nil {
+			return nil, fmt.Errorf("failed to get run by request_id: %w", err)
+		}
+		if existing != nil {
+			return duplicateInvokeResponse(existing), nil
+		}
+	}
 
 	// Get or create session
 	userID := "default_user" // In M0, we use a default user
@@ -36,32 +79,84 @@ func (s *Service) InvokeAgent(ctx context.Context, req domain.InvokeRequest) (*d
 	if err != nil {
 		return nil, fmt.Errorf("failed to get/create session: %w", err)
 	}
+	clientMeta := clientMetaFromContext(req.Context)
+	s.rememberClientMeta(ctx, session, clientMeta)
+	ephemeral, err := s.resolveEphemeral(ctx, session, req.Context)
+	if err != nil {
+		return nil, err
+	}
+	if s.ingressClient != nil {
+		// A new invoke means a client is back for the session.
+		s.ingressClient.AttachSession(req.SessionID)
+	}
 
-	// Get agent endpoint
-	agent, err := s.store.GetAgent(ctx, req.AgentID)
+	// Get agent endpoint (possibly falling back to the default agent)
+	agent, err := s.resolveAgent(ctx, req.AgentID)
 	if err != nil {
-		return nil, fmt.Errorf("failed to get agent: %w", err)
+		return nil, err
 	}
-	if agent == nil {
-		return nil, fmt.Errorf("agent %s not found", req.AgentID)
+	requestedAgentID := req.AgentID
+	fallback := agent.AgentID != requestedAgentID
+	if fallback {
+		s.logger.WarnContext(ctx, "agent unavailable, falling back to default agent", "agent_id", requestedAgentID, "fallback_agent_id", agent.AgentID, "session_id", req.SessionID)
+		req.AgentID = agent.AgentID
 	}
 
+	// Reserve an agent stream slot (or queue position) before creating the run
+	ticket, err := s.streams.admit(req.Priority)
+	if err != nil {
+		s.logger.WarnContext(ctx, "rejecting invoke", "session_id", req.SessionID, "priority", req.Priority, "error", err)
+		return nil, err
+	}
+	started := false
+	defer func() {
+		if !started {
+			ticket.release()
+		}
+	}()
+
 	// Create run
-	runID := "run_" + uuid.New().String()[:8]
-	now := time.Now()
+	runID := s.ids.New("run")
+	now := s.clock.Now()
 	run := &domain.Run{
 		RunID:       runID,
 		SessionID:   session.SessionID,
 		RootAgentID: req.AgentID,
 		Status:      domain.RunStatusCreated,
 		StartedAt:   now,
+		Tags:        tags,
+		RequestID:   req.RequestID,
+		DeadlineAt:  s.runDeadline(req, now),
+		Priority:    req.Priority,
 	}
-	if err := s.store.CreateRun(ctx, run); err != nil {
+	existing, err := s.store.CreateRunIdempotent(ctx, run)
+	if err != nil {
 		return nil, fmt.Errorf("failed to create run: %w", err)
 	}
+	if existing != nil {
+		// A concurrent invoke with the same request_id won the insert.
+		return duplicateInvokeResponse(existing), nil
+	}
+	s.ephemeralRuns.Store(runID, ephemeral)
+	logger := s.logger.With("run_id", runID, "session_id", session.SessionID)
+	span.SetAttributes(attribute.String("run_id", runID), attribute.String("agent_id", req.AgentID))
+
+	resp := &domain.InvokeResponse{
+		RunID:     runID,
+		SessionID: session.SessionID,
+		AgentID:   req.AgentID,
+		Tags:      tags,
+	}
+	if fallback {
+		resp.RequestedAgentID = requestedAgentID
+		resp.Fallback = true
+	}
+
+	// Blocked input is neither saved nor sent to the agent
+	allowed, blockReason := s.moderate(ctx, "user", req.InputMessage.Content)
 
 	// Save user input message
-	msgID := "msg_" + uuid.New().String()[:8]
+	msgID := s.ids.New("msg")
 	userMsg := &domain.Message{
 		MessageID: msgID,
 		SessionID: session.SessionID,
@@ -70,9 +165,11 @@ func (s *Service) InvokeAgent(ctx context.Context, req domain.InvokeRequest) (*d
 		Content:   req.InputMessage.Content,
 		CreatedAt: now,
 	}
-	if err := s.store.CreateMessage(ctx, userMsg); err != nil {
-		log.Printf("ERROR: failed to save user message: %v", err)
-		// Continue anyway - message storage failure shouldn't block the run
+	if !ephemeral && allowed { // ephemeral sessions keep no transcript
+		if err := s.store.CreateMessage(ctx, userMsg); err != nil {
+			logger.ErrorContext(ctx, "failed to save user message", "error", err)
+			// Continue anyway - message storage failure shouldn't block the run
+		}
 	}
 
 	// Record run_started event
@@ -80,8 +177,19 @@ func (s *Service) InvokeAgent(ctx context.Context, req domain.InvokeRequest) (*d
 		RequestID: req.RequestID,
 		SessionID: session.SessionID,
 		AgentID:   req.AgentID,
+		Tags:      tags,
+		Client:    clientMeta,
+		Priority:  req.Priority,
 	}); err != nil {
-		log.Printf("ERROR: failed to record run_started event: %v", err)
+		logger.ErrorContext(ctx, "failed to record run_started event", "error", err)
+	}
+
+	if !allowed {
+		logger.WarnContext(ctx, "user input blocked by moderation", "reason", blockReason)
+		s.failContentBlocked(ctx, runID, session.SessionID, blockReason)
+		s.forgetEventSeq(runID)
+		s.forgetRunEphemeral(runID)
+		return resp, nil
 	}
 
 	// Record user_input event
@@ -89,88 +197,197 @@ func (s *Service) InvokeAgent(ctx context.Context, req domain.InvokeRequest) (*d
 		MessageID: msgID,
 		Content:   req.InputMessage.Content,
 	}); err != nil {
-		log.Printf("ERROR: failed to record user_input event: %v", err)
+		logger.ErrorContext(ctx, "failed to record user_input event", "error", err)
 	}
 
 	// Update run status to RUNNING
 	if err := s.store.UpdateRunStatus(ctx, runID, domain.RunStatusRunning); err != nil {
-		log.Printf("ERROR: failed to update run status: %v", err)
+		logger.ErrorContext(ctx, "failed to update run status", "error", err)
 	}
 
 	// Get conversation history
-	messages, err := s.store.GetMessages(ctx, session.SessionID, 50, "")
-	if err != nil {
-		log.Printf("WARN: failed to get messages: %v", err)
-		messages = []domain.Message{}
+	var messages []domain.Message
+	if window := s.historyWindow(req); window != 0 && agent.RequestFilter.SendsHistory() {
+		messages, err = s.store.GetRecentMessages(ctx, session.SessionID, window)
+		if err != nil {
+			logger.WarnContext(ctx, "failed to get messages", "error", err)
+			messages = []domain.Message{}
+		}
+		model := req.AgentID
+		if agent.LLM != nil {
+			model = agent.LLM.Model
+		}
+		messages = s.trimHistoryToTokens(model, messages)
 	}
 
 	// Prepare agent invoke request
 	agentReq := &domain.AgentInvokeRequest{
-		AgentID:      req.AgentID,
-		SessionID:    session.SessionID,
-		RunID:        runID,
-		InputMessage: req.InputMessage,
-		Messages:     messages,
-		Context:      req.Context,
+		AgentID:        req.AgentID,
+		SessionID:      session.SessionID,
+		RunID:          runID,
+		InputMessage:   req.InputMessage,
+		Messages:       messages,
+		Context:        agent.RequestFilter.FilterContext(req.Context),
+		Headers:        agent.Headers,
+		Protocol:       agent.Protocol,
+		ResponseFormat: agent.ResponseFormat,
+		LLM:            agent.LLM,
 	}
 
 	// Record agent_invoke_started event
-	if err := s.recordEvent(ctx, runID, domain.EventTypeAgentInvokeStarted, map[string]interface{}{
+	invokeStarted := map[string]interface{}{
 		"agent_id": req.AgentID,
 		"endpoint": agent.Endpoint,
-	}); err != nil {
-		log.Printf("ERROR: failed to record agent_invoke_started event: %v", err)
+	}
+	if fallback {
+		invokeStarted["requested_agent_id"] = requestedAgentID
+	}
+	if len(agent.Headers) > 0 {
+		invokeStarted["headers"] = agentclient.RedactHeaders(agent.Headers)
+	}
+	if agent.Protocol != "" {
+		invokeStarted["protocol"] = agent.Protocol
+	}
+	if agent.ResponseFormat != "" {
+		invokeStarted["response_format"] = agent.ResponseFormat
+	}
+	if agent.LLM != nil {
+		invokeStarted["model"] = agent.LLM.Model
+	}
+	if err := s.recordEvent(ctx, runID, domain.EventTypeAgentInvokeStarted, invokeStarted); err != nil {
+		logger.ErrorContext(ctx, "failed to record agent_invoke_started event", "error", err)
 	}
 
 	// Trigger async processing
-	go s.processAgentStream(runID, session.SessionID, agent.Endpoint, agentReq)
+	started = true
+	go s.runAgentStream(telemetry.Detach(ctx), ticket, runID, session.SessionID, agent.Endpoint, agentReq)
+	return resp, nil
+}
 
-	return &domain.InvokeResponse{
-		RunID:     runID,
-		SessionID: session.SessionID,
-		AgentID:   req.AgentID,
-	}, nil
+// historyWindow is how many of the session's most recent messages, including
+// the new input, are sent to the agent: the request's MaxHistory if set, else
+// MaxHistoryMessages. 0 sends none and -1 sends all.
+func (s *Service) historyWindow(req domain.InvokeRequest) int {
+	if req.MaxHistory != nil {
+		return *req.MaxHistory
+	}
+	return s.config.MaxHistoryMessages
+}
+
+// runAgentStream waits for the ticket's stream slot, then processes the agent
+// stream. The run can be cancelled or shed while queued, or cancelled while
+// streaming; either way the slot is released when this returns.
+func (s *Service) runAgentStream(parent context.Context, ticket *streamTicket, runID, sessionID, endpoint string, req *domain.AgentInvokeRequest) {
+	defer ticket.release()
+	defer s.forgetEventSeq(runID)
+	defer s.forgetRunEphemeral(runID)
+
+	ctx, cancel := context.WithCancel(parent)
+	defer cancel()
+	defer s.trackRunCancel(runID, cancel)()
+
+	if err := ticket.wait(ctx); err != nil {
+		if errors.Is(err, ErrAgentCapacity) {
+			s.failShedRun(ctx, runID, sessionID)
+			return
+		}
+		s.logger.InfoContext(ctx, "run cancelled while waiting for an agent stream slot", "run_id", runID, "session_id", sessionID)
+		return
+	}
+	s.processAgentStream(ctx, runID, sessionID, endpoint, req)
 }
 
-func (s *Service) processAgentStream(runID, sessionID, endpoint string, req *domain.AgentInvokeRequest) {
-	ctx, cancel := context.WithTimeout(context.Background(), s.config.AgentTimeout)
+func (s *Service) processAgentStream(parent context.Context, runID, sessionID, endpoint string, req *domain.AgentInvokeRequest) {
+	logger := s.logger.With("run_id", runID, "session_id", sessionID)
+
+	ctx, cancel := context.WithTimeout(parent, s.config.AgentTimeout)
 	defer cancel()
 
+	ctx, span := telemetry.Tracer().Start(ctx, "processAgentStream")
+	defer span.End()
+	span.SetAttributes(attribute.String("run_id", runID), attribute.String("agent_id", req.AgentID))
+
 	var finalMessage string
 	var usage *domain.UsageData
+	// agentErr is the error the agent reported, if it did.
+	var agentErr *domain.RunSummaryError
+	deltaCount := 0
+	status := domain.RunStatusDone
+	defer func() {
+		span.SetAttributes(attribute.Int("delta_count", deltaCount), attribute.String("status", string(status)))
+	}()
+
+	// Deltas and reasoning are batched; every other event flushes them first
+	// to keep order.
+	deltas := s.newDeltaBatcher(ctx, runID, sessionID)
+	defer deltas.close()
+	reasoning := s.newReasoningBatcher(ctx, runID, sessionID)
+	defer reasoning.close()
+
+	// Streamed tool call args are assembled until their tool_call event.
+	toolCalls := newToolCallAssembler()
+
+	// The streamed answer text is kept so a cancelled or failed run can
+	// still save what was generated.
+	partial, stopPartial := s.trackPartialOutput(runID)
+	defer stopPartial()
+
+	// Quiet stretches of the stream get heartbeats until it ends.
+	stopHeartbeat := s.startRunHeartbeat(ctx, runID, sessionID)
+	defer stopHeartbeat()
+
+	// Built-in agents run here and report the same events an external agent
+	// streams.
+	invoke := s.agentClient.Invoke
+	if req.Protocol.Builtin() {
+		invoke = s.invokeLLMToolsAgent
+	}
+	err := invoke(ctx, endpoint, req, func(event agentclient.SSEEvent) error {
+		nowMs := s.clock.Now().UnixMilli()
 
-	err := s.agentClient.Invoke(ctx, endpoint, req, func(event agentclient.SSEEvent) error {
-		nowMs := time.Now().UnixMilli()
+		if event.Event != "delta" {
+			deltas.flush()
+		}
+		if event.Event != "reasoning" {
+			reasoning.flush()
+		}
 
 		switch event.Event {
 		case "delta":
 			delta, err := agentclient.ParseDeltaEvent(event.Data)
 			if err != nil {
-				log.Printf("WARN: failed to parse delta event: %v", err)
+				logger.WarnContext(ctx, "failed to parse delta event", "error", err)
 				return nil
 			}
+			if s.config.ModerateDeltas {
+				if allowed, reason := s.moderate(ctx, "assistant", delta.Text); !allowed {
+					return &contentBlockedError{reason: reason}
+				}
+			}
 
-			// Record event
-			if err := s.recordEvent(ctx, runID, domain.EventTypeAgentStreamDelta, domain.AgentStreamDeltaPayload{
-				Text: delta.Text,
-			}); err != nil {
-				log.Printf("ERROR: failed to record delta event: %v", err)
+			// Record and push (batched)
+			deltaCount++
+			deltas.add(delta.Text)
+			if partial != nil {
+				partial.add(delta.Text)
 			}
 
-			// Push to ingress
-			if s.ingressClient != nil {
-				s.ingressClient.PushEvent(sessionID, map[string]interface{}{
-					"type":   "delta",
-					"ts":     nowMs,
-					"run_id": runID,
-					"text":   delta.Text,
-				})
+		case "reasoning":
+			// Reasoning never becomes part of the assistant message.
+			if !s.flag(config.FlagCaptureReasoning) {
+				return nil
 			}
+			delta, err := agentclient.ParseDeltaEvent(event.Data)
+			if err != nil {
+				logger.WarnContext(ctx, "failed to parse reasoning event", "error", err)
+				return nil
+			}
+			reasoning.add(delta.Text)
 
 		case "done":
 			done, err := agentclient.ParseDoneEvent(event.Data)
 			if err != nil {
-				log.Printf("WARN: failed to parse done event: %v", err)
+				logger.WarnContext(ctx, "failed to parse done event", "error", err)
 				return nil
 			}
 			finalMessage = done.FinalMessage
@@ -179,72 +396,165 @@ func (s *Service) processAgentStream(runID, sessionID, endpoint string, req *dom
 		case "error":
 			errEvt, err := agentclient.ParseErrorEvent(event.Data)
 			if err != nil {
-				log.Printf("WARN: failed to parse error event: %v", err)
+				logger.WarnContext(ctx, "failed to parse error event", "error", err)
 				return nil
 			}
+			agentErr = &domain.RunSummaryError{Code: errEvt.Code, Message: errEvt.Message}
 
 			// Record run_failed event
-			if err := s.recordEvent(ctx, runID, domain.EventTypeRunFailed, domain.RunFailedPayload{
-				Code:    errEvt.Code,
-				Message: errEvt.Message,
-			}); err != nil {
-				log.Printf("ERROR: failed to record run_failed event: %v", err)
+			eventID, err := s.recordEventID(ctx, runID, domain.EventTypeRunFailed, domain.RunFailedPayload{
+				Code:           errEvt.Code,
+				Message:        errEvt.Message,
+				PartialMessage: s.takePartialOutput(runID),
+			})
+			if err != nil {
+				logger.ErrorContext(ctx, "failed to record run_failed event", "error", err)
 			}
 
 			// Update run status
 			errData, _ := json.Marshal(errEvt)
 			if err := s.store.UpdateRunCompleted(ctx, runID, domain.RunStatusFailed, errData); err != nil {
-				log.Printf("ERROR: failed to update run status: %v", err)
+				logger.ErrorContext(ctx, "failed to update run status", "error", err)
 			}
 
 			// Push error to ingress
 			if s.ingressClient != nil {
 				s.ingressClient.PushEvent(sessionID, map[string]interface{}{
-					"type":    "error",
-					"ts":      nowMs,
-					"run_id":  runID,
-					"code":    errEvt.Code,
-					"message": errEvt.Message,
+					"type":     "error",
+					"ts":       nowMs,
+					"run_id":   runID,
+					"event_id": eventID,
+					"code":     errEvt.Code,
+					"message":  errEvt.Message,
 				})
 			}
 
 			return fmt.Errorf("agent error: %s", errEvt.Message)
 
+		case "tool_call_delta":
+			delta, err := agentclient.ParseToolCallDeltaEvent(event.Data)
+			if err != nil {
+				logger.WarnContext(ctx, "failed to parse tool_call_delta event", "error", err)
+				return nil
+			}
+			name := toolCalls.add(delta)
+			s.recordToolCallDelta(ctx, runID, sessionID, delta, name)
+
+		case "tool_call":
+			call, err := agentclient.ParseToolCallEvent(event.Data)
+			if err != nil {
+				logger.WarnContext(ctx, "failed to parse tool_call event", "error", err)
+				return nil
+			}
+			name, args := toolCalls.finish(call)
+			s.dispatchStreamedToolCall(ctx, runID, call.ToolCallID, name, args)
+
 		case "state":
-			// Record state change
-			log.Printf("INFO: state event: %s", event.Data)
+			state, err := agentclient.ParseStateEvent(event.Data)
+			if err != nil {
+				logger.WarnContext(ctx, "failed to parse state event", "error", err)
+				return nil
+			}
+
+			eventID, err := s.recordEventID(ctx, runID, domain.EventTypeAgentState, domain.AgentStatePayload{
+				State:  state.State,
+				Detail: state.Detail,
+			})
+			if err != nil {
+				logger.ErrorContext(ctx, "failed to record agent_state event", "error", err)
+			}
+
+			if s.ingressClient != nil {
+				s.ingressClient.PushEvent(sessionID, map[string]interface{}{
+					"type":     "state",
+					"ts":       nowMs,
+					"run_id":   runID,
+					"event_id": eventID,
+					"state":    state.State,
+					"detail":   state.Detail,
+				})
+			}
 		}
 
 		return nil
 	})
+	stopHeartbeat()
+	deltas.flush()
+	reasoning.flush()
+	if ids := toolCalls.pending(); len(ids) > 0 {
+		logger.WarnContext(ctx, "agent stream ended with unfinished tool calls", "agent_tool_call_ids", ids)
+	}
 
-	nowMs := time.Now().UnixMilli()
+	nowMs := s.clock.Now().UnixMilli()
 
+	if err != nil && errors.Is(parent.Err(), context.Canceled) {
+		// Cancelled via CancelRun, which already recorded the outcome.
+		logger.InfoContext(ctx, "agent stream cancelled")
+		status = domain.RunStatusCancelled
+		s.savePartialMessage(telemetry.Detach(ctx), runID, sessionID, partial)
+		return
+	}
+	var blocked *contentBlockedError
+	if errors.As(err, &blocked) {
+		logger.WarnContext(ctx, "assistant output blocked by moderation", "reason", blocked.reason)
+		status = domain.RunStatusFailed
+		s.recordRunUsage(ctx, runID, usage)
+		s.failContentBlocked(ctx, runID, sessionID, blocked.reason)
+		return
+	}
 	if err != nil {
-		log.Printf("ERROR: agent invocation failed: %v", err)
+		logger.ErrorContext(ctx, "agent invocation failed", "agent_id", req.AgentID, "error", err)
+		if agentUnavailable(err) {
+			s.recordAgentFailure(telemetry.Detach(ctx), req.AgentID, err)
+		}
+		status = domain.RunStatusFailed
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
 
 		// Record run_failed if not already done
-		if err := s.recordEvent(ctx, runID, domain.EventTypeRunFailed, domain.RunFailedPayload{
-			Code:    "agent_error",
-			Message: err.Error(),
-		}); err != nil {
-			log.Printf("ERROR: failed to record run_failed event: %v", err)
+		code := agentErrorCode(err)
+		partialMessage := s.takePartialOutput(runID)
+		eventID, recordErr := s.recordEventID(ctx, runID, domain.EventTypeRunFailed, domain.RunFailedPayload{
+			Code:           code,
+			Message:        err.Error(),
+			PartialMessage: partialMessage,
+		})
+		if recordErr != nil {
+			logger.ErrorContext(ctx, "failed to record run_failed event", "error", recordErr)
 		}
 
-		errData, _ := json.Marshal(map[string]string{"code": "agent_error", "message": err.Error()})
+		errData, _ := json.Marshal(map[string]string{"code": code, "message": err.Error()})
 		if err := s.store.UpdateRunCompleted(ctx, runID, domain.RunStatusFailed, errData); err != nil {
-			log.Printf("ERROR: failed to update run status: %v", err)
+			logger.ErrorContext(ctx, "failed to update run status", "error", err)
 		}
+		s.recordRunUsage(ctx, runID, usage)
+		s.savePartialMessage(telemetry.Detach(ctx), runID, sessionID, partial)
 
 		if s.ingressClient != nil {
 			s.ingressClient.PushEvent(sessionID, map[string]interface{}{
-				"type":    "error",
-				"ts":      nowMs,
-				"run_id":  runID,
-				"code":    "agent_error",
-				"message": err.Error(),
+				"type":     "error",
+				"ts":       nowMs,
+				"run_id":   runID,
+				"event_id": eventID,
+				"code":     code,
+				"message":  err.Error(),
 			})
 		}
+		if agentErr == nil {
+			agentErr = &domain.RunSummaryError{Code: code, Message: err.Error()}
+		}
+		s.recordRunSummary(ctx, runID, sessionID, domain.RunStatusFailed, partialMessage, agentErr)
+		return
+	}
+
+	s.recordAgentSuccess(ctx, req.AgentID)
+
+	// Blocked output is not saved as the assistant message
+	if allowed, reason := s.moderate(ctx, "assistant", finalMessage); !allowed {
+		logger.WarnContext(ctx, "assistant output blocked by moderation", "reason", reason)
+		status = domain.RunStatusFailed
+		s.recordRunUsage(ctx, runID, usage)
+		s.failContentBlocked(ctx, runID, sessionID, reason)
 		return
 	}
 
@@ -253,42 +563,47 @@ func (s *Service) processAgentStream(runID, sessionID, endpoint string, req *dom
 		"final_message": finalMessage,
 		"usage":         usage,
 	}); err != nil {
-		log.Printf("ERROR: failed to record agent_invoke_done event: %v", err)
+		logger.ErrorContext(ctx, "failed to record agent_invoke_done event", "error", err)
 	}
 
 	// Save assistant message
-	if finalMessage != "" {
+	if finalMessage != "" && !s.runEphemeral(ctx, runID) {
 		assistantMsg := &domain.Message{
-			MessageID: "msg_" + uuid.New().String()[:8],
+			MessageID: s.ids.New("msg"),
 			SessionID: sessionID,
 			RunID:     runID,
 			Role:      "assistant",
 			Content:   finalMessage,
-			CreatedAt: time.Now(),
+			CreatedAt: s.clock.Now(),
 		}
 		if err := s.store.CreateMessage(ctx, assistantMsg); err != nil {
-			log.Printf("ERROR: failed to save assistant message: %v", err)
+			logger.ErrorContext(ctx, "failed to save assistant message", "error", err)
 		}
 	}
 
 	// Record run_done event
-	if err := s.recordEvent(ctx, runID, domain.EventTypeRunDone, domain.RunDonePayload{
+	llmUsage, totalTokens := s.recordRunUsage(ctx, runID, usage)
+	doneEventID, err := s.recordEventID(ctx, runID, domain.EventTypeRunDone, domain.RunDonePayload{
 		Usage:        usage,
+		LLMUsage:     llmUsage,
+		TotalTokens:  totalTokens,
 		FinalMessage: finalMessage,
-	}); err != nil {
-		log.Printf("ERROR: failed to record run_done event: %v", err)
+	})
+	if err != nil {
+		logger.ErrorContext(ctx, "failed to record run_done event", "error", err)
 	}
 
 	// Update run status
 	if err := s.store.UpdateRunCompleted(ctx, runID, domain.RunStatusDone, nil); err != nil {
-		log.Printf("ERROR: failed to update run status: %v", err)
+		logger.ErrorContext(ctx, "failed to update run status", "error", err)
 	}
 
 	// Push done to ingress
 	doneEvent := map[string]interface{}{
-		"type":   "done",
-		"ts":     nowMs,
-		"run_id": runID,
+		"type":     "done",
+		"ts":       nowMs,
+		"run_id":   runID,
+		"event_id": doneEventID,
 	}
 	if usage != nil {
 		doneEvent["usage"] = usage
@@ -296,6 +611,38 @@ func (s *Service) processAgentStream(runID, sessionID, endpoint string, req *dom
 	if s.ingressClient != nil {
 		s.ingressClient.PushEvent(sessionID, doneEvent)
 	}
+	s.recordRunSummary(ctx, runID, sessionID, domain.RunStatusDone, finalMessage, nil)
+}
+
+// recordRunUsage aggregates the run's proxied LLM usage and stores the run's
+// total token count. The measured LLM total is authoritative; the agent's
+// self-reported usage is only used when no LLM calls went through the proxy.
+func (s *Service) recordRunUsage(ctx context.Context, runID string, reported *domain.UsageData) (*domain.LLMUsage, int) {
+	llmUsage, err := s.store.SumLLMUsage(ctx, runID)
+	if err != nil {
+		s.logger.WarnContext(ctx, "failed to aggregate LLM usage", "run_id", runID, "error", err)
+		llmUsage = nil
+	}
+
+	total := 0
+	switch {
+	case llmUsage != nil && llmUsage.Calls > 0:
+		total = llmUsage.TotalTokens
+	case reported != nil && reported.TotalTokens > 0:
+		total = reported.TotalTokens
+	case reported != nil:
+		total = reported.Tokens
+	}
+	if llmUsage != nil && llmUsage.Calls == 0 {
+		llmUsage = nil
+	}
+
+	if total > 0 {
+		if err := s.store.UpdateRunTotalTokens(ctx, runID, total); err != nil {
+			s.logger.ErrorContext(ctx, "failed to update run total tokens", "run_id", runID, "error", err)
+		}
+	}
+	return llmUsage, total
 }
 
 func isTerminalRunStatus(status domain.RunStatus) bool {
@@ -306,7 +653,10 @@ func isTerminalRunStatus(status domain.RunStatus) bool {
 	return false
 }
 
-func (s *Service) CancelRun(ctx context.Context, runID string) error {
+// CancelRun cancels a run that has not finished, recording req's reason and
+// decider on the run_cancelled event and as the run's error. A run that
+// already finished is left as is.
+func (s *Service) CancelRun(ctx context.Context, runID string, req domain.CancelRunRequest) error {
 	run, err := s.store.GetRun(ctx, runID)
 	if err != nil {
 		return fmt.Errorf("failed to get run: %w", err)
@@ -319,17 +669,56 @@ func (s *Service) CancelRun(ctx context.Context, runID string) error {
 		return nil // Already terminal
 	}
 
-	if err := s.store.UpdateRunCompleted(ctx, runID, domain.RunStatusCancelled, nil); err != nil {
+	cancelled := domain.RunCancelledPayload{Reason: req.Reason, DecidedBy: req.DecidedBy}
+	if cancelled.DecidedBy == "" {
+		cancelled.DecidedBy = "user"
+	}
+	if cancelled.Reason == "" {
+		cancelled.Reason = "cancelled by " + cancelled.DecidedBy
+	}
+	errData, _ := json.Marshal(cancelled)
+
+	if err := s.store.UpdateRunCompleted(ctx, runID, domain.RunStatusCancelled, errData); err != nil {
 		return fmt.Errorf("failed to cancel run: %w", err)
 	}
+	cancelled.PartialMessage = s.takePartialOutput(runID)
+	s.cancelRunStream(runID)
+	go s.notifyAgentCancel(telemetry.Detach(ctx), run, cancelled.Reason)
 
-	s.recordEvent(ctx, runID, domain.EventTypeRunCancelled, map[string]interface{}{
-		"reason": "cancelled by user",
-	})
+	if err := s.recordEvent(ctx, runID, domain.EventTypeRunCancelled, cancelled); err != nil {
+		s.logger.ErrorContext(ctx, "failed to record run_cancelled event", "run_id", runID, "error", err)
+	}
+	s.recordRunSummary(ctx, runID, run.SessionID, domain.RunStatusCancelled, cancelled.PartialMessage, &domain.RunSummaryError{Code: "cancelled", Message: cancelled.Reason})
 
 	return nil
 }
 
+// agentCancelTimeout bounds the best-effort call to an agent's cancel URL.
+const agentCancelTimeout = 10 * time.Second
+
+// notifyAgentCancel POSTs a cancelled run to its agent's cancel URL, if the
+// agent registered one, so it stops generating. Aborting the stream already
+// closes the connection; this reaches agents that keep working regardless.
+// Failures are only logged.
+func (s *Service) notifyAgentCancel(ctx context.Context, run *domain.Run, reason string) {
+	agent, err := s.store.GetAgent(ctx, run.RootAgentID)
+	if err != nil || agent == nil || agent.CancelURL == "" || agent.Protocol.Builtin() {
+		return
+	}
+	ctx, cancel := context.WithTimeout(ctx, agentCancelTimeout)
+	defer cancel()
+	err = s.agentClient.Cancel(ctx, agent.CancelURL, agent.Headers, agentclient.CancelRequest{
+		RunID:     run.RunID,
+		SessionID: run.SessionID,
+		Reason:    reason,
+	})
+	if err != nil {
+		s.logger.WarnContext(ctx, "failed to notify agent of cancelled run", "agent_id", agent.AgentID, "run_id", run.RunID, "error", err)
+		return
+	}
+	s.logger.InfoContext(ctx, "notified agent of cancelled run", "agent_id", agent.AgentID, "run_id", run.RunID)
+}
+
 func (s *Service) GetRun(ctx context.Context, runID string) (*domain.Run, error) {
 	run, err := s.store.GetRun(ctx, runID)
 	if err != nil {
@@ -337,3 +726,15 @@ func (s *Service) GetRun(ctx context.Context, runID string) (*domain.Run, error)
 	}
 	return run, nil
 }
+
+// duplicateInvokeResponse answers an invoke whose request_id already started
+// run.
+func duplicateInvokeResponse(run *domain.Run) *domain.InvokeResponse {
+	return &domain.InvokeResponse{
+		RunID:     run.RunID,
+		SessionID: run.SessionID,
+		AgentID:   run.RootAgentID,
+		Tags:      run.Tags,
+		Duplicate: true,
+	}
+}
@@ -0,0 +1,126 @@
+package service
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/xiaot623/gogo/orchestrator/internal/domain"
+)
+
+// ErrArchiverUnavailable is returned when restoring an archived run while no
+// archiver is configured.
+var ErrArchiverUnavailable = errors.New("run is archived but no archiver is configured")
+
+// archiveBatchSize bounds how many runs a single sweep archives.
+const archiveBatchSize = 100
+
+// RunArchiveMonitor periodically moves old terminal runs to cold storage.
+// It returns immediately unless archival is enabled and an archiver is set.
+func (s *Service) RunArchiveMonitor(ctx context.Context) {
+	if s.archiver == nil || s.config.RunArchiveAfter <= 0 {
+		return
+	}
+
+	ticker := time.NewTicker(s.config.RunArchiveInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			s.sweepArchivableRuns(ctx)
+		}
+	}
+}
+
+func (s *Service) sweepArchivableRuns(ctx context.Context) {
+	cutoff := s.clock.Now().Add(-s.config.RunArchiveAfter)
+	runs, err := s.store.ListArchivableRuns(ctx, cutoff, archiveBatchSize)
+	if err != nil {
+		s.logger.WarnContext(ctx, "run archive sweep failed", "error", err)
+		return
+	}
+
+	for _, run := range runs {
+		if ctx.Err() != nil {
+			return
+		}
+		if err := s.ArchiveRun(ctx, run.RunID); err != nil {
+			s.logger.WarnContext(ctx, "failed to archive run", "run_id", run.RunID, "error", err)
+		}
+	}
+}
+
+// ArchiveRun writes a run and all of its rows to the archiver, then deletes
+// the rows, leaving the run as a tombstone with its archive location.
+func (s *Service) ArchiveRun(ctx context.Context, runID string) error {
+	if s.archiver == nil {
+		return ErrArchiverUnavailable
+	}
+
+	archived, err := s.store.ExportRun(ctx, runID)
+	if err != nil {
+		return fmt.Errorf("failed to export run: %w", err)
+	}
+	if archived == nil {
+		return fmt.Errorf("run not found")
+	}
+	if archived.Run.ArchiveLocation != "" {
+		return nil
+	}
+	if !isTerminalRunStatus(archived.Run.Status) {
+		return fmt.Errorf("run %s is not terminal", runID)
+	}
+	archived.ArchivedAt = s.clock.Now()
+
+	data, err := json.Marshal(archived)
+	if err != nil {
+		return fmt.Errorf("failed to encode run archive: %w", err)
+	}
+	location, err := s.archiver.Put(ctx, runID+".json", data)
+	if err != nil {
+		return fmt.Errorf("failed to write run archive: %w", err)
+	}
+	if _, err := s.store.MarkRunArchived(ctx, runID, location); err != nil {
+		return fmt.Errorf("failed to mark run archived: %w", err)
+	}
+	s.logger.InfoContext(ctx, "archived run", "run_id", runID, "location", location, "events", len(archived.Events), "messages", len(archived.Messages))
+	return nil
+}
+
+// RestoreRun rehydrates an archived run back into the database and returns
+// it. Runs that are not archived are returned unchanged; nil means the run
+// does not exist.
+func (s *Service) RestoreRun(ctx context.Context, runID string) (*domain.Run, error) {
+	run, err := s.store.GetRun(ctx, runID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get run: %w", err)
+	}
+	if run == nil || run.ArchiveLocation == "" {
+		return run, nil
+	}
+	if s.archiver == nil {
+		return nil, ErrArchiverUnavailable
+	}
+
+	data, err := s.archiver.Get(ctx, run.ArchiveLocation)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read run archive: %w", err)
+	}
+	var archived domain.RunArchive
+	if err := json.Unmarshal(data, &archived); err != nil {
+		return nil, fmt.Errorf("failed to decode run archive: %w", err)
+	}
+	if archived.Run.RunID != runID {
+		return nil, fmt.Errorf("archive at %s holds run %q, not %q", run.ArchiveLocation, archived.Run.RunID, runID)
+	}
+	if _, err := s.store.RestoreRun(ctx, &archived); err != nil {
+		return nil, fmt.Errorf("failed to restore run: %w", err)
+	}
+
+	return s.GetRun(ctx, runID)
+}
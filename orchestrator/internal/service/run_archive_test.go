@@ -0,0 +1,120 @@
+package service
+
+import (
+	"context"
+	"encoding/json"
+	"testing"
+	"time"
+
+	"github.com/xiaot623/gogo/orchestrator/internal/adapter/agentclient"
+	"github.com/xiaot623/gogo/orchestrator/internal/adapter/ingress"
+	"github.com/xiaot623/gogo/orchestrator/internal/adapter/llm"
+	"github.com/xiaot623/gogo/orchestrator/internal/archive"
+	"github.com/xiaot623/gogo/orchestrator/internal/clock"
+	"github.com/xiaot623/gogo/orchestrator/internal/config"
+	"github.com/xiaot623/gogo/orchestrator/internal/domain"
+	"github.com/xiaot623/gogo/orchestrator/tests/helpers"
+)
+
+func TestArchiveAndRestoreRun(t *testing.T) {
+	ctx := context.Background()
+	db := helpers.NewTestSQLiteStore(t)
+	archiver, err := archive.NewDir(t.TempDir())
+	if err != nil {
+		t.Fatalf("NewDir: %v", err)
+	}
+	clk := clock.NewFake(time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC))
+	db.SetClock(clk)
+	cfg := &config.Config{AgentTimeout: time.Second, RunArchiveAfter: time.Hour, RunArchiveInterval: time.Minute}
+	svc := New(db, agentclient.NewClient(), ingress.NewClient(""), llm.NewClient("", "", time.Second), cfg, nil,
+		WithArchiver(archiver), WithClock(clk))
+
+	if err := db.CreateSession(ctx, &domain.Session{SessionID: "s1", UserID: "u1", CreatedAt: clk.Now()}); err != nil {
+		t.Fatalf("CreateSession: %v", err)
+	}
+	for _, runID := range []string{"r_old", "r_active"} {
+		if err := db.CreateRun(ctx, &domain.Run{RunID: runID, SessionID: "s1", RootAgentID: "a1", Status: domain.RunStatusRunning, StartedAt: clk.Now()}); err != nil {
+			t.Fatalf("CreateRun: %v", err)
+		}
+	}
+	if err := db.CreateMessage(ctx, &domain.Message{MessageID: "m1", SessionID: "s1", RunID: "r_old", Role: "user", Content: "hi", CreatedAt: clk.Now()}); err != nil {
+		t.Fatalf("CreateMessage: %v", err)
+	}
+	for _, typ := range []domain.EventType{domain.EventTypeRunStarted, domain.EventTypeRunDone} {
+		if err := svc.recordEvent(ctx, "r_old", typ, map[string]string{"k": "v"}); err != nil {
+			t.Fatalf("recordEvent: %v", err)
+		}
+	}
+	completedAt := clk.Now()
+	if err := db.CreateToolCall(ctx, &domain.ToolCall{ToolCallID: "tc1", RunID: "r_old", ToolName: "weather", Kind: domain.ToolKindServer, Status: domain.ToolCallStatusSucceeded, Args: json.RawMessage(`{"city":"x"}`), Result: json.RawMessage(`{"t":1}`), TimeoutMs: 1000, CreatedAt: clk.Now(), CompletedAt: &completedAt}); err != nil {
+		t.Fatalf("CreateToolCall: %v", err)
+	}
+	if err := db.CreateApproval(ctx, &domain.Approval{ApprovalID: "ap1", RunID: "r_old", ToolCallID: "tc1", Status: domain.ApprovalStatusPending, CreatedAt: clk.Now()}); err != nil {
+		t.Fatalf("CreateApproval: %v", err)
+	}
+	if err := db.UpdateRunCompleted(ctx, "r_old", domain.RunStatusDone, nil); err != nil {
+		t.Fatalf("UpdateRunCompleted: %v", err)
+	}
+
+	// Not old enough yet.
+	clk.Advance(30 * time.Minute)
+	svc.sweepArchivableRuns(ctx)
+	if run, _ := db.GetRun(ctx, "r_old"); run.ArchiveLocation != "" {
+		t.Fatalf("run archived before RunArchiveAfter: %+v", run)
+	}
+
+	clk.Advance(time.Hour)
+	svc.sweepArchivableRuns(ctx)
+
+	tombstone, err := svc.GetRun(ctx, "r_old")
+	if err != nil || tombstone == nil {
+		t.Fatalf("GetRun: %v %v", tombstone, err)
+	}
+	if tombstone.ArchiveLocation == "" || tombstone.Status != domain.RunStatusDone {
+		t.Fatalf("expected DONE tombstone with archive location, got %+v", tombstone)
+	}
+	if events, _ := db.GetEvents(ctx, "r_old", 0, 0, nil, 0); len(events) != 0 {
+		t.Fatalf("expected events to be deleted, got %d", len(events))
+	}
+	if msgs, _ := db.GetMessages(ctx, "s1", 0, "", domain.MessageFilter{RunID: "r_old"}); len(msgs) != 0 {
+		t.Fatalf("expected messages to be deleted, got %d", len(msgs))
+	}
+	if tc, _ := db.GetToolCall(ctx, "tc1"); tc != nil {
+		t.Fatalf("expected tool call to be deleted, got %+v", tc)
+	}
+	if run, _ := db.GetRun(ctx, "r_active"); run.ArchiveLocation != "" {
+		t.Fatal("non-terminal run must not be archived")
+	}
+
+	restored, err := svc.RestoreRun(ctx, "r_old")
+	if err != nil {
+		t.Fatalf("RestoreRun: %v", err)
+	}
+	if restored.ArchiveLocation != "" || restored.Status != domain.RunStatusDone || restored.EndedAt == nil {
+		t.Fatalf("unexpected restored run: %+v", restored)
+	}
+	events, _ := db.GetEvents(ctx, "r_old", 0, 0, nil, 0)
+	if len(events) != 2 || events[0].Type != domain.EventTypeRunStarted || events[1].Seq != 2 {
+		t.Fatalf("unexpected restored events: %+v", events)
+	}
+	if msgs, _ := db.GetMessages(ctx, "s1", 0, "", domain.MessageFilter{RunID: "r_old"}); len(msgs) != 1 || msgs[0].Content != "hi" {
+		t.Fatalf("unexpected restored messages: %+v", msgs)
+	}
+	if tc, _ := db.GetToolCall(ctx, "tc1"); tc == nil || string(tc.Result) != `{"t":1}` || tc.CompletedAt == nil {
+		t.Fatalf("unexpected restored tool call: %+v", tc)
+	}
+	if ap, _ := db.GetApproval(ctx, "ap1"); ap == nil || ap.ToolCallID != "tc1" {
+		t.Fatalf("unexpected restored approval: %+v", ap)
+	}
+
+	// A restored run stays in the database for another full retention period.
+	svc.sweepArchivableRuns(ctx)
+	if run, _ := db.GetRun(ctx, "r_old"); run.ArchiveLocation != "" {
+		t.Fatal("restored run re-archived immediately")
+	}
+	clk.Advance(2 * time.Hour)
+	svc.sweepArchivableRuns(ctx)
+	if run, _ := db.GetRun(ctx, "r_old"); run.ArchiveLocation == "" {
+		t.Fatal("expected restored run to be archived again after the retention period")
+	}
+}
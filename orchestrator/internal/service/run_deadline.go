@@ -0,0 +1,137 @@
+package service
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/xiaot623/gogo/orchestrator/internal/domain"
+	"github.com/xiaot623/gogo/orchestrator/internal/telemetry"
+)
+
+// ErrRunDeadlineExceeded is returned when a run is asked to go on (a tool
+// call or another LLM turn) after its maximum duration.
+var ErrRunDeadlineExceeded = errors.New("run exceeded its maximum duration")
+
+const (
+	// runDeadlineExceededCode is the run_failed code of an overdue run.
+	runDeadlineExceededCode = "run_deadline_exceeded"
+	// runDeadlineSweepInterval is how often overdue runs are looked for.
+	runDeadlineSweepInterval = time.Second
+	// runDeadlineBatchSize bounds how many runs a single sweep fails.
+	runDeadlineBatchSize = 100
+)
+
+// runDeadline returns when a run started at start must finish: MaxRunDuration
+// after it, or the request's max_duration_ms if that is sooner. Returns nil
+// when neither is set.
+func (s *Service) runDeadline(req domain.InvokeRequest, start time.Time) *time.Time {
+	limit := s.config.MaxRunDuration
+	if requested := time.Duration(req.MaxDurationMs) * time.Millisecond; requested > 0 && (limit <= 0 || requested < limit) {
+		limit = requested
+	}
+	if limit <= 0 {
+		return nil
+	}
+	deadline := start.Add(limit)
+	return &deadline
+}
+
+// runOverdue reports whether run is unfinished past its deadline.
+func runOverdue(run *domain.Run, now time.Time) bool {
+	return run.DeadlineAt != nil && !isTerminalRunStatus(run.Status) && !now.Before(*run.DeadlineAt)
+}
+
+// enforceRunDeadline fails run if it is overdue and returns
+// ErrRunDeadlineExceeded, so the caller does not go on with it.
+func (s *Service) enforceRunDeadline(ctx context.Context, run *domain.Run) error {
+	if !runOverdue(run, s.clock.Now()) {
+		return nil
+	}
+	s.failOverdueRun(ctx, run)
+	return ErrRunDeadlineExceeded
+}
+
+// checkRunDeadline is enforceRunDeadline for a run known by ID.
+func (s *Service) checkRunDeadline(ctx context.Context, runID string) error {
+	run, err := s.store.GetRun(ctx, runID)
+	if err != nil {
+		return fmt.Errorf("failed to get run: %w", err)
+	}
+	if run == nil {
+		return fmt.Errorf("run not found")
+	}
+	return s.enforceRunDeadline(ctx, run)
+}
+
+// RunDeadlineMonitor periodically fails runs that outlived their deadline,
+// which catches runs stuck in a quiet agent stream or waiting on a tool.
+func (s *Service) RunDeadlineMonitor(ctx context.Context) {
+	ticker := time.NewTicker(runDeadlineSweepInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			s.sweepOverdueRuns(ctx)
+		}
+	}
+}
+
+func (s *Service) sweepOverdueRuns(ctx context.Context) {
+	runs, err := s.store.ListOverdueRuns(ctx, s.clock.Now(), runDeadlineBatchSize)
+	if err != nil {
+		s.logger.WarnContext(ctx, "run deadline sweep failed", "error", err)
+		return
+	}
+	for i := range runs {
+		if ctx.Err() != nil {
+			return
+		}
+		s.failOverdueRun(ctx, &runs[i])
+	}
+}
+
+// failOverdueRun fails run with run_deadline_exceeded and stops its agent
+// stream, the way CancelRun does for a cancellation.
+func (s *Service) failOverdueRun(ctx context.Context, run *domain.Run) {
+	logger := s.logger.With("run_id", run.RunID, "session_id", run.SessionID)
+	payload := domain.RunFailedPayload{
+		Code:    runDeadlineExceededCode,
+		Message: fmt.Sprintf("run exceeded its maximum duration of %s", run.DeadlineAt.Sub(run.StartedAt)),
+	}
+	errData, _ := json.Marshal(payload)
+	// The run may have finished since it was found overdue.
+	failed, err := s.store.CompleteRunIfActive(ctx, run.RunID, domain.RunStatusFailed, errData)
+	if err != nil {
+		logger.ErrorContext(ctx, "failed to fail overdue run", "error", err)
+		return
+	}
+	if !failed {
+		return
+	}
+	logger.WarnContext(ctx, "run exceeded its deadline", "deadline_at", run.DeadlineAt)
+	payload.PartialMessage = s.takePartialOutput(run.RunID)
+	s.cancelRunStream(run.RunID)
+	go s.notifyAgentCancel(telemetry.Detach(ctx), run, payload.Message)
+
+	eventID, err := s.recordEventID(ctx, run.RunID, domain.EventTypeRunFailed, payload)
+	if err != nil {
+		logger.ErrorContext(ctx, "failed to record run_failed event", "error", err)
+	}
+	if s.ingressClient != nil {
+		s.ingressClient.PushEvent(run.SessionID, map[string]interface{}{
+			"type":     "error",
+			"ts":       s.clock.Now().UnixMilli(),
+			"run_id":   run.RunID,
+			"event_id": eventID,
+			"code":     payload.Code,
+			"message":  payload.Message,
+		})
+	}
+	s.recordRunSummary(ctx, run.RunID, run.SessionID, domain.RunStatusFailed, payload.PartialMessage, &domain.RunSummaryError{Code: payload.Code, Message: payload.Message})
+}
@@ -0,0 +1,80 @@
+package service
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/xiaot623/gogo/orchestrator/internal/domain"
+)
+
+// startRunHeartbeat pushes a run_heartbeat to the session whenever the run has
+// recorded no event for RunHeartbeatInterval, so clients can tell a quiet run
+// from a stalled one. Heartbeats are not recorded as events. The returned
+// stop function ends them and waits until no heartbeat can be pushed; it is
+// safe to call more than once.
+func (s *Service) startRunHeartbeat(ctx context.Context, runID, sessionID string) (stop func()) {
+	interval := s.config.RunHeartbeatInterval
+	if interval <= 0 || s.ingressClient == nil {
+		return func() {}
+	}
+
+	quit := make(chan struct{})
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		last := s.clock.Now().UnixMilli()
+		timer := time.NewTimer(interval)
+		defer timer.Stop()
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-quit:
+				return
+			case <-timer.C:
+			}
+
+			// Any event since the last beat, deltas included, pushes the
+			// next one back.
+			if ts := s.lastEventTs(runID); ts > last {
+				last = ts
+			}
+			now := s.clock.Now()
+			if wait := time.UnixMilli(last).Add(interval).Sub(now); wait > 0 {
+				timer.Reset(wait)
+				continue
+			}
+
+			run, err := s.store.GetRun(ctx, runID)
+			if err != nil || run == nil {
+				s.logger.WarnContext(ctx, "failed to load run for heartbeat", "run_id", runID, "error", err)
+				timer.Reset(interval)
+				continue
+			}
+			if isTerminalRunStatus(run.Status) {
+				return
+			}
+			if run.Status == domain.RunStatusRunning {
+				if err := s.ingressClient.PushEvent(sessionID, map[string]interface{}{
+					"type":       "run_heartbeat",
+					"ts":         now.UnixMilli(),
+					"run_id":     runID,
+					"elapsed_ms": now.Sub(run.StartedAt).Milliseconds(),
+				}); err != nil {
+					s.logger.DebugContext(ctx, "failed to push run_heartbeat", "run_id", runID, "error", err)
+				}
+			}
+			last = now.UnixMilli()
+			timer.Reset(interval)
+		}
+	}()
+
+	var once sync.Once
+	return func() {
+		once.Do(func() {
+			close(quit)
+			<-done
+		})
+	}
+}
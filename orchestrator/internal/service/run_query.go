@@ -3,14 +3,92 @@ package service
 import (
 	"context"
 	"fmt"
+	"time"
 
 	"github.com/xiaot623/gogo/orchestrator/internal/domain"
 )
 
-func (s *Service) GetRunEvents(ctx context.Context, runID string, afterTs int64, types []string, limit int) ([]domain.Event, error) {
-	events, err := s.store.GetEvents(ctx, runID, afterTs, types, limit)
+func (s *Service) GetRunEvents(ctx context.Context, runID string, afterTs, afterSeq int64, types []string, limit int) ([]domain.Event, error) {
+	events, err := s.store.GetEvents(ctx, runID, afterTs, afterSeq, types, limit)
 	if err != nil {
 		return nil, fmt.Errorf("failed to get run events: %w", err)
 	}
 	return events, nil
 }
+
+// GetRunAggregate returns a run with the related rows opts selects, or nil if
+// the run does not exist.
+func (s *Service) GetRunAggregate(ctx context.Context, runID string, opts domain.RunAggregateOptions) (*domain.RunAggregate, error) {
+	agg, err := s.store.GetRunAggregate(ctx, runID, opts)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get run aggregate: %w", err)
+	}
+	return agg, nil
+}
+
+// ListRuns lists run summaries across sessions, newest first.
+func (s *Service) ListRuns(ctx context.Context, filter domain.RunFilter) ([]domain.RunSummary, error) {
+	runs, err := s.store.ListRuns(ctx, filter)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list runs: %w", err)
+	}
+
+	now := s.clock.Now()
+	summaries := make([]domain.RunSummary, 0, len(runs))
+	for i := range runs {
+		summaries = append(summaries, summarizeRun(&runs[i], now))
+	}
+	return summaries, nil
+}
+
+// GetRunSummary returns a run's summary with its event counts by type, or nil
+// if the run does not exist. Archived runs have no events to count.
+func (s *Service) GetRunSummary(ctx context.Context, runID string) (*domain.RunEventSummary, error) {
+	run, err := s.store.GetRun(ctx, runID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get run: %w", err)
+	}
+	if run == nil {
+		return nil, nil
+	}
+
+	counts, err := s.store.CountEventsByType(ctx, runID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to count run events: %w", err)
+	}
+	firstTs, lastTs, err := s.store.GetEventTimeRange(ctx, runID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get run event range: %w", err)
+	}
+
+	summary := &domain.RunEventSummary{
+		RunSummary:   summarizeRun(run, s.clock.Now()),
+		EventCounts:  counts,
+		FirstEventTs: firstTs,
+		LastEventTs:  lastTs,
+	}
+	for _, n := range counts {
+		summary.EventCount += n
+	}
+	return summary, nil
+}
+
+// summarizeRun builds a run's list view; the duration of a run that has not
+// ended runs up to now.
+func summarizeRun(run *domain.Run, now time.Time) domain.RunSummary {
+	end := now
+	if run.EndedAt != nil {
+		end = *run.EndedAt
+	}
+	return domain.RunSummary{
+		RunID:       run.RunID,
+		SessionID:   run.SessionID,
+		AgentID:     run.RootAgentID,
+		Status:      run.Status,
+		StartedAt:   run.StartedAt,
+		EndedAt:     run.EndedAt,
+		DurationMs:  end.Sub(run.StartedAt).Milliseconds(),
+		TotalTokens: run.TotalTokens,
+		Tags:        run.Tags,
+	}
+}
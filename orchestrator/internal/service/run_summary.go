@@ -0,0 +1,60 @@
+package service
+
+import (
+	"context"
+
+	"github.com/xiaot623/gogo/orchestrator/internal/domain"
+)
+
+// recordRunSummary records the run_summary digest of a run that just ended
+// with status, and pushes it to the session when RunSummaryPush is set. It
+// is called after the run's terminal event and final push, so the digest
+// comes last. message is the final message, or the partial one a failed or
+// cancelled run left; runErr says why a run that did not finish ended.
+// Failures are only logged.
+func (s *Service) recordRunSummary(ctx context.Context, runID, sessionID string, status domain.RunStatus, message string, runErr *domain.RunSummaryError) {
+	logger := s.logger.With("run_id", runID, "session_id", sessionID)
+
+	agg, err := s.store.GetRunAggregate(ctx, runID, domain.RunAggregateOptions{ToolCalls: true})
+	if err != nil || agg == nil {
+		logger.WarnContext(ctx, "skipping run_summary: failed to load run", "error", err)
+		return
+	}
+	counts, err := s.store.CountEventsByType(ctx, runID)
+	if err != nil {
+		logger.WarnContext(ctx, "skipping run_summary: failed to count run events", "error", err)
+		return
+	}
+
+	summary := domain.RunSummaryPayload{
+		Status:        status,
+		DurationMs:    summarizeRun(&agg.Run, s.clock.Now()).DurationMs,
+		MessageLength: len(message),
+		DeltaCount:    counts[domain.EventTypeAgentStreamDelta],
+		ToolCallCount: len(agg.ToolCalls),
+		LLMCallCount:  counts[domain.EventTypeLLMCallStarted],
+		TotalTokens:   agg.Run.TotalTokens,
+		Error:         runErr,
+	}
+	// Runs that ended before their usage was stored still count what went
+	// through the LLM proxy.
+	if summary.TotalTokens == 0 {
+		if usage, err := s.store.SumLLMUsage(ctx, runID); err == nil && usage != nil {
+			summary.TotalTokens = usage.TotalTokens
+		}
+	}
+
+	eventID, err := s.recordEventID(ctx, runID, domain.EventTypeRunSummary, summary)
+	if err != nil {
+		logger.ErrorContext(ctx, "failed to record run_summary event", "error", err)
+	}
+	if s.config.RunSummaryPush && s.ingressClient != nil {
+		s.ingressClient.PushEvent(sessionID, map[string]interface{}{
+			"type":     "run_summary",
+			"ts":       s.clock.Now().UnixMilli(),
+			"run_id":   runID,
+			"event_id": eventID,
+			"summary":  summary,
+		})
+	}
+}
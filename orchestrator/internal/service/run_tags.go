@@ -0,0 +1,41 @@
+package service
+
+import (
+	"fmt"
+	"strings"
+	"unicode/utf8"
+)
+
+// Limits on the tags an invoke may attach to its run.
+const (
+	maxRunTags      = 16
+	maxRunTagLength = 64
+)
+
+// normalizeRunTags trims and de-duplicates tags, keeping their order, and
+// enforces the count and length limits.
+func normalizeRunTags(tags []string) ([]string, error) {
+	if len(tags) == 0 {
+		return nil, nil
+	}
+	seen := make(map[string]bool, len(tags))
+	out := make([]string, 0, len(tags))
+	for _, tag := range tags {
+		tag = strings.TrimSpace(tag)
+		if tag == "" {
+			return nil, fmt.Errorf("tags must not be empty")
+		}
+		if utf8.RuneCountInString(tag) > maxRunTagLength {
+			return nil, fmt.Errorf("tag %q is longer than %d characters", tag, maxRunTagLength)
+		}
+		if seen[tag] {
+			continue
+		}
+		seen[tag] = true
+		out = append(out, tag)
+	}
+	if len(out) > maxRunTags {
+		return nil, fmt.Errorf("at most %d tags are allowed, got %d", maxRunTags, len(out))
+	}
+	return out, nil
+}
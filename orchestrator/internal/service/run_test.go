@@ -0,0 +1,854 @@
+package service
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/xiaot623/gogo/orchestrator/internal/adapter/agentclient"
+	"github.com/xiaot623/gogo/orchestrator/internal/adapter/ingress"
+	"github.com/xiaot623/gogo/orchestrator/internal/adapter/llm"
+	"github.com/xiaot623/gogo/orchestrator/internal/clock"
+	"github.com/xiaot623/gogo/orchestrator/internal/config"
+	"github.com/xiaot623/gogo/orchestrator/internal/domain"
+	"github.com/xiaot623/gogo/orchestrator/internal/tokenizer"
+	"github.com/xiaot623/gogo/orchestrator/policy"
+	"github.com/xiaot623/gogo/orchestrator/tests/helpers"
+)
+
+func TestRunDoneAggregatesLLMUsage(t *testing.T) {
+	ctx := context.Background()
+	db := helpers.NewTestSQLiteStore(t)
+
+	policyEngine, err := policy.NewEngine(ctx, policy.DefaultPolicy)
+	if err != nil {
+		t.Fatalf("NewEngine failed: %v", err)
+	}
+	cfg := &config.Config{AgentTimeout: time.Second}
+	svc := New(db, agentclient.NewClient(), ingress.NewClient(""), llm.NewClient("", "", time.Second), cfg, policyEngine)
+
+	if err := db.CreateSession(ctx, &domain.Session{SessionID: "s1", UserID: "u1", CreatedAt: time.Now()}); err != nil {
+		t.Fatalf("CreateSession: %v", err)
+	}
+	if err := db.CreateRun(ctx, &domain.Run{RunID: "r1", SessionID: "s1", RootAgentID: "a1", Status: domain.RunStatusRunning, StartedAt: time.Now()}); err != nil {
+		t.Fatalf("CreateRun: %v", err)
+	}
+	for _, tokens := range [][2]int{{10, 5}, {20, 7}} {
+		if err := svc.recordEvent(ctx, "r1", domain.EventTypeLLMCallDone, domain.LLMCallDonePayload{
+			Model:            "gpt-4o",
+			PromptTokens:     tokens[0],
+			CompletionTokens: tokens[1],
+			TotalTokens:      tokens[0] + tokens[1],
+		}); err != nil {
+			t.Fatalf("recordEvent: %v", err)
+		}
+	}
+
+	// The agent does not report usage itself.
+	agent := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/event-stream")
+		fmt.Fprint(w, "event: done\ndata: {\"final_message\":\"ok\"}\n\n")
+	}))
+	defer agent.Close()
+
+	svc.processAgentStream(ctx, "r1", "s1", agent.URL, &domain.AgentInvokeRequest{AgentID: "a1", SessionID: "s1", RunID: "r1"})
+
+	events, err := db.GetEvents(ctx, "r1", 0, 0, []string{string(domain.EventTypeRunDone)}, 10)
+	if err != nil || len(events) != 1 {
+		t.Fatalf("expected one run_done event, got %d (%v)", len(events), err)
+	}
+	var payload domain.RunDonePayload
+	if err := json.Unmarshal(events[0].Payload, &payload); err != nil {
+		t.Fatalf("unmarshal run_done: %v", err)
+	}
+	want := domain.LLMUsage{Calls: 2, PromptTokens: 30, CompletionTokens: 12, TotalTokens: 42}
+	if payload.LLMUsage == nil || *payload.LLMUsage != want || payload.TotalTokens != 42 {
+		t.Fatalf("unexpected run_done usage: %+v", payload)
+	}
+
+	run, err := db.GetRun(ctx, "r1")
+	if err != nil {
+		t.Fatalf("GetRun: %v", err)
+	}
+	if run.Status != domain.RunStatusDone || run.TotalTokens != 42 {
+		t.Fatalf("unexpected run: %+v", run)
+	}
+}
+
+func TestReasoningKeptOutOfAssistantMessage(t *testing.T) {
+	agent := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/event-stream")
+		fmt.Fprint(w, "event: reasoning\ndata: {\"text\":\"user wants a greeting\"}\n\n")
+		fmt.Fprint(w, "event: delta\ndata: {\"text\":\"Hi\"}\n\n")
+		fmt.Fprint(w, "event: done\ndata: {\"final_message\":\"Hi\"}\n\n")
+	}))
+	defer agent.Close()
+
+	for _, capture := range []bool{true, false} {
+		t.Run(fmt.Sprintf("capture=%v", capture), func(t *testing.T) {
+			ctx := context.Background()
+			db := helpers.NewTestSQLiteStore(t)
+			fake, addr := startFakeIngress(t)
+
+			cfg := &config.Config{AgentTimeout: time.Second, CaptureReasoning: capture}
+			svc := New(db, agentclient.NewClient(), ingress.NewClient(addr), llm.NewClient("", "", time.Second), cfg, nil)
+
+			if err := db.CreateSession(ctx, &domain.Session{SessionID: "s1", UserID: "u1", CreatedAt: time.Now()}); err != nil {
+				t.Fatalf("CreateSession: %v", err)
+			}
+			if err := db.CreateRun(ctx, &domain.Run{RunID: "r1", SessionID: "s1", RootAgentID: "a1", Status: domain.RunStatusRunning, StartedAt: time.Now()}); err != nil {
+				t.Fatalf("CreateRun: %v", err)
+			}
+
+			svc.processAgentStream(ctx, "r1", "s1", agent.URL, &domain.AgentInvokeRequest{AgentID: "a1", SessionID: "s1", RunID: "r1"})
+
+			events, err := db.GetEvents(ctx, "r1", 0, 0, []string{string(domain.EventTypeAgentReasoningDelta)}, 10)
+			if err != nil {
+				t.Fatalf("GetEvents: %v", err)
+			}
+			pushed := false
+			for _, typ := range fake.eventTypes() {
+				pushed = pushed || typ == "reasoning"
+			}
+			if capture && (len(events) != 1 || !pushed) {
+				t.Fatalf("expected reasoning recorded and pushed, got %d events, pushes %v", len(events), fake.eventTypes())
+			}
+			if !capture && (len(events) != 0 || pushed) {
+				t.Fatalf("expected reasoning discarded, got %d events, pushes %v", len(events), fake.eventTypes())
+			}
+
+			messages, err := db.GetMessages(ctx, "s1", 10, "", domain.MessageFilter{})
+			if err != nil || len(messages) != 1 {
+				t.Fatalf("expected one assistant message, got %d (%v)", len(messages), err)
+			}
+			if messages[0].Content != "Hi" {
+				t.Fatalf("reasoning leaked into message: %q", messages[0].Content)
+			}
+		})
+	}
+}
+
+func TestAgentStateRecordedAndPushed(t *testing.T) {
+	agent := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/event-stream")
+		fmt.Fprint(w, "event: state\ndata: {\"state\":\"searching\",\"detail\":\"web\"}\n\n")
+		fmt.Fprint(w, "event: state\ndata: not json\n\n")
+		fmt.Fprint(w, "event: state\ndata: {\"detail\":\"no state\"}\n\n")
+		fmt.Fprint(w, "event: done\ndata: {\"final_message\":\"ok\"}\n\n")
+	}))
+	defer agent.Close()
+
+	ctx := context.Background()
+	db := helpers.NewTestSQLiteStore(t)
+	fake, addr := startFakeIngress(t)
+	cfg := &config.Config{AgentTimeout: time.Second}
+	svc := New(db, agentclient.NewClient(), ingress.NewClient(addr), llm.NewClient("", "", time.Second), cfg, nil)
+
+	if err := db.CreateSession(ctx, &domain.Session{SessionID: "s1", UserID: "u1", CreatedAt: time.Now()}); err != nil {
+		t.Fatalf("CreateSession: %v", err)
+	}
+	if err := db.CreateRun(ctx, &domain.Run{RunID: "r1", SessionID: "s1", RootAgentID: "a1", Status: domain.RunStatusRunning, StartedAt: time.Now()}); err != nil {
+		t.Fatalf("CreateRun: %v", err)
+	}
+
+	svc.processAgentStream(ctx, "r1", "s1", agent.URL, &domain.AgentInvokeRequest{AgentID: "a1", SessionID: "s1", RunID: "r1"})
+
+	// Malformed state frames are skipped without failing the run.
+	events, err := db.GetEvents(ctx, "r1", 0, 0, []string{string(domain.EventTypeAgentState)}, 10)
+	if err != nil || len(events) != 1 {
+		t.Fatalf("expected one agent_state event, got %d (%v)", len(events), err)
+	}
+	var payload domain.AgentStatePayload
+	if err := json.Unmarshal(events[0].Payload, &payload); err != nil {
+		t.Fatalf("unmarshal agent_state: %v", err)
+	}
+	if payload != (domain.AgentStatePayload{State: "searching", Detail: "web"}) {
+		t.Fatalf("unexpected agent_state payload: %+v", payload)
+	}
+
+	var pushes []map[string]interface{}
+	fake.mu.Lock()
+	for _, ev := range fake.events {
+		if ev.Event["type"] == "state" {
+			pushes = append(pushes, ev.Event)
+		}
+	}
+	fake.mu.Unlock()
+	if len(pushes) != 1 || pushes[0]["state"] != "searching" || pushes[0]["event_id"] != events[0].EventID {
+		t.Fatalf("unexpected state pushes: %v", pushes)
+	}
+
+	run, err := db.GetRun(ctx, "r1")
+	if err != nil || run.Status != domain.RunStatusDone {
+		t.Fatalf("expected run DONE, got %+v (%v)", run, err)
+	}
+}
+
+func TestCancelRunRecordsReason(t *testing.T) {
+	ctx := context.Background()
+	db := helpers.NewTestSQLiteStore(t)
+	svc := New(db, agentclient.NewClient(), ingress.NewClient(""), llm.NewClient("", "", time.Second), &config.Config{AgentTimeout: time.Second}, nil)
+
+	if err := db.CreateSession(ctx, &domain.Session{SessionID: "s1", UserID: "u1", CreatedAt: time.Now()}); err != nil {
+		t.Fatalf("CreateSession: %v", err)
+	}
+	for _, runID := range []string{"r1", "r2"} {
+		if err := db.CreateRun(ctx, &domain.Run{RunID: runID, SessionID: "s1", RootAgentID: "a1", Status: domain.RunStatusRunning, StartedAt: time.Now()}); err != nil {
+			t.Fatalf("CreateRun: %v", err)
+		}
+	}
+
+	cancelled := func(runID string, req domain.CancelRunRequest) domain.RunCancelledPayload {
+		t.Helper()
+		if err := svc.CancelRun(ctx, runID, req); err != nil {
+			t.Fatalf("CancelRun: %v", err)
+		}
+		events, err := db.GetEvents(ctx, runID, 0, 0, []string{string(domain.EventTypeRunCancelled)}, 10)
+		if err != nil || len(events) != 1 {
+			t.Fatalf("expected one run_cancelled event, got %d (%v)", len(events), err)
+		}
+		var payload, stored domain.RunCancelledPayload
+		if err := json.Unmarshal(events[0].Payload, &payload); err != nil {
+			t.Fatalf("unmarshal run_cancelled: %v", err)
+		}
+		run, err := db.GetRun(ctx, runID)
+		if err != nil || json.Unmarshal(run.Error, &stored) != nil || stored != payload {
+			t.Fatalf("run error %s does not match event %+v (%v)", run.Error, payload, err)
+		}
+		return payload
+	}
+
+	got := cancelled("r1", domain.CancelRunRequest{Reason: "quota exceeded", DecidedBy: "system"})
+	if got != (domain.RunCancelledPayload{Reason: "quota exceeded", DecidedBy: "system"}) {
+		t.Fatalf("unexpected cancel payload: %+v", got)
+	}
+	got = cancelled("r2", domain.CancelRunRequest{})
+	if got != (domain.RunCancelledPayload{Reason: "cancelled by user", DecidedBy: "user"}) {
+		t.Fatalf("unexpected default cancel payload: %+v", got)
+	}
+
+	// Cancelling again keeps the original reason and records nothing new.
+	if got := cancelled("r1", domain.CancelRunRequest{Reason: "again"}); got.Reason != "quota exceeded" {
+		t.Fatalf("reason overwritten: %+v", got)
+	}
+}
+
+func TestCancelRunSavesPartialOutput(t *testing.T) {
+	ctx := context.Background()
+	db := helpers.NewTestSQLiteStore(t)
+
+	released := make(chan struct{}, 1)
+	agent := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/event-stream")
+		fmt.Fprint(w, "event: delta\ndata: {\"text\":\"Hel\"}\n\n")
+		fmt.Fprint(w, "event: delta\ndata: {\"text\":\"lo wor\"}\n\n")
+		w.(http.Flusher).Flush()
+		<-r.Context().Done()
+		released <- struct{}{}
+	}))
+	defer agent.Close()
+
+	cfg := &config.Config{AgentTimeout: time.Hour, EventBatchSize: 1, PartialOutputMaxBytes: 5}
+	svc := New(db, agentclient.NewClient(), ingress.NewClient(""), llm.NewClient("", "", time.Second), cfg, nil)
+	if _, err := svc.RegisterAgent(ctx, "a1", "Agent", agent.URL, nil, nil, "", "", "", 0, nil, nil); err != nil {
+		t.Fatalf("RegisterAgent: %v", err)
+	}
+	resp, err := svc.InvokeAgent(ctx, domain.InvokeRequest{SessionID: "s1", AgentID: "a1", InputMessage: domain.InputMessage{Role: "user", Content: "hi"}})
+	if err != nil {
+		t.Fatalf("InvokeAgent: %v", err)
+	}
+
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		deltas, _ := db.GetEvents(ctx, resp.RunID, 0, 0, []string{string(domain.EventTypeAgentStreamDelta)}, 10)
+		if len(deltas) == 2 {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("expected 2 deltas, got %d", len(deltas))
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	if err := svc.CancelRun(ctx, resp.RunID, domain.CancelRunRequest{}); err != nil {
+		t.Fatalf("CancelRun: %v", err)
+	}
+	<-released
+
+	// Only the first PartialOutputMaxBytes of the streamed text are kept.
+	events, err := db.GetEvents(ctx, resp.RunID, 0, 0, []string{string(domain.EventTypeRunCancelled)}, 10)
+	if err != nil || len(events) != 1 {
+		t.Fatalf("expected one run_cancelled event, got %d (%v)", len(events), err)
+	}
+	var cancelled domain.RunCancelledPayload
+	if err := json.Unmarshal(events[0].Payload, &cancelled); err != nil || cancelled.PartialMessage != "Hello" {
+		t.Fatalf("unexpected run_cancelled payload %s (%v)", events[0].Payload, err)
+	}
+
+	for {
+		msgs, err := db.GetMessages(ctx, "s1", 10, "", domain.MessageFilter{Roles: []string{"assistant"}})
+		if err != nil {
+			t.Fatalf("GetMessages: %v", err)
+		}
+		if len(msgs) == 1 {
+			var metadata map[string]bool
+			if msgs[0].Content != "Hello" || json.Unmarshal(msgs[0].Metadata, &metadata) != nil || !metadata["partial"] || !metadata["truncated"] {
+				t.Fatalf("unexpected partial message %+v", msgs[0])
+			}
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatal("partial assistant message was not saved")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+func TestCancelRunNotifiesAgent(t *testing.T) {
+	ctx := context.Background()
+	db := helpers.NewTestSQLiteStore(t)
+	svc := New(db, agentclient.NewClient(), ingress.NewClient(""), llm.NewClient("", "", time.Second), &config.Config{AgentTimeout: time.Second}, nil)
+
+	type cancelCall struct {
+		body agentclient.CancelRequest
+		auth string
+	}
+	calls := make(chan cancelCall, 1)
+	agent := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var call cancelCall
+		_ = json.NewDecoder(r.Body).Decode(&call.body)
+		call.auth = r.Header.Get("Authorization")
+		calls <- call
+		w.WriteHeader(http.StatusAccepted)
+	}))
+	defer agent.Close()
+
+	if _, err := svc.RegisterAgent(ctx, "a1", "Agent", agent.URL, nil, map[string]string{"Authorization": "Bearer agent-key"}, "", "", agent.URL+"/cancel", 0, nil, nil); err != nil {
+		t.Fatalf("RegisterAgent: %v", err)
+	}
+	if err := db.CreateSession(ctx, &domain.Session{SessionID: "s1", UserID: "u1", CreatedAt: time.Now()}); err != nil {
+		t.Fatalf("CreateSession: %v", err)
+	}
+	if err := db.CreateRun(ctx, &domain.Run{RunID: "r1", SessionID: "s1", RootAgentID: "a1", Status: domain.RunStatusRunning, StartedAt: time.Now()}); err != nil {
+		t.Fatalf("CreateRun: %v", err)
+	}
+
+	if err := svc.CancelRun(ctx, "r1", domain.CancelRunRequest{Reason: "user pressed stop"}); err != nil {
+		t.Fatalf("CancelRun: %v", err)
+	}
+	select {
+	case call := <-calls:
+		if call.body != (agentclient.CancelRequest{RunID: "r1", SessionID: "s1", Reason: "user pressed stop"}) || call.auth != "Bearer agent-key" {
+			t.Fatalf("unexpected cancel call: %+v", call)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("agent cancel URL was not called")
+	}
+}
+
+func TestRunSummaryRecordedAfterTerminalEvent(t *testing.T) {
+	agent := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/event-stream")
+		fmt.Fprint(w, "event: delta\ndata: {\"text\":\"Hel\"}\n\n")
+		fmt.Fprint(w, "event: delta\ndata: {\"text\":\"lo\"}\n\n")
+		if r.URL.Query().Get("fail") != "" {
+			fmt.Fprint(w, "event: error\ndata: {\"code\":\"boom\",\"message\":\"agent crashed\"}\n\n")
+			return
+		}
+		fmt.Fprint(w, "event: done\ndata: {\"final_message\":\"Hello\",\"usage\":{\"total_tokens\":12}}\n\n")
+	}))
+	defer agent.Close()
+
+	for _, tc := range []struct {
+		name   string
+		url    string
+		status domain.RunStatus
+		last   string
+		err    *domain.RunSummaryError
+	}{
+		{name: "done", url: agent.URL, status: domain.RunStatusDone, last: "done"},
+		{name: "failed", url: agent.URL + "?fail=1", status: domain.RunStatusFailed, last: "error", err: &domain.RunSummaryError{Code: "boom", Message: "agent crashed"}},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			ctx := context.Background()
+			db := helpers.NewTestSQLiteStore(t)
+			fake, addr := startFakeIngress(t)
+			cfg := &config.Config{AgentTimeout: time.Second, PartialOutputMaxBytes: 1024, RunSummaryPush: true}
+			svc := New(db, agentclient.NewClient(), ingress.NewClient(addr), llm.NewClient("", "", time.Second), cfg, nil)
+
+			if err := db.CreateSession(ctx, &domain.Session{SessionID: "s1", UserID: "u1", CreatedAt: time.Now()}); err != nil {
+				t.Fatalf("CreateSession: %v", err)
+			}
+			if err := db.CreateRun(ctx, &domain.Run{RunID: "r1", SessionID: "s1", RootAgentID: "a1", Status: domain.RunStatusRunning, StartedAt: time.Now()}); err != nil {
+				t.Fatalf("CreateRun: %v", err)
+			}
+
+			svc.processAgentStream(ctx, "r1", "s1", tc.url, &domain.AgentInvokeRequest{AgentID: "a1", SessionID: "s1", RunID: "r1"})
+
+			events, err := db.GetEvents(ctx, "r1", 0, 0, []string{string(domain.EventTypeRunSummary)}, 10)
+			if err != nil || len(events) != 1 {
+				t.Fatalf("expected one run_summary event, got %d (%v)", len(events), err)
+			}
+			var summary domain.RunSummaryPayload
+			if err := json.Unmarshal(events[0].Payload, &summary); err != nil {
+				t.Fatalf("unmarshal run_summary: %v", err)
+			}
+			if summary.Status != tc.status || summary.MessageLength != len("Hello") || summary.DeltaCount != 2 {
+				t.Fatalf("unexpected run_summary: %+v", summary)
+			}
+			if (summary.Error == nil) != (tc.err == nil) || (tc.err != nil && *summary.Error != *tc.err) {
+				t.Fatalf("unexpected run_summary error: %+v", summary.Error)
+			}
+			if tc.status == domain.RunStatusDone && summary.TotalTokens != 12 {
+				t.Fatalf("expected 12 total tokens, got %+v", summary)
+			}
+
+			// The digest is pushed right after the terminal event.
+			types := fake.eventTypes()
+			if n := len(types); n < 2 || types[n-2] != tc.last || types[n-1] != "run_summary" {
+				t.Fatalf("expected %s then run_summary pushed last, got %v", tc.last, types)
+			}
+		})
+	}
+}
+
+func TestNormalizeRunTags(t *testing.T) {
+	tags, err := normalizeRunTags([]string{" experiment=x ", "tenant=acme", "experiment=x"})
+	if err != nil {
+		t.Fatalf("normalizeRunTags: %v", err)
+	}
+	if strings.Join(tags, ",") != "experiment=x,tenant=acme" {
+		t.Fatalf("unexpected tags: %v", tags)
+	}
+
+	if _, err := normalizeRunTags([]string{" "}); err == nil {
+		t.Fatal("expected an empty tag to be rejected")
+	}
+	if _, err := normalizeRunTags([]string{strings.Repeat("x", maxRunTagLength+1)}); err == nil {
+		t.Fatal("expected an over-long tag to be rejected")
+	}
+	tooMany := make([]string, maxRunTags+1)
+	for i := range tooMany {
+		tooMany[i] = fmt.Sprintf("t%d", i)
+	}
+	if _, err := normalizeRunTags(tooMany); err == nil {
+		t.Fatal("expected too many tags to be rejected")
+	}
+}
+
+func TestInvokeAgentHistoryWindow(t *testing.T) {
+	ctx := context.Background()
+	db := helpers.NewTestSQLiteStore(t)
+
+	received := make(chan domain.AgentInvokeRequest, 1)
+	agent := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var req domain.AgentInvokeRequest
+		_ = json.NewDecoder(r.Body).Decode(&req)
+		received <- req
+		w.Header().Set("Content-Type", "text/event-stream")
+		fmt.Fprint(w, "event: done\ndata: {\"final_message\":\"ok\"}\n\n")
+	}))
+	defer agent.Close()
+
+	cfg := &config.Config{AgentTimeout: time.Second, InvokeWaitMax: time.Second, MaxHistoryMessages: 3}
+	svc := New(db, agentclient.NewClient(), ingress.NewClient(""), llm.NewClient("", "", time.Second), cfg, nil)
+	if _, err := svc.RegisterAgent(ctx, "a1", "Agent", agent.URL, nil, nil, "", "", "", 0, nil, nil); err != nil {
+		t.Fatalf("RegisterAgent: %v", err)
+	}
+	if _, err := db.GetOrCreateSession(ctx, "s1", "u1"); err != nil {
+		t.Fatalf("GetOrCreateSession: %v", err)
+	}
+	base := time.Now().Add(-time.Hour)
+	for i := 1; i <= 4; i++ {
+		if err := db.CreateMessage(ctx, &domain.Message{
+			MessageID: fmt.Sprintf("m%d", i),
+			SessionID: "s1",
+			Role:      "user",
+			Content:   fmt.Sprintf("old %d", i),
+			CreatedAt: base.Add(time.Duration(i) * time.Minute),
+		}); err != nil {
+			t.Fatalf("CreateMessage: %v", err)
+		}
+	}
+
+	history := func(content string, maxHistory *int) []domain.Message {
+		t.Helper()
+		if _, err := svc.InvokeAgentAndWait(ctx, domain.InvokeRequest{
+			SessionID:    "s1",
+			AgentID:      "a1",
+			InputMessage: domain.InputMessage{Role: "user", Content: content},
+			MaxHistory:   maxHistory,
+		}, 0); err != nil {
+			t.Fatalf("InvokeAgentAndWait: %v", err)
+		}
+		return (<-received).Messages
+	}
+	intPtr := func(n int) *int { return &n }
+
+	// The configured window keeps the most recent messages, ending with the input.
+	msgs := history("first", nil)
+	if len(msgs) != 3 || msgs[0].Content != "old 3" || msgs[2].Content != "first" {
+		t.Fatalf("unexpected default window: %+v", msgs)
+	}
+	if msgs := history("stateless", intPtr(0)); len(msgs) != 0 {
+		t.Fatalf("expected no history, got %+v", msgs)
+	}
+	// 4 seeded messages plus three turns' inputs and two replies.
+	msgs = history("everything", intPtr(-1))
+	if len(msgs) != 9 || msgs[0].Content != "old 1" || msgs[8].Content != "everything" {
+		t.Fatalf("unexpected full history: %+v", msgs)
+	}
+
+	if _, err := svc.InvokeAgent(ctx, domain.InvokeRequest{
+		SessionID:    "s1",
+		AgentID:      "a1",
+		InputMessage: domain.InputMessage{Role: "user", Content: "bad"},
+		MaxHistory:   intPtr(-2),
+	}); err == nil {
+		t.Fatal("expected max_history below -1 to be rejected")
+	}
+}
+
+func TestInvokeAgentRequestFilter(t *testing.T) {
+	ctx := context.Background()
+	db := helpers.NewTestSQLiteStore(t)
+
+	received := make(chan domain.AgentInvokeRequest, 1)
+	agent := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var req domain.AgentInvokeRequest
+		_ = json.NewDecoder(r.Body).Decode(&req)
+		received <- req
+		w.Header().Set("Content-Type", "text/event-stream")
+		fmt.Fprint(w, "event: done\ndata: {\"final_message\":\"ok\"}\n\n")
+	}))
+	defer agent.Close()
+
+	cfg := &config.Config{AgentTimeout: time.Second, InvokeWaitMax: time.Second, MaxHistoryMessages: -1}
+	svc := New(db, agentclient.NewClient(), ingress.NewClient(""), llm.NewClient("", "", time.Second), cfg, nil)
+	filter := &domain.AgentRequestFilter{ContextKeys: []string{"locale"}, LatestInputOnly: true}
+	if _, err := svc.RegisterAgent(ctx, "third-party", "Third party", agent.URL, nil, nil, "", "", "", 0, filter, nil); err != nil {
+		t.Fatalf("RegisterAgent: %v", err)
+	}
+	if _, err := svc.RegisterAgent(ctx, "trusted", "Trusted", agent.URL, nil, nil, "", "", "", 0, nil, nil); err != nil {
+		t.Fatalf("RegisterAgent: %v", err)
+	}
+
+	invoke := func(agentID string) domain.AgentInvokeRequest {
+		t.Helper()
+		if _, err := svc.InvokeAgentAndWait(ctx, domain.InvokeRequest{
+			SessionID:    "s1",
+			AgentID:      agentID,
+			InputMessage: domain.InputMessage{Role: "user", Content: "hi " + agentID},
+			Context:      map[string]string{"locale": "en", "user_id": "u1", "client.platform": "ios"},
+		}, 0); err != nil {
+			t.Fatalf("InvokeAgentAndWait: %v", err)
+		}
+		return <-received
+	}
+
+	// Unfiltered agents keep getting the full context and history.
+	req := invoke("trusted")
+	if len(req.Context) != 3 || len(req.Messages) != 1 {
+		t.Fatalf("unexpected unfiltered request: context %v, messages %+v", req.Context, req.Messages)
+	}
+
+	req = invoke("third-party")
+	if len(req.Context) != 1 || req.Context["locale"] != "en" {
+		t.Fatalf("expected only the allowlisted context, got %v", req.Context)
+	}
+	if len(req.Messages) != 0 || req.InputMessage.Content != "hi third-party" {
+		t.Fatalf("expected only the latest input, got %+v / %+v", req.Messages, req.InputMessage)
+	}
+}
+
+func TestInvokeAgentDuplicateRequestID(t *testing.T) {
+	ctx := context.Background()
+	db := helpers.NewTestSQLiteStore(t)
+
+	var calls atomic.Int32
+	agent := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		calls.Add(1)
+		w.Header().Set("Content-Type", "text/event-stream")
+		fmt.Fprint(w, "event: done\ndata: {\"final_message\":\"ok\"}\n\n")
+	}))
+	defer agent.Close()
+
+	cfg := &config.Config{AgentTimeout: time.Second, InvokeWaitMax: time.Second}
+	svc := New(db, agentclient.NewClient(), ingress.NewClient(""), llm.NewClient("", "", time.Second), cfg, nil)
+	if _, err := svc.RegisterAgent(ctx, "a1", "Agent", agent.URL, nil, nil, "", "", "", 0, nil, nil); err != nil {
+		t.Fatalf("RegisterAgent: %v", err)
+	}
+
+	invoke := func(sessionID, requestID string) *domain.InvokeResult {
+		t.Helper()
+		result, err := svc.InvokeAgentAndWait(ctx, domain.InvokeRequest{
+			SessionID:    sessionID,
+			AgentID:      "a1",
+			InputMessage: domain.InputMessage{Role: "user", Content: "hi"},
+			RequestID:    requestID,
+		}, 0)
+		if err != nil {
+			t.Fatalf("InvokeAgentAndWait: %v", err)
+		}
+		return result
+	}
+
+	first := invoke("s1", "req_1")
+	resent := invoke("s1", "req_1")
+	if resent.RunID != first.RunID || !resent.Duplicate || first.Duplicate {
+		t.Fatalf("expected the resent invoke to return run %s, got %+v", first.RunID, resent.InvokeResponse)
+	}
+	if resent.Status != domain.RunStatusDone || resent.FinalMessage != "ok" {
+		t.Fatalf("expected the existing run's outcome, got %+v", resent)
+	}
+
+	// The key is per session, and invokes without a request_id never dedupe.
+	if other := invoke("s2", "req_1"); other.RunID == first.RunID || other.Duplicate {
+		t.Fatalf("request_id deduplicated across sessions: %+v", other.InvokeResponse)
+	}
+	if a, b := invoke("s1", ""), invoke("s1", ""); a.RunID == b.RunID {
+		t.Fatal("invokes without request_id shared a run")
+	}
+	if n := calls.Load(); n != 4 {
+		t.Fatalf("expected 4 agent invocations, got %d", n)
+	}
+	runs, err := db.ListRuns(ctx, domain.RunFilter{SessionID: "s1"})
+	if err != nil || len(runs) != 3 {
+		t.Fatalf("expected 3 runs in s1, got %d (%v)", len(runs), err)
+	}
+}
+
+func TestTrimHistoryToTokens(t *testing.T) {
+	messages := []domain.Message{
+		{Role: "user", Content: strings.Repeat("old ", 40)},
+		{Role: "assistant", Content: "short reply"},
+		{Role: "user", Content: strings.Repeat("newest input ", 20)},
+	}
+
+	svc := &Service{config: &config.Config{}, tokens: tokenizer.Approximate{}}
+	if got := svc.trimHistoryToTokens("m", messages); len(got) != 3 {
+		t.Fatalf("expected no trimming without a budget, got %d messages", len(got))
+	}
+
+	svc.config.MaxHistoryTokens = 80
+	if got := svc.trimHistoryToTokens("m", messages); len(got) != 2 || got[0].Content != "short reply" {
+		t.Fatalf("expected the oldest message dropped, got %+v", got)
+	}
+
+	// The input is kept even when it alone exceeds the budget.
+	svc.config.MaxHistoryTokens = 1
+	if got := svc.trimHistoryToTokens("m", messages); len(got) != 1 || got[0].Role != "user" {
+		t.Fatalf("expected only the input kept, got %+v", got)
+	}
+}
+
+func TestRunHeartbeatDuringQuietStream(t *testing.T) {
+	ctx := context.Background()
+	db := helpers.NewTestSQLiteStore(t)
+	fake, addr := startFakeIngress(t)
+
+	agent := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/event-stream")
+		fmt.Fprint(w, "event: delta\ndata: {\"text\":\"working\"}\n\n")
+		w.(http.Flusher).Flush()
+		time.Sleep(350 * time.Millisecond)
+		fmt.Fprint(w, "event: done\ndata: {\"final_message\":\"working\"}\n\n")
+	}))
+	defer agent.Close()
+
+	cfg := &config.Config{AgentTimeout: 5 * time.Second, InvokeWaitMax: 5 * time.Second, RunHeartbeatInterval: 100 * time.Millisecond}
+	svc := New(db, agentclient.NewClient(), ingress.NewClient(addr), llm.NewClient("", "", time.Second), cfg, nil)
+	if _, err := svc.RegisterAgent(ctx, "a1", "Agent", agent.URL, nil, nil, "", "", "", 0, nil, nil); err != nil {
+		t.Fatalf("RegisterAgent: %v", err)
+	}
+	resp, err := svc.InvokeAgentAndWait(ctx, domain.InvokeRequest{
+		SessionID:    "s1",
+		AgentID:      "a1",
+		InputMessage: domain.InputMessage{Role: "user", Content: "hi"},
+	}, 0)
+	if err != nil {
+		t.Fatalf("InvokeAgentAndWait: %v", err)
+	}
+
+	fake.mu.Lock()
+	defer fake.mu.Unlock()
+	heartbeats, done := 0, false
+	for _, ev := range fake.events {
+		switch ev.Event["type"] {
+		case "run_heartbeat":
+			if done {
+				t.Fatal("run_heartbeat pushed after done")
+			}
+			if ev.Event["run_id"] != resp.RunID || ev.Event["elapsed_ms"].(float64) <= 0 {
+				t.Fatalf("unexpected heartbeat: %+v", ev.Event)
+			}
+			heartbeats++
+		case "done":
+			done = true
+		}
+	}
+	if heartbeats == 0 || heartbeats > 4 {
+		t.Fatalf("expected a few heartbeats during the quiet stretch, got %d", heartbeats)
+	}
+
+	stored, err := db.CountEventsByType(ctx, resp.RunID)
+	if err != nil {
+		t.Fatalf("CountEventsByType: %v", err)
+	}
+	if stored["run_heartbeat"] != 0 {
+		t.Fatal("heartbeats must not be recorded as events")
+	}
+}
+
+func TestRunDeadlineExceeded(t *testing.T) {
+	ctx := context.Background()
+	db := helpers.NewTestSQLiteStore(t)
+	fake, addr := startFakeIngress(t)
+
+	started := make(chan struct{}, 1)
+	released := make(chan struct{}, 1)
+	agent := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/event-stream")
+		w.(http.Flusher).Flush()
+		started <- struct{}{}
+		<-r.Context().Done()
+		released <- struct{}{}
+	}))
+	defer agent.Close()
+
+	clk := clock.NewFake(time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC))
+	cfg := &config.Config{AgentTimeout: time.Hour, ToolTimeout: time.Minute, MaxRunDuration: 10 * time.Minute}
+	svc := New(db, agentclient.NewClient(), ingress.NewClient(addr), llm.NewClient("", "", time.Second), cfg, nil, WithClock(clk))
+	if _, err := svc.RegisterAgent(ctx, "a1", "Agent", agent.URL, nil, nil, "", "", "", 0, nil, nil); err != nil {
+		t.Fatalf("RegisterAgent: %v", err)
+	}
+
+	invoke := func(maxDurationMs int64) *domain.Run {
+		t.Helper()
+		resp, err := svc.InvokeAgent(ctx, domain.InvokeRequest{
+			SessionID:     "s1",
+			AgentID:       "a1",
+			InputMessage:  domain.InputMessage{Role: "user", Content: "hi"},
+			MaxDurationMs: maxDurationMs,
+		})
+		if err != nil {
+			t.Fatalf("InvokeAgent: %v", err)
+		}
+		<-started
+		run, err := db.GetRun(ctx, resp.RunID)
+		if err != nil || run == nil {
+			t.Fatalf("GetRun: %v", err)
+		}
+		return run
+	}
+
+	// A request can shorten the configured cap but not extend it.
+	short := invoke(60000)
+	long := invoke(int64(time.Hour / time.Millisecond))
+	if short.DeadlineAt == nil || !short.DeadlineAt.Equal(clk.Now().Add(time.Minute)) {
+		t.Fatalf("expected a 1m deadline, got %v", short.DeadlineAt)
+	}
+	if long.DeadlineAt == nil || !long.DeadlineAt.Equal(clk.Now().Add(10*time.Minute)) {
+		t.Fatalf("expected the configured 10m deadline, got %v", long.DeadlineAt)
+	}
+
+	clk.Advance(time.Minute)
+	svc.sweepOverdueRuns(ctx)
+	select {
+	case <-released:
+	case <-time.After(5 * time.Second):
+		t.Fatal("overdue run's agent stream was not stopped")
+	}
+
+	run, err := db.GetRun(ctx, short.RunID)
+	if err != nil || run.Status != domain.RunStatusFailed {
+		t.Fatalf("expected FAILED, got %+v (%v)", run, err)
+	}
+	events, err := db.GetEvents(ctx, short.RunID, 0, 0, []string{string(domain.EventTypeRunFailed)}, 10)
+	if err != nil || len(events) != 1 {
+		t.Fatalf("expected one run_failed event, got %d (%v)", len(events), err)
+	}
+	var failed domain.RunFailedPayload
+	if err := json.Unmarshal(events[0].Payload, &failed); err != nil || failed.Code != "run_deadline_exceeded" {
+		t.Fatalf("unexpected run_failed payload %s (%v)", events[0].Payload, err)
+	}
+	if run, _ := db.GetRun(ctx, long.RunID); run.Status != domain.RunStatusRunning {
+		t.Fatalf("run within its deadline was failed: %+v", run)
+	}
+
+	// A tool call past the deadline fails the run instead of dispatching.
+	clk.Advance(9 * time.Minute)
+	if _, err := svc.InvokeTool(ctx, "browser.screenshot", domain.ToolInvokeRequest{RunID: long.RunID, Args: json.RawMessage(`{}`)}); !errors.Is(err, ErrRunDeadlineExceeded) {
+		t.Fatalf("expected ErrRunDeadlineExceeded, got %v", err)
+	}
+	if run, _ := db.GetRun(ctx, long.RunID); run.Status != domain.RunStatusFailed {
+		t.Fatalf("expected FAILED, got %+v", run)
+	}
+	<-released
+
+	fake.mu.Lock()
+	defer fake.mu.Unlock()
+	pushed := 0
+	for _, ev := range fake.events {
+		if ev.Event["type"] == "error" && ev.Event["code"] == "run_deadline_exceeded" {
+			pushed++
+		}
+	}
+	if pushed != 2 {
+		t.Fatalf("expected two run_deadline_exceeded pushes, got %d", pushed)
+	}
+}
+
+func TestOverdueRunCompletedBeforeSweepIsNotFailed(t *testing.T) {
+	ctx := context.Background()
+	db := helpers.NewTestSQLiteStore(t)
+	fake, addr := startFakeIngress(t)
+
+	clk := clock.NewFake(time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC))
+	svc := New(db, agentclient.NewClient(), ingress.NewClient(addr), llm.NewClient("", "", time.Second), &config.Config{}, nil, WithClock(clk))
+
+	deadline := clk.Now().Add(time.Minute)
+	if err := db.CreateSession(ctx, &domain.Session{SessionID: "s1", UserID: "u1", CreatedAt: clk.Now()}); err != nil {
+		t.Fatalf("CreateSession: %v", err)
+	}
+	if err := db.CreateRun(ctx, &domain.Run{RunID: "r1", SessionID: "s1", RootAgentID: "a1", Status: domain.RunStatusRunning, StartedAt: clk.Now(), DeadlineAt: &deadline}); err != nil {
+		t.Fatalf("CreateRun: %v", err)
+	}
+
+	// The run finishes between the sweep listing it and failing it.
+	clk.Advance(time.Minute)
+	runs, err := db.ListOverdueRuns(ctx, clk.Now(), 10)
+	if err != nil || len(runs) != 1 {
+		t.Fatalf("expected one overdue run, got %d (%v)", len(runs), err)
+	}
+	if err := db.UpdateRunCompleted(ctx, "r1", domain.RunStatusDone, nil); err != nil {
+		t.Fatalf("UpdateRunCompleted: %v", err)
+	}
+	svc.failOverdueRun(ctx, &runs[0])
+
+	run, err := db.GetRun(ctx, "r1")
+	if err != nil || run.Status != domain.RunStatusDone || run.Error != nil {
+		t.Fatalf("expected the run to stay DONE, got %+v (%v)", run, err)
+	}
+	events, err := db.GetEvents(ctx, "r1", 0, 0, nil, 10)
+	if err != nil || len(events) != 0 {
+		t.Fatalf("expected no events, got %+v (%v)", events, err)
+	}
+
+	// Pushes to a session are delivered in order, so once this one arrives
+	// any error push would have too.
+	svc.ingressClient.PushEvent("s1", map[string]interface{}{"type": "marker"})
+	waitForPushes(t, fake, 1)
+	fake.mu.Lock()
+	defer fake.mu.Unlock()
+	if len(fake.events) != 1 || fake.events[0].Event["type"] != "marker" {
+		t.Fatalf("expected no error push, got %+v", fake.events)
+	}
+}
@@ -0,0 +1,113 @@
+package service
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"github.com/xiaot623/gogo/orchestrator/internal/domain"
+)
+
+// runOutcomeEvents are the events that end a run.
+var runOutcomeEvents = []domain.EventType{
+	domain.EventTypeRunDone,
+	domain.EventTypeRunFailed,
+	domain.EventTypeRunCancelled,
+}
+
+// InvokeAgentAndWait invokes an agent like InvokeAgent, then blocks until the
+// run finishes, ctx is done, or wait elapses; wait is capped at InvokeWaitMax
+// (0 means the cap). A run still going when the wait ends is returned with its
+// current status rather than as an error.
+func (s *Service) InvokeAgentAndWait(ctx context.Context, req domain.InvokeRequest, wait time.Duration) (*domain.InvokeResult, error) {
+	if wait <= 0 || wait > s.config.InvokeWaitMax {
+		wait = s.config.InvokeWaitMax
+	}
+
+	resp, err := s.InvokeAgent(ctx, req)
+	if err != nil {
+		return nil, err
+	}
+
+	// Subscribe before the first look at the store so an outcome recorded in
+	// between still wakes us.
+	outcomes, unsubscribe := s.events.subscribe(resp.RunID, runOutcomeEvents...)
+	defer unsubscribe()
+
+	timer := time.NewTimer(wait)
+	defer timer.Stop()
+
+	for {
+		result, err := s.runOutcome(ctx, resp)
+		if err != nil {
+			return nil, err
+		}
+		// An ephemeral run's stored run_done lacks the final message, so
+		// wait for the published copy of it.
+		if isTerminalRunStatus(result.Status) && (result.Status != domain.RunStatusDone || !s.runEphemeral(ctx, resp.RunID)) {
+			return result, nil
+		}
+
+		select {
+		case event := <-outcomes:
+			if event.Type == domain.EventTypeRunDone {
+				return outcomeFromEvent(resp, event), nil
+			}
+		case <-timer.C:
+			return result, nil
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		}
+	}
+}
+
+// runOutcome reads how the invoked run ended from its outcome event, or its
+// current status if it has not ended yet.
+func (s *Service) runOutcome(ctx context.Context, resp *domain.InvokeResponse) (*domain.InvokeResult, error) {
+	result := &domain.InvokeResult{InvokeResponse: *resp}
+
+	types := make([]string, len(runOutcomeEvents))
+	for i, t := range runOutcomeEvents {
+		types[i] = string(t)
+	}
+	events, err := s.store.GetEvents(ctx, resp.RunID, 0, 0, types, 1)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get run outcome: %w", err)
+	}
+	if len(events) == 0 {
+		run, err := s.store.GetRun(ctx, resp.RunID)
+		if err != nil {
+			return nil, fmt.Errorf("failed to get run: %w", err)
+		}
+		if run == nil {
+			return nil, fmt.Errorf("run %s not found", resp.RunID)
+		}
+		result.Status = run.Status
+		return result, nil
+	}
+
+	return outcomeFromEvent(resp, events[0]), nil
+}
+
+// outcomeFromEvent builds the result of a run that ended with event.
+func outcomeFromEvent(resp *domain.InvokeResponse, event domain.Event) *domain.InvokeResult {
+	result := &domain.InvokeResult{InvokeResponse: *resp}
+	switch event.Type {
+	case domain.EventTypeRunDone:
+		var payload domain.RunDonePayload
+		_ = json.Unmarshal(event.Payload, &payload)
+		result.Status = domain.RunStatusDone
+		result.FinalMessage = payload.FinalMessage
+		result.Usage = payload.Usage
+		result.TotalTokens = payload.TotalTokens
+	case domain.EventTypeRunFailed:
+		var payload domain.RunFailedPayload
+		_ = json.Unmarshal(event.Payload, &payload)
+		result.Status = domain.RunStatusFailed
+		result.Error = &payload
+	default:
+		result.Status = domain.RunStatusCancelled
+	}
+	return result
+}
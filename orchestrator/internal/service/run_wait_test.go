@@ -0,0 +1,151 @@
+package service
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/xiaot623/gogo/orchestrator/internal/adapter/agentclient"
+	"github.com/xiaot623/gogo/orchestrator/internal/adapter/ingress"
+	"github.com/xiaot623/gogo/orchestrator/internal/adapter/llm"
+	"github.com/xiaot623/gogo/orchestrator/internal/config"
+	"github.com/xiaot623/gogo/orchestrator/internal/domain"
+	"github.com/xiaot623/gogo/orchestrator/tests/helpers"
+)
+
+func TestInvokeAgentAndWait(t *testing.T) {
+	ctx := context.Background()
+	db := helpers.NewTestSQLiteStore(t)
+
+	release := make(chan struct{})
+	agent := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/event-stream")
+		switch r.URL.Path {
+		case "/ok/invoke":
+			fmt.Fprint(w, "event: delta\ndata: {\"text\":\"hi\"}\n\n")
+			fmt.Fprint(w, "event: done\ndata: {\"final_message\":\"hi there\",\"usage\":{\"total_tokens\":7}}\n\n")
+		case "/broken/invoke":
+			fmt.Fprint(w, "event: error\ndata: {\"code\":\"boom\",\"message\":\"agent broke\"}\n\n")
+		default:
+			w.(http.Flusher).Flush()
+			select {
+			case <-release:
+			case <-r.Context().Done():
+			}
+		}
+	}))
+	defer agent.Close()
+	defer close(release) // before Close, which waits for the slow handler
+
+	cfg := &config.Config{AgentTimeout: time.Minute, InvokeWaitMax: time.Minute}
+	svc := New(db, agentclient.NewClient(), ingress.NewClient(""), llm.NewClient("", "", time.Second), cfg, nil)
+	for _, id := range []string{"ok", "broken", "slow"} {
+		if _, err := svc.RegisterAgent(ctx, id, id, agent.URL+"/"+id, nil, nil, "", "", "", 0, nil, nil); err != nil {
+			t.Fatalf("RegisterAgent: %v", err)
+		}
+	}
+	invoke := func(agentID string, wait time.Duration) *domain.InvokeResult {
+		t.Helper()
+		result, err := svc.InvokeAgentAndWait(ctx, domain.InvokeRequest{
+			SessionID:    "s1",
+			AgentID:      agentID,
+			InputMessage: domain.InputMessage{Role: "user", Content: "hi"},
+		}, wait)
+		if err != nil {
+			t.Fatalf("InvokeAgentAndWait(%s): %v", agentID, err)
+		}
+		return result
+	}
+
+	result := invoke("ok", 0)
+	if result.Status != domain.RunStatusDone || result.FinalMessage != "hi there" || result.RunID == "" {
+		t.Fatalf("unexpected result: %+v", result)
+	}
+	if result.Usage == nil || result.Usage.TotalTokens != 7 {
+		t.Fatalf("expected usage, got %+v", result.Usage)
+	}
+
+	result = invoke("broken", 0)
+	if result.Status != domain.RunStatusFailed || result.Error == nil || result.Error.Code != "boom" {
+		t.Fatalf("unexpected failed result: %+v", result)
+	}
+
+	start := time.Now()
+	result = invoke("slow", 50*time.Millisecond)
+	if result.Status != domain.RunStatusRunning || result.FinalMessage != "" {
+		t.Fatalf("expected a still-running result, got %+v", result)
+	}
+	if elapsed := time.Since(start); elapsed > 2*time.Second {
+		t.Fatalf("wait was not bounded: %v", elapsed)
+	}
+}
+
+// wordModerator blocks content containing word.
+type wordModerator struct {
+	word string
+}
+
+func (m wordModerator) Check(ctx context.Context, role, content string) (bool, string) {
+	if strings.Contains(content, m.word) {
+		return false, role + " content mentions " + m.word
+	}
+	return true, ""
+}
+
+func TestModerationBlocksInputAndOutput(t *testing.T) {
+	ctx := context.Background()
+	db := helpers.NewTestSQLiteStore(t)
+
+	var calls atomic.Int32
+	agent := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		calls.Add(1)
+		w.Header().Set("Content-Type", "text/event-stream")
+		fmt.Fprint(w, "event: done\ndata: {\"final_message\":\"the secret is 42\"}\n\n")
+	}))
+	defer agent.Close()
+
+	cfg := &config.Config{AgentTimeout: time.Minute, InvokeWaitMax: time.Minute, ModerationEnabled: true}
+	svc := New(db, agentclient.NewClient(), ingress.NewClient(""), llm.NewClient("", "", time.Second), cfg, nil, WithModerator(wordModerator{word: "secret"}))
+	if _, err := svc.RegisterAgent(ctx, "a1", "Agent", agent.URL, nil, nil, "", "", "", 0, nil, nil); err != nil {
+		t.Fatalf("RegisterAgent: %v", err)
+	}
+	invoke := func(content string) *domain.InvokeResult {
+		t.Helper()
+		result, err := svc.InvokeAgentAndWait(ctx, domain.InvokeRequest{
+			SessionID:    "s1",
+			AgentID:      "a1",
+			InputMessage: domain.InputMessage{Role: "user", Content: content},
+		}, 0)
+		if err != nil {
+			t.Fatalf("InvokeAgentAndWait: %v", err)
+		}
+		return result
+	}
+
+	// Blocked input fails the run before the agent is called.
+	result := invoke("tell me the secret")
+	if result.Status != domain.RunStatusFailed || result.Error == nil || result.Error.Code != "content_blocked" || result.Error.Message != "user content mentions secret" {
+		t.Fatalf("unexpected result for blocked input: %+v", result.Error)
+	}
+	if n := calls.Load(); n != 0 {
+		t.Fatalf("agent called %d times for blocked input", n)
+	}
+
+	// Blocked output fails the run and is not saved.
+	result = invoke("hello")
+	if result.Status != domain.RunStatusFailed || result.Error == nil || result.Error.Code != "content_blocked" || result.Error.Message != "assistant content mentions secret" {
+		t.Fatalf("unexpected result for blocked output: %+v", result.Error)
+	}
+	msgs, err := db.GetMessages(ctx, "s1", 10, "", domain.MessageFilter{})
+	if err != nil {
+		t.Fatalf("GetMessages: %v", err)
+	}
+	if len(msgs) != 1 || msgs[0].Content != "hello" {
+		t.Fatalf("expected only the allowed user message, got %+v", msgs)
+	}
+}
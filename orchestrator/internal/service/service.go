@@ -1,11 +1,21 @@
 package service
 
 import (
+	"log/slog"
+	"net/http"
+	"sync"
+	"sync/atomic"
+
 	"github.com/xiaot623/gogo/orchestrator/internal/adapter/agentclient"
 	"github.com/xiaot623/gogo/orchestrator/internal/adapter/ingress"
 	"github.com/xiaot623/gogo/orchestrator/internal/adapter/llm"
+	"github.com/xiaot623/gogo/orchestrator/internal/archive"
+	"github.com/xiaot623/gogo/orchestrator/internal/clock"
 	"github.com/xiaot623/gogo/orchestrator/internal/config"
+	"github.com/xiaot623/gogo/orchestrator/internal/idgen"
+	"github.com/xiaot623/gogo/orchestrator/internal/moderation"
 	"github.com/xiaot623/gogo/orchestrator/internal/repository"
+	"github.com/xiaot623/gogo/orchestrator/internal/tokenizer"
 	"github.com/xiaot623/gogo/orchestrator/internal/tools"
 	"github.com/xiaot623/gogo/orchestrator/policy"
 )
@@ -18,10 +28,78 @@ type Service struct {
 	config        *config.Config
 	policyEngine  *policy.Engine
 	toolRegistry  *tools.Registry
+	// toolHTTPClient calls the endpoints of http tools; calls are bounded by
+	// the tool call's timeout.
+	toolHTTPClient *http.Client
+	archiver       archive.Archiver
+	ids            idgen.Generator
+	clock          clock.Clock
+	tokens         tokenizer.Counter
+	moderator      moderation.Moderator
+	ready          atomic.Bool
+	streams        *streamPool
+	runCancels     sync.Map // run ID -> context.CancelFunc of its agent stream
+	eventSeqs      sync.Map // run ID -> *runEventSeq
+	ephemeralRuns  sync.Map // run ID -> bool, while its agent stream is live
+	partials       sync.Map // run ID -> *partialOutput, while its agent stream is live
+	events         *eventBus
+	batchers       *deltaBatcherSet
+	sinks          []eventSinkEntry
+	logger         *slog.Logger
+	flags          *flagSet
+	toolCounts     *toolCounters
+	acks           *eventAcks
+
+	policyErrorsAllowed atomic.Int64
+	policyErrorsBlocked atomic.Int64
+
+	// eventSeqsSweptAt is when idle event clocks were last evicted (unix ns).
+	eventSeqsSweptAt atomic.Int64
 }
 
 type Option func(*Service)
 
+// WithIDGenerator overrides how run, message, event and other IDs are
+// generated (e.g. idgen.NewSequence() for deterministic tests).
+func WithIDGenerator(ids idgen.Generator) Option {
+	return func(s *Service) {
+		if ids != nil {
+			s.ids = ids
+		}
+	}
+}
+
+// WithClock overrides the clock used for timestamps, TTLs and deadlines
+// (e.g. clock.NewFake for deterministic tests).
+func WithClock(c clock.Clock) Option {
+	return func(s *Service) {
+		if c != nil {
+			s.clock = c
+		}
+	}
+}
+
+// WithTokenCounter overrides how message tokens are counted for
+// /v1/tokenize and the MAX_HISTORY_TOKENS budget (e.g. a per-model
+// tokenizer).
+func WithTokenCounter(c tokenizer.Counter) Option {
+	return func(s *Service) {
+		if c != nil {
+			s.tokens = c
+		}
+	}
+}
+
+// WithModerator sets the moderator that screens user input and assistant
+// output when MODERATION_ENABLED is set; the default allows everything.
+func WithModerator(m moderation.Moderator) Option {
+	return func(s *Service) {
+		if m != nil {
+			s.moderator = m
+		}
+	}
+}
+
 // WithToolRegistry overrides the default tool executor registry.
 func WithToolRegistry(registry *tools.Registry) Option {
 	return func(s *Service) {
@@ -31,15 +109,48 @@ func WithToolRegistry(registry *tools.Registry) Option {
 	}
 }
 
+// WithLogger sets the structured logger; the default is slog.Default().
+func WithLogger(logger *slog.Logger) Option {
+	return func(s *Service) {
+		if logger != nil {
+			s.logger = logger
+		}
+	}
+}
+
+// WithArchiver sets where archived runs are written to and restored from.
+func WithArchiver(a archive.Archiver) Option {
+	return func(s *Service) {
+		s.archiver = a
+	}
+}
+
+// Logger returns the service's logger, for handlers built on the service.
+func (s *Service) Logger() *slog.Logger {
+	return s.logger
+}
+
 func New(store store.Store, agentClient *agentclient.Client, ingressClient *ingress.Client, llmClient llm.LLMClient, cfg *config.Config, policyEngine *policy.Engine, opts ...Option) *Service {
 	svc := &Service{
-		store:         store,
-		agentClient:   agentClient,
-		ingressClient: ingressClient,
-		llmClient:     llmClient,
-		config:        cfg,
-		policyEngine:  policyEngine,
-		toolRegistry:  tools.DefaultRegistry,
+		store:          store,
+		agentClient:    agentClient,
+		ingressClient:  ingressClient,
+		llmClient:      llmClient,
+		config:         cfg,
+		policyEngine:   policyEngine,
+		toolRegistry:   tools.DefaultRegistry,
+		toolHTTPClient: &http.Client{},
+		ids:            idgen.Default,
+		clock:          clock.Default,
+		tokens:         tokenizer.Default,
+		moderator:      moderation.Default,
+		streams:        newStreamPool(cfg.MaxAgentStreams, cfg.AgentStreamQueueDepth),
+		events:         newEventBus(),
+		batchers:       newDeltaBatcherSet(),
+		logger:         slog.Default(),
+		flags:          newFlagSet(cfg.Flags()),
+		toolCounts:     newToolCounters(),
+		acks:           newEventAcks(),
 	}
 	for _, opt := range opts {
 		opt(svc)
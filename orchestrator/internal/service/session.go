@@ -0,0 +1,85 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"github.com/xiaot623/gogo/orchestrator/internal/config"
+	"github.com/xiaot623/gogo/orchestrator/internal/domain"
+)
+
+// disconnectCancelReason is recorded on runs cancelled because their
+// session's client disconnected.
+const disconnectCancelReason = "client disconnected"
+
+// ErrInvalidCloseCode is returned when a disconnect asks for a WebSocket
+// close code that may not be sent in a close frame.
+var ErrInvalidCloseCode = errors.New("invalid WebSocket close code")
+
+// sendableCloseCode reports whether code may appear in a close frame
+// (RFC 6455 section 7.4: 1004-1006 and 1015 are reserved).
+func sendableCloseCode(code int) bool {
+	switch {
+	case code >= 1000 && code <= 1003, code >= 1007 && code <= 1014:
+		return true
+	default:
+		return code >= 3000 && code <= 4999
+	}
+}
+
+// DisconnectSession evicts a session's WebSocket connections through ingress,
+// sending each a close frame with code and reason. A zero code leaves the
+// choice to ingress. It returns the number of connections closed.
+func (s *Service) DisconnectSession(ctx context.Context, sessionID string, code int, reason string) (int, error) {
+	if code != 0 && !sendableCloseCode(code) {
+		return 0, ErrInvalidCloseCode
+	}
+	if s.ingressClient == nil {
+		return 0, nil
+	}
+
+	n, err := s.ingressClient.DisconnectSession(sessionID, code, reason)
+	if err != nil {
+		return 0, err
+	}
+	s.logger.InfoContext(ctx, "disconnected session connections", "session_id", sessionID, "connections", n, "reason", reason)
+	return n, nil
+}
+
+// SessionDisconnected handles ingress reporting that the last connection of a
+// session is gone. With the cancel_runs_on_disconnect flag the session's unfinished runs
+// are cancelled; otherwise they continue headless and the session's events are
+// not pushed to ingress until it invokes an agent again.
+func (s *Service) SessionDisconnected(ctx context.Context, sessionID string) (*domain.SessionDisconnectedResponse, error) {
+	if sessionID == "" {
+		return nil, fmt.Errorf("session_id is required")
+	}
+	resp := &domain.SessionDisconnectedResponse{SessionID: sessionID, CancelledRuns: []string{}}
+
+	if !s.flag(config.FlagCancelRunsOnDisconnect) {
+		if s.ingressClient != nil {
+			s.ingressClient.DetachSession(sessionID)
+		}
+		resp.Detached = true
+		s.logger.InfoContext(ctx, "session disconnected; runs continue without pushing events", "session_id", sessionID)
+		return resp, nil
+	}
+
+	runs, err := s.store.ListRuns(ctx, domain.RunFilter{SessionID: sessionID})
+	if err != nil {
+		return nil, fmt.Errorf("failed to list runs: %w", err)
+	}
+	for _, run := range runs {
+		if isTerminalRunStatus(run.Status) {
+			continue
+		}
+		if err := s.CancelRun(ctx, run.RunID, domain.CancelRunRequest{Reason: disconnectCancelReason, DecidedBy: "system"}); err != nil {
+			s.logger.ErrorContext(ctx, "failed to cancel run of disconnected session", "run_id", run.RunID, "session_id", sessionID, "error", err)
+			continue
+		}
+		resp.CancelledRuns = append(resp.CancelledRuns, run.RunID)
+	}
+	s.logger.InfoContext(ctx, "session disconnected; cancelled its runs", "session_id", sessionID, "cancelled_runs", len(resp.CancelledRuns))
+	return resp, nil
+}
@@ -0,0 +1,94 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/xiaot623/gogo/orchestrator/internal/adapter/agentclient"
+	"github.com/xiaot623/gogo/orchestrator/internal/adapter/ingress"
+	"github.com/xiaot623/gogo/orchestrator/internal/adapter/llm"
+	"github.com/xiaot623/gogo/orchestrator/internal/config"
+	"github.com/xiaot623/gogo/orchestrator/internal/domain"
+	"github.com/xiaot623/gogo/orchestrator/tests/helpers"
+)
+
+func TestDisconnectSession(t *testing.T) {
+	ctx := context.Background()
+	fake, addr := startFakeIngress(t)
+	svc := New(helpers.NewTestSQLiteStore(t), agentclient.NewClient(), ingress.NewClient(addr), llm.NewClient("", "", time.Second), &config.Config{}, nil)
+
+	n, err := svc.DisconnectSession(ctx, "s1", 4001, "session deleted")
+	if err != nil {
+		t.Fatalf("DisconnectSession: %v", err)
+	}
+	if n != 2 {
+		t.Fatalf("expected 2 connections closed, got %d", n)
+	}
+	fake.mu.Lock()
+	got := fake.disconnects
+	fake.mu.Unlock()
+	if len(got) != 1 || got[0].SessionID != "s1" || got[0].Code != 4001 || got[0].Reason != "session deleted" {
+		t.Fatalf("unexpected disconnect requests: %+v", got)
+	}
+
+	if _, err := svc.DisconnectSession(ctx, "s1", 1006, ""); !errors.Is(err, ErrInvalidCloseCode) {
+		t.Fatalf("expected ErrInvalidCloseCode, got %v", err)
+	}
+}
+
+func TestSessionDisconnected(t *testing.T) {
+	ctx := context.Background()
+	db := helpers.NewTestSQLiteStore(t)
+	if _, err := db.GetOrCreateSession(ctx, "s1", "u1"); err != nil {
+		t.Fatalf("GetOrCreateSession: %v", err)
+	}
+	for _, run := range []*domain.Run{
+		{RunID: "run_active", SessionID: "s1", RootAgentID: "a1", Status: domain.RunStatusRunning, StartedAt: time.Now()},
+		{RunID: "run_done", SessionID: "s1", RootAgentID: "a1", Status: domain.RunStatusDone, StartedAt: time.Now()},
+	} {
+		if err := db.CreateRun(ctx, run); err != nil {
+			t.Fatalf("CreateRun: %v", err)
+		}
+	}
+
+	// Headless (default): nothing is cancelled and pushes stop.
+	fake, addr := startFakeIngress(t)
+	ingressClient := ingress.NewClient(addr)
+	svc := New(db, agentclient.NewClient(), ingressClient, llm.NewClient("", "", time.Second), &config.Config{}, nil)
+	resp, err := svc.SessionDisconnected(ctx, "s1")
+	if err != nil {
+		t.Fatalf("SessionDisconnected: %v", err)
+	}
+	if !resp.Detached || len(resp.CancelledRuns) != 0 {
+		t.Fatalf("expected detached session, got %+v", resp)
+	}
+	if err := ingressClient.PushEvent("s1", map[string]interface{}{"type": "delta"}); err != nil {
+		t.Fatalf("PushEvent: %v", err)
+	}
+	if got := fake.eventTypes(); len(got) != 0 {
+		t.Fatalf("expected no events pushed to a detached session, got %v", got)
+	}
+	ingressClient.AttachSession("s1")
+	if err := ingressClient.PushEvent("s1", map[string]interface{}{"type": "delta"}); err != nil {
+		t.Fatalf("PushEvent: %v", err)
+	}
+	if got := fake.eventTypes(); len(got) != 1 {
+		t.Fatalf("expected pushes to resume after attach, got %v", got)
+	}
+
+	// Cancel on disconnect: only the unfinished run is cancelled.
+	svc = New(db, agentclient.NewClient(), ingress.NewClient(""), llm.NewClient("", "", time.Second), &config.Config{CancelRunsOnDisconnect: true}, nil)
+	resp, err = svc.SessionDisconnected(ctx, "s1")
+	if err != nil {
+		t.Fatalf("SessionDisconnected: %v", err)
+	}
+	if resp.Detached || len(resp.CancelledRuns) != 1 || resp.CancelledRuns[0] != "run_active" {
+		t.Fatalf("expected run_active cancelled, got %+v", resp)
+	}
+	run, err := db.GetRun(ctx, "run_active")
+	if err != nil || run.Status != domain.RunStatusCancelled {
+		t.Fatalf("expected run_active cancelled, got %+v (%v)", run, err)
+	}
+}
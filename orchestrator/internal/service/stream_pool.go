@@ -0,0 +1,246 @@
+package service
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"sync"
+	"sync/atomic"
+
+	"github.com/xiaot623/gogo/orchestrator/internal/domain"
+)
+
+// ErrAgentCapacity is returned by InvokeAgent when the maximum number of
+// concurrent agent streams is in flight and the wait queue is full. The
+// "capacity:" prefix lets RPC callers recognize it as retryable.
+var ErrAgentCapacity = errors.New("capacity: too many concurrent agent streams, retry later")
+
+// agentCapacityCode is the run_failed code of a run shed from the queue.
+const agentCapacityCode = "capacity"
+
+// StreamStats is a snapshot of agent stream concurrency.
+type StreamStats struct {
+	InFlight int64
+	Queued   int64
+	Max      int
+	Rejected uint64
+	// Shed counts queued runs failed to make room for a higher-priority one.
+	Shed uint64
+}
+
+// priorityRanks orders run priorities for the wait queue, highest first.
+var priorityRanks = []domain.RunPriority{domain.RunPriorityHigh, domain.RunPriorityNormal, domain.RunPriorityLow}
+
+// priorityRank is p's index in priorityRanks; unset means normal.
+func priorityRank(p domain.RunPriority) int {
+	for i, rank := range priorityRanks {
+		if rank == p {
+			return i
+		}
+	}
+	return 1
+}
+
+// streamPool bounds the number of concurrent outbound agent streams. Invokes
+// are admitted up front: they either take a free slot, join a bounded wait
+// queue, or are rejected with ErrAgentCapacity. Freed slots go to the
+// highest-priority queued run, oldest first. When the queue is full, a run
+// sheds the newest queued run of the lowest priority below its own, which
+// then fails with ErrAgentCapacity; with none to shed it is rejected. A max
+// of 0 means unlimited.
+type streamPool struct {
+	max      int
+	maxQueue int
+
+	mu       sync.Mutex
+	inFlight int64
+	queued   int64
+	queues   [][]*streamTicket // by priority rank
+	rejected atomic.Uint64
+	shed     atomic.Uint64
+}
+
+func newStreamPool(maxStreams, maxQueue int) *streamPool {
+	return &streamPool{max: maxStreams, maxQueue: maxQueue, queues: make([][]*streamTicket, len(priorityRanks))}
+}
+
+// streamTicket is an admitted stream. Exactly one of wait+release or release
+// alone (when the stream never starts) must be called. acquired and queued
+// are guarded by the pool's mutex once the ticket is queued.
+type streamTicket struct {
+	pool     *streamPool
+	rank     int
+	acquired bool
+	queued   bool
+	// granted receives nil when a queued ticket gets a slot, or
+	// ErrAgentCapacity when it is shed.
+	granted chan error
+	once    sync.Once
+}
+
+// admit takes a slot if one is free, otherwise queues the caller if the queue
+// has room or a lower-priority run can be shed.
+func (p *streamPool) admit(priority domain.RunPriority) (*streamTicket, error) {
+	t := &streamTicket{pool: p, rank: priorityRank(priority)}
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.max <= 0 || p.inFlight < int64(p.max) {
+		p.inFlight++
+		t.acquired = true
+		return t, nil
+	}
+	if p.queued >= int64(p.maxQueue) {
+		victim := p.lowestQueuedBelow(t.rank)
+		if victim == nil {
+			p.rejected.Add(1)
+			return nil, ErrAgentCapacity
+		}
+		p.dequeue(victim)
+		victim.granted <- ErrAgentCapacity
+		p.shed.Add(1)
+	}
+	t.queued = true
+	t.granted = make(chan error, 1)
+	p.queues[t.rank] = append(p.queues[t.rank], t)
+	p.queued++
+	return t, nil
+}
+
+// lowestQueuedBelow returns the newest queued ticket of the lowest priority
+// under rank, or nil. Callers hold p.mu.
+func (p *streamPool) lowestQueuedBelow(rank int) *streamTicket {
+	for r := len(p.queues) - 1; r > rank; r-- {
+		if q := p.queues[r]; len(q) > 0 {
+			return q[len(q)-1]
+		}
+	}
+	return nil
+}
+
+// dequeue removes a queued ticket from its queue. Callers hold p.mu.
+func (p *streamPool) dequeue(t *streamTicket) {
+	q := p.queues[t.rank]
+	for i, queued := range q {
+		if queued == t {
+			p.queues[t.rank] = append(q[:i], q[i+1:]...)
+			break
+		}
+	}
+	t.queued = false
+	p.queued--
+}
+
+// grant hands free slots to queued tickets, highest priority first. Callers
+// hold p.mu.
+func (p *streamPool) grant() {
+	for p.inFlight < int64(p.max) {
+		var next *streamTicket
+		for _, q := range p.queues {
+			if len(q) > 0 {
+				next = q[0]
+				break
+			}
+		}
+		if next == nil {
+			return
+		}
+		p.dequeue(next)
+		p.inFlight++
+		next.acquired = true
+		next.granted <- nil
+	}
+}
+
+// wait blocks until a queued ticket gets a slot or ctx is done. It returns
+// ErrAgentCapacity when the ticket was shed.
+func (t *streamTicket) wait(ctx context.Context) error {
+	if t.granted == nil {
+		return nil
+	}
+	select {
+	case err := <-t.granted:
+		return err
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// release frees the ticket's slot or queue position. It is safe to call more
+// than once.
+func (t *streamTicket) release() {
+	t.once.Do(func() {
+		p := t.pool
+		p.mu.Lock()
+		defer p.mu.Unlock()
+		if t.queued {
+			p.dequeue(t)
+		}
+		if t.acquired {
+			t.acquired = false
+			p.inFlight--
+			p.grant()
+		}
+	})
+}
+
+func (p *streamPool) stats() StreamStats {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return StreamStats{
+		InFlight: p.inFlight,
+		Queued:   p.queued,
+		Max:      p.max,
+		Rejected: p.rejected.Load(),
+		Shed:     p.shed.Load(),
+	}
+}
+
+// StreamStats reports agent stream concurrency for metrics.
+func (s *Service) StreamStats() StreamStats {
+	return s.streams.stats()
+}
+
+// trackRunCancel registers the cancel func of a run's agent stream so
+// CancelRun can abort it, and returns a func that unregisters it.
+func (s *Service) trackRunCancel(runID string, cancel context.CancelFunc) func() {
+	s.runCancels.Store(runID, cancel)
+	return func() { s.runCancels.Delete(runID) }
+}
+
+// cancelRunStream aborts a run's agent stream (queued or in flight), which
+// releases its slot.
+func (s *Service) cancelRunStream(runID string) {
+	if cancel, ok := s.runCancels.LoadAndDelete(runID); ok {
+		cancel.(context.CancelFunc)()
+	}
+}
+
+// failShedRun fails a run that was shed from the stream wait queue to make
+// room for a higher-priority one, before its agent was ever called.
+func (s *Service) failShedRun(ctx context.Context, runID, sessionID string) {
+	logger := s.logger.With("run_id", runID, "session_id", sessionID)
+	payload := domain.RunFailedPayload{Code: agentCapacityCode, Message: ErrAgentCapacity.Error()}
+	errData, _ := json.Marshal(payload)
+	if err := s.store.UpdateRunCompleted(ctx, runID, domain.RunStatusFailed, errData); err != nil {
+		logger.ErrorContext(ctx, "failed to fail shed run", "error", err)
+		return
+	}
+	logger.WarnContext(ctx, "run shed from the agent stream queue for a higher-priority run")
+
+	eventID, err := s.recordEventID(ctx, runID, domain.EventTypeRunFailed, payload)
+	if err != nil {
+		logger.ErrorContext(ctx, "failed to record run_failed event", "error", err)
+	}
+	if s.ingressClient != nil {
+		s.ingressClient.PushEvent(sessionID, map[string]interface{}{
+			"type":     "error",
+			"ts":       s.clock.Now().UnixMilli(),
+			"run_id":   runID,
+			"event_id": eventID,
+			"code":     payload.Code,
+			"message":  payload.Message,
+		})
+	}
+	s.recordRunSummary(ctx, runID, sessionID, domain.RunStatusFailed, "", &domain.RunSummaryError{Code: payload.Code, Message: payload.Message})
+}
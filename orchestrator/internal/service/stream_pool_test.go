@@ -0,0 +1,181 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/xiaot623/gogo/orchestrator/internal/adapter/agentclient"
+	"github.com/xiaot623/gogo/orchestrator/internal/adapter/ingress"
+	"github.com/xiaot623/gogo/orchestrator/internal/adapter/llm"
+	"github.com/xiaot623/gogo/orchestrator/internal/config"
+	"github.com/xiaot623/gogo/orchestrator/internal/domain"
+	"github.com/xiaot623/gogo/orchestrator/tests/helpers"
+)
+
+func TestStreamPoolAdmission(t *testing.T) {
+	p := newStreamPool(1, 1)
+
+	first, err := p.admit(domain.RunPriorityNormal)
+	if err != nil || !first.acquired {
+		t.Fatalf("expected first ticket to take the slot: %v", err)
+	}
+	second, err := p.admit(domain.RunPriorityNormal)
+	if err != nil || second.acquired {
+		t.Fatalf("expected second ticket to queue: %v", err)
+	}
+	if _, err := p.admit(domain.RunPriorityNormal); !errors.Is(err, ErrAgentCapacity) {
+		t.Fatalf("expected ErrAgentCapacity, got %v", err)
+	}
+	if stats := p.stats(); stats.InFlight != 1 || stats.Queued != 1 || stats.Rejected != 1 || stats.Max != 1 {
+		t.Fatalf("unexpected stats: %+v", stats)
+	}
+
+	first.release()
+	first.release() // idempotent
+	if err := second.wait(context.Background()); err != nil {
+		t.Fatalf("wait: %v", err)
+	}
+	if stats := p.stats(); stats.InFlight != 1 || stats.Queued != 0 {
+		t.Fatalf("unexpected stats after handoff: %+v", stats)
+	}
+	second.release()
+	if stats := p.stats(); stats.InFlight != 0 {
+		t.Fatalf("slot not released: %+v", stats)
+	}
+}
+
+func TestStreamPoolCancelledWhileQueued(t *testing.T) {
+	p := newStreamPool(1, 1)
+	first, _ := p.admit(domain.RunPriorityNormal)
+	defer first.release()
+
+	queued, err := p.admit(domain.RunPriorityNormal)
+	if err != nil {
+		t.Fatalf("admit: %v", err)
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if err := queued.wait(ctx); err == nil {
+		t.Fatal("expected wait to fail on a cancelled context")
+	}
+	queued.release()
+	if stats := p.stats(); stats.Queued != 0 || stats.InFlight != 1 {
+		t.Fatalf("unexpected stats: %+v", stats)
+	}
+}
+
+func TestStreamPoolPriority(t *testing.T) {
+	p := newStreamPool(1, 2)
+	running, _ := p.admit(domain.RunPriorityLow)
+
+	low, err := p.admit(domain.RunPriorityLow)
+	if err != nil || low.acquired {
+		t.Fatalf("expected low ticket to queue: %v", err)
+	}
+	normal, err := p.admit(domain.RunPriorityNormal)
+	if err != nil || normal.acquired {
+		t.Fatalf("expected normal ticket to queue: %v", err)
+	}
+
+	// With the queue full, a high invoke sheds the queued low run, and a
+	// low invoke has nothing below it to shed.
+	high, err := p.admit(domain.RunPriorityHigh)
+	if err != nil {
+		t.Fatalf("expected high ticket to shed the low one: %v", err)
+	}
+	if err := low.wait(context.Background()); !errors.Is(err, ErrAgentCapacity) {
+		t.Fatalf("expected shed ticket to fail with ErrAgentCapacity, got %v", err)
+	}
+	low.release()
+	if _, err := p.admit(domain.RunPriorityLow); !errors.Is(err, ErrAgentCapacity) {
+		t.Fatalf("expected ErrAgentCapacity, got %v", err)
+	}
+	if stats := p.stats(); stats.Queued != 2 || stats.Shed != 1 || stats.Rejected != 1 {
+		t.Fatalf("unexpected stats: %+v", stats)
+	}
+
+	// The freed slot goes to the high ticket although normal queued first.
+	running.release()
+	if err := high.wait(context.Background()); err != nil {
+		t.Fatalf("wait: %v", err)
+	}
+	if stats := p.stats(); stats.InFlight != 1 || stats.Queued != 1 {
+		t.Fatalf("unexpected stats after handoff: %+v", stats)
+	}
+	high.release()
+	if err := normal.wait(context.Background()); err != nil {
+		t.Fatalf("wait: %v", err)
+	}
+	normal.release()
+	if stats := p.stats(); stats.InFlight != 0 || stats.Queued != 0 {
+		t.Fatalf("unexpected final stats: %+v", stats)
+	}
+}
+
+func TestCancelRunReleasesStreamSlot(t *testing.T) {
+	ctx := context.Background()
+	db := helpers.NewTestSQLiteStore(t)
+
+	connected := make(chan struct{}, 1)
+	agent := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/event-stream")
+		w.WriteHeader(http.StatusOK)
+		w.(http.Flusher).Flush()
+		connected <- struct{}{}
+		<-r.Context().Done()
+	}))
+	defer agent.Close()
+
+	cfg := &config.Config{AgentTimeout: time.Minute, MaxAgentStreams: 1, AgentStreamQueueDepth: 0}
+	svc := New(db, agentclient.NewClient(), ingress.NewClient(""), llm.NewClient("", "", time.Second), cfg, nil)
+	if _, err := svc.RegisterAgent(ctx, "a1", "Agent", agent.URL, nil, nil, "", "", "", 0, nil, nil); err != nil {
+		t.Fatalf("RegisterAgent: %v", err)
+	}
+
+	invoke := func() (*domain.InvokeResponse, error) {
+		return svc.InvokeAgent(ctx, domain.InvokeRequest{
+			SessionID:    "s1",
+			AgentID:      "a1",
+			InputMessage: domain.InputMessage{Role: "user", Content: "hi"},
+		})
+	}
+
+	resp, err := invoke()
+	if err != nil {
+		t.Fatalf("InvokeAgent: %v", err)
+	}
+	select {
+	case <-connected:
+	case <-time.After(2 * time.Second):
+		t.Fatal("agent was never called")
+	}
+	if _, err := invoke(); !errors.Is(err, ErrAgentCapacity) {
+		t.Fatalf("expected ErrAgentCapacity while saturated, got %v", err)
+	}
+
+	if err := svc.CancelRun(ctx, resp.RunID, domain.CancelRunRequest{}); err != nil {
+		t.Fatalf("CancelRun: %v", err)
+	}
+	deadline := time.Now().Add(2 * time.Second)
+	for svc.StreamStats().InFlight != 0 {
+		if time.Now().After(deadline) {
+			t.Fatalf("slot not released after cancel: %+v", svc.StreamStats())
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	run, err := db.GetRun(ctx, resp.RunID)
+	if err != nil {
+		t.Fatalf("GetRun: %v", err)
+	}
+	if run.Status != domain.RunStatusCancelled {
+		t.Fatalf("expected run to stay CANCELLED, got %s", run.Status)
+	}
+	if _, err := invoke(); err != nil {
+		t.Fatalf("expected invoke to succeed once the slot is free: %v", err)
+	}
+}
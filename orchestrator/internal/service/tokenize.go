@@ -0,0 +1,44 @@
+package service
+
+import (
+	"github.com/xiaot623/gogo/orchestrator/internal/domain"
+	"github.com/xiaot623/gogo/orchestrator/internal/tokenizer"
+)
+
+// CountTokens returns the token count of each message and their total for
+// the model, so clients can check what fits its context before invoking.
+func (s *Service) CountTokens(req domain.TokenizeRequest) *domain.TokenizeResponse {
+	messages := make([]tokenizer.Message, len(req.Messages))
+	for i, m := range req.Messages {
+		messages[i] = tokenizer.Message{Role: m.Role, Content: m.Content}
+	}
+	counts, total := tokenizer.CountMessages(s.tokens, req.Model, messages)
+	return &domain.TokenizeResponse{
+		Model:     req.Model,
+		Tokenizer: s.tokens.Name(),
+		Messages:  counts,
+		Total:     total,
+	}
+}
+
+// trimHistoryToTokens drops the oldest messages until the rest fit
+// MaxHistoryTokens (0 = no budget). The newest message, the run's input, is
+// always kept.
+func (s *Service) trimHistoryToTokens(model string, messages []domain.Message) []domain.Message {
+	budget := s.config.MaxHistoryTokens
+	if budget <= 0 || len(messages) == 0 {
+		return messages
+	}
+	history := make([]tokenizer.Message, len(messages))
+	for i, m := range messages {
+		history[i] = tokenizer.Message{Role: m.Role, Content: m.Content}
+	}
+	counts, total := tokenizer.CountMessages(s.tokens, model, history)
+
+	start := 0
+	for total > budget && start < len(messages)-1 {
+		total -= counts[start]
+		start++
+	}
+	return messages[start:]
+}
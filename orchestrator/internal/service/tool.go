@@ -3,16 +3,41 @@ package service
 import (
 	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"time"
 
-	"github.com/google/uuid"
 	"github.com/xiaot623/gogo/orchestrator/internal/domain"
+	"github.com/xiaot623/gogo/orchestrator/internal/jsonschema"
+	"github.com/xiaot623/gogo/orchestrator/internal/telemetry"
+	"go.opentelemetry.io/otel/attribute"
 )
 
 const toolInvokeIdempotencyTTL = 24 * time.Hour
 
+// ErrNotClientTool is returned when a result is submitted for a tool call that
+// the orchestrator executes itself.
+var ErrNotClientTool = errors.New("results can only be submitted for client tools")
+
+// ErrInvalidResultSchema is returned when a tool is registered with a
+// result_schema that is not a usable JSON Schema.
+var ErrInvalidResultSchema = errors.New("invalid result_schema")
+
+// InvokeTool invokes a tool for a run. It fails with ErrMaintenance while
+// read-only; tool calls the orchestrator makes itself on behalf of a running
+// agent go through invokeTool, so in-flight runs can finish.
 func (s *Service) InvokeTool(ctx context.Context, toolName string, req domain.ToolInvokeRequest) (*domain.ToolInvokeResponse, error) {
+	if err := s.checkWritable(); err != nil {
+		return nil, err
+	}
+	return s.invokeTool(ctx, toolName, req)
+}
+
+func (s *Service) invokeTool(ctx context.Context, toolName string, req domain.ToolInvokeRequest) (*domain.ToolInvokeResponse, error) {
+	ctx, span := telemetry.Tracer().Start(ctx, "InvokeTool")
+	defer span.End()
+	span.SetAttributes(attribute.String("tool_name", toolName), attribute.String("run_id", req.RunID))
+
 	// 1. Get Run and User ID (for policy)
 	run, err := s.store.GetRun(ctx, req.RunID)
 	if err != nil {
@@ -21,6 +46,9 @@ func (s *Service) InvokeTool(ctx context.Context, toolName string, req domain.To
 	if run == nil {
 		return nil, fmt.Errorf("run not found")
 	}
+	if err := s.enforceRunDeadline(ctx, run); err != nil {
+		return nil, err
+	}
 
 	session, err := s.store.GetSession(ctx, run.SessionID)
 	if err != nil {
@@ -32,10 +60,13 @@ func (s *Service) InvokeTool(ctx context.Context, toolName string, req domain.To
 		if err != nil {
 			return nil, fmt.Errorf("failed to check tool idempotency: %w", err)
 		}
-		if existing != nil && time.Since(existing.CreatedAt) <= toolInvokeIdempotencyTTL {
+		if existing != nil && s.clock.Now().Sub(existing.CreatedAt) <= toolInvokeIdempotencyTTL {
 			return toolInvokeResponseFromToolCall(existing), nil
 		}
 	}
+	if err := s.checkToolCallLimit(ctx, run); err != nil {
+		return nil, err
+	}
 
 	// 2. Get Tool
 	tool, err := s.store.GetTool(ctx, toolName)
@@ -47,26 +78,22 @@ func (s *Service) InvokeTool(ctx context.Context, toolName string, req domain.To
 	}
 
 	// 3. Policy Check via OPA
-	policyInput := map[string]interface{}{
-		"tool_name": toolName,
-		"user_id":   session.UserID,
-	}
-	var argsMap map[string]interface{}
-	if len(req.Args) > 0 {
-		if err := json.Unmarshal(req.Args, &argsMap); err == nil {
-			policyInput["args"] = argsMap
-		}
-	} else {
-		policyInput["args"] = map[string]interface{}{}
+	decision, reason, policyErr := s.evaluateToolPolicy(ctx, toolName, req.RunID, policyInput(toolName, session.UserID, sessionClientMeta(session), req.Args))
+	var policyErrMsg string
+	if policyErr != nil {
+		policyErrMsg = policyErr.Error()
 	}
+	span.SetAttributes(attribute.String("decision", decision))
 
-	decision, reason, err := s.policyEngine.Evaluate(ctx, policyInput)
-	if err != nil {
-		return nil, fmt.Errorf("policy evaluation failed: %w", err)
+	// A remembered approval stands in for prompting the user again. Block
+	// decisions are never overridden.
+	var remembered *domain.RememberedApproval
+	if decision == "require_approval" {
+		remembered = s.findRememberedApproval(ctx, session, toolName)
 	}
 
-	toolCallID := "tc_" + uuid.New().String()
-	now := time.Now()
+	toolCallID := s.ids.New("tc")
+	now := s.clock.Now()
 	timeoutMs := tool.TimeoutMs
 	if req.TimeoutMs > 0 {
 		timeoutMs = req.TimeoutMs
@@ -98,15 +125,23 @@ func (s *Service) InvokeTool(ctx context.Context, toolName string, req domain.To
 		toolCall.Error = errData
 		completedAt := now
 		toolCall.CompletedAt = &completedAt
-		_ = s.store.CreateToolCall(ctx, toolCall)
+		if existing, err := s.createToolCall(ctx, toolCall); err != nil {
+			return nil, err
+		} else if existing != nil {
+			return toolInvokeResponseFromToolCall(existing), nil
+		}
+		s.countToolInvocation(toolName, decision)
+		s.countToolResult(toolName, domain.ToolCallStatusBlocked)
 
 		// Record policy decision event
 		payload := domain.PolicyDecisionPayload{
 			ToolCallID: toolCallID,
 			Decision:   "block",
 			Reason:     reason,
+			Error:      policyErrMsg,
 		}
-		s.recordEvent(ctx, req.RunID, domain.EventTypePolicyDecision, payload)
+		eventID, _ := s.recordEventID(ctx, req.RunID, domain.EventTypePolicyDecision, payload)
+		s.pushPolicyBlocked(session.SessionID, req.RunID, eventID, toolCallID, toolName, reason, now.UnixMilli())
 
 		return &domain.ToolInvokeResponse{
 			Status:     "failed",
@@ -115,11 +150,16 @@ func (s *Service) InvokeTool(ctx context.Context, toolName string, req domain.To
 		}, nil
 	}
 
-	if decision == "require_approval" {
+	if decision == "require_approval" && remembered == nil {
 		toolCall.Status = domain.ToolCallStatusWaitingApproval
-		_ = s.store.CreateToolCall(ctx, toolCall)
+		if existing, err := s.createToolCall(ctx, toolCall); err != nil {
+			return nil, err
+		} else if existing != nil {
+			return toolInvokeResponseFromToolCall(existing), nil
+		}
+		s.countToolInvocation(toolName, decision)
 
-		approvalID := "ap_" + uuid.New().String()
+		approvalID := s.ids.New("ap")
 		approval := &domain.Approval{
 			ApprovalID: approvalID,
 			RunID:      req.RunID,
@@ -135,10 +175,11 @@ func (s *Service) InvokeTool(ctx context.Context, toolName string, req domain.To
 			ApprovalID:  approvalID,
 			ToolCallID:  toolCallID,
 			ToolName:    toolName,
-			ArgsSummary: "Approval required for " + toolName, // Simplification
+			ArgsSummary: approvalSummary(tool, req.Args),
 			Args:        req.Args,
+			ArgsPreview: approvalArgsPreview(req.Args),
 		}
-		s.recordEvent(ctx, req.RunID, domain.EventTypeApprovalRequired, payload)
+		eventID, _ := s.recordEventID(ctx, req.RunID, domain.EventTypeApprovalRequired, payload)
 
 		// Push to ingress
 		// We need to push the approval request to the client
@@ -149,10 +190,13 @@ func (s *Service) InvokeTool(ctx context.Context, toolName string, req domain.To
 				"type":         "approval_required",
 				"ts":           now.UnixMilli(),
 				"run_id":       req.RunID,
+				"event_id":     eventID,
 				"approval_id":  approvalID,
 				"tool_call_id": toolCallID,
 				"tool_name":    toolName,
-				"args_summary": "Approval required for " + toolName,
+				"args_summary": payload.ArgsSummary,
+				"args":         argsObj,
+				"args_preview": payload.ArgsPreview,
 			})
 		}
 
@@ -165,10 +209,27 @@ func (s *Service) InvokeTool(ctx context.Context, toolName string, req domain.To
 
 	// Decision: allow
 	toolCall.Status = domain.ToolCallStatusDispatched
-	if tool.Kind == domain.ToolKindServer {
+	if tool.Kind.RunsOnServer() {
 		toolCall.Status = domain.ToolCallStatusRunning
 	}
-	_ = s.store.CreateToolCall(ctx, toolCall)
+	if existing, err := s.createToolCall(ctx, toolCall); err != nil {
+		return nil, err
+	} else if existing != nil {
+		return toolInvokeResponseFromToolCall(existing), nil
+	}
+	s.countToolInvocation(toolName, decision)
+	if remembered != nil {
+		s.applyRememberedApproval(ctx, toolCall, remembered)
+	}
+	if policyErr != nil {
+		// Allowed only because POLICY_FAIL_MODE is open; keep a record.
+		s.recordEvent(ctx, req.RunID, domain.EventTypePolicyDecision, domain.PolicyDecisionPayload{
+			ToolCallID: toolCallID,
+			Decision:   "allow",
+			Reason:     reason,
+			Error:      policyErrMsg,
+		})
+	}
 
 	// Execute Logic
 	if tool.Kind == domain.ToolKindClient {
@@ -179,21 +240,11 @@ func (s *Service) InvokeTool(ctx context.Context, toolName string, req domain.To
 			Args:       req.Args,
 			DeadlineTs: now.Add(time.Duration(timeoutMs) * time.Millisecond).UnixMilli(),
 		}
-		s.recordEvent(ctx, req.RunID, domain.EventTypeToolRequest, payload)
+		eventID, _ := s.recordEventID(ctx, req.RunID, domain.EventTypeToolRequest, payload)
 
 		// Push to ingress
-		if s.ingressClient != nil {
-			var argsObj interface{}
-			json.Unmarshal(req.Args, &argsObj)
-			s.ingressClient.PushEvent(session.SessionID, map[string]interface{}{
-				"type":         "tool_request",
-				"ts":           now.UnixMilli(),
-				"run_id":       req.RunID,
-				"tool_call_id": toolCallID,
-				"tool_name":    toolName,
-				"args":         argsObj,
-				"deadline_ts":  now.Add(time.Duration(timeoutMs) * time.Millisecond).UnixMilli(),
-			})
+		if err := s.pushToolRequest(session.SessionID, req.RunID, eventID, toolCallID, toolName, req.Args, now.UnixMilli(), payload.DeadlineTs); err != nil {
+			s.logger.ErrorContext(ctx, "failed to push tool_request", "tool_call_id", toolCallID, "run_id", req.RunID, "error", err)
 		}
 
 		return &domain.ToolInvokeResponse{
@@ -204,7 +255,7 @@ func (s *Service) InvokeTool(ctx context.Context, toolName string, req domain.To
 	}
 
 	// Server Tool Execution (Async)
-	go s.executeServerToolAsync(toolCall, tool)
+	go s.executeServerToolAsync(telemetry.Detach(ctx), toolCall, tool)
 
 	return &domain.ToolInvokeResponse{
 		Status:     "pending",
@@ -213,8 +264,44 @@ func (s *Service) InvokeTool(ctx context.Context, toolName string, req domain.To
 	}, nil
 }
 
+// pushPolicyBlocked tells the session that policy blocked a tool call, so
+// clients can show it as a denied action rather than a generic failure.
+func (s *Service) pushPolicyBlocked(sessionID, runID, eventID, toolCallID, toolName, reason string, nowMs int64) {
+	if s.ingressClient == nil {
+		return
+	}
+	if err := s.ingressClient.PushEvent(sessionID, map[string]interface{}{
+		"type":         "policy_blocked",
+		"ts":           nowMs,
+		"run_id":       runID,
+		"event_id":     eventID,
+		"tool_call_id": toolCallID,
+		"tool_name":    toolName,
+		"reason":       reason,
+	}); err != nil {
+		s.logger.Warn("failed to push policy_blocked", "session_id", sessionID, "run_id", runID, "tool_call_id", toolCallID, "error", err)
+	}
+}
+
+// createToolCall persists a new tool call. Keyed invokes are inserted
+// conditionally: if a concurrent invoke with the same idempotency key got there
+// first, its tool call is returned and the caller must not dispatch again.
+func (s *Service) createToolCall(ctx context.Context, toolCall *domain.ToolCall) (*domain.ToolCall, error) {
+	existing, err := s.store.CreateToolCallIdempotent(ctx, toolCall, toolInvokeIdempotencyTTL)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create tool call: %w", err)
+	}
+	return existing, nil
+}
+
 // executeServerToolAsync executes a server tool asynchronously.
-func (s *Service) executeServerToolAsync(toolCall *domain.ToolCall, tool *domain.Tool) {
+func (s *Service) executeServerToolAsync(parent context.Context, toolCall *domain.ToolCall, tool *domain.Tool) {
+	// Client tools are completed via SubmitToolResult only.
+	if !toolCall.Kind.RunsOnServer() {
+		s.logger.ErrorContext(parent, "refusing to execute non-server tool call on the server", "kind", toolCall.Kind, "tool_call_id", toolCall.ToolCallID, "tool_name", toolCall.ToolName, "run_id", toolCall.RunID)
+		return
+	}
+
 	timeoutMs := toolCall.TimeoutMs
 	if timeoutMs <= 0 {
 		timeoutMs = tool.TimeoutMs
@@ -226,25 +313,33 @@ func (s *Service) executeServerToolAsync(toolCall *domain.ToolCall, tool *domain
 		timeoutMs = 60000
 	}
 
-	ctx, cancel := context.WithTimeout(context.Background(), time.Duration(timeoutMs)*time.Millisecond)
+	ctx, cancel := context.WithTimeout(parent, time.Duration(timeoutMs)*time.Millisecond)
 	defer cancel()
 
+	ctx, span := telemetry.Tracer().Start(ctx, "executeServerTool")
+	defer span.End()
+	span.SetAttributes(
+		attribute.String("tool_name", tool.Name),
+		attribute.String("tool_call_id", toolCall.ToolCallID),
+		attribute.String("run_id", toolCall.RunID),
+	)
+	status := domain.ToolCallStatusSucceeded
+	defer func() { span.SetAttributes(attribute.String("status", string(status))) }()
+
 	// Update status to RUNNING
 	_, _ = s.store.UpdateToolCallStatus(ctx, toolCall.ToolCallID, domain.ToolCallStatusRunning)
 
-	// Execute tool logic via the executor registry.
-	type execResult struct {
-		result json.RawMessage
-		err    error
-	}
-	resultCh := make(chan execResult, 1)
+	// Execute tool logic via the executor registry or the tool's endpoint.
+	// ctx is cancelled on timeout, which aborts the executor's work.
+	resultCh := make(chan toolExecResult, 1)
 	go func() {
-		res, err := s.executeServerTool(ctx, tool.Name, toolCall.Args)
-		resultCh <- execResult{result: res, err: err}
+		res, err := s.executeServerTool(ctx, toolCall, tool)
+		resultCh <- toolExecResult{result: res, err: err}
 	}()
 
 	select {
 	case <-ctx.Done():
+		status = domain.ToolCallStatusTimeout
 		errData, _ := json.Marshal(map[string]interface{}{
 			"code":       "timeout",
 			"message":    "tool execution timeout",
@@ -252,6 +347,7 @@ func (s *Service) executeServerToolAsync(toolCall *domain.ToolCall, tool *domain
 		})
 		updated, err := s.store.UpdateToolCallResult(context.Background(), toolCall.ToolCallID, domain.ToolCallStatusTimeout, nil, errData)
 		if err == nil && updated {
+			s.countToolResult(toolCall.ToolName, domain.ToolCallStatusTimeout)
 			payload := domain.ToolResultPayload{
 				ToolCallID: toolCall.ToolCallID,
 				Status:     domain.ToolCallStatusTimeout,
@@ -259,19 +355,35 @@ func (s *Service) executeServerToolAsync(toolCall *domain.ToolCall, tool *domain
 			}
 			s.recordEvent(context.Background(), toolCall.RunID, domain.EventTypeToolResult, payload)
 		}
+		go s.watchAbandonedTool(toolCall, resultCh)
 		return
 	case out := <-resultCh:
 		result, err := out.result, out.err
 		// Update result
 		if err != nil {
-			errData, _ := json.Marshal(map[string]string{
-				"code":    "execution_error",
-				"message": err.Error(),
-			})
+			status = domain.ToolCallStatusFailed
+			span.RecordError(err)
+			errData := toolExecutionError(err)
+			updated, updErr := s.store.UpdateToolCallResult(context.Background(), toolCall.ToolCallID, domain.ToolCallStatusFailed, nil, errData)
+			if updErr != nil || !updated {
+				return
+			}
+			s.countToolResult(toolCall.ToolName, domain.ToolCallStatusFailed)
+
+			// Emit result event
+			payload := domain.ToolResultPayload{
+				ToolCallID: toolCall.ToolCallID,
+				Status:     domain.ToolCallStatusFailed,
+				Error:      errData,
+			}
+			s.recordEvent(context.Background(), toolCall.RunID, domain.EventTypeToolResult, payload)
+		} else if errData := s.invalidToolResult(ctx, tool, result); errData != nil {
+			status = domain.ToolCallStatusFailed
 			updated, updErr := s.store.UpdateToolCallResult(context.Background(), toolCall.ToolCallID, domain.ToolCallStatusFailed, nil, errData)
 			if updErr != nil || !updated {
 				return
 			}
+			s.countToolResult(toolCall.ToolName, domain.ToolCallStatusFailed)
 
 			// Emit result event
 			payload := domain.ToolResultPayload{
@@ -285,6 +397,7 @@ func (s *Service) executeServerToolAsync(toolCall *domain.ToolCall, tool *domain
 			if updErr != nil || !updated {
 				return
 			}
+			s.countToolResult(toolCall.ToolName, domain.ToolCallStatusSucceeded)
 
 			// Emit result event
 			payload := domain.ToolResultPayload{
@@ -297,12 +410,67 @@ func (s *Service) executeServerToolAsync(toolCall *domain.ToolCall, tool *domain
 	}
 }
 
-// executeServerTool executes a server-side tool via the executor registry.
-func (s *Service) executeServerTool(ctx context.Context, toolName string, args json.RawMessage) (json.RawMessage, error) {
+// toolExecResult is the outcome of a server tool executor.
+type toolExecResult struct {
+	result json.RawMessage
+	err    error
+}
+
+// abandonedToolGrace is how long a timed-out executor has to return after its
+// context is cancelled before it is reported as ignoring cancellation.
+const abandonedToolGrace = 5 * time.Second
+
+// watchAbandonedTool waits for the executor of a timed-out tool call to
+// return and warns when it does not within abandonedToolGrace, since its
+// goroutine then leaks until it does. Its result is discarded either way.
+func (s *Service) watchAbandonedTool(toolCall *domain.ToolCall, resultCh <-chan toolExecResult) {
+	logger := s.logger.With("tool_call_id", toolCall.ToolCallID, "tool_name", toolCall.ToolName, "run_id", toolCall.RunID)
+	timer := time.NewTimer(abandonedToolGrace)
+	defer timer.Stop()
+	select {
+	case out := <-resultCh:
+		logger.Debug("timed-out tool executor returned", "error", out.err)
+	case <-timer.C:
+		logger.Warn("tool executor still running after timeout; it does not honor cancellation", "grace", abandonedToolGrace)
+		out := <-resultCh
+		logger.Warn("abandoned tool executor returned", "error", out.err)
+	}
+}
+
+// executeServerTool executes a server-side tool: http tools call their
+// endpoint, others go through the executor registry. Both are given ctx and
+// stop when it is cancelled.
+func (s *Service) executeServerTool(ctx context.Context, toolCall *domain.ToolCall, tool *domain.Tool) (json.RawMessage, error) {
+	if tool.Kind == domain.ToolKindHTTP {
+		return s.executeHTTPTool(ctx, toolCall, tool)
+	}
 	if s.toolRegistry == nil {
 		return nil, fmt.Errorf("tool registry not configured")
 	}
-	return s.toolRegistry.Execute(ctx, toolName, args)
+	return s.toolRegistry.Execute(ctx, tool.Name, toolCall.Args)
+}
+
+// invalidToolResult checks a successful result against the tool's
+// result_schema. It returns the error to store on the tool call when the
+// result does not match, or nil when it matches or the tool has no schema.
+func (s *Service) invalidToolResult(ctx context.Context, tool *domain.Tool, result json.RawMessage) json.RawMessage {
+	if tool == nil || len(tool.ResultSchema) == 0 {
+		return nil
+	}
+	violations, err := jsonschema.Validate(ctx, tool.ResultSchema, result)
+	if err != nil {
+		s.logger.WarnContext(ctx, "skipping result validation", "tool_name", tool.Name, "error", err)
+		return nil
+	}
+	if len(violations) == 0 {
+		return nil
+	}
+	errData, _ := json.Marshal(map[string]interface{}{
+		"code":       "invalid_result",
+		"message":    "tool result does not match result_schema",
+		"violations": violations,
+	})
+	return errData
 }
 
 func (s *Service) GetToolCall(ctx context.Context, toolCallID string) (*domain.ToolCall, error) {
@@ -351,7 +519,28 @@ func isTerminalStatus(status domain.ToolCallStatus) bool {
 	return false
 }
 
+// SubmitToolResult completes a client tool call. A submission resent with the
+// same nonce gets the first one's response.
 func (s *Service) SubmitToolResult(ctx context.Context, toolCallID string, req domain.ToolCallResultRequest) (*domain.ToolCallResultResponse, error) {
+	claimed, replay, err := s.claimNonce(ctx, domain.NonceKindToolResult, req.Nonce, toolCallID)
+	if err != nil {
+		return nil, err
+	}
+	if replay != nil {
+		var resp domain.ToolCallResultResponse
+		if err := json.Unmarshal(replay, &resp); err != nil {
+			return nil, fmt.Errorf("failed to decode replayed response: %w", err)
+		}
+		return &resp, nil
+	}
+	resp, err := s.submitToolResult(ctx, toolCallID, req)
+	if claimed {
+		s.finishNonce(ctx, domain.NonceKindToolResult, req.Nonce, resp, err)
+	}
+	return resp, err
+}
+
+func (s *Service) submitToolResult(ctx context.Context, toolCallID string, req domain.ToolCallResultRequest) (*domain.ToolCallResultResponse, error) {
 	// Get tool call
 	tc, err := s.store.GetToolCall(ctx, toolCallID)
 	if err != nil {
@@ -361,6 +550,12 @@ func (s *Service) SubmitToolResult(ctx context.Context, toolCallID string, req d
 		return nil, fmt.Errorf("tool call not found")
 	}
 
+	// Server tools are executed internally; their results can't be supplied
+	// from outside.
+	if tc.Kind != domain.ToolKindClient {
+		return nil, fmt.Errorf("tool call %s (%s): %w", tc.ToolCallID, tc.ToolName, ErrNotClientTool)
+	}
+
 	// Check if already in terminal state (idempotency)
 	if isTerminalStatus(tc.Status) {
 		var completedAt int64
@@ -389,8 +584,34 @@ func (s *Service) SubmitToolResult(ctx context.Context, toolCallID string, req d
 		newStatus = domain.ToolCallStatusFailed
 	}
 
+	// Results that don't match the tool's result_schema fail the call
+	if newStatus == domain.ToolCallStatusSucceeded {
+		tool, err := s.store.GetTool(ctx, tc.ToolName)
+		if err != nil {
+			return nil, fmt.Errorf("failed to get tool: %w", err)
+		}
+		if errData := s.invalidToolResult(ctx, tool, req.Result); errData != nil {
+			s.logger.WarnContext(ctx, "tool result does not match result_schema", "tool_call_id", tc.ToolCallID, "tool_name", tc.ToolName, "run_id", tc.RunID)
+			newStatus = domain.ToolCallStatusFailed
+			req.Result = nil
+			req.Error = errData
+		}
+	}
+
+	// Enforce the result size limit
+	result := req.Result
+	truncated := false
+	if limit := s.toolResultLimit(ctx, tc.ToolName); limit > 0 && len(result) > limit {
+		if !s.overflowTruncates() {
+			return nil, fmt.Errorf("tool call %s (%s): %d bytes, limit %d: %w", tc.ToolCallID, tc.ToolName, len(result), limit, ErrResultTooLarge)
+		}
+		s.logger.WarnContext(ctx, "truncating tool result", "tool_call_id", tc.ToolCallID, "tool_name", tc.ToolName, "run_id", tc.RunID, "bytes", len(result), "limit", limit)
+		result = s.truncateToolResult(req.Result)
+		truncated = true
+	}
+
 	// Update tool call result
-	updated, err := s.store.UpdateToolCallResult(ctx, toolCallID, newStatus, req.Result, req.Error)
+	updated, err := s.store.UpdateToolCallResult(ctx, toolCallID, newStatus, result, req.Error)
 	if err != nil {
 		return nil, fmt.Errorf("failed to update tool call: %w", err)
 	}
@@ -415,20 +636,24 @@ func (s *Service) SubmitToolResult(ctx context.Context, toolCallID string, req d
 		}, nil
 	}
 
+	s.countToolResult(tc.ToolName, newStatus)
+
 	// Record event
-	now := time.Now()
+	now := s.clock.Now()
 	payload := domain.ToolResultPayload{
 		ToolCallID: toolCallID,
 		Status:     newStatus,
-		Result:     req.Result,
+		Result:     result,
 		Error:      req.Error,
+		Truncated:  truncated,
 	}
-	s.recordEvent(ctx, tc.RunID, domain.EventTypeToolResult, payload)
+	eventID, _ := s.recordEventID(ctx, tc.RunID, domain.EventTypeToolResult, payload)
+	s.pushToolResult(ctx, tc, eventID, newStatus, req.Result, req.Error, now.UnixMilli())
 
 	return &domain.ToolCallResultResponse{
 		ToolCallID:  toolCallID,
 		Status:      newStatus,
-		Result:      req.Result,
+		Result:      result,
 		Error:       req.Error,
 		CompletedAt: now.UnixMilli(),
 	}, nil
@@ -439,17 +664,33 @@ func (s *Service) ListTools(ctx context.Context) ([]domain.Tool, error) {
 	return s.store.ListTools(ctx)
 }
 
-// RegisterTools registers tools from a client.
+// RegisterTools registers client tools, and http tools that the orchestrator
+// executes by calling their endpoint. It fails with ErrMaintenance while
+// read-only.
 func (s *Service) RegisterTools(ctx context.Context, req domain.ToolRegistrationRequest) (*domain.ToolRegistrationResponse, error) {
+	if err := s.checkWritable(); err != nil {
+		return nil, err
+	}
 	registeredCount := 0
 
 	for _, t := range req.Tools {
+		kind, err := validateToolRegistration(t)
+		if err != nil {
+			return nil, err
+		}
+		if len(t.ResultSchema) > 0 {
+			if _, err := jsonschema.Validate(ctx, t.ResultSchema, nil); err != nil {
+				return nil, fmt.Errorf("tool %s: %w: %v", t.Name, ErrInvalidResultSchema, err)
+			}
+		}
 		tool := &domain.Tool{
-			Name:      t.Name,
-			Kind:      domain.ToolKindClient,
-			Schema:    t.Schema,
-			ClientID:  req.ClientID,
-			TimeoutMs: t.TimeoutMs,
+			Name:         t.Name,
+			Kind:         kind,
+			Schema:       t.Schema,
+			ResultSchema: t.ResultSchema,
+			ClientID:     req.ClientID,
+			TimeoutMs:    t.TimeoutMs,
+			Metadata:     t.Metadata,
 		}
 		// Default timeout if not specified
 		if tool.TimeoutMs == 0 {
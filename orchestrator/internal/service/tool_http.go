@@ -0,0 +1,91 @@
+package service
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+
+	"github.com/xiaot623/gogo/orchestrator/internal/domain"
+	"github.com/xiaot623/gogo/orchestrator/internal/tools"
+)
+
+// ErrInvalidTool is returned when a tool registration has an unknown kind or
+// an http tool lacks a valid endpoint.
+var ErrInvalidTool = errors.New("invalid tool")
+
+// validateToolRegistration checks a tool's kind and, for http tools, the
+// endpoint in its metadata. An empty kind registers a client tool.
+func validateToolRegistration(t domain.ToolRegistrationItem) (domain.ToolKind, error) {
+	switch t.Kind {
+	case "", domain.ToolKindClient:
+		return domain.ToolKindClient, nil
+	case domain.ToolKindHTTP:
+		if _, err := tools.ParseHTTPConfig(t.Metadata); err != nil {
+			return "", fmt.Errorf("tool %s: %w: %v", t.Name, ErrInvalidTool, err)
+		}
+		return domain.ToolKindHTTP, nil
+	}
+	return "", fmt.Errorf("tool %s: %w: kind must be client or http", t.Name, ErrInvalidTool)
+}
+
+// executeHTTPTool POSTs the call's args to the tool's endpoint. A 2xx body is
+// the result (wrapped in a JSON string if it is not JSON); the result size
+// limit applies as it does to submitted results.
+func (s *Service) executeHTTPTool(ctx context.Context, toolCall *domain.ToolCall, tool *domain.Tool) (json.RawMessage, error) {
+	cfg, err := tools.ParseHTTPConfig(tool.Metadata)
+	if err != nil {
+		return nil, err
+	}
+	limit := s.toolResultLimit(ctx, tool.Name)
+	resp, err := tools.CallHTTP(ctx, s.toolHTTPClient, cfg, map[string]string{
+		"X-Run-ID":       toolCall.RunID,
+		"X-Tool-Call-ID": toolCall.ToolCallID,
+	}, toolCall.Args, limit)
+	if err != nil {
+		return nil, err
+	}
+
+	if limit > 0 && resp.Size > int64(limit) {
+		if !s.overflowTruncates() {
+			return nil, fmt.Errorf("tool call %s (%s): %d bytes, limit %d: %w", toolCall.ToolCallID, tool.Name, resp.Size, limit, ErrResultTooLarge)
+		}
+		s.logger.WarnContext(ctx, "truncating tool result", "tool_call_id", toolCall.ToolCallID, "tool_name", tool.Name, "run_id", toolCall.RunID, "bytes", resp.Size, "limit", limit)
+		return json.Marshal(domain.TruncatedToolResult{
+			Truncated:     true,
+			OriginalBytes: int(resp.Size),
+			Preview:       s.toolResultPreview(resp.Body),
+		})
+	}
+
+	if len(resp.Body) == 0 {
+		return json.RawMessage("null"), nil
+	}
+	if !json.Valid(resp.Body) {
+		return json.Marshal(string(resp.Body))
+	}
+	return resp.Body, nil
+}
+
+// toolExecutionError is the error stored on a server-side tool call that
+// failed with err.
+func toolExecutionError(err error) json.RawMessage {
+	var httpErr *tools.HTTPError
+	if errors.As(err, &httpErr) {
+		errData, _ := json.Marshal(map[string]interface{}{
+			"code":    "http_error",
+			"message": err.Error(),
+			"status":  httpErr.StatusCode,
+		})
+		return errData
+	}
+	code := "execution_error"
+	if errors.Is(err, ErrResultTooLarge) {
+		code = "result_too_large"
+	}
+	errData, _ := json.Marshal(map[string]string{
+		"code":    code,
+		"message": err.Error(),
+	})
+	return errData
+}
@@ -0,0 +1,46 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"github.com/xiaot623/gogo/orchestrator/internal/domain"
+)
+
+// ErrTooManyToolCalls is returned when a run already has as many unfinished
+// tool calls as it may have at once.
+var ErrTooManyToolCalls = errors.New("too many concurrent tool calls")
+
+// toolCallLimit is how many unfinished tool calls run may have: its agent's
+// MaxConcurrentToolCalls if set, else MaxConcurrentToolCalls. 0 means no cap.
+func (s *Service) toolCallLimit(ctx context.Context, run *domain.Run) int {
+	limit := s.config.MaxConcurrentToolCalls
+	agent, err := s.store.GetAgent(ctx, run.RootAgentID)
+	if err != nil {
+		s.logger.WarnContext(ctx, "failed to get agent for tool call limit", "agent_id", run.RootAgentID, "error", err)
+	}
+	if agent != nil && agent.MaxConcurrentToolCalls != 0 {
+		limit = agent.MaxConcurrentToolCalls
+	}
+	return max(limit, 0)
+}
+
+// checkToolCallLimit rejects a new tool call for run while it has its
+// limit of unfinished ones, so a runaway agent loop cannot flood tool
+// executors and the approval queue.
+func (s *Service) checkToolCallLimit(ctx context.Context, run *domain.Run) error {
+	limit := s.toolCallLimit(ctx, run)
+	if limit == 0 {
+		return nil
+	}
+	active, err := s.store.CountActiveToolCalls(ctx, run.RunID)
+	if err != nil {
+		return fmt.Errorf("failed to count tool calls: %w", err)
+	}
+	if active >= limit {
+		s.logger.WarnContext(ctx, "rejecting tool call over the run's limit", "run_id", run.RunID, "active", active, "limit", limit)
+		return fmt.Errorf("%w: run %s has %d unfinished tool calls (limit %d)", ErrTooManyToolCalls, run.RunID, active, limit)
+	}
+	return nil
+}
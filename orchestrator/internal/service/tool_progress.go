@@ -0,0 +1,101 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"github.com/xiaot623/gogo/orchestrator/internal/domain"
+)
+
+// ErrTooManyProgressChunks is returned when a tool call has already accepted
+// TOOL_PROGRESS_MAX_CHUNKS progress chunks.
+var ErrTooManyProgressChunks = errors.New("tool call progress chunk limit reached")
+
+// SubmitToolProgress records a chunk of incremental output from a running
+// client tool and pushes it to the session. The tool call moves to RUNNING
+// and stays there until its result is submitted.
+//
+// Chunks are ordered by seq, which must increase across the chunks of a tool
+// call. A chunk whose seq is not greater than the last accepted one is a
+// duplicate or arrived late; it is dropped and reported as not accepted.
+func (s *Service) SubmitToolProgress(ctx context.Context, toolCallID string, req domain.ToolProgressRequest) (*domain.ToolProgressResponse, error) {
+	if req.Seq <= 0 {
+		return nil, fmt.Errorf("seq must be positive")
+	}
+
+	tc, err := s.store.GetToolCall(ctx, toolCallID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get tool call: %w", err)
+	}
+	if tc == nil {
+		return nil, fmt.Errorf("tool call not found")
+	}
+	if tc.Kind != domain.ToolKindClient {
+		return nil, fmt.Errorf("tool call %s (%s): %w", tc.ToolCallID, tc.ToolName, ErrNotClientTool)
+	}
+
+	accepted, err := s.store.RecordToolProgress(ctx, toolCallID, req.Seq, s.config.ToolProgressMaxChunks)
+	if err != nil {
+		return nil, fmt.Errorf("failed to record tool progress: %w", err)
+	}
+	if !accepted {
+		// Re-read to tell why the chunk was not accepted.
+		if tc, err = s.store.GetToolCall(ctx, toolCallID); err != nil {
+			return nil, fmt.Errorf("failed to get tool call: %w", err)
+		}
+		if tc == nil {
+			return nil, fmt.Errorf("tool call not found")
+		}
+		switch {
+		case tc.Status != domain.ToolCallStatusDispatched && tc.Status != domain.ToolCallStatusRunning:
+			return nil, fmt.Errorf("tool call is in state %s, cannot submit progress", tc.Status)
+		case req.Seq <= tc.ProgressSeq:
+			return &domain.ToolProgressResponse{ToolCallID: toolCallID, Status: tc.Status, Seq: tc.ProgressSeq}, nil
+		default:
+			return nil, fmt.Errorf("tool call %s (%s): %d chunks: %w", tc.ToolCallID, tc.ToolName, tc.ProgressChunks, ErrTooManyProgressChunks)
+		}
+	}
+
+	payload := domain.ToolProgressPayload{
+		ToolCallID: toolCallID,
+		Seq:        req.Seq,
+		Chunk:      req.Chunk,
+	}
+	eventID, err := s.recordEventID(ctx, tc.RunID, domain.EventTypeToolProgress, payload)
+	if err != nil {
+		s.logger.WarnContext(ctx, "failed to record tool progress event", "tool_call_id", toolCallID, "error", err)
+	}
+	s.pushToolProgress(ctx, tc, eventID, req)
+
+	return &domain.ToolProgressResponse{
+		ToolCallID: toolCallID,
+		Status:     domain.ToolCallStatusRunning,
+		Seq:        req.Seq,
+		Accepted:   true,
+	}, nil
+}
+
+func (s *Service) pushToolProgress(ctx context.Context, tc *domain.ToolCall, eventID string, req domain.ToolProgressRequest) {
+	if s.ingressClient == nil {
+		return
+	}
+	run, err := s.store.GetRun(ctx, tc.RunID)
+	if err != nil || run == nil {
+		return
+	}
+
+	event := map[string]interface{}{
+		"type":         "tool_progress",
+		"ts":           s.clock.Now().UnixMilli(),
+		"run_id":       tc.RunID,
+		"event_id":     eventID,
+		"tool_call_id": tc.ToolCallID,
+		"tool_name":    tc.ToolName,
+		"seq":          req.Seq,
+		"chunk":        req.Chunk,
+	}
+	if err := s.ingressClient.PushEvent(run.SessionID, event); err != nil {
+		s.logger.WarnContext(ctx, "failed to push tool_progress", "tool_call_id", tc.ToolCallID, "run_id", tc.RunID, "session_id", run.SessionID, "error", err)
+	}
+}
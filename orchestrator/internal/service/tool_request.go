@@ -0,0 +1,77 @@
+package service
+
+import (
+	"encoding/json"
+	"fmt"
+	"unicode/utf8"
+)
+
+// pushToolRequest pushes a tool_request for a client tool to ingress. When the
+// serialized args exceed the configured threshold, the args are split into
+// ordered tool_request_chunk messages that the client reassembles by
+// concatenating "data" in seq order until "last" is true. Every chunk carries
+// the tool_request's event_id.
+func (s *Service) pushToolRequest(sessionID, runID, eventID, toolCallID, toolName string, args json.RawMessage, nowMs, deadlineTs int64) error {
+	if s.ingressClient == nil {
+		return nil
+	}
+
+	chunkBytes := s.config.ToolRequestChunkBytes
+	if chunkBytes <= 0 || len(args) <= chunkBytes {
+		var argsObj interface{}
+		_ = json.Unmarshal(args, &argsObj)
+		return s.ingressClient.PushEvent(sessionID, map[string]interface{}{
+			"type":         "tool_request",
+			"ts":           nowMs,
+			"run_id":       runID,
+			"event_id":     eventID,
+			"tool_call_id": toolCallID,
+			"tool_name":    toolName,
+			"args":         argsObj,
+			"deadline_ts":  deadlineTs,
+		})
+	}
+
+	chunks := splitToolArgs(args, chunkBytes)
+	for seq, chunk := range chunks {
+		if err := s.ingressClient.PushEvent(sessionID, map[string]interface{}{
+			"type":         "tool_request_chunk",
+			"ts":           nowMs,
+			"run_id":       runID,
+			"event_id":     eventID,
+			"tool_call_id": toolCallID,
+			"tool_name":    toolName,
+			"deadline_ts":  deadlineTs,
+			"seq":          seq,
+			"total":        len(chunks),
+			"last":         seq == len(chunks)-1,
+			"data":         chunk,
+		}); err != nil {
+			return fmt.Errorf("failed to push tool_request chunk %d/%d: %w", seq+1, len(chunks), err)
+		}
+	}
+	return nil
+}
+
+// splitToolArgs splits serialized args into chunks of at most size bytes
+// without cutting through a multi-byte UTF-8 sequence.
+func splitToolArgs(args []byte, size int) []string {
+	var chunks []string
+	for len(args) > 0 {
+		n := size
+		if n >= len(args) {
+			n = len(args)
+		} else {
+			for n > 0 && !utf8.RuneStart(args[n]) {
+				n--
+			}
+			if n == 0 {
+				// size is smaller than a single rune; take the whole rune.
+				_, n = utf8.DecodeRune(args)
+			}
+		}
+		chunks = append(chunks, string(args[:n]))
+		args = args[n:]
+	}
+	return chunks
+}
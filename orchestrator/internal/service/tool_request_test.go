@@ -0,0 +1,91 @@
+package service
+
+import (
+	"context"
+	"encoding/json"
+	"strings"
+	"testing"
+	"time"
+	"unicode/utf8"
+
+	"github.com/xiaot623/gogo/orchestrator/internal/adapter/agentclient"
+	"github.com/xiaot623/gogo/orchestrator/internal/adapter/ingress"
+	"github.com/xiaot623/gogo/orchestrator/internal/adapter/llm"
+	"github.com/xiaot623/gogo/orchestrator/internal/config"
+	"github.com/xiaot623/gogo/orchestrator/internal/domain"
+	"github.com/xiaot623/gogo/orchestrator/policy"
+	"github.com/xiaot623/gogo/orchestrator/tests/helpers"
+)
+
+func TestSplitToolArgsPreservesContent(t *testing.T) {
+	args := []byte(`{"dom":"` + strings.Repeat("abc", 10) + `"}`)
+
+	chunks := splitToolArgs(args, 8)
+	if len(chunks) < 2 {
+		t.Fatalf("expected multiple chunks, got %d", len(chunks))
+	}
+	for i, c := range chunks {
+		if len(c) > 8 {
+			t.Fatalf("chunk %d exceeds size: %d", i, len(c))
+		}
+	}
+	if got := strings.Join(chunks, ""); got != string(args) {
+		t.Fatalf("reassembled args mismatch: %s", got)
+	}
+}
+
+func TestSplitToolArgsKeepsRunesIntact(t *testing.T) {
+	args := []byte(`{"text":"` + strings.Repeat("天气", 5) + `"}`)
+
+	chunks := splitToolArgs(args, 4)
+	for i, c := range chunks {
+		if !utf8.ValidString(c) {
+			t.Fatalf("chunk %d is not valid UTF-8: %q", i, c)
+		}
+	}
+	if got := strings.Join(chunks, ""); got != string(args) {
+		t.Fatalf("reassembled args mismatch: %s", got)
+	}
+}
+
+func TestInvokeToolChunksLargeToolRequest(t *testing.T) {
+	ctx := context.Background()
+	db := helpers.NewTestSQLiteStore(t)
+	fake, addr := startFakeIngress(t)
+
+	policyEngine, err := policy.NewEngine(ctx, policy.DefaultPolicy)
+	if err != nil {
+		t.Fatalf("NewEngine failed: %v", err)
+	}
+	cfg := &config.Config{ToolTimeout: time.Minute, ToolRequestChunkBytes: 8}
+	svc := New(db, agentclient.NewClient(), ingress.NewClient(addr), llm.NewClient("", "", time.Second), cfg, policyEngine)
+	createSessionAndRun(t, db)
+
+	args := `{"dom":"` + strings.Repeat("abc", 10) + `"}`
+	if _, err := svc.InvokeTool(ctx, "browser.screenshot", domain.ToolInvokeRequest{RunID: "r1", Args: json.RawMessage(args)}); err != nil {
+		t.Fatalf("InvokeTool: %v", err)
+	}
+
+	want := len(splitToolArgs([]byte(args), 8))
+	waitForPushes(t, fake, want)
+	fake.mu.Lock()
+	defer fake.mu.Unlock()
+	if len(fake.events) != want {
+		t.Fatalf("expected %d pushes, got %d", want, len(fake.events))
+	}
+	var data strings.Builder
+	for i, push := range fake.events {
+		ev := push.Event
+		if ev["type"] != "tool_request_chunk" || ev["event_id"] != fake.events[0].Event["event_id"] || ev["tool_name"] != "browser.screenshot" {
+			t.Fatalf("unexpected push %d: %v", i, ev)
+		}
+		// Numbers arrive as float64 after the JSON round trip.
+		if ev["seq"] != float64(i) || ev["total"] != float64(want) || ev["last"] != (i == want-1) {
+			t.Fatalf("push %d has seq %v, total %v, last %v", i, ev["seq"], ev["total"], ev["last"])
+		}
+		data.WriteString(ev["data"].(string))
+	}
+	if data.String() != args {
+		t.Fatalf("reassembled args mismatch: %s", data.String())
+	}
+}
@@ -0,0 +1,108 @@
+package service
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"unicode/utf8"
+
+	"github.com/xiaot623/gogo/orchestrator/internal/config"
+	"github.com/xiaot623/gogo/orchestrator/internal/domain"
+)
+
+// defaultToolResultPreviewBytes is used when ToolResultPreviewBytes is unset.
+const defaultToolResultPreviewBytes = 1024
+
+// ErrResultTooLarge is returned when a submitted tool result exceeds the size
+// limit and the overflow policy is "reject".
+var ErrResultTooLarge = errors.New("tool result exceeds the maximum size")
+
+// toolResultLimit returns the maximum result size for a tool: the tool's
+// "max_result_bytes" metadata if set, otherwise TOOL_RESULT_MAX_BYTES.
+// 0 means unlimited.
+func (s *Service) toolResultLimit(ctx context.Context, toolName string) int {
+	limit := s.config.ToolResultMaxBytes
+	tool, err := s.store.GetTool(ctx, toolName)
+	if err != nil || tool == nil || len(tool.Metadata) == 0 {
+		return limit
+	}
+	var meta struct {
+		MaxResultBytes *int `json:"max_result_bytes"`
+	}
+	if err := json.Unmarshal(tool.Metadata, &meta); err != nil {
+		s.logger.WarnContext(ctx, "ignoring invalid tool metadata", "tool_name", toolName, "error", err)
+		return limit
+	}
+	if meta.MaxResultBytes != nil && *meta.MaxResultBytes >= 0 {
+		return *meta.MaxResultBytes
+	}
+	return limit
+}
+
+// truncateToolResult replaces an oversized result with a TruncatedToolResult
+// marker holding a preview of its leading bytes.
+func (s *Service) truncateToolResult(result json.RawMessage) json.RawMessage {
+	data, _ := json.Marshal(domain.TruncatedToolResult{
+		Truncated:     true,
+		OriginalBytes: len(result),
+		Preview:       s.toolResultPreview(result),
+	})
+	return data
+}
+
+// toolResultPreview returns at most ToolResultPreviewBytes of a result
+// without cutting through a multi-byte UTF-8 sequence.
+func (s *Service) toolResultPreview(result json.RawMessage) string {
+	n := s.config.ToolResultPreviewBytes
+	if n <= 0 {
+		n = defaultToolResultPreviewBytes
+	}
+	if len(result) <= n {
+		return string(result)
+	}
+	for n > 0 && !utf8.RuneStart(result[n]) {
+		n--
+	}
+	return string(result[:n])
+}
+
+// pushToolResult notifies the session that a client tool call completed. The
+// event carries a text preview of the result rather than the result itself;
+// truncated reports whether the preview is shorter than the stored result.
+func (s *Service) pushToolResult(ctx context.Context, tc *domain.ToolCall, eventID string, status domain.ToolCallStatus, result, errData json.RawMessage, nowMs int64) {
+	if s.ingressClient == nil {
+		return
+	}
+	run, err := s.store.GetRun(ctx, tc.RunID)
+	if err != nil || run == nil {
+		return
+	}
+
+	preview := s.toolResultPreview(result)
+	event := map[string]interface{}{
+		"type":           "tool_result",
+		"ts":             nowMs,
+		"run_id":         tc.RunID,
+		"event_id":       eventID,
+		"tool_call_id":   tc.ToolCallID,
+		"tool_name":      tc.ToolName,
+		"status":         status,
+		"result_preview": preview,
+		"result_bytes":   len(result),
+		"truncated":      len(preview) < len(result),
+	}
+	if len(errData) > 0 {
+		var errObj interface{}
+		_ = json.Unmarshal(errData, &errObj)
+		event["error"] = errObj
+	}
+	if err := s.ingressClient.PushEvent(run.SessionID, event); err != nil {
+		s.logger.WarnContext(ctx, "failed to push tool_result", "tool_call_id", tc.ToolCallID, "run_id", tc.RunID, "session_id", run.SessionID, "error", err)
+	}
+}
+
+// overflowTruncates reports whether oversized results are truncated rather
+// than rejected.
+func (s *Service) overflowTruncates() bool {
+	return s.config.ToolResultOverflow == config.ToolResultOverflowTruncate
+}
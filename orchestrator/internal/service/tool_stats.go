@@ -0,0 +1,77 @@
+package service
+
+import (
+	"maps"
+	"sync"
+
+	"github.com/xiaot623/gogo/orchestrator/internal/domain"
+)
+
+// ToolOutcome identifies a counter of ToolStats: a tool and the outcome
+// counted for it.
+type ToolOutcome struct {
+	Tool    string
+	Outcome string
+}
+
+// ToolStats reports tool call outcomes per tool for metrics.
+type ToolStats struct {
+	// Invocations counts created tool calls by policy decision (allow,
+	// block, require_approval).
+	Invocations map[ToolOutcome]int64
+	// Results counts tool calls reaching a terminal status (SUCCEEDED,
+	// FAILED, TIMEOUT, BLOCKED, REJECTED).
+	Results map[ToolOutcome]int64
+	// Approvals counts approval decisions (APPROVED, REJECTED, EXPIRED),
+	// including approvals granted by a remembered one.
+	Approvals map[ToolOutcome]int64
+}
+
+// toolCounters accumulates ToolStats.
+type toolCounters struct {
+	mu          sync.Mutex
+	invocations map[ToolOutcome]int64
+	results     map[ToolOutcome]int64
+	approvals   map[ToolOutcome]int64
+}
+
+func newToolCounters() *toolCounters {
+	return &toolCounters{
+		invocations: make(map[ToolOutcome]int64),
+		results:     make(map[ToolOutcome]int64),
+		approvals:   make(map[ToolOutcome]int64),
+	}
+}
+
+func (c *toolCounters) add(counts map[ToolOutcome]int64, tool, outcome string) {
+	c.mu.Lock()
+	counts[ToolOutcome{Tool: tool, Outcome: outcome}]++
+	c.mu.Unlock()
+}
+
+// countToolInvocation counts a created tool call under its policy decision.
+func (s *Service) countToolInvocation(tool, decision string) {
+	s.toolCounts.add(s.toolCounts.invocations, tool, decision)
+}
+
+// countToolResult counts a tool call that reached a terminal status. Call it
+// only when this caller's update completed the call, so each call counts once.
+func (s *Service) countToolResult(tool string, status domain.ToolCallStatus) {
+	s.toolCounts.add(s.toolCounts.results, tool, string(status))
+}
+
+// countApproval counts an approval decision on a call of tool.
+func (s *Service) countApproval(tool string, status domain.ApprovalStatus) {
+	s.toolCounts.add(s.toolCounts.approvals, tool, string(status))
+}
+
+// ToolStats returns a snapshot of the per-tool counters.
+func (s *Service) ToolStats() ToolStats {
+	s.toolCounts.mu.Lock()
+	defer s.toolCounts.mu.Unlock()
+	return ToolStats{
+		Invocations: maps.Clone(s.toolCounts.invocations),
+		Results:     maps.Clone(s.toolCounts.results),
+		Approvals:   maps.Clone(s.toolCounts.approvals),
+	}
+}
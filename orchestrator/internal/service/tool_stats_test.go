@@ -0,0 +1,101 @@
+package service
+
+import (
+	"context"
+	"encoding/json"
+	"testing"
+	"time"
+
+	"github.com/xiaot623/gogo/orchestrator/internal/adapter/agentclient"
+	"github.com/xiaot623/gogo/orchestrator/internal/adapter/ingress"
+	"github.com/xiaot623/gogo/orchestrator/internal/adapter/llm"
+	"github.com/xiaot623/gogo/orchestrator/internal/config"
+	"github.com/xiaot623/gogo/orchestrator/internal/domain"
+	"github.com/xiaot623/gogo/orchestrator/policy"
+	"github.com/xiaot623/gogo/orchestrator/tests/helpers"
+)
+
+func TestToolStatsCountOutcomes(t *testing.T) {
+	ctx := context.Background()
+	db := helpers.NewTestSQLiteStore(t)
+
+	policyEngine, err := policy.NewEngine(ctx, policy.DefaultPolicy)
+	if err != nil {
+		t.Fatalf("NewEngine failed: %v", err)
+	}
+	svc := New(db, agentclient.NewClient(), ingress.NewClient(""), llm.NewClient("", "", time.Second), &config.Config{ToolTimeout: time.Minute}, policyEngine)
+
+	if err := db.CreateSession(ctx, &domain.Session{SessionID: "s1", UserID: "u1", CreatedAt: time.Now()}); err != nil {
+		t.Fatalf("CreateSession: %v", err)
+	}
+	if err := db.CreateRun(ctx, &domain.Run{RunID: "r1", SessionID: "s1", RootAgentID: "a1", Status: domain.RunStatusRunning, StartedAt: time.Now()}); err != nil {
+		t.Fatalf("CreateRun: %v", err)
+	}
+	for _, tool := range []*domain.Tool{
+		{Name: "dangerous.command", Kind: domain.ToolKindServer},
+		{Name: "payments.transfer", Kind: domain.ToolKindClient},
+		{Name: "browser.screenshot", Kind: domain.ToolKindClient},
+	} {
+		if err := db.UpsertTool(ctx, tool); err != nil {
+			t.Fatalf("UpsertTool: %v", err)
+		}
+	}
+
+	invoke := func(tool, args, key string) *domain.ToolInvokeResponse {
+		t.Helper()
+		resp, err := svc.InvokeTool(ctx, tool, domain.ToolInvokeRequest{RunID: "r1", Args: json.RawMessage(args), IdempotencyKey: key})
+		if err != nil {
+			t.Fatalf("InvokeTool %s: %v", tool, err)
+		}
+		return resp
+	}
+
+	invoke("dangerous.command", `{}`, "")
+
+	transfer := invoke("payments.transfer", `{"amount":500}`, "")
+	tc, err := db.GetToolCall(ctx, transfer.ToolCallID)
+	if err != nil || tc == nil {
+		t.Fatalf("GetToolCall: %v", err)
+	}
+	if err := svc.UpdateApproval(ctx, tc.ApprovalID, domain.ApprovalDecisionRequest{Decision: "reject"}); err != nil {
+		t.Fatalf("UpdateApproval: %v", err)
+	}
+
+	// A replayed idempotent invoke and a resubmitted result count once.
+	screenshot := invoke("browser.screenshot", `{}`, "k1")
+	invoke("browser.screenshot", `{}`, "k1")
+	for i := 0; i < 2; i++ {
+		if _, err := svc.SubmitToolResult(ctx, screenshot.ToolCallID, domain.ToolCallResultRequest{Status: "SUCCEEDED", Result: json.RawMessage(`{}`)}); err != nil {
+			t.Fatalf("SubmitToolResult: %v", err)
+		}
+	}
+
+	stats := svc.ToolStats()
+	for name, c := range map[string]struct {
+		counts map[ToolOutcome]int64
+		want   map[ToolOutcome]int64
+	}{
+		"invocations": {stats.Invocations, map[ToolOutcome]int64{
+			{"dangerous.command", "block"}:            1,
+			{"payments.transfer", "require_approval"}: 1,
+			{"browser.screenshot", "allow"}:           1,
+		}},
+		"results": {stats.Results, map[ToolOutcome]int64{
+			{"dangerous.command", "BLOCKED"}:    1,
+			{"payments.transfer", "REJECTED"}:   1,
+			{"browser.screenshot", "SUCCEEDED"}: 1,
+		}},
+		"approvals": {stats.Approvals, map[ToolOutcome]int64{
+			{"payments.transfer", "REJECTED"}: 1,
+		}},
+	} {
+		if len(c.counts) != len(c.want) {
+			t.Fatalf("%s: expected %v, got %v", name, c.want, c.counts)
+		}
+		for key, n := range c.want {
+			if c.counts[key] != n {
+				t.Fatalf("%s: expected %v, got %v", name, c.want, c.counts)
+			}
+		}
+	}
+}
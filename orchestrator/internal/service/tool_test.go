@@ -0,0 +1,756 @@
+package service
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/xiaot623/gogo/orchestrator/internal/adapter/agentclient"
+	"github.com/xiaot623/gogo/orchestrator/internal/adapter/ingress"
+	"github.com/xiaot623/gogo/orchestrator/internal/adapter/llm"
+	"github.com/xiaot623/gogo/orchestrator/internal/clock"
+	"github.com/xiaot623/gogo/orchestrator/internal/config"
+	"github.com/xiaot623/gogo/orchestrator/internal/domain"
+	"github.com/xiaot623/gogo/orchestrator/internal/tools"
+	"github.com/xiaot623/gogo/orchestrator/policy"
+	"github.com/xiaot623/gogo/orchestrator/tests/helpers"
+)
+
+func TestConcurrentInvokeToolWithSameKeyDispatchesOnce(t *testing.T) {
+	ctx := context.Background()
+	db := helpers.NewTestSQLiteStore(t)
+	fake, addr := startFakeIngress(t)
+
+	policyEngine, err := policy.NewEngine(ctx, policy.DefaultPolicy)
+	if err != nil {
+		t.Fatalf("NewEngine failed: %v", err)
+	}
+	cfg := &config.Config{ToolTimeout: time.Minute}
+	svc := New(db, agentclient.NewClient(), ingress.NewClient(addr), llm.NewClient("", "", time.Second), cfg, policyEngine)
+
+	if err := db.CreateSession(ctx, &domain.Session{SessionID: "s1", UserID: "u1", CreatedAt: time.Now()}); err != nil {
+		t.Fatalf("CreateSession: %v", err)
+	}
+	if err := db.CreateRun(ctx, &domain.Run{RunID: "r1", SessionID: "s1", RootAgentID: "a1", Status: domain.RunStatusRunning, StartedAt: time.Now()}); err != nil {
+		t.Fatalf("CreateRun: %v", err)
+	}
+
+	const workers = 8
+	ids := make([]string, workers)
+	var wg sync.WaitGroup
+	for i := 0; i < workers; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			resp, err := svc.InvokeTool(ctx, "browser.screenshot", domain.ToolInvokeRequest{
+				RunID:          "r1",
+				Args:           json.RawMessage(`{}`),
+				IdempotencyKey: "k1",
+			})
+			if err != nil {
+				t.Errorf("InvokeTool: %v", err)
+				return
+			}
+			ids[i] = resp.ToolCallID
+		}(i)
+	}
+	wg.Wait()
+
+	for _, id := range ids[1:] {
+		if id != ids[0] {
+			t.Fatalf("expected a single tool call, got %v", ids)
+		}
+	}
+	if types := fake.eventTypes(); len(types) != 1 || types[0] != "tool_request" {
+		t.Fatalf("expected exactly one tool_request push, got %v", types)
+	}
+}
+
+func TestExecuteServerToolRefusesClientToolCall(t *testing.T) {
+	ctx := context.Background()
+	db := helpers.NewTestSQLiteStore(t)
+
+	executed := false
+	registry := tools.NewRegistry()
+	if err := registry.Register("browser.screenshot", func(ctx context.Context, args json.RawMessage) (json.RawMessage, error) {
+		executed = true
+		return json.RawMessage(`{}`), nil
+	}); err != nil {
+		t.Fatalf("Register: %v", err)
+	}
+	svc := New(db, agentclient.NewClient(), ingress.NewClient(""), llm.NewClient("", "", time.Second), &config.Config{}, nil, WithToolRegistry(registry))
+
+	if err := db.CreateSession(ctx, &domain.Session{SessionID: "s1", UserID: "u1", CreatedAt: time.Now()}); err != nil {
+		t.Fatalf("CreateSession: %v", err)
+	}
+	if err := db.CreateRun(ctx, &domain.Run{RunID: "r1", SessionID: "s1", RootAgentID: "a1", Status: domain.RunStatusRunning, StartedAt: time.Now()}); err != nil {
+		t.Fatalf("CreateRun: %v", err)
+	}
+	tc := &domain.ToolCall{ToolCallID: "tc1", RunID: "r1", ToolName: "browser.screenshot", Kind: domain.ToolKindClient, Status: domain.ToolCallStatusDispatched, Args: json.RawMessage(`{}`), CreatedAt: time.Now()}
+	if err := db.CreateToolCall(ctx, tc); err != nil {
+		t.Fatalf("CreateToolCall: %v", err)
+	}
+
+	svc.executeServerToolAsync(ctx, tc, &domain.Tool{Name: "browser.screenshot", Kind: domain.ToolKindClient})
+
+	if executed {
+		t.Fatal("server executor ran for a client tool call")
+	}
+	got, err := db.GetToolCall(ctx, "tc1")
+	if err != nil {
+		t.Fatalf("GetToolCall: %v", err)
+	}
+	if got.Status != domain.ToolCallStatusDispatched {
+		t.Fatalf("expected client tool call to stay DISPATCHED, got %s", got.Status)
+	}
+}
+
+func TestServerToolTimeoutCancelsExecutor(t *testing.T) {
+	ctx := context.Background()
+	db := helpers.NewTestSQLiteStore(t)
+
+	// Both executors block until their work is cancelled and report how it
+	// ended, so a run to completion would show up as a missing signal.
+	cancelled := make(chan error, 2)
+	registry := tools.NewRegistry()
+	if err := registry.Register("slow.query", func(ctx context.Context, args json.RawMessage) (json.RawMessage, error) {
+		select {
+		case <-ctx.Done():
+			cancelled <- ctx.Err()
+			return nil, ctx.Err()
+		case <-time.After(10 * time.Second):
+			cancelled <- nil
+			return json.RawMessage(`{}`), nil
+		}
+	}); err != nil {
+		t.Fatalf("Register: %v", err)
+	}
+	endpoint := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		// net/http only notices the client going away once the body has
+		// been consumed, so drain it before waiting on the context.
+		io.Copy(io.Discard, r.Body)
+		select {
+		case <-r.Context().Done():
+			cancelled <- r.Context().Err()
+		case <-time.After(10 * time.Second):
+			cancelled <- nil
+			fmt.Fprint(w, `{}`)
+		}
+	}))
+	defer endpoint.Close()
+
+	svc := New(db, agentclient.NewClient(), ingress.NewClient(""), llm.NewClient("", "", time.Second), &config.Config{ToolTimeout: time.Minute}, nil, WithToolRegistry(registry))
+	if err := db.CreateSession(ctx, &domain.Session{SessionID: "s1", UserID: "u1", CreatedAt: time.Now()}); err != nil {
+		t.Fatalf("CreateSession: %v", err)
+	}
+	if err := db.CreateRun(ctx, &domain.Run{RunID: "r1", SessionID: "s1", RootAgentID: "a1", Status: domain.RunStatusRunning, StartedAt: time.Now()}); err != nil {
+		t.Fatalf("CreateRun: %v", err)
+	}
+
+	for _, tool := range []*domain.Tool{
+		{Name: "slow.query", Kind: domain.ToolKindServer, TimeoutMs: 50},
+		{Name: "slow.http", Kind: domain.ToolKindHTTP, TimeoutMs: 50, Metadata: json.RawMessage(fmt.Sprintf(`{"http":{"url":%q}}`, endpoint.URL))},
+	} {
+		t.Run(tool.Name, func(t *testing.T) {
+			tc := &domain.ToolCall{ToolCallID: "tc_" + tool.Name, RunID: "r1", ToolName: tool.Name, Kind: tool.Kind, Status: domain.ToolCallStatusPolicyChecked, Args: json.RawMessage(`{}`), CreatedAt: time.Now()}
+			if err := db.CreateToolCall(ctx, tc); err != nil {
+				t.Fatalf("CreateToolCall: %v", err)
+			}
+
+			svc.executeServerToolAsync(ctx, tc, tool)
+
+			got, err := db.GetToolCall(ctx, tc.ToolCallID)
+			if err != nil {
+				t.Fatalf("GetToolCall: %v", err)
+			}
+			if got.Status != domain.ToolCallStatusTimeout {
+				t.Fatalf("expected TIMEOUT, got %s", got.Status)
+			}
+			select {
+			case err := <-cancelled:
+				if err == nil {
+					t.Fatal("executor ran to completion instead of being cancelled")
+				}
+			case <-time.After(2 * time.Second):
+				t.Fatal("executor did not observe cancellation")
+			}
+		})
+	}
+}
+
+func TestSubmitToolResultSizeLimit(t *testing.T) {
+	ctx := context.Background()
+	big := json.RawMessage(`{"png":"` + strings.Repeat("A", 64) + `"}`)
+
+	newSvc := func(t *testing.T, overflow string) (*Service, *fakeIngress) {
+		db := helpers.NewTestSQLiteStore(t)
+		fake, addr := startFakeIngress(t)
+		cfg := &config.Config{ToolTimeout: time.Minute, ToolResultMaxBytes: 32, ToolResultOverflow: overflow, ToolResultPreviewBytes: 16}
+		svc := New(db, agentclient.NewClient(), ingress.NewClient(addr), llm.NewClient("", "", time.Second), cfg, nil)
+
+		if err := db.CreateSession(ctx, &domain.Session{SessionID: "s1", UserID: "u1", CreatedAt: time.Now()}); err != nil {
+			t.Fatalf("CreateSession: %v", err)
+		}
+		if err := db.CreateRun(ctx, &domain.Run{RunID: "r1", SessionID: "s1", RootAgentID: "a1", Status: domain.RunStatusRunning, StartedAt: time.Now()}); err != nil {
+			t.Fatalf("CreateRun: %v", err)
+		}
+		if err := db.UpsertTool(ctx, &domain.Tool{Name: "browser.dom", Kind: domain.ToolKindClient, Metadata: json.RawMessage(`{"max_result_bytes":0}`)}); err != nil {
+			t.Fatalf("UpsertTool: %v", err)
+		}
+		for _, tc := range []*domain.ToolCall{
+			{ToolCallID: "tc1", RunID: "r1", ToolName: "browser.screenshot", Kind: domain.ToolKindClient, Status: domain.ToolCallStatusDispatched, Args: json.RawMessage(`{}`)},
+			{ToolCallID: "tc2", RunID: "r1", ToolName: "browser.dom", Kind: domain.ToolKindClient, Status: domain.ToolCallStatusDispatched, Args: json.RawMessage(`{}`)},
+		} {
+			if err := db.CreateToolCall(ctx, tc); err != nil {
+				t.Fatalf("CreateToolCall: %v", err)
+			}
+		}
+		return svc, fake
+	}
+
+	t.Run("reject", func(t *testing.T) {
+		svc, fake := newSvc(t, config.ToolResultOverflowReject)
+		_, err := svc.SubmitToolResult(ctx, "tc1", domain.ToolCallResultRequest{Status: "SUCCEEDED", Result: big})
+		if !errors.Is(err, ErrResultTooLarge) {
+			t.Fatalf("expected ErrResultTooLarge, got %v", err)
+		}
+		if types := fake.eventTypes(); len(types) != 0 {
+			t.Fatalf("expected no pushes, got %v", types)
+		}
+
+		// A metadata override of 0 lifts the limit for browser.dom.
+		resp, err := svc.SubmitToolResult(ctx, "tc2", domain.ToolCallResultRequest{Status: "SUCCEEDED", Result: big})
+		if err != nil {
+			t.Fatalf("SubmitToolResult: %v", err)
+		}
+		if string(resp.Result) != string(big) {
+			t.Fatalf("expected result stored verbatim, got %s", resp.Result)
+		}
+	})
+
+	t.Run("truncate", func(t *testing.T) {
+		svc, fake := newSvc(t, config.ToolResultOverflowTruncate)
+		resp, err := svc.SubmitToolResult(ctx, "tc1", domain.ToolCallResultRequest{Status: "SUCCEEDED", Result: big})
+		if err != nil {
+			t.Fatalf("SubmitToolResult: %v", err)
+		}
+		var marker domain.TruncatedToolResult
+		if err := json.Unmarshal(resp.Result, &marker); err != nil {
+			t.Fatalf("unmarshal marker: %v", err)
+		}
+		if !marker.Truncated || marker.OriginalBytes != len(big) || marker.Preview != string(big[:16]) {
+			t.Fatalf("unexpected marker: %+v", marker)
+		}
+
+		fake.mu.Lock()
+		defer fake.mu.Unlock()
+		if len(fake.events) != 1 {
+			t.Fatalf("expected one push, got %d", len(fake.events))
+		}
+		ev := fake.events[0].Event
+		if ev["type"] != "tool_result" || ev["truncated"] != true || ev["result_preview"] != string(big[:16]) {
+			t.Fatalf("unexpected tool_result push: %v", ev)
+		}
+	})
+}
+
+func TestInvokeToolIdempotencyKeyExpiresWithClock(t *testing.T) {
+	ctx := context.Background()
+	db := helpers.NewTestSQLiteStore(t)
+	_, addr := startFakeIngress(t)
+
+	policyEngine, err := policy.NewEngine(ctx, policy.DefaultPolicy)
+	if err != nil {
+		t.Fatalf("NewEngine failed: %v", err)
+	}
+	clk := clock.NewFake(time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC))
+	cfg := &config.Config{ToolTimeout: time.Minute}
+	svc := New(db, agentclient.NewClient(), ingress.NewClient(addr), llm.NewClient("", "", time.Second), cfg, policyEngine, WithClock(clk))
+
+	if err := db.CreateSession(ctx, &domain.Session{SessionID: "s1", UserID: "u1", CreatedAt: clk.Now()}); err != nil {
+		t.Fatalf("CreateSession: %v", err)
+	}
+	if err := db.CreateRun(ctx, &domain.Run{RunID: "r1", SessionID: "s1", RootAgentID: "a1", Status: domain.RunStatusRunning, StartedAt: clk.Now()}); err != nil {
+		t.Fatalf("CreateRun: %v", err)
+	}
+
+	invoke := func() string {
+		resp, err := svc.InvokeTool(ctx, "browser.screenshot", domain.ToolInvokeRequest{
+			RunID:          "r1",
+			Args:           json.RawMessage(`{}`),
+			IdempotencyKey: "k1",
+		})
+		if err != nil {
+			t.Fatalf("InvokeTool: %v", err)
+		}
+		return resp.ToolCallID
+	}
+
+	first := invoke()
+	clk.Advance(toolInvokeIdempotencyTTL)
+	if again := invoke(); again != first {
+		t.Fatalf("expected %s within the TTL, got %s", first, again)
+	}
+	clk.Advance(time.Second)
+	if fresh := invoke(); fresh == first {
+		t.Fatalf("expected a new tool call after the TTL, got %s again", fresh)
+	}
+}
+
+func TestSubmitToolResultNonce(t *testing.T) {
+	ctx := context.Background()
+	db := helpers.NewTestSQLiteStore(t)
+	_, addr := startFakeIngress(t)
+
+	clk := clock.NewFake(time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC))
+	cfg := &config.Config{ToolTimeout: time.Minute, ToolResultMaxBytes: 32, NonceTTL: time.Hour}
+	svc := New(db, agentclient.NewClient(), ingress.NewClient(addr), llm.NewClient("", "", time.Second), cfg, nil, WithClock(clk))
+
+	if err := db.CreateSession(ctx, &domain.Session{SessionID: "s1", UserID: "u1", CreatedAt: clk.Now()}); err != nil {
+		t.Fatalf("CreateSession: %v", err)
+	}
+	if err := db.CreateRun(ctx, &domain.Run{RunID: "r1", SessionID: "s1", RootAgentID: "a1", Status: domain.RunStatusRunning, StartedAt: clk.Now()}); err != nil {
+		t.Fatalf("CreateRun: %v", err)
+	}
+	for _, id := range []string{"tc1", "tc2"} {
+		tc := &domain.ToolCall{ToolCallID: id, RunID: "r1", ToolName: "browser.screenshot", Kind: domain.ToolKindClient, Status: domain.ToolCallStatusDispatched, Args: json.RawMessage(`{}`)}
+		if err := db.CreateToolCall(ctx, tc); err != nil {
+			t.Fatalf("CreateToolCall: %v", err)
+		}
+	}
+
+	// A failed submission releases its nonce so the retry can use it.
+	big := json.RawMessage(`{"png":"` + strings.Repeat("A", 64) + `"}`)
+	if _, err := svc.SubmitToolResult(ctx, "tc1", domain.ToolCallResultRequest{Status: "SUCCEEDED", Result: big, Nonce: "n1"}); !errors.Is(err, ErrResultTooLarge) {
+		t.Fatalf("expected ErrResultTooLarge, got %v", err)
+	}
+	first, err := svc.SubmitToolResult(ctx, "tc1", domain.ToolCallResultRequest{Status: "SUCCEEDED", Result: json.RawMessage(`{"ok":1}`), Nonce: "n1"})
+	if err != nil {
+		t.Fatalf("SubmitToolResult: %v", err)
+	}
+
+	// A replay gets the first response, whatever it carries.
+	replay, err := svc.SubmitToolResult(ctx, "tc1", domain.ToolCallResultRequest{Status: "FAILED", Nonce: "n1"})
+	if err != nil {
+		t.Fatalf("replay: %v", err)
+	}
+	if replay.Status != first.Status || string(replay.Result) != string(first.Result) || replay.CompletedAt != first.CompletedAt {
+		t.Fatalf("expected replay %+v, got %+v", first, replay)
+	}
+
+	if _, err := svc.SubmitToolResult(ctx, "tc2", domain.ToolCallResultRequest{Status: "SUCCEEDED", Nonce: "n1"}); !errors.Is(err, ErrNonceReused) {
+		t.Fatalf("expected ErrNonceReused, got %v", err)
+	}
+
+	// Once expired, the nonce can be used again.
+	clk.Advance(time.Hour)
+	if _, err := svc.SubmitToolResult(ctx, "tc2", domain.ToolCallResultRequest{Status: "SUCCEEDED", Nonce: "n1"}); err != nil {
+		t.Fatalf("SubmitToolResult after expiry: %v", err)
+	}
+}
+
+func TestSubmitToolProgress(t *testing.T) {
+	ctx := context.Background()
+	db := helpers.NewTestSQLiteStore(t)
+	fake, addr := startFakeIngress(t)
+	cfg := &config.Config{ToolTimeout: time.Minute, ToolProgressMaxChunks: 3}
+	svc := New(db, agentclient.NewClient(), ingress.NewClient(addr), llm.NewClient("", "", time.Second), cfg, nil)
+
+	if err := db.CreateSession(ctx, &domain.Session{SessionID: "s1", UserID: "u1", CreatedAt: time.Now()}); err != nil {
+		t.Fatalf("CreateSession: %v", err)
+	}
+	if err := db.CreateRun(ctx, &domain.Run{RunID: "r1", SessionID: "s1", RootAgentID: "a1", Status: domain.RunStatusRunning, StartedAt: time.Now()}); err != nil {
+		t.Fatalf("CreateRun: %v", err)
+	}
+	if err := db.CreateToolCall(ctx, &domain.ToolCall{ToolCallID: "tc1", RunID: "r1", ToolName: "shell.exec", Kind: domain.ToolKindClient, Status: domain.ToolCallStatusDispatched, Args: json.RawMessage(`{}`)}); err != nil {
+		t.Fatalf("CreateToolCall: %v", err)
+	}
+
+	submit := func(seq int64, chunk string) (*domain.ToolProgressResponse, error) {
+		return svc.SubmitToolProgress(ctx, "tc1", domain.ToolProgressRequest{Seq: seq, Chunk: chunk})
+	}
+
+	resp, err := submit(1, "line 1\n")
+	if err != nil || !resp.Accepted || resp.Status != domain.ToolCallStatusRunning {
+		t.Fatalf("first chunk: %+v %v", resp, err)
+	}
+	if tc, _ := db.GetToolCall(ctx, "tc1"); tc.Status != domain.ToolCallStatusRunning || tc.ProgressSeq != 1 {
+		t.Fatalf("expected RUNNING at seq 1, got %+v", tc)
+	}
+
+	// Duplicates and late chunks are dropped.
+	if resp, err := submit(1, "line 1\n"); err != nil || resp.Accepted || resp.Seq != 1 {
+		t.Fatalf("duplicate chunk: %+v %v", resp, err)
+	}
+	// Gaps are allowed; only increasing seq matters.
+	if resp, err := submit(3, "line 3\n"); err != nil || !resp.Accepted {
+		t.Fatalf("chunk 3: %+v %v", resp, err)
+	}
+	if resp, err := submit(2, "line 2\n"); err != nil || resp.Accepted {
+		t.Fatalf("late chunk: %+v %v", resp, err)
+	}
+	if _, err := submit(4, "line 4\n"); err != nil {
+		t.Fatalf("chunk 4: %v", err)
+	}
+	if _, err := submit(5, "line 5\n"); !errors.Is(err, ErrTooManyProgressChunks) {
+		t.Fatalf("expected ErrTooManyProgressChunks, got %v", err)
+	}
+
+	events, _ := db.GetEvents(ctx, "r1", 0, 0, []string{string(domain.EventTypeToolProgress)}, 0)
+	var seqs []int64
+	for _, ev := range events {
+		var p domain.ToolProgressPayload
+		_ = json.Unmarshal(ev.Payload, &p)
+		seqs = append(seqs, p.Seq)
+	}
+	if fmt.Sprint(seqs) != "[1 3 4]" {
+		t.Fatalf("expected progress events for seqs 1, 3, 4, got %v", seqs)
+	}
+	if types := fake.eventTypes(); fmt.Sprint(types) != "[tool_progress tool_progress tool_progress]" {
+		t.Fatalf("unexpected pushes: %v", types)
+	}
+
+	// The terminal result completes the call; later progress is rejected.
+	if _, err := svc.SubmitToolResult(ctx, "tc1", domain.ToolCallResultRequest{Status: "SUCCEEDED", Result: json.RawMessage(`{"exit":0}`)}); err != nil {
+		t.Fatalf("SubmitToolResult: %v", err)
+	}
+	if _, err := submit(6, "late"); err == nil || errors.Is(err, ErrTooManyProgressChunks) {
+		t.Fatalf("expected progress after completion to be rejected, got %v", err)
+	}
+}
+
+func TestToolResultSchemaValidation(t *testing.T) {
+	ctx := context.Background()
+	db := helpers.NewTestSQLiteStore(t)
+	schema := json.RawMessage(`{"type":"object","properties":{"temp":{"type":"number"}},"required":["temp"]}`)
+
+	registry := tools.NewRegistry()
+	for name, out := range map[string]string{"weather.ok": `{"temp":21}`, "weather.bad": `{"temp":"warm"}`} {
+		out := out
+		if err := registry.Register(name, func(ctx context.Context, args json.RawMessage) (json.RawMessage, error) {
+			return json.RawMessage(out), nil
+		}); err != nil {
+			t.Fatalf("Register: %v", err)
+		}
+	}
+	svc := New(db, agentclient.NewClient(), ingress.NewClient(""), llm.NewClient("", "", time.Second), &config.Config{ToolTimeout: time.Minute}, nil, WithToolRegistry(registry))
+
+	if err := db.CreateSession(ctx, &domain.Session{SessionID: "s1", UserID: "u1", CreatedAt: time.Now()}); err != nil {
+		t.Fatalf("CreateSession: %v", err)
+	}
+	if err := db.CreateRun(ctx, &domain.Run{RunID: "r1", SessionID: "s1", RootAgentID: "a1", Status: domain.RunStatusRunning, StartedAt: time.Now()}); err != nil {
+		t.Fatalf("CreateRun: %v", err)
+	}
+
+	_, err := svc.RegisterTools(ctx, domain.ToolRegistrationRequest{ClientID: "c1", Tools: []domain.ToolRegistrationItem{
+		{Name: "browser.bad_schema", ResultSchema: json.RawMessage(`{"type":"nonsense"}`)},
+	}})
+	if !errors.Is(err, ErrInvalidResultSchema) {
+		t.Fatalf("expected ErrInvalidResultSchema, got %v", err)
+	}
+	if _, err := svc.RegisterTools(ctx, domain.ToolRegistrationRequest{ClientID: "c1", Tools: []domain.ToolRegistrationItem{
+		{Name: "browser.weather", Schema: json.RawMessage(`{}`), ResultSchema: schema},
+	}}); err != nil {
+		t.Fatalf("RegisterTools: %v", err)
+	}
+
+	for _, tc := range []*domain.ToolCall{
+		{ToolCallID: "tc1", RunID: "r1", ToolName: "browser.weather", Kind: domain.ToolKindClient, Status: domain.ToolCallStatusDispatched, Args: json.RawMessage(`{}`)},
+		{ToolCallID: "tc2", RunID: "r1", ToolName: "browser.weather", Kind: domain.ToolKindClient, Status: domain.ToolCallStatusDispatched, Args: json.RawMessage(`{}`)},
+		{ToolCallID: "tc3", RunID: "r1", ToolName: "weather.ok", Kind: domain.ToolKindServer, Status: domain.ToolCallStatusPolicyChecked, Args: json.RawMessage(`{}`)},
+		{ToolCallID: "tc4", RunID: "r1", ToolName: "weather.bad", Kind: domain.ToolKindServer, Status: domain.ToolCallStatusPolicyChecked, Args: json.RawMessage(`{}`)},
+	} {
+		if err := db.CreateToolCall(ctx, tc); err != nil {
+			t.Fatalf("CreateToolCall: %v", err)
+		}
+	}
+
+	expectInvalid := func(t *testing.T, id string) {
+		t.Helper()
+		got, err := db.GetToolCall(ctx, id)
+		if err != nil {
+			t.Fatalf("GetToolCall: %v", err)
+		}
+		if got.Status != domain.ToolCallStatusFailed || len(got.Result) != 0 {
+			t.Fatalf("expected %s FAILED without a result, got %s %s", id, got.Status, got.Result)
+		}
+		var toolErr struct {
+			Code       string   `json:"code"`
+			Violations []string `json:"violations"`
+		}
+		if err := json.Unmarshal(got.Error, &toolErr); err != nil {
+			t.Fatalf("unmarshal error: %v", err)
+		}
+		if toolErr.Code != "invalid_result" || len(toolErr.Violations) == 0 {
+			t.Fatalf("unexpected error for %s: %s", id, got.Error)
+		}
+	}
+
+	t.Run("client", func(t *testing.T) {
+		resp, err := svc.SubmitToolResult(ctx, "tc1", domain.ToolCallResultRequest{Status: "SUCCEEDED", Result: json.RawMessage(`{"temp":21}`)})
+		if err != nil {
+			t.Fatalf("SubmitToolResult: %v", err)
+		}
+		if resp.Status != domain.ToolCallStatusSucceeded {
+			t.Fatalf("expected SUCCEEDED, got %s", resp.Status)
+		}
+
+		resp, err = svc.SubmitToolResult(ctx, "tc2", domain.ToolCallResultRequest{Status: "SUCCEEDED", Result: json.RawMessage(`{"temp":"warm"}`)})
+		if err != nil {
+			t.Fatalf("SubmitToolResult: %v", err)
+		}
+		if resp.Status != domain.ToolCallStatusFailed {
+			t.Fatalf("expected FAILED, got %s", resp.Status)
+		}
+		expectInvalid(t, "tc2")
+	})
+
+	t.Run("server", func(t *testing.T) {
+		for _, name := range []string{"weather.ok", "weather.bad"} {
+			if err := db.UpsertTool(ctx, &domain.Tool{Name: name, Kind: domain.ToolKindServer, ResultSchema: schema}); err != nil {
+				t.Fatalf("UpsertTool: %v", err)
+			}
+		}
+		for id, name := range map[string]string{"tc3": "weather.ok", "tc4": "weather.bad"} {
+			tc, err := db.GetToolCall(ctx, id)
+			if err != nil {
+				t.Fatalf("GetToolCall: %v", err)
+			}
+			tool, err := db.GetTool(ctx, name)
+			if err != nil {
+				t.Fatalf("GetTool: %v", err)
+			}
+			svc.executeServerToolAsync(ctx, tc, tool)
+		}
+
+		got, err := db.GetToolCall(ctx, "tc3")
+		if err != nil {
+			t.Fatalf("GetToolCall: %v", err)
+		}
+		if got.Status != domain.ToolCallStatusSucceeded {
+			t.Fatalf("expected tc3 SUCCEEDED, got %s %s", got.Status, got.Error)
+		}
+		expectInvalid(t, "tc4")
+	})
+}
+
+func TestInvokeToolPushesPolicyBlocked(t *testing.T) {
+	ctx := context.Background()
+	db := helpers.NewTestSQLiteStore(t)
+	fake, addr := startFakeIngress(t)
+
+	policyEngine, err := policy.NewEngine(ctx, policy.DefaultPolicy)
+	if err != nil {
+		t.Fatalf("NewEngine failed: %v", err)
+	}
+	svc := New(db, agentclient.NewClient(), ingress.NewClient(addr), llm.NewClient("", "", time.Second), &config.Config{ToolTimeout: time.Minute}, policyEngine)
+
+	if err := db.CreateSession(ctx, &domain.Session{SessionID: "s1", UserID: "u1", CreatedAt: time.Now()}); err != nil {
+		t.Fatalf("CreateSession: %v", err)
+	}
+	if err := db.CreateRun(ctx, &domain.Run{RunID: "r1", SessionID: "s1", RootAgentID: "a1", Status: domain.RunStatusRunning, StartedAt: time.Now()}); err != nil {
+		t.Fatalf("CreateRun: %v", err)
+	}
+	if err := db.UpsertTool(ctx, &domain.Tool{Name: "dangerous.command", Kind: domain.ToolKindServer}); err != nil {
+		t.Fatalf("UpsertTool: %v", err)
+	}
+
+	resp, err := svc.InvokeTool(ctx, "dangerous.command", domain.ToolInvokeRequest{RunID: "r1", Args: json.RawMessage(`{}`)})
+	if err != nil {
+		t.Fatalf("InvokeTool: %v", err)
+	}
+	if resp.Status != "failed" || resp.Error == nil || resp.Error.Code != "blocked" {
+		t.Fatalf("expected blocked response, got %+v", resp)
+	}
+
+	fake.mu.Lock()
+	defer fake.mu.Unlock()
+	if len(fake.events) != 1 {
+		t.Fatalf("expected one push, got %d", len(fake.events))
+	}
+	ev := fake.events[0]
+	if ev.SessionID != "s1" || ev.Event["type"] != "policy_blocked" || ev.Event["run_id"] != "r1" ||
+		ev.Event["tool_call_id"] != resp.ToolCallID || ev.Event["tool_name"] != "dangerous.command" {
+		t.Fatalf("unexpected policy_blocked push: %+v", ev)
+	}
+
+	// The push carries the ID of the policy_decision event it reports.
+	events, err := db.GetEvents(ctx, "r1", 0, 0, []string{string(domain.EventTypePolicyDecision)}, 0)
+	if err != nil {
+		t.Fatalf("GetEvents: %v", err)
+	}
+	if len(events) != 1 || ev.Event["event_id"] != events[0].EventID {
+		t.Fatalf("expected event_id to match the recorded event, got %v and %+v", ev.Event["event_id"], events)
+	}
+}
+
+func TestHTTPTool(t *testing.T) {
+	ctx := context.Background()
+	db := helpers.NewTestSQLiteStore(t)
+	_, addr := startFakeIngress(t)
+
+	endpoint := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost || r.Header.Get("Content-Type") != "application/json" {
+			t.Errorf("unexpected request: %s %s", r.Method, r.Header.Get("Content-Type"))
+		}
+		switch r.URL.Path {
+		case "/lookup":
+			if r.Header.Get("Authorization") != "Bearer crm-key" || r.Header.Get("X-Tool-Call-ID") == "" || r.Header.Get("X-Run-ID") != "r1" {
+				t.Errorf("unexpected headers: %v", r.Header)
+			}
+			var args map[string]string
+			_ = json.NewDecoder(r.Body).Decode(&args)
+			fmt.Fprintf(w, `{"customer":%q}`, args["id"])
+		case "/text":
+			fmt.Fprint(w, "plain answer")
+		case "/big":
+			fmt.Fprint(w, strings.Repeat("x", 64))
+		default:
+			http.Error(w, "upstream down", http.StatusBadGateway)
+		}
+	}))
+	defer endpoint.Close()
+
+	policyEngine, err := policy.NewEngine(ctx, policy.DefaultPolicy)
+	if err != nil {
+		t.Fatalf("NewEngine failed: %v", err)
+	}
+	cfg := &config.Config{ToolTimeout: time.Minute, ToolResultMaxBytes: 32}
+	svc := New(db, agentclient.NewClient(), ingress.NewClient(addr), llm.NewClient("", "", time.Second), cfg, policyEngine)
+
+	for _, bad := range []domain.ToolRegistrationItem{
+		{Name: "crm.remote", Kind: domain.ToolKindServer},
+		{Name: "crm.nourl", Kind: domain.ToolKindHTTP, Metadata: json.RawMessage(`{"http":{}}`)},
+		{Name: "crm.ftp", Kind: domain.ToolKindHTTP, Metadata: json.RawMessage(`{"http":{"url":"ftp://example.com"}}`)},
+	} {
+		if _, err := svc.RegisterTools(ctx, domain.ToolRegistrationRequest{Tools: []domain.ToolRegistrationItem{bad}}); !errors.Is(err, ErrInvalidTool) {
+			t.Fatalf("%s: expected ErrInvalidTool, got %v", bad.Name, err)
+		}
+	}
+
+	httpTool := func(name, path string) domain.ToolRegistrationItem {
+		return domain.ToolRegistrationItem{
+			Name:     name,
+			Kind:     domain.ToolKindHTTP,
+			Metadata: json.RawMessage(`{"http":{"url":"` + endpoint.URL + path + `","headers":{"Authorization":"Bearer crm-key"}}}`),
+		}
+	}
+	if _, err := svc.RegisterTools(ctx, domain.ToolRegistrationRequest{Tools: []domain.ToolRegistrationItem{
+		httpTool("crm.lookup", "/lookup"),
+		httpTool("crm.text", "/text"),
+		httpTool("crm.big", "/big"),
+		httpTool("crm.down", "/down"),
+	}}); err != nil {
+		t.Fatalf("RegisterTools: %v", err)
+	}
+
+	if err := db.CreateSession(ctx, &domain.Session{SessionID: "s1", UserID: "u1", CreatedAt: time.Now()}); err != nil {
+		t.Fatalf("CreateSession: %v", err)
+	}
+	if err := db.CreateRun(ctx, &domain.Run{RunID: "r1", SessionID: "s1", RootAgentID: "a1", Status: domain.RunStatusRunning, StartedAt: time.Now()}); err != nil {
+		t.Fatalf("CreateRun: %v", err)
+	}
+
+	call := func(toolName, args string) *domain.ToolCall {
+		t.Helper()
+		resp, err := svc.InvokeTool(ctx, toolName, domain.ToolInvokeRequest{RunID: "r1", Args: json.RawMessage(args)})
+		if err != nil {
+			t.Fatalf("InvokeTool %s: %v", toolName, err)
+		}
+		if resp.Status != "pending" || resp.Reason != "server_tool_executing" {
+			t.Fatalf("expected %s to execute on the server, got %+v", toolName, resp)
+		}
+		waitCtx, cancel := context.WithTimeout(ctx, 5*time.Second)
+		defer cancel()
+		tc, err := svc.awaitToolCall(waitCtx, "r1", resp.ToolCallID)
+		if err != nil {
+			t.Fatalf("awaitToolCall %s: %v", toolName, err)
+		}
+		return tc
+	}
+
+	if tc := call("crm.lookup", `{"id":"c42"}`); tc.Status != domain.ToolCallStatusSucceeded || string(tc.Result) != `{"customer":"c42"}` {
+		t.Fatalf("unexpected lookup call: %s %s %s", tc.Status, tc.Result, tc.Error)
+	}
+	if tc := call("crm.text", `{}`); tc.Status != domain.ToolCallStatusSucceeded || string(tc.Result) != `"plain answer"` {
+		t.Fatalf("expected a non-JSON body as a string, got %s %s", tc.Status, tc.Result)
+	}
+
+	var toolErr struct {
+		Code   string `json:"code"`
+		Status int    `json:"status"`
+	}
+	tc := call("crm.down", `{}`)
+	if err := json.Unmarshal(tc.Error, &toolErr); err != nil || tc.Status != domain.ToolCallStatusFailed || toolErr.Code != "http_error" || toolErr.Status != http.StatusBadGateway {
+		t.Fatalf("unexpected failed call: %s %s", tc.Status, tc.Error)
+	}
+	tc = call("crm.big", `{}`)
+	if err := json.Unmarshal(tc.Error, &toolErr); err != nil || tc.Status != domain.ToolCallStatusFailed || toolErr.Code != "result_too_large" {
+		t.Fatalf("expected result_too_large, got %s %s", tc.Status, tc.Error)
+	}
+}
+
+func TestInvokeToolConcurrencyLimit(t *testing.T) {
+	ctx := context.Background()
+	db := helpers.NewTestSQLiteStore(t)
+
+	policyEngine, err := policy.NewEngine(ctx, policy.DefaultPolicy)
+	if err != nil {
+		t.Fatalf("NewEngine failed: %v", err)
+	}
+	cfg := &config.Config{ToolTimeout: time.Minute, MaxConcurrentToolCalls: 2}
+	svc := New(db, agentclient.NewClient(), ingress.NewClient(""), llm.NewClient("", "", time.Second), cfg, policyEngine)
+
+	if err := db.CreateSession(ctx, &domain.Session{SessionID: "s1", UserID: "u1", CreatedAt: time.Now()}); err != nil {
+		t.Fatalf("CreateSession: %v", err)
+	}
+	if _, err := svc.RegisterAgent(ctx, "unlimited", "Unlimited", "http://agent.invalid", nil, nil, "", "", "", -1, nil, nil); err != nil {
+		t.Fatalf("RegisterAgent: %v", err)
+	}
+	for runID, agentID := range map[string]string{"r1": "a1", "r2": "unlimited"} {
+		if err := db.CreateRun(ctx, &domain.Run{RunID: runID, SessionID: "s1", RootAgentID: agentID, Status: domain.RunStatusRunning, StartedAt: time.Now()}); err != nil {
+			t.Fatalf("CreateRun: %v", err)
+		}
+	}
+	invoke := func(runID string) (*domain.ToolInvokeResponse, error) {
+		return svc.InvokeTool(ctx, "browser.screenshot", domain.ToolInvokeRequest{RunID: runID, Args: json.RawMessage(`{}`)})
+	}
+
+	// Client tool calls stay unfinished until their result is submitted.
+	var first string
+	for i := 0; i < 2; i++ {
+		resp, err := invoke("r1")
+		if err != nil {
+			t.Fatalf("InvokeTool %d: %v", i, err)
+		}
+		if i == 0 {
+			first = resp.ToolCallID
+		}
+	}
+	if _, err := invoke("r1"); !errors.Is(err, ErrTooManyToolCalls) {
+		t.Fatalf("expected ErrTooManyToolCalls, got %v", err)
+	}
+
+	// A finished call frees its slot.
+	if _, err := svc.SubmitToolResult(ctx, first, domain.ToolCallResultRequest{Status: "succeeded", Result: json.RawMessage(`{}`)}); err != nil {
+		t.Fatalf("SubmitToolResult: %v", err)
+	}
+	if _, err := invoke("r1"); err != nil {
+		t.Fatalf("InvokeTool after a call finished: %v", err)
+	}
+
+	// The agent's override lifts the cap.
+	for i := 0; i < 3; i++ {
+		if _, err := invoke("r2"); err != nil {
+			t.Fatalf("InvokeTool for uncapped agent: %v", err)
+		}
+	}
+}
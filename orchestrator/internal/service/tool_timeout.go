@@ -3,7 +3,6 @@ package service
 import (
 	"context"
 	"encoding/json"
-	"log"
 	"time"
 
 	"github.com/xiaot623/gogo/orchestrator/internal/domain"
@@ -27,9 +26,9 @@ func (s *Service) sweepToolCallTimeouts(ctx context.Context) {
 	sweepCtx, cancel := context.WithTimeout(ctx, 2*time.Second)
 	defer cancel()
 
-	expired, err := s.store.ListExpiredToolCalls(sweepCtx, 100)
+	expired, err := s.store.ListExpiredToolCalls(sweepCtx, s.clock.Now(), 100)
 	if err != nil {
-		log.Printf("WARN: tool timeout sweep failed: %v", err)
+		s.logger.WarnContext(ctx, "tool timeout sweep failed", "error", err)
 		return
 	}
 
@@ -42,12 +41,13 @@ func (s *Service) sweepToolCallTimeouts(ctx context.Context) {
 
 		updated, err := s.store.UpdateToolCallResult(sweepCtx, tc.ToolCallID, domain.ToolCallStatusTimeout, nil, errData)
 		if err != nil {
-			log.Printf("WARN: failed to mark tool call timeout %s: %v", tc.ToolCallID, err)
+			s.logger.WarnContext(ctx, "failed to mark tool call timeout", "tool_call_id", tc.ToolCallID, "run_id", tc.RunID, "error", err)
 			continue
 		}
 		if !updated {
 			continue
 		}
+		s.countToolResult(tc.ToolName, domain.ToolCallStatusTimeout)
 
 		payload := domain.ToolResultPayload{
 			ToolCallID: tc.ToolCallID,
@@ -55,11 +55,13 @@ func (s *Service) sweepToolCallTimeouts(ctx context.Context) {
 			Error:      errData,
 		}
 		if err := s.recordEvent(sweepCtx, tc.RunID, domain.EventTypeToolResult, payload); err != nil {
-			log.Printf("WARN: failed to record tool timeout event %s: %v", tc.ToolCallID, err)
+			s.logger.WarnContext(ctx, "failed to record tool timeout event", "tool_call_id", tc.ToolCallID, "run_id", tc.RunID, "error", err)
 		}
 
 		if tc.ApprovalID != "" {
-			_, _ = s.store.ExpireApprovalIfPending(sweepCtx, tc.ApprovalID, "tool_call_timeout")
+			if expired, _ := s.store.ExpireApprovalIfPending(sweepCtx, tc.ApprovalID, "tool_call_timeout"); expired {
+				s.countApproval(tc.ToolName, domain.ApprovalStatusExpired)
+			}
 		}
 	}
 }
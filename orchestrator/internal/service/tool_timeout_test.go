@@ -9,6 +9,7 @@ import (
 	"github.com/xiaot623/gogo/orchestrator/internal/adapter/agentclient"
 	"github.com/xiaot623/gogo/orchestrator/internal/adapter/ingress"
 	"github.com/xiaot623/gogo/orchestrator/internal/adapter/llm"
+	"github.com/xiaot623/gogo/orchestrator/internal/clock"
 	"github.com/xiaot623/gogo/orchestrator/internal/config"
 	"github.com/xiaot623/gogo/orchestrator/internal/domain"
 	"github.com/xiaot623/gogo/orchestrator/policy"
@@ -70,6 +71,52 @@ func TestToolCallTimeoutSweepMarksTimeout(t *testing.T) {
 	}
 }
 
+func TestToolCallTimeoutSweepFollowsClock(t *testing.T) {
+	ctx := context.Background()
+	db := helpers.NewTestSQLiteStore(t)
+
+	clk := clock.NewFake(time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC))
+	svc := New(db, agentclient.NewClient(), ingress.NewClient(""), llm.NewClient("", "", time.Second), &config.Config{ToolTimeout: time.Minute}, nil, WithClock(clk))
+
+	if err := db.CreateSession(ctx, &domain.Session{SessionID: "s1", UserID: "u1", CreatedAt: clk.Now()}); err != nil {
+		t.Fatalf("CreateSession: %v", err)
+	}
+	if err := db.CreateRun(ctx, &domain.Run{RunID: "r1", SessionID: "s1", RootAgentID: "a1", Status: domain.RunStatusRunning, StartedAt: clk.Now()}); err != nil {
+		t.Fatalf("CreateRun: %v", err)
+	}
+	// Created "now" by the fake clock, which is years behind the wall clock.
+	if err := db.CreateToolCall(ctx, &domain.ToolCall{
+		ToolCallID: "tc_1",
+		RunID:      "r1",
+		ToolName:   "browser.screenshot",
+		Kind:       domain.ToolKindClient,
+		Status:     domain.ToolCallStatusDispatched,
+		Args:       json.RawMessage(`{}`),
+		TimeoutMs:  1000,
+		CreatedAt:  clk.Now(),
+	}); err != nil {
+		t.Fatalf("CreateToolCall: %v", err)
+	}
+
+	status := func() domain.ToolCallStatus {
+		svc.sweepToolCallTimeouts(ctx)
+		got, err := db.GetToolCall(ctx, "tc_1")
+		if err != nil || got == nil {
+			t.Fatalf("GetToolCall: %+v, %v", got, err)
+		}
+		return got.Status
+	}
+
+	clk.Advance(999 * time.Millisecond)
+	if got := status(); got != domain.ToolCallStatusDispatched {
+		t.Fatalf("expected DISPATCHED before the timeout, got %s", got)
+	}
+	clk.Advance(time.Millisecond)
+	if got := status(); got != domain.ToolCallStatusTimeout {
+		t.Fatalf("expected TIMEOUT once the clock passes the timeout, got %s", got)
+	}
+}
+
 func TestToolCallTimeoutSweepExpiresApproval(t *testing.T) {
 	ctx := context.Background()
 	db := helpers.NewTestSQLiteStore(t)
@@ -0,0 +1,70 @@
+// Package tokenizer estimates how many tokens text and chat messages use, so
+// callers can check what fits a model's context.
+package tokenizer
+
+import (
+	"strings"
+	"unicode/utf8"
+)
+
+// Counter counts the tokens of text for a model. Implementations may ignore
+// model if they do not distinguish between models.
+type Counter interface {
+	Count(model, text string) int
+	// Name identifies the counter in responses, e.g. "approximate".
+	Name() string
+}
+
+// messageOverhead is the tokens a chat message costs beyond its role and
+// content (OpenAI-style chat formats spend about this much on framing).
+const messageOverhead = 3
+
+// Message is a chat message to count.
+type Message struct {
+	Role    string
+	Content string
+}
+
+// CountMessages returns the tokens of each message, including its role and
+// framing overhead, and their total.
+func CountMessages(c Counter, model string, messages []Message) ([]int, int) {
+	counts := make([]int, len(messages))
+	total := 0
+	for i, m := range messages {
+		counts[i] = c.Count(model, m.Role) + c.Count(model, m.Content) + messageOverhead
+		total += counts[i]
+	}
+	return counts, total
+}
+
+// Approximate estimates tokens without a vocabulary: about four bytes of
+// ASCII per token, one token per non-ASCII rune (CJK text is roughly that
+// dense), and never fewer than 4/3 tokens per word. It tends to overcount
+// slightly, which is the safe side for a context-fit check.
+type Approximate struct{}
+
+// Count implements Counter.
+func (Approximate) Count(model, text string) int {
+	if text == "" {
+		return 0
+	}
+	ascii, other := 0, 0
+	for _, r := range text {
+		if r < utf8.RuneSelf {
+			ascii++
+		} else {
+			other++
+		}
+	}
+	byBytes := (ascii+3)/4 + other
+	byWords := (len(strings.Fields(text))*4 + 2) / 3
+	return max(byBytes, byWords)
+}
+
+// Name implements Counter.
+func (Approximate) Name() string {
+	return "approximate"
+}
+
+// Default is the counter used when none is injected.
+var Default Counter = Approximate{}
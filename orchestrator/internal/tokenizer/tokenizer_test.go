@@ -0,0 +1,34 @@
+package tokenizer
+
+import "testing"
+
+func TestApproximateCount(t *testing.T) {
+	tests := []struct {
+		text string
+		want int
+	}{
+		{"", 0},
+		{"hello", 2},
+		{"the quick brown fox jumps", 7},
+		{"你好世界", 4},
+		{"a b c d e f", 8},
+	}
+	for _, tt := range tests {
+		if got := (Approximate{}).Count("any", tt.text); got != tt.want {
+			t.Errorf("Count(%q) = %d, want %d", tt.text, got, tt.want)
+		}
+	}
+}
+
+func TestCountMessages(t *testing.T) {
+	counts, total := CountMessages(Approximate{}, "any", []Message{
+		{Role: "system", Content: "be brief"},
+		{Role: "user", Content: "hello"},
+	})
+	if len(counts) != 2 || counts[0] != 2+3+messageOverhead || counts[1] != 2+2+messageOverhead {
+		t.Fatalf("unexpected counts: %v", counts)
+	}
+	if total != counts[0]+counts[1] {
+		t.Fatalf("total %d does not add up: %v", total, counts)
+	}
+}
@@ -0,0 +1,114 @@
+package tools
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+)
+
+// httpErrorBodyBytes bounds how much of a failed response is kept in an
+// HTTPError.
+const httpErrorBodyBytes = 1024
+
+// HTTPConfig is where an http tool sends its calls, read from the "http"
+// object of the tool's metadata.
+type HTTPConfig struct {
+	URL     string            `json:"url"`
+	Headers map[string]string `json:"headers,omitempty"`
+}
+
+// ParseHTTPConfig reads and validates the "http" object of a tool's metadata.
+func ParseHTTPConfig(metadata json.RawMessage) (*HTTPConfig, error) {
+	var meta struct {
+		HTTP *HTTPConfig `json:"http"`
+	}
+	if len(metadata) > 0 {
+		if err := json.Unmarshal(metadata, &meta); err != nil {
+			return nil, fmt.Errorf("invalid metadata: %w", err)
+		}
+	}
+	if meta.HTTP == nil || meta.HTTP.URL == "" {
+		return nil, fmt.Errorf("metadata.http.url is required")
+	}
+	u, err := url.Parse(meta.HTTP.URL)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return nil, fmt.Errorf("metadata.http.url must be an http(s) URL")
+	}
+	for name := range meta.HTTP.Headers {
+		if strings.EqualFold(name, "Content-Type") {
+			return nil, fmt.Errorf("metadata.http.headers must not set Content-Type")
+		}
+	}
+	return meta.HTTP, nil
+}
+
+// HTTPError is a non-2xx answer from an http tool's endpoint.
+type HTTPError struct {
+	StatusCode int
+	Body       string
+}
+
+func (e *HTTPError) Error() string {
+	if e.Body == "" {
+		return fmt.Sprintf("tool endpoint returned HTTP %d", e.StatusCode)
+	}
+	return fmt.Sprintf("tool endpoint returned HTTP %d: %s", e.StatusCode, e.Body)
+}
+
+// HTTPResponse is a 2xx answer from an http tool's endpoint. Body holds at
+// most the maxBytes passed to CallHTTP plus one byte; Size is the full size.
+type HTTPResponse struct {
+	Body []byte
+	Size int64
+}
+
+// CallHTTP POSTs args to cfg.URL with cfg.Headers and extra headers. A non-2xx
+// answer is returned as an *HTTPError. With maxBytes > 0 only the first
+// maxBytes+1 bytes of the body are kept, enough to tell it is too large.
+func CallHTTP(ctx context.Context, client *http.Client, cfg *HTTPConfig, extra map[string]string, args json.RawMessage, maxBytes int) (*HTTPResponse, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, cfg.URL, bytes.NewReader(args))
+	if err != nil {
+		return nil, fmt.Errorf("failed to create request: %w", err)
+	}
+	for name, value := range cfg.Headers {
+		req.Header.Set(name, value)
+	}
+	for name, value := range extra {
+		req.Header.Set(name, value)
+	}
+	req.Header.Set("Content-Type", "application/json")
+
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("tool endpoint request failed: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		body, _ := io.ReadAll(io.LimitReader(resp.Body, httpErrorBodyBytes))
+		return nil, &HTTPError{StatusCode: resp.StatusCode, Body: strings.TrimSpace(string(body))}
+	}
+
+	var reader io.Reader = resp.Body
+	if maxBytes > 0 {
+		reader = io.LimitReader(resp.Body, int64(maxBytes)+1)
+	}
+	body, err := io.ReadAll(reader)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read tool endpoint response: %w", err)
+	}
+	size := int64(len(body))
+	if maxBytes > 0 && len(body) > maxBytes {
+		rest, err := io.Copy(io.Discard, resp.Body)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read tool endpoint response: %w", err)
+		}
+		size += rest
+	}
+	return &HTTPResponse{Body: body, Size: size}, nil
+}
@@ -7,7 +7,9 @@ import (
 	"sync"
 )
 
-// ExecutorFunc defines a server-side tool executor.
+// ExecutorFunc defines a server-side tool executor. ctx is cancelled when
+// the tool call times out; an executor doing I/O must pass ctx on and return
+// once it is done, as its result is discarded from then on.
 type ExecutorFunc func(ctx context.Context, args json.RawMessage) (json.RawMessage, error)
 
 // Registry stores tool executors keyed by tool name.
@@ -54,6 +56,9 @@ func (r *Registry) Execute(ctx context.Context, toolName string, args json.RawMe
 	if exec == nil {
 		return nil, fmt.Errorf("no executor registered for %s", toolName)
 	}
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
 	return exec(ctx, args)
 }
 
@@ -0,0 +1,59 @@
+package http
+
+import (
+	"crypto/subtle"
+	"net/http"
+	"strings"
+
+	"github.com/labstack/echo/v4"
+)
+
+// BearerAuth requires an "Authorization: Bearer <key>" header carrying one of
+// keys on every request whose path is not in publicPaths. With no keys the
+// middleware lets everything through.
+func BearerAuth(keys, publicPaths []string) echo.MiddlewareFunc {
+	public := make(map[string]bool, len(publicPaths))
+	for _, p := range publicPaths {
+		public[p] = true
+	}
+	return func(next echo.HandlerFunc) echo.HandlerFunc {
+		return func(c echo.Context) error {
+			if len(keys) == 0 || public[c.Request().URL.Path] || c.Request().Method == http.MethodOptions {
+				return next(c)
+			}
+
+			token, ok := bearerToken(c.Request().Header.Get(echo.HeaderAuthorization))
+			if !ok {
+				return unauthorized(c, "missing bearer token")
+			}
+			if !validKey(keys, token) {
+				return unauthorized(c, "invalid bearer token")
+			}
+			return next(c)
+		}
+	}
+}
+
+// bearerToken extracts the token of a Bearer authorization header.
+func bearerToken(header string) (string, bool) {
+	scheme, token, ok := strings.Cut(header, " ")
+	if !ok || !strings.EqualFold(scheme, "Bearer") {
+		return "", false
+	}
+	token = strings.TrimSpace(token)
+	return token, token != ""
+}
+
+// validKey compares token against every key in constant time.
+func validKey(keys []string, token string) bool {
+	valid := 0
+	for _, key := range keys {
+		valid |= subtle.ConstantTimeCompare([]byte(key), []byte(token))
+	}
+	return valid == 1
+}
+
+func unauthorized(c echo.Context, msg string) error {
+	c.Response().Header().Set(echo.HeaderWWWAuthenticate, `Bearer realm="orchestrator"`)
+	return c.JSON(http.StatusUnauthorized, map[string]string{"error": msg, "code": "unauthorized"})
+}
@@ -0,0 +1,57 @@
+package http
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/labstack/echo/v4"
+)
+
+func TestBearerAuth(t *testing.T) {
+	newServer := func(keys []string) *echo.Echo {
+		e := echo.New()
+		e.Use(BearerAuth(keys, []string{"/health"}))
+		ok := func(c echo.Context) error { return c.String(http.StatusOK, "ok") }
+		e.GET("/health", ok)
+		e.GET("/v1/agents", ok)
+		return e
+	}
+	do := func(e *echo.Echo, path, auth string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodGet, path, nil)
+		if auth != "" {
+			req.Header.Set(echo.HeaderAuthorization, auth)
+		}
+		rec := httptest.NewRecorder()
+		e.ServeHTTP(rec, req)
+		return rec
+	}
+
+	e := newServer([]string{"k1", "k2"})
+	cases := []struct {
+		path string
+		auth string
+		want int
+	}{
+		{"/health", "", http.StatusOK},
+		{"/v1/agents", "", http.StatusUnauthorized},
+		{"/v1/agents", "Basic azE6", http.StatusUnauthorized},
+		{"/v1/agents", "Bearer nope", http.StatusUnauthorized},
+		{"/v1/agents", "Bearer k2", http.StatusOK},
+		{"/v1/agents", "bearer k1", http.StatusOK},
+	}
+	for _, tc := range cases {
+		rec := do(e, tc.path, tc.auth)
+		if rec.Code != tc.want {
+			t.Fatalf("%s with %q: expected %d, got %d", tc.path, tc.auth, tc.want, rec.Code)
+		}
+		if rec.Code == http.StatusUnauthorized && rec.Header().Get(echo.HeaderWWWAuthenticate) == "" {
+			t.Fatalf("401 without WWW-Authenticate")
+		}
+	}
+
+	// Without keys, authentication is disabled.
+	if rec := do(newServer(nil), "/v1/agents", ""); rec.Code != http.StatusOK {
+		t.Fatalf("expected open access without keys, got %d", rec.Code)
+	}
+}
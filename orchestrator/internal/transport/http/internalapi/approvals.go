@@ -1,10 +1,12 @@
 package internalapi
 
 import (
+	"errors"
 	"net/http"
 
 	"github.com/labstack/echo/v4"
 	"github.com/xiaot623/gogo/orchestrator/internal/domain"
+	"github.com/xiaot623/gogo/orchestrator/internal/service"
 )
 
 // SubmitApprovalDecision handles approval decision submission from ingress.
@@ -23,6 +25,12 @@ func (h *Handler) SubmitApprovalDecision(c echo.Context) error {
 	ctx := c.Request().Context()
 	
 	if err := h.service.UpdateApproval(ctx, approvalID, req); err != nil {
+		if errors.Is(err, service.ErrNonceReused) {
+			return c.JSON(http.StatusConflict, map[string]string{"error": err.Error(), "code": "nonce_reused"})
+		}
+		if errors.Is(err, service.ErrNonceInFlight) {
+			return c.JSON(http.StatusConflict, map[string]string{"error": err.Error(), "code": "nonce_in_flight"})
+		}
 		return c.JSON(http.StatusInternalServerError, map[string]string{"error": err.Error()})
 	}
 
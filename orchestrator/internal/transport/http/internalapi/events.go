@@ -3,7 +3,6 @@ package internalapi
 import (
 	"encoding/json"
 	"fmt"
-	"log"
 	"net/http"
 	"time"
 
@@ -23,7 +22,7 @@ func (h *Handler) StreamRunEvents(c echo.Context) error {
 	// Validate run exists
 	run, err := h.service.GetRun(ctx, runID)
 	if err != nil {
-		log.Printf("ERROR: failed to get run: %v", err)
+		h.logger.ErrorContext(ctx, "failed to get run", "run_id", runID, "error", err)
 		return c.JSON(http.StatusInternalServerError, map[string]string{"error": err.Error()})
 	}
 	if run == nil {
@@ -43,7 +42,7 @@ func (h *Handler) StreamRunEvents(c echo.Context) error {
 	}
 
 	// Start streaming events
-	lastTs := int64(0)
+	lastTs, lastSeq := int64(0), int64(0)
 	pollInterval := 100 * time.Millisecond
 	maxDuration := 5 * time.Minute // Maximum streaming duration
 
@@ -60,38 +59,36 @@ func (h *Handler) StreamRunEvents(c echo.Context) error {
 		case <-ticker.C:
 			// Check if exceeded max duration
 			if time.Now().After(deadline) {
-				log.Printf("INFO: event stream for run %s exceeded max duration", runID)
+				h.logger.InfoContext(ctx, "event stream exceeded max duration", "run_id", runID)
 				return nil
 			}
 
 			// Poll for new events
-			events, err := h.service.GetRunEvents(ctx, runID, lastTs, nil, 100)
+			events, err := h.service.GetRunEvents(ctx, runID, lastTs, lastSeq, nil, 100)
 			if err != nil {
-				log.Printf("ERROR: failed to get events: %v", err)
+				h.logger.ErrorContext(ctx, "failed to get events", "run_id", runID, "error", err)
 				continue
 			}
 
 			// Send new events
 			for _, event := range events {
-				if event.Ts > lastTs {
-					if err := h.sendSSEEvent(c, event); err != nil {
-						log.Printf("ERROR: failed to send SSE event: %v", err)
-						return err
-					}
-					lastTs = event.Ts
+				if err := h.sendSSEEvent(c, event); err != nil {
+					h.logger.ErrorContext(ctx, "failed to send SSE event", "run_id", runID, "error", err)
+					return err
 				}
+				lastTs, lastSeq = event.Ts, event.Seq
 			}
 
 			// Check if run is in terminal state
 			currentRun, err := h.service.GetRun(ctx, runID)
 			if err != nil {
-				log.Printf("ERROR: failed to get run status: %v", err)
+				h.logger.ErrorContext(ctx, "failed to get run status", "run_id", runID, "error", err)
 				continue
 			}
 
 			if h.isTerminalState(currentRun.Status) {
 				// Send a final marker event and close the stream
-				log.Printf("INFO: run %s reached terminal state: %s", runID, currentRun.Status)
+				h.logger.InfoContext(ctx, "run reached terminal state", "run_id", runID, "status", currentRun.Status)
 				return nil
 			}
 		}
@@ -133,4 +130,4 @@ func (h *Handler) isTerminalState(status domain.RunStatus) bool {
 	return status == domain.RunStatusDone ||
 		status == domain.RunStatusFailed ||
 		status == domain.RunStatusCancelled
-}
\ No newline at end of file
+}
@@ -0,0 +1,35 @@
+package internalapi
+
+import (
+	"errors"
+	"net/http"
+
+	"github.com/labstack/echo/v4"
+	"github.com/xiaot623/gogo/orchestrator/internal/domain"
+	"github.com/xiaot623/gogo/orchestrator/internal/service"
+)
+
+// GetFlags returns the current feature flags and runtime overrides.
+// GET /internal/flags
+func (h *Handler) GetFlags(c echo.Context) error {
+	return c.JSON(http.StatusOK, h.service.Flags())
+}
+
+// UpdateFlags overrides feature flags until restart; a null value clears an
+// override.
+// PUT /internal/flags
+func (h *Handler) UpdateFlags(c echo.Context) error {
+	var req domain.FeatureFlagsUpdate
+	if err := c.Bind(&req); err != nil {
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": "invalid request body"})
+	}
+
+	flags, err := h.service.SetFlags(req)
+	if errors.Is(err, service.ErrUnknownFlag) {
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": err.Error(), "code": "unknown_flag"})
+	}
+	if err != nil {
+		return c.JSON(http.StatusInternalServerError, map[string]string{"error": err.Error()})
+	}
+	return c.JSON(http.StatusOK, flags)
+}
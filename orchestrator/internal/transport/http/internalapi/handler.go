@@ -3,6 +3,8 @@
 package internalapi
 
 import (
+	"log/slog"
+
 	"github.com/labstack/echo/v4"
 	"github.com/xiaot623/gogo/orchestrator/internal/service"
 )
@@ -10,12 +12,14 @@ import (
 // Handler handles internal HTTP requests from ingress.
 type Handler struct {
 	service *service.Service
+	logger  *slog.Logger
 }
 
 // NewHandler creates a new internal API handler.
 func NewHandler(service *service.Service) *Handler {
 	return &Handler{
 		service: service,
+		logger:  service.Logger(),
 	}
 }
 
@@ -38,4 +42,12 @@ func (h *Handler) RegisterRoutes(e *echo.Echo) {
 
 	// Run management
 	e.POST("/internal/runs/:run_id/cancel", h.CancelRun)
+
+	// Session management
+	e.POST("/internal/sessions/:session_id/disconnect", h.DisconnectSession)
+	e.POST("/internal/sessions/:session_id/disconnected", h.SessionDisconnected)
+
+	// Feature flags
+	e.GET("/internal/flags", h.GetFlags)
+	e.PUT("/internal/flags", h.UpdateFlags)
 }
\ No newline at end of file
@@ -1,26 +1,70 @@
 package internalapi
 
 import (
+	"errors"
 	"net/http"
+	"strconv"
+	"time"
 
 	"github.com/labstack/echo/v4"
 	"github.com/xiaot623/gogo/orchestrator/internal/domain"
+	"github.com/xiaot623/gogo/orchestrator/internal/service"
 )
 
+// ephemeralHeader, when set, supplies the invoke's "ephemeral" context entry.
+const ephemeralHeader = "X-Ephemeral-Session"
+
 // Invoke handles agent invocation request from ingress.
 // POST /internal/invoke
+//
+// With ?wait=true the response is held until the run finishes (or wait_ms,
+// capped at INVOKE_WAIT_MAX_MS, elapses) and carries the run's outcome.
 func (h *Handler) Invoke(c echo.Context) error {
 	var req domain.InvokeRequest
 	if err := c.Bind(&req); err != nil {
 		return c.JSON(http.StatusBadRequest, map[string]string{"error": "invalid request body"})
 	}
+	if ephemeral := c.Request().Header.Get(ephemeralHeader); ephemeral != "" {
+		if req.Context == nil {
+			req.Context = make(map[string]string)
+		}
+		req.Context[domain.EphemeralContextKey] = ephemeral
+	}
 
 	ctx := c.Request().Context()
-	
+
+	if wait, _ := strconv.ParseBool(c.QueryParam("wait")); wait {
+		var waitFor time.Duration
+		if raw := c.QueryParam("wait_ms"); raw != "" {
+			ms, err := strconv.Atoi(raw)
+			if err != nil || ms <= 0 {
+				return c.JSON(http.StatusBadRequest, map[string]string{"error": "wait_ms must be a positive integer"})
+			}
+			waitFor = time.Duration(ms) * time.Millisecond
+		}
+
+		result, err := h.service.InvokeAgentAndWait(ctx, req, waitFor)
+		if errors.Is(err, service.ErrMaintenance) {
+			return c.JSON(http.StatusServiceUnavailable, map[string]string{"error": err.Error(), "code": "maintenance"})
+		}
+		if err != nil {
+			return c.JSON(http.StatusInternalServerError, map[string]string{"error": err.Error()})
+		}
+		switch result.Status {
+		case domain.RunStatusDone, domain.RunStatusFailed, domain.RunStatusCancelled:
+			return c.JSON(http.StatusOK, result)
+		}
+		// Still running: the caller can follow up with the run_id.
+		return c.JSON(http.StatusAccepted, result)
+	}
+
 	resp, err := h.service.InvokeAgent(ctx, req)
+	if errors.Is(err, service.ErrMaintenance) {
+		return c.JSON(http.StatusServiceUnavailable, map[string]string{"error": err.Error(), "code": "maintenance"})
+	}
 	if err != nil {
 		return c.JSON(http.StatusInternalServerError, map[string]string{"error": err.Error()})
 	}
 
 	return c.JSON(http.StatusOK, resp)
-}
\ No newline at end of file
+}
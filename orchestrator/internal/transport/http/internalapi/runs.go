@@ -7,13 +7,19 @@ import (
 	"github.com/xiaot623/gogo/orchestrator/internal/domain"
 )
 
-// CancelRun cancels a running execution.
+// CancelRun cancels a running execution. The optional body carries the
+// reason and decided_by.
 // POST /internal/runs/:run_id/cancel
 func (h *Handler) CancelRun(c echo.Context) error {
 	runID := c.Param("run_id")
 	ctx := c.Request().Context()
 
-	if err := h.service.CancelRun(ctx, runID); err != nil {
+	var req domain.CancelRunRequest
+	if err := c.Bind(&req); err != nil {
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": "invalid request body"})
+	}
+
+	if err := h.service.CancelRun(ctx, runID, req); err != nil {
 		return c.JSON(http.StatusInternalServerError, map[string]string{"error": err.Error()})
 	}
 
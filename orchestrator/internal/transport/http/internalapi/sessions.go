@@ -0,0 +1,51 @@
+package internalapi
+
+import (
+	"errors"
+	"net/http"
+
+	"github.com/labstack/echo/v4"
+	"github.com/xiaot623/gogo/orchestrator/internal/service"
+)
+
+// DisconnectSessionRequest is the optional body of a disconnect request.
+type DisconnectSessionRequest struct {
+	Code   int    `json:"code,omitempty"`
+	Reason string `json:"reason,omitempty"`
+}
+
+// DisconnectSession evicts every WebSocket connection of a session.
+// POST /internal/sessions/:session_id/disconnect
+func (h *Handler) DisconnectSession(c echo.Context) error {
+	sessionID := c.Param("session_id")
+	var req DisconnectSessionRequest
+	if err := c.Bind(&req); err != nil {
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": "invalid request body"})
+	}
+
+	ctx := c.Request().Context()
+
+	n, err := h.service.DisconnectSession(ctx, sessionID, req.Code, req.Reason)
+	if errors.Is(err, service.ErrInvalidCloseCode) {
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": err.Error(), "code": "invalid_close_code"})
+	}
+	if err != nil {
+		return c.JSON(http.StatusBadGateway, map[string]string{"error": err.Error()})
+	}
+
+	return c.JSON(http.StatusOK, map[string]interface{}{
+		"session_id":   sessionID,
+		"disconnected": n,
+	})
+}
+
+// SessionDisconnected is called by ingress when the last connection of a
+// session closes; see Service.SessionDisconnected.
+// POST /internal/sessions/:session_id/disconnected
+func (h *Handler) SessionDisconnected(c echo.Context) error {
+	resp, err := h.service.SessionDisconnected(c.Request().Context(), c.Param("session_id"))
+	if err != nil {
+		return c.JSON(http.StatusInternalServerError, map[string]string{"error": err.Error()})
+	}
+	return c.JSON(http.StatusOK, resp)
+}
@@ -1,10 +1,12 @@
 package internalapi
 
 import (
+	"errors"
 	"net/http"
 
 	"github.com/labstack/echo/v4"
 	"github.com/xiaot623/gogo/orchestrator/internal/domain"
+	"github.com/xiaot623/gogo/orchestrator/internal/service"
 )
 
 // RegisterTools handles client tool registration from ingress.
@@ -26,6 +28,15 @@ func (h *Handler) RegisterTools(c echo.Context) error {
 	ctx := c.Request().Context()
 
 	resp, err := h.service.RegisterTools(ctx, req)
+	if errors.Is(err, service.ErrMaintenance) {
+		return c.JSON(http.StatusServiceUnavailable, map[string]string{"error": err.Error(), "code": "maintenance"})
+	}
+	if errors.Is(err, service.ErrInvalidTool) {
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": err.Error(), "code": "invalid_tool"})
+	}
+	if errors.Is(err, service.ErrInvalidResultSchema) {
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": err.Error(), "code": "invalid_result_schema"})
+	}
 	if err != nil {
 		return c.JSON(http.StatusInternalServerError, map[string]string{"error": err.Error()})
 	}
@@ -50,6 +61,18 @@ func (h *Handler) SubmitToolResult(c echo.Context) error {
 	ctx := c.Request().Context()
 	
 	resp, err := h.service.SubmitToolResult(ctx, toolCallID, req)
+	if errors.Is(err, service.ErrNotClientTool) {
+		return c.JSON(http.StatusConflict, map[string]string{"error": err.Error(), "code": "not_client_tool"})
+	}
+	if errors.Is(err, service.ErrResultTooLarge) {
+		return c.JSON(http.StatusRequestEntityTooLarge, map[string]string{"error": err.Error(), "code": "result_too_large"})
+	}
+	if errors.Is(err, service.ErrNonceReused) {
+		return c.JSON(http.StatusConflict, map[string]string{"error": err.Error(), "code": "nonce_reused"})
+	}
+	if errors.Is(err, service.ErrNonceInFlight) {
+		return c.JSON(http.StatusConflict, map[string]string{"error": err.Error(), "code": "nonce_in_flight"})
+	}
 	if err != nil {
 		return c.JSON(http.StatusInternalServerError, map[string]string{"error": err.Error()})
 	}
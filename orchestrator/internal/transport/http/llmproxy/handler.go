@@ -2,9 +2,14 @@ package llmproxy
 
 import (
 	"encoding/json"
+	"errors"
 	"fmt"
+	"io"
+	"log/slog"
 	"net/http"
 	"context"
+	"sync"
+	"time"
 
 	"github.com/labstack/echo/v4"
 	"github.com/xiaot623/gogo/orchestrator/internal/adapter/llm"
@@ -14,12 +19,14 @@ import (
 // Handler handles LLM proxy HTTP requests.
 type Handler struct {
 	service *service.Service
+	logger  *slog.Logger
 }
 
 // NewHandler creates a new LLM proxy handler.
 func NewHandler(service *service.Service) *Handler {
 	return &Handler{
 		service: service,
+		logger:  service.Logger(),
 	}
 }
 
@@ -48,7 +55,8 @@ func (h *Handler) ChatCompletions(c echo.Context) error {
 		})
 	}
 
-	// Validate required fields
+	// Validate required fields, once aliases and the default model apply
+	h.service.ResolveLLMModel(&req)
 	if req.Model == "" {
 		return c.JSON(http.StatusBadRequest, llm.ErrorResponse{
 			Error: &llm.APIError{
@@ -68,6 +76,15 @@ func (h *Handler) ChatCompletions(c echo.Context) error {
 		})
 	}
 
+	if err := h.service.ApplyLLMParamLimits(&req); err != nil {
+		return c.JSON(http.StatusBadRequest, llm.ErrorResponse{
+			Error: &llm.APIError{
+				Message: err.Error(),
+				Type:    "invalid_request_error",
+			},
+		})
+	}
+
 	if req.Stream {
 		return h.handleStreamingRequest(c, ctx, runID, &req)
 	}
@@ -78,6 +95,9 @@ func (h *Handler) ChatCompletions(c echo.Context) error {
 // handleNonStreamingRequest handles non-streaming chat completion requests.
 func (h *Handler) handleNonStreamingRequest(c echo.Context, ctx context.Context, runID string, req *llm.ChatCompletionRequest) error {
 	resp, err := h.service.ProxyChatCompletion(ctx, runID, req)
+	if errors.Is(err, llm.ErrCircuitOpen) {
+		return circuitOpenResponse(c, err)
+	}
 	if err != nil {
 		// Error handling could be improved to map to OpenAI error types
 		return c.JSON(http.StatusBadGateway, llm.ErrorResponse{
@@ -93,10 +113,11 @@ func (h *Handler) handleNonStreamingRequest(c echo.Context, ctx context.Context,
 
 // handleStreamingRequest handles streaming chat completion requests.
 func (h *Handler) handleStreamingRequest(c echo.Context, ctx context.Context, runID string, req *llm.ChatCompletionRequest) error {
+	// The 200 status is sent with the first write, so a request rejected by
+	// the circuit breaker can still be answered with a 503.
 	c.Response().Header().Set("Content-Type", "text/event-stream")
 	c.Response().Header().Set("Cache-Control", "no-cache")
 	c.Response().Header().Set("Connection", "keep-alive")
-	c.Response().WriteHeader(http.StatusOK)
 
 	flusher, ok := c.Response().Writer.(http.Flusher)
 	if !ok {
@@ -108,6 +129,11 @@ func (h *Handler) handleStreamingRequest(c echo.Context, ctx context.Context, ru
 		})
 	}
 	
+	// Writes from the keepalive goroutine and the chunk callback must not
+	// interleave.
+	var mu sync.Mutex
+	stopKeepalive := h.startKeepalive(&mu, c.Response().Writer, flusher)
+
 	err := h.service.ProxyChatCompletionStream(ctx, runID, req, func(chunk *llm.StreamChunk) error {
 		// Forward the chunk as SSE
 		data, err := json.Marshal(chunk)
@@ -115,6 +141,8 @@ func (h *Handler) handleStreamingRequest(c echo.Context, ctx context.Context, ru
 			return err
 		}
 
+		mu.Lock()
+		defer mu.Unlock()
 		_, writeErr := fmt.Fprintf(c.Response().Writer, "data: %s\n\n", data)
 		if writeErr != nil {
 			return writeErr
@@ -123,25 +151,84 @@ func (h *Handler) handleStreamingRequest(c echo.Context, ctx context.Context, ru
 		return nil
 	})
 
-	// Write [DONE] marker
+	// Write [DONE] marker; no keepalive may follow it.
+	stopKeepalive()
+	if errors.Is(err, llm.ErrCircuitOpen) && !c.Response().Committed {
+		header := c.Response().Header()
+		header.Del("Content-Type")
+		header.Del("Cache-Control")
+		header.Del("Connection")
+		return circuitOpenResponse(c, err)
+	}
 	fmt.Fprintf(c.Response().Writer, "data: [DONE]\n\n")
 	flusher.Flush()
 
 	if err != nil {
 		// Can't change status code after writing response
 		// Just log it
-		fmt.Printf("ERROR: LLM streaming request failed: %v\n", err)
+		h.logger.ErrorContext(ctx, "LLM streaming request failed", "run_id", runID, "model", req.Model, "error", err)
 	}
 
 	return nil
 }
 
+// startKeepalive writes an SSE comment line every LLMStreamKeepalive interval
+// so idle connections survive long upstream pauses. The returned function
+// stops the ticker and waits for any in-progress write to finish.
+func (h *Handler) startKeepalive(mu *sync.Mutex, w io.Writer, flusher http.Flusher) func() {
+	interval := h.service.LLMStreamKeepalive()
+	if interval <= 0 {
+		return func() {}
+	}
+
+	stop := make(chan struct{})
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-stop:
+				return
+			case <-ticker.C:
+				mu.Lock()
+				_, err := io.WriteString(w, ": keepalive\n\n")
+				if err == nil {
+					flusher.Flush()
+				}
+				mu.Unlock()
+				if err != nil {
+					return
+				}
+			}
+		}
+	}()
+	return func() {
+		close(stop)
+		<-done
+	}
+}
+
+// circuitOpenResponse answers a request that the LLM circuit breaker refused.
+func circuitOpenResponse(c echo.Context, err error) error {
+	return c.JSON(http.StatusServiceUnavailable, llm.ErrorResponse{
+		Error: &llm.APIError{
+			Message: err.Error(),
+			Type:    "service_unavailable",
+		},
+	})
+}
+
 // ListModels handles the models list request.
 // GET /v1/models
 func (h *Handler) ListModels(c echo.Context) error {
 	ctx := c.Request().Context()
 
 	models, err := h.service.ListModels(ctx)
+	if errors.Is(err, llm.ErrCircuitOpen) {
+		return circuitOpenResponse(c, err)
+	}
 	if err != nil {
 		return c.JSON(http.StatusBadGateway, llm.ErrorResponse{
 			Error: &llm.APIError{
@@ -6,6 +6,7 @@ import (
 	"encoding/json"
 	"net/http"
 	"net/http/httptest"
+	"strings"
 	"testing"
 	"time"
 
@@ -22,10 +23,13 @@ import (
 )
 
 func newTestHandler(t *testing.T, liteLLMURL string) (*Handler, store.Store) {
-	cfg := &config.Config{
+	return newTestHandlerWithConfig(t, &config.Config{
 		LiteLLMURL: liteLLMURL,
 		LLMTimeout: time.Second,
-	}
+	})
+}
+
+func newTestHandlerWithConfig(t *testing.T, cfg *config.Config) (*Handler, store.Store) {
 	db := helpers.NewTestSQLiteStore(t)
 	agentClient := agentclient.NewClient()
 	ingressClient := ingress.NewClient("")
@@ -92,7 +96,7 @@ func TestChatCompletionsNonStreaming(t *testing.T) {
 		t.Fatalf("expected 200, got %d", rec.Code)
 	}
 
-	events, err := db.GetEvents(ctx, "run_1", 0, []string{string(domain.EventTypeLLMCallStarted), string(domain.EventTypeLLMCallDone)}, 10)
+	events, err := db.GetEvents(ctx, "run_1", 0, 0, []string{string(domain.EventTypeLLMCallStarted), string(domain.EventTypeLLMCallDone)}, 10)
 	if err != nil {
 		t.Fatalf("GetEvents failed: %v", err)
 	}
@@ -141,7 +145,7 @@ func TestChatCompletionsStreaming(t *testing.T) {
 		t.Fatalf("expected DONE marker")
 	}
 
-	events, err := db.GetEvents(ctx, "run_stream", 0, []string{string(domain.EventTypeLLMCallStarted), string(domain.EventTypeLLMCallDone)}, 10)
+	events, err := db.GetEvents(ctx, "run_stream", 0, 0, []string{string(domain.EventTypeLLMCallStarted), string(domain.EventTypeLLMCallDone)}, 10)
 	if err != nil {
 		t.Fatalf("GetEvents failed: %v", err)
 	}
@@ -176,4 +180,239 @@ func TestListModels(t *testing.T) {
 	if rec.Code != http.StatusOK {
 		t.Fatalf("expected 200, got %d", rec.Code)
 	}
-}
\ No newline at end of file
+}
+func TestChatCompletionsStreamingKeepalive(t *testing.T) {
+	liteServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/event-stream")
+		w.WriteHeader(http.StatusOK)
+		w.(http.Flusher).Flush()
+		// Stall like a model that is thinking before its first token.
+		time.Sleep(200 * time.Millisecond)
+		w.Write([]byte("data: {\"id\":\"c1\",\"object\":\"chat.completion.chunk\",\"created\":1,\"model\":\"gpt\",\"choices\":[{\"index\":0,\"delta\":{\"role\":\"assistant\",\"content\":\"hi\"}}]}\n\n"))
+		w.Write([]byte("data: [DONE]\n\n"))
+	}))
+	defer liteServer.Close()
+
+	h, _ := newTestHandlerWithConfig(t, &config.Config{
+		LiteLLMURL:         liteServer.URL,
+		LLMTimeout:         time.Second,
+		LLMStreamKeepalive: 20 * time.Millisecond,
+	})
+	e := echo.New()
+
+	body := `{"model":"gpt","messages":[{"role":"user","content":"hello"}],"stream":true}`
+	req := httptest.NewRequest(http.MethodPost, "/v1/chat/completions", bytes.NewBufferString(body))
+	req.Header.Set("Content-Type", "application/json")
+	rec := httptest.NewRecorder()
+	c := e.NewContext(req, rec)
+
+	if err := h.ChatCompletions(c); err != nil {
+		t.Fatalf("handler error: %v", err)
+	}
+
+	out := rec.Body.String()
+	first := strings.Index(out, ": keepalive\n\n")
+	chunk := strings.Index(out, "data: {")
+	if first < 0 || chunk < 0 || first > chunk {
+		t.Fatalf("expected keepalives before the first chunk, got %q", out)
+	}
+	if !strings.HasSuffix(out, "data: [DONE]\n\n") {
+		t.Fatalf("expected stream to end with the DONE marker, got %q", out)
+	}
+	// Every frame is either a data line or a keepalive comment.
+	for _, frame := range strings.Split(strings.TrimSuffix(out, "\n\n"), "\n\n") {
+		if !strings.HasPrefix(frame, "data: ") && frame != ": keepalive" {
+			t.Fatalf("corrupted frame %q in %q", frame, out)
+		}
+	}
+}
+
+func TestChatCompletionsCircuitOpen(t *testing.T) {
+	liteServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusBadGateway)
+	}))
+	defer liteServer.Close()
+
+	cfg := &config.Config{LiteLLMURL: liteServer.URL, LLMTimeout: time.Second}
+	breaker := llm.NewBreaker(llm.NewClient(cfg.LiteLLMURL, "", cfg.LLMTimeout), 1, time.Minute)
+	svc := service.New(helpers.NewTestSQLiteStore(t), agentclient.NewClient(), ingress.NewClient(""), breaker, cfg, nil)
+	h := NewHandler(svc)
+	e := echo.New()
+
+	post := func(body string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodPost, "/v1/chat/completions", bytes.NewBufferString(body))
+		req.Header.Set("Content-Type", "application/json")
+		rec := httptest.NewRecorder()
+		if err := h.ChatCompletions(e.NewContext(req, rec)); err != nil {
+			t.Fatalf("handler error: %v", err)
+		}
+		return rec
+	}
+
+	// The first failure reaches the upstream and trips the breaker.
+	if rec := post(`{"model":"gpt","messages":[{"role":"user","content":"hello"}]}`); rec.Code != http.StatusBadGateway {
+		t.Fatalf("expected 502, got %d", rec.Code)
+	}
+
+	for _, body := range []string{
+		`{"model":"gpt","messages":[{"role":"user","content":"hello"}]}`,
+		`{"model":"gpt","messages":[{"role":"user","content":"hello"}],"stream":true}`,
+	} {
+		rec := post(body)
+		if rec.Code != http.StatusServiceUnavailable {
+			t.Fatalf("expected 503, got %d: %s", rec.Code, rec.Body.String())
+		}
+		var resp llm.ErrorResponse
+		if err := json.Unmarshal(rec.Body.Bytes(), &resp); err != nil || resp.Error == nil || resp.Error.Type != "service_unavailable" {
+			t.Fatalf("unexpected body %q: %v", rec.Body.String(), err)
+		}
+	}
+}
+
+func TestChatCompletionsParamLimits(t *testing.T) {
+	var forwarded llm.ChatCompletionRequest
+	liteServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		json.NewDecoder(r.Body).Decode(&forwarded)
+		w.Header().Set("Content-Type", "application/json")
+		w.Write([]byte(`{"id":"c1","object":"chat.completion","created":1,"model":"gpt","choices":[{"index":0,"message":{"role":"assistant","content":"hi"},"finish_reason":"stop"}]}`))
+	}))
+	defer liteServer.Close()
+
+	defaultTemperature := 0.3
+	cfg := &config.Config{
+		LiteLLMURL:            liteServer.URL,
+		LLMTimeout:            time.Second,
+		LLMDefaultTemperature: &defaultTemperature,
+		LLMMaxTokensLimit:     4096,
+		LLMParamOverflow:      config.LLMParamOverflowClamp,
+	}
+
+	post := func(h *Handler, body string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodPost, "/v1/chat/completions", bytes.NewBufferString(body))
+		req.Header.Set("Content-Type", "application/json")
+		rec := httptest.NewRecorder()
+		if err := h.ChatCompletions(echo.New().NewContext(req, rec)); err != nil {
+			t.Fatalf("handler error: %v", err)
+		}
+		return rec
+	}
+
+	h, _ := newTestHandlerWithConfig(t, cfg)
+	rec := post(h, `{"model":"gpt","messages":[{"role":"user","content":"hello"}],"max_tokens":1000000}`)
+	if rec.Code != http.StatusOK {
+		t.Fatalf("expected 200, got %d: %s", rec.Code, rec.Body.String())
+	}
+	if forwarded.MaxTokens == nil || *forwarded.MaxTokens != 4096 {
+		t.Fatalf("expected max_tokens clamped to 4096, got %v", forwarded.MaxTokens)
+	}
+	if forwarded.Temperature == nil || *forwarded.Temperature != defaultTemperature {
+		t.Fatalf("expected default temperature %v, got %v", defaultTemperature, forwarded.Temperature)
+	}
+
+	forwarded = llm.ChatCompletionRequest{}
+	rec = post(h, `{"model":"gpt","messages":[{"role":"user","content":"hello"}],"max_tokens":100,"temperature":1.5}`)
+	if rec.Code != http.StatusOK {
+		t.Fatalf("expected 200, got %d", rec.Code)
+	}
+	if *forwarded.MaxTokens != 100 || *forwarded.Temperature != 1.5 {
+		t.Fatalf("expected in-range params forwarded unchanged, got max_tokens=%d temperature=%v", *forwarded.MaxTokens, *forwarded.Temperature)
+	}
+
+	rejecting := *cfg
+	rejecting.LLMParamOverflow = config.LLMParamOverflowReject
+	h, _ = newTestHandlerWithConfig(t, &rejecting)
+	forwarded = llm.ChatCompletionRequest{}
+	rec = post(h, `{"model":"gpt","messages":[{"role":"user","content":"hello"}],"max_tokens":1000000}`)
+	if rec.Code != http.StatusBadRequest || !strings.Contains(rec.Body.String(), "max_tokens") {
+		t.Fatalf("expected 400 naming max_tokens, got %d: %s", rec.Code, rec.Body.String())
+	}
+	if forwarded.Model != "" {
+		t.Fatal("rejected request was forwarded upstream")
+	}
+}
+
+func TestChatCompletionsModelAliases(t *testing.T) {
+	models := make(chan string, 1)
+	liteServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		if r.URL.Path == "/v1/models" {
+			w.Write([]byte(`{"object":"list","data":[{"id":"gpt-4o","object":"model","created":1,"owned_by":"openai"}]}`))
+			return
+		}
+		var body llm.ChatCompletionRequest
+		_ = json.NewDecoder(r.Body).Decode(&body)
+		models <- body.Model
+		// The upstream leaves model out of its answer.
+		w.Write([]byte(`{"id":"c1","object":"chat.completion","created":1,"choices":[{"index":0,"message":{"role":"assistant","content":"hi"},"finish_reason":"stop"}]}`))
+	}))
+	defer liteServer.Close()
+
+	h, db := newTestHandlerWithConfig(t, &config.Config{
+		LiteLLMURL:          liteServer.URL,
+		LLMTimeout:          time.Second,
+		LLMDefaultModel:     "gpt-4o",
+		LLMModelAliases:     map[string]string{"fast": "gpt-4o-mini", "smart": "gpt-4o"},
+		LLMListModelAliases: true,
+	})
+	e := echo.New()
+
+	ctx := context.Background()
+	if err := db.CreateSession(ctx, &domain.Session{SessionID: "s1", UserID: "u1", CreatedAt: time.Now()}); err != nil {
+		t.Fatalf("CreateSession failed: %v", err)
+	}
+	if err := db.CreateRun(ctx, &domain.Run{RunID: "run_1", SessionID: "s1", RootAgentID: "agent", Status: domain.RunStatusCreated, StartedAt: time.Now()}); err != nil {
+		t.Fatalf("CreateRun failed: %v", err)
+	}
+
+	for _, tt := range []struct{ requested, want string }{
+		{`"fast"`, "gpt-4o-mini"},
+		{`""`, "gpt-4o"},
+		{`"default"`, "gpt-4o"},
+		{`"gpt-3.5-turbo"`, "gpt-3.5-turbo"},
+	} {
+		body := `{"model":` + tt.requested + `,"messages":[{"role":"user","content":"hello"}]}`
+		req := httptest.NewRequest(http.MethodPost, "/v1/chat/completions", bytes.NewBufferString(body))
+		req.Header.Set("Content-Type", "application/json")
+		req.Header.Set("x-run-id", "run_1")
+		rec := httptest.NewRecorder()
+		if err := h.ChatCompletions(e.NewContext(req, rec)); err != nil {
+			t.Fatalf("handler error: %v", err)
+		}
+		if rec.Code != http.StatusOK {
+			t.Fatalf("%s: expected 200, got %d: %s", tt.requested, rec.Code, rec.Body.String())
+		}
+		if got := <-models; got != tt.want {
+			t.Fatalf("%s: upstream got model %q, want %q", tt.requested, got, tt.want)
+		}
+		var resp llm.ChatCompletionResponse
+		if err := json.Unmarshal(rec.Body.Bytes(), &resp); err != nil || resp.Model != tt.want {
+			t.Fatalf("%s: expected response model %q, got %q (%v)", tt.requested, tt.want, resp.Model, err)
+		}
+	}
+
+	events, err := db.GetEvents(ctx, "run_1", 0, 0, []string{string(domain.EventTypeLLMCallStarted)}, 1)
+	if err != nil || len(events) != 1 {
+		t.Fatalf("GetEvents failed: %v", err)
+	}
+	var started domain.LLMCallStartedPayload
+	if err := json.Unmarshal(events[0].Payload, &started); err != nil || started.Model != "gpt-4o-mini" {
+		t.Fatalf("expected llm_call_started for the resolved model, got %+v (%v)", started, err)
+	}
+
+	req := httptest.NewRequest(http.MethodGet, "/v1/models", nil)
+	rec := httptest.NewRecorder()
+	if err := h.ListModels(e.NewContext(req, rec)); err != nil {
+		t.Fatalf("handler error: %v", err)
+	}
+	var listed llm.ModelsResponse
+	if err := json.Unmarshal(rec.Body.Bytes(), &listed); err != nil {
+		t.Fatalf("invalid models response: %v", err)
+	}
+	var ids []string
+	for _, m := range listed.Data {
+		ids = append(ids, m.ID)
+	}
+	if strings.Join(ids, ",") != "gpt-4o,fast,smart" {
+		t.Fatalf("expected upstream models then aliases, got %v", ids)
+	}
+}
@@ -4,6 +4,7 @@ package http
 import (
 	"github.com/labstack/echo/v4"
 	"github.com/labstack/echo/v4/middleware"
+	"github.com/xiaot623/gogo/orchestrator/internal/config"
 	"github.com/xiaot623/gogo/orchestrator/internal/service"
 	"github.com/xiaot623/gogo/orchestrator/internal/transport/http/internalapi"
 	"github.com/xiaot623/gogo/orchestrator/internal/transport/http/llmproxy"
@@ -12,7 +13,9 @@ import (
 
 // NewExternalServer creates and configures the external-facing HTTP server.
 // This server handles agent registration, tool invocations, and LLM proxying.
-func NewExternalServer(svc *service.Service) *echo.Echo {
+// When cfg.APIKeys is set, every route outside cfg.AuthPublicPaths requires
+// one of them as a bearer token.
+func NewExternalServer(svc *service.Service, cfg *config.Config) *echo.Echo {
 	e := echo.New()
 	e.HideBanner = true
 
@@ -20,6 +23,7 @@ func NewExternalServer(svc *service.Service) *echo.Echo {
 	e.Use(middleware.Logger())
 	e.Use(middleware.Recover())
 	e.Use(middleware.CORS())
+	e.Use(BearerAuth(cfg.APIKeys, cfg.AuthPublicPaths))
 
 	// Handlers
 	v1Handler := v1.NewHandler(svc)
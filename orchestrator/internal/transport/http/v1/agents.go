@@ -1,9 +1,13 @@
 package v1
 
 import (
+	"errors"
 	"net/http"
 
 	"github.com/labstack/echo/v4"
+	"github.com/xiaot623/gogo/orchestrator/internal/adapter/agentclient"
+	"github.com/xiaot623/gogo/orchestrator/internal/domain"
+	"github.com/xiaot623/gogo/orchestrator/internal/service"
 )
 
 // AgentRegisterRequest is the request to register an agent.
@@ -12,6 +16,32 @@ type AgentRegisterRequest struct {
 	Name         string   `json:"name"`
 	Endpoint     string   `json:"endpoint"`
 	Capabilities []string `json:"capabilities,omitempty"`
+	// Headers are sent with every invocation of the agent, e.g. an
+	// Authorization bearer token or tenant routing header.
+	Headers map[string]string `json:"headers,omitempty"`
+	// Protocol is "native" (default), "openai_chat" for OpenAI-compatible
+	// chat completion endpoints, or "llm_tools" for a built-in agent that
+	// needs no endpoint.
+	Protocol domain.AgentProtocol `json:"protocol,omitempty"`
+	// ResponseFormat is "sse" or "ndjson"; empty detects it from the
+	// response Content-Type.
+	ResponseFormat domain.AgentResponseFormat `json:"response_format,omitempty"`
+	// CancelURL is an optional http(s) URL POSTed {"run_id", "session_id",
+	// "reason"} when a run the agent is working on is cancelled.
+	CancelURL string `json:"cancel_url,omitempty"`
+	// MaxConcurrentToolCalls overrides MAX_CONCURRENT_TOOL_CALLS for the
+	// agent's runs: 0 uses the global cap and -1 lifts it.
+	MaxConcurrentToolCalls int `json:"max_concurrent_tool_calls,omitempty"`
+	// RequestFilter limits what the agent is sent with each invoke: an
+	// allowlist of context keys and/or no session history.
+	RequestFilter *domain.AgentRequestFilter `json:"request_filter,omitempty"`
+	// LLM configures an llm_tools agent: model, system prompt, tools and
+	// iteration cap.
+	LLM *domain.LLMAgentConfig `json:"llm,omitempty"`
+	// Verify probes the agent before registering it and rejects the
+	// registration with 422 if it does not answer. Leave it unset to
+	// register agents the orchestrator cannot reach yet.
+	Verify bool `json:"verify,omitempty"`
 }
 
 // RegisterAgent registers a new agent.
@@ -30,11 +60,41 @@ func (h *Handler) RegisterAgent(c echo.Context) error {
 	if req.Name == "" {
 		return c.JSON(http.StatusBadRequest, map[string]string{"error": "name is required"})
 	}
-	if req.Endpoint == "" {
+	if req.Protocol.Builtin() {
+		if err := req.LLM.Validate(); err != nil {
+			return c.JSON(http.StatusBadRequest, map[string]string{"error": err.Error()})
+		}
+	} else if req.Endpoint == "" {
 		return c.JSON(http.StatusBadRequest, map[string]string{"error": "endpoint is required"})
+	} else if err := agentclient.ValidateEndpoint(req.Endpoint); err != nil {
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": err.Error()})
+	}
+	if err := agentclient.ValidateHeaders(req.Headers); err != nil {
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": err.Error()})
+	}
+	if !req.Protocol.Valid() {
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": "protocol must be native, openai_chat or llm_tools"})
+	}
+	if !req.ResponseFormat.Valid() {
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": "response_format must be sse or ndjson"})
+	}
+	if err := agentclient.ValidateCancelURL(req.CancelURL); err != nil {
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": err.Error()})
+	}
+	if req.MaxConcurrentToolCalls < -1 {
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": "max_concurrent_tool_calls must be -1 (no cap), 0 (global cap) or positive"})
+	}
+
+	if req.Verify {
+		if err := h.service.ProbeAgent(ctx, req.Endpoint, req.Protocol, req.Headers); err != nil {
+			return c.JSON(http.StatusUnprocessableEntity, map[string]string{"error": err.Error(), "code": "agent_unreachable"})
+		}
 	}
 
-	agent, err := h.service.RegisterAgent(ctx, req.AgentID, req.Name, req.Endpoint, req.Capabilities)
+	agent, err := h.service.RegisterAgent(ctx, req.AgentID, req.Name, req.Endpoint, req.Capabilities, req.Headers, req.Protocol, req.ResponseFormat, req.CancelURL, req.MaxConcurrentToolCalls, req.RequestFilter, req.LLM)
+	if errors.Is(err, service.ErrMaintenance) {
+		return c.JSON(http.StatusServiceUnavailable, map[string]string{"error": err.Error(), "code": "maintenance"})
+	}
 	if err != nil {
 		return c.JSON(http.StatusInternalServerError, map[string]string{"error": err.Error()})
 	}
@@ -54,6 +114,10 @@ func (h *Handler) ListAgents(c echo.Context) error {
 	if err != nil {
 		return c.JSON(http.StatusInternalServerError, map[string]string{"error": err.Error()})
 	}
+	activeRuns, err := h.service.ActiveRunsByAgent(ctx)
+	if err != nil {
+		return c.JSON(http.StatusInternalServerError, map[string]string{"error": err.Error()})
+	}
 
 	// Convert to response format
 	agentList := make([]map[string]interface{}, len(agents))
@@ -61,8 +125,13 @@ func (h *Handler) ListAgents(c echo.Context) error {
 		agentList[i] = map[string]interface{}{
 			"agent_id":          a.AgentID,
 			"name":              a.Name,
-			"status":            a.Status,
-			"last_heartbeat_at": nil,
+			"status":               a.Status,
+			"consecutive_failures": a.ConsecutiveFailures,
+			"active_runs":          activeRuns[a.AgentID],
+			"last_heartbeat_at":    nil,
+		}
+		if a.LastError != "" {
+			agentList[i]["last_error"] = a.LastError
 		}
 		if a.LastHeartbeat != nil {
 			agentList[i]["last_heartbeat_at"] = a.LastHeartbeat.UnixMilli()
@@ -87,6 +156,7 @@ func (h *Handler) GetAgent(c echo.Context) error {
 	if agent == nil {
 		return c.JSON(http.StatusNotFound, map[string]string{"error": "agent not found"})
 	}
+	agent.Headers = agentclient.RedactHeaders(agent.Headers)
 
 	return c.JSON(http.StatusOK, agent)
 }
\ No newline at end of file
@@ -5,6 +5,7 @@ import (
 	"context"
 	"net/http"
 	"net/http/httptest"
+	"strings"
 	"testing"
 	"time"
 
@@ -151,3 +152,165 @@ func TestGetAgentSuccess(t *testing.T) {
 		t.Fatalf("expected 200, got %d", rec.Code)
 	}
 }
+
+func TestRegisterAgentHeaders(t *testing.T) {
+	e := echo.New()
+	h, db := newTestHandler(t)
+
+	body := `{"agent_id":"demo","name":"Demo","endpoint":"http://agent","headers":{"Authorization":"Bearer s3cret","X-Tenant":"acme"}}`
+	req := httptest.NewRequest(http.MethodPost, "/v1/agents/register", bytes.NewBufferString(body))
+	req.Header.Set("Content-Type", "application/json")
+	rec := httptest.NewRecorder()
+	if err := h.RegisterAgent(e.NewContext(req, rec)); err != nil {
+		t.Fatalf("handler error: %v", err)
+	}
+	if rec.Code != http.StatusOK {
+		t.Fatalf("expected 200, got %d", rec.Code)
+	}
+
+	got, err := db.GetAgent(context.Background(), "demo")
+	if err != nil {
+		t.Fatalf("GetAgent failed: %v", err)
+	}
+	if got.Headers["Authorization"] != "Bearer s3cret" || got.Headers["X-Tenant"] != "acme" {
+		t.Fatalf("unexpected stored headers: %+v", got.Headers)
+	}
+
+	req = httptest.NewRequest(http.MethodGet, "/v1/agents/demo", nil)
+	rec = httptest.NewRecorder()
+	c := e.NewContext(req, rec)
+	c.SetParamNames("agent_id")
+	c.SetParamValues("demo")
+	if err := h.GetAgent(c); err != nil {
+		t.Fatalf("handler error: %v", err)
+	}
+	if strings.Contains(rec.Body.String(), "s3cret") || !strings.Contains(rec.Body.String(), "acme") {
+		t.Fatalf("expected redacted headers, got %s", rec.Body.String())
+	}
+}
+
+func TestRegisterAgentRejectsReservedHeader(t *testing.T) {
+	e := echo.New()
+	h, _ := newTestHandler(t)
+
+	body := `{"agent_id":"demo","name":"Demo","endpoint":"http://agent","headers":{"content-type":"text/plain"}}`
+	req := httptest.NewRequest(http.MethodPost, "/v1/agents/register", bytes.NewBufferString(body))
+	req.Header.Set("Content-Type", "application/json")
+	rec := httptest.NewRecorder()
+	if err := h.RegisterAgent(e.NewContext(req, rec)); err != nil {
+		t.Fatalf("handler error: %v", err)
+	}
+	if rec.Code != http.StatusBadRequest {
+		t.Fatalf("expected 400, got %d", rec.Code)
+	}
+}
+
+func TestRegisterAgentProtocol(t *testing.T) {
+	e := echo.New()
+	h, db := newTestHandler(t)
+
+	body := `{"agent_id":"gpt-4o-mini","name":"GPT","endpoint":"http://llm/v1","protocol":"openai_chat"}`
+	req := httptest.NewRequest(http.MethodPost, "/v1/agents/register", bytes.NewBufferString(body))
+	req.Header.Set("Content-Type", "application/json")
+	rec := httptest.NewRecorder()
+	if err := h.RegisterAgent(e.NewContext(req, rec)); err != nil {
+		t.Fatalf("handler error: %v", err)
+	}
+	if rec.Code != http.StatusOK {
+		t.Fatalf("expected 200, got %d: %s", rec.Code, rec.Body.String())
+	}
+	agent, err := db.GetAgent(context.Background(), "gpt-4o-mini")
+	if err != nil || agent == nil {
+		t.Fatalf("GetAgent: %v", err)
+	}
+	if agent.Protocol != domain.AgentProtocolOpenAIChat {
+		t.Fatalf("expected openai_chat, got %q", agent.Protocol)
+	}
+
+	body = `{"agent_id":"demo","name":"Demo","endpoint":"http://agent","protocol":"grpc"}`
+	req = httptest.NewRequest(http.MethodPost, "/v1/agents/register", bytes.NewBufferString(body))
+	req.Header.Set("Content-Type", "application/json")
+	rec = httptest.NewRecorder()
+	if err := h.RegisterAgent(e.NewContext(req, rec)); err != nil {
+		t.Fatalf("handler error: %v", err)
+	}
+	if rec.Code != http.StatusBadRequest {
+		t.Fatalf("expected 400, got %d", rec.Code)
+	}
+}
+
+func TestRegisterAgentResponseFormat(t *testing.T) {
+	e := echo.New()
+	h, db := newTestHandler(t)
+
+	body := `{"agent_id":"demo","name":"Demo","endpoint":"http://agent","response_format":"ndjson"}`
+	req := httptest.NewRequest(http.MethodPost, "/v1/agents/register", bytes.NewBufferString(body))
+	req.Header.Set("Content-Type", "application/json")
+	rec := httptest.NewRecorder()
+	if err := h.RegisterAgent(e.NewContext(req, rec)); err != nil {
+		t.Fatalf("handler error: %v", err)
+	}
+	if rec.Code != http.StatusOK {
+		t.Fatalf("expected 200, got %d: %s", rec.Code, rec.Body.String())
+	}
+	agent, err := db.GetAgent(context.Background(), "demo")
+	if err != nil || agent == nil {
+		t.Fatalf("GetAgent: %v", err)
+	}
+	if agent.ResponseFormat != domain.AgentResponseFormatNDJSON {
+		t.Fatalf("expected ndjson, got %q", agent.ResponseFormat)
+	}
+
+	body = `{"agent_id":"demo","name":"Demo","endpoint":"http://agent","response_format":"xml"}`
+	req = httptest.NewRequest(http.MethodPost, "/v1/agents/register", bytes.NewBufferString(body))
+	req.Header.Set("Content-Type", "application/json")
+	rec = httptest.NewRecorder()
+	if err := h.RegisterAgent(e.NewContext(req, rec)); err != nil {
+		t.Fatalf("handler error: %v", err)
+	}
+	if rec.Code != http.StatusBadRequest {
+		t.Fatalf("expected 400, got %d", rec.Code)
+	}
+}
+
+func TestRegisterAgentVerify(t *testing.T) {
+	e := echo.New()
+	h, db := newTestHandler(t)
+
+	agent := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/health" {
+			http.NotFound(w, r)
+			return
+		}
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer agent.Close()
+	down := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	down.Close()
+
+	register := func(body string) int {
+		req := httptest.NewRequest(http.MethodPost, "/v1/agents/register", bytes.NewBufferString(body))
+		req.Header.Set("Content-Type", "application/json")
+		rec := httptest.NewRecorder()
+		if err := h.RegisterAgent(e.NewContext(req, rec)); err != nil {
+			t.Fatalf("handler error: %v", err)
+		}
+		return rec.Code
+	}
+
+	if code := register(`{"agent_id":"demo","name":"Demo","endpoint":"grpc://agent"}`); code != http.StatusBadRequest {
+		t.Fatalf("expected 400 for a non-http endpoint, got %d", code)
+	}
+	if code := register(`{"agent_id":"demo","name":"Demo","endpoint":"` + down.URL + `","verify":true}`); code != http.StatusUnprocessableEntity {
+		t.Fatalf("expected 422 for an unreachable agent, got %d", code)
+	}
+	if got, _ := db.GetAgent(context.Background(), "demo"); got != nil {
+		t.Fatalf("unverified agent was registered: %+v", got)
+	}
+	if code := register(`{"agent_id":"demo","name":"Demo","endpoint":"` + agent.URL + `","verify":true}`); code != http.StatusOK {
+		t.Fatalf("expected 200 for a reachable agent, got %d", code)
+	}
+	if code := register(`{"agent_id":"offline","name":"Offline","endpoint":"` + down.URL + `"}`); code != http.StatusOK {
+		t.Fatalf("expected registration without verify to skip the probe, got %d", code)
+	}
+}
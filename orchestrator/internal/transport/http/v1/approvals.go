@@ -1,10 +1,19 @@
 package v1
 
 import (
+	"errors"
 	"net/http"
+	"strconv"
+	"strings"
 
 	"github.com/labstack/echo/v4"
 	"github.com/xiaot623/gogo/orchestrator/internal/domain"
+	"github.com/xiaot623/gogo/orchestrator/internal/service"
+)
+
+const (
+	defaultApprovalsLimit = 50
+	maxApprovalsLimit     = 200
 )
 
 // SubmitApprovalDecision handles approval decision submission.
@@ -18,12 +27,95 @@ func (h *Handler) SubmitApprovalDecision(c echo.Context) error {
 	if req.Decision != "approve" && req.Decision != "reject" {
 		return c.JSON(http.StatusBadRequest, map[string]string{"error": "decision must be approve or reject"})
 	}
+	if !service.ValidRememberScope(req.Remember) {
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": service.ErrInvalidRememberScope.Error()})
+	}
 
 	ctx := c.Request().Context()
 	
 	if err := h.service.UpdateApproval(ctx, approvalID, req); err != nil {
+		if errors.Is(err, service.ErrRememberNeedsUser) {
+			return c.JSON(http.StatusBadRequest, map[string]string{"error": err.Error()})
+		}
+		if errors.Is(err, service.ErrNonceReused) {
+			return c.JSON(http.StatusConflict, map[string]string{"error": err.Error(), "code": "nonce_reused"})
+		}
+		if errors.Is(err, service.ErrNonceInFlight) {
+			return c.JSON(http.StatusConflict, map[string]string{"error": err.Error(), "code": "nonce_in_flight"})
+		}
 		return c.JSON(http.StatusInternalServerError, map[string]string{"error": err.Error()})
 	}
 
 	return c.JSON(http.StatusOK, map[string]bool{"ok": true})
-}
\ No newline at end of file
+}
+
+// ListApprovals returns the approvals awaiting a decision, oldest first, for
+// approver dashboards. Only status=pending is supported.
+// GET /v1/approvals?status=pending&tool_name=&user_id=&limit=&cursor=
+func (h *Handler) ListApprovals(c echo.Context) error {
+	if status := c.QueryParam("status"); status != "" && !strings.EqualFold(status, string(domain.ApprovalStatusPending)) {
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": "only status=pending is supported"})
+	}
+	filter := domain.PendingApprovalFilter{
+		ToolName: c.QueryParam("tool_name"),
+		UserID:   c.QueryParam("user_id"),
+	}
+
+	limit := defaultApprovalsLimit
+	if l := c.QueryParam("limit"); l != "" {
+		if val, err := strconv.Atoi(l); err == nil && val > 0 {
+			limit = val
+		}
+	}
+	if limit > maxApprovalsLimit {
+		limit = maxApprovalsLimit
+	}
+
+	if cur := c.QueryParam("cursor"); cur != "" {
+		var err error
+		// Approval cursors share the run cursor encoding.
+		if filter.AfterCreatedAt, filter.AfterApprovalID, err = parseRunCursor(cur); err != nil {
+			return c.JSON(http.StatusBadRequest, map[string]string{"error": "invalid cursor"})
+		}
+	}
+
+	// Fetch one extra approval to know whether another page exists.
+	filter.Limit = limit + 1
+	approvals, err := h.service.ListPendingApprovals(c.Request().Context(), filter)
+	if err != nil {
+		return c.JSON(http.StatusInternalServerError, map[string]string{"error": err.Error()})
+	}
+
+	hasMore := len(approvals) > limit
+	if hasMore {
+		approvals = approvals[:limit]
+	}
+	resp := map[string]interface{}{
+		"approvals": approvals,
+		"has_more":  hasMore,
+	}
+	if hasMore {
+		last := approvals[len(approvals)-1]
+		resp["next_cursor"] = formatRunCursor(last.CreatedAt, last.ApprovalID)
+	}
+	return c.JSON(http.StatusOK, resp)
+}
+
+// ClearRememberedApprovals forgets remembered approvals so their tools prompt
+// again. At least one of user_id and session_id is required.
+// DELETE /v1/approvals/remembered?user_id=&session_id=&tool_name=
+func (h *Handler) ClearRememberedApprovals(c echo.Context) error {
+	filter := domain.RememberedApprovalFilter{
+		UserID:    c.QueryParam("user_id"),
+		SessionID: c.QueryParam("session_id"),
+		ToolName:  c.QueryParam("tool_name"),
+	}
+	cleared, err := h.service.ClearRememberedApprovals(c.Request().Context(), filter)
+	if errors.Is(err, service.ErrRememberFilterRequired) {
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": err.Error()})
+	}
+	if err != nil {
+		return c.JSON(http.StatusInternalServerError, map[string]string{"error": err.Error()})
+	}
+	return c.JSON(http.StatusOK, map[string]int64{"cleared": cleared})
+}
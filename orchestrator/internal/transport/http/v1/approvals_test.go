@@ -59,7 +59,7 @@ func TestDecideApprovalApprove(t *testing.T) {
 	assert.Equal(t, domain.ToolCallStatusSucceeded, updatedToolCall.Status)
 	assert.NotNil(t, updatedToolCall.CompletedAt)
 
-	events, err := db.GetEvents(ctx, "r1", 0, []string{string(domain.EventTypeApprovalDecision)}, 10)
+	events, err := db.GetEvents(ctx, "r1", 0, 0, []string{string(domain.EventTypeApprovalDecision)}, 10)
 	assert.NoError(t, err)
 	assert.NotEmpty(t, events)
 }
@@ -140,3 +140,69 @@ func createPendingApproval(t *testing.T, ctx context.Context, handler *Handler,
 
 	return resp.ToolCallID, tc.ApprovalID
 }
+
+func TestListPendingApprovals(t *testing.T) {
+	ctx := context.Background()
+	e := echo.New()
+	handler, db := newTestHandler(t)
+
+	setupSessionAndRun(t, ctx, db, "s1", "r1")
+	setupSessionAndRun(t, ctx, db, "s2", "r2")
+	_, first := createPendingApproval(t, ctx, handler, e, db, "r1")
+	time.Sleep(5 * time.Millisecond)
+	_, second := createPendingApproval(t, ctx, handler, e, db, "r2")
+	time.Sleep(5 * time.Millisecond)
+	_, decided := createPendingApproval(t, ctx, handler, e, db, "r2")
+	assert.NoError(t, db.UpdateApprovalStatus(ctx, decided, domain.ApprovalStatusRejected, "ops", "no"))
+
+	list := func(query string) (int, map[string]json.RawMessage) {
+		req := httptest.NewRequest(http.MethodGet, "/v1/approvals?"+query, nil)
+		rec := httptest.NewRecorder()
+		err := handler.ListApprovals(e.NewContext(req, rec))
+		assert.NoError(t, err)
+		var resp map[string]json.RawMessage
+		json.Unmarshal(rec.Body.Bytes(), &resp)
+		return rec.Code, resp
+	}
+	approvalsOf := func(resp map[string]json.RawMessage) []domain.PendingApproval {
+		var approvals []domain.PendingApproval
+		json.Unmarshal(resp["approvals"], &approvals)
+		return approvals
+	}
+
+	code, resp := list("status=pending")
+	assert.Equal(t, http.StatusOK, code)
+	approvals := approvalsOf(resp)
+	if assert.Len(t, approvals, 2) {
+		assert.Equal(t, first, approvals[0].ApprovalID)
+		assert.Equal(t, second, approvals[1].ApprovalID)
+		assert.Equal(t, "payments.transfer", approvals[0].ToolName)
+		assert.Equal(t, `{"amount":200}`, approvals[0].ArgsSummary)
+		assert.Equal(t, "r1", approvals[0].RunID)
+		assert.Equal(t, "s1", approvals[0].SessionID)
+		assert.Equal(t, "user_s1", approvals[0].UserID)
+		assert.GreaterOrEqual(t, approvals[0].AgeMs, approvals[1].AgeMs)
+	}
+
+	// Paginate oldest-first one at a time.
+	code, resp = list("limit=1")
+	assert.Equal(t, http.StatusOK, code)
+	assert.Equal(t, "true", string(resp["has_more"]))
+	var cursor string
+	json.Unmarshal(resp["next_cursor"], &cursor)
+	_, resp = list("limit=1&cursor=" + cursor)
+	if approvals := approvalsOf(resp); assert.Len(t, approvals, 1) {
+		assert.Equal(t, second, approvals[0].ApprovalID)
+	}
+	assert.Equal(t, "false", string(resp["has_more"]))
+
+	_, resp = list("user_id=user_s2")
+	if approvals := approvalsOf(resp); assert.Len(t, approvals, 1) {
+		assert.Equal(t, second, approvals[0].ApprovalID)
+	}
+	_, resp = list("tool_name=other.tool")
+	assert.Equal(t, "[]", string(resp["approvals"]))
+
+	code, _ = list("status=approved")
+	assert.Equal(t, http.StatusBadRequest, code)
+}
@@ -2,7 +2,9 @@
 package v1
 
 import (
+	"context"
 	"net/http"
+	"time"
 
 	"github.com/labstack/echo/v4"
 	"github.com/xiaot623/gogo/orchestrator/internal/service"
@@ -23,8 +25,13 @@ func NewHandler(service *service.Service) *Handler {
 // RegisterRoutes registers external routes with the echo server.
 func (h *Handler) RegisterRoutes(e *echo.Echo) {
 	// Public API (for retrieving data)
+	e.GET("/v1/runs", h.ListRuns)
+	e.GET("/v1/runs/:run_id", h.GetRun)
 	e.GET("/v1/runs/:run_id/events", h.GetRunEvents)
+	e.GET("/v1/runs/:run_id/summary", h.GetRunSummary)
 	e.GET("/v1/sessions/:session_id/messages", h.GetSessionMessages)
+	e.POST("/v1/sessions/:session_id/messages\\:import", h.ImportSessionMessages)
+	e.PATCH("/v1/sessions/:session_id", h.UpdateSession)
 
 	// Agent registry API
 	e.POST("/v1/agents/register", h.RegisterAgent)
@@ -33,12 +40,23 @@ func (h *Handler) RegisterRoutes(e *echo.Echo) {
 
 	// Tool API
 	e.GET("/v1/tools", h.ListTools)
+	e.POST("/v1/tools", h.RegisterTools)
 	e.POST("/v1/tools/:tool_name/invoke", h.InvokeTool)
 	e.GET("/v1/tool_calls/:tool_call_id", h.GetToolCall)
 	e.POST("/v1/tool_calls/:tool_call_id/wait", h.WaitToolCall)
+	e.POST("/v1/tool_calls/:tool_call_id/submit", h.SubmitToolResult)
+	e.POST("/v1/tool_calls/:tool_call_id/progress", h.SubmitToolProgress)
+	e.GET("/v1/approvals", h.ListApprovals)
 	e.POST("/v1/approvals/:approval_id/decide", h.SubmitApprovalDecision)
+	e.DELETE("/v1/approvals/remembered", h.ClearRememberedApprovals)
+
+	// Policy API
+	e.POST("/v1/policy/evaluate", h.EvaluatePolicy)
+
+	e.POST("/v1/tokenize", h.Tokenize)
 
 	e.GET("/health", h.Health)
+	e.GET("/ready", h.Ready)
 }
 
 // Health returns health status.
@@ -47,4 +65,22 @@ func (h *Handler) Health(c echo.Context) error {
 		"status":  "healthy",
 		"version": "0.1.0",
 	})
-}
\ No newline at end of file
+}
+
+// readyTimeout bounds the store ping performed by the readiness probe.
+const readyTimeout = 2 * time.Second
+
+// Ready returns 200 once startup has completed and the store answers a ping,
+// and 503 otherwise. Readiness probes should target this instead of /health.
+func (h *Handler) Ready(c echo.Context) error {
+	ctx, cancel := context.WithTimeout(c.Request().Context(), readyTimeout)
+	defer cancel()
+
+	if err := h.service.Ready(ctx); err != nil {
+		return c.JSON(http.StatusServiceUnavailable, map[string]string{
+			"status": "unavailable",
+			"error":  err.Error(),
+		})
+	}
+	return c.JSON(http.StatusOK, map[string]string{"status": "ready"})
+}
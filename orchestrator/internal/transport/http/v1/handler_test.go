@@ -0,0 +1,37 @@
+package v1
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/labstack/echo/v4"
+)
+
+func TestReady(t *testing.T) {
+	e := echo.New()
+	h, db := newTestHandler(t)
+
+	ready := func() int {
+		rec := httptest.NewRecorder()
+		c := e.NewContext(httptest.NewRequest(http.MethodGet, "/ready", nil), rec)
+		if err := h.Ready(c); err != nil {
+			t.Fatalf("handler error: %v", err)
+		}
+		return rec.Code
+	}
+
+	if code := ready(); code != http.StatusServiceUnavailable {
+		t.Fatalf("expected 503 during startup, got %d", code)
+	}
+
+	h.service.MarkReady()
+	if code := ready(); code != http.StatusOK {
+		t.Fatalf("expected 200 once ready, got %d", code)
+	}
+
+	db.Close()
+	if code := ready(); code != http.StatusServiceUnavailable {
+		t.Fatalf("expected 503 when the store is unreachable, got %d", code)
+	}
+}
@@ -1,10 +1,13 @@
 package v1
 
 import (
+	"fmt"
 	"net/http"
 	"strconv"
+	"strings"
 
 	"github.com/labstack/echo/v4"
+	"github.com/xiaot623/gogo/orchestrator/internal/domain"
 )
 
 // GetSessionMessages retrieves messages for a session.
@@ -19,9 +22,19 @@ func (h *Handler) GetSessionMessages(c echo.Context) error {
 	}
 	before := c.QueryParam("before")
 
+	// role accepts a comma-separated list (e.g. "user,assistant").
+	filter := domain.MessageFilter{RunID: c.QueryParam("run_id")}
+	if r := c.QueryParam("role"); r != "" {
+		for _, role := range strings.Split(r, ",") {
+			if role = strings.TrimSpace(role); role != "" {
+				filter.Roles = append(filter.Roles, role)
+			}
+		}
+	}
+
 	ctx := c.Request().Context()
 	
-	messages, err := h.service.GetMessages(ctx, sessionID, limit, before)
+	messages, err := h.service.GetMessages(ctx, sessionID, limit, before, filter)
 	if err != nil {
 		return c.JSON(http.StatusInternalServerError, map[string]string{"error": err.Error()})
 	}
@@ -38,29 +51,82 @@ func (h *Handler) GetRunEvents(c echo.Context) error {
 	runID := c.Param("run_id")
 	limit := 100
 	if l := c.QueryParam("limit"); l != "" {
-		if val, err := strconv.Atoi(l); err == nil {
+		if val, err := strconv.Atoi(l); err == nil && val > 0 {
 			limit = val
 		}
 	}
-	afterTs := int64(0)
+	afterTs, afterSeq := int64(0), int64(0)
 	if t := c.QueryParam("after_ts"); t != "" {
 		if val, err := strconv.ParseInt(t, 10, 64); err == nil {
 			afterTs = val
 		}
 	}
-	// types currently ignored in service for simplicity or assume implementation supports it
-	var types []string // Parse from query param if needed
+	// cursor takes precedence over after_ts; it is the next_cursor of a previous page.
+	if cur := c.QueryParam("cursor"); cur != "" {
+		ts, seq, err := parseEventCursor(cur)
+		if err != nil {
+			return c.JSON(http.StatusBadRequest, map[string]string{"error": "invalid cursor"})
+		}
+		afterTs, afterSeq = ts, seq
+	}
+	// Without a position, device_id resumes after the last event that device
+	// acknowledged over its WebSocket.
+	if deviceID := c.QueryParam("device_id"); deviceID != "" && afterTs == 0 && afterSeq == 0 {
+		seq, err := h.service.AckedEventSeq(c.Request().Context(), runID, deviceID)
+		if err != nil {
+			return c.JSON(http.StatusInternalServerError, map[string]string{"error": err.Error()})
+		}
+		afterSeq = seq
+	}
+	var types []string
+	if t := c.QueryParam("types"); t != "" {
+		for _, typ := range strings.Split(t, ",") {
+			if typ = strings.TrimSpace(typ); typ != "" {
+				types = append(types, typ)
+			}
+		}
+	}
 
 	ctx := c.Request().Context()
-	
-	events, err := h.service.GetRunEvents(ctx, runID, afterTs, types, limit)
+
+	// Fetch one extra event to know whether another page exists.
+	events, err := h.service.GetRunEvents(ctx, runID, afterTs, afterSeq, types, limit+1)
 	if err != nil {
 		return c.JSON(http.StatusInternalServerError, map[string]string{"error": err.Error()})
 	}
-	
-	// Need to check if more events available, but store API doesn't return that info directly usually unless limit+1 fetched.
-	
-	return c.JSON(http.StatusOK, map[string]interface{}{
-		"events": events,
-	})
-}
\ No newline at end of file
+
+	hasMore := len(events) > limit
+	if hasMore {
+		events = events[:limit]
+	}
+	resp := map[string]interface{}{
+		"events":   events,
+		"has_more": hasMore,
+	}
+	if hasMore && len(events) > 0 {
+		last := events[len(events)-1]
+		resp["next_cursor"] = formatEventCursor(last.Ts, last.Seq)
+	}
+
+	return c.JSON(http.StatusOK, resp)
+}
+
+// formatEventCursor encodes an event position as "<ts>-<seq>".
+func formatEventCursor(ts, seq int64) string {
+	return strconv.FormatInt(ts, 10) + "-" + strconv.FormatInt(seq, 10)
+}
+
+// parseEventCursor decodes a cursor produced by formatEventCursor. A bare
+// timestamp (the pre-seq cursor format) is accepted and resumes after that ts.
+func parseEventCursor(cursor string) (ts, seq int64, err error) {
+	tsPart, seqPart, hasSeq := strings.Cut(cursor, "-")
+	if ts, err = strconv.ParseInt(tsPart, 10, 64); err != nil {
+		return 0, 0, err
+	}
+	if hasSeq {
+		if seq, err = strconv.ParseInt(seqPart, 10, 64); err != nil || seq < 0 {
+			return 0, 0, fmt.Errorf("invalid cursor seq: %q", seqPart)
+		}
+	}
+	return ts, seq, nil
+}
@@ -3,6 +3,7 @@ package v1
 import (
 	"context"
 	"encoding/json"
+	"fmt"
 	"net/http"
 	"net/http/httptest"
 	"testing"
@@ -204,6 +205,70 @@ func TestGetSessionMessagesLimit(t *testing.T) {
 	}
 }
 
+func TestGetSessionMessagesFilters(t *testing.T) {
+	e := echo.New()
+	h, db := newTestHandler(t)
+
+	ctx := context.Background()
+	if err := db.CreateSession(ctx, &domain.Session{SessionID: "s1", UserID: "u1", CreatedAt: time.Now()}); err != nil {
+		t.Fatalf("CreateSession failed: %v", err)
+	}
+	base := time.Now()
+	for i, m := range []struct{ runID, role string }{
+		{"r1", "system"}, {"r1", "user"}, {"r1", "assistant"},
+		{"r2", "user"}, {"r2", "assistant"},
+	} {
+		msg := &domain.Message{
+			MessageID: fmt.Sprintf("m%d", i+1),
+			SessionID: "s1",
+			RunID:     m.runID,
+			Role:      m.role,
+			Content:   "hello",
+			CreatedAt: base.Add(time.Duration(i) * time.Second),
+		}
+		if err := db.CreateMessage(ctx, msg); err != nil {
+			t.Fatalf("CreateMessage failed: %v", err)
+		}
+	}
+
+	get := func(query string) []string {
+		req := httptest.NewRequest(http.MethodGet, "/v1/sessions/s1/messages?"+query, nil)
+		rec := httptest.NewRecorder()
+		c := e.NewContext(req, rec)
+		c.SetParamNames("session_id")
+		c.SetParamValues("s1")
+		if err := h.GetSessionMessages(c); err != nil {
+			t.Fatalf("handler error: %v", err)
+		}
+		if rec.Code != http.StatusOK {
+			t.Fatalf("expected 200, got %d", rec.Code)
+		}
+		var resp struct {
+			Messages []domain.Message `json:"messages"`
+		}
+		if err := json.Unmarshal(rec.Body.Bytes(), &resp); err != nil {
+			t.Fatalf("decode response: %v", err)
+		}
+		var ids []string
+		for _, m := range resp.Messages {
+			ids = append(ids, m.MessageID)
+		}
+		return ids
+	}
+
+	for query, want := range map[string]string{
+		"role=user,assistant":         "[m2 m3 m4 m5]",
+		"run_id=r1":                   "[m1 m2 m3]",
+		"run_id=r1&role=assistant":    "[m3]",
+		"role=user,assistant&limit=2": "[m2 m3]",
+		"run_id=r2&role=system":       "[]",
+	} {
+		if got := fmt.Sprint(get(query)); got != want {
+			t.Errorf("%s: expected %s, got %s", query, want, got)
+		}
+	}
+}
+
 func TestGetRunEventsFilters(t *testing.T) {
 	e := echo.New()
 	h, db := newTestHandler(t)
@@ -236,6 +301,72 @@ func TestGetRunEventsFilters(t *testing.T) {
 	}
 }
 
+func TestGetRunEventsPaginatesSameMillisecond(t *testing.T) {
+	e := echo.New()
+	h, db := newTestHandler(t)
+	ctx := context.Background()
+
+	if err := db.CreateSession(ctx, &domain.Session{SessionID: "s1", UserID: "u1", CreatedAt: time.Now()}); err != nil {
+		t.Fatalf("CreateSession failed: %v", err)
+	}
+	if err := db.CreateRun(ctx, &domain.Run{RunID: "r1", SessionID: "s1", RootAgentID: "a1", Status: domain.RunStatusRunning, StartedAt: time.Now()}); err != nil {
+		t.Fatalf("CreateRun failed: %v", err)
+	}
+
+	// All events share one millisecond, as rapid stream deltas do.
+	ts := time.Now().UnixMilli()
+	for i := 0; i < 7; i++ {
+		event := &domain.Event{EventID: fmt.Sprintf("e%d", i), RunID: "r1", Ts: ts, Type: domain.EventTypeAgentStreamDelta}
+		if err := db.CreateEvent(ctx, event); err != nil {
+			t.Fatalf("CreateEvent failed: %v", err)
+		}
+		if event.Seq != int64(i+1) {
+			t.Fatalf("expected seq %d, got %d", i+1, event.Seq)
+		}
+	}
+
+	var ids []string
+	cursor := ""
+	for page := 0; page < 10; page++ {
+		target := "/v1/runs/r1/events?limit=3"
+		if cursor != "" {
+			target += "&cursor=" + cursor
+		}
+		req := httptest.NewRequest(http.MethodGet, target, nil)
+		rec := httptest.NewRecorder()
+		c := e.NewContext(req, rec)
+		c.SetParamNames("run_id")
+		c.SetParamValues("r1")
+		if err := h.GetRunEvents(c); err != nil {
+			t.Fatalf("handler error: %v", err)
+		}
+		if rec.Code != http.StatusOK {
+			t.Fatalf("expected 200, got %d: %s", rec.Code, rec.Body.String())
+		}
+
+		var resp struct {
+			Events     []domain.Event `json:"events"`
+			HasMore    bool           `json:"has_more"`
+			NextCursor string         `json:"next_cursor"`
+		}
+		if err := json.Unmarshal(rec.Body.Bytes(), &resp); err != nil {
+			t.Fatalf("decode response: %v", err)
+		}
+		for _, ev := range resp.Events {
+			ids = append(ids, ev.EventID)
+		}
+		if !resp.HasMore {
+			break
+		}
+		cursor = resp.NextCursor
+	}
+
+	want := []string{"e0", "e1", "e2", "e3", "e4", "e5", "e6"}
+	if fmt.Sprint(ids) != fmt.Sprint(want) {
+		t.Fatalf("expected %v, got %v", want, ids)
+	}
+}
+
 func TestHealth(t *testing.T) {
 	e := echo.New()
 	h, _ := newTestHandler(t)
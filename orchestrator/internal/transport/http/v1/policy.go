@@ -0,0 +1,27 @@
+package v1
+
+import (
+	"net/http"
+
+	"github.com/labstack/echo/v4"
+	"github.com/xiaot623/gogo/orchestrator/internal/domain"
+)
+
+// EvaluatePolicy evaluates the tool policy for a (tool, user, args) tuple
+// without invoking anything.
+// POST /v1/policy/evaluate
+func (h *Handler) EvaluatePolicy(c echo.Context) error {
+	var req domain.PolicyEvaluateRequest
+	if err := c.Bind(&req); err != nil {
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": "invalid request body"})
+	}
+	if req.ToolName == "" {
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": "tool_name is required"})
+	}
+
+	resp, err := h.service.EvaluatePolicy(c.Request().Context(), req)
+	if err != nil {
+		return c.JSON(http.StatusInternalServerError, map[string]string{"error": err.Error()})
+	}
+	return c.JSON(http.StatusOK, resp)
+}
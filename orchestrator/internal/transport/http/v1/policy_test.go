@@ -0,0 +1,59 @@
+package v1
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/labstack/echo/v4"
+	"github.com/stretchr/testify/assert"
+	"github.com/xiaot623/gogo/orchestrator/internal/domain"
+)
+
+func TestEvaluatePolicy(t *testing.T) {
+	cases := []struct {
+		name     string
+		req      domain.PolicyEvaluateRequest
+		decision string
+	}{
+		{"Allow", domain.PolicyEvaluateRequest{ToolName: "weather.query", UserID: "u1"}, "allow"},
+		{"Block", domain.PolicyEvaluateRequest{ToolName: "dangerous.command", UserID: "u1"}, "block"},
+		{"Require Approval", domain.PolicyEvaluateRequest{ToolName: "payments.transfer", UserID: "u1", Args: json.RawMessage(`{"amount":500}`)}, "require_approval"},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			e := echo.New()
+			handler, _ := newTestHandler(t)
+
+			reqBody, _ := json.Marshal(tc.req)
+			req := httptest.NewRequest(http.MethodPost, "/v1/policy/evaluate", bytes.NewReader(reqBody))
+			req.Header.Set(echo.HeaderContentType, echo.MIMEApplicationJSON)
+			rec := httptest.NewRecorder()
+			c := e.NewContext(req, rec)
+
+			assert.NoError(t, handler.EvaluatePolicy(c))
+			assert.Equal(t, http.StatusOK, rec.Code)
+
+			var resp domain.PolicyEvaluateResponse
+			assert.NoError(t, json.Unmarshal(rec.Body.Bytes(), &resp))
+			assert.Equal(t, tc.decision, resp.Decision)
+			assert.NotEmpty(t, resp.PolicyVersion)
+		})
+	}
+}
+
+func TestEvaluatePolicyRequiresToolName(t *testing.T) {
+	e := echo.New()
+	handler, _ := newTestHandler(t)
+
+	req := httptest.NewRequest(http.MethodPost, "/v1/policy/evaluate", bytes.NewReader([]byte(`{"user_id":"u1"}`)))
+	req.Header.Set(echo.HeaderContentType, echo.MIMEApplicationJSON)
+	rec := httptest.NewRecorder()
+	c := e.NewContext(req, rec)
+
+	assert.NoError(t, handler.EvaluatePolicy(c))
+	assert.Equal(t, http.StatusBadRequest, rec.Code)
+}
@@ -0,0 +1,191 @@
+package v1
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/labstack/echo/v4"
+	"github.com/xiaot623/gogo/orchestrator/internal/archive"
+	"github.com/xiaot623/gogo/orchestrator/internal/domain"
+	"github.com/xiaot623/gogo/orchestrator/internal/service"
+)
+
+const (
+	defaultRunsLimit = 50
+	maxRunsLimit     = 200
+
+	// Bounds on the latest events GET /v1/runs/:run_id?include=events returns.
+	defaultRunEventsInclude = 100
+	maxRunEventsInclude     = 1000
+)
+
+// ListRuns lists runs across sessions, newest first.
+// GET /v1/runs?status=&agent_id=&session_id=&tag=&started_after=&started_before=&limit=&cursor=
+func (h *Handler) ListRuns(c echo.Context) error {
+	filter := domain.RunFilter{
+		Status:    domain.RunStatus(strings.ToUpper(c.QueryParam("status"))),
+		AgentID:   c.QueryParam("agent_id"),
+		SessionID: c.QueryParam("session_id"),
+		Tag:       c.QueryParam("tag"),
+	}
+
+	limit := defaultRunsLimit
+	if l := c.QueryParam("limit"); l != "" {
+		if val, err := strconv.Atoi(l); err == nil && val > 0 {
+			limit = val
+		}
+	}
+	if limit > maxRunsLimit {
+		limit = maxRunsLimit
+	}
+
+	var err error
+	if filter.StartedAfter, err = parseTimeParam(c.QueryParam("started_after")); err != nil {
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": "invalid started_after"})
+	}
+	if filter.StartedBefore, err = parseTimeParam(c.QueryParam("started_before")); err != nil {
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": "invalid started_before"})
+	}
+	if cur := c.QueryParam("cursor"); cur != "" {
+		if filter.BeforeStartedAt, filter.BeforeRunID, err = parseRunCursor(cur); err != nil {
+			return c.JSON(http.StatusBadRequest, map[string]string{"error": "invalid cursor"})
+		}
+	}
+
+	// Fetch one extra run to know whether another page exists.
+	filter.Limit = limit + 1
+	runs, err := h.service.ListRuns(c.Request().Context(), filter)
+	if err != nil {
+		return c.JSON(http.StatusInternalServerError, map[string]string{"error": err.Error()})
+	}
+
+	hasMore := len(runs) > limit
+	if hasMore {
+		runs = runs[:limit]
+	}
+	resp := map[string]interface{}{
+		"runs":     runs,
+		"has_more": hasMore,
+	}
+	if hasMore {
+		last := runs[len(runs)-1]
+		resp["next_cursor"] = formatRunCursor(last.StartedAt, last.RunID)
+	}
+	return c.JSON(http.StatusOK, resp)
+}
+
+// GetRun returns a run. An archived run is returned as a tombstone carrying
+// archive_location unless rehydrate=true, which restores it from the archive
+// first. include lists the related rows to embed: tool_calls, messages and
+// events (the latest events_limit of them).
+// GET /v1/runs/:run_id?rehydrate=&include=&events_limit=
+func (h *Handler) GetRun(c echo.Context) error {
+	ctx := c.Request().Context()
+	runID := c.Param("run_id")
+
+	opts, err := parseRunIncludes(c.QueryParam("include"), c.QueryParam("events_limit"))
+	if err != nil {
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": err.Error()})
+	}
+
+	var run *domain.Run
+	if rehydrate, _ := strconv.ParseBool(c.QueryParam("rehydrate")); rehydrate {
+		run, err = h.service.RestoreRun(ctx, runID)
+	} else {
+		run, err = h.service.GetRun(ctx, runID)
+	}
+	if errors.Is(err, service.ErrArchiverUnavailable) || errors.Is(err, archive.ErrNotFound) {
+		return c.JSON(http.StatusServiceUnavailable, map[string]string{"error": err.Error(), "code": "archive_unavailable"})
+	}
+	if err != nil {
+		return c.JSON(http.StatusInternalServerError, map[string]string{"error": err.Error()})
+	}
+	if run == nil {
+		return c.JSON(http.StatusNotFound, map[string]string{"error": "run not found"})
+	}
+	if !opts.ToolCalls && !opts.Messages && !opts.Events {
+		return c.JSON(http.StatusOK, run)
+	}
+
+	agg, err := h.service.GetRunAggregate(ctx, runID, opts)
+	if err != nil {
+		return c.JSON(http.StatusInternalServerError, map[string]string{"error": err.Error()})
+	}
+	if agg == nil {
+		return c.JSON(http.StatusNotFound, map[string]string{"error": "run not found"})
+	}
+	return c.JSON(http.StatusOK, agg)
+}
+
+// parseRunIncludes parses GetRun's comma-separated include list and
+// events_limit.
+func parseRunIncludes(include, eventsLimit string) (domain.RunAggregateOptions, error) {
+	opts := domain.RunAggregateOptions{MaxEvents: defaultRunEventsInclude}
+	for _, part := range strings.Split(include, ",") {
+		switch strings.TrimSpace(part) {
+		case "":
+		case "tool_calls":
+			opts.ToolCalls = true
+		case "messages":
+			opts.Messages = true
+		case "events":
+			opts.Events = true
+		default:
+			return opts, fmt.Errorf("include must list tool_calls, messages or events, got %q", part)
+		}
+	}
+	if eventsLimit != "" {
+		n, err := strconv.Atoi(eventsLimit)
+		if err != nil || n <= 0 {
+			return opts, fmt.Errorf("events_limit must be a positive integer")
+		}
+		opts.MaxEvents = min(n, maxRunEventsInclude)
+	}
+	return opts, nil
+}
+
+// GetRunSummary returns a run's status and duration with its event counts by
+// type, without the events themselves.
+// GET /v1/runs/:run_id/summary
+func (h *Handler) GetRunSummary(c echo.Context) error {
+	summary, err := h.service.GetRunSummary(c.Request().Context(), c.Param("run_id"))
+	if err != nil {
+		return c.JSON(http.StatusInternalServerError, map[string]string{"error": err.Error()})
+	}
+	if summary == nil {
+		return c.JSON(http.StatusNotFound, map[string]string{"error": "run not found"})
+	}
+	return c.JSON(http.StatusOK, summary)
+}
+
+// parseTimeParam accepts an RFC 3339 timestamp or Unix milliseconds.
+func parseTimeParam(v string) (time.Time, error) {
+	if v == "" {
+		return time.Time{}, nil
+	}
+	if ms, err := strconv.ParseInt(v, 10, 64); err == nil {
+		return time.UnixMilli(ms), nil
+	}
+	return time.Parse(time.RFC3339Nano, v)
+}
+
+// formatRunCursor encodes a run position as "<started_at unix nanos>-<run_id>".
+func formatRunCursor(startedAt time.Time, runID string) string {
+	return strconv.FormatInt(startedAt.UnixNano(), 10) + "-" + runID
+}
+
+func parseRunCursor(cursor string) (time.Time, string, error) {
+	nanosPart, runID, ok := strings.Cut(cursor, "-")
+	if !ok || runID == "" {
+		return time.Time{}, "", fmt.Errorf("invalid run cursor: %q", cursor)
+	}
+	nanos, err := strconv.ParseInt(nanosPart, 10, 64)
+	if err != nil {
+		return time.Time{}, "", err
+	}
+	return time.Unix(0, nanos), runID, nil
+}
@@ -0,0 +1,250 @@
+package v1
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+	"time"
+
+	"github.com/labstack/echo/v4"
+	"github.com/stretchr/testify/assert"
+	"github.com/xiaot623/gogo/orchestrator/internal/domain"
+)
+
+type listRunsResponse struct {
+	Runs       []domain.RunSummary `json:"runs"`
+	HasMore    bool                `json:"has_more"`
+	NextCursor string              `json:"next_cursor"`
+}
+
+func listRuns(t *testing.T, h *Handler, query string) (*httptest.ResponseRecorder, listRunsResponse) {
+	t.Helper()
+	e := echo.New()
+	req := httptest.NewRequest(http.MethodGet, "/v1/runs?"+query, nil)
+	rec := httptest.NewRecorder()
+	assert.NoError(t, h.ListRuns(e.NewContext(req, rec)))
+	var resp listRunsResponse
+	if rec.Code == http.StatusOK {
+		assert.NoError(t, json.Unmarshal(rec.Body.Bytes(), &resp))
+	}
+	return rec, resp
+}
+
+func TestListRunsFiltersAndPaginates(t *testing.T) {
+	h, db := newTestHandler(t)
+	ctx := context.Background()
+	assert.NoError(t, db.CreateSession(ctx, &domain.Session{SessionID: "s1", UserID: "u1", CreatedAt: time.Now()}))
+
+	base := time.Now().Add(-time.Hour)
+	runs := []struct {
+		id     string
+		agent  string
+		status domain.RunStatus
+	}{
+		{"r1", "a1", domain.RunStatusDone},
+		{"r2", "a2", domain.RunStatusFailed},
+		{"r3", "a1", domain.RunStatusRunning},
+		{"r4", "a1", domain.RunStatusFailed},
+	}
+	for i, r := range runs {
+		assert.NoError(t, db.CreateRun(ctx, &domain.Run{RunID: r.id, SessionID: "s1", RootAgentID: r.agent, Status: r.status, StartedAt: base.Add(time.Duration(i) * time.Minute)}))
+	}
+	assert.NoError(t, db.UpdateRunCompleted(ctx, "r1", domain.RunStatusDone, nil))
+
+	rec, resp := listRuns(t, h, "limit=3")
+	assert.Equal(t, http.StatusOK, rec.Code)
+	assert.True(t, resp.HasMore)
+	assert.Equal(t, []string{"r4", "r3", "r2"}, runIDs(resp.Runs))
+
+	_, resp = listRuns(t, h, "limit=3&cursor="+resp.NextCursor)
+	assert.False(t, resp.HasMore)
+	assert.Equal(t, []string{"r1"}, runIDs(resp.Runs))
+	assert.NotNil(t, resp.Runs[0].EndedAt)
+	assert.Greater(t, resp.Runs[0].DurationMs, int64(0))
+
+	_, resp = listRuns(t, h, "status=failed&agent_id=a1")
+	assert.Equal(t, []string{"r4"}, runIDs(resp.Runs))
+
+	after := base.Add(90 * time.Second).Format(time.RFC3339Nano)
+	_, resp = listRuns(t, h, "session_id=s1&started_after="+url.QueryEscape(after)+"&started_before="+url.QueryEscape(time.Now().Format(time.RFC3339Nano)))
+	assert.Equal(t, []string{"r4", "r3"}, runIDs(resp.Runs))
+}
+
+func TestListRunsFiltersByTag(t *testing.T) {
+	h, db := newTestHandler(t)
+	ctx := context.Background()
+	assert.NoError(t, db.CreateSession(ctx, &domain.Session{SessionID: "s1", UserID: "u1", CreatedAt: time.Now()}))
+
+	base := time.Now().Add(-time.Hour)
+	for i, tags := range [][]string{{"experiment=x"}, {"experiment=y", "tenant=acme"}, nil, {"tenant=acme", "experiment=x"}} {
+		id := "r" + string(rune('1'+i))
+		assert.NoError(t, db.CreateRun(ctx, &domain.Run{RunID: id, SessionID: "s1", RootAgentID: "a1", Status: domain.RunStatusFailed, StartedAt: base.Add(time.Duration(i) * time.Minute), Tags: tags}))
+	}
+
+	_, resp := listRuns(t, h, "tag="+url.QueryEscape("experiment=x")+"&status=failed")
+	assert.Equal(t, []string{"r4", "r1"}, runIDs(resp.Runs))
+	assert.Equal(t, []string{"tenant=acme", "experiment=x"}, resp.Runs[0].Tags)
+
+	_, resp = listRuns(t, h, "tag=tenant%3Dacme")
+	assert.Equal(t, []string{"r4", "r2"}, runIDs(resp.Runs))
+
+	_, resp = listRuns(t, h, "tag=experiment")
+	assert.Empty(t, resp.Runs)
+}
+
+func TestListRunsRejectsBadParams(t *testing.T) {
+	h, _ := newTestHandler(t)
+
+	rec, _ := listRuns(t, h, "started_after=yesterday")
+	assert.Equal(t, http.StatusBadRequest, rec.Code)
+
+	rec, _ = listRuns(t, h, "cursor=nope")
+	assert.Equal(t, http.StatusBadRequest, rec.Code)
+}
+
+func runIDs(runs []domain.RunSummary) []string {
+	ids := make([]string, 0, len(runs))
+	for _, r := range runs {
+		ids = append(ids, r.RunID)
+	}
+	return ids
+}
+
+func TestGetRunArchivedTombstone(t *testing.T) {
+	h, db := newTestHandler(t)
+	ctx := context.Background()
+	assert.NoError(t, db.CreateSession(ctx, &domain.Session{SessionID: "s1", UserID: "u1", CreatedAt: time.Now()}))
+	assert.NoError(t, db.CreateRun(ctx, &domain.Run{RunID: "r1", SessionID: "s1", RootAgentID: "a1", Status: domain.RunStatusRunning, StartedAt: time.Now()}))
+	assert.NoError(t, db.UpdateRunCompleted(ctx, "r1", domain.RunStatusDone, nil))
+	marked, err := db.MarkRunArchived(ctx, "r1", "file:///archive/r1.json")
+	assert.NoError(t, err)
+	assert.True(t, marked)
+
+	getRun := func(runID, query string) *httptest.ResponseRecorder {
+		e := echo.New()
+		req := httptest.NewRequest(http.MethodGet, "/v1/runs/"+runID+"?"+query, nil)
+		rec := httptest.NewRecorder()
+		c := e.NewContext(req, rec)
+		c.SetParamNames("run_id")
+		c.SetParamValues(runID)
+		assert.NoError(t, h.GetRun(c))
+		return rec
+	}
+
+	rec := getRun("r1", "")
+	assert.Equal(t, http.StatusOK, rec.Code)
+	var run domain.Run
+	assert.NoError(t, json.Unmarshal(rec.Body.Bytes(), &run))
+	assert.Equal(t, "file:///archive/r1.json", run.ArchiveLocation)
+	assert.Equal(t, domain.RunStatusDone, run.Status)
+
+	// The test handler has no archiver configured.
+	rec = getRun("r1", "rehydrate=true")
+	assert.Equal(t, http.StatusServiceUnavailable, rec.Code)
+	assert.Contains(t, rec.Body.String(), "archive_unavailable")
+
+	rec = getRun("missing", "")
+	assert.Equal(t, http.StatusNotFound, rec.Code)
+}
+
+func TestGetRunSummary(t *testing.T) {
+	h, db := newTestHandler(t)
+	ctx := context.Background()
+	assert.NoError(t, db.CreateSession(ctx, &domain.Session{SessionID: "s1", UserID: "u1", CreatedAt: time.Now()}))
+	assert.NoError(t, db.CreateRun(ctx, &domain.Run{RunID: "r1", SessionID: "s1", RootAgentID: "a1", Status: domain.RunStatusRunning, StartedAt: time.Now()}))
+	assert.NoError(t, db.UpdateRunCompleted(ctx, "r1", domain.RunStatusDone, nil))
+	for i, typ := range []domain.EventType{domain.EventTypeRunStarted, domain.EventTypeLLMCallStarted, domain.EventTypeLLMCallStarted, domain.EventTypeRunDone} {
+		assert.NoError(t, db.CreateEvent(ctx, &domain.Event{EventID: fmt.Sprintf("e%d", i), RunID: "r1", Ts: int64(1000 + i), Seq: int64(i + 1), Type: typ}))
+	}
+
+	getSummary := func(runID string) *httptest.ResponseRecorder {
+		e := echo.New()
+		req := httptest.NewRequest(http.MethodGet, "/v1/runs/"+runID+"/summary", nil)
+		rec := httptest.NewRecorder()
+		c := e.NewContext(req, rec)
+		c.SetParamNames("run_id")
+		c.SetParamValues(runID)
+		assert.NoError(t, h.GetRunSummary(c))
+		return rec
+	}
+
+	rec := getSummary("r1")
+	assert.Equal(t, http.StatusOK, rec.Code)
+	var summary domain.RunEventSummary
+	assert.NoError(t, json.Unmarshal(rec.Body.Bytes(), &summary))
+	assert.Equal(t, domain.RunStatusDone, summary.Status)
+	assert.Equal(t, 4, summary.EventCount)
+	assert.Equal(t, map[domain.EventType]int{
+		domain.EventTypeRunStarted:     1,
+		domain.EventTypeLLMCallStarted: 2,
+		domain.EventTypeRunDone:        1,
+	}, summary.EventCounts)
+	assert.Equal(t, int64(1000), summary.FirstEventTs)
+	assert.Equal(t, int64(1003), summary.LastEventTs)
+
+	rec = getSummary("missing")
+	assert.Equal(t, http.StatusNotFound, rec.Code)
+}
+
+func TestGetRunIncludes(t *testing.T) {
+	h, db := newTestHandler(t)
+	ctx := context.Background()
+	assert.NoError(t, db.CreateSession(ctx, &domain.Session{SessionID: "s1", UserID: "u1", CreatedAt: time.Now()}))
+	assert.NoError(t, db.CreateRun(ctx, &domain.Run{RunID: "r1", SessionID: "s1", RootAgentID: "a1", Status: domain.RunStatusRunning, StartedAt: time.Now()}))
+	assert.NoError(t, db.CreateMessage(ctx, &domain.Message{MessageID: "m1", SessionID: "s1", RunID: "r1", Role: "user", Content: "hi", CreatedAt: time.Now()}))
+	assert.NoError(t, db.CreateToolCall(ctx, &domain.ToolCall{ToolCallID: "tc1", RunID: "r1", ToolName: "weather.query", Kind: domain.ToolKindServer, Status: domain.ToolCallStatusRunning, Args: json.RawMessage(`{}`), CreatedAt: time.Now()}))
+	for i := 0; i < 5; i++ {
+		assert.NoError(t, db.CreateEvent(ctx, &domain.Event{EventID: fmt.Sprintf("e%d", i), RunID: "r1", Ts: int64(1000 + i), Seq: int64(i + 1), Type: domain.EventTypeAgentStreamDelta}))
+	}
+
+	getRun := func(query string) (*httptest.ResponseRecorder, map[string]json.RawMessage) {
+		e := echo.New()
+		req := httptest.NewRequest(http.MethodGet, "/v1/runs/r1?"+query, nil)
+		rec := httptest.NewRecorder()
+		c := e.NewContext(req, rec)
+		c.SetParamNames("run_id")
+		c.SetParamValues("r1")
+		assert.NoError(t, h.GetRun(c))
+		var body map[string]json.RawMessage
+		if rec.Code == http.StatusOK {
+			assert.NoError(t, json.Unmarshal(rec.Body.Bytes(), &body))
+		}
+		return rec, body
+	}
+
+	rec, body := getRun("")
+	assert.Equal(t, http.StatusOK, rec.Code)
+	assert.NotContains(t, body, "tool_calls")
+	assert.NotContains(t, body, "events")
+
+	rec, body = getRun("include=tool_calls,messages,events&events_limit=3")
+	assert.Equal(t, http.StatusOK, rec.Code)
+	var agg domain.RunAggregate
+	assert.NoError(t, json.Unmarshal(rec.Body.Bytes(), &agg))
+	assert.Equal(t, "r1", agg.RunID)
+	if assert.Len(t, agg.ToolCalls, 1) {
+		assert.Equal(t, "tc1", agg.ToolCalls[0].ToolCallID)
+	}
+	if assert.Len(t, agg.Messages, 1) {
+		assert.Equal(t, "hi", agg.Messages[0].Content)
+	}
+	if assert.Len(t, agg.Events, 3) {
+		assert.Equal(t, "e2", agg.Events[0].EventID)
+		assert.Equal(t, "e4", agg.Events[2].EventID)
+	}
+	assert.True(t, agg.EventsTruncated)
+
+	rec, body = getRun("include=messages")
+	assert.Equal(t, http.StatusOK, rec.Code)
+	assert.Contains(t, body, "messages")
+	assert.NotContains(t, body, "tool_calls")
+
+	rec, _ = getRun("include=approvals")
+	assert.Equal(t, http.StatusBadRequest, rec.Code)
+	rec, _ = getRun("include=events&events_limit=0")
+	assert.Equal(t, http.StatusBadRequest, rec.Code)
+}
@@ -0,0 +1,59 @@
+package v1
+
+import (
+	"bytes"
+	"errors"
+	"net/http"
+
+	"github.com/labstack/echo/v4"
+	"github.com/xiaot623/gogo/orchestrator/internal/domain"
+	"github.com/xiaot623/gogo/orchestrator/internal/service"
+)
+
+// UpdateSession updates a session's metadata and returns the updated session.
+// PATCH /v1/sessions/:session_id
+func (h *Handler) UpdateSession(c echo.Context) error {
+	sessionID := c.Param("session_id")
+	var req domain.SessionUpdateRequest
+	if err := c.Bind(&req); err != nil {
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": "invalid request body"})
+	}
+	if !bytes.HasPrefix(bytes.TrimSpace(req.Metadata), []byte("{")) {
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": "metadata must be a JSON object"})
+	}
+
+	session, err := h.service.UpdateSessionMetadata(c.Request().Context(), sessionID, req)
+	if err != nil {
+		return c.JSON(http.StatusInternalServerError, map[string]string{"error": err.Error()})
+	}
+	if session == nil {
+		return c.JSON(http.StatusNotFound, map[string]string{"error": "session not found"})
+	}
+	return c.JSON(http.StatusOK, session)
+}
+
+// ImportSessionMessages stores an existing conversation in a session in one
+// transaction, creating the session for user_id when it does not exist.
+// POST /v1/sessions/:session_id/messages:import
+func (h *Handler) ImportSessionMessages(c echo.Context) error {
+	sessionID := c.Param("session_id")
+	var req domain.MessageImportRequest
+	if err := c.Bind(&req); err != nil {
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": "invalid request body"})
+	}
+
+	resp, err := h.service.ImportMessages(c.Request().Context(), sessionID, req)
+	if errors.Is(err, service.ErrMaintenance) {
+		return c.JSON(http.StatusServiceUnavailable, map[string]string{"error": err.Error(), "code": "maintenance"})
+	}
+	if errors.Is(err, service.ErrInvalidMessageImport) {
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": err.Error(), "code": "invalid_import"})
+	}
+	if errors.Is(err, service.ErrSessionNotFound) {
+		return c.JSON(http.StatusNotFound, map[string]string{"error": err.Error()})
+	}
+	if err != nil {
+		return c.JSON(http.StatusInternalServerError, map[string]string{"error": err.Error()})
+	}
+	return c.JSON(http.StatusOK, resp)
+}
@@ -0,0 +1,119 @@
+package v1
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/labstack/echo/v4"
+	"github.com/stretchr/testify/assert"
+	"github.com/xiaot623/gogo/orchestrator/internal/domain"
+)
+
+func patchSession(t *testing.T, h *Handler, sessionID, body string) *httptest.ResponseRecorder {
+	t.Helper()
+	e := echo.New()
+	req := httptest.NewRequest(http.MethodPatch, "/v1/sessions/"+sessionID, bytes.NewReader([]byte(body)))
+	req.Header.Set(echo.HeaderContentType, echo.MIMEApplicationJSON)
+	rec := httptest.NewRecorder()
+	c := e.NewContext(req, rec)
+	c.SetParamNames("session_id")
+	c.SetParamValues(sessionID)
+	assert.NoError(t, h.UpdateSession(c))
+	return rec
+}
+
+func TestUpdateSessionMetadata(t *testing.T) {
+	h, db := newTestHandler(t)
+	session := &domain.Session{SessionID: "s1", UserID: "u1", CreatedAt: time.Now(), Metadata: json.RawMessage(`{"title":"old","locale":"en"}`)}
+	assert.NoError(t, db.CreateSession(context.Background(), session))
+
+	rec := patchSession(t, h, "s1", `{"metadata":{"title":"new","locale":null,"flags":["beta"]}}`)
+	assert.Equal(t, http.StatusOK, rec.Code)
+	var got domain.Session
+	assert.NoError(t, json.Unmarshal(rec.Body.Bytes(), &got))
+	assert.JSONEq(t, `{"title":"new","flags":["beta"]}`, string(got.Metadata))
+
+	rec = patchSession(t, h, "s1", `{"metadata":{"only":1},"replace":true}`)
+	assert.Equal(t, http.StatusOK, rec.Code)
+	stored, err := db.GetSession(context.Background(), "s1")
+	assert.NoError(t, err)
+	assert.JSONEq(t, `{"only":1}`, string(stored.Metadata))
+}
+
+func TestUpdateSessionErrors(t *testing.T) {
+	h, _ := newTestHandler(t)
+
+	rec := patchSession(t, h, "missing", `{"metadata":{"a":1}}`)
+	assert.Equal(t, http.StatusNotFound, rec.Code)
+
+	rec = patchSession(t, h, "missing", `{"metadata":[1,2]}`)
+	assert.Equal(t, http.StatusBadRequest, rec.Code)
+}
+
+func importMessages(t *testing.T, h *Handler, sessionID, body string) *httptest.ResponseRecorder {
+	t.Helper()
+	e := echo.New()
+	h.RegisterRoutes(e)
+	req := httptest.NewRequest(http.MethodPost, "/v1/sessions/"+sessionID+"/messages:import", bytes.NewReader([]byte(body)))
+	req.Header.Set(echo.HeaderContentType, echo.MIMEApplicationJSON)
+	rec := httptest.NewRecorder()
+	e.ServeHTTP(rec, req)
+	return rec
+}
+
+func TestImportSessionMessages(t *testing.T) {
+	h, db := newTestHandler(t)
+	ctx := context.Background()
+
+	// Out of order on purpose; the last two share a timestamp.
+	rec := importMessages(t, h, "s1", `{"user_id":"u1","messages":[
+		{"role":"assistant","content":"second","created_at":"2024-01-15T10:00:01Z"},
+		{"role":"user","content":"first","created_at":"2024-01-15T10:00:00Z","metadata":{"source":"legacy"}},
+		{"role":"user","content":"third","created_at":"2024-01-15T10:00:02Z"},
+		{"role":"assistant","content":"fourth","created_at":"2024-01-15T10:00:02Z"}
+	]}`)
+	assert.Equal(t, http.StatusOK, rec.Code, rec.Body.String())
+	var resp domain.MessageImportResponse
+	assert.NoError(t, json.Unmarshal(rec.Body.Bytes(), &resp))
+	assert.Equal(t, 4, resp.ImportedCount)
+
+	session, err := db.GetSession(ctx, "s1")
+	assert.NoError(t, err)
+	assert.Equal(t, "u1", session.UserID)
+
+	stored, err := db.GetRecentMessages(ctx, "s1", 0)
+	assert.NoError(t, err)
+	var contents []string
+	for _, m := range stored {
+		contents = append(contents, m.Content)
+	}
+	assert.Equal(t, []string{"first", "second", "third", "fourth"}, contents)
+	assert.JSONEq(t, `{"source":"legacy"}`, string(stored[0].Metadata))
+	for i, m := range resp.Messages {
+		assert.Equal(t, stored[i].MessageID, m.MessageID)
+	}
+}
+
+func TestImportSessionMessagesErrors(t *testing.T) {
+	h, db := newTestHandler(t)
+	ctx := context.Background()
+
+	rec := importMessages(t, h, "missing", `{"messages":[{"role":"user","content":"hi"}]}`)
+	assert.Equal(t, http.StatusNotFound, rec.Code)
+
+	assert.NoError(t, db.CreateSession(ctx, &domain.Session{SessionID: "s1", UserID: "u1", CreatedAt: time.Now()}))
+	rec = importMessages(t, h, "s1", `{"messages":[]}`)
+	assert.Equal(t, http.StatusBadRequest, rec.Code)
+
+	// One bad role rejects the whole import.
+	rec = importMessages(t, h, "s1", `{"messages":[{"role":"user","content":"hi"},{"role":"robot","content":"beep"}]}`)
+	assert.Equal(t, http.StatusBadRequest, rec.Code)
+	stored, err := db.GetRecentMessages(ctx, "s1", 0)
+	assert.NoError(t, err)
+	assert.Empty(t, stored)
+}
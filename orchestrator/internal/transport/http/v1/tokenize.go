@@ -0,0 +1,23 @@
+package v1
+
+import (
+	"net/http"
+
+	"github.com/labstack/echo/v4"
+	"github.com/xiaot623/gogo/orchestrator/internal/domain"
+)
+
+// Tokenize counts the tokens of each message for a model, so clients can
+// check what fits its context before invoking.
+// POST /v1/tokenize
+func (h *Handler) Tokenize(c echo.Context) error {
+	var req domain.TokenizeRequest
+	if err := c.Bind(&req); err != nil {
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": "invalid request body"})
+	}
+	if len(req.Messages) == 0 {
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": "messages is required"})
+	}
+
+	return c.JSON(http.StatusOK, h.service.CountTokens(req))
+}
@@ -0,0 +1,40 @@
+package v1
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/labstack/echo/v4"
+	"github.com/stretchr/testify/assert"
+	"github.com/xiaot623/gogo/orchestrator/internal/domain"
+)
+
+func TestTokenize(t *testing.T) {
+	e := echo.New()
+	handler, _ := newTestHandler(t)
+
+	post := func(body string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodPost, "/v1/tokenize", bytes.NewReader([]byte(body)))
+		req.Header.Set(echo.HeaderContentType, echo.MIMEApplicationJSON)
+		rec := httptest.NewRecorder()
+		assert.NoError(t, handler.Tokenize(e.NewContext(req, rec)))
+		return rec
+	}
+
+	rec := post(`{"model":"gpt-4o","messages":[{"role":"system","content":"be brief"},{"role":"user","content":"hello there, how long is this?"}]}`)
+	assert.Equal(t, http.StatusOK, rec.Code)
+	var resp domain.TokenizeResponse
+	assert.NoError(t, json.Unmarshal(rec.Body.Bytes(), &resp))
+	assert.Equal(t, "gpt-4o", resp.Model)
+	assert.Equal(t, "approximate", resp.Tokenizer)
+	if assert.Len(t, resp.Messages, 2) {
+		assert.Greater(t, resp.Messages[1], resp.Messages[0])
+		assert.Equal(t, resp.Messages[0]+resp.Messages[1], resp.Total)
+	}
+
+	rec = post(`{"model":"gpt-4o","messages":[]}`)
+	assert.Equal(t, http.StatusBadRequest, rec.Code)
+}
@@ -1,11 +1,13 @@
 package v1
 
 import (
+	"errors"
 	"net/http"
 	"strconv"
 
 	"github.com/labstack/echo/v4"
 	"github.com/xiaot623/gogo/orchestrator/internal/domain"
+	"github.com/xiaot623/gogo/orchestrator/internal/service"
 )
 
 // ListTools returns all registered tools.
@@ -20,16 +22,51 @@ func (h *Handler) ListTools(c echo.Context) error {
 	items := make([]domain.ToolListItem, 0, len(tools))
 	for _, t := range tools {
 		items = append(items, domain.ToolListItem{
-			Name:      t.Name,
-			Source:    string(t.Kind), // Kind is "server" or "client"
-			Schema:    t.Schema,
-			TimeoutMs: t.TimeoutMs,
+			Name:         t.Name,
+			Source:       string(t.Kind), // Kind is "server", "client" or "http"
+			Schema:       t.Schema,
+			ResultSchema: t.ResultSchema,
+			TimeoutMs:    t.TimeoutMs,
 		})
 	}
 
 	return c.JSON(http.StatusOK, domain.ListToolsResponse{Tools: items})
 }
 
+// RegisterTools registers client tools and http tools, whose calls the
+// orchestrator makes to the endpoint in their metadata.
+// POST /v1/tools
+func (h *Handler) RegisterTools(c echo.Context) error {
+	var req domain.ToolRegistrationRequest
+	if err := c.Bind(&req); err != nil {
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": "invalid request body"})
+	}
+	if len(req.Tools) == 0 {
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": "tools array is required"})
+	}
+	for _, t := range req.Tools {
+		if t.Name == "" {
+			return c.JSON(http.StatusBadRequest, map[string]string{"error": "tool name is required"})
+		}
+	}
+
+	resp, err := h.service.RegisterTools(c.Request().Context(), req)
+	if errors.Is(err, service.ErrMaintenance) {
+		return c.JSON(http.StatusServiceUnavailable, map[string]string{"error": err.Error(), "code": "maintenance"})
+	}
+	if errors.Is(err, service.ErrInvalidTool) {
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": err.Error(), "code": "invalid_tool"})
+	}
+	if errors.Is(err, service.ErrInvalidResultSchema) {
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": err.Error(), "code": "invalid_result_schema"})
+	}
+	if err != nil {
+		return c.JSON(http.StatusInternalServerError, map[string]string{"error": err.Error()})
+	}
+
+	return c.JSON(http.StatusOK, resp)
+}
+
 // InvokeTool handles tool invocation.
 func (h *Handler) InvokeTool(c echo.Context) error {
 	toolName := c.Param("tool_name")
@@ -41,6 +78,15 @@ func (h *Handler) InvokeTool(c echo.Context) error {
 	ctx := c.Request().Context()
 
 	resp, err := h.service.InvokeTool(ctx, toolName, req)
+	if errors.Is(err, service.ErrMaintenance) {
+		return c.JSON(http.StatusServiceUnavailable, map[string]string{"error": err.Error(), "code": "maintenance"})
+	}
+	if errors.Is(err, service.ErrRunDeadlineExceeded) {
+		return c.JSON(http.StatusConflict, map[string]string{"error": err.Error(), "code": "run_deadline_exceeded"})
+	}
+	if errors.Is(err, service.ErrTooManyToolCalls) {
+		return c.JSON(http.StatusTooManyRequests, map[string]string{"error": err.Error(), "code": "too_many_tool_calls"})
+	}
 	if err != nil {
 		return c.JSON(http.StatusInternalServerError, map[string]string{"error": err.Error()})
 	}
@@ -114,3 +160,66 @@ func (h *Handler) WaitToolCall(c echo.Context) error {
 
 	return c.JSON(http.StatusOK, resp)
 }
+
+// SubmitToolResult submits the result of a client tool call.
+// POST /v1/tool_calls/:tool_call_id/submit
+func (h *Handler) SubmitToolResult(c echo.Context) error {
+	toolCallID := c.Param("tool_call_id")
+	var req domain.ToolCallResultRequest
+	if err := c.Bind(&req); err != nil {
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": "invalid request body"})
+	}
+
+	if req.Status != "SUCCEEDED" && req.Status != "FAILED" {
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": "status must be SUCCEEDED or FAILED"})
+	}
+
+	ctx := c.Request().Context()
+
+	resp, err := h.service.SubmitToolResult(ctx, toolCallID, req)
+	if errors.Is(err, service.ErrNotClientTool) {
+		return c.JSON(http.StatusConflict, map[string]string{"error": err.Error(), "code": "not_client_tool"})
+	}
+	if errors.Is(err, service.ErrResultTooLarge) {
+		return c.JSON(http.StatusRequestEntityTooLarge, map[string]string{"error": err.Error(), "code": "result_too_large"})
+	}
+	if errors.Is(err, service.ErrNonceReused) {
+		return c.JSON(http.StatusConflict, map[string]string{"error": err.Error(), "code": "nonce_reused"})
+	}
+	if errors.Is(err, service.ErrNonceInFlight) {
+		return c.JSON(http.StatusConflict, map[string]string{"error": err.Error(), "code": "nonce_in_flight"})
+	}
+	if err != nil {
+		return c.JSON(http.StatusInternalServerError, map[string]string{"error": err.Error()})
+	}
+
+	return c.JSON(http.StatusOK, resp)
+}
+
+// SubmitToolProgress submits a chunk of incremental output from a running
+// client tool call.
+// POST /v1/tool_calls/:tool_call_id/progress
+func (h *Handler) SubmitToolProgress(c echo.Context) error {
+	toolCallID := c.Param("tool_call_id")
+
+	var req domain.ToolProgressRequest
+	if err := c.Bind(&req); err != nil {
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": "invalid request body"})
+	}
+	if req.Seq <= 0 {
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": "seq must be positive"})
+	}
+
+	resp, err := h.service.SubmitToolProgress(c.Request().Context(), toolCallID, req)
+	if errors.Is(err, service.ErrNotClientTool) {
+		return c.JSON(http.StatusConflict, map[string]string{"error": err.Error(), "code": "not_client_tool"})
+	}
+	if errors.Is(err, service.ErrTooManyProgressChunks) {
+		return c.JSON(http.StatusTooManyRequests, map[string]string{"error": err.Error(), "code": "too_many_progress_chunks"})
+	}
+	if err != nil {
+		return c.JSON(http.StatusInternalServerError, map[string]string{"error": err.Error()})
+	}
+
+	return c.JSON(http.StatusOK, resp)
+}
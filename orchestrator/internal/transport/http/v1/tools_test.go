@@ -156,3 +156,43 @@ func TestInvokeTool(t *testing.T) {
 		assert.Equal(t, "waiting_approval", resp.Reason)
 	})
 }
+
+func TestSubmitToolResultRequiresClientTool(t *testing.T) {
+	ctx := context.Background()
+	e := echo.New()
+	handler, store := newTestHandler(t)
+
+	store.CreateSession(ctx, &domain.Session{SessionID: "s1", UserID: "u1"})
+	store.CreateRun(ctx, &domain.Run{RunID: "r1", SessionID: "s1", RootAgentID: "a1", Status: domain.RunStatusRunning})
+	for _, tc := range []*domain.ToolCall{
+		{ToolCallID: "tc_server", RunID: "r1", ToolName: "weather.query", Kind: domain.ToolKindServer, Status: domain.ToolCallStatusRunning, Args: json.RawMessage(`{}`)},
+		{ToolCallID: "tc_client", RunID: "r1", ToolName: "browser.screenshot", Kind: domain.ToolKindClient, Status: domain.ToolCallStatusDispatched, Args: json.RawMessage(`{}`)},
+	} {
+		assert.NoError(t, store.CreateToolCall(ctx, tc))
+	}
+
+	submit := func(toolCallID string) *httptest.ResponseRecorder {
+		body := []byte(`{"status":"SUCCEEDED","result":{"forged":true}}`)
+		req := httptest.NewRequest(http.MethodPost, "/v1/tool_calls/"+toolCallID+"/submit", bytes.NewReader(body))
+		req.Header.Set(echo.HeaderContentType, echo.MIMEApplicationJSON)
+		rec := httptest.NewRecorder()
+		c := e.NewContext(req, rec)
+		c.SetParamNames("tool_call_id")
+		c.SetParamValues(toolCallID)
+		assert.NoError(t, handler.SubmitToolResult(c))
+		return rec
+	}
+
+	rec := submit("tc_server")
+	assert.Equal(t, http.StatusConflict, rec.Code)
+	assert.Contains(t, rec.Body.String(), "not_client_tool")
+	tc, err := store.GetToolCall(ctx, "tc_server")
+	assert.NoError(t, err)
+	assert.Equal(t, domain.ToolCallStatusRunning, tc.Status)
+
+	rec = submit("tc_client")
+	assert.Equal(t, http.StatusOK, rec.Code)
+	tc, err = store.GetToolCall(ctx, "tc_client")
+	assert.NoError(t, err)
+	assert.Equal(t, domain.ToolCallStatusSucceeded, tc.Status)
+}
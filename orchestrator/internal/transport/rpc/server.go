@@ -1,15 +1,19 @@
 package rpc
 
 import (
+	"bytes"
 	"context"
+	"encoding/json"
 	"errors"
 	"fmt"
-	"log"
+	"io"
+	"log/slog"
 	"net"
 	"net/rpc"
 	"net/rpc/jsonrpc"
 	"strings"
 
+	"github.com/xiaot623/gogo/orchestrator/internal/adapter/ingress"
 	"github.com/xiaot623/gogo/orchestrator/internal/domain"
 	"github.com/xiaot623/gogo/orchestrator/internal/service"
 )
@@ -19,20 +23,43 @@ type Server struct {
 	listener  net.Listener
 	rpcServer *rpc.Server
 	done      chan struct{}
+	streams   EventStreamer
+}
+
+// EventStreamer serves the event streams ingress opens on the RPC port.
+type EventStreamer interface {
+	// ServeEventStream serves the stream on conn, reading from r, and
+	// returns when it closes.
+	ServeEventStream(conn net.Conn, r io.Reader)
+}
+
+// Option configures a Server.
+type Option func(*Server)
+
+// WithEventStreams hands connections whose first request is
+// Orchestrator.SubscribeEvents to streams instead of the RPC handler.
+func WithEventStreams(streams EventStreamer) Option {
+	return func(s *Server) {
+		s.streams = streams
+	}
 }
 
 // NewServer creates a new RPC server bound to the orchestrator service.
-func NewServer(svc *service.Service) (*Server, error) {
+func NewServer(svc *service.Service, opts ...Option) (*Server, error) {
 	rpcServer := rpc.NewServer()
 	handler := &Handler{service: svc}
 	if err := rpcServer.RegisterName("Orchestrator", handler); err != nil {
 		return nil, fmt.Errorf("register rpc handler: %w", err)
 	}
 
-	return &Server{
+	s := &Server{
 		rpcServer: rpcServer,
 		done:      make(chan struct{}),
-	}, nil
+	}
+	for _, opt := range opts {
+		opt(s)
+	}
+	return s, nil
 }
 
 // Start begins accepting RPC connections on the given address.
@@ -50,12 +77,49 @@ func (s *Server) Start(addr string) error {
 				close(s.done)
 				return nil
 			}
-			log.Printf("RPC accept error: %v", err)
+			slog.Error("RPC accept error", "error", err)
 			continue
 		}
 
-		go s.rpcServer.ServeCodec(jsonrpc.NewServerCodec(conn))
+		go s.serveConn(conn)
+	}
+}
+
+// serveConn serves one connection: an event stream when its first request
+// opens one, JSON-RPC calls otherwise.
+func (s *Server) serveConn(conn net.Conn) {
+	if s.streams == nil {
+		s.rpcServer.ServeCodec(jsonrpc.NewServerCodec(conn))
+		return
+	}
+
+	dec := json.NewDecoder(conn)
+	var first json.RawMessage
+	if err := dec.Decode(&first); err != nil {
+		conn.Close()
+		return
 	}
+	r := io.MultiReader(bytes.NewReader(first), dec.Buffered(), conn)
+
+	var head struct {
+		Method string `json:"method"`
+	}
+	if json.Unmarshal(first, &head) == nil && head.Method == ingress.SubscribeEventsMethod {
+		s.streams.ServeEventStream(conn, r)
+		return
+	}
+	s.rpcServer.ServeCodec(jsonrpc.NewServerCodec(&replayConn{Conn: conn, r: r}))
+}
+
+// replayConn is a connection whose reads start with bytes already consumed
+// from it.
+type replayConn struct {
+	net.Conn
+	r io.Reader
+}
+
+func (c *replayConn) Read(p []byte) (int, error) {
+	return c.r.Read(p)
 }
 
 // Shutdown stops accepting new RPC connections.
@@ -81,30 +145,72 @@ type Handler struct {
 	service *service.Service
 }
 
+// ToolInvokeArgs wraps a tool name with the invocation payload.
+type ToolInvokeArgs struct {
+	ToolName string                   `json:"tool_name"`
+	Request  domain.ToolInvokeRequest `json:"request"`
+}
+
 // ToolCallResultArgs wraps tool call IDs with the tool result payload.
 type ToolCallResultArgs struct {
 	ToolCallID string                       `json:"tool_call_id"`
 	Request    domain.ToolCallResultRequest `json:"request"`
 }
 
+// ToolProgressArgs wraps tool call IDs with a progress chunk.
+type ToolProgressArgs struct {
+	ToolCallID string                     `json:"tool_call_id"`
+	Request    domain.ToolProgressRequest `json:"request"`
+}
+
 // ApprovalDecisionArgs wraps approval IDs with the decision payload.
 type ApprovalDecisionArgs struct {
 	ApprovalID string                         `json:"approval_id"`
 	Request    domain.ApprovalDecisionRequest `json:"request"`
 }
 
-// CancelRunRequest identifies a run to cancel.
+// CancelRunRequest identifies a run to cancel and, optionally, why and by
+// whom.
 type CancelRunRequest struct {
-	RunID string `json:"run_id"`
+	RunID     string `json:"run_id"`
+	Reason    string `json:"reason,omitempty"`
+	DecidedBy string `json:"decided_by,omitempty"`
 }
 
-// CancelRunResponse is returned after a run cancellation request.
+// CancelRunResponse is returned after a run cancellation request. Reason and
+// DecidedBy are those recorded when the run was cancelled.
 type CancelRunResponse struct {
-	RunID   string           `json:"run_id"`
-	Status  domain.RunStatus `json:"status"`
-	Message string           `json:"message"`
+	RunID     string           `json:"run_id"`
+	Status    domain.RunStatus `json:"status"`
+	Message   string           `json:"message"`
+	Reason    string           `json:"reason,omitempty"`
+	DecidedBy string           `json:"decided_by,omitempty"`
+}
+
+// SessionDisconnectedArgs identifies a session that has no connection left
+// at ingress.
+type SessionDisconnectedArgs struct {
+	SessionID string `json:"session_id"`
 }
 
+// ListRunsArgs selects a session's runs. Active keeps only runs that have not
+// ended; Limit defaults to defaultListRunsLimit.
+type ListRunsArgs struct {
+	SessionID string `json:"session_id"`
+	Active    bool   `json:"active,omitempty"`
+	Limit     int    `json:"limit,omitempty"`
+}
+
+// ListRunsResponse lists a session's runs, newest first.
+type ListRunsResponse struct {
+	Runs []domain.RunSummary `json:"runs"`
+}
+
+const (
+	defaultListRunsLimit = 20
+	maxListRunsLimit     = 100
+)
+
 // AckResponse is a generic OK response.
 type AckResponse struct {
 	OK bool `json:"ok"`
@@ -148,6 +254,30 @@ func (h *Handler) RegisterTools(req *domain.ToolRegistrationRequest, resp *domai
 	return nil
 }
 
+// InvokeTool invokes a tool within a run. It shares the service path with
+// POST /v1/tools/:tool_name/invoke, so server tools return pending and run
+// asynchronously and client tools are pushed to ingress.
+func (h *Handler) InvokeTool(req *ToolInvokeArgs, resp *domain.ToolInvokeResponse) error {
+	if req == nil {
+		return errors.New("tool invoke request is required")
+	}
+	if req.ToolName == "" {
+		return errors.New("tool_name is required")
+	}
+	if req.Request.RunID == "" {
+		return errors.New("run_id is required")
+	}
+
+	result, err := h.service.InvokeTool(context.Background(), req.ToolName, req.Request)
+	if err != nil {
+		return err
+	}
+	if resp != nil && result != nil {
+		*resp = *result
+	}
+	return nil
+}
+
 // SubmitToolResult submits a tool call result.
 func (h *Handler) SubmitToolResult(req *ToolCallResultArgs, resp *domain.ToolCallResultResponse) error {
 	if req == nil {
@@ -170,6 +300,25 @@ func (h *Handler) SubmitToolResult(req *ToolCallResultArgs, resp *domain.ToolCal
 	return nil
 }
 
+// SubmitToolProgress records a progress chunk of a running client tool call.
+func (h *Handler) SubmitToolProgress(req *ToolProgressArgs, resp *domain.ToolProgressResponse) error {
+	if req == nil {
+		return errors.New("tool progress request is required")
+	}
+	if req.ToolCallID == "" {
+		return errors.New("tool_call_id is required")
+	}
+
+	result, err := h.service.SubmitToolProgress(context.Background(), req.ToolCallID, req.Request)
+	if err != nil {
+		return err
+	}
+	if resp != nil && result != nil {
+		*resp = *result
+	}
+	return nil
+}
+
 // SubmitApprovalDecision records an approval decision.
 func (h *Handler) SubmitApprovalDecision(req *ApprovalDecisionArgs, resp *AckResponse) error {
 	if req == nil {
@@ -184,6 +333,9 @@ func (h *Handler) SubmitApprovalDecision(req *ApprovalDecisionArgs, resp *AckRes
 		return errors.New("decision must be approve or reject")
 	}
 	req.Request.Decision = decision
+	if !service.ValidRememberScope(req.Request.Remember) {
+		return service.ErrInvalidRememberScope
+	}
 
 	if err := h.service.UpdateApproval(context.Background(), req.ApprovalID, req.Request); err != nil {
 		return err
@@ -203,13 +355,96 @@ func (h *Handler) CancelRun(req *CancelRunRequest, resp *CancelRunResponse) erro
 		return errors.New("run_id is required")
 	}
 
-	if err := h.service.CancelRun(context.Background(), req.RunID); err != nil {
+	ctx := context.Background()
+	if err := h.service.CancelRun(ctx, req.RunID, domain.CancelRunRequest{Reason: req.Reason, DecidedBy: req.DecidedBy}); err != nil {
 		return err
 	}
 	if resp != nil {
 		resp.RunID = req.RunID
 		resp.Status = domain.RunStatusCancelled
 		resp.Message = "run cancelled successfully"
+		run, err := h.service.GetRun(ctx, req.RunID)
+		switch {
+		case err != nil || run == nil:
+		case run.Status != domain.RunStatusCancelled:
+			// A run that had already finished keeps its own terminal status.
+			resp.Status = run.Status
+			resp.Message = "run already finished"
+		default:
+			var cancelled domain.RunCancelledPayload
+			if json.Unmarshal(run.Error, &cancelled) == nil {
+				resp.Reason = cancelled.Reason
+				resp.DecidedBy = cancelled.DecidedBy
+			}
+		}
+	}
+	return nil
+}
+
+// SessionDisconnected is called by ingress when the last connection of a
+// session closes.
+func (h *Handler) SessionDisconnected(req *SessionDisconnectedArgs, resp *domain.SessionDisconnectedResponse) error {
+	if req == nil {
+		return errors.New("session disconnected request is required")
+	}
+	if req.SessionID == "" {
+		return errors.New("session_id is required")
+	}
+
+	result, err := h.service.SessionDisconnected(context.Background(), req.SessionID)
+	if err != nil {
+		return err
+	}
+	if resp != nil && result != nil {
+		*resp = *result
+	}
+	return nil
+}
+
+// ListRuns lists a session's runs that have not been archived, newest first,
+// so a reconnecting client can restore the ones still in flight.
+func (h *Handler) ListRuns(req *ListRunsArgs, resp *ListRunsResponse) error {
+	if req == nil {
+		return errors.New("list runs request is required")
+	}
+	if req.SessionID == "" {
+		return errors.New("session_id is required")
+	}
+
+	limit := req.Limit
+	if limit <= 0 {
+		limit = defaultListRunsLimit
+	}
+	if limit > maxListRunsLimit {
+		limit = maxListRunsLimit
+	}
+	runs, err := h.service.ListRuns(context.Background(), domain.RunFilter{
+		SessionID:  req.SessionID,
+		Unarchived: true,
+		Active:     req.Active,
+		Limit:      limit,
+	})
+	if err != nil {
+		return err
+	}
+	if resp != nil {
+		resp.Runs = runs
+	}
+	return nil
+}
+
+// AckEvents records how far a client device has handled a run's events, so
+// GET /v1/runs/:run_id/events can resume from there for that device.
+func (h *Handler) AckEvents(req *domain.EventAckRequest, resp *AckResponse) error {
+	if req == nil {
+		return errors.New("ack request is required")
+	}
+
+	if err := h.service.AckEvents(context.Background(), *req); err != nil {
+		return err
+	}
+	if resp != nil {
+		resp.OK = true
 	}
 	return nil
 }
@@ -2,78 +2,192 @@ package main
 
 import (
 	"context"
+	"flag"
 	"fmt"
 	"log"
+	"log/slog"
 	"net/http"
 	"os"
 	"os/signal"
 	"syscall"
 	"time"
 
+	"github.com/labstack/echo/v4"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
 	"github.com/xiaot623/gogo/orchestrator/internal/adapter/agentclient"
 	"github.com/xiaot623/gogo/orchestrator/internal/adapter/ingress"
 	"github.com/xiaot623/gogo/orchestrator/internal/adapter/llm"
+	"github.com/xiaot623/gogo/orchestrator/internal/adapter/webhook"
+	"github.com/xiaot623/gogo/orchestrator/internal/archive"
 	"github.com/xiaot623/gogo/orchestrator/internal/config"
+	"github.com/xiaot623/gogo/orchestrator/internal/domain"
+	"github.com/xiaot623/gogo/orchestrator/internal/idgen"
+	"github.com/xiaot623/gogo/orchestrator/internal/logging"
+	"github.com/xiaot623/gogo/orchestrator/internal/metrics"
 	"github.com/xiaot623/gogo/orchestrator/internal/repository"
 	"github.com/xiaot623/gogo/orchestrator/internal/service"
+	"github.com/xiaot623/gogo/orchestrator/internal/telemetry"
 	transport "github.com/xiaot623/gogo/orchestrator/internal/transport/http"
 	internalrpc "github.com/xiaot623/gogo/orchestrator/internal/transport/rpc"
 	"github.com/xiaot623/gogo/orchestrator/policy"
 )
 
 func main() {
+	configPath := flag.String("config", os.Getenv("CONFIG_FILE"), "path to a YAML or JSON config file (env vars override file values)")
+	flag.Parse()
+
 	// Load configuration
-	cfg := config.Load()
+	cfg, err := config.LoadFile(*configPath)
+	if err != nil {
+		log.Fatalf("Failed to load configuration: %v", err)
+	}
+
+	// Structured logging; the standard log package is routed through it too
+	logger := logging.New(os.Stderr, cfg.LogLevel, cfg.LogFormat)
+	slog.SetDefault(logger)
+	fatal := func(msg string, err error) {
+		logger.Error(msg, "error", err)
+		os.Exit(1)
+	}
+
+	logger.Info("starting orchestrator",
+		"http_port", cfg.HTTPPort,
+		"internal_port", cfg.InternalPort,
+		"database", cfg.DatabaseURL,
+		"litellm_url", cfg.LiteLLMURL)
+	if len(cfg.APIKeys) == 0 {
+		logger.Warn("API_KEYS is not set; the external API accepts unauthenticated requests")
+	}
 
-	log.Printf("Starting orchestrator...")
-	log.Printf("External HTTP Port: %d", cfg.HTTPPort)
-	log.Printf("Internal RPC Port: %d", cfg.InternalPort)
-	log.Printf("Database: %s", cfg.DatabaseURL)
-	log.Printf("LiteLLM URL: %s", cfg.LiteLLMURL)
+	// Initialize tracing (no-op unless an OTLP endpoint is configured)
+	shutdownTracing, err := telemetry.Setup(context.Background(), cfg.OTelEndpoint, "orchestrator")
+	if err != nil {
+		fatal("failed to initialize tracing", err)
+	}
 
 	// Initialize store
-	db, err := store.NewSQLiteStore(cfg.DatabaseURL)
+	db, err := store.NewSQLiteStoreWithReadDSN(cfg.DatabaseURL, cfg.ReadDatabaseURL)
 	if err != nil {
-		log.Fatalf("Failed to initialize store: %v", err)
+		fatal("failed to initialize store", err)
 	}
 	defer db.Close()
 
+	// Fail fast if the database is not reachable after migrations
+	pingCtx, pingCancel := context.WithTimeout(context.Background(), 5*time.Second)
+	err = db.Ping(pingCtx)
+	pingCancel()
+	if err != nil {
+		fatal("failed to reach database", err)
+	}
+
 	// Initialize agent client
-	agentClient := agentclient.NewClient()
+	agentClient := agentclient.NewClient(
+		agentclient.WithTransport(agentclient.NewTransport(agentclient.TransportConfig{
+			DialTimeout:           cfg.AgentDialTimeout,
+			KeepAlive:             cfg.AgentKeepAlive,
+			TLSHandshakeTimeout:   cfg.AgentTLSHandshakeTimeout,
+			ResponseHeaderTimeout: cfg.AgentResponseHeaderTimeout,
+			IdleConnTimeout:       cfg.AgentIdleConnTimeout,
+			MaxIdleConnsPerHost:   cfg.AgentMaxIdleConnsPerHost,
+		})),
+		agentclient.WithReadBufferSize(cfg.AgentReadBufferBytes),
+		agentclient.WithMaxFrameSize(cfg.AgentMaxFrameBytes),
+	)
 
 	// Initialize ingress client
-	ingressClient := ingress.NewClient(cfg.IngressRPCAddr)
+	ingressClient := ingress.NewClient(cfg.IngressRPCAddr, ingress.WithQueueSize(cfg.IngressQueueSize))
 
 	// Initialize LLM client (uses mock if GOGO_MODE=MOCK)
 	llmClient := llm.NewLLMClient(cfg.LiteLLMURL, cfg.LiteLLMAPIKey, cfg.LLMTimeout)
 
+	// Fail fast while LiteLLM is down instead of waiting out LLMTimeout
+	var llmBreaker *llm.Breaker
+	if cfg.LLMBreakerFailures > 0 {
+		llmBreaker = llm.NewBreaker(llmClient, cfg.LLMBreakerFailures, cfg.LLMBreakerCooldown)
+		llmClient = llmBreaker
+	}
+
 	// Initialize policy engine
 	ctx := context.Background()
 	policyEngine, err := policy.NewEngine(ctx, policy.DefaultPolicy)
 	if err != nil {
-		log.Fatalf("Failed to initialize policy engine: %v", err)
+		fatal("failed to initialize policy engine", err)
+	}
+
+	// Move old runs to cold storage when archival is enabled
+	svcOpts := []service.Option{
+		service.WithLogger(logger),
+		service.WithIDGenerator(idgen.WithNamespace(idgen.Default, cfg.IDNamespace)),
+	}
+	if cfg.RunArchiveAfter > 0 {
+		archiver, err := archive.NewDir(cfg.RunArchiveDir)
+		if err != nil {
+			fatal("failed to initialize run archive", err)
+		}
+		svcOpts = append(svcOpts, service.WithArchiver(archiver))
+	}
+
+	// Deliver recorded events to an external webhook when configured
+	var eventWebhook *webhook.Sink
+	if cfg.EventWebhookURL != "" {
+		eventWebhook = webhook.New(webhook.Config{
+			URL:         cfg.EventWebhookURL,
+			Secret:      cfg.EventWebhookSecret,
+			Timeout:     cfg.EventWebhookTimeout,
+			MaxAttempts: cfg.EventWebhookMaxAttempts,
+			Backoff:     cfg.EventWebhookRetryBackoff,
+			QueueSize:   cfg.EventWebhookQueueSize,
+		}, logger)
+		types := make([]domain.EventType, len(cfg.EventWebhookEventTypes))
+		for i, t := range cfg.EventWebhookEventTypes {
+			types[i] = domain.EventType(t)
+		}
+		svcOpts = append(svcOpts, service.WithEventSink(eventWebhook, types...))
 	}
 
 	// Initialize service
-	svc := service.New(db, agentClient, ingressClient, llmClient, cfg, policyEngine)
+	svc := service.New(db, agentClient, ingressClient, llmClient, cfg, policyEngine, svcOpts...)
+
+	// Register agents defined in config
+	if err := svc.BootstrapAgents(ctx); err != nil {
+		fatal("failed to register bootstrap agents", err)
+	}
 
 	// Start background monitors (best-effort)
 	bgCtx, bgCancel := context.WithCancel(context.Background())
 	defer bgCancel()
 	go svc.RunToolCallTimeoutMonitor(bgCtx)
+	go svc.RunDeadlineMonitor(bgCtx)
+	go svc.RunArchiveMonitor(bgCtx)
+	if eventWebhook != nil {
+		go eventWebhook.Run(bgCtx)
+	}
 
 	// Create servers
-	externalServer := transport.NewExternalServer(svc)
-	rpcServer, err := internalrpc.NewServer(svc)
+	externalServer := transport.NewExternalServer(svc, cfg)
+
+	// Expose agent stream and policy metrics for Prometheus
+	registry := prometheus.NewRegistry()
+	registry.MustRegister(metrics.NewStreamCollector(svc))
+	registry.MustRegister(metrics.NewPolicyCollector(svc))
+	registry.MustRegister(metrics.NewAgentLoadCollector(svc))
+	registry.MustRegister(metrics.NewToolCollector(svc))
+	registry.MustRegister(metrics.NewIngressQueueCollector(ingressClient))
+	if llmBreaker != nil {
+		registry.MustRegister(metrics.NewBreakerCollector(llmBreaker))
+	}
+	externalServer.GET("/metrics", echo.WrapHandler(promhttp.HandlerFor(registry, promhttp.HandlerOpts{})))
+	rpcServer, err := internalrpc.NewServer(svc, internalrpc.WithEventStreams(ingressClient))
 	if err != nil {
-		log.Fatalf("Failed to initialize internal RPC server: %v", err)
+		fatal("failed to initialize internal RPC server", err)
 	}
 
 	// Start external server
 	go func() {
 		addr := fmt.Sprintf(":%d", cfg.HTTPPort)
 		if err := externalServer.Start(addr); err != nil && err != http.ErrServerClosed {
-			log.Fatalf("Failed to start external server: %v", err)
+			fatal("failed to start external server", err)
 		}
 	}()
 
@@ -81,19 +195,21 @@ func main() {
 	go func() {
 		addr := fmt.Sprintf(":%d", cfg.InternalPort)
 		if err := rpcServer.Start(addr); err != nil {
-			log.Fatalf("Failed to start internal RPC server: %v", err)
+			fatal("failed to start internal RPC server", err)
 		}
 	}()
 
-	log.Printf("External API started on port %d", cfg.HTTPPort)
-	log.Printf("Internal RPC started on port %d", cfg.InternalPort)
+	logger.Info("orchestrator started", "http_port", cfg.HTTPPort, "internal_port", cfg.InternalPort)
+
+	// Startup complete: /ready now reports 200 while the store stays reachable
+	svc.MarkReady()
 
 	// Wait for interrupt signal
 	quit := make(chan os.Signal, 1)
 	signal.Notify(quit, syscall.SIGINT, syscall.SIGTERM)
 	<-quit
 
-	log.Println("Shutting down orchestrator...")
+	logger.Info("shutting down orchestrator")
 	bgCancel()
 
 	// Graceful shutdown
@@ -102,11 +218,14 @@ func main() {
 
 	// Shutdown both servers
 	if err := externalServer.Shutdown(shutdownCtx); err != nil {
-		log.Printf("Failed to shutdown external server gracefully: %v", err)
+		logger.Error("failed to shutdown external server gracefully", "error", err)
 	}
 	if err := rpcServer.Shutdown(shutdownCtx); err != nil {
-		log.Printf("Failed to shutdown internal RPC server gracefully: %v", err)
+		logger.Error("failed to shutdown internal RPC server gracefully", "error", err)
+	}
+	if err := shutdownTracing(shutdownCtx); err != nil {
+		logger.Error("failed to flush traces", "error", err)
 	}
 
-	log.Println("Orchestrator stopped")
+	logger.Info("orchestrator stopped")
 }
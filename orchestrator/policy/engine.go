@@ -2,6 +2,8 @@ package policy
 
 import (
 	"context"
+	"crypto/sha256"
+	"encoding/hex"
 	"fmt"
 
 	"github.com/open-policy-agent/opa/rego"
@@ -9,7 +11,8 @@ import (
 
 // Engine is the OPA policy engine.
 type Engine struct {
-	query rego.PreparedEvalQuery
+	query   rego.PreparedEvalQuery
+	version string
 }
 
 // NewEngine creates a new policy engine with the given policy content.
@@ -25,7 +28,14 @@ func NewEngine(ctx context.Context, policyContent string) (*Engine, error) {
 		return nil, fmt.Errorf("failed to prepare rego: %w", err)
 	}
 
-	return &Engine{query: query}, nil
+	sum := sha256.Sum256([]byte(policyContent))
+	return &Engine{query: query, version: "sha256:" + hex.EncodeToString(sum[:])[:12]}, nil
+}
+
+// Version identifies the loaded policy content. It changes whenever the
+// policy source changes.
+func (e *Engine) Version() string {
+	return e.version
 }
 
 // Evaluate checks the tool policy.
@@ -28,6 +28,7 @@ class SSEEventType(str, Enum):
     """SSE event types that agents can emit."""
 
     DELTA = "delta"
+    REASONING = "reasoning"
     STATE = "state"
     DONE = "done"
     ERROR = "error"
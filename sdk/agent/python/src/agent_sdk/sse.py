@@ -76,6 +76,20 @@ class SSEResponse:
         event = DeltaEvent(text=text, run_id=self.run_id)
         return format_sse_event(SSEEventType.DELTA.value, event.model_dump(exclude_none=True))
 
+    def reasoning(self, text: str) -> str:
+        """
+        Create a reasoning event for model "thinking" text that should be
+        shown separately from the answer and kept out of the final message.
+
+        Args:
+            text: The reasoning chunk to stream
+
+        Returns:
+            Formatted SSE event string
+        """
+        event = DeltaEvent(text=text, run_id=self.run_id)
+        return format_sse_event(SSEEventType.REASONING.value, event.model_dump(exclude_none=True))
+
     def state(self, state: str, detail: Optional[dict[str, Any]] = None) -> str:
         """
         Create a state change event.